@@ -0,0 +1,360 @@
+package main
+
+import (
+	"context"
+	"io"
+
+	"github.com/github/git-sizer/counts"
+	"github.com/github/git-sizer/git"
+	"github.com/github/git-sizer/sizes"
+)
+
+// analysisEnv holds what the analyses that run after the main scan
+// need.
+type analysisEnv struct {
+	opts *options
+	repo *git.Repository
+
+	// rg is the `RefGrouper` that the main scan used, without the
+	// wrapper that lists the references.
+	rg sizes.RefGrouper
+
+	// otherRepo is the repository given by `--compare-repo`, if any.
+	otherRepo *git.Repository
+
+	// warn reports a warning to the user.
+	warn func(msg string)
+
+	// lfsCandidates is set by `--lfs-candidates`, whose list replaces
+	// the usual output.
+	lfsCandidates *sizes.LFSCandidates
+}
+
+// analysis is one of the optional analyses that run after the main
+// scan. Most of them add a section to `HistorySize`; some write a
+// file instead.
+type analysis struct {
+	// option is the option that requests the analysis (or, if it is
+	// part of an output format, a description of it).
+	option string
+
+	// wanted reports whether the analysis was requested. It can
+	// depend on the results of the main scan, too.
+	wanted func(o *options, hs *sizes.HistorySize) bool
+
+	// run runs the analysis and records its results.
+	run func(ctx context.Context, env *analysisEnv, hs *sizes.HistorySize) error
+}
+
+// manifestAnalysis writes the `--manifest` file. It comes first, and
+// is also done with `--lfs-candidates`.
+var manifestAnalysis = analysis{
+	option: "--manifest",
+	wanted: func(o *options, _ *sizes.HistorySize) bool { return o.manifestFile != "" },
+	run: func(ctx context.Context, env *analysisEnv, hs *sizes.HistorySize) error {
+		return writeFileAtomically(env.opts.manifestFile, "manifest", func(w io.Writer) error {
+			return hs.WriteBlobManifest(ctx, env.repo, env.rg, env.opts.lfsCandidates, w)
+		})
+	},
+}
+
+// lfsCandidatesAnalyses are the analyses that are done with
+// `--lfs-candidates`.
+var lfsCandidatesAnalyses = []analysis{
+	manifestAnalysis,
+	{
+		option: "--lfs-candidates",
+		wanted: func(o *options, _ *sizes.HistorySize) bool { return o.lfsCandidates },
+		run: func(ctx context.Context, env *analysisEnv, hs *sizes.HistorySize) error {
+			lc, err := sizes.FindLFSCandidates(ctx, env.repo, "HEAD", hs.TopBlobs)
+			if err != nil {
+				return err
+			}
+			env.lfsCandidates = lc
+			return nil
+		},
+	},
+}
+
+// analyses are the analyses that are done otherwise, in the order
+// that they are done in.
+var analyses = []analysis{
+	manifestAnalysis,
+	{
+		option: "--attributes",
+		wanted: func(o *options, _ *sizes.HistorySize) bool { return o.attributesRev != "" },
+		run: func(ctx context.Context, env *analysisEnv, hs *sizes.HistorySize) error {
+			ac, err := sizes.CountAttributes(ctx, env.repo, env.opts.attributesRev)
+			if err != nil {
+				return err
+			}
+			hs.Attributes = ac
+			return nil
+		},
+	},
+	{
+		option: "--pack-stats",
+		wanted: func(o *options, _ *sizes.HistorySize) bool { return o.packStats },
+		run: func(ctx context.Context, env *analysisEnv, hs *sizes.HistorySize) error {
+			ps, err := sizes.ComputePackStats(ctx, env.repo, hs.TopBlobs)
+			if err != nil {
+				return err
+			}
+			hs.PackStats = ps
+			return nil
+		},
+	},
+	{
+		option: "--archive-size",
+		wanted: func(o *options, _ *sizes.HistorySize) bool { return o.archiveRev != "" },
+		run: func(ctx context.Context, env *analysisEnv, hs *sizes.HistorySize) error {
+			as, err := sizes.ComputeArchiveSize(ctx, env.repo, env.opts.archiveRev)
+			if err != nil {
+				return err
+			}
+			hs.Archive = as
+			if warning := as.Warning(); warning != "" {
+				env.warn(warning)
+			}
+			return nil
+		},
+	},
+	{
+		option: "--check-submodules",
+		wanted: func(o *options, _ *sizes.HistorySize) bool { return o.checkSubmodules },
+		run: func(ctx context.Context, env *analysisEnv, hs *sizes.HistorySize) error {
+			gc, err := sizes.CheckGitlinks(ctx, env.repo, env.rg)
+			if err != nil {
+				return err
+			}
+			hs.GitlinkCheck = gc
+			return nil
+		},
+	},
+	{
+		option: "--by-remote",
+		wanted: func(o *options, _ *sizes.HistorySize) bool { return o.byRemote },
+		run: func(ctx context.Context, env *analysisEnv, hs *sizes.HistorySize) error {
+			rs, err := sizes.ComputeRemoteSizes(ctx, env.repo, env.rg)
+			if err != nil {
+				return err
+			}
+			hs.Remotes = rs
+			return nil
+		},
+	},
+	{
+		option: "--by-namespace",
+		wanted: func(o *options, _ *sizes.HistorySize) bool { return o.byNamespace },
+		run: func(ctx context.Context, env *analysisEnv, hs *sizes.HistorySize) error {
+			nso, err := sizes.ComputeNamespaceObjects(ctx, env.repo, env.rg)
+			if err != nil {
+				return err
+			}
+			hs.Namespaces = nso
+			return nil
+		},
+	},
+	{
+		option: "--compare-repo",
+		wanted: func(o *options, _ *sizes.HistorySize) bool { return o.compareRepo != "" },
+		run: func(ctx context.Context, env *analysisEnv, hs *sizes.HistorySize) error {
+			rc, err := sizes.ComputeRepoComparison(
+				ctx, env.repo, env.rg, env.otherRepo, env.opts.compareRepo,
+			)
+			if err != nil {
+				return err
+			}
+			hs.Comparison = rc
+			return nil
+		},
+	},
+	{
+		option: "--tag-only",
+		wanted: func(o *options, _ *sizes.HistorySize) bool { return o.tagOnly },
+		run: func(ctx context.Context, env *analysisEnv, hs *sizes.HistorySize) error {
+			tos, err := sizes.ComputeTagOnlySize(ctx, env.repo, env.rg)
+			if err != nil {
+				return err
+			}
+			hs.TagOnly = tos
+			return nil
+		},
+	},
+	{
+		option: "--notes-only",
+		wanted: func(o *options, _ *sizes.HistorySize) bool { return o.notesOnly },
+		run: func(ctx context.Context, env *analysisEnv, hs *sizes.HistorySize) error {
+			nos, err := sizes.ComputeNotesOnlySize(ctx, env.repo, env.rg)
+			if err != nil {
+				return err
+			}
+			hs.NotesOnly = nos
+			return nil
+		},
+	},
+	{
+		option: "--ref-sharing",
+		wanted: func(o *options, _ *sizes.HistorySize) bool { return o.refSharing },
+		run: func(ctx context.Context, env *analysisEnv, hs *sizes.HistorySize) error {
+			rs, err := sizes.ComputeRefSharing(ctx, env.repo, env.rg)
+			if err != nil {
+				return err
+			}
+			hs.RefSharing = rs
+			return nil
+		},
+	},
+	{
+		option: "--export-tree-dot",
+		wanted: func(o *options, _ *sizes.HistorySize) bool { return o.exportTreeDOT != "" },
+		run: func(ctx context.Context, env *analysisEnv, hs *sizes.HistorySize) error {
+			ds, err := sizes.ComputeDirectorySizes(ctx, env.repo, "HEAD", env.opts.dotDepth)
+			if err != nil {
+				return err
+			}
+			return writeTreeDOT(env.opts.exportTreeDOT, ds, counts.Count64(env.opts.dotMinBytes))
+		},
+	},
+	{
+		option: "--classify-attr",
+		wanted: func(o *options, hs *sizes.HistorySize) bool {
+			return o.classifyAttr != "" && hs.TopBlobs != nil
+		},
+		run: func(ctx context.Context, env *analysisEnv, hs *sizes.HistorySize) error {
+			as, err := sizes.ClassifyTopBlobs(
+				ctx, env.repo, "HEAD", env.opts.classifyAttr, hs.TopBlobs,
+			)
+			if err != nil {
+				return err
+			}
+			hs.TopBlobsByAttribute = as
+			return nil
+		},
+	},
+	{
+		option: "--classify",
+		wanted: func(o *options, _ *sizes.HistorySize) bool { return o.classify },
+		run: func(ctx context.Context, env *analysisEnv, hs *sizes.HistorySize) error {
+			rt, err := sizes.ClassifyRepository(ctx, env.repo, "HEAD", hs)
+			if err != nil {
+				return err
+			}
+			hs.RepoType = rt
+			return nil
+		},
+	},
+	{
+		option: "--duplicate-names",
+		wanted: func(o *options, _ *sizes.HistorySize) bool { return o.duplicateNames > 0 },
+		run: func(ctx context.Context, env *analysisEnv, hs *sizes.HistorySize) error {
+			dn, err := sizes.FindDuplicateNames(ctx, env.repo, "HEAD", env.opts.duplicateNames)
+			if err != nil {
+				return err
+			}
+			hs.DuplicateNames = dn
+			return nil
+		},
+	},
+	{
+		option: "--blame-top-blob",
+		wanted: func(o *options, _ *sizes.HistorySize) bool { return o.blameTopBlob },
+		run: func(ctx context.Context, env *analysisEnv, hs *sizes.HistorySize) error {
+			tbh, err := sizes.BlameTopBlob(ctx, env.repo, hs)
+			if err != nil {
+				return err
+			}
+			hs.TopBlobHistory = tbh
+			return nil
+		},
+	},
+	{
+		option: "--renames",
+		wanted: func(o *options, _ *sizes.HistorySize) bool { return o.renames },
+		run: func(ctx context.Context, env *analysisEnv, hs *sizes.HistorySize) error {
+			rs, err := sizes.CountRenames(ctx, env.repo, env.rg)
+			if err != nil {
+				return err
+			}
+			hs.Renames = rs
+			return nil
+		},
+	},
+	{
+		option: "--include-gitattributes-lfs-size",
+		wanted: func(o *options, _ *sizes.HistorySize) bool { return o.lfsSizes },
+		run: func(ctx context.Context, env *analysisEnv, hs *sizes.HistorySize) error {
+			ls, err := sizes.ComputeLFSSizes(ctx, env.repo, env.rg)
+			if err != nil {
+				return err
+			}
+			hs.LFSSizes = ls
+			return nil
+		},
+	},
+	{
+		option: "--names-file",
+		wanted: func(o *options, _ *sizes.HistorySize) bool { return o.namesFile != "" },
+		run: func(ctx context.Context, env *analysisEnv, hs *sizes.HistorySize) error {
+			objects, err := hs.NamedObjects(ctx, env.repo, env.rg)
+			if err != nil || len(objects) == 0 {
+				return err
+			}
+			return writeNamesFile(env.opts.namesFile, objects)
+		},
+	},
+	{
+		option: `the "objects" table`,
+		wanted: func(o *options, _ *sizes.HistorySize) bool { return o.objectsTable() },
+		run: func(ctx context.Context, env *analysisEnv, hs *sizes.HistorySize) error {
+			objects, err := hs.NamedObjects(ctx, env.repo, env.rg)
+			if err != nil {
+				return err
+			}
+			hs.SetNamedObjects(objects)
+			return nil
+		},
+	},
+	{
+		option: "--track",
+		wanted: func(o *options, _ *sizes.HistorySize) bool { return o.track },
+		run: func(_ context.Context, env *analysisEnv, hs *sizes.HistorySize) error {
+			return trackGrowth(hs, env.rg.Groups(), env.repo.Path())
+		},
+	},
+}
+
+// runAnalyses runs the analyses in `list` that were requested, in
+// order. They are skipped if the main scan was interrupted, so that
+// the partial results are output promptly. If `ctx` is done while
+// they run, the one that was running and the ones after it are left
+// out (and listed in `hs.LeftOut`), and `hs.Partial` is set, so that
+// the results of the main scan are still output.
+func runAnalyses(
+	ctx context.Context, env *analysisEnv, hs *sizes.HistorySize, list []analysis,
+) error {
+	if hs.Partial {
+		return nil
+	}
+	for _, a := range list {
+		if !a.wanted(env.opts, hs) {
+			continue
+		}
+		if ctx.Err() != nil {
+			hs.Partial = true
+			hs.LeftOut = append(hs.LeftOut, a.option)
+			continue
+		}
+		if err := a.run(ctx, env, hs); err != nil {
+			// Whatever error the stopped command produced isn't
+			// interesting:
+			if ctx.Err() != nil {
+				hs.Partial = true
+				hs.LeftOut = append(hs.LeftOut, a.option)
+				continue
+			}
+			return err
+		}
+	}
+	return nil
+}
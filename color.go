@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// ColorMode is a `pflag.Value` that records the user's choice for the
+// `--color` option.
+type ColorMode int
+
+const (
+	ColorAuto ColorMode = iota
+	ColorAlways
+	ColorNever
+)
+
+func (c *ColorMode) String() string {
+	if c == nil {
+		return "UNSET"
+	}
+
+	switch *c {
+	case ColorAuto:
+		return "auto"
+	case ColorAlways:
+		return "always"
+	case ColorNever:
+		return "never"
+	default:
+		panic("Unexpected ColorMode value")
+	}
+}
+
+func (c *ColorMode) Set(s string) error {
+	switch s {
+	case "auto":
+		*c = ColorAuto
+	case "always", "true":
+		*c = ColorAlways
+	case "never", "false":
+		*c = ColorNever
+	default:
+		return fmt.Errorf("not a valid color mode: %v", s)
+	}
+	return nil
+}
+
+func (c *ColorMode) Type() string {
+	return "when"
+}
+
+// noColorValue is a `pflag.Value` that implements `--no-color` by
+// setting a `ColorMode` to `ColorNever` (or, if the user explicitly
+// passes `--no-color=false`, back to `ColorAuto`).
+type noColorValue struct {
+	mode *ColorMode
+}
+
+func (v noColorValue) Set(s string) error {
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return err
+	}
+	if b {
+		*v.mode = ColorNever
+	} else {
+		*v.mode = ColorAuto
+	}
+	return nil
+}
+
+func (v noColorValue) String() string {
+	if v.mode == nil {
+		return "false"
+	}
+	return strconv.FormatBool(*v.mode == ColorNever)
+}
+
+func (v noColorValue) Type() string {
+	return "bool"
+}
+
+// useColor decides whether the output should be colorized. An
+// explicit `--color=always` or `--color=never` (including
+// `--no-color`) always wins. Otherwise, the `NO_COLOR` and
+// `FORCE_COLOR` environment variables are consulted (with `NO_COLOR`
+// taking precedence if both are set). If neither is set, color is
+// used iff `out` is a terminal. `getenv` is used to read the
+// environment.
+func useColor(mode ColorMode, getenv func(string) string, out interface{}) bool {
+	switch mode {
+	case ColorAlways:
+		return true
+	case ColorNever:
+		return false
+	}
+
+	if getenv("NO_COLOR") != "" {
+		return false
+	}
+
+	if force := getenv("FORCE_COLOR"); force != "" {
+		b, err := strconv.ParseBool(force)
+		// Values that aren't boolean (e.g., `FORCE_COLOR=3`, which
+		// some tools use to select a color depth) count as "yes".
+		return err != nil || b
+	}
+
+	if getenv("TERM") == "dumb" {
+		return false
+	}
+
+	return isTerminal(out)
+}
+
+// isTerminal returns true iff `out` is a terminal.
+func isTerminal(out interface{}) bool {
+	f, ok := out.(*os.File)
+	if !ok {
+		return false
+	}
+
+	// Don't use `isatty.Isatty()` here, because the default build
+	// stubs it out to always return `true`, which would cause escape
+	// sequences to be written into pipes and files.
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
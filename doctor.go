@@ -0,0 +1,206 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/github/git-sizer/git"
+)
+
+// doctorStatus is the outcome of one of the `--doctor` checks. Higher
+// values are worse.
+type doctorStatus int
+
+const (
+	doctorPass doctorStatus = iota
+	doctorWarn
+	doctorFail
+)
+
+func (s doctorStatus) String() string {
+	switch s {
+	case doctorPass:
+		return "pass"
+	case doctorWarn:
+		return "warn"
+	default:
+		return "FAIL"
+	}
+}
+
+// errDoctorWarning and errDoctorFailure are returned (wrapped in
+// `reportedError`) by `runDoctor()` if the worst result was a warning
+// or a failure, respectively. The results have already been output by
+// then.
+var (
+	errDoctorWarning = errors.New("some checks reported warnings")
+	errDoctorFailure = errors.New("some checks failed")
+)
+
+// doctorCheck is the result of one of the `--doctor` checks.
+type doctorCheck struct {
+	name   string
+	status doctorStatus
+	detail string
+
+	// remedy is a one-line suggestion of how to fix the problem, if
+	// the check didn't pass.
+	remedy string
+}
+
+// runDoctor checks whether git-sizer can scan the repository at
+// `path` and how well, without scanning it, and writes the results to
+// `w`. It uses the same checks as `git.NewRepository()`, so the two
+// can't disagree. Later checks are skipped if an earlier one makes
+// them impossible.
+func runDoctor(w io.Writer, path string) error {
+	var checks []doctorCheck
+	add := func(name string, status doctorStatus, detail, remedy string) {
+		checks = append(checks, doctorCheck{name, status, detail, remedy})
+	}
+
+	func() {
+		gitBin, err := git.FindGit()
+		if err != nil {
+			add("git executable", doctorFail, err.Error(), "install git, or add it to your PATH")
+			return
+		}
+		add("git executable", doctorPass, gitBin, "")
+
+		version, err := git.ReadGitVersion(gitBin)
+		if err != nil {
+			add("git version", doctorFail, err.Error(), "check that '"+gitBin+"' is a working git")
+			return
+		}
+		if err := git.CheckGitVersion(version); err != nil {
+			add(
+				"git version", doctorFail, err.Error(),
+				fmt.Sprintf("install git %s or newer, and put it first in your PATH", git.MinimumGitVersion),
+			)
+			return
+		}
+		if unavailable := git.UnavailableCapabilities(version); len(unavailable) != 0 {
+			names := make([]string, 0, len(unavailable))
+			for _, c := range unavailable {
+				names = append(names, fmt.Sprintf("%s (git %s)", c.Name, c.Since))
+			}
+			add(
+				"git version", doctorWarn,
+				fmt.Sprintf("%s lacks %s", version, strings.Join(names, ", ")),
+				"install a newer git, and put it first in your PATH",
+			)
+		} else {
+			add(
+				"git version", doctorPass,
+				fmt.Sprintf("%s (at least %s is required)", version, git.MinimumGitVersion), "",
+			)
+		}
+
+		gitDir, err := git.GitDir(gitBin, path)
+		if err != nil {
+			add(
+				"repository", doctorFail, strings.TrimSpace(err.Error()),
+				"run git-sizer from within a Git repository, or set GIT_DIR",
+			)
+			return
+		}
+		add("repository", doctorPass, gitDir, "")
+
+		objectFormat, err := git.ObjectFormat(gitBin, gitDir)
+		if err != nil {
+			add("object format", doctorFail, err.Error(), "upgrade git")
+		} else {
+			add("object format", doctorPass, objectFormat, "")
+		}
+
+		if shallow, err := git.IsShallow(gitBin, gitDir); shallow {
+			add(
+				"shallow clone", doctorFail, err.Error(),
+				"run 'git fetch --unshallow' to fetch the full history",
+			)
+		} else if err != nil {
+			add("shallow clone", doctorFail, err.Error(), "check the repository with 'git fsck'")
+		} else {
+			add("shallow clone", doctorPass, "no", "")
+		}
+
+		if partial, err := git.IsPartialClone(gitBin, gitDir); err != nil {
+			add("partial clone", doctorFail, err.Error(), "check the repository's gitconfig")
+		} else if partial {
+			add(
+				"partial clone", doctorWarn,
+				"yes; objects that haven't been fetched are missing or get fetched during the scan",
+				"clone the repository again without '--filter'",
+			)
+		} else {
+			add("partial clone", doctorPass, "no", "")
+		}
+
+		if alternates, err := git.Alternates(gitBin, gitDir); err != nil {
+			add("alternates", doctorFail, err.Error(), "check 'objects/info/alternates'")
+		} else if len(alternates) != 0 {
+			add(
+				"alternates", doctorWarn,
+				fmt.Sprintf(
+					"objects are borrowed from %s; the pack statistics only cover this repository's own packs",
+					strings.Join(alternates, ", "),
+				),
+				"run 'git repack -a -d' to copy the borrowed objects into this repository",
+			)
+		} else {
+			add("alternates", doctorPass, "none", "")
+		}
+
+		if ok, err := git.HasCommitGraph(gitBin, gitDir); err != nil {
+			add("commit-graph", doctorFail, err.Error(), "check the repository with 'git fsck'")
+		} else if !ok {
+			add(
+				"commit-graph", doctorWarn, "none; walking the history is slower without one",
+				"run 'git commit-graph write --reachable'",
+			)
+		} else {
+			add("commit-graph", doctorPass, "present", "")
+		}
+
+		// git-sizer doesn't use bitmaps, so this is only for
+		// information:
+		if ok, err := git.HasBitmaps(gitBin, gitDir); err != nil {
+			add("bitmaps", doctorFail, err.Error(), "check the repository with 'git fsck'")
+		} else if !ok {
+			add("bitmaps", doctorPass, "none (git-sizer doesn't need them)", "")
+		} else {
+			add("bitmaps", doctorPass, "present", "")
+		}
+
+		if count, err := git.CountStoredObjects(gitBin, gitDir); err != nil {
+			add("objects", doctorFail, err.Error(), "check the repository with 'git fsck'")
+		} else {
+			add(
+				"objects", doctorPass,
+				fmt.Sprintf("about %d stored, including unreachable ones", count), "",
+			)
+		}
+	}()
+
+	worst := doctorPass
+	for _, c := range checks {
+		fmt.Fprintf(w, "%-4s  %-15s %s\n", c.status, c.name+":", c.detail)
+		if c.remedy != "" {
+			fmt.Fprintf(w, "      %-15s %s\n", "", "remedy: "+c.remedy)
+		}
+		if c.status > worst {
+			worst = c.status
+		}
+	}
+
+	switch worst {
+	case doctorWarn:
+		return reportedError{errDoctorWarning}
+	case doctorFail:
+		return reportedError{errDoctorFailure}
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+)
+
+// OutputEncoding is a `pflag.Value` that records the character
+// encoding chosen with the `--encoding` option for the tabular
+// output. (JSON output is always UTF-8.)
+type OutputEncoding int
+
+const (
+	EncodingUTF8 OutputEncoding = iota
+	EncodingUTF16LE
+	EncodingUTF16BE
+	EncodingLatin1
+)
+
+func (e *OutputEncoding) String() string {
+	if e == nil {
+		return "UNSET"
+	}
+
+	switch *e {
+	case EncodingUTF8:
+		return "utf-8"
+	case EncodingUTF16LE:
+		return "utf-16le"
+	case EncodingUTF16BE:
+		return "utf-16be"
+	case EncodingLatin1:
+		return "iso-8859-1"
+	default:
+		panic("Unexpected OutputEncoding value")
+	}
+}
+
+func (e *OutputEncoding) Set(s string) error {
+	switch strings.ToLower(s) {
+	case "utf-8", "utf8":
+		*e = EncodingUTF8
+	case "utf-16le", "utf16le":
+		*e = EncodingUTF16LE
+	case "utf-16be", "utf16be":
+		*e = EncodingUTF16BE
+	case "iso-8859-1", "latin1", "latin-1":
+		*e = EncodingLatin1
+	default:
+		return fmt.Errorf(
+			"not a supported encoding: %v (use utf-8, utf-16le, utf-16be, or iso-8859-1)", s,
+		)
+	}
+	return nil
+}
+
+func (e *OutputEncoding) Type() string {
+	return "encoding"
+}
+
+// Encode transcodes `s`, which should be UTF-8, to `e`. If `bom` is
+// set, a byte-order mark is written first (for ISO-8859-1, which has
+// none, it is omitted). When transcoding, invalid UTF-8 sequences in
+// `s` become U+FFFD, and characters that ISO-8859-1 can't represent
+// become '?'.
+func (e OutputEncoding) Encode(s string, bom bool) []byte {
+	var buf bytes.Buffer
+	switch e {
+	case EncodingUTF8:
+		if bom {
+			buf.WriteString("\ufeff")
+		}
+		buf.WriteString(s)
+	case EncodingUTF16LE, EncodingUTF16BE:
+		var order binary.ByteOrder = binary.LittleEndian
+		if e == EncodingUTF16BE {
+			order = binary.BigEndian
+		}
+		units := make([]uint16, 0, len(s)+1)
+		if bom {
+			units = append(units, 0xFEFF)
+		}
+		units = append(units, utf16.Encode([]rune(s))...)
+		b := make([]byte, 2*len(units))
+		for i, u := range units {
+			order.PutUint16(b[2*i:], u)
+		}
+		buf.Write(b)
+	case EncodingLatin1:
+		for _, r := range s {
+			if r > 0xFF {
+				r = '?'
+			}
+			buf.WriteByte(byte(r))
+		}
+	default:
+		panic("Unexpected OutputEncoding value")
+	}
+	return buf.Bytes()
+}
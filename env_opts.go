@@ -0,0 +1,102 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// optionsEnvVar is the environment variable that can hold default
+// options, which are processed before the command-line options.
+const optionsEnvVar = "GIT_SIZER_OPTS"
+
+// envOptions returns the options in `getenv(optionsEnvVar)`, split into
+// words the way that a shell would.
+func envOptions(getenv func(string) string) ([]string, error) {
+	words, err := splitShellWords(getenv(optionsEnvVar))
+	if err != nil {
+		return nil, usageErrorf("invalid %s: %w", optionsEnvVar, err)
+	}
+	return words, nil
+}
+
+// splitShellWords splits `s` into words the way that a POSIX shell
+// would, except that no expansions are done. Words are separated by
+// unquoted whitespace. Within single quotes, every character is
+// literal. Within double quotes, a backslash only escapes `"`, `\`,
+// `$`, "`", and newline. Elsewhere, a backslash escapes any character
+// (and a backslash-newline is removed).
+func splitShellWords(s string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+
+	// inWord is set if a word has been started, even if it is still
+	// empty (e.g., after `''`):
+	inWord := false
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch c {
+		case ' ', '\t', '\n':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		case '\'':
+			end := strings.IndexByte(s[i+1:], '\'')
+			if end == -1 {
+				return nil, errors.New("unterminated single quote")
+			}
+			word.WriteString(s[i+1 : i+1+end])
+			i += 1 + end
+			inWord = true
+		case '"':
+			i++
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) && strings.IndexByte("\"\\$`\n", s[i+1]) != -1 {
+					i++
+					if s[i] == '\n' {
+						continue
+					}
+				}
+				word.WriteByte(s[i])
+			}
+			if i == len(s) {
+				return nil, errors.New("unterminated double quote")
+			}
+			inWord = true
+		case '\\':
+			if i+1 == len(s) {
+				return nil, errors.New("trailing backslash")
+			}
+			i++
+			if s[i] != '\n' {
+				word.WriteByte(s[i])
+				inWord = true
+			}
+		default:
+			word.WriteByte(c)
+			inWord = true
+		}
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+
+	return words, nil
+}
+
+// quoteShellWords is the inverse of `splitShellWords()`. It quotes
+// only the words that need it.
+func quoteShellWords(words []string) string {
+	quoted := make([]string, 0, len(words))
+	for _, w := range words {
+		if w != "" && !strings.ContainsAny(w, " \t\n'\"\\$`") {
+			quoted = append(quoted, w)
+			continue
+		}
+		quoted = append(quoted, fmt.Sprintf("'%s'", strings.ReplaceAll(w, "'", `'\''`)))
+	}
+	return strings.Join(quoted, " ")
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/github/git-sizer/git"
+)
+
+// The exit statuses that git-sizer uses. They are part of its
+// interface, so that automation can tell what went wrong; see
+// `exitCodes`.
+const (
+	exitOK             = 0
+	exitError          = 1
+	exitLimitsExceeded = 2
+	exitUsage          = 3
+	exitInterrupted    = 4
+	exitCorruption     = 5
+
+	// exitDoctorWarning is used if `--doctor` found problems that
+	// git-sizer can work around, but none that prevent it from
+	// scanning the repository.
+	exitDoctorWarning = 6
+)
+
+// exitCodes describes the exit statuses, for `--help-exit-codes`.
+var exitCodes = []struct {
+	code    int
+	meaning string
+}{
+	{exitOK, "success (and, with '--fail-on', no statistic reached the level)"},
+	{exitError, "operational error (e.g., the repository couldn't be read)"},
+	{exitLimitsExceeded, "a statistic reached the '--fail-on' level, or a push exceeded '--max-push-size'"},
+	{exitUsage, "invalid usage (e.g., an unknown or conflicting option)"},
+	{exitInterrupted, "the scan was interrupted or timed out; partial results were output"},
+	{exitCorruption, "some objects were missing or corrupt, and were skipped"},
+	{exitDoctorWarning, "'--doctor' found problems that git-sizer can work around"},
+}
+
+// writeExitCodes writes the table of exit statuses to `w`.
+func writeExitCodes(w io.Writer) {
+	fmt.Fprintln(w, "git-sizer exits with one of the following statuses:")
+	fmt.Fprintln(w)
+	for _, c := range exitCodes {
+		fmt.Fprintf(w, "    %d  %s\n", c.code, c.meaning)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "If more than one applies, the first of 4, 5, and 2 is used. With")
+	fmt.Fprintln(w, "'--doctor', 6 means that some checks warned and 1 that some failed.")
+}
+
+// errCorruption is returned by `mainImplementation()` if some objects
+// had to be skipped. The results have already been output by then.
+var errCorruption = errors.New("some objects were missing or corrupt and have been skipped")
+
+// errInterrupted is returned by `mainImplementation()` if the scan, or
+// an analysis after it, was interrupted. The partial results have
+// already been output by then.
+var errInterrupted = errors.New("git-sizer was interrupted; the results are partial")
+
+// errTimedOut is returned by `mainImplementation()` if the scan, or an
+// analysis after it, was stopped by `--timeout`. The partial results
+// have already been output by then.
+var errTimedOut = errors.New("git-sizer timed out; the results are partial")
+
+// stoppedError returns the error to report if the context of
+// `mainImplementation()` stopped `what`, which has no partial results
+// to output.
+func stoppedError(ctx context.Context, what string) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%s timed out: %w", what, ctx.Err())
+	}
+	return fmt.Errorf("%s was interrupted: %w", what, ctx.Err())
+}
+
+// errLimitsExceeded is returned (wrapped) by `mainImplementation()` if
+// a statistic reached the `--fail-on` level of concern. The results
+// have already been output by then.
+var errLimitsExceeded = errors.New("the level of concern given by --fail-on was reached")
+
+// errPushTooLarge is returned (wrapped) by `mainImplementation()` if
+// the objects introduced by a push total more than `--max-push-size`.
+// The push's sizes have already been output by then.
+var errPushTooLarge = errors.New("the push is too large")
+
+// usageError wraps an error in the way that git-sizer was invoked
+// (e.g., an invalid or conflicting option).
+type usageError struct {
+	error
+}
+
+func (err usageError) Unwrap() error {
+	return err.error
+}
+
+// usageErrorf returns a `usageError` with the specified message.
+func usageErrorf(format string, args ...interface{}) error {
+	return usageError{fmt.Errorf(format, args...)}
+}
+
+// exitCode returns the exit status for the error `err` that
+// `mainImplementation()` returned.
+func exitCode(err error) int {
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.Is(err, errInterrupted), errors.Is(err, errTimedOut),
+		errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded),
+		errors.Is(err, git.ErrRepositoryClosed):
+		return exitInterrupted
+	case errors.Is(err, errCorruption):
+		return exitCorruption
+	case errors.Is(err, errLimitsExceeded), errors.Is(err, errPushTooLarge):
+		return exitLimitsExceeded
+	case errors.Is(err, errDoctorWarning):
+		return exitDoctorWarning
+	case errors.As(err, &usageError{}):
+		return exitUsage
+	default:
+		return exitError
+	}
+}
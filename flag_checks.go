@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/pflag"
+)
+
+// flagUse records one use of a command-line option. `parseFlags()`
+// records them in the order that they were given, because some
+// mistakes can only be recognized from the order.
+type flagUse struct {
+	flag  *pflag.Flag
+	value string
+
+	// fromEnv is set if the option came from `optionsEnvVar` rather
+	// than the command line.
+	fromEnv bool
+}
+
+// String returns the option the way it was probably written (e.g.,
+// "--critical" or "--threshold=2").
+func (u flagUse) String() string {
+	if u.flag.NoOptDefVal == "true" && u.value == "true" {
+		return "--" + u.flag.Name
+	}
+	return fmt.Sprintf("--%s=%s", u.flag.Name, u.value)
+}
+
+// parseFlags parses `envArgs` (the options from `optionsEnvVar`)
+// followed by `args` into `flags`, like `flags.Parse()`, and returns
+// the options that were used, in order. `envArgs` are parsed on their
+// own, so that an option at the end of them that is missing its value
+// is reported as such rather than taking the first of `args`.
+func parseFlags(flags *pflag.FlagSet, envArgs, args []string) ([]flagUse, error) {
+	var uses []flagUse
+	parse := func(args []string, fromEnv bool) error {
+		return flags.ParseAll(args, func(flag *pflag.Flag, value string) error {
+			uses = append(uses, flagUse{flag, value, fromEnv})
+			return flags.Set(flag.Name, value)
+		})
+	}
+
+	if len(envArgs) != 0 {
+		if err := parse(envArgs, true); err != nil {
+			return nil, fmt.Errorf("in %s: %w", optionsEnvVar, err)
+		}
+		if len(flags.Args()) != 0 {
+			return nil, fmt.Errorf("in %s: unexpected argument %q", optionsEnvVar, flags.Args()[0])
+		}
+	}
+
+	err := parse(args, false)
+	return uses, err
+}
+
+// overridingFlags lists groups of options that set the same thing,
+// so that if more than one of them is used, the last one wins (for
+// the reference selection options, the last one that matches a
+// reference).
+var overridingFlags = [][]string{
+	{"threshold", "verbose", "no-verbose", "critical"},
+	{"progress", "no-progress"},
+	{"color", "no-color"},
+	{"branches", "no-branches"},
+	{"tags", "no-tags"},
+	{"remotes", "no-remotes"},
+	{"notes", "no-notes"},
+	{"stash", "no-stash"},
+}
+
+// checkFlagUses looks for combinations of options in `uses` that are
+// probably mistakes, because some of them have no effect, and returns
+// a one-line warning about each one that it finds. None of them is
+// serious enough to refuse to run.
+func checkFlagUses(uses []flagUse) []string {
+	var warnings []string
+
+	last := make(map[string]flagUse)
+	for _, u := range uses {
+		last[u.flag.Name] = u
+	}
+	used := func(name string) bool {
+		_, ok := last[name]
+		return ok
+	}
+
+	for _, group := range overridingFlags {
+		inGroup := make(map[string]bool, len(group))
+		for _, name := range group {
+			inGroup[name] = true
+		}
+
+		// Find the use that wins, and the latest one before it
+		// that it overrides (if any):
+		var winner, overridden *flagUse
+		for i := range uses {
+			u := &uses[i]
+			if !inGroup[u.flag.Name] {
+				continue
+			}
+			if winner != nil && (u.flag.Name != winner.flag.Name || u.value != winner.value) {
+				overridden = winner
+			}
+			winner = u
+		}
+		// Overriding the defaults from the environment is what the
+		// command line is for:
+		if overridden != nil && !overridden.fromEnv {
+			warnings = append(
+				warnings, fmt.Sprintf("%s overrides the earlier %s", winner, overridden),
+			)
+		}
+	}
+
+	if used("json-version") {
+		switch {
+		case used("json-stream"):
+			warnings = append(
+				warnings,
+				"--json-version has no effect with --json-stream, which always uses version 2",
+			)
+		case !used("json") && !used("print-config"):
+			warnings = append(warnings, "--json-version has no effect without --json")
+		}
+	}
+
+	if used("names-per-metric") {
+		if u, ok := last["names"]; ok && u.value == "none" {
+			warnings = append(warnings, "--names-per-metric has no effect with --names=none")
+		}
+	}
+
+	return warnings
+}
@@ -1,18 +1,25 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"runtime/pprof"
-	"strconv"
 	"time"
 
 	"github.com/spf13/pflag"
 
+	"github.com/github/git-sizer/counts"
 	"github.com/github/git-sizer/git"
+	"github.com/github/git-sizer/internal/diag"
 	"github.com/github/git-sizer/internal/refopts"
 	"github.com/github/git-sizer/isatty"
 	"github.com/github/git-sizer/meter"
@@ -30,6 +37,11 @@ const usage = `usage: git-sizer [OPTS]
       --no-verbose             equivalent to '--threshold=1'
       --critical               only report critical statistics; equivalent
                                to '--threshold=30'
+      --fail-on=THRESHOLD      exit with status 2 (after the output) if any
+                               statistic reaches the level of concern
+                               THRESHOLD (in the same units as
+                               '--threshold'; e.g., '--fail-on=30' for
+                               critical statistics)
       --names=[none|hash|full] display names of large objects in the specified
                                style. Values:
                                * 'none' - omit footnotes entirely
@@ -37,13 +49,530 @@ const usage = `usage: git-sizer [OPTS]
                                * 'full' - show full names
                                Default is '--names=full'. Can be set via
                                gitconfig: 'sizer.names'.
+      --names-per-metric=N     name the N objects with the highest values
+                               of each statistic that has a footnote,
+                               numbered, rather than just one (default:
+                               1). Objects with equal values are listed
+                               in order of their SHA-1s
+      --names-file=FILE        also write the objects named in the
+                               footnotes (and by '--top' and
+                               '--top-trees') to FILE, as tab-separated
+                               values: metric, OID, type, size, path,
+                               and the reference via which the object
+                               was found (if it wasn't found via a
+                               commit named by its OID).
+                               FILE is replaced atomically, and not
+                               written at all if no objects are named
   -j, --json                   output results in JSON format
       --json-version=[1|2]     choose which JSON format version to output.
                                Default: --json-version=1. Can be set via
-                               gitconfig: 'sizer.jsonVersion'.
+                               gitconfig: 'sizer.jsonVersion'. Version 2
+                               also has an "objects" table, keyed by OID,
+                               describing each object that is named
+                               (with its "oid", "type", "size", "path",
+                               and "ref"); statistics refer to it via
+                               "objectKey"
+      --json-stream            output the results as a stream of JSON
+                               objects, one per line, with the same
+                               contents as '--json-version=2': each
+                               statistic, and each entry of a section
+                               that is a list or map (e.g., the remotes
+                               or submodules), on a line of its own,
+                               as {"section", "key" or "index",
+                               "value"}, so that consumers can process
+                               it incrementally
+      --output-template=FILE   format the results using the Go
+                               'text/template' in FILE, instead of as a
+                               table. The template is executed with:
+                               * '.Stats': a map from the symbol of each
+                                 statistic (as in '--json-version=2') to
+                                 the statistic, with the fields 'Symbol',
+                                 'Label', 'Description', 'Value', 'Unit',
+                                 'HumanValue', 'ReferenceValue',
+                                 'LevelOfConcern', 'Stars', 'Reported'
+                                 (whether it meets the threshold),
+                                 'ObjectName', and 'ObjectDescription'
+                               * '.Statistics': the same statistics, as a
+                                 list ordered by symbol
+                               * '.Worst': the statistic with the highest
+                                 level of concern
+                               * '.Threshold': the threshold
+                               * '.History': all of the results, with
+                                 Go field names (e.g., '.History.Remotes')
+                               Besides the standard functions, 'bytes N'
+                               and 'metric N' format a number with binary
+                               or metric prefixes, 'stars L' shows a level
+                               of concern as stars, and 'json V' formats
+                               V as JSON. For example:
+                               '{{.Stats.maxBlobSize.HumanValue}}'
+      --output-template-text=TEMPLATE
+                               like '--output-template', but with the
+                               template given inline
+      --porcelain              output the statistics in a stable format
+                               for scripts: a header line '# git-sizer
+                               porcelain 1', then one line per statistic,
+                               ordered by symbol, of the form
+                               'METRIC VALUE LEVEL OID PATH'. METRIC is
+                               the symbol (as in '--json-version=2'),
+                               VALUE the raw integer value, and LEVEL the
+                               level of concern with three decimals. OID
+                               and PATH identify the object that the
+                               statistic refers to, or are '-' if there
+                               is none; PATH is C-quoted like Git's own
+                               porcelain formats. All statistics are
+                               listed, regardless of the threshold. The
+                               number in the header changes whenever the
+                               format does (other than by adding
+                               statistics)
       --[no-]progress          report (don't report) progress to stderr. Can
                                be set via gitconfig: 'sizer.progress'.
+      --log-json               write diagnostics (the start and end of each
+                               processing phase, warnings, and errors) to
+                               stderr as JSON objects, one per line, each
+                               with 'time', 'level', 'message', and
+                               'fields' members. This replaces the
+                               progress meter
+      --color=[auto|always|never]
+                               colorize the level of concern in tabular
+                               output. Default is '--color=auto', which
+                               honors the 'NO_COLOR' and 'FORCE_COLOR'
+                               environment variables and otherwise uses
+                               color iff stdout is a terminal.
+      --no-color               equivalent to '--color=never'
+      --live                   if stdout is a terminal, show the table
+                               while the scan is running and update it in
+                               place as statistics come in (instead of
+                               the progress meter). Names are only shown
+                               in the final table. Can't be combined with
+                               '--json'
+      --encoding=ENCODING      the character encoding of the tabular output:
+                               'utf-8' (the default), 'utf-16le',
+                               'utf-16be', or 'iso-8859-1'. JSON output is
+                               always UTF-8
+      --bom                    start the output with a byte-order mark (in
+                               the encoding chosen by '--encoding', or
+                               UTF-8 for JSON output)
+      --track                  also show how each statistic changed since
+                               the previous run with '--track' on this
+                               repository, and store this run's results
+                               for the next one. They are stored in
+                               'git-sizer/track' in the user's cache
+                               directory (e.g., '~/.cache'), keyed by
+                               the repository's git dir
+      --assume-unchanged-cache
+                               if none of the references (or HEAD) has
+                               changed since an earlier run with this
+                               option and the same settings, output its
+                               results again without scanning the
+                               repository. Otherwise, scan it and cache
+                               the results, in 'git-sizer/results' in
+                               the user's cache directory. Only runs
+                               that succeed are cached. A note on stderr
+                               says whether the cached results were
+                               trusted or recomputed
+      --verify-cache           with '--assume-unchanged-cache', recompute
+                               the results even if they are cached, and
+                               report the lines in which they differ
+                               from the cached ones, if any (exit status
+                               1). The cache isn't changed
+      --repair-cache           with '--assume-unchanged-cache', recompute
+                               the results even if they are cached, and
+                               replace the cached ones
+      --attributes[=REV]       also count how many blobs in the tree of REV
+                               (default: HEAD) have each gitattribute
+                               setting (e.g., 'binary', '-text', or
+                               'diff=lfs'), as reported by 'git
+                               check-attr'. This runs extra git commands.
+      --archive-size[=REV]     also report the number and total size of
+                               the files that 'git archive REV' (default:
+                               HEAD) would include; i.e., without the
+                               paths that have the 'export-ignore'
+                               gitattribute, and how many were left out.
+                               This runs extra git commands.
+      --blame-top-blob         also list the commits (with author and date)
+                               that added or modified the path at which
+                               the largest blob was found, as reported by
+                               'git log --follow'. Requires '--names=full'
+      --renames                also count the renames and copies of files
+                               that 'git log --find-renames
+                               --find-copies' detects in the history,
+                               and list the files that were renamed most
+                               often. This diffs every commit, so it can
+                               be slow for big repositories
+      --include-gitattributes-lfs-size
+                               also report the true size of the content:
+                               the total size of the blobs, but counting
+                               each Git LFS pointer blob as the size of
+                               the file that it points at (as recorded
+                               in the pointer). The number and size of
+                               the LFS objects that are present in
+                               '.git/lfs/objects' are reported, too
+      --by-remote              also report, for each remote, the objects
+                               reachable from its remote-tracking
+                               references ('refs/remotes/<name>/*').
+                               Objects that aren't reachable from any
+                               other included reference are counted as
+                               unique to the remote; they could be
+                               pruned along with it. Objects that are
+                               also reachable from other references are
+                               shared
+      --by-namespace           also report a matrix of the commits, trees,
+                               blobs, and tags (and their total size)
+                               that are reachable exclusively from each
+                               reference namespace ('refs/heads/*',
+                               'refs/tags/*', 'refs/remotes/*',
+                               'refs/notes/*', 'refs/pull/*' and
+                               'refs/changes/*', and all others).
+                               Objects reachable from more than one
+                               namespace are counted as shared
+      --compare-repo=PATH      also report how many of the reachable
+                               objects are also reachable in the
+                               repository at PATH (e.g., the upstream
+                               of a fork, or the repository that a
+                               '--reference' clone borrows from), and
+                               how many are unique to each repository.
+                               All of the other repository's references
+                               are used
+      --tag-only               also report the commits and blobs that are
+                               reachable from tags ('refs/tags/*') but not
+                               from any branch ('refs/heads/*'), and the
+                               total size of all such objects. The
+                               objects reachable from what annotated
+                               tags point at (i.e., archived releases)
+                               are also reported separately. This runs
+                               extra git commands
+      --notes-only             also report the objects that are reachable
+                               from git-notes references ('refs/notes/*')
+                               but not from any other included
+                               reference, and which notes reference
+                               contributes the most. This is the space
+                               that pruning the notes would reclaim
+      --ref-sharing            also report how much blob content is shared
+                               by all of the included references, and how
+                               much is exclusive to a single one (and
+                               which references have the most). This
+                               walks the history of each reference
+                               separately, so it can be slow
+      --check-submodules       also compare the gitlinks (submodule entries)
+                               in the tree at the tip of each included
+                               branch with that tree's '.gitmodules', and
+                               list gitlinks that aren't configured there
+                               (and vice versa)
+      --recurse-submodules     also scan the repositories of the submodules
+                               referenced by gitlinks at the tips of the
+                               included references (recursively), using
+                               the same options. A summary of each
+                               submodule and a combined total are shown;
+                               uninitialized submodules are listed as
+                               skipped
+      --diff-commits           also compare the tree of each commit with
+                               that of its first parent (root commits
+                               with the empty tree), and report the
+                               commit that changed the most paths and
+                               the one that introduced the most bytes of
+                               new blobs (blobs that no other commit
+                               introduced before; for merges, only
+                               content that differs from all parents).
+                               Also report the directory that has
+                               contained the most distinct names over
+                               history. This is slower
+      --persistence-weighted   also report the total size of the blobs,
+                               each multiplied by the number of scanned
+                               commits that contain it (once for each
+                               path that it appears at), and the number
+                               of commits that each byte of distinct
+                               blob content is in on average. Content
+                               that is present throughout the history
+                               weighs more than content that was added
+                               recently, which models its fetch cost
+      --committer-domains      also count the commits by the domain of
+                               their committer's email address (the part
+                               after the last '@', lowercased), and
+                               report the number of distinct domains and
+                               the domains with the most commits. Commits
+                               whose committer has no usable domain are
+                               counted separately
+      --export-dot=FILE        also write the graph of the scanned commits
+                               to FILE in Graphviz DOT format, with an
+                               edge from each commit to each of its
+                               parents. With '--diff-commits', each
+                               commit is labeled with the number of
+                               bytes of new blobs that it introduced
+      --export-tree-dot=FILE   also write the directory hierarchy of the
+                               history of HEAD (the default branch) to
+                               FILE in Graphviz DOT format, with each
+                               directory labeled with the total size of
+                               the distinct blobs that have ever been
+                               found under it. Each blob is counted once,
+                               at the first path where it appeared
+      --dot-depth=N            with '--export-tree-dot', show directories
+                               down to N levels below the top level
+                               (default: 3)
+      --dot-min-bytes=SIZE     with '--export-tree-dot', leave out the
+                               directories (and everything under them)
+                               whose blobs total less than SIZE (written
+                               like '--blob-size-limit'; e.g., '10m')
+      --export-sqlite=FILE     also write an inventory of the scanned
+                               objects to the SQLite database FILE (which
+                               is created if necessary), in the tables
+                               'objects' (oid, type, size), 'commits'
+                               (oid, author_date, parent_count, tree),
+                               and 'refs' (name, oid). Any existing
+                               tables with those names are replaced.
+                               Requires the 'sqlite3' command
+      --sqlite-tree-entries    with '--export-sqlite', also fill the table
+                               'tree_entries' (tree_oid, name, mode,
+                               entry_oid) with every entry of every
+                               tree. This can be very large
+      --export-dot-limit=N     fail rather than export a graph with more
+                               than N commits (default: 10000; 0 means no
+                               limit). Consider '--sample-rate' for big
+                               repositories
+      --histograms             also show the distributions of blob sizes,
+                               of the number of entries in trees, and of
+                               the maximum path depth in each commit.
+                               Implied by '--verbose'
+      --pack-stats             also report the longest delta chain in the
+                               packfiles and the distribution of chain
+                               lengths, from 'git verify-pack -v'. Long
+                               chains slow down object access ('git
+                               repack --depth' limits them). This reads
+                               every packed object, so it can be slow.
+                               Also summarize each packfile (its object
+                               count, size on disk, and the object that
+                               takes the most space in it), and show
+                               which packfile holds each blob listed by
+                               '--top' ('loose' for loose objects), from
+                               the packs' indexes ('git show-index').
+                               The space used is broken down into live
+                               packs, cruft packs (which hold
+                               unreachable objects until they expire;
+                               they are left out of the delta chain
+                               statistics), and loose objects, along
+                               with the coverage of the
+                               multi-pack-index, if there is one
+      --top-trees=N            also list the N trees with the most entries,
+                               widest first. With '--names=full', each is
+                               shown with the directory at which it was
+                               found and the reference or commit whose
+                               tree contains it
+      --top=N                  also list the N top-ranked blobs (see
+                               '--top-by'), with their paths
+      --top-by=size|refcount   rank the blobs listed by '--top' by their
+                               size in bytes (the default), or by the
+                               number of tree entries that refer to them
+      --classify-attr=ATTR     also split the blobs listed by '--top' (and
+                               their total size) by whether the
+                               gitattribute ATTR (e.g.,
+                               'linguist-generated') is true for their
+                               paths, according to the attributes in
+                               HEAD. Requires '--top' and '--names=full'
+      --classify               also guess what kind of repository this is
+                               ("source code", "asset-heavy", "monorepo",
+                               or "documentation"), with a confidence,
+                               from the mix of file extensions in HEAD,
+                               the number of project manifests (e.g.,
+                               'go.mod'), and the average blob size
+      --duplicate-names=N      also list the N file names that are used by
+                               the most paths in HEAD (e.g., hundreds of
+                               'index.js' files in different directories),
+                               which can be a sign of generated sprawl
+      --lfs-candidates         instead of the usual output, list the largest
+                               blobs (as many as '--top', default 10)
+                               whose paths aren't routed to Git LFS
+                               (i.e., don't have the gitattribute
+                               'filter=lfs') according to the attributes
+                               in HEAD; i.e., the files to migrate to
+                               LFS. Requires '--names=full'
+      --blob-size-limit=SIZE   also count the blobs larger than SIZE, and
+                               report their total size and the names of
+                               some of them. SIZE is a number of bytes,
+                               optionally followed by a unit: 'k', 'm',
+                               'g', or 't' (as in gitconfig) or 'KiB',
+                               'MiB', 'GiB', or 'TiB' multiply by powers
+                               of 1024, and 'kB', 'MB', 'GB', or 'TB' by
+                               powers of 1000 (e.g., '10m', '1.5GiB', or
+                               '500kB'). A lowercase 'b' after the unit
+                               (e.g., '10mb') is rejected as ambiguous
+      --big-file-threshold=SIZE
+                               count the blobs larger than SIZE (written
+                               like '--blob-size-limit') as "big files",
+                               rather than those larger than the
+                               repository's 'core.bigFileThreshold'
+                               (default: 512m), above which Git stores
+                               files without delta compression. Use it
+                               to see what a different setting would
+                               affect; '0' turns the count off
+      --manifest=FILE          also write a line of JSON to FILE for each
+                               blob larger than '--blob-size-limit' (which
+                               is required), ordered by when it was first
+                               added: {"oid", "size", "paths" (up to 3),
+                               "commit" and "date" (of the first commit
+                               that added it), "ref" (a reference that
+                               reaches that commit), "at_tip" (whether
+                               it is in the tree of a reference's tip),
+                               and, with '--lfs-candidates', "lfs"
+                               (whether its path is routed to LFS)}.
+                               "commit", "date", and "ref" are left out
+                               if unknown. This walks the history again.
+                               FILE is replaced atomically
+      --objects-from=FILE      after the scan, describe each object whose
+                               OID is listed in FILE ('-' for stdin): its
+                               type and size, whether the scan reached
+                               it, the name by which it was found, and
+                               a reference that it is reachable from.
+                               Other words on each line (e.g., in the
+                               output of 'git fsck') are ignored
+      --why=OID                instead of scanning the repository, show a
+                               chain of objects (from a reference to a
+                               commit, through trees, to the object)
+                               through which the blob, tree, or commit
+                               OID is reachable, or say that it isn't
+                               reachable from any included reference.
+                               The branch that HEAD refers to is tried
+                               first, then tags, then other references.
+                               Can be repeated
+      --merge-base=RANGE       scan only the objects introduced by one
+                               branch relative to another. RANGE is
+                               '<base>..<tip>' or '<base>...<tip>'; the
+                               objects reachable from <tip> but not from
+                               the merge base of <base> and <tip> are
+                               scanned. All references are still counted
+      --first-parent           follow only the first parent of each merge
+                               commit, so that only the mainline history
+                               of the references (and the trees and
+                               blobs of its commits) is scanned. The
+                               history depth is then the length of the
+                               mainline. The mode is noted in the output
+      --path=PREFIX            limit the blob and tree statistics to the
+                               objects under PREFIX (a path relative to
+                               the top level of the tree) in any commit.
+                               Can be repeated. Commit, tag, and reference
+                               statistics still cover the whole history
+      --exclude-path=PREFIX    leave the objects under PREFIX out of the
+                               blob and tree statistics, unless they are
+                               also found under other paths. The number
+                               of bytes left out is reported. Can be
+                               repeated and combined with --path; if
+                               several options match a path, the last
+                               one wins
+      --path-regexp=REGEXP     like '--path', but for the paths that
+                               REGEXP matches in full (e.g.,
+                               '.*\.png' or 'docs/.*'), and everything
+                               under them. Every tree has to be read to
+                               check its path, so this is slower
+      --exclude-path-regexp=REGEXP
+                               like '--exclude-path', but for the paths
+                               that REGEXP matches in full, and
+                               everything under them (e.g.,
+                               '(.*/)?node_modules' or '.*\.min\.js').
+                               Can be combined with the other path
+                               options; the last one that matches wins
+      --introduced-since=DATE  limit the blob and tree statistics to the
+                               objects first introduced by commits whose
+                               committer date is after DATE (YYYY-MM-DD,
+                               in UTC, or RFC 3339). The checkout, commit,
+                               tag, and reference statistics still cover
+                               the whole history. The date is stated in
+                               the output
+      --sample-rate=RATE       scan only a random sample of a fraction RATE
+                               (0 < RATE <= 1) of the commits. This is
+                               faster but the results are approximate:
+                               the commit totals are extrapolated from
+                               the sample (marked '~'), while the tree
+                               and blob statistics cover only the sampled
+                               commits' trees, so they are lower bounds
+                               (marked '+'). A note describing their
+                               precision is included in the output
+      --sample-seed=N          seed the random choice of commits for
+                               '--sample-rate' with N, to get a different
+                               sample. The same seed always chooses the
+                               same sample. Default: 0
+      --max-commits=N          do a quick scan of only the trees of the N
+                               newest commits, walking back from all of
+                               the references at once. The commit count
+                               is exact; other totals are extrapolated
+                               using the number of objects in the
+                               repository (marked '~'), and maxima are
+                               lower bounds (marked '+'). The JSON output
+                               marks each such statistic with "estimate"
+      --checkpoint=FILE        save the list of objects to scan in FILE once
+                               'git rev-list' has produced it. If the scan
+                               is interrupted after that (e.g., the job
+                               is preempted), running git-sizer again
+                               with the same '--checkpoint' resumes from
+                               the saved list instead of walking the
+                               history again. The checkpoint is refused
+                               if it was written by another version of
+                               git-sizer, with different options, or for
+                               different references. FILE is removed
+                               when the scan completes. Can't be combined
+                               with '--sample-rate' or '--max-commits'
+      --limit-memory=SIZE      use roughly at most SIZE of memory (e.g.,
+                               '4g') for the tables that grow with the
+                               number of objects: the sizes of the
+                               blobs, trees, and commits, and the number
+                               of references to each blob. If there are
+                               too many objects for that, the rest are
+                               spilled to temporary files, at the cost
+                               of making the scan much slower. Under
+                               the limit, the scan runs in memory as
+                               usual
+      --pre-receive            instead of scanning the repository, read
+                               reference updates from stdin in the format
+                               that Git passes to a 'pre-receive' hook
+                               ('<old-oid> <new-oid> <refname>' per line)
+                               and report the number and size of the
+                               objects that they introduce (those not
+                               reachable from any existing reference),
+                               in total and for each updated reference
+      --max-push-size=SIZE     with '--pre-receive', exit with status 2
+                               (which makes Git reject the push) if the
+                               objects that the push introduces total
+                               more than SIZE (e.g., '100m'), not
+                               counting compression
+      --timeout=DURATION       stop the scan after DURATION (e.g., '30m'),
+                               output the partial results, and exit with
+                               status 4, as if it had been interrupted. If
+                               the main scan has finished, its results
+                               are output, without the analyses that
+                               other options asked for that hadn't
+                               finished (which are listed). '--why' and
+                               '--pre-receive' just fail with status 4
+      --strict                 abort if any object is missing or can't be
+                               parsed. By default, such objects are skipped
+                               and listed at the end of the output, and
+                               git-sizer exits with status 5. Also abort if
+                               any reference points at a missing object
+                               (by default, such references are skipped
+                               with a warning)
+      --print-config           print the effective value of each option as
+                               JSON, along with where it came from (the
+                               command line, gitconfig, the environment,
+                               or the built-in default), then exit
+      --doctor                 check, without scanning, whether git-sizer
+                               can work with the git executable and the
+                               repository: git's path and version, the
+                               repository's location and object format,
+                               whether it is a shallow or partial clone
+                               or uses alternates, whether it has a
+                               commit-graph and bitmaps, and roughly how
+                               many objects it has. Each check reports
+                               'pass', 'warn', or 'FAIL', with a remedy
+                               for the latter two. The exit status is 0
+                               if all checks passed, 6 if some only
+                               warned, and 1 if any failed
+      --preflight              check, without looking at the repository,
+                               which optional capabilities the installed
+                               git has that some features depend on
+                               (e.g., 'cat-file %(objectsize:disk)' or
+                               the SHA-256 object format), by trying
+                               each of them in a scratch repository,
+                               and report which features they are used
+                               by, then exit. Fails only if git is
+                               missing or too old
       --version                only report the git-sizer version number
+      --help-exit-codes        list the exit statuses and their meanings
 
  Reference selection:
 
@@ -69,12 +598,21 @@ const usage = `usage: git-sizer [OPTS]
       --include @REFGROUP, --exclude @REFGROUP
                                process [don't process] references in the
                                specified reference group (see below)
+      --regexp-partial-match   let REGEXP patterns match any part of a
+                               reference name
+      --lenient-filters        skip an invalid REGEXP or undefined REFGROUP
+                               with a warning, instead of failing
       --show-refs              show which refs are being included/excluded
+      --explain-refs           like '--show-refs', but also show the option
+                               that decided whether each ref is included
+                               (the last one that matches it)
 
  PREFIX must match at a boundary; for example 'refs/foo' matches
  'refs/foo' and 'refs/foo/bar' but not 'refs/foobar'.
 
- REGEXP patterns must match the full reference name.
+ REGEXP patterns must match the full reference name, unless
+ '--regexp-partial-match' is specified, in which case they only have
+ to match part of it (use '^' and '$' to anchor them explicitly).
 
  REFGROUP can be the name of a predefined reference group ('branches',
  'tags', 'remotes', 'pulls', 'changes', 'notes', or 'stash'), or one
@@ -87,73 +625,56 @@ const usage = `usage: git-sizer [OPTS]
    * 'refgroup.REFGROUP.exclude=PREFIX'
    * 'refgroup.REFGROUP.excludeRegexp=REGEXP'
 
+ Default options can be put in the 'GIT_SIZER_OPTS' environment
+ variable, which is split into words like a shell would (honoring
+ quotes and backslashes). They are processed before the command-line
+ options, which therefore override them. With '--verbose' or
+ '--log-json', the options taken from it are reported on stderr.
+
 `
 
 var ReleaseVersion string
 var BuildVersion string
 
+// reportedError wraps an error that `mainImplementation()` has
+// already reported (e.g., to the JSON log), so that `main()` doesn't
+// need to print it.
+type reportedError struct {
+	error
+}
+
+func (err reportedError) Unwrap() error {
+	return err.error
+}
+
 func main() {
-	err := mainImplementation(os.Stdout, os.Stderr, os.Args[1:])
+	err := mainImplementation(os.Stdin, os.Stdout, os.Stderr, os.Args[1:])
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "error: %s\n", err)
-		os.Exit(1)
+		if !errors.As(err, &reportedError{}) {
+			fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		}
+		os.Exit(exitCode(err))
 	}
 }
 
-func mainImplementation(stdout, stderr io.Writer, args []string) error {
-	var nameStyle sizes.NameStyle = sizes.NameStyleFull
-	var cpuprofile string
-	var jsonOutput bool
-	var jsonVersion int
-	var threshold sizes.Threshold = 1
-	var progress bool
-	var version bool
-	var showRefs bool
+func mainImplementation(stdin io.Reader, stdout, stderr io.Writer, args []string) (err error) {
+	o := newOptions()
+	var logger *diag.Logger
 
 	// Try to open the repository, but it's not an error yet if this
 	// fails, because the user might only be asking for `--help`.
 	repo, repoErr := git.NewRepository(".")
+	if repoErr == nil {
+		// `main()` only exits after this function has returned, so
+		// this reaps any helper processes on error paths, too:
+		defer repo.Close()
+	}
 
 	flags := pflag.NewFlagSet("git-sizer", pflag.ContinueOnError)
 	flags.Usage = func() {
 		fmt.Fprint(stdout, usage)
 	}
 
-	flags.VarP(
-		sizes.NewThresholdFlagValue(&threshold, 0),
-		"verbose", "v", "report all statistics, whether concerning or not",
-	)
-	flags.Lookup("verbose").NoOptDefVal = "true"
-
-	flags.Var(
-		sizes.NewThresholdFlagValue(&threshold, 1),
-		"no-verbose", "report statistics that are at all concerning",
-	)
-	flags.Lookup("no-verbose").NoOptDefVal = "true"
-
-	flags.Var(
-		&threshold, "threshold",
-		"minimum level of concern (i.e., number of stars) that should be\n"+
-			"                              reported",
-	)
-
-	flags.Var(
-		sizes.NewThresholdFlagValue(&threshold, 30),
-		"critical", "only report critical statistics",
-	)
-	flags.Lookup("critical").NoOptDefVal = "true"
-
-	flags.Var(
-		&nameStyle, "names",
-		"display names of large objects in the specified `style`:\n"+
-			"        --names=none            omit footnotes entirely\n"+
-			"        --names=hash            show only the SHA-1s of objects\n"+
-			"        --names=full            show full names",
-	)
-
-	flags.BoolVarP(&jsonOutput, "json", "j", false, "output results in JSON format")
-	flags.IntVar(&jsonVersion, "json-version", 1, "JSON format version to output (1 or 2)")
-
 	defaultProgress := false
 	if f, ok := stderr.(*os.File); ok {
 		atty, err := isatty.Isatty(f.Fd())
@@ -162,14 +683,8 @@ func mainImplementation(stdout, stderr io.Writer, args []string) error {
 		}
 	}
 
-	flags.BoolVar(&progress, "progress", defaultProgress, "report progress to stderr")
-	flags.BoolVar(&version, "version", false, "report the git-sizer version number")
-	flags.Var(&NegatedBoolValue{&progress}, "no-progress", "suppress progress output")
-	flags.Lookup("no-progress").NoOptDefVal = "true"
-
-	flags.StringVar(&cpuprofile, "cpuprofile", "", "write cpu profile to file")
-	if err := flags.MarkHidden("cpuprofile"); err != nil {
-		return fmt.Errorf("marking option hidden: %w", err)
+	if err := o.addFlags(flags, defaultProgress); err != nil {
+		return err
 	}
 
 	var configger refopts.Configger
@@ -184,20 +699,94 @@ func mainImplementation(stdout, stderr io.Writer, args []string) error {
 
 	rgb.AddRefopts(flags)
 
-	flags.BoolVar(&showRefs, "show-refs", false, "list the references being processed")
+	flags.BoolVar(&o.showRefs, "show-refs", false, "list the references being processed")
+	flags.BoolVar(
+		&o.explainRefs, "explain-refs", false,
+		"list the references being processed and the option that decided each one",
+	)
+	// `--filter-debug` is an undocumented synonym:
+	flags.BoolVar(
+		&o.explainRefs, "filter-debug", false,
+		"list the references being processed and the option that decided each one",
+	)
+	if err := flags.MarkHidden("filter-debug"); err != nil {
+		return err
+	}
 
 	flags.SortFlags = false
 
-	err = flags.Parse(args)
+	// Options from the environment are processed first, so that the
+	// command-line options override them:
+	envArgs, err := envOptions(os.Getenv)
+	if err != nil {
+		return err
+	}
+
+	flagUses, err := parseFlags(flags, envArgs, args)
 	if err != nil {
 		if errors.Is(err, pflag.ErrHelp) {
 			return nil
 		}
-		return err
+		return usageError{err}
+	}
+
+	if o.logJSON {
+		logger = diag.NewJSONLogger(stderr)
+		defer func() {
+			if err != nil {
+				logger.Error(err.Error(), nil)
+				err = reportedError{err}
+			}
+		}()
+	}
+
+	filterWarnings, err := rgb.CheckFilters()
+	if err != nil {
+		return usageError{err}
+	}
+
+	for _, warning := range append(checkFlagUses(flagUses), filterWarnings...) {
+		if logger != nil {
+			logger.Warn(warning, nil)
+		} else {
+			fmt.Fprintf(stderr, "warning: %s\n", warning)
+		}
+	}
+
+	if len(envArgs) != 0 {
+		if logger != nil {
+			logger.Info(
+				"using options from the environment",
+				diag.Fields{"variable": optionsEnvVar, "options": envArgs},
+			)
+		} else if o.threshold == 0 {
+			fmt.Fprintf(stderr, "note: using options from %s: %s\n", optionsEnvVar, quoteShellWords(envArgs))
+		}
+	}
+
+	// Say up front if the `git` executable is too old for some
+	// features, rather than letting them fail obscurely later:
+	var gitLimitations *sizes.GitLimitations
+	if repoErr == nil {
+		gitLimitations = sizes.CheckGitLimitations(repo)
+	}
+	if gitLimitations != nil {
+		if logger != nil {
+			logger.Warn(
+				"git is old, so some features are unavailable",
+				diag.Fields{
+					"version":     gitLimitations.Version,
+					"path":        gitLimitations.Path,
+					"unavailable": gitLimitations.Unavailable,
+				},
+			)
+		} else {
+			fmt.Fprintf(stderr, "warning: %s\n", gitLimitations.Warning())
+		}
 	}
 
-	if cpuprofile != "" {
-		f, err := os.Create(cpuprofile)
+	if o.cpuprofile != "" {
+		f, err := os.Create(o.cpuprofile)
 		if err != nil {
 			return fmt.Errorf("couldn't set up cpuprofile file: %w", err)
 		}
@@ -207,7 +796,12 @@ func mainImplementation(stdout, stderr io.Writer, args []string) error {
 		defer pprof.StopCPUProfile()
 	}
 
-	if version {
+	if o.helpExitCodes {
+		writeExitCodes(stdout)
+		return nil
+	}
+
+	if o.version {
 		if ReleaseVersion != "" {
 			fmt.Fprintf(stdout, "git-sizer release %s\n", ReleaseVersion)
 		} else {
@@ -217,104 +811,666 @@ func mainImplementation(stdout, stderr io.Writer, args []string) error {
 	}
 
 	if len(flags.Args()) != 0 {
-		return errors.New("excess arguments")
+		return usageErrorf("excess arguments")
+	}
+
+	if o.doctor {
+		return runDoctor(stdout, ".")
+	}
+
+	if o.preflight {
+		return runPreflight(stdout)
+	}
+
+	if err := o.check(flags); err != nil {
+		return err
 	}
 
 	if repoErr != nil {
 		return fmt.Errorf("couldn't open Git repository: %w", repoErr)
 	}
 
-	if jsonOutput {
-		if !flags.Changed("json-version") {
-			v, err := repo.ConfigIntDefault("sizer.jsonVersion", jsonVersion)
+	if err := o.readConfig(repo, flags); err != nil {
+		return err
+	}
+
+	if o.printConfigOnly {
+		settings, err := effectiveConfig(repo, flags, rgb, o.pathRules, os.Getenv)
+		if err != nil {
+			return err
+		}
+		return printConfig(stdout, settings)
+	}
+
+	// The first SIGINT stops the scan (or the analyses after it; see
+	// `runAnalyses()`), after which the results so far are output. It
+	// also stops `--why` and `--pre-receive`, which have no partial
+	// results. Once it has arrived, a second one kills the process as
+	// usual.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if o.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, o.timeout)
+		defer cancel()
+	}
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	if o.preReceive {
+		updates, err := sizes.ReadRefUpdates(stdin)
+		if err != nil {
+			return err
+		}
+		ps, err := sizes.ComputePushSize(ctx, repo, updates)
+		if err != nil {
+			if ctx.Err() != nil {
+				return stoppedError(ctx, "--pre-receive")
+			}
+			return err
+		}
+		if o.jsonOutput {
+			j, err := json.MarshalIndent(ps, "", "    ")
 			if err != nil {
-				return err
+				return fmt.Errorf("could not convert %v to json: %w", ps, err)
 			}
-			jsonVersion = v
-			if !(jsonVersion == 1 || jsonVersion == 2) {
-				return fmt.Errorf("JSON version (read from gitconfig) must be 1 or 2")
+			fmt.Fprintf(stdout, "%s\n", j)
+		} else if _, err := io.WriteString(stdout, ps.String()); err != nil {
+			return fmt.Errorf("writing output: %w", err)
+		}
+		if o.maxPushSize != 0 && uint64(ps.ObjectSize) > uint64(o.maxPushSize) {
+			return fmt.Errorf(
+				"%w: its new objects total %s, more than --max-push-size=%s",
+				errPushTooLarge,
+				sizes.FormatHumanBytes(uint64(ps.ObjectSize)),
+				sizes.FormatHumanBytes(uint64(o.maxPushSize)),
+			)
+		}
+		return nil
+	}
+
+	rg, err := rgb.Finish()
+	if err != nil {
+		return err
+	}
+
+	// Open the repository to compare with before scanning, so that a
+	// bad path is reported right away:
+	var otherRepo *git.Repository
+	if o.compareRepo != "" {
+		otherRepo, err = git.NewRepository(o.compareRepo)
+		if err != nil {
+			return fmt.Errorf("couldn't open Git repository '%s': %w", o.compareRepo, err)
+		}
+		defer otherRepo.Close()
+	}
+
+	// scanRG is the `RefGrouper` for the main scan, which also lists
+	// the references if requested. The other passes use `rg`, so
+	// that the list isn't repeated for each of them.
+	scanRG := rg
+	if o.explainRefs {
+		fmt.Fprintf(
+			stderr,
+			"References (included references marked with '+'; the option that decided in parentheses):\n",
+		)
+		scanRG = refopts.NewExplainRefGrouper(rg, rgb, stderr)
+	} else if o.showRefs {
+		fmt.Fprintf(stderr, "References (included references marked with '+'):\n")
+		scanRG = refopts.NewShowRefGrouper(rg, stderr)
+	}
+
+	if len(o.whyOIDs) != 0 {
+		oids := make([]git.OID, 0, len(o.whyOIDs))
+		for _, s := range o.whyOIDs {
+			oid, err := git.NewOID(s)
+			if err != nil {
+				return usageErrorf("--why requires a full object name, not %q", s)
 			}
-		} else if !(jsonVersion == 1 || jsonVersion == 2) {
-			return fmt.Errorf("JSON version must be 1 or 2")
+			oids = append(oids, oid)
 		}
+		rs, err := sizes.ExplainReachability(ctx, repo, scanRG, oids)
+		if err != nil {
+			if ctx.Err() != nil {
+				return stoppedError(ctx, "--why")
+			}
+			return err
+		}
+		if o.jsonOutput {
+			j, err := json.MarshalIndent(rs, "", "    ")
+			if err != nil {
+				return fmt.Errorf("could not convert %v to json: %w", rs, err)
+			}
+			fmt.Fprintf(stdout, "%s\n", j)
+		} else if _, err := io.WriteString(stdout, rs.String()); err != nil {
+			return fmt.Errorf("writing output: %w", err)
+		}
+		return nil
 	}
 
-	if !flags.Changed("threshold") &&
-		!flags.Changed("verbose") &&
-		!flags.Changed("no-verbose") &&
-		!flags.Changed("critical") {
-		s, err := repo.ConfigStringDefault("sizer.threshold", fmt.Sprintf("%g", threshold))
+	// colorize is decided before `stdout` might be wrapped below, so
+	// that it still reflects whether the output goes to a terminal.
+	colorize := useColor(o.colorMode, os.Getenv, stdout)
+
+	if o.assumeUnchanged {
+		// Don't shadow `err`, which the deferred function below sets:
+		var settings map[string]ConfigSetting
+		settings, err = effectiveConfig(repo, flags, rgb, o.pathRules, os.Getenv)
 		if err != nil {
 			return err
 		}
-		v, err := strconv.ParseFloat(s, 64)
+		var cache *resultCache
+		cache, err = openResultCache(repo, settings, colorize)
 		if err != nil {
-			return fmt.Errorf("parsing gitconfig value for 'sizer.threshold': %w", err)
+			return err
+		}
+		note := func(msg string) {
+			if logger != nil {
+				logger.Info(msg, nil)
+			} else {
+				fmt.Fprintf(stderr, "note: %s\n", msg)
+			}
+		}
+
+		entry := cache.fresh()
+		var savedAt string
+		if entry != nil {
+			savedAt = entry.SavedAt.Format(time.RFC3339)
+		}
+		switch {
+		case entry != nil && !o.verifyCache && !o.repairCache:
+			note(fmt.Sprintf(
+				"trusting the results cached at %s, because the references haven't changed since"+
+					" (use --verify-cache to check them)",
+				savedAt,
+			))
+			if _, err := stdout.Write(entry.Output); err != nil {
+				return fmt.Errorf("writing output: %w", err)
+			}
+			return nil
+		case entry != nil && o.verifyCache:
+			note(fmt.Sprintf("recomputing the results cached at %s to verify them", savedAt))
+		case entry != nil:
+			note(fmt.Sprintf("recomputing the results cached at %s to replace them", savedAt))
+		case cache.cached != nil:
+			note("recomputing the results, because the references have changed since they were cached")
+		default:
+			note("recomputing the results, because none are cached for these settings")
+		}
+
+		// Keep a copy of the output, and cache it or compare it with
+		// the cached results if the run succeeds:
+		var output bytes.Buffer
+		stdout = io.MultiWriter(stdout, &output)
+		defer func() {
+			if err != nil {
+				return
+			}
+			if entry == nil || !o.verifyCache {
+				err = cache.save(output.Bytes())
+				return
+			}
+			if bytes.Equal(output.Bytes(), entry.Output) {
+				note("the cached results match the recomputed ones")
+				return
+			}
+			if logger != nil {
+				removed, added := cacheMismatches(entry.Output, output.Bytes())
+				logger.Warn(
+					"the cached results don't match the recomputed ones",
+					diag.Fields{"cached": removed, "recomputed": added},
+				)
+			} else {
+				fmt.Fprintf(stderr, "the cached results don't match the recomputed ones:\n")
+				writeCacheMismatches(stderr, entry.Output, output.Bytes())
+			}
+			err = errors.New("the cached results are stale; use --repair-cache to replace them")
+		}()
+	}
+
+	// liveOutput, if set, displays the table while the scan runs. It
+	// is only used on a terminal, and replaces the progress meter,
+	// which would otherwise be drawn over it.
+	var liveOutput *liveTable
+	if o.live && isTerminal(stdout) {
+		liveOutput = newLiveTable(stdout, o.outputEncoding)
+	}
+
+	var progressMeter meter.Progress = meter.NoProgressMeter
+	if o.logJSON {
+		progressMeter = logger.Progress()
+	} else if o.progress && liveOutput == nil {
+		progressMeter = meter.NewProgressMeter(stderr, 100*time.Millisecond)
+	}
+
+	// dotOutput is where the commit graph is written, if requested.
+	// Only the top-level repository's graph is exported.
+	var dotOutput io.Writer
+	if o.exportDOT != "" {
+		f, createErr := os.Create(o.exportDOT)
+		if createErr != nil {
+			return fmt.Errorf("couldn't create DOT file: %w", createErr)
+		}
+		defer func() {
+			if closeErr := f.Close(); closeErr != nil && err == nil {
+				err = fmt.Errorf("writing DOT file: %w", closeErr)
+			}
+		}()
+		dotOutput = f
+	}
+
+	// sqlOutput is where the object inventory is written, if
+	// requested. Like the DOT output, it only covers the top-level
+	// repository.
+	var sqlOutput io.Writer
+	if o.exportSQLite != "" {
+		db, openErr := openSQLiteDatabase(o.exportSQLite)
+		if openErr != nil {
+			return openErr
 		}
-		threshold = sizes.Threshold(v)
+		defer func() {
+			if closeErr := db.Close(); closeErr != nil && err == nil {
+				err = fmt.Errorf("writing SQLite database: %w", closeErr)
+			}
+		}()
+		sqlOutput = db
 	}
 
-	if !flags.Changed("names") {
-		s, err := repo.ConfigStringDefault("sizer.names", "full")
+	var lookupOIDs []git.OID
+	if o.objectsFrom != "" {
+		lookupOIDs, err = readObjectIDs(stdin, o.objectsFrom)
 		if err != nil {
 			return err
 		}
-		err = nameStyle.Set(s)
+	}
+
+	// roots, exclude, and pathRules limit the scan, if requested.
+	// Like the DOT output and the object lookups, they only apply to
+	// the top-level repository.
+	var roots []git.Reference
+	var exclude []git.OID
+	if o.mergeBaseRange != "" {
+		root, mergeBase, err := sizes.ResolveMergeBaseRange(repo, o.mergeBaseRange)
 		if err != nil {
-			return fmt.Errorf("parsing gitconfig value for 'sizer.names': %w", err)
+			return fmt.Errorf("resolving --merge-base: %w", err)
 		}
+		roots = []git.Reference{root}
+		exclude = []git.OID{mergeBase}
 	}
 
-	if !flags.Changed("progress") && !flags.Changed("no-progress") {
-		v, err := repo.ConfigBoolDefault("sizer.progress", progress)
+	topLevel := true
+	var scanRepository func(repo *git.Repository) (sizes.HistorySize, error)
+	scanRepository = func(repo *git.Repository) (sizes.HistorySize, error) {
+		logger.Info("scanning repository", diag.Fields{"gitDir": repo.Path()})
+		opts := o.scanOptions()
+		if topLevel {
+			// These are only for the top-level repository:
+			opts.DOT, opts.SQL, opts.Checkpoint = dotOutput, sqlOutput, o.checkpointFile
+			opts.Roots, opts.Exclude = roots, exclude
+			opts.PathRules, opts.LookupOIDs = o.pathRules, lookupOIDs
+		}
+		if liveOutput != nil && topLevel {
+			// Only the top-level repository's scan is displayed.
+			opts.Snapshot = func(hs sizes.HistorySize) {
+				liveOutput.Update(hs.SnapshotTableString(rg.Groups(), o.threshold, colorize))
+			}
+			opts.SnapshotInterval = liveInterval
+		}
+		refGrouper := scanRG
+		scanRG = rg
+		topLevel = false
+		historySize, err := sizes.ScanRepositoryUsingGraphContext(
+			ctx, repo, refGrouper, o.nameStyle, progressMeter, opts,
+		)
 		if err != nil {
-			return fmt.Errorf("parsing gitconfig value for 'sizer.progress': %w", err)
+			if historySize.Partial {
+				return historySize, err
+			}
+			return sizes.HistorySize{}, err
 		}
-		progress = v
+		if o.recurseSubmodules {
+			if err := historySize.ScanSubmodules(
+				ctx, repo, rg, scanRepository,
+			); err != nil {
+				if ctx.Err() != nil {
+					historySize.Partial = true
+					return historySize, err
+				}
+				return sizes.HistorySize{}, err
+			}
+		}
+		return historySize, nil
 	}
 
-	rg, err := rgb.Finish()
-	if err != nil {
+	historySize, err := scanRepository(repo)
+	historySize.GitLimitations = gitLimitations
+	if err != nil && !historySize.Partial {
+		return fmt.Errorf("error scanning repository: %w", err)
+	}
+
+	env := analysisEnv{
+		opts:      o,
+		repo:      repo,
+		rg:        rg,
+		otherRepo: otherRepo,
+		warn: func(msg string) {
+			if logger != nil {
+				logger.Warn(msg, nil)
+			} else {
+				fmt.Fprintf(stderr, "warning: %s\n", msg)
+			}
+		},
+	}
+	list := analyses
+	if o.lfsCandidates {
+		list = lfsCandidatesAnalyses
+	}
+	if err := runAnalyses(ctx, &env, &historySize, list); err != nil {
 		return err
 	}
 
-	if showRefs {
-		fmt.Fprintf(stderr, "References (included references marked with '+'):\n")
-		rg = refopts.NewShowRefGrouper(rg, stderr)
+	if lc := env.lfsCandidates; lc != nil {
+		if err := liveOutput.Clear(); err != nil {
+			return fmt.Errorf("writing output: %w", err)
+		}
+		if o.jsonOutput {
+			j, err := json.MarshalIndent(lc, "", "    ")
+			if err != nil {
+				return fmt.Errorf("could not convert %v to json: %w", lc, err)
+			}
+			fmt.Fprintf(stdout, "%s\n", j)
+		} else if _, err := stdout.Write(o.outputEncoding.Encode(lc.String(), o.bom)); err != nil {
+			return fmt.Errorf("writing output: %w", err)
+		}
+		if historySize.Errors != nil {
+			return errCorruption
+		}
+		return nil
 	}
 
-	var progressMeter meter.Progress = meter.NoProgressMeter
-	if progress {
-		progressMeter = meter.NewProgressMeter(stderr, 100*time.Millisecond)
+	logWarnings(logger, "", &historySize)
+
+	if err := writeResults(stdout, o, &historySize, rg.Groups(), colorize, liveOutput); err != nil {
+		return err
 	}
 
-	historySize, err := sizes.ScanRepositoryUsingGraph(repo, rg, nameStyle, progressMeter)
-	if err != nil {
-		return fmt.Errorf("error scanning repository: %w", err)
+	if historySize.Partial {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return errTimedOut
+		}
+		return errInterrupted
+	}
+
+	if historySize.Errors != nil {
+		return errCorruption
 	}
 
-	if jsonOutput {
+	if flags.Changed("fail-on") && historySize.Worst != nil &&
+		sizes.Threshold(historySize.Worst.LevelOfConcern) >= o.failOn {
+		return fmt.Errorf(
+			"%w: %s has level of concern %.1f",
+			errLimitsExceeded, historySize.Worst.Symbol, historySize.Worst.LevelOfConcern,
+		)
+	}
+
+	return nil
+}
+
+// writeResults writes `hs` to `w` in the format that `o` selects,
+// with colors in the table if `colorize` is set. `liveOutput`, if
+// set, is cleared first.
+func writeResults(
+	w io.Writer, o *options, hs *sizes.HistorySize, groups []sizes.RefGroup,
+	colorize bool, liveOutput *liveTable,
+) error {
+	if o.jsonStream {
+		if o.bom {
+			fmt.Fprint(w, "\ufeff")
+		}
+		if err := hs.WriteJSONStream(w, groups); err != nil {
+			return fmt.Errorf("writing output: %w", err)
+		}
+	} else if o.jsonOutput {
 		var j []byte
 		var err error
-		switch jsonVersion {
+		switch o.jsonVersion {
 		case 1:
-			j, err = json.MarshalIndent(historySize, "", "    ")
+			j, err = json.MarshalIndent(*hs, "", "    ")
 		case 2:
-			j, err = historySize.JSON(rg.Groups(), threshold, nameStyle)
+			j, err = hs.JSON(groups, o.threshold, o.nameStyle)
 		default:
-			return fmt.Errorf("JSON version must be 1 or 2")
+			return usageErrorf("JSON version must be 1 or 2")
 		}
 		if err != nil {
-			return fmt.Errorf("could not convert %v to json: %w", historySize, err)
+			return fmt.Errorf("could not convert %v to json: %w", *hs, err)
+		}
+		if o.bom {
+			fmt.Fprint(w, "\ufeff")
+		}
+		fmt.Fprintf(w, "%s\n", j)
+	} else if o.porcelain {
+		if err := hs.WritePorcelain(w, groups); err != nil {
+			return fmt.Errorf("writing output: %w", err)
+		}
+	} else if o.outputTemplate != nil {
+		var buf bytes.Buffer
+		if err := hs.WriteTemplate(&buf, o.outputTemplate, groups, o.threshold); err != nil {
+			return fmt.Errorf("executing output template: %w", err)
+		}
+		if _, err := w.Write(o.outputEncoding.Encode(buf.String(), o.bom)); err != nil {
+			return fmt.Errorf("writing output: %w", err)
 		}
-		fmt.Fprintf(stdout, "%s\n", j)
 	} else {
-		if _, err := io.WriteString(
-			stdout, historySize.TableString(rg.Groups(), threshold, nameStyle),
-		); err != nil {
+		table := hs.TableString(groups, o.threshold, o.nameStyle, colorize)
+		if err := liveOutput.Clear(); err != nil {
+			return fmt.Errorf("writing output: %w", err)
+		}
+		if _, err := w.Write(o.outputEncoding.Encode(table, o.bom)); err != nil {
 			return fmt.Errorf("writing output: %w", err)
 		}
 	}
 
 	return nil
 }
+
+// logWarnings logs a warning for each problem recorded in `hs` (and,
+// recursively, in the submodules that were scanned along with it).
+// `prefix` is prepended to the paths of submodules.
+func logWarnings(logger *diag.Logger, prefix string, hs *sizes.HistorySize) {
+	if logger == nil {
+		return
+	}
+
+	if hs.BrokenReferences != nil {
+		refs := make([]diag.Fields, 0, len(hs.BrokenReferences.References))
+		for _, ref := range hs.BrokenReferences.References {
+			refs = append(refs, diag.Fields{
+				"refname": git.DisplayString(ref.Refname),
+				"oid":     ref.OID.String(),
+			})
+		}
+		logger.Warn(
+			"references point at missing objects and were skipped",
+			diag.Fields{
+				"count":      hs.BrokenReferences.Count,
+				"references": refs,
+			},
+		)
+	}
+
+	if hs.Errors != nil {
+		logger.Warn(
+			"objects could not be read and were skipped",
+			diag.Fields{
+				"count":   hs.Errors.Count,
+				"objects": hs.Errors.Objects,
+			},
+		)
+	}
+
+	if hs.PackStats != nil && hs.PackStats.Skipped != "" {
+		logger.Warn(
+			"packfile indexes could not be read, so objects weren't attributed to packfiles",
+			diag.Fields{
+				"reason": hs.PackStats.Skipped,
+			},
+		)
+	}
+
+	if hs.GitlinkCheck != nil && hs.GitlinkCheck.Count != 0 {
+		logger.Warn(
+			"gitlinks don't match .gitmodules at branch tips",
+			diag.Fields{
+				"count":    hs.GitlinkCheck.Count,
+				"problems": hs.GitlinkCheck.Problems,
+			},
+		)
+	}
+
+	for path, sm := range hs.Submodules {
+		if sm.Skipped != "" {
+			logger.Warn(
+				"submodule was skipped",
+				diag.Fields{
+					"path":   prefix + path,
+					"reason": sm.Skipped,
+				},
+			)
+		}
+		if sm.Size != nil {
+			logWarnings(logger, prefix+path+"/", sm.Size)
+		}
+	}
+}
+
+// readObjectIDs reads the object IDs to be looked up from the file
+// named `filename`, or from `stdin` if it is "-".
+func readObjectIDs(stdin io.Reader, filename string) ([]git.OID, error) {
+	if filename == "-" {
+		return sizes.ReadObjectIDs(stdin)
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("opening --objects-from file: %w", err)
+	}
+	defer f.Close()
+	return sizes.ReadObjectIDs(f)
+}
+
+// parseDate parses `s`, which is either a date like "2006-01-02"
+// (taken to be midnight UTC) or a timestamp in RFC 3339 format.
+func parseDate(s string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is not a date (YYYY-MM-DD) or an RFC 3339 timestamp", s)
+	}
+	return t, nil
+}
+
+// writeTreeDOT writes the directory hierarchy in `ds` to the file
+// named `filename` in DOT format (see `--export-tree-dot`).
+func writeTreeDOT(filename string, ds *sizes.DirectorySizes, minBytes counts.Count64) (err error) {
+	f, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("couldn't create DOT file: %w", err)
+	}
+	defer func() {
+		if closeErr := f.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("writing DOT file: %w", closeErr)
+		}
+	}()
+
+	if err := ds.WriteDOT(f, minBytes); err != nil {
+		return fmt.Errorf("writing DOT file: %w", err)
+	}
+	return nil
+}
+
+// writeNamesFile writes `objects` to the file named `filename` (see
+// `--names-file`).
+func writeNamesFile(filename string, objects []sizes.NamedObject) error {
+	return writeFileAtomically(filename, "names file", func(w io.Writer) error {
+		return sizes.WriteNamedObjects(w, objects)
+	})
+}
+
+// writeFileAtomically calls `write` to write the contents of the file
+// named `filename`, which is described by `what` in error messages.
+// The file is written under a temporary name in the same directory
+// and then renamed, so that readers never see it incomplete.
+func writeFileAtomically(filename, what string, write func(w io.Writer) error) (err error) {
+	f, err := os.CreateTemp(filepath.Dir(filename), "."+filepath.Base(filename)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("couldn't create %s: %w", what, err)
+	}
+	defer func() {
+		if err != nil {
+			_ = f.Close()
+			_ = os.Remove(f.Name())
+		}
+	}()
+
+	if err := f.Chmod(0o644); err != nil {
+		return fmt.Errorf("couldn't create %s: %w", what, err)
+	}
+	if err := write(f); err != nil {
+		return fmt.Errorf("writing %s: %w", what, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("writing %s: %w", what, err)
+	}
+	if err := os.Rename(f.Name(), filename); err != nil {
+		return fmt.Errorf("writing %s: %w", what, err)
+	}
+	return nil
+}
+
+// trackFile returns the name of the file in which `--track` stores
+// the results for the repository whose git dir is `gitDir`: a file
+// in the user's cache directory, named after a hash of `gitDir`.
+func trackFile(gitDir string) (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("finding the directory for --track: %w", err)
+	}
+	sum := sha256.Sum256([]byte(gitDir))
+	return filepath.Join(
+		cacheDir, "git-sizer", "track", hex.EncodeToString(sum[:])+".json",
+	), nil
+}
+
+// trackGrowth compares `hs` with the results that were stored for
+// the repository whose git dir is `gitDir` by the previous run with
+// `--track`, if any, setting `hs.Growth`, then stores the results of
+// this run in their place.
+func trackGrowth(hs *sizes.HistorySize, refGroups []sizes.RefGroup, gitDir string) error {
+	filename, err := trackFile(gitDir)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(filename)
+	switch {
+	case err == nil:
+		previous, err := sizes.ReadTrackedRun(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", filename, err)
+		}
+		hs.Growth = hs.ComputeGrowth(refGroups, previous)
+	case !os.IsNotExist(err):
+		return fmt.Errorf("reading previous results: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(filename), 0o755); err != nil {
+		return fmt.Errorf("couldn't create directory for --track: %w", err)
+	}
+	tr := hs.TrackedRun(refGroups, gitDir, time.Now())
+	return writeFileAtomically(filename, "results for --track", tr.Write)
+}
@@ -0,0 +1,74 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/github/git-sizer/internal/pipe"
+)
+
+// ObjectHeaders looks up the types and sizes of `oids` using `git
+// cat-file --batch-check`. The headers are returned in the same
+// order; the type of objects that don't exist is "missing".
+func (repo *Repository) ObjectHeaders(ctx context.Context, oids []OID) ([]BatchHeader, error) {
+	return repo.objectHeaders(ctx, oids, "")
+}
+
+// PeeledObjectHeaders is like `ObjectHeaders()`, except that any
+// annotated tags among `oids` are peeled (recursively), and the
+// headers of the objects that they point at are returned instead.
+func (repo *Repository) PeeledObjectHeaders(ctx context.Context, oids []OID) ([]BatchHeader, error) {
+	return repo.objectHeaders(ctx, oids, "^{}")
+}
+
+// objectHeaders looks up the objects named by each of `oids` followed
+// by `suffix`.
+func (repo *Repository) objectHeaders(
+	ctx context.Context, oids []OID, suffix string,
+) ([]BatchHeader, error) {
+	var stdin bytes.Buffer
+	for _, oid := range oids {
+		fmt.Fprintf(&stdin, "%s%s\n", oid, suffix)
+	}
+
+	headers := make([]BatchHeader, 0, len(oids))
+
+	p := pipe.New(pipe.WithStdin(&stdin))
+	p.Add(
+		pipe.CommandStage(
+			"git-cat-file",
+			repo.GitCommand("cat-file", "--batch-check", "--buffer"),
+		),
+		pipe.Function(
+			"read-headers",
+			func(_ context.Context, _ pipe.Env, stdin io.Reader, _ io.Writer) error {
+				f := bufio.NewReader(stdin)
+				for _, oid := range oids {
+					header, err := f.ReadString('\n')
+					if err != nil {
+						return fmt.Errorf("reading from 'git cat-file': %w", err)
+					}
+					if strings.HasSuffix(header, " missing\n") {
+						headers = append(headers, BatchHeader{OID: oid, ObjectType: "missing"})
+						continue
+					}
+					batchHeader, err := ParseBatchHeader("", header)
+					if err != nil {
+						return fmt.Errorf("parsing output of 'git cat-file': %w", err)
+					}
+					headers = append(headers, batchHeader)
+				}
+				return nil
+			},
+		),
+	)
+
+	if err := p.Run(ctx); err != nil {
+		return nil, err
+	}
+	return headers, nil
+}
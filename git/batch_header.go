@@ -21,7 +21,7 @@ var missingHeader = BatchHeader{
 // Parse a `cat-file --batch[-check]` output header line (including
 // the trailing LF). `spec`, if not "", is used in error messages.
 func ParseBatchHeader(spec string, header string) (BatchHeader, error) {
-	header = header[:len(header)-1]
+	header = strings.TrimSuffix(header, "\n")
 	words := strings.Split(header, " ")
 	if words[len(words)-1] == "missing" {
 		if spec == "" {
@@ -29,6 +29,9 @@ func ParseBatchHeader(spec string, header string) (BatchHeader, error) {
 		}
 		return missingHeader, fmt.Errorf("missing object %s", spec)
 	}
+	if len(words) != 3 || words[1] == "" {
+		return missingHeader, fmt.Errorf("malformed object header %q", header)
+	}
 
 	oid, err := NewOID(words[0])
 	if err != nil {
@@ -37,7 +40,7 @@ func ParseBatchHeader(spec string, header string) (BatchHeader, error) {
 
 	size, err := strconv.ParseUint(words[2], 10, 0)
 	if err != nil {
-		return missingHeader, err
+		return missingHeader, fmt.Errorf("malformed object size in header %q", header)
 	}
 	return BatchHeader{
 		OID:        oid,
@@ -0,0 +1,45 @@
+package git_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/github/git-sizer/counts"
+	"github.com/github/git-sizer/git"
+)
+
+func TestParseBatchHeader(t *testing.T) {
+	t.Parallel()
+
+	const hex = "0123456789abcdef0123456789abcdef01234567"
+
+	header, err := git.ParseBatchHeader("", hex+" blob 123\n")
+	require.NoError(t, err)
+	assert.Equal(t, hex, header.OID.String())
+	assert.Equal(t, git.ObjectType("blob"), header.ObjectType)
+	assert.Equal(t, counts.Count32(123), header.ObjectSize)
+
+	// Unknown types are passed through for the caller to deal with:
+	header, err = git.ParseBatchHeader("", hex+" bogus 5\n")
+	require.NoError(t, err)
+	assert.Equal(t, git.ObjectType("bogus"), header.ObjectType)
+
+	_, err = git.ParseBatchHeader("HEAD", hex+" missing\n")
+	assert.EqualError(t, err, "missing object HEAD")
+
+	for _, line := range []string{
+		"\n",
+		"",
+		hex + "\n",
+		hex + " blob\n",
+		hex + "  123\n",
+		hex + " blob 123 extra\n",
+		hex + " blob many\n",
+		"nonsense blob 123\n",
+	} {
+		_, err := git.ParseBatchHeader("", line)
+		assert.Errorf(t, err, "parsing %q", line)
+	}
+}
@@ -3,8 +3,11 @@ package git
 import (
 	"bufio"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"strings"
+	"sync"
 
 	"github.com/github/git-sizer/internal/pipe"
 )
@@ -20,9 +23,14 @@ type ObjectRecord struct {
 type BatchObjectIter struct {
 	ctx   context.Context
 	p     *pipe.Pipeline
+	child *child
 	oidCh chan OID
 	objCh chan ObjectRecord
 	errCh chan error
+
+	// closed is closed when no more objects will be requested.
+	closed    chan struct{}
+	closeOnce sync.Once
 }
 
 // NewBatchObjectIter returns a `*BatchObjectIterator` and an
@@ -31,12 +39,14 @@ type BatchObjectIter struct {
 // `io.WriteCloser` should normally be closed and the iterator's
 // output drained before `Close()` is called.
 func (repo *Repository) NewBatchObjectIter(ctx context.Context) (*BatchObjectIter, error) {
+	ctx, cancel := context.WithCancel(ctx)
 	iter := BatchObjectIter{
-		ctx:   ctx,
-		p:     pipe.New(),
-		oidCh: make(chan OID),
-		objCh: make(chan ObjectRecord),
-		errCh: make(chan error),
+		ctx:    ctx,
+		p:      pipe.New(),
+		oidCh:  make(chan OID),
+		objCh:  make(chan ObjectRecord),
+		errCh:  make(chan error),
+		closed: make(chan struct{}),
 	}
 
 	iter.p.Add(
@@ -49,13 +59,12 @@ func (repo *Repository) NewBatchObjectIter(ctx context.Context) (*BatchObjectIte
 
 				for {
 					select {
-					case oid, ok := <-iter.oidCh:
-						if !ok {
-							return out.Flush()
-						}
+					case oid := <-iter.oidCh:
 						if _, err := fmt.Fprintln(out, oid.String()); err != nil {
 							return fmt.Errorf("writing to 'git cat-file': %w", err)
 						}
+					case <-iter.closed:
+						return out.Flush()
 					case <-ctx.Done():
 						return ctx.Err()
 					}
@@ -87,6 +96,23 @@ func (repo *Repository) NewBatchObjectIter(ctx context.Context) (*BatchObjectIte
 						}
 						return fmt.Errorf("reading from 'git cat-file': %w", err)
 					}
+					if oidString := strings.TrimSuffix(header, " missing\n"); oidString != header {
+						// The object disappeared after it was
+						// listed. Report it with type "missing" and
+						// let the caller decide what to do:
+						oid, err := NewOID(oidString)
+						if err != nil {
+							return fmt.Errorf("parsing output of 'git cat-file': %w", err)
+						}
+						select {
+						case iter.objCh <- ObjectRecord{
+							BatchHeader: BatchHeader{OID: oid, ObjectType: "missing"},
+						}:
+						case <-iter.ctx.Done():
+							return iter.ctx.Err()
+						}
+						continue
+					}
 					batchHeader, err := ParseBatchHeader("", header)
 					if err != nil {
 						return fmt.Errorf("parsing output of 'git cat-file': %w", err)
@@ -116,7 +142,12 @@ func (repo *Repository) NewBatchObjectIter(ctx context.Context) (*BatchObjectIte
 		),
 	)
 
-	if err := iter.p.Start(ctx); err != nil {
+	iter.child = &child{
+		closeInput: iter.Close,
+		cancel:     cancel,
+		waitFn:     iter.p.Wait,
+	}
+	if err := repo.startChild(iter.child, func() error { return iter.p.Start(ctx) }); err != nil {
 		return nil, err
 	}
 
@@ -130,15 +161,17 @@ func (iter *BatchObjectIter) RequestObject(oid OID) error {
 	select {
 	case iter.oidCh <- oid:
 		return nil
+	case <-iter.closed:
+		return errors.New("requesting an object from a closed batch object iterator")
 	case <-iter.ctx.Done():
 		return iter.ctx.Err()
 	}
 }
 
-// Close closes the iterator and frees up resources. Close must be
-// called exactly once.
+// Close closes the iterator and frees up resources. It can be called
+// more than once.
 func (iter *BatchObjectIter) Close() {
-	close(iter.oidCh)
+	iter.closeOnce.Do(func() { close(iter.closed) })
 }
 
 // Next either returns the next object (its header and contents), or a
@@ -150,7 +183,7 @@ func (iter *BatchObjectIter) Next() (ObjectRecord, bool, error) {
 	if !ok {
 		return ObjectRecord{
 			BatchHeader: missingHeader,
-		}, false, iter.p.Wait()
+		}, false, iter.child.wait()
 	}
 	return obj, true, nil
 }
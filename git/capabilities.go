@@ -0,0 +1,161 @@
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Capability is an optional feature of the `git` executable that some
+// of git-sizer's features depend on. Git versions older than
+// `MinimumGitVersion` are refused outright; these are the things that
+// even a new-enough git might not support, depending on how it was
+// built or how new it is.
+type Capability struct {
+	// Name is a short description of the capability, like
+	// "cat-file %(objectsize:disk)".
+	Name string
+
+	// NeededFor describes the git-sizer features that depend on the
+	// capability.
+	NeededFor string
+
+	// Since is the first version of Git that has the capability, or
+	// the zero value if every version that git-sizer supports has
+	// it (as far as is known; a git might still have been built
+	// without it).
+	Since GitVersion
+
+	// probe checks for the capability using the scratch repository
+	// whose git dir is `gitdir`. It returns nil if the capability is
+	// available.
+	probe func(gitbin, gitdir string) error
+}
+
+// Capabilities are the optional capabilities that `ProbeCapabilities()`
+// checks for.
+var Capabilities = []Capability{
+	{
+		Name:      "cat-file %(objectsize:disk)",
+		NeededFor: "--by-remote, --tag-only, --notes-only, and --pre-receive",
+		probe: func(gitbin, gitdir string) error {
+			return runProbe(gitDirCommand(
+				gitbin, gitdir, "cat-file", "--batch-check=%(objectsize:disk)",
+			))
+		},
+	},
+	{
+		Name:      "rev-list --missing",
+		NeededFor: "scanning partial clones without --strict",
+		probe: func(gitbin, gitdir string) error {
+			return runProbe(gitDirCommand(
+				gitbin, gitdir, "rev-list", "--objects", "--missing=print", "--stdin",
+			))
+		},
+	},
+	{
+		Name:      "rev-parse --show-object-format",
+		NeededFor: "detecting the object format (otherwise SHA-1 is assumed)",
+		probe: func(gitbin, gitdir string) error {
+			out, err := gitDirCommand(gitbin, gitdir, "rev-parse", "--show-object-format").Output()
+			if err != nil {
+				return err
+			}
+			if format := string(bytes.TrimSpace(out)); format != "sha1" {
+				// Older versions of Git echo options that they
+				// don't know.
+				return fmt.Errorf("unexpected output %q", format)
+			}
+			return nil
+		},
+	},
+	{
+		Name:      "SHA-256 object format",
+		NeededFor: "scanning repositories that use SHA-256 object IDs",
+		Since:     GitVersion{2, 29, 0},
+		probe: func(gitbin, gitdir string) error {
+			return runProbe(initCommand(
+				gitbin, filepath.Join(filepath.Dir(gitdir), "sha256.git"),
+				"--object-format=sha256",
+			))
+		},
+	},
+}
+
+// CapabilityResult is the outcome of probing for a `Capability`.
+type CapabilityResult struct {
+	Capability
+
+	// Err is nil if the capability is available, or otherwise the
+	// reason why it isn't.
+	Err error
+}
+
+// Available reports whether the capability is available.
+func (r CapabilityResult) Available() bool {
+	return r.Err == nil
+}
+
+// UnavailableCapabilities returns the `Capabilities` that Git version
+// `v` is too old to have. Unlike `ProbeCapabilities()`, it doesn't run
+// anything, so it is cheap enough to check on every run.
+func UnavailableCapabilities(v GitVersion) []Capability {
+	var unavailable []Capability
+	for _, c := range Capabilities {
+		if v.Less(c.Since) {
+			unavailable = append(unavailable, c)
+		}
+	}
+	return unavailable
+}
+
+// ProbeCapabilities checks which of `Capabilities` the `git` executable
+// `gitbin` supports, by trying each of them in a scratch repository
+// that it creates in a temporary directory. An error is returned only
+// if the scratch repository can't be set up.
+func ProbeCapabilities(gitbin string) ([]CapabilityResult, error) {
+	dir, err := os.MkdirTemp("", "git-sizer-preflight-")
+	if err != nil {
+		return nil, fmt.Errorf("creating a scratch directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	gitdir := filepath.Join(dir, "scratch.git")
+	if err := runProbe(initCommand(gitbin, gitdir)); err != nil {
+		return nil, fmt.Errorf("creating a scratch repository: %w", err)
+	}
+
+	results := make([]CapabilityResult, 0, len(Capabilities))
+	for _, c := range Capabilities {
+		results = append(results, CapabilityResult{c, c.probe(gitbin, gitdir)})
+	}
+	return results, nil
+}
+
+// initCommand returns an `*exec.Cmd` that creates a bare repository
+// at `gitdir`. `GIT_DIR` is set explicitly so that one inherited from
+// the environment can't redirect it.
+func initCommand(gitbin, gitdir string, args ...string) *exec.Cmd {
+	cmd := exec.Command(gitbin, append([]string{"init", "-q", "--bare"}, args...)...)
+	cmd.Env = setEnv(os.Environ(), "GIT_DIR", gitdir)
+	return cmd
+}
+
+// runProbe runs `cmd` with empty stdin. If it fails, the error
+// includes the first line of its stderr, which usually says what git
+// didn't like.
+func runProbe(cmd *exec.Cmd) error {
+	var stderr bytes.Buffer
+	cmd.Stdin = strings.NewReader("")
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if line := strings.SplitN(strings.TrimSpace(stderr.String()), "\n", 2)[0]; line != "" {
+			return fmt.Errorf("%w: %s", err, line)
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,279 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/github/git-sizer/internal/pipe"
+)
+
+// Attribute is a gitattribute that applies to a path, as reported by
+// `git check-attr`.
+type Attribute struct {
+	Name string
+
+	// Value is "set", "unset", or the value that the attribute is
+	// set to.
+	Value string
+}
+
+// String returns `a` in the notation used in `.gitattributes` files;
+// e.g., `binary`, `-text`, or `diff=lfs`.
+func (a Attribute) String() string {
+	switch a.Value {
+	case "set":
+		return a.Name
+	case "unset":
+		return "-" + a.Name
+	default:
+		return a.Name + "=" + a.Value
+	}
+}
+
+// ForEachBlobAttributes calls `fn` for each blob in the tree
+// referred to by `rev` that has any gitattributes, passing it the
+// blob's path and the attributes that apply to it. The attributes are
+// taken from the `.gitattributes` files in that tree (plus
+// `$GIT_DIR/info/attributes` and `core.attributesFile`), not from
+// any working tree. It returns the total number of blobs in the tree,
+// including those without any attributes.
+//
+// This works by reading the tree into a temporary index, so it works
+// in bare repositories and with any version of Git that supports
+// `git check-attr --cached`.
+func (repo *Repository) ForEachBlobAttributes(
+	ctx context.Context, rev string, fn func(path string, attrs []Attribute) error,
+) (int, error) {
+	indexEnv, cleanup, err := repo.readTreeIntoTemporaryIndex(rev)
+	if err != nil {
+		return 0, err
+	}
+	defer cleanup()
+
+	lsFiles := repo.GitCommand("ls-files", "--cached", "--stage", "-z")
+	lsFiles.Env = append(lsFiles.Env, indexEnv)
+
+	checkAttr := repo.GitCommand("check-attr", "--cached", "--stdin", "-z", "--all")
+	checkAttr.Env = append(checkAttr.Env, indexEnv)
+
+	var blobCount int
+
+	p := pipe.New()
+	p.Add(
+		pipe.CommandStage("git-ls-files", lsFiles),
+
+		// Parse the `ls-files` output, which is of the form
+		// `<mode> SP <oid> SP <stage> TAB <path> NUL`, and pass the
+		// paths of blobs (i.e., everything but submodules) along to
+		// `check-attr`:
+		pipe.Function(
+			"select-blobs",
+			func(_ context.Context, _ pipe.Env, stdin io.Reader, stdout io.Writer) error {
+				in := bufio.NewReader(stdin)
+				out := bufio.NewWriter(stdout)
+				for {
+					record, err := readNULTerminated(in, "git ls-files")
+					if err != nil {
+						return err
+					}
+					if record == nil {
+						return out.Flush()
+					}
+
+					tab := bytes.IndexByte(record, '\t')
+					if tab == -1 {
+						return fmt.Errorf("malformed 'git ls-files' output: %q", record)
+					}
+					if bytes.HasPrefix(record, []byte("160000 ")) {
+						continue
+					}
+
+					blobCount++
+					if _, err := out.Write(record[tab+1:]); err != nil {
+						return err
+					}
+					if err := out.WriteByte(0); err != nil {
+						return err
+					}
+				}
+			},
+		),
+
+		pipe.CommandStage("git-check-attr", checkAttr),
+
+		// Parse the `check-attr` output, which consists of
+		// `<path> NUL <attribute> NUL <value> NUL` triples. The
+		// triples for a given path are adjacent, and paths without
+		// any attributes are omitted:
+		pipe.Function(
+			"collate-attributes",
+			func(_ context.Context, _ pipe.Env, stdin io.Reader, _ io.Writer) error {
+				in := bufio.NewReader(stdin)
+
+				var path string
+				var attrs []Attribute
+				flush := func() error {
+					if len(attrs) == 0 {
+						return nil
+					}
+					err := fn(path, attrs)
+					attrs = nil
+					return err
+				}
+
+				for {
+					var fields [3]string
+					for i := range fields {
+						field, err := readNULTerminated(in, "git check-attr")
+						if err != nil {
+							return err
+						}
+						if field == nil {
+							if i != 0 {
+								return errors.New("truncated 'git check-attr' output")
+							}
+							return flush()
+						}
+						fields[i] = string(field)
+					}
+
+					if fields[0] != path {
+						if err := flush(); err != nil {
+							return err
+						}
+						path = fields[0]
+					}
+					attrs = append(attrs, Attribute{Name: fields[1], Value: fields[2]})
+				}
+			},
+		),
+	)
+
+	if err := p.Run(ctx); err != nil {
+		return 0, err
+	}
+
+	return blobCount, nil
+}
+
+// CheckAttr uses `git check-attr` to look up the value of the
+// gitattribute `attr` for each of `paths`, according to the
+// attributes in the tree referred to by `rev` (as for
+// `ForEachBlobAttributes()`). The paths needn't exist in that tree.
+// The returned map holds the value for each path: "set", "unset",
+// "unspecified", or the value that the attribute is set to.
+func (repo *Repository) CheckAttr(
+	ctx context.Context, rev, attr string, paths []string,
+) (map[string]string, error) {
+	indexEnv, cleanup, err := repo.readTreeIntoTemporaryIndex(rev)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	checkAttr := repo.GitCommand("check-attr", "--cached", "--stdin", "-z", attr)
+	checkAttr.Env = append(checkAttr.Env, indexEnv)
+
+	values := make(map[string]string, len(paths))
+
+	p := pipe.New()
+	p.Add(
+		pipe.Function(
+			"request-paths",
+			func(_ context.Context, _ pipe.Env, _ io.Reader, stdout io.Writer) error {
+				out := bufio.NewWriter(stdout)
+				for _, path := range paths {
+					if _, err := out.WriteString(path); err != nil {
+						return err
+					}
+					if err := out.WriteByte(0); err != nil {
+						return err
+					}
+				}
+				return out.Flush()
+			},
+		),
+
+		pipe.CommandStage("git-check-attr", checkAttr),
+
+		// The output consists of one `<path> NUL <attribute> NUL
+		// <value> NUL` triple per path:
+		pipe.Function(
+			"read-values",
+			func(_ context.Context, _ pipe.Env, stdin io.Reader, _ io.Writer) error {
+				in := bufio.NewReader(stdin)
+				for {
+					var fields [3]string
+					for i := range fields {
+						field, err := readNULTerminated(in, "git check-attr")
+						if err != nil {
+							return err
+						}
+						if field == nil {
+							if i != 0 {
+								return errors.New("truncated 'git check-attr' output")
+							}
+							return nil
+						}
+						fields[i] = string(field)
+					}
+					values[fields[0]] = fields[2]
+				}
+			},
+		),
+	)
+
+	if err := p.Run(ctx); err != nil {
+		return nil, err
+	}
+
+	return values, nil
+}
+
+// readTreeIntoTemporaryIndex reads the tree referred to by `rev` into
+// a new temporary index file. It returns the environment setting
+// that makes git commands use that index, and a function that removes
+// the index again.
+func (repo *Repository) readTreeIntoTemporaryIndex(rev string) (string, func(), error) {
+	tmpDir, err := os.MkdirTemp("", "git-sizer-attr-")
+	if err != nil {
+		return "", nil, fmt.Errorf("creating temporary directory: %w", err)
+	}
+	cleanup := func() { os.RemoveAll(tmpDir) }
+
+	indexEnv := "GIT_INDEX_FILE=" + filepath.Join(tmpDir, "index")
+
+	cmd := repo.GitCommand("read-tree", rev)
+	cmd.Env = append(cmd.Env, indexEnv)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf(
+			"reading '%s' into temporary index: %w: %s", rev, err, bytes.TrimSpace(out),
+		)
+	}
+
+	return indexEnv, cleanup, nil
+}
+
+// readNULTerminated reads the next NUL-terminated record from `in`
+// and returns it without the terminator. At a clean EOF, it returns
+// `nil, nil`. `command` is used in error messages.
+func readNULTerminated(in *bufio.Reader, command string) ([]byte, error) {
+	record, err := in.ReadBytes(0)
+	if err != nil {
+		if err == io.EOF {
+			if len(record) != 0 {
+				return nil, fmt.Errorf("unterminated record in '%s' output: %q", command, record)
+			}
+			return nil, nil
+		}
+		return nil, fmt.Errorf("reading '%s' output: %w", command, err)
+	}
+	return record[:len(record)-1], nil
+}
@@ -0,0 +1,129 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// childExitTimeout is how long `Repository.Close()` gives a helper
+// process to exit after its input has been closed, before killing it.
+const childExitTimeout = 2 * time.Second
+
+// ErrRepositoryClosed is returned when trying to start a helper
+// process in a repository that has been closed.
+var ErrRepositoryClosed = errors.New("the repository has been closed")
+
+// child is a long-lived helper that `repo` has started, like the `git
+// cat-file --batch` pipeline behind a `BatchObjectIter`. Its owner
+// normally waits for it to finish, but if the owner is abandoned
+// (e.g., because a scan failed or was cancelled), `Repository.Close()`
+// reaps it.
+type child struct {
+	repo *Repository
+
+	// closeInput tells the child that no more input is coming, so
+	// that it can finish normally. It must be idempotent.
+	closeInput func()
+
+	// cancel kills the child.
+	cancel context.CancelFunc
+
+	// waitFn waits for the child to exit. It is only called once, by
+	// `wait()`.
+	waitFn func() error
+
+	waitOnce sync.Once
+	err      error
+}
+
+// startChild calls `start` to start `c`, and registers it so that
+// `Close()` can reap it, unless `repo` has already been closed. If
+// `c` can't be started, it is cancelled.
+func (repo *Repository) startChild(c *child, start func() error) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	if repo.closed {
+		c.cancel()
+		return ErrRepositoryClosed
+	}
+	if err := start(); err != nil {
+		c.cancel()
+		return err
+	}
+
+	c.repo = repo
+	if repo.children == nil {
+		repo.children = make(map[*child]struct{})
+	}
+	repo.children[c] = struct{}{}
+	return nil
+}
+
+// wait waits for `c` to exit and returns its error. It can be called
+// any number of times, including concurrently.
+func (c *child) wait() error {
+	c.waitOnce.Do(func() {
+		c.err = c.waitFn()
+		c.cancel()
+
+		c.repo.mu.Lock()
+		delete(c.repo.children, c)
+		c.repo.mu.Unlock()
+	})
+	return c.err
+}
+
+// reap closes `c`'s input and waits for it to exit. If it doesn't
+// exit within `childExitTimeout`, it is killed.
+func (c *child) reap() {
+	c.closeInput()
+
+	done := make(chan struct{})
+	go func() {
+		_ = c.wait()
+		close(done)
+	}()
+
+	timer := time.NewTimer(childExitTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-done:
+		return
+	case <-timer.C:
+	}
+
+	c.cancel()
+	<-done
+}
+
+// Close reaps any helper processes that `repo` started and that are
+// still running or haven't been waited for; e.g., because the
+// iterator reading from them was abandoned when a scan failed or was
+// cancelled. Each one's input is closed, so that it can finish
+// normally; if it doesn't do so promptly, it is killed. Once `Close()`
+// has been called, no more helper processes can be started. It can be
+// called more than once, and concurrently with the cancellation of a
+// scan.
+func (repo *Repository) Close() {
+	repo.mu.Lock()
+	repo.closed = true
+	children := make([]*child, 0, len(repo.children))
+	for c := range repo.children {
+		children = append(children, c)
+	}
+	repo.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, c := range children {
+		wg.Add(1)
+		go func(c *child) {
+			defer wg.Done()
+			c.reap()
+		}(c)
+	}
+	wg.Wait()
+}
@@ -2,6 +2,9 @@ package git
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/github/git-sizer/counts"
 )
@@ -11,6 +14,66 @@ type Commit struct {
 	Size    counts.Count32
 	Parents []OID
 	Tree    OID
+
+	// Author and Committer are the commit's author and committer, or
+	// nil if the corresponding header is missing or malformed.
+	Author    *Signature
+	Committer *Signature
+
+	// Encoding is the value of the commit's `encoding` header, or ""
+	// if it has none (which means that the message is UTF-8).
+	Encoding string
+
+	// Signed is true if the commit has a `gpgsig` or `gpgsig-sha256`
+	// header. The signature is not verified.
+	Signed bool
+}
+
+// Signature is the identity and timestamp from an `author`,
+// `committer`, or `tagger` header.
+type Signature struct {
+	Name  string
+	Email string
+	When  time.Time
+}
+
+// ParseSignature parses the value of an `author`, `committer`, or
+// `tagger` header, which has the form
+//
+//	Name <email> <seconds since epoch> <+|-><hhmm>
+func ParseSignature(value string) (*Signature, error) {
+	lt := strings.IndexByte(value, '<')
+	gt := strings.LastIndexByte(value, '>')
+	if lt == -1 || gt < lt {
+		return nil, fmt.Errorf("missing email in %q", value)
+	}
+
+	words := strings.Fields(value[gt+1:])
+	if len(words) != 2 {
+		return nil, fmt.Errorf("missing timestamp in %q", value)
+	}
+	seconds, err := strconv.ParseInt(words[0], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("malformed timestamp in %q", value)
+	}
+	tz := words[1]
+	if len(tz) != 5 || (tz[0] != '+' && tz[0] != '-') {
+		return nil, fmt.Errorf("malformed time zone in %q", value)
+	}
+	hhmm, err := strconv.ParseUint(tz[1:], 10, 16)
+	if err != nil || hhmm%100 >= 60 {
+		return nil, fmt.Errorf("malformed time zone in %q", value)
+	}
+	offset := int(hhmm/100*3600 + hhmm%100*60)
+	if tz[0] == '-' {
+		offset = -offset
+	}
+
+	return &Signature{
+		Name:  strings.TrimSpace(value[:lt]),
+		Email: value[lt+1 : gt],
+		When:  time.Unix(seconds, 0).In(time.FixedZone(tz, offset)),
+	}, nil
 }
 
 // ParseCommit parses the commit object whose contents are in `data`.
@@ -19,6 +82,9 @@ func ParseCommit(oid OID, data []byte) (*Commit, error) {
 	var parents []OID
 	var tree OID
 	var treeFound bool
+	var author, committer *Signature
+	var encoding string
+	var signed bool
 	iter, err := NewObjectHeaderIter(oid.String(), data)
 	if err != nil {
 		return nil, err
@@ -44,14 +110,27 @@ func ParseCommit(oid OID, data []byte) (*Commit, error) {
 				return nil, fmt.Errorf("malformed tree header in commit %s", oid)
 			}
 			treeFound = true
+		case "author":
+			// A malformed author is tolerated, but reported as nil:
+			author, _ = ParseSignature(value)
+		case "committer":
+			committer, _ = ParseSignature(value)
+		case "encoding":
+			encoding = value
+		case "gpgsig", "gpgsig-sha256":
+			signed = true
 		}
 	}
 	if !treeFound {
 		return nil, fmt.Errorf("no tree found in commit %s", oid)
 	}
 	return &Commit{
-		Size:    counts.NewCount32(uint64(len(data))),
-		Parents: parents,
-		Tree:    tree,
+		Size:      counts.NewCount32(uint64(len(data))),
+		Parents:   parents,
+		Tree:      tree,
+		Author:    author,
+		Committer: committer,
+		Encoding:  encoding,
+		Signed:    signed,
 	}, nil
 }
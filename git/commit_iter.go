@@ -0,0 +1,136 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/github/git-sizer/internal/pipe"
+)
+
+// ForEachCommit calls `fn` for each commit that is reachable from
+// `roots` (which may also include annotated tags) but not from
+// `exclude`, passing it the commit's OID and the OIDs of its parents.
+// The commits are visited parents-first, and otherwise in (roughly)
+// chronological order.
+func (repo *Repository) ForEachCommit(
+	ctx context.Context, roots, exclude []OID, fn func(oid OID, parents []OID) error,
+) error {
+	var stdin bytes.Buffer
+	for _, root := range roots {
+		fmt.Fprintln(&stdin, root)
+	}
+	for _, oid := range exclude {
+		fmt.Fprintf(&stdin, "^%s\n", oid)
+	}
+
+	p := pipe.New(pipe.WithStdin(&stdin))
+	p.Add(
+		pipe.CommandStage(
+			"git-rev-list",
+			repo.GitCommand("rev-list", "--stdin", "--date-order", "--reverse", "--parents"),
+		),
+		pipe.LinewiseFunction(
+			"parse-commits",
+			func(_ context.Context, _ pipe.Env, line []byte, _ *bufio.Writer) error {
+				fields := strings.Fields(string(line))
+				if len(fields) == 0 {
+					return fmt.Errorf("malformed 'git rev-list' output: %q", line)
+				}
+				oids := make([]OID, len(fields))
+				for i, field := range fields {
+					oid, err := NewOID(field)
+					if err != nil {
+						return fmt.Errorf("parsing 'git rev-list' output: %w", err)
+					}
+					oids[i] = oid
+				}
+				return fn(oids[0], oids[1:])
+			},
+		),
+	)
+
+	return p.Run(ctx)
+}
+
+// NewestCommits returns up to `n` of the commits that are reachable
+// from `roots` (which may also include annotated tags), newest first,
+// like `git rev-list --max-count=n`. The walk proceeds from all of
+// the roots at once, so the commits are those nearest to the tips.
+// If `firstParent` is set, only the first parents of merges are
+// followed.
+func (repo *Repository) NewestCommits(
+	ctx context.Context, roots []OID, n int, firstParent bool,
+) ([]OID, error) {
+	var commits []OID
+	if len(roots) == 0 || n <= 0 {
+		return commits, nil
+	}
+
+	args := []string{"rev-list", "--stdin", fmt.Sprintf("--max-count=%d", n)}
+	if firstParent {
+		args = append(args, "--first-parent")
+	}
+
+	var stdin bytes.Buffer
+	for _, root := range roots {
+		fmt.Fprintln(&stdin, root)
+	}
+
+	p := pipe.New(pipe.WithStdin(&stdin))
+	p.Add(
+		pipe.CommandStage("git-rev-list", repo.GitCommand(args...)),
+		pipe.LinewiseFunction(
+			"parse-commits",
+			func(_ context.Context, _ pipe.Env, line []byte, _ *bufio.Writer) error {
+				oid, err := NewOID(string(line))
+				if err != nil {
+					return fmt.Errorf("parsing 'git rev-list' output: %w", err)
+				}
+				commits = append(commits, oid)
+				return nil
+			},
+		),
+	)
+
+	if err := p.Run(ctx); err != nil {
+		return nil, err
+	}
+	return commits, nil
+}
+
+// CountCommits returns the number of commits that are reachable from
+// `roots`, like `git rev-list --count`. If `firstParent` is set, only
+// the first parents of merges are followed.
+func (repo *Repository) CountCommits(
+	ctx context.Context, roots []OID, firstParent bool,
+) (uint64, error) {
+	if len(roots) == 0 {
+		return 0, nil
+	}
+
+	args := []string{"rev-list", "--stdin", "--count"}
+	if firstParent {
+		args = append(args, "--first-parent")
+	}
+
+	var stdin bytes.Buffer
+	for _, root := range roots {
+		fmt.Fprintln(&stdin, root)
+	}
+
+	cmd := repo.GitCommand(args...)
+	cmd.Stdin = &stdin
+	out, err := cmd.Output()
+	if err != nil {
+		return 0, fmt.Errorf("running 'git rev-list --count': %w", err)
+	}
+	count, err := strconv.ParseUint(strings.TrimSpace(string(out)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("parsing 'git rev-list --count' output: %w", err)
+	}
+	return count, nil
+}
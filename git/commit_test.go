@@ -0,0 +1,88 @@
+package git_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/github/git-sizer/git"
+)
+
+func TestParseSignature(t *testing.T) {
+	t.Parallel()
+
+	sig, err := git.ParseSignature("A U Thor <author@example.com> 1112911993 -0700")
+	require.NoError(t, err)
+	assert.Equal(t, "A U Thor", sig.Name)
+	assert.Equal(t, "author@example.com", sig.Email)
+	assert.Equal(t, int64(1112911993), sig.When.Unix())
+	_, offset := sig.When.Zone()
+	assert.Equal(t, -7*3600, offset)
+
+	// An empty name is allowed:
+	sig, err = git.ParseSignature("<nobody@example.com> 0 +0000")
+	require.NoError(t, err)
+	assert.Equal(t, "", sig.Name)
+	assert.Equal(t, time.Unix(0, 0).Unix(), sig.When.Unix())
+
+	for _, value := range []string{
+		"",
+		"A U Thor",
+		"A U Thor <author@example.com",
+		"A U Thor <author@example.com>",
+		"A U Thor <author@example.com> 1112911993",
+		"A U Thor <author@example.com> soon -0700",
+		"A U Thor <author@example.com> 1112911993 0700",
+		"A U Thor <author@example.com> 1112911993 -07:00",
+		"A U Thor <author@example.com> 1112911993 -0799",
+		"A U Thor <author@example.com> 99999999999999999999 -0700",
+	} {
+		_, err := git.ParseSignature(value)
+		assert.Errorf(t, err, "parsing %q", value)
+	}
+}
+
+func TestParseCommit(t *testing.T) {
+	t.Parallel()
+
+	const tree = "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+	commit, err := git.ParseCommit(
+		git.NullOID,
+		[]byte("tree "+tree+"\n"+
+			"author A U Thor <author@example.com> 1112911993 -0700\n"+
+			"committer Broken\n"+
+			"encoding ISO-8859-1\n"+
+			"\n"+
+			"Caf\xe9\n"),
+	)
+	require.NoError(t, err)
+	assert.Equal(t, tree, commit.Tree.String())
+	assert.Empty(t, commit.Parents)
+	if assert.NotNil(t, commit.Author) {
+		assert.Equal(t, "A U Thor", commit.Author.Name)
+	}
+	assert.Nil(t, commit.Committer)
+	assert.Equal(t, "ISO-8859-1", commit.Encoding)
+
+	assert.False(t, commit.Signed)
+
+	commit, err = git.ParseCommit(
+		git.NullOID,
+		[]byte("tree "+tree+"\n"+
+			"author A U Thor <author@example.com> 1112911993 -0700\n"+
+			"committer A U Thor <author@example.com> 1112911993 -0700\n"+
+			"gpgsig -----BEGIN SSH SIGNATURE-----\n"+
+			" U1NIU0lHAAAAAQ==\n"+
+			" -----END SSH SIGNATURE-----\n"+
+			"\n"+
+			"Signed\n"),
+	)
+	require.NoError(t, err)
+	assert.True(t, commit.Signed)
+	assert.NotNil(t, commit.Committer)
+
+	_, err = git.ParseCommit(git.NullOID, []byte("author A U Thor <a@example.com> 0 +0000\n\n"))
+	assert.Error(t, err)
+}
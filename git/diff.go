@@ -0,0 +1,165 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/github/git-sizer/internal/pipe"
+)
+
+// CommitParent pairs a commit with the parent that it should be
+// compared with. Parent is `NullOID` for a root commit, which is
+// compared with the empty tree.
+type CommitParent struct {
+	Commit OID
+	Parent OID
+}
+
+// TreeChange describes a path whose entry differs between the tree
+// of a commit and the tree of its parent.
+type TreeChange struct {
+	// Path is the full path of the entry. Only entries for
+	// non-trees (blobs, symlinks, and submodules) are reported.
+	Path string
+
+	// OldOID and NewOID are the OIDs of the entry before and after
+	// the change. One of them is `NullOID` if the entry was added or
+	// deleted.
+	OldOID OID
+	NewOID OID
+
+	// Status is the status letter reported by `git diff-tree` (e.g.,
+	// 'A' for added, 'D' for deleted, 'M' for modified, or 'T' for a
+	// change in type).
+	Status byte
+}
+
+// ForEachCommitDiff uses `git diff-tree` to compare the tree of each
+// commit in `commits` with that of the specified parent, and calls
+// `fn` once for each commit, in order, with the entries that differ.
+// Renames are not detected.
+func (repo *Repository) ForEachCommitDiff(
+	ctx context.Context, commits []CommitParent,
+	fn func(commit OID, changes []TreeChange) error,
+) error {
+	if len(commits) == 0 {
+		return nil
+	}
+
+	var stdin bytes.Buffer
+	for _, cp := range commits {
+		if cp.Parent == NullOID {
+			fmt.Fprintln(&stdin, cp.Commit)
+		} else {
+			fmt.Fprintf(&stdin, "%s %s\n", cp.Commit, cp.Parent)
+		}
+	}
+
+	p := pipe.New(pipe.WithStdin(&stdin))
+	p.Add(
+		pipe.CommandStage(
+			"git-diff-tree",
+			repo.GitCommand(
+				"diff-tree", "--stdin", "-r", "--root", "--always",
+				"--no-renames", "--raw", "-z",
+			),
+		),
+		pipe.Function(
+			"parse-diff-tree",
+			func(_ context.Context, _ pipe.Env, stdin io.Reader, _ io.Writer) error {
+				return parseDiffTree(bufio.NewReader(stdin), fn)
+			},
+		),
+	)
+
+	return p.Run(ctx)
+}
+
+// parseDiffTree parses the output of `git diff-tree --stdin --always
+// --raw -z`, which consists of a commit OID followed by the raw diff
+// records for that commit, for each commit.
+func parseDiffTree(
+	in *bufio.Reader, fn func(commit OID, changes []TreeChange) error,
+) error {
+	const command = "git diff-tree"
+
+	var commit OID
+	var changes []TreeChange
+	started := false
+
+	for {
+		record, err := readNULTerminated(in, command)
+		if err != nil {
+			return err
+		}
+		if record == nil {
+			break
+		}
+
+		if len(record) == 0 || record[0] != ':' {
+			// This is the OID of the next commit.
+			if started {
+				if err := fn(commit, changes); err != nil {
+					return err
+				}
+			}
+			commit, err = NewOID(string(record))
+			if err != nil {
+				return fmt.Errorf("parsing '%s' output: %w", command, err)
+			}
+			changes = nil
+			started = true
+			continue
+		}
+
+		if !started {
+			return fmt.Errorf("unexpected '%s' output: %q", command, record)
+		}
+
+		change, err := readRawChange(in, record, command)
+		if err != nil {
+			return err
+		}
+		changes = append(changes, change)
+	}
+
+	if started {
+		return fn(commit, changes)
+	}
+	return nil
+}
+
+// readRawChange parses `record`, a raw diff record of the form
+//
+//	:<old mode> <new mode> <old oid> <new oid> <status>
+//
+// as output by `command` with `-z`, and reads the path that follows
+// it in a separate record from `in`.
+func readRawChange(in *bufio.Reader, record []byte, command string) (TreeChange, error) {
+	fields := bytes.Fields(record[1:])
+	if len(fields) != 5 || len(fields[4]) == 0 {
+		return TreeChange{}, fmt.Errorf("malformed '%s' output: %q", command, record)
+	}
+	change := TreeChange{Status: fields[4][0]}
+	var err error
+	if change.OldOID, err = NewOID(string(fields[2])); err != nil {
+		return TreeChange{}, fmt.Errorf("parsing '%s' output: %w", command, err)
+	}
+	if change.NewOID, err = NewOID(string(fields[3])); err != nil {
+		return TreeChange{}, fmt.Errorf("parsing '%s' output: %w", command, err)
+	}
+
+	path, err := readNULTerminated(in, command)
+	if err != nil {
+		return TreeChange{}, err
+	}
+	if path == nil {
+		return TreeChange{}, fmt.Errorf("missing path in '%s' output", command)
+	}
+	change.Path = string(path)
+
+	return change, nil
+}
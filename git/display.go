@@ -0,0 +1,112 @@
+package git
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// DisplayString returns a version of `s` (e.g., a reference name or
+// a path within a tree) that is safe to write to a terminal. Git
+// treats such names as arbitrary byte strings, so they might contain
+// control characters or bytes that are not valid UTF-8. Common
+// control characters are escaped C-style (e.g., `\t`); other control
+// characters and any bytes that are not part of a valid UTF-8
+// sequence are written as `\xNN`. Strings that don't need any
+// escaping are returned unchanged.
+//
+// This should be applied only when generating human-readable output;
+// internally, names should be kept (and compared) in their raw form.
+func DisplayString(s string) string {
+	if !needsEscaping(s) {
+		return s
+	}
+
+	var sb strings.Builder
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case r == utf8.RuneError && size <= 1:
+			fmt.Fprintf(&sb, `\x%02x`, s[i])
+		case r == '\t':
+			sb.WriteString(`\t`)
+		case r == '\n':
+			sb.WriteString(`\n`)
+		case r == '\r':
+			sb.WriteString(`\r`)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(&sb, `\x%02x`, r)
+		default:
+			sb.WriteString(s[i : i+size])
+		}
+		i += size
+	}
+	return sb.String()
+}
+
+// needsEscaping returns true iff `s` contains any bytes that
+// `DisplayString()` would escape.
+func needsEscaping(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c < 0x20 || c == 0x7f {
+			return true
+		}
+	}
+	return !utf8.ValidString(s)
+}
+
+// QuotePath returns `s` quoted the way that Git quotes paths in its
+// porcelain output formats when `core.quotePath` is on (its default):
+// if `s` contains a double quote, a backslash, a control character, or
+// any non-ASCII byte, it is enclosed in double quotes, and those bytes
+// are escaped C-style (e.g., `\t` or `\"`), or as three-digit octal
+// escapes (e.g., `\303\251` for "é"). An empty string is written as
+// `""`. Other strings are returned unchanged. The result never
+// contains a newline.
+func QuotePath(s string) string {
+	if s != "" && !needsQuoting(s) {
+		return s
+	}
+
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"', '\\':
+			sb.WriteByte('\\')
+			sb.WriteByte(c)
+		case '\a':
+			sb.WriteString(`\a`)
+		case '\b':
+			sb.WriteString(`\b`)
+		case '\t':
+			sb.WriteString(`\t`)
+		case '\n':
+			sb.WriteString(`\n`)
+		case '\v':
+			sb.WriteString(`\v`)
+		case '\f':
+			sb.WriteString(`\f`)
+		case '\r':
+			sb.WriteString(`\r`)
+		default:
+			if c < 0x20 || c >= 0x7f {
+				fmt.Fprintf(&sb, `\%03o`, c)
+			} else {
+				sb.WriteByte(c)
+			}
+		}
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
+
+// needsQuoting returns true iff `QuotePath()` would quote `s`.
+func needsQuoting(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c < 0x20 || c >= 0x7f || c == '"' || c == '\\' {
+			return true
+		}
+	}
+	return false
+}
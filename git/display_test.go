@@ -0,0 +1,68 @@
+package git_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/github/git-sizer/git"
+)
+
+func TestDisplayString(t *testing.T) {
+	t.Parallel()
+
+	for _, p := range []struct {
+		s        string
+		expected string
+	}{
+		{"refs/heads/master", "refs/heads/master"},
+		{"refs/heads/café", "refs/heads/café"},
+		{"refs/heads/caf\xe9", `refs/heads/caf\xe9`},
+		{"refs/heads/a\tb", `refs/heads/a\tb`},
+		{"refs/heads/a\nb", `refs/heads/a\nb`},
+		{"refs/heads/a\rb", `refs/heads/a\rb`},
+		{"refs/heads/\x1b[31mred", `refs/heads/\x1b[31mred`},
+		{"refs/heads/del\x7f", `refs/heads/del\x7f`},
+		{"refs/heads/\xe2\x82", `refs/heads/\xe2\x82`},
+		{"dir/file\xff\xfe.txt", `dir/file\xff\xfe.txt`},
+		{"", ""},
+	} {
+		p := p
+		t.Run(
+			fmt.Sprintf("%q", p.s),
+			func(t *testing.T) {
+				t.Parallel()
+				assert.Equal(t, p.expected, git.DisplayString(p.s))
+			},
+		)
+	}
+}
+
+func TestQuotePath(t *testing.T) {
+	t.Parallel()
+
+	for _, p := range []struct {
+		s        string
+		expected string
+	}{
+		{"dir/file.txt", "dir/file.txt"},
+		{"with space", "with space"},
+		{"", `""`},
+		{"café", `"caf\303\251"`},
+		{"caf\xe9", `"caf\351"`},
+		{"a\tb\nc", `"a\tb\nc"`},
+		{`say "hi"`, `"say \"hi\""`},
+		{`back\slash`, `"back\\slash"`},
+		{"\x1b[31mred\x7f", `"\033[31mred\177"`},
+	} {
+		p := p
+		t.Run(
+			fmt.Sprintf("%q", p.s),
+			func(t *testing.T) {
+				t.Parallel()
+				assert.Equal(t, p.expected, git.QuotePath(p.s))
+			},
+		)
+	}
+}
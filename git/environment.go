@@ -0,0 +1,232 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// This file holds the checks that `NewRepository()` uses to decide
+// whether it can work with the `git` executable and the repository,
+// along with some other checks of the repository's setup. They are
+// exported so that `git-sizer --doctor` can report the same findings
+// without scanning anything.
+
+// GitVersion is a version of Git, as reported by `git version`.
+type GitVersion struct {
+	Major, Minor, Patch int
+}
+
+// MinimumGitVersion is the oldest version of Git that supports all of
+// the commands and options that git-sizer uses. (The newest of those
+// is `git rev-list --in-commit-order`, which appeared in Git 2.19.)
+var MinimumGitVersion = GitVersion{2, 19, 0}
+
+func (v GitVersion) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// Less reports whether `v` is older than `other`.
+func (v GitVersion) Less(other GitVersion) bool {
+	if v.Major != other.Major {
+		return v.Major < other.Major
+	}
+	if v.Minor != other.Minor {
+		return v.Minor < other.Minor
+	}
+	return v.Patch < other.Patch
+}
+
+// ParseGitVersion parses the output of `git version`, like "git
+// version 2.39.5". Anything after the first three numbers, like
+// ".windows.1" or " (Apple Git-154)", is ignored, and a missing patch
+// number is taken to be zero.
+func ParseGitVersion(s string) (GitVersion, error) {
+	words := strings.Fields(s)
+	if len(words) < 3 || words[0] != "git" || words[1] != "version" {
+		return GitVersion{}, fmt.Errorf("unexpected 'git version' output: %q", s)
+	}
+
+	parts := strings.SplitN(words[2], ".", 4)
+	if len(parts) < 2 {
+		return GitVersion{}, fmt.Errorf("unexpected 'git version' output: %q", s)
+	}
+	var numbers [3]int
+	for i := 0; i < len(numbers) && i < len(parts); i++ {
+		n, err := strconv.Atoi(parts[i])
+		if err != nil {
+			if i == 2 {
+				// E.g., "2.40.0-rc0"; the patch number doesn't
+				// matter much.
+				break
+			}
+			return GitVersion{}, fmt.Errorf("unexpected 'git version' output: %q", s)
+		}
+		numbers[i] = n
+	}
+	return GitVersion{numbers[0], numbers[1], numbers[2]}, nil
+}
+
+// FindGit returns the path of the `git` executable that git-sizer uses
+// (see `findGitBin()`).
+func FindGit() (string, error) {
+	gitBin, err := findGitBin()
+	if err != nil {
+		return "", fmt.Errorf(
+			"could not find 'git' executable (is it in your PATH?): %w", err,
+		)
+	}
+	return gitBin, nil
+}
+
+// ReadGitVersion returns the version of the `git` executable `gitbin`.
+func ReadGitVersion(gitbin string) (GitVersion, error) {
+	out, err := exec.Command(gitbin, "version").Output()
+	if err != nil {
+		return GitVersion{}, fmt.Errorf("could not run 'git version': %w", err)
+	}
+	return ParseGitVersion(string(bytes.TrimSpace(out)))
+}
+
+// CheckGitVersion returns an error if `v` is older than
+// `MinimumGitVersion`.
+func CheckGitVersion(v GitVersion) error {
+	if v.Less(MinimumGitVersion) {
+		return fmt.Errorf(
+			"git %s is too old; git-sizer requires git %s or newer",
+			v, MinimumGitVersion,
+		)
+	}
+	return nil
+}
+
+// gitDirCommand returns an `*exec.Cmd` for running `gitbin` with
+// `args` in the repository whose git dir is `gitdir`.
+func gitDirCommand(gitbin, gitdir string, args ...string) *exec.Cmd {
+	cmd := exec.Command(gitbin, args...)
+	cmd.Dir = gitdir
+	cmd.Env = setEnv(os.Environ(), "GIT_DIR", gitdir)
+	return cmd
+}
+
+// gitDirPath returns the path of `name` (e.g., "objects/pack") within
+// `gitdir`, as reported by `git rev-parse --git-path`.
+func gitDirPath(gitbin, gitdir, name string) (string, error) {
+	out, err := gitDirCommand(gitbin, gitdir, "rev-parse", "--git-path", name).Output()
+	if err != nil {
+		return "", fmt.Errorf("could not run 'git rev-parse --git-path %s': %w", name, err)
+	}
+	return smartJoin(gitdir, string(bytes.TrimSpace(out))), nil
+}
+
+// IsPartialClone reports whether the repository in `gitdir` is a
+// partial clone; i.e., whether it has a promisor remote from which
+// missing objects are fetched on demand.
+func IsPartialClone(gitbin, gitdir string) (bool, error) {
+	out, err := gitDirCommand(
+		gitbin, gitdir,
+		"config", "--get-regexp", `^(extensions\.partialclone|remote\..*\.promisor)$`,
+	).Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+			// No such settings.
+			return false, nil
+		}
+		return false, fmt.Errorf("could not read gitconfig: %w", err)
+	}
+
+	for _, line := range strings.Split(string(out), "\n") {
+		words := strings.SplitN(line, " ", 2)
+		if len(words) != 2 {
+			continue
+		}
+		key, value := words[0], words[1]
+		switch {
+		case key == "extensions.partialclone" && value != "":
+			return true, nil
+		case strings.HasSuffix(key, ".promisor") && value == "true":
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Alternates returns the alternate object directories that the
+// repository in `gitdir` borrows objects from, as listed in
+// `objects/info/alternates`.
+func Alternates(gitbin, gitdir string) ([]string, error) {
+	path, err := gitDirPath(gitbin, gitdir, "objects/info/alternates")
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var alternates []string
+	in := bufio.NewScanner(f)
+	for in.Scan() {
+		line := strings.TrimSpace(in.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		alternates = append(alternates, line)
+	}
+	return alternates, in.Err()
+}
+
+// HasCommitGraph reports whether the repository in `gitdir` has a
+// commit-graph file (or a chain of them), which speeds up walking the
+// history.
+func HasCommitGraph(gitbin, gitdir string) (bool, error) {
+	for _, name := range []string{
+		"objects/info/commit-graph",
+		"objects/info/commit-graphs/commit-graph-chain",
+	} {
+		path, err := gitDirPath(gitbin, gitdir, name)
+		if err != nil {
+			return false, err
+		}
+		if _, err := os.Stat(path); err == nil {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// HasBitmaps reports whether the repository in `gitdir` has any
+// reachability bitmaps, for a single packfile or a multi-pack index.
+func HasBitmaps(gitbin, gitdir string) (bool, error) {
+	dir, err := gitDirPath(gitbin, gitdir, "objects/pack")
+	if err != nil {
+		return false, err
+	}
+	matches, err := filepath.Glob(filepath.Join(dir, "*.bitmap"))
+	if err != nil {
+		return false, err
+	}
+	return len(matches) != 0, nil
+}
+
+// CountStoredObjects returns the number of objects stored in the
+// repository in `gitdir`, loose or packed, as reported by `git
+// count-objects -v` (see `Repository.StoredObjectCount()`).
+func CountStoredObjects(gitbin, gitdir string) (uint64, error) {
+	values, err := countObjects(gitDirCommand(gitbin, gitdir, "count-objects", "-v"))
+	if err != nil {
+		return 0, err
+	}
+	return values["count"] + values["in-pack"], nil
+}
@@ -7,6 +7,8 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
+	"sync"
 )
 
 // ObjectType represents the type of a Git object ("blob", "tree",
@@ -20,21 +22,95 @@ type Repository struct {
 	// gitBin is the path of the `git` executable that should be used
 	// when running commands in this repository.
 	gitBin string
+
+	// gitVersion is the version of `gitBin`.
+	gitVersion GitVersion
+
+	// objectFormat is the repository's object format ("sha1" or
+	// "sha256").
+	objectFormat string
+
+	// mu protects `children` and `closed`.
+	mu sync.Mutex
+
+	// children are the long-lived helpers that are running in the
+	// repository (see `startChild()`).
+	children map[*child]struct{}
+
+	// closed is set once `Close()` has been called.
+	closed bool
 }
 
 // smartJoin returns the path that can be described as `relPath`
 // relative to `path`, given that `path` is either absolute or is
-// relative to the current directory.
+// relative to the current directory. `relPath` is a path as printed
+// by Git, so it is converted to a native path first (see
+// `nativePath()`).
 func smartJoin(path, relPath string) string {
+	relPath = nativePath(relPath)
 	if filepath.IsAbs(relPath) {
-		return relPath
+		return filepath.Clean(relPath)
 	}
 	return filepath.Join(path, relPath)
 }
 
-// GitDir gets repo's git-dir
+// setEnv returns `env` (a list of `NAME=value` entries, as used in
+// `exec.Cmd.Env`), with any existing entries for `name` removed and
+// `name=value` appended. The name is used with its exact casing, but
+// on platforms where environment variable names are
+// case-insensitive, existing entries that differ only in case are
+// removed, too. `env` is not modified.
+func setEnv(env []string, name, value string) []string {
+	return append(unsetEnv(env, name), name+"="+value)
+}
+
+// unsetEnv returns `env` with any entries for the variables in
+// `names` removed (see `setEnv()` regarding case). `env` is not
+// modified.
+func unsetEnv(env []string, names ...string) []string {
+	result := make([]string, 0, len(env)+1)
+envLoop:
+	for _, e := range env {
+		if i := strings.IndexByte(e, '='); i > 0 {
+			for _, name := range names {
+				if envNameEqual(e[:i], name) {
+					continue envLoop
+				}
+			}
+		}
+		result = append(result, e)
+	}
+	return result
+}
+
+// GitDir returns the git dir of the repository containing `path`.
+// If `path` is ".", then `GIT_DIR` is honored if it is set in the
+// environment, just as Git itself would do. Otherwise, the repository
+// is discovered starting at `path`, ignoring `GIT_DIR` and
+// `GIT_WORK_TREE`. Discovery works the same way as Git's: `path` can
+// be a subdirectory of a working tree (or of a git dir), in which
+// case its parent directories are searched, subject to
+// `GIT_CEILING_DIRECTORIES` and `GIT_DISCOVERY_ACROSS_FILESYSTEM`.
+//
+// The result is always an absolute, canonical path, as reported by
+// `git rev-parse --absolute-git-dir`. In particular, any `.git` file
+// (as used by submodules and worktrees) or symlink along the way has
+// already been resolved.
 func GitDir(gitbin, path string) (string, error) {
-	cmd := exec.Command(gitbin, "-C", path, "rev-parse", "--git-dir")
+	fi, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("could not open repository: %w", err)
+	}
+	if !fi.IsDir() {
+		return "", fmt.Errorf(
+			"could not open repository: %s is not a directory", path,
+		)
+	}
+
+	cmd := exec.Command(gitbin, "-C", path, "rev-parse", "--absolute-git-dir")
+	if path != "." {
+		cmd.Env = unsetEnv(os.Environ(), "GIT_DIR", "GIT_WORK_TREE")
+	}
 	out, err := cmd.Output()
 	if err != nil {
 		switch err := err.(type) {
@@ -50,16 +126,22 @@ func GitDir(gitbin, path string) (string, error) {
 			return "", err
 		}
 	}
-	gitDir := smartJoin(path, string(bytes.TrimSpace(out)))
 
-	return gitDir, nil
+	// Git reports the path in its own notation, which might not be
+	// native (e.g., `/c/foo` on Windows):
+	gitDir := nativePath(string(bytes.TrimSpace(out)))
+	if !filepath.IsAbs(gitDir) {
+		return "", fmt.Errorf(
+			"git rev-parse reported a relative git dir: %q", gitDir,
+		)
+	}
+
+	return filepath.Clean(gitDir), nil
 }
 
 // IsShallow checks if a repo is shallow clone
 func IsShallow(gitbin, gitdir string) (bool, error) {
-	cmd := exec.Command(gitbin, "rev-parse", "--git-path", "shallow")
-	cmd.Dir = gitdir
-	out, err := cmd.Output()
+	out, err := gitDirCommand(gitbin, gitdir, "rev-parse", "--git-path", "shallow").Output()
 	if err != nil {
 		return false, fmt.Errorf(
 			"could not run 'git rev-parse --git-path shallow': %w", err,
@@ -73,15 +155,44 @@ func IsShallow(gitbin, gitdir string) (bool, error) {
 	return false, nil
 }
 
+// ObjectFormat returns the object format of the repository in
+// `gitdir` ("sha1" or "sha256"), as reported by `git rev-parse
+// --show-object-format`. Versions of Git that are too old to support
+// that option only support SHA-1.
+func ObjectFormat(gitbin, gitdir string) (string, error) {
+	out, err := gitDirCommand(gitbin, gitdir, "rev-parse", "--show-object-format").Output()
+	if err != nil {
+		return "", fmt.Errorf(
+			"could not run 'git rev-parse --show-object-format': %w", err,
+		)
+	}
+
+	switch format := string(bytes.TrimSpace(out)); format {
+	case "sha1", "sha256":
+		return format, nil
+	case "--show-object-format":
+		// Older versions of Git echo options that they don't know.
+		return "sha1", nil
+	default:
+		return "", fmt.Errorf("unsupported object format %q", format)
+	}
+}
+
 // NewRepository creates a new repository object that can be used for
 // running `git` commands within that repository.
 func NewRepository(path string) (*Repository, error) {
-	// Find the `git` executable to be used:
-	gitBin, err := findGitBin()
+	// Find the `git` executable to be used, and check that it is
+	// recent enough:
+	gitBin, err := FindGit()
 	if err != nil {
-		return nil, fmt.Errorf(
-			"could not find 'git' executable (is it in your PATH?): %w", err,
-		)
+		return nil, err
+	}
+	gitVersion, err := ReadGitVersion(gitBin)
+	if err != nil {
+		return nil, err
+	}
+	if err := CheckGitVersion(gitVersion); err != nil {
+		return nil, fmt.Errorf("%s: %w", gitBin, err)
 	}
 	// Find git dir
 	gitDir, err := GitDir(gitBin, path)
@@ -93,12 +204,25 @@ func NewRepository(path string) (*Repository, error) {
 	if shallow {
 		return nil, err
 	}
+	objectFormat, err := ObjectFormat(gitBin, gitDir)
+	if err != nil {
+		return nil, err
+	}
 	return &Repository{
-		path:   gitDir,
-		gitBin: gitBin,
+		path:         gitDir,
+		gitBin:       gitBin,
+		gitVersion:   gitVersion,
+		objectFormat: objectFormat,
 	}, nil
 }
 
+// GitCommand returns an `*exec.Cmd` for running `git` in `repo` with
+// the specified arguments. `GIT_DIR` is set to the repository's path,
+// but other variables that affect where objects are read from and
+// written to (e.g., `GIT_OBJECT_DIRECTORY`,
+// `GIT_ALTERNATE_OBJECT_DIRECTORIES`, and `GIT_QUARANTINE_PATH`, as
+// set by `git receive-pack` when running hooks) are passed through
+// from our environment unchanged.
 func (repo *Repository) GitCommand(callerArgs ...string) *exec.Cmd {
 	args := []string{
 		// Disable replace references when running our commands:
@@ -116,16 +240,31 @@ func (repo *Repository) GitCommand(callerArgs ...string) *exec.Cmd {
 	// the args have been checked.
 	cmd := exec.Command(repo.gitBin, args...)
 
-	cmd.Env = append(
-		os.Environ(),
-		"GIT_DIR="+repo.path,
-		// Disable grafts when running our commands:
-		"GIT_GRAFT_FILE="+os.DevNull,
-	)
+	cmd.Env = setEnv(os.Environ(), "GIT_DIR", repo.path)
+	// Disable grafts when running our commands:
+	cmd.Env = setEnv(cmd.Env, "GIT_GRAFT_FILE", os.DevNull)
 
 	return cmd
 }
 
+// GitBin returns the path of the `git` executable that is used for
+// running commands in `repo`.
+func (repo *Repository) GitBin() string {
+	return repo.gitBin
+}
+
+// GitVersion returns the version of the `git` executable that is used
+// for running commands in `repo`.
+func (repo *Repository) GitVersion() GitVersion {
+	return repo.gitVersion
+}
+
+// ObjectFormat returns the object format of `repo` ("sha1" or
+// "sha256").
+func (repo *Repository) ObjectFormat() string {
+	return repo.objectFormat
+}
+
 // Path returns the path to `repo`.
 func (repo *Repository) Path() string {
 	return repo.path
@@ -11,7 +11,9 @@ import (
 // because on Windows, `exec.Cmd` looks not only in PATH, but also in
 // the current directory. This is a potential risk if the repository
 // being scanned is hostile and non-bare because it might possibly
-// contain an executable file named `git`.
+// contain an executable file named `git`. On Windows, if the `git`
+// found in PATH is a `git.cmd` wrapper script, the `git.exe` that it
+// wraps is used instead (see `resolveGitWrapper()`).
 func findGitBin() (string, error) {
 	gitBin, err := safeexec.LookPath("git")
 	if err != nil {
@@ -23,5 +25,5 @@ func findGitBin() (string, error) {
 		return "", err
 	}
 
-	return gitBin, nil
+	return resolveGitWrapper(gitBin), nil
 }
@@ -0,0 +1,48 @@
+package git
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSmartJoin(t *testing.T) {
+	abs, err := filepath.Abs("elsewhere")
+	assert.NoError(t, err)
+
+	for _, p := range []struct {
+		path, relPath string
+		expected      string
+	}{
+		{"repo", ".git", filepath.Join("repo", ".git")},
+		{"repo", ".", "repo"},
+		{".", ".git", ".git"},
+		{filepath.Join("repo", "sub"), "../.git", filepath.Join("repo", ".git")},
+		{"repo", abs, abs},
+		{"repo", filepath.ToSlash(abs) + "/", abs},
+	} {
+		t.Run(
+			fmt.Sprintf("smartJoin(%q, %q)", p.path, p.relPath),
+			func(t *testing.T) {
+				assert.Equal(t, p.expected, smartJoin(p.path, p.relPath))
+			},
+		)
+	}
+}
+
+func TestSetEnv(t *testing.T) {
+	env := []string{"PATH=/bin", "GIT_DIR=/old", "FOO=bar=baz"}
+
+	result := setEnv(env, "GIT_DIR", "/new")
+	assert.Equal(t, []string{"PATH=/bin", "FOO=bar=baz", "GIT_DIR=/new"}, result)
+	assert.Equal(t, "GIT_DIR=/old", env[1], "input modified")
+
+	result = setEnv(env, "GIT_GRAFT_FILE", "/dev/null")
+	assert.Equal(
+		t,
+		[]string{"PATH=/bin", "GIT_DIR=/old", "FOO=bar=baz", "GIT_GRAFT_FILE=/dev/null"},
+		result,
+	)
+}
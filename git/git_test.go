@@ -0,0 +1,165 @@
+package git_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/github/git-sizer/git"
+	"github.com/github/git-sizer/internal/testutils"
+)
+
+// Note: these tests modify the process environment, so they can't be
+// run in parallel.
+
+func TestGitCommandPassesObjectDirectories(t *testing.T) {
+	repo := testutils.NewTestRepo(t, true, "object-dirs")
+	t.Cleanup(func() { repo.Remove(t) })
+
+	objectDir := filepath.Join(repo.Path, "quarantine")
+	require.NoError(t, os.MkdirAll(objectDir, 0o777))
+	alternateDir := filepath.Join(repo.Path, "objects")
+
+	t.Setenv("GIT_OBJECT_DIRECTORY", objectDir)
+	t.Setenv("GIT_ALTERNATE_OBJECT_DIRECTORIES", alternateDir)
+
+	r := repo.Repository(t)
+
+	cmd := r.GitCommand("rev-parse", "--git-path", "objects")
+	assert.Contains(t, cmd.Env, "GIT_DIR="+r.Path())
+	assert.Contains(t, cmd.Env, "GIT_OBJECT_DIRECTORY="+objectDir)
+	assert.Contains(t, cmd.Env, "GIT_ALTERNATE_OBJECT_DIRECTORIES="+alternateDir)
+
+	out, err := cmd.Output()
+	require.NoError(t, err)
+	assert.Equal(t, objectDir, strings.TrimSpace(string(out)))
+}
+
+func TestNewRepositoryHonorsGitDir(t *testing.T) {
+	repo := testutils.NewTestRepo(t, true, "git-dir")
+	t.Cleanup(func() { repo.Remove(t) })
+
+	other := testutils.NewTestRepo(t, true, "other")
+	t.Cleanup(func() { other.Remove(t) })
+
+	expected, err := filepath.EvalSymlinks(repo.Path)
+	require.NoError(t, err)
+
+	t.Setenv("GIT_DIR", repo.Path)
+
+	// With ".", `GIT_DIR` is used:
+	r, err := git.NewRepository(".")
+	require.NoError(t, err)
+	actual, err := filepath.EvalSymlinks(r.Path())
+	require.NoError(t, err)
+	assert.Equal(t, expected, actual)
+
+	// An explicit path takes precedence over `GIT_DIR`:
+	expected, err = filepath.EvalSymlinks(other.Path)
+	require.NoError(t, err)
+	r, err = git.NewRepository(other.Path)
+	require.NoError(t, err)
+	actual, err = filepath.EvalSymlinks(r.Path())
+	require.NoError(t, err)
+	assert.Equal(t, expected, actual)
+}
+
+func TestNewRepositoryFromSubdirectory(t *testing.T) {
+	repo := testutils.NewTestRepo(t, false, "nested")
+	t.Cleanup(func() { repo.Remove(t) })
+
+	bare := testutils.NewTestRepo(t, true, "nested-bare")
+	t.Cleanup(func() { bare.Remove(t) })
+
+	nested := filepath.Join(repo.Path, "a", "b", "c")
+	require.NoError(t, os.MkdirAll(nested, 0o777))
+
+	cwd, err := os.Getwd()
+	require.NoError(t, err)
+	relNested, err := filepath.Rel(cwd, nested)
+	require.NoError(t, err)
+
+	gitDir := filepath.Join(repo.Path, ".git")
+
+	for _, p := range []struct {
+		name     string
+		path     string
+		expected string
+	}{
+		{"toplevel", repo.Path, gitDir},
+		{"nested", nested, gitDir},
+		{"nested-relative", relNested, gitDir},
+		{"nested-unclean", nested + string(filepath.Separator) + filepath.Join("..", "..", "b", "."), gitDir},
+		{"inside-git-dir", filepath.Join(gitDir, "refs", "heads"), gitDir},
+		{"inside-bare", filepath.Join(bare.Path, "refs", "heads"), bare.Path},
+	} {
+		p := p
+		t.Run(p.name, func(t *testing.T) {
+			expected, err := filepath.EvalSymlinks(p.expected)
+			require.NoError(t, err)
+
+			r, err := git.NewRepository(p.path)
+			require.NoError(t, err)
+			assert.True(t, filepath.IsAbs(r.Path()))
+			actual, err := filepath.EvalSymlinks(r.Path())
+			require.NoError(t, err)
+			assert.Equal(t, expected, actual)
+		})
+	}
+}
+
+func TestNewRepositoryErrors(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file")
+	require.NoError(t, os.WriteFile(file, []byte("hello\n"), 0o666))
+
+	// Don't let discovery escape from `dir` into an enclosing
+	// repository:
+	t.Setenv("GIT_CEILING_DIRECTORIES", dir)
+
+	for _, p := range []struct {
+		name string
+		path string
+	}{
+		{"nonexistent", filepath.Join(dir, "nonexistent")},
+		{"file", file},
+		{"not-a-repo", dir},
+	} {
+		p := p
+		t.Run(p.name, func(t *testing.T) {
+			_, err := git.NewRepository(p.path)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestParseGitVersion(t *testing.T) {
+	for _, p := range []struct {
+		output   string
+		expected git.GitVersion
+	}{
+		{"git version 2.39.5", git.GitVersion{2, 39, 5}},
+		{"git version 2.45.1.windows.1", git.GitVersion{2, 45, 1}},
+		{"git version 2.39.3 (Apple Git-146)", git.GitVersion{2, 39, 3}},
+		{"git version 2.40.0-rc0", git.GitVersion{2, 40, 0}},
+		{"git version 2.19", git.GitVersion{2, 19, 0}},
+	} {
+		v, err := git.ParseGitVersion(p.output)
+		if assert.NoError(t, err, p.output) {
+			assert.Equal(t, p.expected, v, p.output)
+		}
+	}
+
+	for _, output := range []string{"", "git version", "hub version 2.14.2", "git version two"} {
+		_, err := git.ParseGitVersion(output)
+		assert.Error(t, err, output)
+	}
+
+	assert.NoError(t, git.CheckGitVersion(git.MinimumGitVersion))
+	assert.NoError(t, git.CheckGitVersion(git.GitVersion{3, 0, 0}))
+	assert.Error(t, git.CheckGitVersion(git.GitVersion{2, 18, 9}))
+}
@@ -0,0 +1,206 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/github/git-sizer/internal/pipe"
+)
+
+// MaxLFSPointerSize is the size of the largest blob that Git LFS
+// accepts as a pointer file. Bigger blobs are never pointers.
+const MaxLFSPointerSize = 1024
+
+// lfsPointerVersion is the first line of a Git LFS pointer file.
+const lfsPointerVersion = "version https://git-lfs.github.com/spec/v1"
+
+// LFSPointer is the contents of a Git LFS pointer file, which stands
+// in for a file whose real contents are stored outside of Git.
+type LFSPointer struct {
+	// OID is the SHA-256 of the real contents, in hex.
+	OID string
+
+	// Size is the size of the real contents in bytes.
+	Size uint64
+}
+
+// ParseLFSPointer parses `data` as a Git LFS pointer file. It returns
+// false if `data` is not a (valid) pointer.
+func ParseLFSPointer(data []byte) (LFSPointer, bool) {
+	if len(data) > MaxLFSPointerSize || !bytes.HasPrefix(data, []byte(lfsPointerVersion+"\n")) {
+		return LFSPointer{}, false
+	}
+
+	var p LFSPointer
+	var haveOID, haveSize bool
+	for _, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")[1:] {
+		i := strings.IndexByte(line, ' ')
+		if i == -1 {
+			return LFSPointer{}, false
+		}
+		key, value := line[:i], line[i+1:]
+		switch key {
+		case "oid":
+			hex := strings.TrimPrefix(value, "sha256:")
+			if hex == value || len(hex) != 64 {
+				return LFSPointer{}, false
+			}
+			p.OID = hex
+			haveOID = true
+		case "size":
+			size, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				return LFSPointer{}, false
+			}
+			p.Size = size
+			haveSize = true
+		}
+	}
+	if !haveOID || !haveSize {
+		return LFSPointer{}, false
+	}
+	return p, true
+}
+
+// ForEachLFSPointer calls `fn` for each blob reachable from `roots`
+// that is a Git LFS pointer file, along with the parsed pointer. Only
+// the blobs that are small enough to be pointers are read. It returns
+// the number and total size of all of the blobs that are reachable
+// from `roots`, pointers or not. Missing objects are skipped.
+func (repo *Repository) ForEachLFSPointer(
+	ctx context.Context, roots []OID, fn func(blob BatchHeader, p LFSPointer) error,
+) (ObjectsSize, error) {
+	var blobs ObjectsSize
+	if len(roots) == 0 {
+		return blobs, nil
+	}
+
+	var stdin bytes.Buffer
+	for _, oid := range roots {
+		fmt.Fprintln(&stdin, oid)
+	}
+
+	p := pipe.New(pipe.WithStdin(&stdin))
+	p.Add(
+		pipe.CommandStage(
+			"git-rev-list",
+			repo.GitCommand("rev-list", "--objects", "--missing=allow-any", "--stdin"),
+		),
+
+		// Strip off the paths that `rev-list` appends to some OIDs:
+		pipe.LinewiseFunction(
+			"copy-oids",
+			func(_ context.Context, _ pipe.Env, line []byte, stdout *bufio.Writer) error {
+				if i := bytes.IndexByte(line, ' '); i != -1 {
+					line = line[:i]
+				}
+				if _, err := stdout.Write(line); err != nil {
+					return fmt.Errorf("writing OID to 'git cat-file': %w", err)
+				}
+				return stdout.WriteByte('\n')
+			},
+		),
+
+		pipe.CommandStage(
+			"git-cat-file",
+			repo.GitCommand("cat-file", "--batch-check", "--buffer"),
+		),
+
+		// Total up the blobs and pass on the ones that might be
+		// pointers:
+		pipe.LinewiseFunction(
+			"select-small-blobs",
+			func(_ context.Context, _ pipe.Env, line []byte, stdout *bufio.Writer) error {
+				if bytes.HasSuffix(line, []byte(" missing")) {
+					return nil
+				}
+				header, err := ParseBatchHeader("", string(line))
+				if err != nil {
+					return fmt.Errorf("parsing 'git cat-file' output: %w", err)
+				}
+				if header.ObjectType != "blob" {
+					return nil
+				}
+				blobs.Count++
+				blobs.Size += uint64(header.ObjectSize)
+				if header.ObjectSize > MaxLFSPointerSize {
+					return nil
+				}
+				if _, err := stdout.WriteString(header.OID.String()); err != nil {
+					return fmt.Errorf("writing OID to 'git cat-file': %w", err)
+				}
+				return stdout.WriteByte('\n')
+			},
+		),
+
+		pipe.CommandStage(
+			"git-cat-file",
+			repo.GitCommand("cat-file", "--batch", "--buffer"),
+		),
+
+		pipe.Function(
+			"parse-pointers",
+			func(_ context.Context, _ pipe.Env, stdin io.Reader, _ io.Writer) error {
+				in := bufio.NewReader(stdin)
+				for {
+					line, err := in.ReadString('\n')
+					if err != nil {
+						if err == io.EOF {
+							return nil
+						}
+						return fmt.Errorf("reading from 'git cat-file': %w", err)
+					}
+					header, err := ParseBatchHeader("", line)
+					if err != nil {
+						return fmt.Errorf("parsing 'git cat-file' output: %w", err)
+					}
+
+					// Read the contents plus the trailing LF:
+					data := make([]byte, header.ObjectSize+1)
+					if _, err := io.ReadFull(in, data); err != nil {
+						return fmt.Errorf(
+							"reading blob '%s' from 'git cat-file': %w", header.OID, err,
+						)
+					}
+					if p, ok := ParseLFSPointer(data[:header.ObjectSize]); ok {
+						if err := fn(header, p); err != nil {
+							return err
+						}
+					}
+				}
+			},
+		),
+	)
+
+	if err := p.Run(ctx); err != nil {
+		return ObjectsSize{}, err
+	}
+	return blobs, nil
+}
+
+// LFSObjectsDir returns the directory in which Git LFS stores the
+// real contents of files locally; i.e., `lfs/objects` within `repo`'s
+// common git directory.
+func (repo *Repository) LFSObjectsDir() (string, error) {
+	out, err := repo.GitCommand("rev-parse", "--git-common-dir").Output()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(
+		smartJoin(repo.path, string(bytes.TrimSpace(out))), "lfs", "objects",
+	), nil
+}
+
+// HasLFSObject reports whether the real contents for `p` are stored
+// in `dir` (see `LFSObjectsDir()`).
+func HasLFSObject(dir string, p LFSPointer) bool {
+	fi, err := os.Stat(filepath.Join(dir, p.OID[0:2], p.OID[2:4], p.OID))
+	return err == nil && fi.Mode().IsRegular()
+}
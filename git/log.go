@@ -0,0 +1,338 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/github/git-sizer/internal/pipe"
+)
+
+// PathCommit describes a commit that added or modified a path, as
+// reported by `ForEachPathCommit()`.
+type PathCommit struct {
+	OID OID
+
+	// AuthorName and AuthorEmail identify the commit's author.
+	AuthorName  string
+	AuthorEmail string
+
+	// AuthorDate is the author date, in strict ISO 8601 format.
+	AuthorDate string
+
+	// Subject is the first line of the commit message.
+	Subject string
+}
+
+// ForEachPathCommit calls `fn` for each commit reachable from `rev`
+// that added or modified `path`, newest first. Renames of the path
+// are followed, as for `git log --follow`.
+func (repo *Repository) ForEachPathCommit(
+	ctx context.Context, rev, path string, fn func(pc PathCommit) error,
+) error {
+	p := pipe.New()
+	p.Add(
+		pipe.CommandStage(
+			"git-log",
+			repo.GitCommand(
+				"log", "--follow", "--no-show-signature", "--no-color",
+				"--format=%H%x00%an%x00%ae%x00%aI%x00%s",
+				rev, "--", path,
+			),
+		),
+		pipe.LinewiseFunction(
+			"parse-log",
+			func(_ context.Context, _ pipe.Env, line []byte, _ *bufio.Writer) error {
+				fields := strings.SplitN(string(line), "\x00", 5)
+				if len(fields) != 5 {
+					return fmt.Errorf("malformed 'git log' output: %q", line)
+				}
+				oid, err := NewOID(fields[0])
+				if err != nil {
+					return fmt.Errorf("parsing 'git log' output: %w", err)
+				}
+				return fn(
+					PathCommit{
+						OID:         oid,
+						AuthorName:  fields[1],
+						AuthorEmail: fields[2],
+						AuthorDate:  fields[3],
+						Subject:     fields[4],
+					},
+				)
+			},
+		),
+	)
+
+	return p.Run(ctx)
+}
+
+// CommitSummary returns the author date (in strict ISO 8601 format)
+// and the subject (the first line of the message) of the commit
+// `oid`.
+func (repo *Repository) CommitSummary(oid OID) (date, subject string, err error) {
+	cmd := repo.GitCommand(
+		"log", "-1", "--no-walk", "--no-show-signature", "--no-color",
+		"--format=%aI%x00%s", oid.String(), "--",
+	)
+	out, err := cmd.Output()
+	if err != nil {
+		return "", "", fmt.Errorf("reading commit %s: %w", oid, err)
+	}
+	fields := strings.SplitN(strings.TrimSuffix(string(out), "\n"), "\x00", 2)
+	if len(fields) != 2 {
+		return "", "", fmt.Errorf("malformed 'git log' output: %q", out)
+	}
+	return fields[0], fields[1], nil
+}
+
+// LoggedCommit is a commit, with its changes, as reported by
+// `ForEachLoggedCommit()`.
+type LoggedCommit struct {
+	OID OID
+
+	// Date is the committer date, in strict ISO 8601 format.
+	Date string
+
+	// Source is the root (e.g., reference name) via which the commit
+	// was reached.
+	Source string
+
+	// Changes are the entries that differ from the commit's parents.
+	// A merge commit is compared with each of its parents in turn,
+	// so the same change might be listed more than once. Renames are
+	// not detected.
+	Changes []TreeChange
+}
+
+// ForEachLoggedCommit calls `fn` for each commit reachable from
+// `roots` (e.g., reference names), parents first, and otherwise in
+// (roughly) chronological order.
+func (repo *Repository) ForEachLoggedCommit(
+	ctx context.Context, roots []string, fn func(lc LoggedCommit) error,
+) error {
+	if len(roots) == 0 {
+		return nil
+	}
+
+	var stdin bytes.Buffer
+	for _, root := range roots {
+		fmt.Fprintln(&stdin, root)
+	}
+
+	p := pipe.New(pipe.WithStdin(&stdin))
+	p.Add(
+		pipe.CommandStage(
+			"git-log",
+			repo.GitCommand(
+				"log", "--stdin", "--date-order", "--reverse", "-m",
+				"--no-renames", "--raw", "--no-abbrev", "-z",
+				"--no-show-signature", "--no-color",
+				"--format=%x01%H %cI %S",
+			),
+		),
+		pipe.Function(
+			"parse-log",
+			func(_ context.Context, _ pipe.Env, stdin io.Reader, _ io.Writer) error {
+				return parseLoggedCommits(bufio.NewReader(stdin), fn)
+			},
+		),
+	)
+
+	return p.Run(ctx)
+}
+
+// parseLoggedCommits parses the output of `ForEachLoggedCommit()`'s
+// `git log` command, which consists of a header record for each
+// commit, starting with "\x01", followed by the raw diff records for
+// that commit. With `-m`, a merge commit is listed once per parent.
+func parseLoggedCommits(in *bufio.Reader, fn func(lc LoggedCommit) error) error {
+	const command = "git log"
+
+	var lc LoggedCommit
+	started := false
+	flush := func() error {
+		if !started {
+			return nil
+		}
+		return fn(lc)
+	}
+
+	for {
+		record, err := readNULTerminated(in, command)
+		if err != nil {
+			return err
+		}
+		if record == nil {
+			break
+		}
+
+		// Git separates the header from the diff with a newline:
+		record = bytes.TrimLeft(record, "\n")
+
+		switch {
+		case len(record) == 0:
+			continue
+		case record[0] == '\x01':
+			fields := strings.SplitN(string(record[1:]), " ", 3)
+			if len(fields) != 3 {
+				return fmt.Errorf("malformed '%s' output: %q", command, record)
+			}
+			oid, err := NewOID(fields[0])
+			if err != nil {
+				return fmt.Errorf("parsing '%s' output: %w", command, err)
+			}
+			if started && oid == lc.OID {
+				// This is the same merge commit, compared with
+				// another parent.
+				continue
+			}
+			if err := flush(); err != nil {
+				return err
+			}
+			lc = LoggedCommit{OID: oid, Date: fields[1], Source: fields[2]}
+			started = true
+		case record[0] == ':':
+			if !started {
+				return fmt.Errorf("unexpected '%s' output: %q", command, record)
+			}
+			change, err := readRawChange(in, record, command)
+			if err != nil {
+				return err
+			}
+			lc.Changes = append(lc.Changes, change)
+		default:
+			return fmt.Errorf("malformed '%s' output: %q", command, record)
+		}
+	}
+
+	return flush()
+}
+
+// PathRename is a rename or copy of a file, as reported by
+// `ForEachRename()`.
+type PathRename struct {
+	// Commit is the commit that renamed or copied the file.
+	Commit OID
+
+	OldPath string
+	NewPath string
+
+	// Copy is set if the file at `OldPath` was kept; i.e., the file
+	// was copied rather than renamed.
+	Copy bool
+}
+
+// ForEachRename calls `fn` for each rename or copy of a file that
+// `git log --find-renames --find-copies` detects in the commits
+// reachable from `roots` (e.g., reference names), parents first, and
+// otherwise in (roughly) chronological order. Merge commits aren't
+// compared with their parents, so the renames made on other branches
+// are only counted once.
+func (repo *Repository) ForEachRename(
+	ctx context.Context, roots []string, fn func(r PathRename) error,
+) error {
+	if len(roots) == 0 {
+		return nil
+	}
+
+	var stdin bytes.Buffer
+	for _, root := range roots {
+		fmt.Fprintln(&stdin, root)
+	}
+
+	p := pipe.New(pipe.WithStdin(&stdin))
+	p.Add(
+		pipe.CommandStage(
+			"git-log",
+			repo.GitCommand(
+				"log", "--stdin", "--date-order", "--reverse",
+				"--find-renames", "--find-copies", "--name-status", "-z",
+				"--no-show-signature", "--no-color",
+				"--format=%x01%H",
+			),
+		),
+		pipe.Function(
+			"parse-log",
+			func(_ context.Context, _ pipe.Env, stdin io.Reader, _ io.Writer) error {
+				return parseRenames(bufio.NewReader(stdin), fn)
+			},
+		),
+	)
+
+	return p.Run(ctx)
+}
+
+// parseRenames parses the output of `ForEachRename()`'s `git log`
+// command, which consists of a header record for each commit,
+// starting with "\x01", followed by a status record for each changed
+// path and then the path. For a rename ('R') or copy ('C'), the
+// status is followed by a similarity score and by both the old and
+// the new path.
+func parseRenames(in *bufio.Reader, fn func(r PathRename) error) error {
+	const command = "git log"
+
+	var commit OID
+	started := false
+	for {
+		record, err := readNULTerminated(in, command)
+		if err != nil {
+			return err
+		}
+		if record == nil {
+			return nil
+		}
+
+		// Git separates the header from the changes with a newline:
+		record = bytes.TrimLeft(record, "\n")
+
+		switch {
+		case len(record) == 0:
+			continue
+		case record[0] == '\x01':
+			commit, err = NewOID(string(record[1:]))
+			if err != nil {
+				return fmt.Errorf("parsing '%s' output: %w", command, err)
+			}
+			started = true
+			continue
+		case !started:
+			return fmt.Errorf("unexpected '%s' output: %q", command, record)
+		}
+
+		path, err := readNULTerminated(in, command)
+		if err != nil {
+			return err
+		}
+		if path == nil {
+			return fmt.Errorf("missing path in '%s' output", command)
+		}
+
+		status := record[0]
+		if status != 'R' && status != 'C' {
+			continue
+		}
+
+		newPath, err := readNULTerminated(in, command)
+		if err != nil {
+			return err
+		}
+		if newPath == nil {
+			return fmt.Errorf("missing path in '%s' output", command)
+		}
+
+		if err := fn(
+			PathRename{
+				Commit:  commit,
+				OldPath: string(path),
+				NewPath: string(newPath),
+				Copy:    status == 'C',
+			},
+		); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/github/git-sizer/internal/pipe"
+)
+
+// LsTreeEntry is an entry in the recursive listing of a tree.
+type LsTreeEntry struct {
+	Filemode   uint
+	ObjectType ObjectType
+	OID        OID
+
+	// Size is the size of the object if it is a blob, and otherwise
+	// -1.
+	Size int64
+
+	// Path is the entry's path relative to the top level of the
+	// tree.
+	Path string
+}
+
+// ForEachLsTreeEntry calls `fn` for each entry in the tree of `rev`,
+// recursively, including the entries for subtrees (which come before
+// the entries within them).
+func (repo *Repository) ForEachLsTreeEntry(
+	ctx context.Context, rev string, fn func(entry LsTreeEntry) error,
+) error {
+	p := pipe.New()
+	p.Add(
+		pipe.CommandStage(
+			"git-ls-tree",
+			repo.GitCommand("ls-tree", "-r", "-t", "-l", "-z", "--full-tree", rev),
+		),
+		// Parse the `ls-tree` output, which is of the form
+		// `<mode> SP <type> SP <oid> SP+ <size> TAB <path> NUL`,
+		// where `<size>` is "-" for anything but blobs:
+		pipe.Function(
+			"parse-entries",
+			func(_ context.Context, _ pipe.Env, stdin io.Reader, _ io.Writer) error {
+				in := bufio.NewReader(stdin)
+				for {
+					record, err := readNULTerminated(in, "git ls-tree")
+					if err != nil {
+						return err
+					}
+					if record == nil {
+						return nil
+					}
+
+					tab := bytes.IndexByte(record, '\t')
+					if tab == -1 {
+						return fmt.Errorf("malformed 'git ls-tree' output: %q", record)
+					}
+					words := strings.Fields(string(record[:tab]))
+					if len(words) != 4 {
+						return fmt.Errorf("malformed 'git ls-tree' output: %q", record)
+					}
+
+					entry := LsTreeEntry{
+						ObjectType: ObjectType(words[1]),
+						Size:       -1,
+						Path:       string(record[tab+1:]),
+					}
+					mode, err := strconv.ParseUint(words[0], 8, 32)
+					if err != nil {
+						return fmt.Errorf("parsing 'git ls-tree' output: %w", err)
+					}
+					entry.Filemode = uint(mode)
+					entry.OID, err = NewOID(words[2])
+					if err != nil {
+						return fmt.Errorf("parsing 'git ls-tree' output: %w", err)
+					}
+					if words[3] != "-" {
+						entry.Size, err = strconv.ParseInt(words[3], 10, 64)
+						if err != nil {
+							return fmt.Errorf("parsing 'git ls-tree' output: %w", err)
+						}
+					}
+
+					if err := fn(entry); err != nil {
+						return err
+					}
+				}
+			},
+		),
+	)
+
+	return p.Run(ctx)
+}
@@ -0,0 +1,63 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// ResolveCommit returns the OID of the commit named by `rev`, which
+// can be any revision that `git rev-parse` understands. Annotated tags
+// are peeled.
+func (repo *Repository) ResolveCommit(rev string) (OID, error) {
+	cmd := repo.GitCommand("rev-parse", "--verify", "--quiet", rev+"^{commit}")
+	out, err := cmd.Output()
+	if err != nil {
+		return NullOID, fmt.Errorf("%q does not name a commit", rev)
+	}
+	return NewOID(strings.TrimSpace(string(out)))
+}
+
+// MergeBase returns the best common ancestor of the commits `a` and
+// `b`, as computed by `git merge-base`. It is an error if they have
+// no common ancestor.
+func (repo *Repository) MergeBase(a, b OID) (OID, error) {
+	cmd := repo.GitCommand("merge-base", a.String(), b.String())
+	out, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+			return NullOID, fmt.Errorf("commits %s and %s have no merge base", a, b)
+		}
+		return NullOID, fmt.Errorf("running 'git merge-base': %w", err)
+	}
+	return NewOID(strings.TrimSpace(string(out)))
+}
+
+// RefsContaining returns the names of the references whose history
+// contains the commit `oid`, as listed by `git for-each-ref
+// --contains`, in sorted order.
+func (repo *Repository) RefsContaining(oid OID) ([]string, error) {
+	cmd := repo.GitCommand("for-each-ref", "--contains", oid.String(), "--format=%(refname)")
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("running 'git for-each-ref --contains %s': %w", oid, err)
+	}
+	return strings.Fields(string(out)), nil
+}
+
+// HeadRefname returns the name of the branch that `HEAD` refers to,
+// or "" if `HEAD` is detached.
+func (repo *Repository) HeadRefname() (string, error) {
+	cmd := repo.GitCommand("symbolic-ref", "-q", "HEAD")
+	out, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+			return "", nil
+		}
+		return "", fmt.Errorf("running 'git symbolic-ref': %w", err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
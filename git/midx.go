@@ -0,0 +1,168 @@
+package git
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// MultiPackIndex describes a repository's multi-pack-index, which
+// lets Git look up objects in several packfiles at once.
+type MultiPackIndex struct {
+	// Packs are the names of the packfiles that it covers (e.g.,
+	// `pack-<hash>.pack`), sorted.
+	Packs []string
+
+	// ObjectCount is the number of distinct objects in those
+	// packfiles.
+	ObjectCount uint32
+}
+
+// ReadMultiPackIndex reads the header of `objects/pack/multi-pack-index`
+// in `repo`'s object directory, or returns nil if there is none.
+// Incremental multi-pack-index chains (in `multi-pack-index.d`) are
+// not read.
+func (repo *Repository) ReadMultiPackIndex() (*MultiPackIndex, error) {
+	path, err := repo.gitPath("objects/pack/multi-pack-index")
+	if err != nil {
+		return nil, fmt.Errorf("finding multi-pack-index: %w", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("reading multi-pack-index: %w", err)
+	}
+	midx, err := parseMultiPackIndex(data)
+	if err != nil {
+		return nil, fmt.Errorf("reading multi-pack-index: %w", err)
+	}
+	return midx, nil
+}
+
+// parseMultiPackIndex parses the contents of a multi-pack-index file,
+// which start with a 12-byte header:
+//
+//	"MIDX" <version> <hash version> <chunk count> <base count> <pack count>
+//
+// followed by a table of (4-byte ID, 8-byte offset) pairs locating
+// the chunks, terminated by an entry with a zero ID. Only the pack
+// names ("PNAM") and the OID fanout ("OIDF", the last entry of which
+// is the number of objects) are read.
+func parseMultiPackIndex(data []byte) (*MultiPackIndex, error) {
+	const headerSize = 12
+	if len(data) < headerSize || string(data[:4]) != "MIDX" {
+		return nil, errors.New("not a multi-pack-index file")
+	}
+	if data[4] != 1 {
+		return nil, fmt.Errorf("unsupported multi-pack-index version %d", data[4])
+	}
+	chunkCount := int(data[6])
+	packCount := binary.BigEndian.Uint32(data[8:12])
+
+	chunks := make(map[string][]byte)
+	table := data[headerSize:]
+	if len(table) < 12*(chunkCount+1) {
+		return nil, errors.New("truncated chunk table")
+	}
+	for i := 0; i < chunkCount; i++ {
+		entry := table[12*i:]
+		id := string(entry[:4])
+		start := binary.BigEndian.Uint64(entry[4:12])
+		end := binary.BigEndian.Uint64(entry[16:24])
+		if start > end || end > uint64(len(data)) {
+			return nil, fmt.Errorf("chunk %q is out of bounds", id)
+		}
+		chunks[id] = data[start:end]
+	}
+
+	var midx MultiPackIndex
+
+	names := chunks["PNAM"]
+	if names == nil {
+		return nil, errors.New("missing pack names")
+	}
+	for len(midx.Packs) < int(packCount) {
+		i := bytes.IndexByte(names, 0)
+		if i == -1 {
+			return nil, errors.New("truncated pack names")
+		}
+		midx.Packs = append(midx.Packs, strings.TrimSuffix(string(names[:i]), ".idx")+".pack")
+		names = names[i+1:]
+	}
+
+	fanout := chunks["OIDF"]
+	if len(fanout) != 256*4 {
+		return nil, errors.New("missing or malformed OID fanout")
+	}
+	midx.ObjectCount = binary.BigEndian.Uint32(fanout[255*4:])
+
+	return &midx, nil
+}
+
+// LooseObjectStats describes the loose objects in `repo`'s object
+// directory, as reported by `git count-objects -v`.
+type LooseObjectStats struct {
+	Count uint64
+
+	// Size is the disk space that they use, in bytes (rounded to
+	// whole KiB by Git).
+	Size uint64
+}
+
+// LooseObjects counts the loose objects in `repo`'s object directory.
+func (repo *Repository) LooseObjects() (LooseObjectStats, error) {
+	values, err := countObjects(repo.GitCommand("count-objects", "-v"))
+	if err != nil {
+		return LooseObjectStats{}, err
+	}
+	return LooseObjectStats{
+		Count: values["count"],
+		Size:  values["size"] * 1024,
+	}, nil
+}
+
+// StoredObjectCount returns the number of objects in `repo`'s object
+// directory, loose or packed, as reported by `git count-objects -v`.
+// Objects that are in more than one packfile are counted more than
+// once, and unreachable objects are counted, too.
+func (repo *Repository) StoredObjectCount() (uint64, error) {
+	values, err := countObjects(repo.GitCommand("count-objects", "-v"))
+	if err != nil {
+		return 0, err
+	}
+	return values["count"] + values["in-pack"], nil
+}
+
+// countObjects runs `cmd`, which must be `git count-objects -v`, and
+// returns the numeric values that it reports, keyed by name (e.g.,
+// "count" or "in-pack").
+func countObjects(cmd *exec.Cmd) (map[string]uint64, error) {
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("running 'git count-objects': %w", err)
+	}
+
+	values := make(map[string]uint64)
+	for _, line := range strings.Split(string(out), "\n") {
+		if line == "" {
+			continue
+		}
+		i := strings.Index(line, ": ")
+		if i == -1 {
+			return nil, fmt.Errorf("malformed 'git count-objects' output: %q", line)
+		}
+		n, err := strconv.ParseUint(line[i+2:], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("malformed 'git count-objects' output: %q", line)
+		}
+		values[line[:i]] = n
+	}
+	return values, nil
+}
@@ -2,9 +2,13 @@ package git
 
 import (
 	"bufio"
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"strings"
+	"sync"
 
 	"github.com/github/git-sizer/internal/pipe"
 )
@@ -13,22 +17,33 @@ import (
 type ObjectIter struct {
 	ctx      context.Context
 	p        *pipe.Pipeline
+	child    *child
 	oidCh    chan OID
 	errCh    chan error
 	headerCh chan BatchHeader
+
+	// closed is closed when no more roots are coming.
+	closed    chan struct{}
+	closeOnce sync.Once
 }
 
 // NewObjectIter returns an iterator that iterates over objects in
-// `repo`. The arguments are passed to `git rev-list --objects`. The
-// second return value is the stdin of the `rev-list` command. The
-// caller can feed values into it but must close it in any case.
-func (repo *Repository) NewObjectIter(ctx context.Context) (*ObjectIter, error) {
+// `repo`. `args` are passed as additional arguments to `git rev-list
+// --objects`. The roots of the walk are fed in using `AddRoot()`; the
+// caller must call `Close()` in any case.
+//
+// If `args` includes `--missing=print`, then objects that are missing
+// from the repository are reported with type "missing" rather than
+// causing an error.
+func (repo *Repository) NewObjectIter(ctx context.Context, args ...string) (*ObjectIter, error) {
+	ctx, cancel := context.WithCancel(ctx)
 	iter := ObjectIter{
 		ctx:      ctx,
 		p:        pipe.New(),
 		oidCh:    make(chan OID),
 		errCh:    make(chan error),
 		headerCh: make(chan BatchHeader),
+		closed:   make(chan struct{}),
 	}
 
 	iter.p.Add(
@@ -41,13 +56,12 @@ func (repo *Repository) NewObjectIter(ctx context.Context) (*ObjectIter, error)
 
 				for {
 					select {
-					case oid, ok := <-iter.oidCh:
-						if !ok {
-							return out.Flush()
-						}
+					case oid := <-iter.oidCh:
 						if _, err := fmt.Fprintln(out, oid.String()); err != nil {
 							return fmt.Errorf("writing to 'git cat-file': %w", err)
 						}
+					case <-iter.closed:
+						return out.Flush()
 					case <-ctx.Done():
 						return ctx.Err()
 					}
@@ -60,18 +74,32 @@ func (repo *Repository) NewObjectIter(ctx context.Context) (*ObjectIter, error)
 		// found.
 		pipe.CommandStage(
 			"git-rev-list",
-			repo.GitCommand("rev-list", "--objects", "--stdin", "--date-order"),
+			repo.GitCommand(
+				append(
+					[]string{"rev-list", "--objects", "--stdin", "--date-order"},
+					args...,
+				)...,
+			),
 		),
 
 		// Read the output of `git rev-list --objects`, strip off any
-		// trailing information, and write the OIDs to `git cat-file`:
+		// trailing information, and write the OIDs to `git cat-file`.
+		// Missing objects (reported as `?<oid>` if `--missing=print`
+		// was requested) are passed along, too; `git cat-file` will
+		// report them as missing:
 		pipe.LinewiseFunction(
 			"copy-oids",
 			func(_ context.Context, _ pipe.Env, line []byte, stdout *bufio.Writer) error {
-				if len(line) < 40 {
+				if len(line) > 0 && line[0] == '?' {
+					line = line[1:]
+				}
+				if i := bytes.IndexByte(line, ' '); i != -1 {
+					line = line[:i]
+				}
+				if len(line) < 2*SHA1Size {
 					return fmt.Errorf("line too short: '%s'", line)
 				}
-				if _, err := stdout.Write(line[:40]); err != nil {
+				if _, err := stdout.Write(line); err != nil {
 					return fmt.Errorf("writing OID to 'git cat-file': %w", err)
 				}
 				if err := stdout.WriteByte('\n'); err != nil {
@@ -104,18 +132,43 @@ func (repo *Repository) NewObjectIter(ctx context.Context) (*ObjectIter, error)
 						}
 						return fmt.Errorf("reading from 'git cat-file': %w", err)
 					}
+					if oidString := strings.TrimSuffix(header, " missing\n"); oidString != header {
+						// The only way that we can have asked for a
+						// missing object is if `rev-list` told us
+						// about it, which means that the caller asked
+						// for missing objects to be reported.
+						oid, err := NewOID(oidString)
+						if err != nil {
+							return fmt.Errorf("parsing output of 'git cat-file': %w", err)
+						}
+						select {
+						case iter.headerCh <- BatchHeader{OID: oid, ObjectType: "missing"}:
+						case <-ctx.Done():
+							return ctx.Err()
+						}
+						continue
+					}
 					batchHeader, err := ParseBatchHeader("", header)
 					if err != nil {
 						return fmt.Errorf("parsing output of 'git cat-file': %w", err)
 					}
 
-					iter.headerCh <- batchHeader
+					select {
+					case iter.headerCh <- batchHeader:
+					case <-ctx.Done():
+						return ctx.Err()
+					}
 				}
 			},
 		),
 	)
 
-	if err := iter.p.Start(ctx); err != nil {
+	iter.child = &child{
+		closeInput: iter.Close,
+		cancel:     cancel,
+		waitFn:     iter.p.Wait,
+	}
+	if err := repo.startChild(iter.child, func() error { return iter.p.Start(ctx) }); err != nil {
 		return nil, err
 	}
 
@@ -127,14 +180,17 @@ func (iter *ObjectIter) AddRoot(oid OID) error {
 	select {
 	case iter.oidCh <- oid:
 		return nil
+	case <-iter.closed:
+		return errors.New("adding a root to a closed object iterator")
 	case <-iter.ctx.Done():
 		return iter.ctx.Err()
 	}
 }
 
-// Close closes the iterator and frees up resources.
+// Close closes the iterator and frees up resources. It can be called
+// more than once.
 func (iter *ObjectIter) Close() {
-	close(iter.oidCh)
+	iter.closeOnce.Do(func() { close(iter.closed) })
 }
 
 // Next returns either the next object (its OID, type, and size), or a
@@ -142,7 +198,7 @@ func (iter *ObjectIter) Close() {
 func (iter *ObjectIter) Next() (BatchHeader, bool, error) {
 	header, ok := <-iter.headerCh
 	if !ok {
-		return missingHeader, false, iter.p.Wait()
+		return missingHeader, false, iter.child.wait()
 	}
 	return header, true, nil
 }
@@ -1,32 +1,50 @@
 package git
 
 import (
+	"bytes"
 	"encoding/hex"
 	"errors"
 )
 
-// OID represents the SHA-1 object ID of a Git object, in binary
-// format.
+// The sizes, in bytes, of the object IDs of the supported object
+// formats.
+const (
+	SHA1Size   = 20
+	SHA256Size = 32
+)
+
+// OID represents the object ID of a Git object, in binary format. It
+// can hold either a SHA-1 or a SHA-256 object ID.
 type OID struct {
-	v [20]byte
+	v [SHA256Size]byte
+
+	// n is the number of bytes of `v` that are used, or 0 for
+	// `NullOID`.
+	n uint8
 }
 
-// NullOID is the null object ID; i.e., all zeros.
+// NullOID is the null object ID; i.e., all zeros. Since it is the
+// same for all object formats, it is formatted like a SHA-1 object
+// ID.
 var NullOID OID
 
 // OIDFromBytes converts a byte slice containing an object ID in
-// binary format into an `OID`.
+// binary format into an `OID`. An object ID that is all zeros is
+// converted to `NullOID`, regardless of its length.
 func OIDFromBytes(oidBytes []byte) (OID, error) {
 	var oid OID
-	if len(oidBytes) != len(oid.v) {
+	if len(oidBytes) != SHA1Size && len(oidBytes) != SHA256Size {
 		return OID{}, errors.New("bytes oid has the wrong length")
 	}
-	copy(oid.v[0:20], oidBytes)
+	if bytes.Count(oidBytes, []byte{0}) == len(oidBytes) {
+		return NullOID, nil
+	}
+	oid.n = uint8(copy(oid.v[:], oidBytes))
 	return oid, nil
 }
 
-// NewOID converts an object ID in hex format (i.e., `[0-9a-f]{40}`)
-// into an `OID`.
+// NewOID converts an object ID in hex format (i.e., `[0-9a-f]{40}`
+// for SHA-1 or `[0-9a-f]{64}` for SHA-256) into an `OID`.
 func NewOID(s string) (OID, error) {
 	oidBytes, err := hex.DecodeString(s)
 	if err != nil {
@@ -35,20 +53,28 @@ func NewOID(s string) (OID, error) {
 	return OIDFromBytes(oidBytes)
 }
 
+// size returns the number of bytes in `oid`.
+func (oid OID) size() int {
+	if oid.n == 0 {
+		return SHA1Size
+	}
+	return int(oid.n)
+}
+
 // String formats `oid` as a string in hex format.
 func (oid OID) String() string {
-	return hex.EncodeToString(oid.v[:])
+	return hex.EncodeToString(oid.Bytes())
 }
 
 // Bytes returns a byte slice view of `oid`, in binary format.
 func (oid OID) Bytes() []byte {
-	return oid.v[:]
+	return oid.v[:oid.size()]
 }
 
 // MarshalJSON expresses `oid` as a JSON string with its enclosing
 // quotation marks.
 func (oid OID) MarshalJSON() ([]byte, error) {
-	src := oid.v[:]
+	src := oid.Bytes()
 	dst := make([]byte, hex.EncodedLen(len(src))+2)
 	dst[0] = '"'
 	dst[len(dst)-1] = '"'
@@ -0,0 +1,54 @@
+package git_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/github/git-sizer/git"
+)
+
+func TestNewOID(t *testing.T) {
+	t.Parallel()
+
+	for _, p := range []struct {
+		name string
+		hex  string
+		size int
+	}{
+		{"sha1", "0123456789abcdef0123456789abcdef01234567", git.SHA1Size},
+		{"sha256", "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef", git.SHA256Size},
+	} {
+		p := p
+		t.Run(p.name, func(t *testing.T) {
+			t.Parallel()
+
+			oid, err := git.NewOID(p.hex)
+			require.NoError(t, err)
+			assert.Equal(t, p.hex, oid.String())
+			assert.Len(t, oid.Bytes(), p.size)
+
+			j, err := oid.MarshalJSON()
+			require.NoError(t, err)
+			assert.Equal(t, `"`+p.hex+`"`, string(j))
+
+			// The null OID is the same in every object format:
+			null, err := git.NewOID(strings.Repeat("0", 2*p.size))
+			require.NoError(t, err)
+			assert.Equal(t, git.NullOID, null)
+		})
+	}
+
+	// A SHA-1 OID is not equal to a SHA-256 OID that starts with the
+	// same bytes:
+	sha1, err := git.NewOID("0123456789abcdef0123456789abcdef01234567")
+	require.NoError(t, err)
+	sha256, err := git.NewOID("0123456789abcdef0123456789abcdef01234567" + strings.Repeat("0", 24))
+	require.NoError(t, err)
+	assert.NotEqual(t, sha1, sha256)
+
+	_, err = git.NewOID("0123456789abcdef")
+	assert.Error(t, err)
+}
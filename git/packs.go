@@ -0,0 +1,227 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/github/git-sizer/internal/pipe"
+)
+
+// Packfile describes a packfile in a repository's object directory.
+type Packfile struct {
+	// Name is the packfile's filename (e.g., `pack-<hash>.pack`).
+	Name string
+
+	// Path is the packfile's path.
+	Path string
+
+	// Size is the size of the packfile, in bytes.
+	Size int64
+
+	// Cruft is true if the packfile is a cruft pack, which holds
+	// unreachable objects until they expire (see `git repack
+	// --cruft`). Git marks those with a `.mtimes` file.
+	Cruft bool
+}
+
+// Packfiles returns the packfiles in `repo`'s object directory (which
+// is affected by `GIT_OBJECT_DIRECTORY`), sorted by name. Packfiles
+// in alternate object directories are not included.
+func (repo *Repository) Packfiles() ([]Packfile, error) {
+	dir, err := repo.gitPath("objects/pack")
+	if err != nil {
+		return nil, fmt.Errorf("finding pack directory: %w", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("reading pack directory: %w", err)
+	}
+
+	var packs []Packfile
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".pack") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			if os.IsNotExist(err) {
+				// It was removed (e.g., by a concurrent `git gc`).
+				continue
+			}
+			return nil, fmt.Errorf("reading pack directory: %w", err)
+		}
+		path := filepath.Join(dir, entry.Name())
+		_, err = os.Stat(strings.TrimSuffix(path, ".pack") + ".mtimes")
+		packs = append(packs, Packfile{
+			Name:  entry.Name(),
+			Path:  path,
+			Size:  info.Size(),
+			Cruft: err == nil,
+		})
+	}
+
+	return packs, nil
+}
+
+// gitPath returns the path of `name` (e.g., "objects/pack") within
+// `repo`'s git directory, as reported by `git rev-parse --git-path`,
+// which respects `GIT_OBJECT_DIRECTORY` and the like.
+func (repo *Repository) gitPath(name string) (string, error) {
+	out, err := repo.GitCommand("rev-parse", "--git-path", name).Output()
+	if err != nil {
+		return "", err
+	}
+	return smartJoin(repo.path, string(bytes.TrimSpace(out))), nil
+}
+
+// IsLooseObject reports whether the object `oid` is stored as a loose
+// object in `repo`'s object directory.
+func (repo *Repository) IsLooseObject(oid OID) (bool, error) {
+	hex := oid.String()
+	path, err := repo.gitPath("objects/" + hex[:2] + "/" + hex[2:])
+	if err != nil {
+		return false, fmt.Errorf("finding loose object: %w", err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// PackIndexEntry describes one of the objects in a packfile.
+type PackIndexEntry struct {
+	OID OID
+
+	// DiskSize is the number of bytes that the object occupies in
+	// the packfile (compressed, and possibly as a delta).
+	DiskSize uint64
+}
+
+// PackIndex lists the objects in `pack`, in the order that they are
+// stored, as read from its index by `git show-index`. It doesn't read
+// the packfile itself, so it is fast even for big packs.
+func (repo *Repository) PackIndex(ctx context.Context, pack Packfile) ([]PackIndexEntry, error) {
+	idx, err := os.Open(strings.TrimSuffix(pack.Path, ".pack") + ".idx")
+	if err != nil {
+		return nil, fmt.Errorf("reading index of packfile '%s': %w", pack.Name, err)
+	}
+	defer idx.Close()
+
+	type indexed struct {
+		oid    OID
+		offset uint64
+	}
+	var objects []indexed
+
+	p := pipe.New(pipe.WithStdin(idx))
+	p.Add(
+		pipe.CommandStage("git-show-index", repo.GitCommand("show-index")),
+
+		// Each line is of the form `<offset> SP <oid>`, followed by
+		// ` (<crc32>)` for version 2 indexes:
+		pipe.LinewiseFunction(
+			"parse-show-index",
+			func(_ context.Context, _ pipe.Env, line []byte, _ *bufio.Writer) error {
+				fields := strings.Fields(string(line))
+				if len(fields) < 2 {
+					return fmt.Errorf("malformed 'git show-index' output: %q", line)
+				}
+				offset, err := strconv.ParseUint(fields[0], 10, 64)
+				if err != nil {
+					return fmt.Errorf("malformed 'git show-index' output: %q", line)
+				}
+				oid, err := NewOID(fields[1])
+				if err != nil {
+					return fmt.Errorf("parsing 'git show-index' output: %w", err)
+				}
+				objects = append(objects, indexed{oid: oid, offset: offset})
+				return nil
+			},
+		),
+	)
+
+	if err := p.Run(ctx); err != nil {
+		return nil, fmt.Errorf("reading index of packfile '%s': %w", pack.Name, err)
+	}
+
+	// Each object extends to the start of the next one, and the last
+	// one to the checksum at the end of the packfile:
+	sort.Slice(objects, func(i, j int) bool { return objects[i].offset < objects[j].offset })
+	entries := make([]PackIndexEntry, len(objects))
+	for i, o := range objects {
+		end := uint64(pack.Size) - uint64(len(o.oid.Bytes()))
+		if i+1 < len(objects) {
+			end = objects[i+1].offset
+		}
+		if end < o.offset {
+			return nil, fmt.Errorf("index of packfile '%s' doesn't match the packfile", pack.Name)
+		}
+		entries[i] = PackIndexEntry{OID: o.oid, DiskSize: end - o.offset}
+	}
+	return entries, nil
+}
+
+// DeltaChainCounts maps the length of a delta chain to the number of
+// objects in a packfile that are stored at the end of a chain of that
+// length. Objects that are stored whole have length 0.
+type DeltaChainCounts map[uint64]uint64
+
+// PackDeltaChains returns the lengths of the delta chains in `pack`,
+// from the summary that `git verify-pack -v` prints after verifying
+// it. Since this reads (and checks) every object in the pack, it can
+// take a while for big packs.
+func (repo *Repository) PackDeltaChains(
+	ctx context.Context, pack Packfile,
+) (DeltaChainCounts, error) {
+	chains := make(DeltaChainCounts)
+
+	p := pipe.New()
+	p.Add(
+		pipe.CommandStage("git-verify-pack", repo.GitCommand("verify-pack", "-v", pack.Path)),
+
+		// Besides a line for each object, the output includes lines
+		// like `non delta: <n> objects` and `chain length = <length>:
+		// <n> objects` (or `object`, if there is only one):
+		pipe.LinewiseFunction(
+			"parse-verify-pack",
+			func(_ context.Context, _ pipe.Env, line []byte, _ *bufio.Writer) error {
+				var length, n uint64
+				switch {
+				case bytes.HasPrefix(line, []byte("non delta: ")):
+					if _, err := fmt.Sscanf(string(line), "non delta: %d object", &n); err != nil {
+						return fmt.Errorf("malformed 'git verify-pack' output: %q", line)
+					}
+				case bytes.HasPrefix(line, []byte("chain length = ")):
+					if _, err := fmt.Sscanf(
+						string(line), "chain length = %d: %d object", &length, &n,
+					); err != nil {
+						return fmt.Errorf("malformed 'git verify-pack' output: %q", line)
+					}
+				default:
+					return nil
+				}
+				chains[length] += n
+				return nil
+			},
+		),
+	)
+
+	if err := p.Run(ctx); err != nil {
+		return nil, fmt.Errorf("verifying packfile '%s': %w", pack.Name, err)
+	}
+	return chains, nil
+}
@@ -0,0 +1,23 @@
+//go:build !windows
+// +build !windows
+
+package git
+
+// nativePath converts a path as printed by Git into a native path.
+// On this platform, Git's paths are already native.
+func nativePath(path string) string {
+	return path
+}
+
+// envNameEqual reports whether `a` and `b` name the same environment
+// variable. Environment variable names are case-sensitive on this
+// platform.
+func envNameEqual(a, b string) bool {
+	return a == b
+}
+
+// resolveGitWrapper returns `gitBin` unchanged; wrapper scripts are
+// only a concern on Windows.
+func resolveGitWrapper(gitBin string) string {
+	return gitBin
+}
@@ -0,0 +1,75 @@
+//go:build windows
+// +build windows
+
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// nativePath converts a path as printed by Git into a native path.
+// Git for Windows prints paths with forward slashes (e.g.,
+// `C:/src/repo/.git`), and Git from MSYS2 or Cygwin might print
+// POSIX-style paths (e.g., `/c/src/repo/.git` or
+// `/cygdrive/c/src/repo/.git`). UNC paths (`//server/share/...`) are
+// preserved. Drive letters are normalized to upper case, so that
+// paths that differ only in the case of their drive letter compare
+// equal.
+func nativePath(path string) string {
+	path = strings.TrimPrefix(path, "/cygdrive")
+	if len(path) >= 2 && path[0] == '/' && isDriveLetter(path[1]) &&
+		(len(path) == 2 || path[2] == '/') {
+		path = path[1:2] + ":" + path[2:]
+		if len(path) == 2 {
+			path += "/"
+		}
+	}
+
+	path = filepath.FromSlash(path)
+
+	if len(path) >= 2 && isDriveLetter(path[0]) && path[1] == ':' {
+		path = strings.ToUpper(path[:1]) + path[1:]
+	}
+
+	return path
+}
+
+func isDriveLetter(c byte) bool {
+	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+// envNameEqual reports whether `a` and `b` name the same environment
+// variable. Environment variable names are case-insensitive on
+// Windows.
+func envNameEqual(a, b string) bool {
+	return strings.EqualFold(a, b)
+}
+
+// resolveGitWrapper returns the path to the real `git.exe` if
+// `gitBin` is one of the `git.cmd`/`git.bat` wrapper scripts that
+// some Git for Windows installations put in PATH. Such wrappers can't
+// be relied upon to pass arguments (e.g., reference names or paths
+// containing special characters) through unchanged. If no `git.exe`
+// can be found near the wrapper, `gitBin` is returned unchanged.
+func resolveGitWrapper(gitBin string) string {
+	ext := strings.ToLower(filepath.Ext(gitBin))
+	if ext != ".cmd" && ext != ".bat" {
+		return gitBin
+	}
+
+	dir := filepath.Dir(gitBin)
+	for _, candidate := range []string{
+		filepath.Join(dir, "git.exe"),
+		filepath.Join(dir, "..", "bin", "git.exe"),
+		filepath.Join(dir, "..", "mingw64", "bin", "git.exe"),
+		filepath.Join(dir, "..", "mingw32", "bin", "git.exe"),
+	} {
+		if fi, err := os.Stat(candidate); err == nil && fi.Mode().IsRegular() {
+			return filepath.Clean(candidate)
+		}
+	}
+
+	return gitBin
+}
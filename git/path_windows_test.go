@@ -0,0 +1,64 @@
+//go:build windows
+// +build windows
+
+package git
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNativePath(t *testing.T) {
+	for _, p := range []struct {
+		path     string
+		expected string
+	}{
+		{"C:/src/repo/.git", `C:\src\repo\.git`},
+		{"c:/src/repo/.git", `C:\src\repo\.git`},
+		{`d:\src\repo\.git`, `D:\src\repo\.git`},
+		{"/c/src/repo/.git", `C:\src\repo\.git`},
+		{"/cygdrive/d/src/repo/.git", `D:\src\repo\.git`},
+		{"/c", `C:\`},
+		{"//server/share/repo/.git", `\\server\share\repo\.git`},
+		{".git", ".git"},
+		{"../.git", `..\.git`},
+	} {
+		t.Run(
+			fmt.Sprintf("nativePath(%q)", p.path),
+			func(t *testing.T) {
+				assert.Equal(t, p.expected, nativePath(p.path))
+			},
+		)
+	}
+}
+
+func TestSetEnvCaseInsensitive(t *testing.T) {
+	result := setEnv([]string{"Git_Dir=C:\\old", "Path=C:\\bin"}, "GIT_DIR", `C:\new`)
+	assert.Equal(t, []string{"Path=C:\\bin", `GIT_DIR=C:\new`}, result)
+}
+
+func TestResolveGitWrapper(t *testing.T) {
+	dir := t.TempDir()
+	cmdDir := filepath.Join(dir, "cmd")
+	binDir := filepath.Join(dir, "mingw64", "bin")
+	require.NoError(t, os.MkdirAll(cmdDir, 0o755))
+	require.NoError(t, os.MkdirAll(binDir, 0o755))
+
+	wrapper := filepath.Join(cmdDir, "git.cmd")
+	require.NoError(t, os.WriteFile(wrapper, nil, 0o755))
+
+	// No `git.exe` anywhere nearby:
+	assert.Equal(t, wrapper, resolveGitWrapper(wrapper))
+
+	gitExe := filepath.Join(binDir, "git.exe")
+	require.NoError(t, os.WriteFile(gitExe, nil, 0o755))
+	assert.Equal(t, gitExe, resolveGitWrapper(wrapper))
+
+	// A real executable is used as-is:
+	assert.Equal(t, gitExe, resolveGitWrapper(gitExe))
+}
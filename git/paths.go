@@ -0,0 +1,78 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/github/git-sizer/internal/pipe"
+)
+
+// ForEachTreeAt calls `fn` for each of `specs` (revisions like
+// "HEAD:src", or "HEAD:" for the top-level tree) that names a tree,
+// in order, passing it the index of the spec, the tree's OID, and the
+// tree. Specs that don't name anything, or that name something other
+// than a tree, are skipped.
+func (repo *Repository) ForEachTreeAt(
+	ctx context.Context, specs []string, fn func(i int, oid OID, tree *Tree) error,
+) error {
+	var stdin bytes.Buffer
+	for _, spec := range specs {
+		fmt.Fprintln(&stdin, spec)
+	}
+
+	p := pipe.New(pipe.WithStdin(&stdin))
+	p.Add(
+		pipe.CommandStage(
+			"git-cat-file",
+			repo.GitCommand("cat-file", "--batch", "--buffer"),
+		),
+		pipe.Function(
+			"read-trees",
+			func(_ context.Context, _ pipe.Env, stdin io.Reader, _ io.Writer) error {
+				f := bufio.NewReader(stdin)
+				for i := 0; ; i++ {
+					header, err := f.ReadString('\n')
+					if err != nil {
+						if err == io.EOF {
+							return nil
+						}
+						return fmt.Errorf("reading from 'git cat-file': %w", err)
+					}
+					if strings.HasSuffix(header, " missing\n") {
+						continue
+					}
+					batchHeader, err := ParseBatchHeader(specs[i], header)
+					if err != nil {
+						return fmt.Errorf("parsing output of 'git cat-file': %w", err)
+					}
+
+					// Read the object contents plus the trailing LF:
+					data := make([]byte, batchHeader.ObjectSize+1)
+					if _, err := io.ReadFull(f, data); err != nil {
+						return fmt.Errorf(
+							"reading object data from 'git cat-file' for %s '%s': %w",
+							batchHeader.ObjectType, batchHeader.OID, err,
+						)
+					}
+					if batchHeader.ObjectType != "tree" {
+						continue
+					}
+
+					tree, err := ParseTree(batchHeader.OID, data[:batchHeader.ObjectSize])
+					if err != nil {
+						return err
+					}
+					if err := fn(i, batchHeader.OID, tree); err != nil {
+						return err
+					}
+				}
+			},
+		),
+	)
+
+	return p.Run(ctx)
+}
@@ -0,0 +1,297 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/github/git-sizer/internal/pipe"
+)
+
+// ObjectsSize summarizes a set of objects.
+type ObjectsSize struct {
+	// Count is the number of objects.
+	Count uint64
+
+	// Size is the total (uncompressed) size of the objects.
+	Size uint64
+
+	// DiskSize is the total size that the objects occupy on disk,
+	// as reported by `git cat-file`'s `%(objectsize:disk)`.
+	DiskSize uint64
+}
+
+// ReachableObjectsSize reports the number and sizes of the objects
+// that are reachable from `include` but not from `exclude`, like
+// `git rev-list --objects include... --not exclude...`.
+func (repo *Repository) ReachableObjectsSize(
+	ctx context.Context, include, exclude []OID,
+) (ObjectsSize, error) {
+	var total ObjectsSize
+	byType, err := repo.ReachableObjectsSizeByType(ctx, include, exclude)
+	if err != nil {
+		return ObjectsSize{}, err
+	}
+	for _, size := range byType {
+		total.Count += size.Count
+		total.Size += size.Size
+		total.DiskSize += size.DiskSize
+	}
+	return total, nil
+}
+
+// ReachableObjectsSizeByType is like `ReachableObjectsSize()`, except
+// that it reports the objects of each type separately. Types that
+// have no objects are omitted.
+func (repo *Repository) ReachableObjectsSizeByType(
+	ctx context.Context, include, exclude []OID,
+) (map[ObjectType]ObjectsSize, error) {
+	byType := make(map[ObjectType]ObjectsSize)
+	if len(include) == 0 {
+		return byType, nil
+	}
+
+	var stdin bytes.Buffer
+	for _, oid := range include {
+		fmt.Fprintln(&stdin, oid)
+	}
+	for _, oid := range exclude {
+		fmt.Fprintf(&stdin, "^%s\n", oid)
+	}
+
+	p := pipe.New(pipe.WithStdin(&stdin))
+	p.Add(
+		pipe.CommandStage(
+			"git-rev-list",
+			repo.GitCommand("rev-list", "--objects", "--stdin"),
+		),
+
+		// Strip off the paths that `rev-list` appends to some OIDs:
+		pipe.LinewiseFunction(
+			"copy-oids",
+			func(_ context.Context, _ pipe.Env, line []byte, stdout *bufio.Writer) error {
+				if i := bytes.IndexByte(line, ' '); i != -1 {
+					line = line[:i]
+				}
+				if _, err := stdout.Write(line); err != nil {
+					return fmt.Errorf("writing OID to 'git cat-file': %w", err)
+				}
+				return stdout.WriteByte('\n')
+			},
+		),
+
+		pipe.CommandStage(
+			"git-cat-file",
+			repo.GitCommand(
+				"cat-file", "--batch-check=%(objecttype) %(objectsize) %(objectsize:disk)", "--buffer",
+			),
+		),
+
+		pipe.Function(
+			"sum-sizes",
+			func(_ context.Context, _ pipe.Env, stdin io.Reader, _ io.Writer) error {
+				in := bufio.NewScanner(stdin)
+				for in.Scan() {
+					words := strings.Fields(in.Text())
+					if len(words) != 3 {
+						return fmt.Errorf("malformed 'git cat-file' output: %q", in.Text())
+					}
+					size, err := strconv.ParseUint(words[1], 10, 64)
+					if err != nil {
+						return fmt.Errorf("parsing 'git cat-file' output: %w", err)
+					}
+					diskSize, err := strconv.ParseUint(words[2], 10, 64)
+					if err != nil {
+						return fmt.Errorf("parsing 'git cat-file' output: %w", err)
+					}
+					objectType := ObjectType(words[0])
+					total := byType[objectType]
+					total.Count++
+					total.Size += size
+					total.DiskSize += diskSize
+					byType[objectType] = total
+				}
+				return in.Err()
+			},
+		),
+	)
+
+	if err := p.Run(ctx); err != nil {
+		return nil, err
+	}
+	return byType, nil
+}
+
+// ForEachReachableObject calls `fn` for each object that is reachable
+// from `roots` (which may include trees and blobs), like `git
+// rev-list --objects roots...`. Missing objects are skipped.
+func (repo *Repository) ForEachReachableObject(
+	ctx context.Context, roots []OID, fn func(oid OID) error,
+) error {
+	if len(roots) == 0 {
+		return nil
+	}
+
+	var stdin bytes.Buffer
+	for _, oid := range roots {
+		fmt.Fprintln(&stdin, oid)
+	}
+
+	p := pipe.New(pipe.WithStdin(&stdin))
+	p.Add(
+		pipe.CommandStage(
+			"git-rev-list",
+			repo.GitCommand("rev-list", "--objects", "--missing=allow-any", "--stdin"),
+		),
+		pipe.LinewiseFunction(
+			"parse-oids",
+			func(_ context.Context, _ pipe.Env, line []byte, _ *bufio.Writer) error {
+				// Strip off the path that `rev-list` appends to some
+				// OIDs:
+				if i := bytes.IndexByte(line, ' '); i != -1 {
+					line = line[:i]
+				}
+				oid, err := NewOID(string(line))
+				if err != nil {
+					return fmt.Errorf("parsing 'git rev-list' output: %w", err)
+				}
+				return fn(oid)
+			},
+		),
+	)
+
+	return p.Run(ctx)
+}
+
+// ForEachObjectInCommitOrder calls `fn` for each object that is
+// reachable from the commits `roots` but not from `exclude`, like
+// `git rev-list --objects --in-commit-order`. Each commit is visited
+// right before the trees and blobs that are first reached via its
+// tree, which are passed along with their paths relative to that
+// tree ("" for the tree itself). If `fn` returns `pipe.FinishEarly`,
+// the walk is stopped without an error.
+func (repo *Repository) ForEachObjectInCommitOrder(
+	ctx context.Context, roots, exclude []OID,
+	fn func(oid OID, isCommit bool, path string) error,
+) error {
+	if len(roots) == 0 {
+		return nil
+	}
+
+	var stdin bytes.Buffer
+	for _, oid := range roots {
+		fmt.Fprintln(&stdin, oid)
+	}
+	for _, oid := range exclude {
+		fmt.Fprintf(&stdin, "^%s\n", oid)
+	}
+
+	p := pipe.New(pipe.WithStdin(&stdin))
+	p.Add(
+		pipe.CommandStage(
+			"git-rev-list",
+			repo.GitCommand("rev-list", "--objects", "--in-commit-order", "--stdin"),
+		),
+		pipe.LinewiseFunction(
+			"parse-objects",
+			func(_ context.Context, _ pipe.Env, line []byte, _ *bufio.Writer) error {
+				// Commits are output without a path; all other
+				// objects are followed by a space and their
+				// (possibly empty) path:
+				isCommit := true
+				var path string
+				if i := bytes.IndexByte(line, ' '); i != -1 {
+					isCommit = false
+					path = string(line[i+1:])
+					line = line[:i]
+				}
+				oid, err := NewOID(string(line))
+				if err != nil {
+					return fmt.Errorf("parsing 'git rev-list' output: %w", err)
+				}
+				return fn(oid, isCommit, path)
+			},
+		),
+	)
+
+	return p.Run(ctx)
+}
+
+// ForEachObjectIntroducedSince calls `fn` for each object that is
+// reachable from the commits `commits` but not from any commit in
+// their history whose committer date is at or before `since`. These
+// are the objects that were first introduced by commits dated after
+// `since` (including those commits themselves).
+func (repo *Repository) ForEachObjectIntroducedSince(
+	ctx context.Context, commits []OID, since time.Time, fn func(oid OID) error,
+) error {
+	if len(commits) == 0 {
+		return nil
+	}
+
+	var stdin bytes.Buffer
+	for _, oid := range commits {
+		fmt.Fprintln(&stdin, oid)
+	}
+
+	// First find the commits that are too old. (`--until` only
+	// filters the output; it doesn't stop the walk.)
+	var old []OID
+	p := pipe.New(pipe.WithStdin(bytes.NewReader(stdin.Bytes())))
+	p.Add(
+		pipe.CommandStage(
+			"git-rev-list",
+			repo.GitCommand(
+				"rev-list", fmt.Sprintf("--until=@%d", since.Unix()), "--stdin",
+			),
+		),
+		pipe.LinewiseFunction(
+			"parse-oids",
+			func(_ context.Context, _ pipe.Env, line []byte, _ *bufio.Writer) error {
+				oid, err := NewOID(string(line))
+				if err != nil {
+					return fmt.Errorf("parsing 'git rev-list' output: %w", err)
+				}
+				old = append(old, oid)
+				return nil
+			},
+		),
+	)
+	if err := p.Run(ctx); err != nil {
+		return err
+	}
+
+	for _, oid := range old {
+		fmt.Fprintf(&stdin, "^%s\n", oid)
+	}
+
+	p = pipe.New(pipe.WithStdin(&stdin))
+	p.Add(
+		pipe.CommandStage(
+			"git-rev-list",
+			repo.GitCommand("rev-list", "--objects", "--missing=allow-any", "--stdin"),
+		),
+		pipe.LinewiseFunction(
+			"parse-oids",
+			func(_ context.Context, _ pipe.Env, line []byte, _ *bufio.Writer) error {
+				// Strip off the path that `rev-list` appends to some
+				// OIDs:
+				if i := bytes.IndexByte(line, ' '); i != -1 {
+					line = line[:i]
+				}
+				oid, err := NewOID(string(line))
+				if err != nil {
+					return fmt.Errorf("parsing 'git rev-list' output: %w", err)
+				}
+				return fn(oid)
+			},
+		),
+	)
+
+	return p.Run(ctx)
+}
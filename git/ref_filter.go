@@ -125,6 +125,19 @@ func RegexpFilter(pattern string) (ReferenceFilter, error) {
 	return regexpFilter{re}, nil
 }
 
+// PartialRegexpFilter returns a `ReferenceFilter` that matches
+// references whose names contain a match for the specified
+// `pattern` anywhere. The pattern can still be anchored explicitly
+// using `^` and `$`.
+func PartialRegexpFilter(pattern string) (ReferenceFilter, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	return regexpFilter{re}, nil
+}
+
 type regexpFilter struct {
 	re *regexp.Regexp
 }
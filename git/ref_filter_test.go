@@ -87,6 +87,35 @@ func TestRegexpFilter(t *testing.T) {
 	}
 }
 
+func TestPartialRegexpFilter(t *testing.T) {
+	t.Parallel()
+
+	for _, p := range []struct {
+		pattern  string
+		refname  string
+		expected bool
+	}{
+		{`refs/heads/master`, "refs/heads/master", true},
+		{`.*/heads/`, "refs/heads/master", true},
+		{`/heads/`, "refs/heads/master", true},
+		{`heads`, "refs/heads/master", true},
+		{`^heads`, "refs/heads/master", false},
+		{`master$`, "refs/heads/master", true},
+		{`master$`, "refs/heads/master-2", false},
+		{`release-\d+`, "refs/tags/release-1.2.3rc1", true},
+		{`tags`, "refs/heads/master", false},
+	} {
+		t.Run(
+			fmt.Sprintf("pattern '%s', refname '%s'", p.pattern, p.refname),
+			func(t *testing.T) {
+				f, err := git.PartialRegexpFilter(p.pattern)
+				require.NoError(t, err)
+				assert.Equal(t, p.expected, f.Filter(p.refname))
+			},
+		)
+	}
+}
+
 func TestIncludeExcludeFilter(t *testing.T) {
 	t.Parallel()
 
@@ -2,9 +2,11 @@ package git
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"fmt"
 	"io"
+	"strings"
 
 	"github.com/github/git-sizer/internal/pipe"
 )
@@ -12,69 +14,165 @@ import (
 // ReferenceIter is an iterator that interates over references.
 type ReferenceIter struct {
 	refCh chan Reference
-	errCh chan error
+	child *child
 }
 
 // NewReferenceIter returns an iterator that iterates over all of the
-// references in `repo`.
+// references in `repo`. References that point at objects that don't
+// exist are reported with `ObjectType` "missing".
 func (repo *Repository) NewReferenceIter(ctx context.Context) (*ReferenceIter, error) {
+	ctx, cancel := context.WithCancel(ctx)
 	iter := ReferenceIter{
 		refCh: make(chan Reference),
-		errCh: make(chan error),
 	}
 
+	done := make(chan struct{})
+	var readErr error
+	iter.child = &child{
+		// There is no input to close:
+		closeInput: func() {},
+		cancel:     cancel,
+		waitFn: func() error {
+			<-done
+			return readErr
+		},
+	}
+	if err := repo.startChild(
+		iter.child,
+		func() error {
+			go func() {
+				readErr = repo.readReferences(ctx, iter.refCh)
+				close(iter.refCh)
+				close(done)
+			}()
+			return nil
+		},
+	); err != nil {
+		return nil, err
+	}
+
+	return &iter, nil
+}
+
+// refTip is a reference name and the OID that it points at, before
+// the object has been looked up.
+type refTip struct {
+	oid     OID
+	refname string
+}
+
+// readReferences reads all of the references in `repo`, looks up
+// the objects that they point at, and sends the results to `refCh`.
+// The objects are looked up separately (rather than using
+// `%(objecttype)` etc.), because `git for-each-ref` dies if asked
+// about an object that is missing.
+func (repo *Repository) readReferences(ctx context.Context, refCh chan<- Reference) error {
+	var tips []refTip
+
 	p := pipe.New()
 	p.Add(
-		// Output all references and their values:
+		// Output all references and their values. Each record is
+		// terminated by a NUL (which can't appear in a reference
+		// name), followed by the LF that `for-each-ref` always
+		// appends, so that reference names containing LFs or other
+		// odd bytes can be read reliably:
 		pipe.CommandStage(
 			"git-for-each-ref",
-			repo.GitCommand(
-				"for-each-ref",
-				"--format=%(objectname) %(objecttype) %(objectsize) %(refname)",
-			),
+			repo.GitCommand("for-each-ref", "--format=%(objectname) %(refname)%00"),
 		),
 
-		// Read the references and send them to `iter.refCh`, then close
-		// the channel.
 		pipe.Function(
 			"parse-refs",
 			func(ctx context.Context, env pipe.Env, stdin io.Reader, stdout io.Writer) error {
-				defer close(iter.refCh)
-
 				in := bufio.NewReader(stdin)
 				for {
-					line, err := in.ReadBytes('\n')
+					record, err := in.ReadBytes(0)
 					if err != nil {
 						if err == io.EOF {
+							if len(record) != 0 && string(record) != "\n" {
+								return fmt.Errorf(
+									"unterminated record in 'git for-each-ref' output: %q",
+									record,
+								)
+							}
 							return nil
 						}
 						return fmt.Errorf("reading 'git for-each-ref' output: %w", err)
 					}
 
-					ref, err := ParseReference(string(line[:len(line)-1]))
+					// Every record but the first starts with the LF
+					// that terminated the previous one:
+					if len(record) > 0 && record[0] == '\n' {
+						record = record[1:]
+					}
+
+					line := string(record[:len(record)-1])
+					words := strings.SplitN(line, " ", 2)
+					if len(words) != 2 {
+						return fmt.Errorf("malformed 'git for-each-ref' output: %q", line)
+					}
+					oid, err := NewOID(words[0])
 					if err != nil {
 						return fmt.Errorf("parsing 'git for-each-ref' output: %w", err)
 					}
+					tips = append(tips, refTip{oid: oid, refname: words[1]})
+				}
+			},
+		),
+	)
+
+	if err := p.Run(ctx); err != nil {
+		return err
+	}
+
+	var oids bytes.Buffer
+	for _, tip := range tips {
+		fmt.Fprintln(&oids, tip.oid)
+	}
+
+	p = pipe.New(pipe.WithStdin(&oids))
+	p.Add(
+		pipe.CommandStage("git-cat-file", repo.GitCommand("cat-file", "--batch-check")),
+
+		// `cat-file` outputs one line for each of the OIDs, in
+		// order, so match them back up with the references:
+		pipe.Function(
+			"combine-refs",
+			func(ctx context.Context, env pipe.Env, stdin io.Reader, stdout io.Writer) error {
+				in := bufio.NewReader(stdin)
+				for _, tip := range tips {
+					header, err := in.ReadString('\n')
+					if err != nil {
+						return fmt.Errorf("reading 'git cat-file' output: %w", err)
+					}
+
+					ref := Reference{
+						Refname: tip.refname,
+						OID:     tip.oid,
+					}
+					if strings.HasSuffix(header, " missing\n") {
+						ref.ObjectType = "missing"
+					} else {
+						batchHeader, err := ParseBatchHeader(tip.refname, header)
+						if err != nil {
+							return err
+						}
+						ref.ObjectType = batchHeader.ObjectType
+						ref.ObjectSize = batchHeader.ObjectSize
+					}
+
 					select {
-					case iter.refCh <- ref:
+					case refCh <- ref:
 					case <-ctx.Done():
 						return ctx.Err()
 					}
 				}
+				return nil
 			},
 		),
 	)
 
-	err := p.Start(ctx)
-	if err != nil {
-		return nil, err
-	}
-
-	go func() {
-		iter.errCh <- p.Wait()
-	}()
-
-	return &iter, nil
+	return p.Run(ctx)
 }
 
 // Next returns either the next reference or a boolean `false` value
@@ -83,7 +181,7 @@ func (repo *Repository) NewReferenceIter(ctx context.Context) (*ReferenceIter, e
 func (iter *ReferenceIter) Next() (Reference, bool, error) {
 	ref, ok := <-iter.refCh
 	if !ok {
-		return Reference{}, false, <-iter.errCh
+		return Reference{}, false, iter.child.wait()
 	}
 
 	return ref, true, nil
@@ -10,10 +10,13 @@ import (
 
 // Reference represents a Git reference.
 type Reference struct {
-	// Refname is the full reference name of the reference.
+	// Refname is the full reference name of the reference. It is
+	// the raw bytes reported by Git, which are not necessarily valid
+	// UTF-8. Use `DisplayString()` to make it safe for output.
 	Refname string
 
-	// ObjectType is the type of the object referenced.
+	// ObjectType is the type of the object referenced, or
+	// "missing" if that object doesn't exist.
 	ObjectType ObjectType
 
 	// ObjectSize is the size of the referred-to object, in bytes.
@@ -23,13 +26,17 @@ type Reference struct {
 	OID OID
 }
 
-// ParseReference parses `line` (a non-LF-terminated line) into a
+// ParseReference parses `line` (without its terminator) into a
 // `Reference`. It is assumed that `line` is formatted like the output
 // of
 //
 //     git for-each-ref --format='%(objectname) %(objecttype) %(objectsize) %(refname)'
+//
+// The reference name is taken verbatim to the end of `line`, so it
+// may contain arbitrary bytes other than the terminator (including
+// spaces).
 func ParseReference(line string) (Reference, error) {
-	words := strings.Split(line, " ")
+	words := strings.SplitN(line, " ", 4)
 	if len(words) != 4 {
 		return Reference{}, fmt.Errorf("line improperly formatted: %#v", line)
 	}
@@ -0,0 +1,48 @@
+package git_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/github/git-sizer/counts"
+	"github.com/github/git-sizer/git"
+)
+
+func TestParseReference(t *testing.T) {
+	t.Parallel()
+
+	const hex = "0123456789abcdef0123456789abcdef01234567"
+	oid, err := git.NewOID(hex)
+	require.NoError(t, err)
+
+	for _, refname := range []string{
+		"refs/heads/master",
+		"refs/heads/caf\xe9",
+		"refs/heads/with space",
+		"refs/heads/a\tb",
+		"refs/heads/a\nb",
+	} {
+		refname := refname
+		t.Run(
+			fmt.Sprintf("%q", refname),
+			func(t *testing.T) {
+				t.Parallel()
+
+				ref, err := git.ParseReference(
+					fmt.Sprintf("%s commit 123 %s", hex, refname),
+				)
+				require.NoError(t, err)
+				assert.Equal(t, refname, ref.Refname)
+				assert.Equal(t, oid, ref.OID)
+				assert.Equal(t, git.ObjectType("commit"), ref.ObjectType)
+				assert.Equal(t, counts.Count32(123), ref.ObjectSize)
+			},
+		)
+	}
+
+	_, err = git.ParseReference(hex + " commit 123")
+	assert.Error(t, err)
+}
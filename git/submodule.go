@@ -0,0 +1,154 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/github/git-sizer/internal/pipe"
+)
+
+// ForEachGitlink calls `fn` for each gitlink (i.e., submodule entry)
+// in the tree of `rev`, including those in subdirectories, passing
+// it the entry's path and the OID of the commit that it refers to.
+func (repo *Repository) ForEachGitlink(
+	ctx context.Context, rev string, fn func(path string, oid OID) error,
+) error {
+	p := pipe.New()
+	p.Add(
+		pipe.CommandStage(
+			"git-ls-tree",
+			repo.GitCommand("ls-tree", "-r", "-z", "--full-tree", rev),
+		),
+		// Parse the `ls-tree` output, which is of the form
+		// `<mode> SP <type> SP <oid> TAB <path> NUL`:
+		pipe.Function(
+			"select-gitlinks",
+			func(_ context.Context, _ pipe.Env, stdin io.Reader, _ io.Writer) error {
+				in := bufio.NewReader(stdin)
+				for {
+					record, err := readNULTerminated(in, "git ls-tree")
+					if err != nil {
+						return err
+					}
+					if record == nil {
+						return nil
+					}
+
+					if !bytes.HasPrefix(record, []byte("160000 ")) {
+						continue
+					}
+					tab := bytes.IndexByte(record, '\t')
+					if tab == -1 {
+						return fmt.Errorf("malformed 'git ls-tree' output: %q", record)
+					}
+					words := strings.Fields(string(record[:tab]))
+					if len(words) != 3 {
+						return fmt.Errorf("malformed 'git ls-tree' output: %q", record)
+					}
+					oid, err := NewOID(words[2])
+					if err != nil {
+						return fmt.Errorf("parsing 'git ls-tree' output: %w", err)
+					}
+					if err := fn(string(record[tab+1:]), oid); err != nil {
+						return err
+					}
+				}
+			},
+		),
+	)
+
+	return p.Run(ctx)
+}
+
+// SubmoduleNames reads `.gitmodules` from the tree of `rev` and
+// returns a map from each submodule's path to its name. The map is
+// empty if there is no `.gitmodules` file.
+func (repo *Repository) SubmoduleNames(rev string) (map[string]string, error) {
+	names := make(map[string]string)
+
+	spec := rev + ":.gitmodules"
+	if err := repo.GitCommand("cat-file", "-e", spec).Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return names, nil
+		}
+		return nil, fmt.Errorf("looking for '%s': %w", spec, err)
+	}
+
+	out, err := repo.GitCommand(
+		"config", "--blob", spec, "-z",
+		"--get-regexp", `^submodule\..*\.path$`,
+	).Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+			// No submodule paths are configured.
+			return names, nil
+		}
+		return nil, fmt.Errorf("reading '%s': %w", spec, err)
+	}
+
+	// Each entry is of the form `<key> LF <value> NUL`:
+	for len(out) > 0 {
+		end := bytes.IndexByte(out, 0)
+		if end == -1 {
+			return nil, fmt.Errorf("invalid output from 'git config': %q", out)
+		}
+		entry := string(out[:end])
+		out = out[end+1:]
+
+		i := strings.IndexByte(entry, '\n')
+		if i == -1 {
+			return nil, fmt.Errorf("invalid output from 'git config': %q", entry)
+		}
+		key, path := entry[:i], entry[i+1:]
+		name := strings.TrimSuffix(strings.TrimPrefix(key, "submodule."), ".path")
+		names[path] = name
+	}
+
+	return names, nil
+}
+
+// SubmoduleGitDir returns the path of the repository for the
+// submodule named `name`, whose path within the superproject's tree
+// is `path`. The repository is looked for first under
+// `$GIT_DIR/modules/`, where `git submodule` stores it, then in a
+// checked-out working directory (if `repo` has a conventional
+// working tree). `ok` is false if the submodule hasn't been
+// initialized.
+func (repo *Repository) SubmoduleGitDir(name, path string) (string, bool) {
+	dir := filepath.Join(repo.path, "modules", filepath.FromSlash(name))
+	if isGitDir(dir) {
+		return dir, true
+	}
+
+	if filepath.Base(repo.path) == ".git" {
+		dir = filepath.Join(filepath.Dir(repo.path), filepath.FromSlash(path))
+		// Don't let an empty directory (as left behind for an
+		// uninitialized submodule) resolve to the superproject:
+		if _, err := os.Lstat(filepath.Join(dir, ".git")); err == nil {
+			return dir, true
+		}
+	}
+
+	return "", false
+}
+
+// isGitDir reports whether `dir` looks like a git dir.
+func isGitDir(dir string) bool {
+	if fi, err := os.Stat(filepath.Join(dir, "HEAD")); err != nil || fi.IsDir() {
+		return false
+	}
+	if fi, err := os.Stat(filepath.Join(dir, "objects")); err != nil || !fi.IsDir() {
+		return false
+	}
+	return true
+}
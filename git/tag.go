@@ -1,6 +1,7 @@
 package git
 
 import (
+	"bytes"
 	"fmt"
 
 	"github.com/github/git-sizer/counts"
@@ -11,6 +12,41 @@ type Tag struct {
 	Size         counts.Count32
 	Referent     OID
 	ReferentType ObjectType
+
+	// MessageSize is the size of the tag's message (everything after
+	// the headers, including any signature block), in bytes.
+	MessageSize counts.Count32
+
+	// Signed is true if the tag carries a signature (which is not
+	// verified), either in its message or in a `gpgsig` header.
+	Signed bool
+}
+
+// signatureBeginMarkers are the lines that can start a signature
+// block at the end of a tag message.
+var signatureBeginMarkers = [][]byte{
+	[]byte("-----BEGIN PGP SIGNATURE-----\n"),
+	[]byte("-----BEGIN PGP MESSAGE-----\n"),
+	[]byte("-----BEGIN SSH SIGNATURE-----\n"),
+	[]byte("-----BEGIN SIGNED MESSAGE-----\n"),
+}
+
+// hasSignatureBlock reports whether any line of `message` starts a
+// signature block.
+func hasSignatureBlock(message []byte) bool {
+	for len(message) > 0 {
+		for _, marker := range signatureBeginMarkers {
+			if bytes.HasPrefix(message, marker) {
+				return true
+			}
+		}
+		i := bytes.IndexByte(message, '\n')
+		if i == -1 {
+			break
+		}
+		message = message[i+1:]
+	}
+	return false
 }
 
 // ParseTag parses the Git tag object whose contents are contained in
@@ -20,6 +56,7 @@ func ParseTag(oid OID, data []byte) (*Tag, error) {
 	var referentFound bool
 	var referentType ObjectType
 	var referentTypeFound bool
+	var signed bool
 	iter, err := NewObjectHeaderIter(oid.String(), data)
 	if err != nil {
 		return nil, err
@@ -45,6 +82,8 @@ func ParseTag(oid OID, data []byte) (*Tag, error) {
 			}
 			referentType = ObjectType(value)
 			referentTypeFound = true
+		case "gpgsig", "gpgsig-sha256":
+			signed = true
 		}
 	}
 	if !referentFound {
@@ -53,9 +92,18 @@ func ParseTag(oid OID, data []byte) (*Tag, error) {
 	if !referentTypeFound {
 		return nil, fmt.Errorf("no type found in tag %s", oid)
 	}
+	var message []byte
+	if i := bytes.Index(data, []byte("\n\n")); i != -1 {
+		message = data[i+2:]
+	}
+	if hasSignatureBlock(message) {
+		signed = true
+	}
 	return &Tag{
 		Size:         counts.NewCount32(uint64(len(data))),
 		Referent:     referent,
 		ReferentType: referentType,
+		MessageSize:  counts.NewCount32(uint64(len(message))),
+		Signed:       signed,
 	}, nil
 }
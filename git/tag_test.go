@@ -0,0 +1,83 @@
+package git_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/github/git-sizer/counts"
+	"github.com/github/git-sizer/git"
+)
+
+func TestParseTagSignature(t *testing.T) {
+	t.Parallel()
+
+	const header = "object 0123456789abcdef0123456789abcdef01234567\n" +
+		"type commit\n" +
+		"tag v1.0\n" +
+		"tagger A U Thor <author@example.com> 1112911993 -0700\n"
+
+	for _, p := range []struct {
+		name     string
+		data     string
+		expected bool
+	}{
+		{"unsigned", header + "\nRelease 1.0\n", false},
+		{
+			"pgp",
+			header + "\nRelease 1.0\n-----BEGIN PGP SIGNATURE-----\n\nabc\n-----END PGP SIGNATURE-----\n",
+			true,
+		},
+		{
+			"ssh",
+			header + "\nRelease 1.0\n-----BEGIN SSH SIGNATURE-----\nabc\n-----END SSH SIGNATURE-----\n",
+			true,
+		},
+		{
+			"x509",
+			header + "\nRelease 1.0\n-----BEGIN SIGNED MESSAGE-----\nabc\n-----END SIGNED MESSAGE-----\n",
+			true,
+		},
+		{"header", header + "gpgsig-sha256 -----BEGIN PGP SIGNATURE-----\n abc\n\nRelease 1.0\n", true},
+		{"mentioned", header + "\nDon't paste -----BEGIN PGP SIGNATURE----- here\n", false},
+	} {
+		p := p
+		t.Run(p.name, func(t *testing.T) {
+			t.Parallel()
+
+			tag, err := git.ParseTag(git.NullOID, []byte(p.data))
+			require.NoError(t, err)
+			assert.Equal(t, p.expected, tag.Signed)
+		})
+	}
+}
+
+func TestParseTagMessageSize(t *testing.T) {
+	t.Parallel()
+
+	const header = "object 0123456789abcdef0123456789abcdef01234567\n" +
+		"type commit\n" +
+		"tag v1.0\n" +
+		"tagger A U Thor <author@example.com> 1112911993 -0700\n"
+
+	for _, p := range []struct {
+		name     string
+		data     string
+		expected counts.Count32
+	}{
+		{"message", header + "\nRelease 1.0\n", 12},
+		{"empty", header + "\n", 0},
+		{"none", header, 0},
+	} {
+		p := p
+		t.Run(p.name, func(t *testing.T) {
+			t.Parallel()
+
+			tag, err := git.ParseTag(git.NullOID, []byte(p.data))
+			require.NoError(t, err)
+			assert.Equal(t, p.expected, tag.MessageSize)
+			assert.Equal(t, counts.Count32(len(p.data)), tag.Size)
+		})
+	}
+}
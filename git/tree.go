@@ -11,12 +11,16 @@ import (
 // Tree represents a Git tree object.
 type Tree struct {
 	data string
+
+	// oidSize is the size of the object IDs in the tree's entries.
+	oidSize int
 }
 
 // ParseTree parses the tree object whose contents are contained in
-// `data`. `oid` is currently unused.
+// `data`. The object IDs in its entries are assumed to be in the same
+// object format as `oid`.
 func ParseTree(oid OID, data []byte) (*Tree, error) {
-	return &Tree{string(data)}, nil
+	return &Tree{data: string(data), oidSize: oid.size()}, nil
 }
 
 // Size returns the size of the tree object.
@@ -31,18 +35,26 @@ type TreeEntry struct {
 	Name     string
 	OID      OID
 	Filemode uint
+
+	// ZeroPaddedFilemode is set if the mode was written with a
+	// leading zero (e.g., "040000" rather than "40000"), as some old
+	// tools did. `git fsck` warns about such entries.
+	ZeroPaddedFilemode bool
 }
 
 // TreeIter is an iterator over the entries in a Git tree object.
 type TreeIter struct {
 	// The as-yet-unread part of the tree's data.
 	data string
+
+	oidSize int
 }
 
 // Iter returns an iterator over the entries in `tree`.
 func (tree *Tree) Iter() *TreeIter {
 	return &TreeIter{
-		data: tree.data,
+		data:    tree.data,
+		oidSize: tree.oidSize,
 	}
 }
 
@@ -64,6 +76,7 @@ func (iter *TreeIter) NextEntry() (TreeEntry, bool, error) {
 		return TreeEntry{}, false, err
 	}
 	entry.Filemode = uint(mode)
+	entry.ZeroPaddedFilemode = iter.data[0] == '0'
 
 	iter.data = iter.data[spAt+1:]
 	nulAt := strings.IndexByte(iter.data, 0)
@@ -74,12 +87,12 @@ func (iter *TreeIter) NextEntry() (TreeEntry, bool, error) {
 	entry.Name = iter.data[:nulAt]
 
 	iter.data = iter.data[nulAt+1:]
-	if len(iter.data) < 20 {
+	if len(iter.data) < iter.oidSize {
 		return TreeEntry{}, false, errors.New("tree entry ends unexpectedly")
 	}
 
-	copy(entry.OID.v[0:20], iter.data[0:20])
-	iter.data = iter.data[20:]
+	entry.OID.n = uint8(copy(entry.OID.v[:], iter.data[:iter.oidSize]))
+	iter.data = iter.data[iter.oidSize:]
 
 	return entry, true, nil
 }
@@ -1,7 +1,11 @@
 package main_test
 
 import (
+	"archive/zip"
 	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -10,9 +14,12 @@ import (
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"sort"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
+	"unicode/utf16"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -113,22 +120,22 @@ func TestRefSelections(t *testing.T) {
 		refname string
 	}{
 		//nolint:gocritic // Want columns in comment to match initializers.
-		//          111111111
-		//0123456789012345678
-		{"+ + + + + + +   + +", "refs/barfoo"},
-		{"+ + + + + + +++    ", "refs/foo"},
-		{"+ + + + + + +   + +", "refs/foobar"},
-		{"++  + + + +++   +++", "refs/heads/foo"},
-		{"++  + + + ++    +++", "refs/heads/master"},
-		{"+ + + ++  +        ", "refs/notes/discussion"},
-		{"+ + ++  + +        ", "refs/remotes/origin/master"},
-		{"+ + ++  + + +   + +", "refs/remotes/upstream/foo"},
-		{"+ + ++  + +        ", "refs/remotes/upstream/master"},
-		{"+ + + + ++         ", "refs/stash"},
-		{"+ ++  + + +++   + +", "refs/tags/foolish"},
-		{"+ ++  + + ++    + +", "refs/tags/other"},
-		{"+ ++  + + ++   +   ", "refs/tags/release-1"},
-		{"+ ++  + + ++   +   ", "refs/tags/release-2"},
+		//          1111111111222
+		//0123456789012345678901
+		{"+ + + + + + +   + ++  ", "refs/barfoo"},
+		{"+ + + + + + +++    +  ", "refs/foo"},
+		{"+ + + + + + +   + ++  ", "refs/foobar"},
+		{"++  + + + +++   ++++  ", "refs/heads/foo"},
+		{"++  + + + ++    +++  +", "refs/heads/master"},
+		{"+ + + ++  +           ", "refs/notes/discussion"},
+		{"+ + ++  + +          +", "refs/remotes/origin/master"},
+		{"+ + ++  + + +   + ++  ", "refs/remotes/upstream/foo"},
+		{"+ + ++  + +          +", "refs/remotes/upstream/master"},
+		{"+ + + + ++            ", "refs/stash"},
+		{"+ ++  + + +++   + +++ ", "refs/tags/foolish"},
+		{"+ ++  + + ++    + + + ", "refs/tags/other"},
+		{"+ ++  + + ++   +    + ", "refs/tags/release-1"},
+		{"+ ++  + + ++   +    + ", "refs/tags/release-2"},
 	}
 
 	// computeExpectations assembles and returns the results expected
@@ -255,6 +262,21 @@ func TestRefSelections(t *testing.T) {
 				{Key: "refgroup.mygroup.excludeRegexp", Value: "refs/tags/release-.*"},
 			},
 		},
+		{ // 19
+			name: "foo partial match",
+			args: []string{"--regexp-partial-match", "--include", "/foo/"},
+		},
+		{ // 20
+			name: "partial match after pattern",
+			args: []string{"--include", "/^refs/tags//", "--regexp-partial-match"},
+		},
+		{ // 21
+			name: "partial match refgroup",
+			args: []string{"--include=@mygroup", "--regexp-partial-match"},
+			config: []git.ConfigEntry{
+				{Key: "refgroup.mygroup.includeRegexp", Value: "master$"},
+			},
+		},
 	} {
 		i, p := i, p
 		t.Run(
@@ -357,6 +379,7 @@ func TestRefgroups(t *testing.T) {
 |     * Git notes              |     3     |                                |
 |     * Git stash              |     1     |                                |
 |     * Other                  |     2     |                                |
+|   * Max refs per commit  [1] |     1     |                                |
 |                              |           |                                |
 `[1:],
 			stderr: `
@@ -415,6 +438,7 @@ References (included references marked with '+'):
 |         * oatend             |     3     |                                |
 |         * Other              |     1     |                                |
 |     * Other                  |     1     |                                |
+|   * Max refs per commit  [1] |     1     |                                |
 |                              |           |                                |
 `[1:],
 		},
@@ -436,6 +460,7 @@ References (included references marked with '+'):
 |     * Remote-tracking refs   |     1     |                                |
 |     * oatend                 |     4     |                                |
 |     * Ignored                |    14     |                                |
+|   * Max refs per commit  [1] |     1     |                                |
 |                              |           |                                |
 `[1:],
 			stderr: `
@@ -476,6 +501,7 @@ References (included references marked with '+'):
 |     * Changeset refs         |     2     |                                |
 |     * Other                  |     2     |                                |
 |     * Ignored                |     4     |                                |
+|   * Max refs per commit  [1] |     1     |                                |
 |                              |           |                                |
 `[1:],
 			stderr: `
@@ -536,6 +562,425 @@ References (included references marked with '+'):
 	}
 }
 
+// TestLenientFilters checks that `--lenient-filters` skips invalid
+// reference-selection patterns with a warning, wherever it appears on
+// the command line.
+func TestLenientFilters(t *testing.T) {
+	t.Parallel()
+
+	repo := testutils.NewTestRepo(t, true, "lenient-filters")
+	t.Cleanup(func() { repo.Remove(t) })
+
+	repo.CreateReferencedOrphan(t, "refs/heads/master")
+	repo.CreateReferencedOrphan(t, "refs/heads/keep")
+
+	run := func(args ...string) (string, error) {
+		t.Helper()
+		cmd := exec.Command(
+			sizerExe(t), append([]string{"--show-refs", "--no-progress"}, args...)...,
+		)
+		cmd.Dir = repo.Path
+		cmd.Env = testutils.CleanGitEnv()
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		err := cmd.Run()
+		return stderr.String(), err
+	}
+
+	filters := []string{"--no-branches", "--include=/keep(/", "--include=@nope", "--include=refs/heads/keep"}
+
+	stderr, err := run(filters...)
+	assert.Error(t, err)
+	assert.Equal(
+		t,
+		"error: invalid argument \"/keep(/\" for \"--include\" flag: "+
+			"error parsing regexp: missing closing ): `^keep($`\n",
+		stderr,
+	)
+
+	stderr, err = run(append(filters, "--lenient-filters")...)
+	require.NoError(t, err, "running git-sizer")
+	assert.Equal(
+		t,
+		"warning: skipping invalid argument \"/keep(/\" for \"--include\" flag: "+
+			"error parsing regexp: missing closing ): `^keep($`\n"+
+			"warning: skipping invalid argument \"@nope\" for \"--include\" flag: "+
+			"undefined refgroup 'nope'\n"+
+			"References (included references marked with '+'):\n"+
+			"+ refs/heads/keep\n"+
+			"  refs/heads/master\n",
+		stderr,
+	)
+}
+
+// TestExplainRefs checks that `--explain-refs` reports the option
+// that decided whether each reference is walked.
+func TestExplainRefs(t *testing.T) {
+	t.Parallel()
+
+	repo := testutils.NewTestRepo(t, true, "explain-refs")
+	t.Cleanup(func() { repo.Remove(t) })
+
+	repo.CreateReferencedOrphan(t, "refs/heads/master")
+	repo.CreateReferencedOrphan(t, "refs/heads/wip/experiment")
+	repo.CreateReferencedOrphan(t, "refs/notes/commits")
+	repo.CreateReferencedOrphan(t, "refs/tags/v1.0")
+
+	run := func(args ...string) string {
+		t.Helper()
+		cmd := exec.Command(sizerExe(t), append([]string{"--no-progress"}, args...)...)
+		cmd.Dir = repo.Path
+		cmd.Env = testutils.CleanGitEnv()
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		require.NoError(t, cmd.Run(), "running git-sizer")
+		return stderr.String()
+	}
+
+	const header = "References (included references marked with '+'; " +
+		"the option that decided in parentheses):\n"
+
+	assert.Equal(
+		t,
+		header+
+			"+ refs/heads/master (--branches)\n"+
+			"  refs/heads/wip/experiment (--exclude=/.*/wip/.*/)\n"+
+			"  refs/notes/commits (no option matched)\n"+
+			"+ refs/tags/v1.0 (--tags)\n",
+		run("--explain-refs", "--branches", "--exclude=/.*/wip/.*/", "--tags"),
+	)
+
+	// An initial `--exclude` lets through the references that no
+	// option matches, and `--filter-debug` is a synonym:
+	assert.Equal(
+		t,
+		header+
+			"+ refs/heads/master (no option matched)\n"+
+			"+ refs/heads/wip/experiment (--include=refs/heads/wip)\n"+
+			"  refs/notes/commits (--no-notes)\n"+
+			"+ refs/tags/v1.0 (no option matched)\n",
+		run("--filter-debug", "--no-notes", "--exclude=refs/heads/wip", "--include=refs/heads/wip"),
+	)
+
+	// Options are reported the way that they were written:
+	assert.Equal(
+		t,
+		header+
+			"+ refs/heads/master (--no-branches=false)\n"+
+			"+ refs/heads/wip/experiment (--no-branches=false)\n"+
+			"  refs/notes/commits (no option matched)\n"+
+			"  refs/tags/v1.0 (--no-tags)\n",
+		run("--explain-refs", "--no-branches=false", "--no-tags"),
+	)
+
+	assert.Equal(
+		t,
+		header+
+			"+ refs/heads/master (no reference-selection options)\n"+
+			"+ refs/heads/wip/experiment (no reference-selection options)\n"+
+			"+ refs/notes/commits (no reference-selection options)\n"+
+			"+ refs/tags/v1.0 (no reference-selection options)\n",
+		run("--explain-refs"),
+	)
+
+	// The references are only listed once, even if there are other
+	// passes that look at them:
+	assert.Equal(
+		t,
+		"References (included references marked with '+'):\n"+
+			"+ refs/heads/master\n"+
+			"+ refs/heads/wip/experiment\n"+
+			"+ refs/notes/commits\n"+
+			"+ refs/tags/v1.0\n",
+		run("--show-refs", "--tag-only", "--by-remote", "--notes-only", "--by-namespace"),
+	)
+}
+
+// TestSHA256 checks that repositories that use SHA-256 object IDs
+// can be scanned.
+func TestSHA256(t *testing.T) {
+	t.Parallel()
+
+	path, err := ioutil.TempDir("", "sha256")
+	require.NoError(t, err)
+	repo := &testutils.TestRepo{Path: path}
+	t.Cleanup(func() { repo.Remove(t) })
+
+	cmd := exec.Command("git", "init", "--object-format=sha256", path)
+	cmd.Env = testutils.CleanGitEnv()
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Skipf("this version of git can't create SHA-256 repositories: %s", out)
+	}
+
+	timestamp := time.Unix(1112911993, 0)
+	runGit := func(args ...string) {
+		t.Helper()
+		cmd := repo.GitCommand(t, args...)
+		testutils.AddAuthorInfo(cmd, &timestamp)
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, "running git %v: %s", args, out)
+	}
+
+	repo.AddFile(t, "small.txt", "small\n")
+	repo.AddFile(t, "dir/big.bin", strings.Repeat("b", 1000))
+	runGit("commit", "-m", "initial")
+	runGit("tag", "-m", "release", "v1")
+
+	r := repo.Repository(t)
+	assert.Equal(t, "sha256", r.ObjectFormat())
+
+	h, err := sizes.ScanRepositoryUsingGraph(
+		r, refGrouper{}, sizes.NameStyleFull, meter.NoProgressMeter,
+		sizes.ScanOptions{},
+	)
+	require.NoError(t, err, "scanning repository")
+	assert.Equal(t, counts.Count32(1), h.UniqueCommitCount)
+	assert.Equal(t, counts.Count32(2), h.UniqueTreeCount)
+	assert.Equal(t, counts.Count32(2), h.UniqueBlobCount)
+	assert.Equal(t, counts.Count32(1), h.UniqueTagCount)
+	assert.Equal(t, counts.Count32(2), h.MaxExpandedBlobCount)
+	if assert.NotNil(t, h.MaxBlobSizeBlob) {
+		assert.Equal(t, "refs/heads/master:dir/big.bin", h.MaxBlobSizeBlob.Path())
+		assert.Len(t, h.MaxBlobSizeBlob.OID.String(), 64)
+	}
+
+	out, err := repo.GitCommand(t, "rev-parse", "HEAD").Output()
+	require.NoError(t, err)
+	head := strings.TrimSpace(string(out))
+	require.Len(t, head, 64)
+
+	// With '--names=hash', the footnotes name objects by their full
+	// object IDs:
+	cmd = exec.Command(sizerExe(t), "--no-progress", "-v", "--names=hash")
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	out, err = cmd.Output()
+	require.NoError(t, err, "running git-sizer")
+	assert.Regexp(t, `\n\[\d+\]  `+head+`\n`, string(out))
+}
+
+// TestHostileRefnames checks that reference names that are not
+// valid UTF-8, or that Git itself refuses to list, don't derail the
+// scan, and that odd bytes are escaped in the output.
+func TestHostileRefnames(t *testing.T) {
+	t.Parallel()
+
+	repo := testutils.NewTestRepo(t, true, "hostile-refnames")
+	t.Cleanup(func() { repo.Remove(t) })
+
+	repo.CreateReferencedOrphan(t, "refs/heads/master")
+	repo.CreateReferencedOrphan(t, "refs/heads/caf\xe9")
+	repo.CreateReferencedOrphan(t, "refs/tags/caf\xc3\xa9")
+
+	// Git doesn't allow references with control characters to be
+	// created, but ancient tooling could write them directly.
+	// Modern Git skips them (with a warning) when listing
+	// references; make sure that they don't confuse us either:
+	out, err := repo.GitCommand(t, "rev-parse", "refs/heads/master").Output()
+	require.NoError(t, err)
+	oid, err := git.NewOID(string(bytes.TrimSpace(out)))
+	require.NoError(t, err)
+	require.NoError(
+		t,
+		os.WriteFile(
+			filepath.Join(repo.Path, "packed-refs"),
+			[]byte(fmt.Sprintf(
+				"# pack-refs with: peeled fully-peeled sorted \n"+
+					"%s refs/heads/a\tb\n",
+				oid,
+			)),
+			0o666,
+		),
+	)
+	require.NoError(t, os.MkdirAll(filepath.Join(repo.Path, "refs", "heads"), 0o777))
+	require.NoError(
+		t,
+		os.WriteFile(
+			filepath.Join(repo.Path, "refs", "heads", "new\nline"),
+			[]byte(oid.String()+"\n"),
+			0o666,
+		),
+	)
+
+	cmd := exec.Command(
+		sizerExe(t), "--show-refs", "--no-progress", "--json", "--json-version=2",
+		"--include=/refs/heads/caf.*/", "--include=refs/tags",
+	)
+	cmd.Dir = repo.Path
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	require.NoError(t, cmd.Run())
+
+	assert.Equal(
+		t,
+		"References (included references marked with '+'):\n"+
+			"+ refs/heads/caf\\xe9\n"+
+			"  refs/heads/master\n"+
+			"+ refs/tags/caf\xc3\xa9\n",
+		stderr.String(),
+	)
+
+	var v struct {
+		UniqueCommitCount struct {
+			Value int
+		}
+	}
+	require.NoError(t, json.Unmarshal(stdout.Bytes(), &v))
+	assert.EqualValues(t, 2, v.UniqueCommitCount.Value)
+}
+
+// TestColor tests the precedence of the color-related options and
+// environment variables. Since stdout is not a terminal, output is
+// uncolored unless something asks for color explicitly.
+func TestColor(t *testing.T) {
+	t.Parallel()
+
+	repo := testutils.NewTestRepo(t, true, "color")
+	t.Cleanup(func() { repo.Remove(t) })
+
+	newGitBomb(t, repo, 10, 10, "boom!\n")
+
+	executable := sizerExe(t)
+
+	for _, p := range []struct {
+		name     string
+		args     []string
+		env      []string
+		expected bool
+	}{
+		{name: "default"},
+		{name: "force-color", env: []string{"FORCE_COLOR=1"}, expected: true},
+		{name: "force-color-depth", env: []string{"FORCE_COLOR=3"}, expected: true},
+		{name: "force-color-zero", env: []string{"FORCE_COLOR=0"}},
+		{name: "no-color-env", env: []string{"NO_COLOR=1"}},
+		{name: "both-env", env: []string{"NO_COLOR=1", "FORCE_COLOR=1"}},
+		{name: "empty-no-color", env: []string{"NO_COLOR=", "FORCE_COLOR=1"}, expected: true},
+		{name: "always", args: []string{"--color=always"}, expected: true},
+		{name: "bare-color", args: []string{"--color"}, expected: true},
+		{name: "always-no-color-env", args: []string{"--color=always"}, env: []string{"NO_COLOR=1"}, expected: true},
+		{name: "never", args: []string{"--color=never"}},
+		{name: "never-force-color", args: []string{"--color=never"}, env: []string{"FORCE_COLOR=1"}},
+		{name: "no-color-force-color", args: []string{"--no-color"}, env: []string{"FORCE_COLOR=1"}},
+		{name: "auto-force-color", args: []string{"--color=auto"}, env: []string{"FORCE_COLOR=1"}, expected: true},
+		{name: "last-wins", args: []string{"--no-color", "--color=always"}, expected: true},
+		{name: "last-wins-no-color", args: []string{"--color=always", "--no-color"}},
+	} {
+		p := p
+		t.Run(
+			p.name,
+			func(t *testing.T) {
+				t.Parallel()
+
+				args := append([]string{"--no-progress"}, p.args...)
+				cmd := exec.Command(executable, args...)
+				cmd.Dir = repo.Path
+				cmd.Env = append(colorlessEnv(), p.env...)
+				var stdout bytes.Buffer
+				cmd.Stdout = &stdout
+				err := cmd.Run()
+				require.NoError(t, err)
+
+				assert.Contains(t, stdout.String(), "Maximum path depth")
+				assert.Equal(t, p.expected, strings.Contains(stdout.String(), "\x1b["))
+			},
+		)
+	}
+
+	t.Run(
+		"json",
+		func(t *testing.T) {
+			t.Parallel()
+
+			cmd := exec.Command(executable, "--no-progress", "--json", "--color=always")
+			cmd.Dir = repo.Path
+			cmd.Env = colorlessEnv()
+			output, err := cmd.Output()
+			require.NoError(t, err)
+			assert.NotContains(t, string(output), "\x1b[")
+		},
+	)
+}
+
+func TestEncoding(t *testing.T) {
+	t.Parallel()
+
+	repo := testutils.NewTestRepo(t, false, "encoding")
+	t.Cleanup(func() { repo.Remove(t) })
+
+	timestamp := time.Unix(1112911993, 0)
+	repo.AddFile(t, "größe.bin", strings.Repeat("x", 1000))
+	cmd := repo.GitCommand(t, "-c", "core.quotepath=false", "commit", "-m", "initial")
+	testutils.AddAuthorInfo(cmd, &timestamp)
+	require.NoError(t, cmd.Run(), "creating commit")
+
+	run := func(args ...string) []byte {
+		t.Helper()
+		cmd := exec.Command(sizerExe(t), append([]string{"--no-progress", "-v"}, args...)...)
+		cmd.Dir = repo.Path
+		cmd.Env = testutils.CleanGitEnv()
+		out, err := cmd.Output()
+		require.NoError(t, err, "running git-sizer %v", args)
+		return out
+	}
+
+	expected := string(run())
+	require.Contains(t, expected, "refs/heads/master:größe.bin")
+
+	decodeUTF16 := func(b []byte, order binary.ByteOrder) string {
+		t.Helper()
+		require.Equal(t, 0, len(b)%2)
+		units := make([]uint16, len(b)/2)
+		for i := range units {
+			units[i] = order.Uint16(b[2*i:])
+		}
+		return string(utf16.Decode(units))
+	}
+
+	out := run("--encoding=utf-16le", "--bom")
+	assert.Equal(t, []byte{0xff, 0xfe}, out[:2])
+	assert.Equal(t, expected, decodeUTF16(out[2:], binary.LittleEndian))
+
+	out = run("--encoding=UTF-16BE")
+	assert.Equal(t, expected, decodeUTF16(out, binary.BigEndian))
+
+	out = run("--encoding=iso-8859-1", "--bom")
+	assert.Contains(t, string(out), "refs/heads/master:gr\xf6\xdfe.bin")
+	// ISO-8859-1 has no byte-order mark:
+	assert.Equal(t, expected[0], out[0])
+
+	out = run("--bom")
+	assert.Equal(t, "\ufeff"+expected, string(out))
+
+	// JSON is always UTF-8:
+	out = run("--json", "--encoding=utf-16le", "--bom")
+	assert.True(t, bytes.HasPrefix(out, []byte("\xef\xbb\xbf{")))
+	assert.Contains(t, string(out), "größe.bin")
+
+	cmd = exec.Command(sizerExe(t), "--no-progress", "--encoding=ebcdic")
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	combined, err := cmd.CombinedOutput()
+	assert.Error(t, err)
+	assert.Contains(t, string(combined), "not a supported encoding")
+}
+
+// colorlessEnv returns the current environment, minus any variables
+// that affect whether git-sizer colorizes its output.
+func colorlessEnv() []string {
+	var env []string
+	for _, e := range os.Environ() {
+		if strings.HasPrefix(e, "NO_COLOR=") ||
+			strings.HasPrefix(e, "FORCE_COLOR=") ||
+			strings.HasPrefix(e, "TERM=") {
+			continue
+		}
+		env = append(env, e)
+	}
+	return env
+}
+
 func pow(x uint64, n int) uint64 {
 	p := uint64(1)
 	for ; n > 0; n-- {
@@ -565,6 +1010,7 @@ func TestBomb(t *testing.T) {
 	h, err := sizes.ScanRepositoryUsingGraph(
 		repo.Repository(t),
 		refGrouper{}, sizes.NameStyleFull, meter.NoProgressMeter,
+		sizes.ScanOptions{},
 	)
 	require.NoError(t, err)
 
@@ -607,6 +1053,11 @@ func TestBomb(t *testing.T) {
 	assert.Nil(t, h.MaxExpandedLinkCountTree, "max expanded link count tree")
 	assert.Equal(t, counts.Count32(0), h.MaxExpandedSubmoduleCount, "max expanded submodule count")
 	assert.Nil(t, h.MaxExpandedSubmoduleCountTree, "max expanded submodule count tree")
+
+	// The overflowed blob count is the most concerning statistic:
+	if assert.NotNil(t, h.Worst, "worst statistic") {
+		assert.Equal(t, "maxCheckoutBlobCount", h.Worst.Symbol)
+	}
 }
 
 func TestTaggedTags(t *testing.T) {
@@ -638,96 +1089,6974 @@ func TestTaggedTags(t *testing.T) {
 	h, err := sizes.ScanRepositoryUsingGraph(
 		repo.Repository(t),
 		refGrouper{}, sizes.NameStyleNone, meter.NoProgressMeter,
+		sizes.ScanOptions{},
 	)
 	require.NoError(t, err, "scanning repository")
 	assert.Equal(t, counts.Count32(3), h.MaxTagDepth, "tag depth")
+
+	if assert.NotNil(t, h.Worst, "worst statistic") {
+		assert.Equal(t, "maxTagDepth", h.Worst.Symbol)
+		assert.Equal(t, uint64(3), h.Worst.Value)
+		assert.InDelta(t, 3.0, h.Worst.LevelOfConcern, 0.01)
+	}
 }
 
-func TestFromSubdir(t *testing.T) {
+func TestTagObjects(t *testing.T) {
 	t.Parallel()
 
-	repo := testutils.NewTestRepo(t, false, "subdir")
-	defer repo.Remove(t)
+	repo := testutils.NewTestRepo(t, false, "tag-objects")
+	t.Cleanup(func() { repo.Remove(t) })
 
 	timestamp := time.Unix(1112911993, 0)
 
-	repo.AddFile(t, "subdir/file.txt", "Hello, world!\n")
+	cmd := repo.GitCommand(t, "commit", "-m", "initial", "--allow-empty")
+	testutils.AddAuthorInfo(cmd, &timestamp)
+	require.NoError(t, cmd.Run(), "creating commit")
+
+	tag := func(name, message string) git.OID {
+		t.Helper()
+		cmd := repo.GitCommand(t, "tag", "--cleanup=verbatim", "-m", message, name, "master")
+		testutils.AddAuthorInfo(cmd, &timestamp)
+		require.NoError(t, cmd.Run(), "creating tag %s", name)
+		out, err := repo.GitCommand(t, "rev-parse", "refs/tags/"+name).Output()
+		require.NoError(t, err)
+		oid, err := git.NewOID(strings.TrimSpace(string(out)))
+		require.NoError(t, err)
+		return oid
+	}
+
+	tag("v1.0", "Short\n")
+	long := tag("v2.0", strings.Repeat("Long release notes.\n", 100))
+	// Lightweight tags don't count:
+	require.NoError(t, repo.GitCommand(t, "tag", "light", "master").Run())
+
+	var totalSize uint64
+	for _, name := range []string{"v1.0", "v2.0"} {
+		out, err := repo.GitCommand(t, "cat-file", "-s", "refs/tags/"+name).Output()
+		require.NoError(t, err)
+		size, err := strconv.ParseUint(strings.TrimSpace(string(out)), 10, 64)
+		require.NoError(t, err)
+		totalSize += size
+	}
+
+	h, err := sizes.ScanRepositoryUsingGraph(
+		repo.Repository(t),
+		refGrouper{}, sizes.NameStyleFull, meter.NoProgressMeter,
+		sizes.ScanOptions{},
+	)
+	require.NoError(t, err, "scanning repository")
+
+	assert.Equal(t, counts.Count32(2), h.UniqueTagCount)
+	assert.Equal(t, counts.Count64(totalSize), h.UniqueTagSize)
+	assert.Equal(t, counts.Count32(2000), h.MaxTagMessageSize)
+	if assert.NotNil(t, h.MaxTagMessageTag) {
+		assert.Equal(t, long, h.MaxTagMessageTag.OID)
+		assert.Equal(t, "refs/tags/v2.0", h.MaxTagMessageTag.Path())
+	}
+	assert.Equal(t, counts.Count32(4), h.ReferenceCount)
+
+	cmd = exec.Command(sizerExe(t), "--no-progress", "-v", "--names=hash")
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	out, err := cmd.Output()
+	require.NoError(t, err, "running git-sizer")
+	assert.Regexp(t, `\|   \* Maximum message      \[(\d+)\] \|  1\.95 KiB \|`, string(out))
+	assert.Contains(t, string(out), "]  "+long.String()+"\n")
+	assert.NotContains(t, string(out), "refs/tags/v2.0")
+}
+
+func TestTagChains(t *testing.T) {
+	t.Parallel()
+
+	repo := testutils.NewTestRepo(t, false, "tag-chains")
+	t.Cleanup(func() { repo.Remove(t) })
+
+	timestamp := time.Unix(1112911993, 0)
 
+	repo.AddFile(t, "README", "Hello, world!\n")
 	cmd := repo.GitCommand(t, "commit", "-m", "initial")
 	testutils.AddAuthorInfo(cmd, &timestamp)
 	require.NoError(t, cmd.Run(), "creating commit")
 
+	tag := func(name, target string) {
+		t.Helper()
+		cmd := repo.GitCommand(t, "tag", "-m", name, name, target)
+		testutils.AddAuthorInfo(cmd, &timestamp)
+		require.NoError(t, cmd.Run(), "creating tag %s", name)
+	}
+
+	// A chain of 5 tags, of which only the outermost is referenced
+	// directly:
+	tag("chain-1", "master")
+	for i := 2; i <= 5; i++ {
+		tag(fmt.Sprintf("chain-%d", i), fmt.Sprintf("chain-%d", i-1))
+	}
+	for i := 1; i <= 4; i++ {
+		require.NoError(t, repo.GitCommand(t, "tag", "-d", fmt.Sprintf("chain-%d", i)).Run())
+	}
+
+	// Tags of a blob (which is bigger than any other blob) and of a
+	// tree, which can only be named via those tags:
+	blob := repo.CreateObject(t, "blob", func(w io.Writer) error {
+		_, err := io.WriteString(w, strings.Repeat("x", 1000))
+		return err
+	})
+	tag("blob-tag", blob.String())
+	tree := repo.CreateObject(t, "tree", func(w io.Writer) error {
+		_, err := fmt.Fprintf(w, "100644 big\x00%s", blob.Bytes())
+		return err
+	})
+	tag("tree-tag", tree.String())
+
 	h, err := sizes.ScanRepositoryUsingGraph(
 		repo.Repository(t),
-		refGrouper{}, sizes.NameStyleNone, meter.NoProgressMeter,
+		refGrouper{}, sizes.NameStyleFull, meter.NoProgressMeter,
+		sizes.ScanOptions{},
 	)
 	require.NoError(t, err, "scanning repository")
-	assert.Equal(t, counts.Count32(2), h.MaxPathDepth, "max path depth")
+
+	assert.Equal(t, counts.Count32(7), h.UniqueTagCount)
+	assert.Equal(t, counts.Count32(5), h.MaxTagDepth)
+	if assert.NotNil(t, h.MaxTagDepthTag) {
+		assert.Equal(t, "refs/tags/chain-5", h.MaxTagDepthTag.Path())
+	}
+	assert.Nil(t, h.Errors)
+
+	// The blob is found via the tree first, which is found via
+	// its tag:
+	assert.Equal(t, counts.Count32(1000), h.MaxBlobSize)
+	if assert.NotNil(t, h.MaxBlobSizeBlob) {
+		assert.Equal(t, blob, h.MaxBlobSizeBlob.OID)
+		assert.Contains(
+			t, []string{"refs/tags/blob-tag^{blob}", "refs/tags/tree-tag:big"},
+			h.MaxBlobSizeBlob.Path(),
+		)
+	}
+
+	for _, tc := range []struct {
+		names       string
+		description string
+	}{
+		{"full", "refs/tags/chain-5"},
+		{"hash", ""},
+	} {
+		tc := tc
+		t.Run(tc.names, func(t *testing.T) {
+			cmd := exec.Command(
+				sizerExe(t), "--no-progress", "--json", "--json-version=2",
+				"--names="+tc.names,
+			)
+			cmd.Dir = repo.Path
+			cmd.Env = testutils.CleanGitEnv()
+			out, err := cmd.Output()
+			require.NoError(t, err, "running git-sizer")
+
+			var v map[string]struct {
+				Value             uint64
+				ObjectName        string
+				ObjectDescription string
+			}
+			require.NoError(t, json.Unmarshal(out, &v))
+			assert.Equal(t, uint64(5), v["maxTagDepth"].Value)
+			assert.Equal(t, h.MaxTagDepthTag.OID.String(), v["maxTagDepth"].ObjectName)
+			assert.Equal(t, tc.description, v["maxTagDepth"].ObjectDescription)
+		})
+	}
 }
 
-func TestSubmodule(t *testing.T) {
+func TestJSONHumanValues(t *testing.T) {
 	t.Parallel()
 
-	tmp, err := ioutil.TempDir("", "submodule")
-	require.NoError(t, err, "creating temporary directory")
-
-	defer func() {
-		os.RemoveAll(tmp)
-	}()
+	repo := testutils.NewTestRepo(t, false, "json-human-values")
+	t.Cleanup(func() { repo.Remove(t) })
 
 	timestamp := time.Unix(1112911993, 0)
+	repo.AddFile(t, "big.bin", strings.Repeat("x", 123456))
+	repo.AddFile(t, "dir/small.txt", "Hello, world!\n")
+	cmd := repo.GitCommand(t, "commit", "-m", "initial")
+	testutils.AddAuthorInfo(cmd, &timestamp)
+	require.NoError(t, cmd.Run(), "creating commit")
 
-	submRepo := testutils.TestRepo{
-		Path: filepath.Join(tmp, "subm"),
+	run := func(args ...string) []byte {
+		t.Helper()
+		cmd := exec.Command(
+			sizerExe(t),
+			append([]string{"--no-progress", "-v", "--names=none", "--histograms"}, args...)...,
+		)
+		cmd.Dir = repo.Path
+		cmd.Env = testutils.CleanGitEnv()
+		out, err := cmd.Output()
+		require.NoError(t, err, "running git-sizer %v", args)
+		return out
 	}
-	submRepo.Init(t, false)
-	submRepo.AddFile(t, "submfile1.txt", "Hello, submodule!\n")
-	submRepo.AddFile(t, "submfile2.txt", "Hello again, submodule!\n")
-	submRepo.AddFile(t, "submfile3.txt", "Hello again, submodule!\n")
 
-	cmd := submRepo.GitCommand(t, "commit", "-m", "subm initial")
-	testutils.AddAuthorInfo(cmd, &timestamp)
-	require.NoError(t, cmd.Run(), "creating subm commit")
+	// The human-readable value of each row of the table, by label.
+	// Labels aren't unique (e.g., "Count"), so keep them all:
+	rows := make(map[string][]string)
+	for _, line := range strings.Split(string(run()), "\n") {
+		cols := strings.Split(line, "|")
+		if len(cols) != 5 {
+			continue
+		}
+		label := strings.TrimPrefix(strings.TrimSpace(cols[1]), "* ")
+		rows[label] = append(rows[label], strings.Join(strings.Fields(cols[2]), " "))
+	}
 
-	mainRepo := testutils.TestRepo{
-		Path: filepath.Join(tmp, "main"),
+	var items map[string]json.RawMessage
+	require.NoError(t, json.Unmarshal(run("--json", "--json-version=2"), &items))
+
+	checked := 0
+	for symbol, raw := range items {
+		var item struct {
+			Prefixes   *string
+			Quantity   string
+			HumanValue string
+			Label      string
+		}
+		if err := json.Unmarshal(raw, &item); err != nil || item.Prefixes == nil {
+			// Not a metric (e.g., "worst" or the histograms).
+			continue
+		}
+		assert.Contains(t, []string{"bytes", "count", "percent"}, item.Quantity, symbol)
+		assert.Contains(t, rows[item.Label], item.HumanValue, symbol)
+		checked++
 	}
-	mainRepo.Init(t, false)
+	assert.Greater(t, checked, 20)
 
-	mainRepo.AddFile(t, "mainfile.txt", "Hello, main!\n")
+	var bigBlob struct {
+		Quantity   string
+		HumanValue string
+		Label      string
+	}
+	require.NoError(t, json.Unmarshal(items["maxBlobSize"], &bigBlob))
+	assert.Equal(t, "bytes", bigBlob.Quantity)
+	assert.Equal(t, "121 KiB", bigBlob.HumanValue)
+	assert.Equal(t, "Maximum size", bigBlob.Label)
+}
 
-	cmd = mainRepo.GitCommand(t, "commit", "-m", "main initial")
-	testutils.AddAuthorInfo(cmd, &timestamp)
-	require.NoError(t, cmd.Run(), "creating main commit")
+func TestJSONObjects(t *testing.T) {
+	t.Parallel()
 
-	// Make subm a submodule of main:
-	cmd = mainRepo.GitCommand(t, "submodule", "add", submRepo.Path, "sub")
-	cmd.Dir = mainRepo.Path
-	require.NoError(t, cmd.Run(), "adding submodule")
+	repo := testutils.NewTestRepo(t, false, "json-objects")
+	t.Cleanup(func() { repo.Remove(t) })
 
-	cmd = mainRepo.GitCommand(t, "commit", "-m", "add submodule")
+	timestamp := time.Unix(1112911993, 0)
+	repo.AddFile(t, "dir/big.bin", strings.Repeat("x", 5000))
+	repo.AddFile(t, "small.txt", "Hello, world!\n")
+	cmd := repo.GitCommand(t, "commit", "-m", "initial")
 	testutils.AddAuthorInfo(cmd, &timestamp)
-	require.NoError(t, cmd.Run(), "committing submodule to main")
+	require.NoError(t, cmd.Run(), "creating commit")
 
-	// Analyze the main repo:
-	h, err := sizes.ScanRepositoryUsingGraph(
-		mainRepo.Repository(t),
-		refGrouper{}, sizes.NameStyleNone, meter.NoProgressMeter,
-	)
-	require.NoError(t, err, "scanning repository")
-	assert.Equal(t, counts.Count32(2), h.UniqueBlobCount, "unique blob count")
-	assert.Equal(t, counts.Count32(2), h.MaxExpandedBlobCount, "max expanded blob count")
-	assert.Equal(t, counts.Count32(1), h.MaxExpandedSubmoduleCount, "max expanded submodule count")
+	run := func(args ...string) []byte {
+		t.Helper()
+		cmd := exec.Command(sizerExe(t), append([]string{"--no-progress", "-v", "--json"}, args...)...)
+		cmd.Dir = repo.Path
+		cmd.Env = testutils.CleanGitEnv()
+		out, err := cmd.Output()
+		require.NoError(t, err, "running git-sizer %v", args)
+		return out
+	}
 
-	// Analyze the submodule:
-	submRepo2 := testutils.TestRepo{
-		Path: filepath.Join(mainRepo.Path, "sub"),
+	type object struct {
+		OID  string
+		Type string
+		Size uint64
+		Path string
+		Ref  string
 	}
-	h, err = sizes.ScanRepositoryUsingGraph(
-		submRepo2.Repository(t),
-		refGrouper{}, sizes.NameStyleNone, meter.NoProgressMeter,
-	)
-	require.NoError(t, err, "scanning repository")
-	assert.Equal(t, counts.Count32(2), h.UniqueBlobCount, "unique blob count")
+	var output struct {
+		Objects     map[string]object
+		MaxBlobSize struct {
+			ObjectName        string
+			ObjectDescription string
+			ObjectKey         string
+		}
+		MaxTreeEntries struct {
+			ObjectKey string
+		}
+		MaxCheckoutBlobCount struct {
+			ObjectKey string
+		}
+	}
+	require.NoError(t, json.Unmarshal(run("--json-version=2"), &output))
+
+	// The display strings are still there:
+	assert.Equal(t, "refs/heads/master:dir/big.bin", output.MaxBlobSize.ObjectDescription)
+
+	blob, ok := output.Objects[output.MaxBlobSize.ObjectKey]
+	require.True(t, ok, "the largest blob is in the objects table")
+	assert.Equal(t, output.MaxBlobSize.ObjectName, blob.OID)
+	assert.Equal(t, object{blob.OID, "blob", 5000, "dir/big.bin", "refs/heads/master"}, blob)
+
+	// Statistics that name the same object share its entry:
+	assert.Equal(t, output.MaxTreeEntries.ObjectKey, output.MaxCheckoutBlobCount.ObjectKey)
+	tree := output.Objects[output.MaxTreeEntries.ObjectKey]
+	assert.Equal(t, "tree", tree.Type)
+	assert.Equal(t, "", tree.Path)
+	assert.Equal(t, "refs/heads/master", tree.Ref)
+	assert.Len(t, output.Objects, 3)
+
+	// Version 1 and unnamed objects get no table:
+	var v1 map[string]interface{}
+	require.NoError(t, json.Unmarshal(run("--json-version=1"), &v1))
+	assert.NotContains(t, v1, "objects")
+	var unnamed map[string]interface{}
+	require.NoError(t, json.Unmarshal(run("--json-version=2", "--names=none"), &unnamed))
+	assert.NotContains(t, unnamed, "objects")
+}
+
+func TestFromSubdir(t *testing.T) {
+	t.Parallel()
+
+	repo := testutils.NewTestRepo(t, false, "subdir")
+	defer repo.Remove(t)
+
+	timestamp := time.Unix(1112911993, 0)
+
+	repo.AddFile(t, "subdir/file.txt", "Hello, world!\n")
+
+	cmd := repo.GitCommand(t, "commit", "-m", "initial")
+	testutils.AddAuthorInfo(cmd, &timestamp)
+	require.NoError(t, cmd.Run(), "creating commit")
+
+	h, err := sizes.ScanRepositoryUsingGraph(
+		repo.Repository(t),
+		refGrouper{}, sizes.NameStyleNone, meter.NoProgressMeter,
+		sizes.ScanOptions{},
+	)
+	require.NoError(t, err, "scanning repository")
+	assert.Equal(t, counts.Count32(2), h.MaxPathDepth, "max path depth")
+}
+
+func TestCorruptObjects(t *testing.T) {
+	t.Parallel()
+
+	repo := testutils.NewTestRepo(t, false, "corrupt")
+	t.Cleanup(func() { repo.Remove(t) })
+
+	timestamp := time.Unix(1112911993, 0)
+
+	repo.AddFile(t, "present.txt", "Hello, world!\n")
+	repo.AddFile(t, "missing.txt", "Goodbye, cruel world!\n")
+
+	cmd := repo.GitCommand(t, "commit", "-m", "initial")
+	testutils.AddAuthorInfo(cmd, &timestamp)
+	require.NoError(t, cmd.Run(), "creating commit")
+
+	// Delete the loose object for one of the blobs:
+	out, err := repo.GitCommand(t, "rev-parse", "HEAD:missing.txt").Output()
+	require.NoError(t, err)
+	missingOID := strings.TrimSpace(string(out))
+	require.NoError(
+		t,
+		os.Remove(filepath.Join(repo.Path, ".git", "objects", missingOID[:2], missingOID[2:])),
+	)
+
+	h, err := sizes.ScanRepositoryUsingGraph(
+		repo.Repository(t),
+		refGrouper{}, sizes.NameStyleFull, meter.NoProgressMeter,
+		sizes.ScanOptions{},
+	)
+	require.NoError(t, err, "scanning repository")
+	assert.Equal(t, counts.Count32(1), h.UniqueBlobCount, "unique blob count")
+	assert.Equal(t, counts.Count32(1), h.UniqueCommitCount, "unique commit count")
+	if assert.NotNil(t, h.Errors) {
+		assert.Equal(t, counts.Count32(1), h.Errors.Count)
+		assert.Equal(t, counts.Count32(1), h.Errors.MissingCount)
+		assert.Equal(t, counts.Count32(0), h.Errors.UnknownTypeCount)
+		assert.Equal(t, counts.Count32(0), h.Errors.MalformedCount)
+		if assert.Len(t, h.Errors.Objects, 1) {
+			assert.Equal(t, missingOID, h.Errors.Objects[0].OID.String())
+		}
+	}
+
+	_, err = sizes.ScanRepositoryUsingGraph(
+		repo.Repository(t),
+		refGrouper{}, sizes.NameStyleFull, meter.NoProgressMeter,
+		sizes.ScanOptions{Strict: true},
+	)
+	assert.Error(t, err, "strict scan")
+
+	executable := sizerExe(t)
+
+	for _, p := range []struct {
+		name             string
+		args             []string
+		expectedExitCode int
+		expectedOutput   string
+	}{
+		{
+			name:             "table",
+			args:             []string{"--no-progress"},
+			expectedExitCode: 5,
+			expectedOutput:   "Corruption encountered: 1 object(s) could not be read",
+		},
+		{
+			name:             "table-row",
+			args:             []string{"--no-progress"},
+			expectedExitCode: 5,
+			expectedOutput:   "|   * Missing                  |     1     | *                              |",
+		},
+		{
+			name:             "json",
+			args:             []string{"--no-progress", "--json", "--json-version=2"},
+			expectedExitCode: 5,
+			expectedOutput:   `"errors": {`,
+		},
+		{
+			name:             "strict",
+			args:             []string{"--no-progress", "--strict"},
+			expectedExitCode: 1,
+		},
+	} {
+		p := p
+		t.Run(
+			p.name,
+			func(t *testing.T) {
+				t.Parallel()
+
+				cmd := exec.Command(executable, p.args...)
+				cmd.Dir = repo.Path
+				var stdout bytes.Buffer
+				cmd.Stdout = &stdout
+				err := cmd.Run()
+
+				var exitErr *exec.ExitError
+				if assert.ErrorAs(t, err, &exitErr) {
+					assert.Equal(t, p.expectedExitCode, exitErr.ExitCode())
+				}
+				assert.Contains(t, stdout.String(), p.expectedOutput)
+				if p.expectedOutput != "" {
+					assert.Contains(t, stdout.String(), missingOID)
+				}
+			},
+		)
+	}
+}
+
+func TestAttributes(t *testing.T) {
+	t.Parallel()
+
+	repo := testutils.NewTestRepo(t, false, "attributes")
+	t.Cleanup(func() { repo.Remove(t) })
+
+	timestamp := time.Unix(1112911993, 0)
+
+	repo.AddFile(t, ".gitattributes", "*.bin binary\n*.psd diff=lfs\n")
+	repo.AddFile(t, "a.bin", "a")
+	repo.AddFile(t, "sub/b.bin", "b")
+	repo.AddFile(t, "c.psd", "c")
+	repo.AddFile(t, "d.txt", "d")
+
+	cmd := repo.GitCommand(t, "commit", "-m", "initial")
+	testutils.AddAuthorInfo(cmd, &timestamp)
+	require.NoError(t, cmd.Run(), "creating commit")
+
+	// Attributes are read from the committed tree, not the working
+	// tree or index:
+	repo.AddFile(t, ".gitattributes", "*.txt binary\n")
+
+	ac, err := sizes.CountAttributes(context.Background(), repo.Repository(t), "HEAD")
+	require.NoError(t, err)
+	assert.Equal(t, counts.Count32(5), ac.BlobCount, "blob count")
+	assert.Equal(t, counts.Count32(2), ac.UnattributedBlobCount, "unattributed blob count")
+	assert.Equal(t, counts.Count32(2), ac.Counts["binary"], "binary")
+	assert.Equal(t, counts.Count32(2), ac.Counts["-text"], "-text")
+	assert.Equal(t, counts.Count32(1), ac.Counts["diff=lfs"], "diff=lfs")
+
+	_, err = sizes.CountAttributes(context.Background(), repo.Repository(t), "no-such-ref")
+	assert.Error(t, err)
+}
+
+func TestArchiveSize(t *testing.T) {
+	t.Parallel()
+
+	repo := testutils.NewTestRepo(t, false, "archive-size")
+	t.Cleanup(func() { repo.Remove(t) })
+
+	timestamp := time.Unix(1112911993, 0)
+
+	attributes := "docs export-ignore\n*.test export-ignore\n"
+	repo.AddFile(t, ".gitattributes", attributes)
+	repo.AddFile(t, "main.go", strings.Repeat("m", 500))
+	repo.AddFile(t, "x.test", strings.Repeat("x", 50))
+	// Everything under an ignored directory is ignored:
+	repo.AddFile(t, "docs/a.md", strings.Repeat("a", 100))
+	repo.AddFile(t, "docs/sub/b.md", strings.Repeat("b", 200))
+
+	cmd := repo.GitCommand(t, "commit", "-m", "initial")
+	testutils.AddAuthorInfo(cmd, &timestamp)
+	require.NoError(t, cmd.Run(), "creating commit")
+
+	as, err := sizes.ComputeArchiveSize(context.Background(), repo.Repository(t), "HEAD")
+	require.NoError(t, err)
+	assert.Equal(t, counts.Count32(2), as.BlobCount)
+	assert.Equal(t, counts.Count64(500+len(attributes)), as.BlobSize)
+	assert.Equal(t, counts.Count32(3), as.IgnoredBlobCount)
+	assert.Equal(t, counts.Count64(350), as.IgnoredBlobSize)
+	assert.Equal(t, counts.Count32(0), as.LookupFailureCount)
+
+	// Check against what `git archive` actually includes:
+	out, err := repo.GitCommand(t, "archive", "--format=zip", "-0", "HEAD").Output()
+	require.NoError(t, err)
+	zr, err := zip.NewReader(bytes.NewReader(out), int64(len(out)))
+	require.NoError(t, err)
+	var files int
+	for _, f := range zr.File {
+		if !strings.HasSuffix(f.Name, "/") {
+			files++
+		}
+	}
+	assert.Equal(t, int(as.BlobCount), files)
+
+	// The report is shown whatever the threshold:
+	cmd = exec.Command(sizerExe(t), "--no-progress", "--archive-size")
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err = cmd.Output()
+	require.NoError(t, err, "running git-sizer")
+	assert.Contains(
+		t, string(out),
+		"\nFiles in 'git archive HEAD':\n\n"+
+			"    Files                          Count        Size\n"+
+			"    Archived                           2       540 B\n"+
+			"    Left out (export-ignore)           3       350 B\n",
+	)
+	assert.Equal(t, "", stderr.String())
+
+	cmd = exec.Command(sizerExe(t), "--no-progress", "--archive-size", "--json", "--json-version=2")
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	out, err = cmd.Output()
+	require.NoError(t, err, "running git-sizer")
+	var j struct {
+		Archive map[string]interface{} `json:"archive"`
+	}
+	require.NoError(t, json.Unmarshal(out, &j))
+	assert.Equal(t, "HEAD", j.Archive["rev"])
+	assert.Equal(t, 2.0, j.Archive["blobCount"])
+	assert.Equal(t, 540.0, j.Archive["blobSize"])
+	assert.Equal(t, 3.0, j.Archive["ignoredBlobCount"])
+}
+
+func TestClassifyAttr(t *testing.T) {
+	t.Parallel()
+
+	repo := testutils.NewTestRepo(t, false, "classify-attr")
+	t.Cleanup(func() { repo.Remove(t) })
+
+	timestamp := time.Unix(1112911993, 0)
+	commit := func(msg string) {
+		t.Helper()
+		cmd := repo.GitCommand(t, "commit", "-m", msg)
+		testutils.AddAuthorInfo(cmd, &timestamp)
+		require.NoError(t, cmd.Run(), "creating commit")
+	}
+
+	repo.AddFile(
+		t, ".gitattributes",
+		"gen/** linguist-generated\ngen/keep.go linguist-generated=false\n",
+	)
+	repo.AddFile(t, "gen/old.go", strings.Repeat("o", 3000))
+	commit("initial")
+
+	// "gen/old.go" is only in the history, but it is classified
+	// using the attributes in HEAD:
+	cmd := repo.GitCommand(t, "rm", "-q", "gen/old.go")
+	require.NoError(t, cmd.Run(), "removing file")
+	repo.AddFile(t, "gen/api.go", strings.Repeat("a", 2000))
+	repo.AddFile(t, "gen/keep.go", strings.Repeat("k", 1000))
+	repo.AddFile(t, "main.go", strings.Repeat("m", 500))
+	commit("regenerate")
+
+	h, err := sizes.ScanRepositoryUsingGraph(
+		repo.Repository(t),
+		refGrouper{}, sizes.NameStyleFull, meter.NoProgressMeter,
+		sizes.ScanOptions{TopBlobs: 4},
+	)
+	require.NoError(t, err, "scanning repository")
+	require.NotNil(t, h.TopBlobs)
+	assert.Equal(t, "gen/api.go", h.TopBlobs.Blobs[1].Path)
+
+	as, err := sizes.ClassifyTopBlobs(
+		context.Background(), repo.Repository(t), "HEAD", "linguist-generated", h.TopBlobs,
+	)
+	require.NoError(t, err)
+	assert.Equal(
+		t, sizes.AttributeBucket{BlobCount: 2, BlobSize: 5000}, as.True, "generated",
+	)
+	assert.Equal(
+		t, sizes.AttributeBucket{BlobCount: 2, BlobSize: 1500}, as.False, "not generated",
+	)
+	assert.Equal(t, counts.Count32(0), as.Unknown.BlobCount)
+
+	cmd = exec.Command(
+		sizerExe(t), "--no-progress", "--json", "--json-version=2",
+		"--top=4", "--classify-attr=linguist-generated",
+	)
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	out, err := cmd.Output()
+	require.NoError(t, err, "running git-sizer")
+	var j struct {
+		TopBlobsByAttribute struct {
+			Attr string `json:"attr"`
+			True struct {
+				BlobSize counts.Count64 `json:"blobSize"`
+			} `json:"true"`
+		} `json:"topBlobsByAttribute"`
+	}
+	require.NoError(t, json.Unmarshal(out, &j))
+	assert.Equal(t, "linguist-generated", j.TopBlobsByAttribute.Attr)
+	assert.Equal(t, counts.Count64(5000), j.TopBlobsByAttribute.True.BlobSize)
+
+	cmd = exec.Command(sizerExe(t), "--no-progress", "--classify-attr=linguist-generated")
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	out, err = cmd.CombinedOutput()
+	assert.Error(t, err)
+	assert.Contains(t, string(out), "--classify-attr requires --top")
+}
+
+func TestClassify(t *testing.T) {
+	t.Parallel()
+
+	repo := testutils.NewTestRepo(t, false, "classify")
+	t.Cleanup(func() { repo.Remove(t) })
+
+	timestamp := time.Unix(1112911993, 0)
+	commit := func(msg string) {
+		t.Helper()
+		cmd := repo.GitCommand(t, "commit", "-m", msg)
+		testutils.AddAuthorInfo(cmd, &timestamp)
+		require.NoError(t, cmd.Run(), "creating commit")
+	}
+	classify := func() *sizes.RepoType {
+		t.Helper()
+		rt, err := sizes.ClassifyRepository(
+			context.Background(), repo.Repository(t), "HEAD", &sizes.HistorySize{},
+		)
+		require.NoError(t, err)
+		return rt
+	}
+
+	repo.AddFile(t, "README.md", "readme\n")
+	repo.AddFile(t, "guide/intro.md", "intro\n")
+	repo.AddFile(t, "guide/usage.rst", "usage\n")
+	repo.AddFile(t, "LICENSE", "license\n")
+	commit("docs")
+	rt := classify()
+	assert.Equal(t, sizes.RepoTypeDocumentation, rt.Label)
+	assert.InDelta(t, 0.75, rt.Confidence, 0.001)
+	assert.Equal(t, counts.Count32(4), rt.FileCount)
+
+	for i := 0; i < 4; i++ {
+		repo.AddFile(t, fmt.Sprintf("src/file%d.go", i), "package src\n")
+	}
+	commit("code")
+	rt = classify()
+	assert.Equal(t, sizes.RepoTypeSourceCode, rt.Label)
+	assert.InDelta(t, 0.5, rt.Confidence, 0.001)
+	assert.Equal(t, sizes.FileKindShare{Count: 4, Size: 48}, rt.Kinds["code"])
+
+	for i := 0; i < 5; i++ {
+		repo.AddFile(t, fmt.Sprintf("services/s%d/go.mod", i), "module s\n")
+	}
+	commit("services")
+	rt = classify()
+	assert.Equal(t, sizes.RepoTypeMonorepo, rt.Label)
+	assert.Equal(t, counts.Count32(5), rt.ManifestCount)
+	assert.InDelta(t, 0.625, rt.Confidence, 0.001)
+
+	repo.AddFile(t, "assets/logo.png", strings.Repeat("p", 1000))
+	commit("assets")
+	rt = classify()
+	assert.Equal(t, sizes.RepoTypeAssetHeavy, rt.Label)
+	assert.Equal(t, sizes.FileKindShare{Count: 1, Size: 1000}, rt.Kinds["assets"])
+
+	cmd := exec.Command(sizerExe(t), "--no-progress", "--classify")
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	out, err := cmd.Output()
+	require.NoError(t, err, "running git-sizer")
+	assert.Contains(t, string(out), "Repository type: asset-heavy (confidence")
+	assert.Regexp(t, `\n    assets +1 +1000 B\n`, string(out))
+
+	cmd = exec.Command(sizerExe(t), "--no-progress", "--json", "--json-version=2", "--classify")
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	out, err = cmd.Output()
+	require.NoError(t, err, "running git-sizer")
+	var j struct {
+		RepoType struct {
+			Label     string         `json:"label"`
+			Rev       string         `json:"rev"`
+			FileCount counts.Count32 `json:"fileCount"`
+		} `json:"repoType"`
+	}
+	require.NoError(t, json.Unmarshal(out, &j))
+	assert.Equal(t, sizes.RepoTypeAssetHeavy, j.RepoType.Label)
+	assert.Equal(t, "HEAD", j.RepoType.Rev)
+	assert.Equal(t, counts.Count32(14), j.RepoType.FileCount)
+}
+
+func TestDuplicateNames(t *testing.T) {
+	t.Parallel()
+
+	repo := testutils.NewTestRepo(t, false, "duplicate-names")
+	t.Cleanup(func() { repo.Remove(t) })
+
+	timestamp := time.Unix(1112911993, 0)
+	for i := 0; i < 3; i++ {
+		repo.AddFile(t, fmt.Sprintf("pkg%d/index.js", i), fmt.Sprintf("%d\n", i))
+	}
+	repo.AddFile(t, "a/README", "a\n")
+	repo.AddFile(t, "b/README", "b\n")
+	repo.AddFile(t, "main.go", "package main\n")
+	cmd := repo.GitCommand(t, "commit", "-m", "initial")
+	testutils.AddAuthorInfo(cmd, &timestamp)
+	require.NoError(t, cmd.Run(), "creating commit")
+
+	dn, err := sizes.FindDuplicateNames(context.Background(), repo.Repository(t), "HEAD", 10)
+	require.NoError(t, err)
+	assert.Equal(t, counts.Count32(6), dn.FileCount)
+	assert.Equal(t, counts.Count32(3), dn.DistinctNameCount)
+	assert.Equal(
+		t,
+		[]sizes.DuplicateName{
+			{Name: "index.js", PathCount: 3, ExamplePath: "pkg0/index.js"},
+			{Name: "README", PathCount: 2, ExamplePath: "a/README"},
+		},
+		dn.Names,
+	)
+
+	dn, err = sizes.FindDuplicateNames(context.Background(), repo.Repository(t), "HEAD", 1)
+	require.NoError(t, err)
+	assert.Len(t, dn.Names, 1)
+
+	cmd = exec.Command(sizerExe(t), "--no-progress", "--duplicate-names=5")
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	out, err := cmd.Output()
+	require.NoError(t, err, "running git-sizer")
+	assert.Contains(
+		t, string(out),
+		"\nMost duplicated file names in HEAD (6 files, 3 distinct names):\n\n"+
+			"           3 paths  index.js (e.g., pkg0/index.js)\n"+
+			"           2 paths  README (e.g., a/README)\n",
+	)
+}
+
+func TestLFSCandidates(t *testing.T) {
+	t.Parallel()
+
+	repo := testutils.NewTestRepo(t, false, "lfs-candidates")
+	t.Cleanup(func() { repo.Remove(t) })
+
+	timestamp := time.Unix(1112911993, 0)
+	commit := func(msg string) {
+		t.Helper()
+		cmd := repo.GitCommand(t, "commit", "-m", msg)
+		testutils.AddAuthorInfo(cmd, &timestamp)
+		require.NoError(t, cmd.Run(), "creating commit")
+	}
+
+	// Only the filter attribute matters; a file that is merely
+	// diffed like an LFS pointer isn't in LFS:
+	repo.AddFile(
+		t, ".gitattributes",
+		"*.psd filter=lfs diff=lfs merge=lfs -text\n*.zip diff=lfs\n",
+	)
+	repo.AddFile(t, "art/logo.psd", strings.Repeat("p", 4000))
+	repo.AddFile(t, "dist/release.zip", strings.Repeat("z", 3000))
+	repo.AddFile(t, "data/dump.sql", strings.Repeat("d", 2000))
+	repo.AddFile(t, "main.go", strings.Repeat("m", 500))
+	commit("initial")
+
+	h, err := sizes.ScanRepositoryUsingGraph(
+		repo.Repository(t),
+		refGrouper{}, sizes.NameStyleFull, meter.NoProgressMeter,
+		sizes.ScanOptions{TopBlobs: 3},
+	)
+	require.NoError(t, err, "scanning repository")
+
+	lc, err := sizes.FindLFSCandidates(
+		context.Background(), repo.Repository(t), "HEAD", h.TopBlobs,
+	)
+	require.NoError(t, err)
+	assert.Equal(t, counts.Count32(3), lc.CheckedCount)
+	assert.Equal(t, counts.Count32(1), lc.LFSCount)
+	if assert.Len(t, lc.Blobs, 2) {
+		assert.Equal(t, "dist/release.zip", lc.Blobs[0].Path)
+		assert.Equal(t, "data/dump.sql", lc.Blobs[1].Path)
+	}
+	assert.Equal(t, counts.Count64(5000), lc.BlobSize)
+
+	run := func(args ...string) (string, error) {
+		cmd := exec.Command(sizerExe(t), append([]string{"--no-progress"}, args...)...)
+		cmd.Dir = repo.Path
+		cmd.Env = testutils.CleanGitEnv()
+		out, err := cmd.CombinedOutput()
+		return string(out), err
+	}
+
+	// Only the list is output:
+	out, err := run("--lfs-candidates", "--top=3")
+	require.NoError(t, err, "running git-sizer: %s", out)
+	assert.True(t, strings.HasPrefix(out, "Large blobs not stored in LFS"), out)
+	assert.Contains(t, out, "dist/release.zip\n")
+	assert.Contains(t, out, "data/dump.sql\n")
+	assert.NotContains(t, out, "logo.psd")
+	assert.Contains(t, out, "Total: 4.88 KiB\n")
+
+	// By default, the ten largest blobs are checked:
+	out, err = run("--lfs-candidates", "--json")
+	require.NoError(t, err, "running git-sizer: %s", out)
+	var j struct {
+		CheckedCount int `json:"checked_count"`
+		Blobs        []struct {
+			Path string `json:"path"`
+		} `json:"blobs"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(out), &j))
+	assert.Equal(t, 5, j.CheckedCount)
+	assert.Len(t, j.Blobs, 4)
+
+	out, err = run("--lfs-candidates", "--names=hash")
+	assert.Error(t, err)
+	assert.Contains(t, out, "--lfs-candidates requires --names=full")
+}
+
+func TestLFSSizes(t *testing.T) {
+	t.Parallel()
+
+	repo := testutils.NewTestRepo(t, false, "lfs-sizes")
+	t.Cleanup(func() { repo.Remove(t) })
+
+	timestamp := time.Unix(1112911993, 0)
+	commit := func(msg string) {
+		t.Helper()
+		cmd := repo.GitCommand(t, "commit", "-m", msg)
+		testutils.AddAuthorInfo(cmd, &timestamp)
+		require.NoError(t, cmd.Run(), "creating commit")
+	}
+
+	pointer := func(oid string, size int) string {
+		return fmt.Sprintf(
+			"version https://git-lfs.github.com/spec/v1\noid sha256:%s\nsize %d\n",
+			oid, size,
+		)
+	}
+	oid1 := strings.Repeat("1", 64)
+	oid2 := strings.Repeat("2", 64)
+
+	repo.AddFile(t, "art/logo.psd", pointer(oid1, 100000))
+	repo.AddFile(t, "art/intro.mp4", pointer(oid2, 2000000))
+	repo.AddFile(t, "main.go", strings.Repeat("m", 500))
+	// Not a valid pointer, because it lacks the size:
+	repo.AddFile(
+		t, "broken.psd",
+		"version https://git-lfs.github.com/spec/v1\noid sha256:"+oid1+"\n",
+	)
+	commit("initial")
+
+	// A second pointer to the same LFS object isn't counted again:
+	repo.AddFile(t, "art/logo-copy.psd", pointer(oid1, 100000)+"ext-0-foo sha256:"+oid2+"\n")
+	commit("copy logo")
+
+	// Only the first object is present locally:
+	dir := filepath.Join(repo.Path, ".git", "lfs", "objects", oid1[0:2], oid1[2:4])
+	require.NoError(t, os.MkdirAll(dir, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, oid1), []byte("logo"), 0o644))
+
+	ls, err := sizes.ComputeLFSSizes(context.Background(), repo.Repository(t), refGrouper{})
+	require.NoError(t, err)
+
+	pointerSize := len(pointer(oid1, 100000)) + len(pointer(oid2, 2000000)) +
+		len(pointer(oid1, 100000)+"ext-0-foo sha256:"+oid2+"\n")
+	blobSize := pointerSize + 500 + len(pointer(oid1, 0)) - len("size 0\n")
+	assert.Equal(t, counts.Count32(5), ls.BlobCount)
+	assert.Equal(t, counts.Count64(blobSize), ls.BlobSize)
+	assert.Equal(t, counts.Count32(3), ls.PointerCount)
+	assert.Equal(t, counts.Count64(pointerSize), ls.PointerSize)
+	assert.Equal(t, counts.Count32(2), ls.ObjectCount)
+	assert.Equal(t, counts.Count64(2100000), ls.ObjectSize)
+	assert.Equal(t, counts.Count32(1), ls.LocalObjectCount)
+	assert.Equal(t, counts.Count64(100000), ls.LocalObjectSize)
+	assert.Equal(t, counts.Count64(blobSize-pointerSize+2100000), ls.ContentSize)
+
+	cmd := exec.Command(
+		sizerExe(t), "--no-progress", "--json", "--json-version=2",
+		"--include-gitattributes-lfs-size",
+	)
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	out, err := cmd.Output()
+	require.NoError(t, err, "running git-sizer")
+	var j struct {
+		LFSSizes struct {
+			BlobCount        counts.Count32 `json:"blobCount"`
+			BlobSize         counts.Count64 `json:"blobSize"`
+			PointerCount     counts.Count32 `json:"pointerCount"`
+			PointerSize      counts.Count64 `json:"pointerSize"`
+			ObjectCount      counts.Count32 `json:"objectCount"`
+			ObjectSize       counts.Count64 `json:"objectSize"`
+			LocalObjectCount counts.Count32 `json:"localObjectCount"`
+			LocalObjectSize  counts.Count64 `json:"localObjectSize"`
+			ContentSize      counts.Count64 `json:"contentSize"`
+		} `json:"lfsSizes"`
+	}
+	require.NoError(t, json.Unmarshal(out, &j))
+	assert.Equal(t, *ls, sizes.LFSSizes(j.LFSSizes))
+}
+
+func TestBlameTopBlob(t *testing.T) {
+	t.Parallel()
+
+	repo := testutils.NewTestRepo(t, false, "blame")
+	t.Cleanup(func() { repo.Remove(t) })
+
+	timestamp := time.Unix(1112911993, 0)
+
+	commit := func(msg string) {
+		t.Helper()
+		cmd := repo.GitCommand(t, "commit", "-m", msg)
+		testutils.AddAuthorInfo(cmd, &timestamp)
+		require.NoError(t, cmd.Run(), "creating commit")
+	}
+
+	repo.AddFile(t, "big.bin", strings.Repeat("a", 1000))
+	repo.AddFile(t, "small.txt", "small\n")
+	commit("add big")
+
+	cmd := repo.GitCommand(t, "mv", "big.bin", "big.dat")
+	require.NoError(t, cmd.Run(), "renaming file")
+	commit("rename big")
+
+	repo.AddFile(t, "big.dat", strings.Repeat("b", 2000))
+	commit("grow big")
+
+	repo.AddFile(t, "small.txt", "still small\n")
+	commit("unrelated")
+
+	h, err := sizes.ScanRepositoryUsingGraph(
+		repo.Repository(t),
+		refGrouper{}, sizes.NameStyleFull, meter.NoProgressMeter,
+		sizes.ScanOptions{},
+	)
+	require.NoError(t, err, "scanning repository")
+
+	tbh, err := sizes.BlameTopBlob(context.Background(), repo.Repository(t), &h)
+	require.NoError(t, err)
+	require.NotNil(t, tbh)
+	assert.Equal(t, "big.dat", tbh.Path)
+	assert.Equal(t, counts.Count32(2000), tbh.Size)
+	assert.Equal(t, counts.Count32(3), tbh.Count)
+	var subjects []string
+	for _, c := range tbh.Commits {
+		subjects = append(subjects, c.Subject)
+		assert.Equal(t, "Arthur <arthur@example.com>", c.Author)
+	}
+	assert.Equal(t, []string{"grow big", "rename big", "add big"}, subjects)
+
+	// The path can't be determined without full names:
+	h, err = sizes.ScanRepositoryUsingGraph(
+		repo.Repository(t),
+		refGrouper{}, sizes.NameStyleHash, meter.NoProgressMeter,
+		sizes.ScanOptions{},
+	)
+	require.NoError(t, err, "scanning repository")
+	_, err = sizes.BlameTopBlob(context.Background(), repo.Repository(t), &h)
+	assert.Error(t, err)
+}
+
+func TestRenames(t *testing.T) {
+	t.Parallel()
+
+	repo := testutils.NewTestRepo(t, false, "renames")
+	t.Cleanup(func() { repo.Remove(t) })
+
+	timestamp := time.Unix(1112911993, 0)
+	commit := func(msg string) {
+		t.Helper()
+		cmd := repo.GitCommand(t, "commit", "-m", msg)
+		testutils.AddAuthorInfo(cmd, &timestamp)
+		require.NoError(t, cmd.Run(), "creating commit")
+	}
+	run := func(args ...string) {
+		t.Helper()
+		cmd := repo.GitCommand(t, args...)
+		testutils.AddAuthorInfo(cmd, &timestamp)
+		require.NoError(t, cmd.Run(), "running git %s", strings.Join(args, " "))
+	}
+	lines := func(word string) string {
+		return strings.Repeat(word+"\n", 20)
+	}
+
+	repo.AddFile(t, "a.txt", lines("alpha"))
+	repo.AddFile(t, "d.txt", lines("delta"))
+	repo.AddFile(t, "g.txt", lines("gamma"))
+	commit("initial")
+
+	run("mv", "a.txt", "b.txt")
+	run("mv", "d.txt", "e.txt")
+	commit("rename a and d")
+
+	run("mv", "b.txt", "c.txt")
+	commit("rename b")
+
+	// A copy is only detected if its source was modified, too:
+	repo.AddFile(t, "copy.txt", lines("alpha"))
+	repo.AddFile(t, "c.txt", lines("alpha")+"more\n")
+	commit("copy c")
+
+	// A rename on a branch is counted once, not again for the merge:
+	run("checkout", "-q", "-b", "side")
+	run("mv", "g.txt", "h.txt")
+	commit("rename g")
+	run("checkout", "-q", "master")
+	run("merge", "-q", "--no-ff", "-m", "merge side", "side")
+
+	rs, err := sizes.CountRenames(context.Background(), repo.Repository(t), refGrouper{})
+	require.NoError(t, err)
+	assert.Equal(t, counts.Count32(4), rs.RenameCount)
+	assert.Equal(t, counts.Count32(1), rs.CopyCount)
+	assert.Equal(t, counts.Count32(4), rs.CommitCount)
+	assert.Equal(
+		t,
+		[]sizes.RenamedFile{
+			{Path: "c.txt", RenameCount: 2},
+			{Path: "e.txt", RenameCount: 1},
+			{Path: "h.txt", RenameCount: 1},
+		},
+		rs.MostRenamed,
+	)
+
+	cmd := exec.Command(sizerExe(t), "--no-progress", "--json", "--json-version=2", "--renames")
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	out, err := cmd.Output()
+	require.NoError(t, err, "running git-sizer")
+	var j struct {
+		Renames struct {
+			RenameCount counts.Count32 `json:"renameCount"`
+			CopyCount   counts.Count32 `json:"copyCount"`
+			CommitCount counts.Count32 `json:"commitCount"`
+			MostRenamed []struct {
+				Path        string         `json:"path"`
+				RenameCount counts.Count32 `json:"renameCount"`
+			} `json:"mostRenamed"`
+		} `json:"renames"`
+	}
+	require.NoError(t, json.Unmarshal(out, &j))
+	assert.Equal(t, rs.RenameCount, j.Renames.RenameCount)
+	assert.Equal(t, rs.CopyCount, j.Renames.CopyCount)
+	assert.Equal(t, rs.CommitCount, j.Renames.CommitCount)
+	if assert.Len(t, j.Renames.MostRenamed, len(rs.MostRenamed)) {
+		for i, rf := range rs.MostRenamed {
+			assert.Equal(t, rf, sizes.RenamedFile(j.Renames.MostRenamed[i]))
+		}
+	}
+}
+
+func TestSampleRate(t *testing.T) {
+	t.Parallel()
+
+	repo := testutils.NewTestRepo(t, false, "sample")
+	t.Cleanup(func() { repo.Remove(t) })
+
+	timestamp := time.Unix(1112911993, 0)
+
+	for i := 0; i < 20; i++ {
+		repo.AddFile(t, fmt.Sprintf("file%d.txt", i%3), fmt.Sprintf("version %d\n", i))
+		cmd := repo.GitCommand(t, "commit", "-m", fmt.Sprintf("commit %d", i))
+		testutils.AddAuthorInfo(cmd, &timestamp)
+		require.NoError(t, cmd.Run(), "creating commit")
+	}
+
+	h, err := sizes.ScanRepositoryUsingGraph(
+		repo.Repository(t),
+		refGrouper{}, sizes.NameStyleFull, meter.NoProgressMeter,
+		sizes.ScanOptions{SampleRate: 0.25},
+	)
+	require.NoError(t, err, "scanning repository")
+
+	// These are computed exactly even when sampling:
+	assert.Equal(t, counts.Count32(20), h.UniqueCommitCount, "unique commit count")
+	assert.Equal(t, counts.Count32(20), h.MaxHistoryDepth, "max history depth")
+	assert.Equal(t, counts.Count32(1), h.MaxParentCount, "max parent count")
+
+	if assert.NotNil(t, h.Sample) {
+		assert.Equal(t, counts.Count32(20), h.Sample.CommitCount)
+		assert.Equal(t, counts.Count32(5), h.Sample.SampledCommitCount)
+	}
+	// Only the trees of the sampled commits were scanned:
+	assert.Equal(t, counts.Count32(5), h.UniqueTreeCount, "unique tree count")
+
+	full, err := sizes.ScanRepositoryUsingGraph(
+		repo.Repository(t),
+		refGrouper{}, sizes.NameStyleFull, meter.NoProgressMeter,
+		sizes.ScanOptions{},
+	)
+	require.NoError(t, err, "scanning repository")
+	assert.Nil(t, full.Sample)
+	assert.Equal(t, counts.Count32(20), full.UniqueTreeCount, "unique tree count")
+	assert.InEpsilon(t, float64(full.UniqueCommitSize), float64(h.UniqueCommitSize), 0.05)
+
+	// The sample is random, but the same seed chooses the same one:
+	scanWithSeed := func(seed int64) sizes.HistorySize {
+		t.Helper()
+		h, err := sizes.ScanRepositoryUsingGraph(
+			repo.Repository(t),
+			refGrouper{}, sizes.NameStyleFull, meter.NoProgressMeter,
+			sizes.ScanOptions{SampleRate: 0.25, SampleSeed: seed},
+		)
+		require.NoError(t, err, "scanning repository")
+		return h
+	}
+	assert.Equal(t, h.UniqueBlobSize, scanWithSeed(0).UniqueBlobSize)
+	sampled := make(map[counts.Count64]bool)
+	for seed := int64(1); seed <= 10; seed++ {
+		hs := scanWithSeed(seed)
+		assert.Equal(t, int64(seed), hs.Sample.Seed)
+		assert.Equal(t, counts.Count32(5), hs.Sample.SampledCommitCount)
+		sampled[hs.UniqueBlobSize] = true
+	}
+	assert.Greater(t, len(sampled), 1, "different seeds choose different samples")
+
+	// The commit total is extrapolated, but the tree and blob
+	// statistics are lower bounds:
+	cmd := exec.Command(sizerExe(t), "--no-progress", "-v", "--sample-rate=0.25", "--sample-seed=3")
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	out, err := cmd.Output()
+	require.NoError(t, err, "running git-sizer")
+	assert.Contains(
+		t, string(out),
+		"NOTE: These results are approximate. Only a random sample of 5 of 20\n"+
+			"commits (sample rate 0.25, seed 3) were scanned.",
+	)
+	assert.Regexp(t, `\|   \* Count +\|    20     \|`, string(out))
+	assert.Regexp(t, `\|   \* Total size +\| +~[\d.]+ KiB`, string(out))
+	assert.Regexp(t, `\|   \* Count +\| +\d+\+ +\|`, string(out))
+
+	cmd = exec.Command(
+		sizerExe(t), "--no-progress", "--json", "--json-version=2", "--sample-rate=0.25",
+	)
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	out, err = cmd.Output()
+	require.NoError(t, err, "running git-sizer")
+	var j map[string]struct {
+		Estimate string `json:"estimate"`
+	}
+	require.NoError(t, json.Unmarshal(out, &j))
+	assert.Equal(t, "", j["uniqueCommitCount"].Estimate)
+	assert.Equal(t, "extrapolated", j["uniqueCommitSize"].Estimate)
+	assert.Equal(t, "lowerBound", j["uniqueTreeCount"].Estimate)
+	assert.Equal(t, "lowerBound", j["uniqueBlobSize"].Estimate)
+
+	cmd = exec.Command(sizerExe(t), "--no-progress", "--sample-seed=3")
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	out, err = cmd.CombinedOutput()
+	assert.Error(t, err)
+	assert.Contains(t, string(out), "--sample-seed requires --sample-rate")
+}
+
+func TestQuickScan(t *testing.T) {
+	t.Parallel()
+
+	repo := testutils.NewTestRepo(t, false, "quick-scan")
+	t.Cleanup(func() { repo.Remove(t) })
+
+	timestamp := time.Unix(1112911993, 0)
+
+	// Each commit replaces the one file, so every commit has one new
+	// tree and one new blob, of the same size:
+	for i := 0; i < 10; i++ {
+		repo.AddFile(t, "file.txt", fmt.Sprintf("version %02d\n", i))
+		cmd := repo.GitCommand(t, "commit", "-m", fmt.Sprintf("commit %d", i))
+		testutils.AddAuthorInfo(cmd, &timestamp)
+		require.NoError(t, cmd.Run(), "creating commit")
+	}
+
+	h, err := sizes.ScanRepositoryUsingGraph(
+		repo.Repository(t),
+		refGrouper{}, sizes.NameStyleFull, meter.NoProgressMeter,
+		sizes.ScanOptions{MaxCommits: 2},
+	)
+	require.NoError(t, err, "scanning repository")
+
+	if assert.NotNil(t, h.QuickScan) {
+		assert.Equal(t, counts.Count32(10), h.QuickScan.CommitCount)
+		assert.Equal(t, counts.Count32(2), h.QuickScan.ScannedCommitCount)
+		assert.Equal(t, counts.Count64(30), h.QuickScan.ObjectCount)
+		assert.Equal(t, counts.Count64(6), h.QuickScan.ScannedObjectCount)
+	}
+	// The commit count is exact:
+	assert.Equal(t, counts.Count32(10), h.UniqueCommitCount)
+	// The tree and blob totals are extrapolated from two of each to
+	// the 20 objects that aren't commits:
+	assert.Equal(t, counts.Count32(10), h.UniqueTreeCount)
+	assert.Equal(t, counts.Count32(10), h.UniqueBlobCount)
+	assert.Equal(t, counts.Count64(110), h.UniqueBlobSize)
+	// The maxima only cover what was scanned:
+	assert.Equal(t, counts.Count32(1), h.MaxHistoryDepth)
+
+	full, err := sizes.ScanRepositoryUsingGraph(
+		repo.Repository(t),
+		refGrouper{}, sizes.NameStyleFull, meter.NoProgressMeter,
+		sizes.ScanOptions{},
+	)
+	require.NoError(t, err, "scanning repository")
+	assert.Nil(t, full.QuickScan)
+	assert.InEpsilon(t, float64(full.UniqueCommitSize), float64(h.UniqueCommitSize), 0.05)
+
+	cmd := exec.Command(sizerExe(t), "--no-progress", "-v", "--max-commits=2")
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	out, err := cmd.Output()
+	require.NoError(t, err, "running git-sizer")
+	assert.Contains(
+		t, string(out),
+		"NOTE: This was a quick scan. Only the newest 2 of 10 commits (and 6 of\n"+
+			"about 30 objects) were scanned.",
+	)
+	assert.Regexp(t, `\|   \* Count +\|    10     \|`, string(out))
+	assert.Regexp(t, `\|   \* Count +\|   ~10     \|`, string(out))
+	assert.Regexp(t, `\|   \* Maximum size +\[\d+\] \|   11\+ B   \|`, string(out))
+
+	cmd = exec.Command(
+		sizerExe(t), "--no-progress", "--json", "--json-version=2", "--max-commits=2",
+	)
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	out, err = cmd.Output()
+	require.NoError(t, err, "running git-sizer")
+	var j map[string]struct {
+		Value      uint64 `json:"value"`
+		HumanValue string `json:"humanValue"`
+		Estimate   string `json:"estimate"`
+	}
+	require.NoError(t, json.Unmarshal(out, &j))
+	assert.Equal(t, "", j["uniqueCommitCount"].Estimate)
+	assert.Equal(t, "extrapolated", j["uniqueBlobCount"].Estimate)
+	assert.Equal(t, "~10", j["uniqueBlobCount"].HumanValue)
+	assert.Equal(t, "lowerBound", j["maxBlobSize"].Estimate)
+	assert.Equal(t, uint64(11), j["maxBlobSize"].Value)
+	assert.Equal(t, "", j["referenceCount"].Estimate)
+
+	cmd = exec.Command(sizerExe(t), "--no-progress", "--max-commits=2", "--sample-rate=0.5")
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	out, err = cmd.CombinedOutput()
+	assert.Error(t, err)
+	assert.Contains(t, string(out), "--max-commits cannot be combined with --sample-rate")
+}
+
+func TestMergeCommits(t *testing.T) {
+	t.Parallel()
+
+	repo := testutils.NewTestRepo(t, false, "merge-commits")
+	t.Cleanup(func() { repo.Remove(t) })
+
+	timestamp := time.Unix(1112911993, 0)
+	runGit := func(args ...string) {
+		t.Helper()
+		cmd := repo.GitCommand(t, args...)
+		testutils.AddAuthorInfo(cmd, &timestamp)
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, "running git %v: %s", args, out)
+	}
+
+	repo.AddFile(t, "a.txt", "a\n")
+	runGit("commit", "-m", "initial")
+
+	// On a linear history, no commit is footnoted for the zero merge
+	// depth:
+	h, err := sizes.ScanRepositoryUsingGraph(
+		repo.Repository(t),
+		refGrouper{}, sizes.NameStyleFull, meter.NoProgressMeter,
+		sizes.ScanOptions{},
+	)
+	require.NoError(t, err, "scanning repository")
+	assert.Equal(t, counts.Count32(0), h.MaxMergeDepth, "linear max merge depth")
+	assert.Nil(t, h.MaxMergeDepthCommit)
+
+	cmd := exec.Command(sizerExe(t), "--no-progress", "-v")
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	out, err := cmd.Output()
+	require.NoError(t, err, "running git-sizer")
+	assert.Regexp(t, `\* Maximum merge depth\s+\|\s+0\s+\|`, string(out))
+
+	// Two of the six commits are merges:
+	for i := 0; i < 2; i++ {
+		runGit("checkout", "-q", "-b", "side")
+		repo.AddFile(t, fmt.Sprintf("side-%d.txt", i), "side\n")
+		runGit("commit", "-m", "side")
+		runGit("checkout", "-q", "master")
+		runGit("merge", "-q", "--no-ff", "-m", "merge", "side")
+		runGit("branch", "-q", "-D", "side")
+	}
+	repo.AddFile(t, "b.txt", "b\n")
+	runGit("commit", "-m", "linear")
+
+	h, err = sizes.ScanRepositoryUsingGraph(
+		repo.Repository(t),
+		refGrouper{}, sizes.NameStyleFull, meter.NoProgressMeter,
+		sizes.ScanOptions{},
+	)
+	require.NoError(t, err, "scanning repository")
+	assert.Equal(t, counts.Count32(6), h.UniqueCommitCount, "unique commit count")
+	assert.Equal(t, counts.Count32(2), h.MergeCommitCount, "merge commit count")
+	// Both merges are on the chain leading to the tip:
+	assert.Equal(t, counts.Count32(2), h.MaxMergeDepth, "max merge depth")
+	if assert.NotNil(t, h.MaxMergeDepthCommit) {
+		assert.Equal(t, "refs/heads/master", h.MaxMergeDepthCommit.Path())
+	}
+
+	// The merge depth is exact even when sampling:
+	h, err = sizes.ScanRepositoryUsingGraph(
+		repo.Repository(t),
+		refGrouper{}, sizes.NameStyleFull, meter.NoProgressMeter,
+		sizes.ScanOptions{SampleRate: 0.5},
+	)
+	require.NoError(t, err, "scanning repository with sampling")
+	assert.Equal(t, counts.Count32(2), h.MaxMergeDepth, "sampled max merge depth")
+
+	// The statistics are informational, so they are only shown in
+	// verbose mode, and without stars:
+	cmd = exec.Command(sizerExe(t), "--no-progress", "--threshold=0.0001")
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	out, err = cmd.Output()
+	require.NoError(t, err, "running git-sizer")
+	assert.NotContains(t, string(out), "Merge ratio")
+
+	cmd = exec.Command(sizerExe(t), "--no-progress", "-v")
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	out, err = cmd.Output()
+	require.NoError(t, err, "running git-sizer")
+	assert.Regexp(t, `\*\s+Merge commits\s+\|\s+2\s+\|\s+\|`, string(out))
+	assert.Regexp(t, `\*\s+Merge ratio\s+\|\s+33 %\s+\|\s+\|`, string(out))
+
+	cmd = exec.Command(sizerExe(t), "--no-progress", "--json", "--json-version=2")
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	out, err = cmd.Output()
+	require.NoError(t, err, "running git-sizer")
+
+	var v map[string]struct {
+		Value          uint64  `json:"value"`
+		Unit           string  `json:"unit"`
+		Prefixes       string  `json:"prefixes"`
+		LevelOfConcern float64 `json:"levelOfConcern"`
+	}
+	require.NoError(t, json.Unmarshal(out, &v))
+	assert.Equal(t, uint64(2), v["mergeCommitCount"].Value)
+	assert.Equal(t, uint64(2), v["maxMergeDepth"].Value)
+	ratio := v["mergeCommitRatio"]
+	assert.Equal(t, uint64(33), ratio.Value)
+	assert.Equal(t, "%", ratio.Unit)
+	assert.Equal(t, "metric", ratio.Prefixes)
+	assert.Zero(t, ratio.LevelOfConcern)
+}
+
+func TestFirstParent(t *testing.T) {
+	t.Parallel()
+
+	repo := testutils.NewTestRepo(t, false, "first-parent")
+	t.Cleanup(func() { repo.Remove(t) })
+
+	timestamp := time.Unix(1112911993, 0)
+	runGit := func(args ...string) {
+		t.Helper()
+		cmd := repo.GitCommand(t, args...)
+		testutils.AddAuthorInfo(cmd, &timestamp)
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, "running git %v: %s", args, out)
+	}
+
+	repo.AddFile(t, "a.txt", "a\n")
+	runGit("commit", "-m", "initial")
+
+	// Three topic branches, each with two commits; the first commit
+	// of each adds a file that the second one changes:
+	for i := 0; i < 3; i++ {
+		runGit("checkout", "-q", "-b", fmt.Sprintf("topic-%d", i), "master")
+		repo.AddFile(t, fmt.Sprintf("topic-%d.txt", i), fmt.Sprintf("draft %d\n", i))
+		runGit("commit", "-m", "draft")
+		repo.AddFile(t, fmt.Sprintf("topic-%d.txt", i), fmt.Sprintf("final %d\n", i))
+		runGit("commit", "-m", "final")
+	}
+	runGit("checkout", "-q", "master")
+	runGit("merge", "-q", "--no-ff", "-m", "octopus", "topic-0", "topic-1", "topic-2")
+	for i := 0; i < 3; i++ {
+		runGit("branch", "-q", "-D", fmt.Sprintf("topic-%d", i))
+	}
+
+	h, err := sizes.ScanRepositoryUsingGraph(
+		repo.Repository(t),
+		refGrouper{}, sizes.NameStyleFull, meter.NoProgressMeter,
+		sizes.ScanOptions{},
+	)
+	require.NoError(t, err, "scanning repository")
+	assert.Equal(t, counts.Count32(8), h.UniqueCommitCount)
+	assert.Equal(t, counts.Count32(4), h.MaxHistoryDepth)
+	// "a.txt", plus the draft and final versions of the three files:
+	assert.Equal(t, counts.Count32(7), h.UniqueBlobCount)
+	assert.Nil(t, h.Scope)
+
+	h, err = sizes.ScanRepositoryUsingGraph(
+		repo.Repository(t),
+		refGrouper{}, sizes.NameStyleFull, meter.NoProgressMeter,
+		sizes.ScanOptions{FirstParent: true},
+	)
+	require.NoError(t, err, "scanning repository")
+	// Only the initial commit and the merge:
+	assert.Equal(t, counts.Count32(2), h.UniqueCommitCount)
+	assert.Equal(t, counts.Count32(2), h.MaxHistoryDepth)
+	assert.Equal(t, counts.Count32(1), h.MergeCommitCount)
+	assert.Equal(t, counts.Count32(4), h.MaxParentCount)
+	assert.Equal(t, counts.Count32(1), h.MaxMergeDepth)
+	// The drafts were only in the topic branches:
+	assert.Equal(t, counts.Count32(4), h.UniqueBlobCount)
+	assert.Equal(t, counts.Count32(2), h.UniqueTreeCount)
+	assert.Equal(t, counts.Count32(4), h.MaxExpandedBlobCount)
+	if assert.NotNil(t, h.Scope) {
+		assert.True(t, h.Scope.FirstParent)
+	}
+
+	cmd := exec.Command(sizerExe(t), "--no-progress", "-v", "--first-parent")
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	out, err := cmd.Output()
+	require.NoError(t, err, "running git-sizer")
+	assert.Contains(
+		t, string(out),
+		"NOTE: Only the first-parent (mainline) history of each reference was\nscanned;",
+	)
+	assert.Regexp(t, `\* Maximum history depth +\| +2 +\|`, string(out))
+
+	cmd = exec.Command(
+		sizerExe(t), "--no-progress", "--json", "--json-version=2", "--first-parent",
+	)
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	out, err = cmd.Output()
+	require.NoError(t, err, "running git-sizer")
+	var j struct {
+		Scope struct {
+			FirstParent bool `json:"firstParent"`
+		} `json:"scope"`
+	}
+	require.NoError(t, json.Unmarshal(out, &j))
+	assert.True(t, j.Scope.FirstParent)
+
+	cmd = exec.Command(sizerExe(t), "--no-progress", "--first-parent", "--sample-rate=0.5")
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	out, err = cmd.CombinedOutput()
+	assert.Error(t, err)
+	assert.Contains(t, string(out), "--first-parent cannot be combined with --sample-rate")
+}
+
+func TestCommitMetadata(t *testing.T) {
+	t.Parallel()
+
+	repo := testutils.NewTestRepo(t, true, "commit-metadata")
+	t.Cleanup(func() { repo.Remove(t) })
+
+	tree := repo.CreateObject(t, "tree", func(w io.Writer) error { return nil })
+
+	// Create commits with `--literally`, because recent versions of
+	// Git refuse to create some of them otherwise:
+	var parent git.OID
+	commit := func(headers string) git.OID {
+		t.Helper()
+		var parentHeader string
+		if parent != git.NullOID {
+			parentHeader = fmt.Sprintf("parent %s\n", parent)
+		}
+		cmd := repo.GitCommand(t, "hash-object", "-w", "--literally", "-t", "commit", "--stdin")
+		cmd.Stdin = strings.NewReader(
+			fmt.Sprintf("tree %s\n%s%s\nmessage\n", tree, parentHeader, headers),
+		)
+		out, err := cmd.Output()
+		require.NoError(t, err, "creating commit")
+		parent, err = git.NewOID(strings.TrimSpace(string(out)))
+		require.NoError(t, err)
+		return parent
+	}
+
+	const (
+		goodAuthor    = "author A U Thor <author@example.com> 1112911993 -0700\n"
+		goodCommitter = "committer C O Mitter <committer@example.com> 1112911993 -0700\n"
+	)
+	latin1 := commit(goodAuthor + goodCommitter + "encoding ISO-8859-1\n")
+	commit(goodAuthor + goodCommitter + "encoding ISO-8859-1\n")
+	malformed := commit("author Broken <author@example.com>\n" + goodCommitter)
+	old := commit(goodAuthor + "committer C O Mitter <committer@example.com> 315532799 +0000\n")
+	future := time.Now().Add(48 * time.Hour).Unix()
+	commit(fmt.Sprintf("author A U Thor <author@example.com> %d +0000\n", future) + goodCommitter)
+	commit(goodAuthor + goodCommitter + "encoding UTF-8\n")
+	repo.UpdateRef(t, "refs/heads/master", parent)
+
+	h, err := sizes.ScanRepositoryUsingGraph(
+		repo.Repository(t),
+		refGrouper{}, sizes.NameStyleFull, meter.NoProgressMeter,
+		sizes.ScanOptions{},
+	)
+	require.NoError(t, err, "scanning repository")
+
+	assert.Equal(t, counts.Count32(2), h.NonUTF8CommitCount, "non-UTF-8 commit count")
+	if assert.NotNil(t, h.NonUTF8Commit) {
+		assert.Equal(t, latin1, h.NonUTF8Commit.OID)
+	}
+	assert.Equal(t, counts.Count32(1), h.MalformedIdentityCommitCount, "malformed identity count")
+	if assert.NotNil(t, h.MalformedIdentityCommit) {
+		assert.Equal(t, malformed, h.MalformedIdentityCommit.OID)
+	}
+	assert.Equal(t, counts.Count32(2), h.ImplausibleDateCommitCount, "implausible date count")
+	if assert.NotNil(t, h.ImplausibleDateCommit) {
+		assert.Equal(t, old, h.ImplausibleDateCommit.OID)
+	}
+
+	cmd := exec.Command(sizerExe(t), "--no-progress", "-v")
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	out, err := cmd.Output()
+	require.NoError(t, err, "running git-sizer")
+	assert.Regexp(t, `\* Non-UTF-8 encoding\s+\[(\d+)\]\s+\|\s+2\s+\|\s+\|`, string(out))
+	assert.Regexp(t, `\* Malformed identities\s+\[(\d+)\]\s+\|\s+1\s+\|\s+\|`, string(out))
+	assert.Regexp(t, `\* Dates out of range\s+\[(\d+)\]\s+\|\s+2\s+\|\s+\|`, string(out))
+	assert.Contains(t, string(out), malformed.String())
+}
+
+func TestTreeAnomalies(t *testing.T) {
+	t.Parallel()
+
+	repo := testutils.NewTestRepo(t, true, "tree-anomalies")
+	t.Cleanup(func() { repo.Remove(t) })
+
+	blob := repo.CreateObject(t, "blob", func(w io.Writer) error {
+		_, err := io.WriteString(w, "contents\n")
+		return err
+	})
+	emptyTree := repo.CreateObject(t, "tree", func(w io.Writer) error { return nil })
+
+	type entry struct {
+		mode, name string
+		oid        git.OID
+	}
+	file := func(mode, name string) entry { return entry{mode, name, blob} }
+
+	// Create trees with `--literally`, because Git refuses to create
+	// them otherwise:
+	tree := func(entries ...entry) git.OID {
+		t.Helper()
+		var buf bytes.Buffer
+		for _, e := range entries {
+			fmt.Fprintf(&buf, "%s %s\x00", e.mode, e.name)
+			buf.Write(e.oid.Bytes())
+		}
+		cmd := repo.GitCommand(t, "hash-object", "-w", "--literally", "-t", "tree", "--stdin")
+		cmd.Stdin = &buf
+		out, err := cmd.Output()
+		require.NoError(t, err, "creating tree")
+		oid, err := git.NewOID(strings.TrimSpace(string(out)))
+		require.NoError(t, err)
+		return oid
+	}
+
+	duplicate := tree(file("100644", "a"), file("100755", "a"))
+	unsorted := tree(file("100644", "b"), file("100644", "a"))
+	badMode := tree(file("100664", "a"))
+	zeroPadded := tree(entry{"040000", "a", emptyTree})
+	dotGit := tree(file("100644", ".GIT"))
+	badName := tree(file("100644", "a/b"))
+	root := tree(
+		// These are in order, because a tree's name sorts as if it
+		// ended with a slash:
+		file("100644", "a.txt"),
+		entry{"40000", "a", emptyTree},
+		entry{"40000", "d1", duplicate},
+		entry{"40000", "d2", unsorted},
+		entry{"40000", "d3", badMode},
+		entry{"40000", "d4", zeroPadded},
+		entry{"40000", "d5", dotGit},
+		entry{"40000", "d6", badName},
+	)
+	commit := repo.CreateObject(t, "commit", func(w io.Writer) error {
+		_, err := fmt.Fprintf(
+			w,
+			"tree %s\n"+
+				"author A U Thor <author@example.com> 1112911993 -0700\n"+
+				"committer C O Mitter <committer@example.com> 1112911993 -0700\n"+
+				"\nmessage\n",
+			root,
+		)
+		return err
+	})
+	repo.UpdateRef(t, "refs/heads/master", commit)
+
+	h, err := sizes.ScanRepositoryUsingGraph(
+		repo.Repository(t),
+		refGrouper{}, sizes.NameStyleFull, meter.NoProgressMeter,
+		sizes.ScanOptions{},
+	)
+	require.NoError(t, err, "scanning repository")
+
+	ta := h.TreeAnomalies
+	for _, c := range []struct {
+		name    string
+		count   counts.Count32
+		example *sizes.Path
+		tree    git.OID
+		path    string
+	}{
+		{"duplicate entries", ta.DuplicateEntriesCount, ta.DuplicateEntriesTree, duplicate, "d1"},
+		{"unsorted", ta.UnsortedCount, ta.UnsortedTree, unsorted, "d2"},
+		{"bad filemode", ta.BadFilemodeCount, ta.BadFilemodeTree, badMode, "d3"},
+		{"zero-padded filemode", ta.ZeroPaddedFilemodeCount, ta.ZeroPaddedFilemodeTree, zeroPadded, "d4"},
+		{"dot git", ta.DotGitCount, ta.DotGitTree, dotGit, "d5"},
+		{"bad name", ta.BadNameCount, ta.BadNameTree, badName, "d6"},
+	} {
+		assert.Equal(t, counts.Count32(1), c.count, c.name)
+		if assert.NotNil(t, c.example, c.name) {
+			assert.Equal(t, c.tree, c.example.OID, c.name)
+			assert.Equal(t, "refs/heads/master:"+c.path, c.example.Path(), c.name)
+		}
+	}
+
+	cmd := exec.Command(sizerExe(t), "--no-progress")
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	out, err := cmd.Output()
+	require.NoError(t, err, "running git-sizer")
+	assert.Contains(
+		t, string(out),
+		"\nWarning: some trees have problems that 'git fsck' reports, and that\n"+
+			"hosts that check pushed objects reject:\n\n"+
+			fmt.Sprintf("    duplicate entries               1 tree(s), e.g., %s (refs/heads/master:d1)\n", duplicate),
+	)
+	assert.Contains(t, string(out), "    bad entry names                 1 tree(s), e.g., ")
+
+	cmd = exec.Command(sizerExe(t), "--no-progress", "--json", "--json-version=2")
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	out, err = cmd.Output()
+	require.NoError(t, err, "running git-sizer")
+	var j struct {
+		TreeAnomalies map[string]interface{} `json:"treeAnomalies"`
+	}
+	require.NoError(t, json.Unmarshal(out, &j))
+	assert.Equal(t, 1.0, j.TreeAnomalies["unsortedCount"])
+	assert.Equal(t, unsorted.String(), j.TreeAnomalies["unsortedTree"])
+	assert.Equal(t, "refs/heads/master:d2", j.TreeAnomalies["unsortedTreeRef"])
+	assert.NotContains(t, j.TreeAnomalies, "unsorted_count")
+}
+
+func TestCommitDates(t *testing.T) {
+	t.Parallel()
+
+	repo := testutils.NewTestRepo(t, true, "commit-dates")
+	t.Cleanup(func() { repo.Remove(t) })
+
+	tree := repo.CreateObject(t, "tree", func(w io.Writer) error { return nil })
+
+	var parent git.OID
+	commit := func(timestamp int64) git.OID {
+		t.Helper()
+		var parentHeader string
+		if parent != git.NullOID {
+			parentHeader = fmt.Sprintf("parent %s\n", parent)
+		}
+		cmd := repo.GitCommand(t, "hash-object", "-w", "--literally", "-t", "commit", "--stdin")
+		cmd.Stdin = strings.NewReader(
+			fmt.Sprintf(
+				"tree %s\n%s"+
+					"author A U Thor <author@example.com> 1112911993 -0700\n"+
+					"committer C O Mitter <committer@example.com> %d -0700\n"+
+					"\nmessage\n",
+				tree, parentHeader, timestamp,
+			),
+		)
+		out, err := cmd.Output()
+		require.NoError(t, err, "creating commit")
+		parent, err = git.NewOID(strings.TrimSpace(string(out)))
+		require.NoError(t, err)
+		return parent
+	}
+
+	// The dates don't have to be in order:
+	commit(1301012345)
+	first := commit(1112911993)
+	last := commit(1490000000)
+	commit(1200000000)
+	repo.UpdateRef(t, "refs/heads/master", parent)
+
+	scan := func() *sizes.CommitDates {
+		t.Helper()
+		h, err := sizes.ScanRepositoryUsingGraph(
+			repo.Repository(t),
+			refGrouper{}, sizes.NameStyleFull, meter.NoProgressMeter,
+			sizes.ScanOptions{},
+		)
+		require.NoError(t, err, "scanning repository")
+		require.NotNil(t, h.CommitDates)
+		return h.CommitDates
+	}
+
+	cd := scan()
+	assert.Equal(t, int64(1112911993), cd.Earliest)
+	assert.Equal(t, "2005-04-07T22:13:13Z", cd.EarliestDate)
+	if assert.NotNil(t, cd.EarliestCommit) {
+		assert.Equal(t, first, cd.EarliestCommit.OID)
+	}
+	assert.Equal(t, int64(1490000000), cd.Latest)
+	if assert.NotNil(t, cd.LatestCommit) {
+		assert.Equal(t, last, cd.LatestCommit.OID)
+	}
+	assert.InDelta(t, 11.94, cd.SpanYears, 0.01)
+
+	// The range is only shown with `-v`, since it isn't concerning:
+	cmd := exec.Command(sizerExe(t), "--no-progress")
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	out, err := cmd.Output()
+	require.NoError(t, err, "running git-sizer")
+	assert.NotContains(t, string(out), "Commit dates")
+
+	cmd = exec.Command(sizerExe(t), "--no-progress", "-v")
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	out, err = cmd.Output()
+	require.NoError(t, err, "running git-sizer")
+	assert.Contains(t, string(out), "\nCommit dates: 2005-04-07 to 2017-03-20 (11.9 years)\n")
+	assert.NotContains(t, string(out), "implausible dates")
+
+	// A commit from a badly skewed clock, beyond what
+	// `time.Time.Sub()` and `time.Time.MarshalJSON()` can handle:
+	skewed := commit(300000000000)
+	repo.UpdateRef(t, "refs/heads/master", parent)
+
+	cd = scan()
+	assert.Equal(t, int64(300000000000), cd.Latest)
+	assert.Equal(t, "11476-08-15T05:20:00Z", cd.LatestDate)
+	assert.InDelta(t, 9471.35, cd.SpanYears, 0.01)
+
+	cmd = exec.Command(sizerExe(t), "--no-progress", "--json", "--json-version=2")
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	out, err = cmd.Output()
+	require.NoError(t, err, "running git-sizer")
+	var j struct {
+		CommitDates map[string]interface{} `json:"commitDates"`
+	}
+	require.NoError(t, json.Unmarshal(out, &j))
+	assert.Equal(t, 300000000000.0, j.CommitDates["latest"])
+	assert.Equal(t, "11476-08-15T05:20:00Z", j.CommitDates["latestDate"])
+	assert.Equal(t, skewed.String(), j.CommitDates["latestCommit"])
+	assert.Equal(t, "refs/heads/master", j.CommitDates["latestCommitRef"])
+	assert.Equal(t, first.String(), j.CommitDates["earliestCommit"])
+	assert.InDelta(t, 9471.35, j.CommitDates["spanYears"], 0.01)
+
+	cmd = exec.Command(sizerExe(t), "--no-progress")
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	out, err = cmd.Output()
+	require.NoError(t, err, "running git-sizer")
+	assert.Contains(t, string(out), "\nCommit dates: 2005-04-07 to 11476-08-15 (9471.4 years)\n")
+	assert.Contains(t, string(out), "Some commits have implausible dates")
+}
+
+func TestCommitterDomains(t *testing.T) {
+	t.Parallel()
+
+	repo := testutils.NewTestRepo(t, true, "committer-domains")
+	t.Cleanup(func() { repo.Remove(t) })
+
+	tree := repo.CreateObject(t, "tree", func(w io.Writer) error { return nil })
+
+	var parent git.OID
+	commit := func(committer string) {
+		t.Helper()
+		var parentHeader string
+		if parent != git.NullOID {
+			parentHeader = fmt.Sprintf("parent %s\n", parent)
+		}
+		cmd := repo.GitCommand(t, "hash-object", "-w", "--literally", "-t", "commit", "--stdin")
+		cmd.Stdin = strings.NewReader(
+			fmt.Sprintf(
+				"tree %s\n%sauthor A U Thor <author@example.com> 1112911993 -0700\n%s\nmessage\n",
+				tree, parentHeader, committer,
+			),
+		)
+		out, err := cmd.Output()
+		require.NoError(t, err, "creating commit")
+		parent, err = git.NewOID(strings.TrimSpace(string(out)))
+		require.NoError(t, err)
+	}
+
+	commit("committer C O Mitter <committer@example.com> 1112911993 -0700\n")
+	commit("committer C O Mitter <Committer@EXAMPLE.com> 1112911993 -0700\n")
+	commit("committer Someone <someone@example.com.> 1112911993 -0700\n")
+	commit("committer Outside <dev@Other.ORG> 1112911993 -0700\n")
+	commit("committer Nobody <nobody> 1112911993 -0700\n")
+	commit("committer Empty <empty@> 1112911993 -0700\n")
+	commit("committer Broken\n")
+	repo.UpdateRef(t, "refs/heads/master", parent)
+
+	h, err := sizes.ScanRepositoryUsingGraph(
+		repo.Repository(t),
+		refGrouper{}, sizes.NameStyleFull, meter.NoProgressMeter,
+		sizes.ScanOptions{CommitterDomains: true},
+	)
+	require.NoError(t, err, "scanning repository")
+	if assert.NotNil(t, h.CommitterDomains) {
+		assert.Equal(t, counts.Count32(2), h.CommitterDomains.DomainCount)
+		assert.Equal(
+			t,
+			map[string]counts.Count32{"example.com": 3, "other.org": 1},
+			h.CommitterDomains.Domains,
+		)
+		assert.Equal(t, counts.Count32(3), h.CommitterDomains.MalformedCount)
+	}
+
+	// It is opt-in:
+	h, err = sizes.ScanRepositoryUsingGraph(
+		repo.Repository(t),
+		refGrouper{}, sizes.NameStyleFull, meter.NoProgressMeter,
+		sizes.ScanOptions{},
+	)
+	require.NoError(t, err, "scanning repository")
+	assert.Nil(t, h.CommitterDomains)
+
+	cmd := exec.Command(sizerExe(t), "--no-progress", "--committer-domains")
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	out, err := cmd.Output()
+	require.NoError(t, err, "running git-sizer")
+	assert.Contains(
+		t, string(out),
+		"\nCommitter email domains: 2\n\n"+
+			"    Domain          Commits\n"+
+			"    example.com           3\n"+
+			"    other.org             1\n\n"+
+			"    3 commit(s) have a committer email address without a usable domain\n",
+	)
+}
+
+func TestEmptyCommits(t *testing.T) {
+	t.Parallel()
+
+	repo := testutils.NewTestRepo(t, false, "empty-commits")
+	t.Cleanup(func() { repo.Remove(t) })
+
+	timestamp := time.Unix(1112911993, 0)
+	runGit := func(args ...string) string {
+		t.Helper()
+		cmd := repo.GitCommand(t, args...)
+		testutils.AddAuthorInfo(cmd, &timestamp)
+		out, err := cmd.Output()
+		require.NoError(t, err, "running git %v", args)
+		return strings.TrimSpace(string(out))
+	}
+
+	repo.AddFile(t, "a.txt", "a\n")
+	runGit("commit", "-m", "initial")
+	runGit("commit", "--allow-empty", "-m", "empty")
+	allowEmpty := runGit("rev-parse", "HEAD")
+
+	// A merge that keeps the tree of its first parent:
+	runGit("checkout", "-q", "-b", "side")
+	repo.AddFile(t, "b.txt", "b\n")
+	runGit("commit", "-m", "side")
+	runGit("checkout", "-q", "master")
+	runGit("merge", "-q", "-s", "ours", "-m", "merge", "side")
+	runGit("branch", "-q", "-D", "side")
+
+	// A commit that changes something isn't counted:
+	repo.AddFile(t, "a.txt", "a2\n")
+	runGit("commit", "-m", "change")
+
+	// Nor is a root commit, unless its tree is empty:
+	emptyTree := runGit("hash-object", "-t", "tree", "-w", "--stdin")
+	runGit("update-ref", "refs/heads/orphan", runGit("commit-tree", "-m", "nothing", emptyTree))
+
+	h, err := sizes.ScanRepositoryUsingGraph(
+		repo.Repository(t),
+		refGrouper{}, sizes.NameStyleFull, meter.NoProgressMeter,
+		sizes.ScanOptions{},
+	)
+	require.NoError(t, err, "scanning repository")
+	assert.Equal(t, counts.Count32(3), h.EmptyCommitCount, "empty commit count")
+	if assert.NotNil(t, h.EmptyCommit) {
+		assert.Equal(t, allowEmpty, h.EmptyCommit.OID.String())
+	}
+
+	cmd := exec.Command(sizerExe(t), "--no-progress", "-v")
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	out, err := cmd.Output()
+	require.NoError(t, err, "running git-sizer")
+	assert.Regexp(t, `\* Content-free commits\s+\[(\d+)\]\s+\|\s+3\s+\|\s+\|`, string(out))
+}
+
+func TestPersistenceWeighted(t *testing.T) {
+	t.Parallel()
+
+	repo := testutils.NewTestRepo(t, false, "persistence-weighted")
+	t.Cleanup(func() { repo.Remove(t) })
+
+	timestamp := time.Unix(1112911993, 0)
+	commit := func(msg string) {
+		t.Helper()
+		cmd := repo.GitCommand(t, "commit", "-m", msg)
+		testutils.AddAuthorInfo(cmd, &timestamp)
+		require.NoError(t, cmd.Run(), "committing")
+	}
+
+	// "a.txt" (100 bytes) is in all three commits, and at a second
+	// path in the last one; "b.txt" (10 bytes) is only in the last
+	// two:
+	repo.AddFile(t, "a.txt", strings.Repeat("a", 99)+"\n")
+	commit("add a")
+	repo.AddFile(t, "b.txt", strings.Repeat("b", 9)+"\n")
+	commit("add b")
+	repo.AddFile(t, "dir/a.txt", strings.Repeat("a", 99)+"\n")
+	commit("copy a")
+
+	h, err := sizes.ScanRepositoryUsingGraph(
+		repo.Repository(t),
+		refGrouper{}, sizes.NameStyleFull, meter.NoProgressMeter,
+		sizes.ScanOptions{PersistenceWeighted: true},
+	)
+	require.NoError(t, err, "scanning repository")
+	if assert.NotNil(t, h.PersistenceWeighted) {
+		assert.Equal(t, counts.Count64(100+110+210), h.PersistenceWeighted.Size)
+		assert.Equal(t, counts.Count32(3), h.PersistenceWeighted.CommitCount)
+	}
+
+	// It is opt-in:
+	h, err = sizes.ScanRepositoryUsingGraph(
+		repo.Repository(t),
+		refGrouper{}, sizes.NameStyleFull, meter.NoProgressMeter,
+		sizes.ScanOptions{},
+	)
+	require.NoError(t, err, "scanning repository")
+	assert.Nil(t, h.PersistenceWeighted)
+
+	cmd := exec.Command(sizerExe(t), "--no-progress", "-v", "--persistence-weighted")
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	out, err := cmd.Output()
+	require.NoError(t, err, "running git-sizer")
+	assert.Regexp(t, `\* Persistence-weighted\s+\|\s+420 B\s+\|`, string(out))
+	// 420 / 110 bytes of distinct blobs:
+	assert.Regexp(t, `\* Mean persistence\s+\|\s+4\s+\|`, string(out))
+}
+
+func TestSignedObjects(t *testing.T) {
+	t.Parallel()
+
+	repo := testutils.NewTestRepo(t, true, "signed-objects")
+	t.Cleanup(func() { repo.Remove(t) })
+
+	tree := repo.CreateObject(t, "tree", func(w io.Writer) error { return nil })
+
+	const identity = "A U Thor <author@example.com> 1112911993 -0700"
+	const signature = "-----BEGIN PGP SIGNATURE-----\n\nabc\n-----END PGP SIGNATURE-----\n"
+
+	// The signatures don't have to be valid, because they aren't
+	// verified:
+	var parent git.OID
+	for i, signed := range []bool{false, true, true, false} {
+		var headers string
+		if parent != git.NullOID {
+			headers += fmt.Sprintf("parent %s\n", parent)
+		}
+		headers += fmt.Sprintf("author %s\ncommitter %s\n", identity, identity)
+		if signed {
+			headers += "gpgsig " + strings.ReplaceAll(strings.TrimSuffix(signature, "\n"), "\n", "\n ") + "\n"
+		}
+		parent = repo.CreateObject(t, "commit", func(w io.Writer) error {
+			_, err := fmt.Fprintf(w, "tree %s\n%s\ncommit %d\n", tree, headers, i)
+			return err
+		})
+	}
+	repo.UpdateRef(t, "refs/heads/master", parent)
+
+	for i, message := range []string{"unsigned\n", "signed\n" + signature} {
+		tag := repo.CreateObject(t, "tag", func(w io.Writer) error {
+			_, err := fmt.Fprintf(
+				w, "object %s\ntype commit\ntag v%d\ntagger %s\n\n%s",
+				parent, i, identity, message,
+			)
+			return err
+		})
+		repo.UpdateRef(t, fmt.Sprintf("refs/tags/v%d", i), tag)
+	}
+
+	h, err := sizes.ScanRepositoryUsingGraph(
+		repo.Repository(t),
+		refGrouper{}, sizes.NameStyleFull, meter.NoProgressMeter,
+		sizes.ScanOptions{},
+	)
+	require.NoError(t, err, "scanning repository")
+	assert.Equal(t, counts.Count32(2), h.SignedCommitCount, "signed commit count")
+	assert.Equal(t, counts.Count32(1), h.SignedTagCount, "signed tag count")
+
+	// The statistics are only shown in verbose mode:
+	cmd := exec.Command(sizerExe(t), "--no-progress", "--threshold=0.0001")
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	out, err := cmd.Output()
+	require.NoError(t, err, "running git-sizer")
+	assert.NotContains(t, string(out), "Signed")
+
+	cmd = exec.Command(sizerExe(t), "--no-progress", "-v")
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	out, err = cmd.Output()
+	require.NoError(t, err, "running git-sizer")
+	assert.Regexp(t, `\*\s+Signed commits\s+\|\s+2\s+\|\s+\|`, string(out))
+	assert.Regexp(t, `\*\s+Signed ratio\s+\|\s+50 %\s+\|\s+\|`, string(out))
+	assert.Regexp(t, `\*\s+Signed\s+\|\s+1\s+\|\s+\|`, string(out))
+
+	cmd = exec.Command(sizerExe(t), "--no-progress", "--json", "--json-version=2")
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	out, err = cmd.Output()
+	require.NoError(t, err, "running git-sizer")
+
+	var v map[string]struct {
+		Value uint64 `json:"value"`
+	}
+	require.NoError(t, json.Unmarshal(out, &v))
+	assert.Equal(t, uint64(2), v["signedCommitCount"].Value)
+	assert.Equal(t, uint64(50), v["signedCommitRatio"].Value)
+	assert.Equal(t, uint64(1), v["signedTagCount"].Value)
+}
+
+func TestBrokenReferences(t *testing.T) {
+	t.Parallel()
+
+	repo := testutils.NewTestRepo(t, true, "broken-refs")
+	t.Cleanup(func() { repo.Remove(t) })
+
+	repo.CreateReferencedOrphan(t, "refs/heads/master")
+
+	// Write loose references that point at objects that don't exist:
+	const missingOID = "1234567890123456789012345678901234567890"
+	for _, refname := range []string{"refs/heads/broken", "refs/tags/broken"} {
+		path := filepath.Join(repo.Path, filepath.FromSlash(refname))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, ioutil.WriteFile(path, []byte(missingOID+"\n"), 0o644))
+	}
+
+	h, err := sizes.ScanRepositoryUsingGraph(
+		repo.Repository(t),
+		refGrouper{}, sizes.NameStyleFull, meter.NoProgressMeter,
+		sizes.ScanOptions{},
+	)
+	require.NoError(t, err, "scanning repository")
+	assert.Equal(t, counts.Count32(1), h.UniqueCommitCount, "unique commit count")
+	assert.Equal(t, counts.Count32(1), h.ReferenceCount, "reference count")
+	assert.Nil(t, h.Errors)
+	if assert.NotNil(t, h.BrokenReferences) {
+		assert.Equal(t, counts.Count32(2), h.BrokenReferences.Count)
+		if assert.Len(t, h.BrokenReferences.References, 2) {
+			assert.Equal(t, "refs/heads/broken", h.BrokenReferences.References[0].Refname)
+			assert.Equal(t, missingOID, h.BrokenReferences.References[0].OID.String())
+			assert.Equal(t, "refs/tags/broken", h.BrokenReferences.References[1].Refname)
+		}
+	}
+
+	_, err = sizes.ScanRepositoryUsingGraph(
+		repo.Repository(t),
+		refGrouper{}, sizes.NameStyleFull, meter.NoProgressMeter,
+		sizes.ScanOptions{Strict: true},
+	)
+	if assert.Error(t, err, "strict scan") {
+		assert.Contains(t, err.Error(), "refs/heads/broken -> "+missingOID)
+		assert.Contains(t, err.Error(), "refs/tags/broken -> "+missingOID)
+	}
+}
+
+// TestDeepDirectory checks that a repository whose path is longer
+// than Windows's traditional `MAX_PATH` limit of 260 characters can
+// be scanned.
+func TestDeepDirectory(t *testing.T) {
+	t.Parallel()
+
+	top, err := ioutil.TempDir("", "deep")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = os.RemoveAll(top) })
+
+	path := top
+	for len(path) <= 300 {
+		path = filepath.Join(path, strings.Repeat("d", 40))
+	}
+
+	// Use `core.longpaths` so that Git for Windows can handle the
+	// path, too:
+	cmd := exec.Command("git", "-c", "core.longpaths=true", "init", path)
+	cmd.Env = testutils.CleanGitEnv()
+	require.NoError(t, cmd.Run(), "initializing repository")
+
+	repo := &testutils.TestRepo{Path: path}
+	repo.ConfigAdd(t, "core.longpaths", "true")
+
+	timestamp := time.Unix(1112911993, 0)
+
+	repo.AddFile(t, "subdir/file.txt", "Hello, world!\n")
+
+	cmd = repo.GitCommand(t, "commit", "-m", "initial")
+	testutils.AddAuthorInfo(cmd, &timestamp)
+	require.NoError(t, cmd.Run(), "creating commit")
+
+	h, err := sizes.ScanRepositoryUsingGraph(
+		repo.Repository(t),
+		refGrouper{}, sizes.NameStyleFull, meter.NoProgressMeter,
+		sizes.ScanOptions{},
+	)
+	require.NoError(t, err, "scanning repository")
+	assert.Equal(t, counts.Count32(1), h.UniqueCommitCount, "unique commit count")
+	assert.Equal(t, counts.Count32(1), h.UniqueBlobCount, "unique blob count")
+	assert.Equal(t, counts.Count32(2), h.MaxPathDepth, "max path depth")
+}
+
+// TestQuarantine checks that git-sizer can see objects that are only
+// available via `GIT_OBJECT_DIRECTORY`, as is the case for new
+// objects when `git receive-pack` runs a pre-receive hook.
+func TestQuarantine(t *testing.T) {
+	t.Parallel()
+
+	repo := testutils.NewTestRepo(t, true, "quarantine")
+	t.Cleanup(func() { repo.Remove(t) })
+
+	repo.CreateReferencedOrphan(t, "refs/heads/master")
+
+	quarantineDir := filepath.Join(repo.Path, "objects", "incoming")
+	require.NoError(t, os.MkdirAll(quarantineDir, 0o777))
+	quarantineEnv := []string{
+		"GIT_OBJECT_DIRECTORY=" + quarantineDir,
+		"GIT_ALTERNATE_OBJECT_DIRECTORIES=" + filepath.Join(repo.Path, "objects"),
+		"GIT_QUARANTINE_PATH=" + quarantineDir,
+	}
+
+	// Create a commit whose objects only exist in the quarantine
+	// directory:
+	timestamp := time.Unix(1112911993, 0)
+	cmd := repo.GitCommand(t, "commit-tree", "-p", "refs/heads/master", "-m", "new", "refs/heads/master^{tree}")
+	testutils.AddAuthorInfo(cmd, &timestamp)
+	cmd.Env = append(cmd.Env, quarantineEnv...)
+	out, err := cmd.Output()
+	require.NoError(t, err, "creating commit in quarantine")
+	newOID := strings.TrimSpace(string(out))
+
+	// Git refuses to update references if `GIT_QUARANTINE_PATH` is
+	// set, so leave that one out here:
+	cmd = repo.GitCommand(t, "update-ref", "refs/heads/new", newOID)
+	cmd.Env = append(cmd.Env, quarantineEnv[:2]...)
+	require.NoError(t, cmd.Run(), "updating reference")
+
+	executable := sizerExe(t)
+
+	cmd = exec.Command(executable, "--no-progress", "--json", "--json-version=2")
+	cmd.Dir = repo.Path
+	cmd.Env = append(testutils.CleanGitEnv(), quarantineEnv...)
+	out, err = cmd.Output()
+	require.NoError(t, err)
+
+	var v map[string]struct {
+		Value uint64 `json:"value"`
+	}
+	require.NoError(t, json.Unmarshal(out, &v))
+	assert.Equal(t, uint64(2), v["uniqueCommitCount"].Value, "unique commit count")
+
+	// Without the quarantine settings, the new commit is missing, so
+	// its reference is reported as broken:
+	cmd = exec.Command(executable, "--no-progress", "--json", "--json-version=2")
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	out, err = cmd.Output()
+	require.NoError(t, err)
+
+	var broken struct {
+		BrokenReferences struct {
+			Count int `json:"count"`
+		} `json:"brokenReferences"`
+	}
+	require.NoError(t, json.Unmarshal(out, &broken))
+	assert.Equal(t, 1, broken.BrokenReferences.Count, "broken reference count")
+}
+
+func TestSubmodule(t *testing.T) {
+	t.Parallel()
+
+	tmp, err := ioutil.TempDir("", "submodule")
+	require.NoError(t, err, "creating temporary directory")
+
+	defer func() {
+		os.RemoveAll(tmp)
+	}()
+
+	timestamp := time.Unix(1112911993, 0)
+
+	submRepo := testutils.TestRepo{
+		Path: filepath.Join(tmp, "subm"),
+	}
+	submRepo.Init(t, false)
+	submRepo.AddFile(t, "submfile1.txt", "Hello, submodule!\n")
+	submRepo.AddFile(t, "submfile2.txt", "Hello again, submodule!\n")
+	submRepo.AddFile(t, "submfile3.txt", "Hello again, submodule!\n")
+
+	cmd := submRepo.GitCommand(t, "commit", "-m", "subm initial")
+	testutils.AddAuthorInfo(cmd, &timestamp)
+	require.NoError(t, cmd.Run(), "creating subm commit")
+
+	mainRepo := testutils.TestRepo{
+		Path: filepath.Join(tmp, "main"),
+	}
+	mainRepo.Init(t, false)
+
+	mainRepo.AddFile(t, "mainfile.txt", "Hello, main!\n")
+
+	cmd = mainRepo.GitCommand(t, "commit", "-m", "main initial")
+	testutils.AddAuthorInfo(cmd, &timestamp)
+	require.NoError(t, cmd.Run(), "creating main commit")
+
+	// Make subm a submodule of main:
+	cmd = mainRepo.GitCommand(
+		t, "-c", "protocol.file.allow=always", "submodule", "add", submRepo.Path, "sub",
+	)
+	cmd.Dir = mainRepo.Path
+	require.NoError(t, cmd.Run(), "adding submodule")
+
+	cmd = mainRepo.GitCommand(t, "commit", "-m", "add submodule")
+	testutils.AddAuthorInfo(cmd, &timestamp)
+	require.NoError(t, cmd.Run(), "committing submodule to main")
+
+	// Analyze the main repo:
+	h, err := sizes.ScanRepositoryUsingGraph(
+		mainRepo.Repository(t),
+		refGrouper{}, sizes.NameStyleNone, meter.NoProgressMeter,
+		sizes.ScanOptions{},
+	)
+	require.NoError(t, err, "scanning repository")
+	assert.Equal(t, counts.Count32(2), h.UniqueBlobCount, "unique blob count")
+	assert.Equal(t, counts.Count32(2), h.MaxExpandedBlobCount, "max expanded blob count")
+	assert.Equal(t, counts.Count32(1), h.MaxExpandedSubmoduleCount, "max expanded submodule count")
+
+	// Analyze the submodule:
+	submRepo2 := testutils.TestRepo{
+		Path: filepath.Join(mainRepo.Path, "sub"),
+	}
+	// Its `.git` is a file pointing into the main repo's git dir:
+	assertGitDir(t, filepath.Join(mainRepo.Path, ".git", "modules", "sub"), submRepo2.Path)
+	h, err = sizes.ScanRepositoryUsingGraph(
+		submRepo2.Repository(t),
+		refGrouper{}, sizes.NameStyleNone, meter.NoProgressMeter,
+		sizes.ScanOptions{},
+	)
+	require.NoError(t, err, "scanning repository")
+	assert.Equal(t, counts.Count32(2), h.UniqueBlobCount, "unique blob count")
 	assert.Equal(t, counts.Count32(3), h.MaxExpandedBlobCount, "max expanded blob count")
 }
+
+// assertGitDir asserts that opening the repository at `path` yields
+// the absolute git dir `expected` (modulo symlinks in `expected`).
+func assertGitDir(t *testing.T, expected, path string) {
+	t.Helper()
+
+	expected, err := filepath.EvalSymlinks(expected)
+	require.NoError(t, err)
+
+	r, err := git.NewRepository(path)
+	require.NoError(t, err)
+	assert.True(t, filepath.IsAbs(r.Path()), "path %q is not absolute", r.Path())
+	assert.Equal(t, expected, r.Path())
+}
+
+func TestWorktree(t *testing.T) {
+	t.Parallel()
+
+	repo := testutils.NewTestRepo(t, false, "worktree")
+	t.Cleanup(func() { repo.Remove(t) })
+
+	timestamp := time.Unix(1112911993, 0)
+
+	repo.AddFile(t, "file.txt", "Hello, world!\n")
+	cmd := repo.GitCommand(t, "commit", "-m", "initial")
+	testutils.AddAuthorInfo(cmd, &timestamp)
+	require.NoError(t, cmd.Run(), "creating commit")
+
+	wt := filepath.Join(t.TempDir(), "wt")
+	cmd = repo.GitCommand(t, "worktree", "add", "-b", "other", wt)
+	require.NoError(t, cmd.Run(), "adding worktree")
+
+	assertGitDir(t, filepath.Join(repo.Path, ".git", "worktrees", "wt"), wt)
+
+	cmd = exec.Command(sizerExe(t), "--json", "--json-version=2")
+	cmd.Dir = wt
+	cmd.Env = testutils.CleanGitEnv()
+	out, err := cmd.Output()
+	require.NoError(t, err, "running git-sizer in worktree")
+
+	var output map[string]map[string]interface{}
+	require.NoError(t, json.Unmarshal(out, &output))
+	// Both branches are found via the worktree's common dir:
+	assert.Equal(t, 2.0, output["referenceCount"]["value"])
+	assert.Equal(t, 1.0, output["uniqueCommitCount"]["value"])
+}
+
+func TestSymlinkedRepository(t *testing.T) {
+	t.Parallel()
+
+	repo := testutils.NewTestRepo(t, false, "symlinked")
+	t.Cleanup(func() { repo.Remove(t) })
+
+	tmp := t.TempDir()
+
+	// A working directory whose `.git` is a symlink to the repo's
+	// git dir:
+	gitLink := filepath.Join(tmp, "gitlink")
+	require.NoError(t, os.Mkdir(gitLink, 0o777))
+	if err := os.Symlink(filepath.Join(repo.Path, ".git"), filepath.Join(gitLink, ".git")); err != nil {
+		t.Skipf("creating symlinks is not supported: %v", err)
+	}
+
+	// A symlink to the directory containing the repository:
+	parentLink := filepath.Join(tmp, "parent")
+	require.NoError(t, os.Symlink(filepath.Dir(repo.Path), parentLink))
+
+	gitDir := filepath.Join(repo.Path, ".git")
+
+	for _, p := range []struct {
+		name string
+		path string
+	}{
+		{"git-symlink", gitLink},
+		{"symlinked-parent", filepath.Join(parentLink, filepath.Base(repo.Path))},
+		{"symlinked-parent-subdir", filepath.Join(parentLink, filepath.Base(repo.Path), ".git", "refs")},
+	} {
+		p := p
+		t.Run(p.name, func(t *testing.T) {
+			assertGitDir(t, gitDir, p.path)
+		})
+	}
+}
+
+func TestRecurseSubmodules(t *testing.T) {
+	t.Parallel()
+
+	tmp := t.TempDir()
+
+	timestamp := time.Unix(1112911993, 0)
+
+	newRepo := func(name string) *testutils.TestRepo {
+		repo := &testutils.TestRepo{Path: filepath.Join(tmp, name)}
+		repo.Init(t, false)
+		return repo
+	}
+	commit := func(repo *testutils.TestRepo, msg string) {
+		t.Helper()
+		cmd := repo.GitCommand(t, "commit", "-m", msg)
+		testutils.AddAuthorInfo(cmd, &timestamp)
+		require.NoError(t, cmd.Run(), "creating commit")
+	}
+	runGit := func(repo *testutils.TestRepo, args ...string) {
+		t.Helper()
+		cmd := repo.GitCommand(t, append([]string{"-c", "protocol.file.allow=always"}, args...)...)
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, "running git %v: %s", args, out)
+	}
+
+	inner := newRepo("inner")
+	inner.AddFile(t, "big.bin", strings.Repeat("x", 3000))
+	commit(inner, "inner")
+
+	mid := newRepo("mid")
+	mid.AddFile(t, "mid.txt", "mid\n")
+	commit(mid, "mid")
+	runGit(mid, "submodule", "add", inner.Path, "in")
+	commit(mid, "add inner")
+
+	top := newRepo("top")
+	top.AddFile(t, "top.txt", "top\n")
+	commit(top, "top")
+	runGit(top, "submodule", "add", mid.Path, "mid")
+	runGit(top, "submodule", "add", inner.Path, "other")
+	commit(top, "add submodules")
+	runGit(top, "submodule", "update", "--init", "--recursive")
+	runGit(top, "submodule", "deinit", "-f", "other")
+	require.NoError(t, os.RemoveAll(filepath.Join(top.Path, ".git", "modules", "other")))
+
+	cmd := exec.Command(sizerExe(t), "--recurse-submodules", "--json", "--json-version=2")
+	cmd.Dir = top.Path
+	cmd.Env = testutils.CleanGitEnv()
+	out, err := cmd.Output()
+	require.NoError(t, err, "running git-sizer")
+
+	var output struct {
+		Submodules map[string]struct {
+			Skipped string `json:"skipped"`
+			Size    *struct {
+				UniqueBlobCount struct {
+					Value uint64 `json:"value"`
+				} `json:"uniqueBlobCount"`
+				Submodules map[string]json.RawMessage `json:"submodules"`
+			} `json:"size"`
+		} `json:"submodules"`
+		Combined struct {
+			RepositoryCount counts.Count32 `json:"repositoryCount"`
+			UniqueBlobCount counts.Count32 `json:"uniqueBlobCount"`
+			MaxBlobSize     counts.Count32 `json:"maxBlobSize"`
+		} `json:"combined"`
+	}
+	require.NoError(t, json.Unmarshal(out, &output))
+
+	require.Len(t, output.Submodules, 2)
+	if assert.NotNil(t, output.Submodules["mid"].Size) {
+		assert.Equal(t, uint64(2), output.Submodules["mid"].Size.UniqueBlobCount.Value)
+		assert.Contains(t, output.Submodules["mid"].Size.Submodules, "in")
+	}
+	assert.Equal(t, "not initialized", output.Submodules["other"].Skipped)
+	assert.Nil(t, output.Submodules["other"].Size)
+
+	assert.Equal(t, counts.Count32(3), output.Combined.RepositoryCount)
+	assert.Equal(t, counts.Count32(3000), output.Combined.MaxBlobSize)
+	// top.txt and .gitmodules, mid.txt and .gitmodules, and big.bin:
+	assert.Equal(t, counts.Count32(5), output.Combined.UniqueBlobCount)
+
+	cmd = exec.Command(sizerExe(t), "--recurse-submodules", "--no-progress")
+	cmd.Dir = top.Path
+	cmd.Env = testutils.CleanGitEnv()
+	out, err = cmd.Output()
+	require.NoError(t, err, "running git-sizer")
+	assert.Contains(t, string(out), "mid/in")
+	assert.Contains(t, string(out), "(skipped: not initialized)")
+	assert.Contains(t, string(out), "Combined total (3 repositories")
+}
+
+func TestByRemote(t *testing.T) {
+	t.Parallel()
+
+	repo := testutils.NewTestRepo(t, false, "by-remote")
+	t.Cleanup(func() { repo.Remove(t) })
+
+	timestamp := time.Unix(1112911993, 0)
+
+	runGit := func(args ...string) {
+		t.Helper()
+		cmd := repo.GitCommand(t, args...)
+		testutils.AddAuthorInfo(cmd, &timestamp)
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, "running git %v: %s", args, out)
+	}
+
+	repo.AddFile(t, "a.txt", "a\n")
+	runGit("commit", "-m", "initial")
+
+	// Create a commit on a throwaway branch and point `refname` at it
+	// instead:
+	remoteCommit := func(refname, path string, size int) {
+		t.Helper()
+		runGit("checkout", "-q", "-b", "tmp")
+		repo.AddFile(t, path, strings.Repeat("x", size))
+		runGit("commit", "-m", path)
+		runGit("update-ref", refname, "HEAD")
+		runGit("checkout", "-q", "-")
+		runGit("branch", "-q", "-D", "tmp")
+	}
+	remoteCommit("refs/remotes/origin/feature", "big.bin", 1000)
+	remoteCommit("refs/remotes/stale/old", "mid.bin", 500)
+	// This one is also reachable from the main branch:
+	runGit("update-ref", "refs/remotes/stale/main", "HEAD")
+
+	rs, err := sizes.ComputeRemoteSizes(context.Background(), repo.Repository(t), refGrouper{})
+	require.NoError(t, err)
+	require.Len(t, rs, 2)
+
+	// Each remote has a commit, a tree, and a blob of its own, and
+	// shares the initial commit, tree, and blob with the others:
+	origin := rs["origin"]
+	assert.Equal(t, counts.Count32(1), origin.ReferenceCount)
+	assert.Equal(t, counts.Count64(6), origin.ObjectCount)
+	assert.Equal(t, counts.Count64(3), origin.UniqueObjectCount)
+	assert.Less(t, uint64(1000), uint64(origin.UniqueObjectSize))
+	assert.Greater(t, uint64(origin.ObjectSize), uint64(origin.UniqueObjectSize))
+
+	stale := rs["stale"]
+	assert.Equal(t, counts.Count32(2), stale.ReferenceCount)
+	assert.Equal(t, counts.Count64(6), stale.ObjectCount)
+	assert.Equal(t, counts.Count64(3), stale.UniqueObjectCount)
+	assert.Less(t, uint64(500), uint64(stale.UniqueObjectSize))
+	assert.Greater(t, uint64(origin.UniqueObjectSize), uint64(stale.UniqueObjectSize))
+
+	cmd := exec.Command(sizerExe(t), "--by-remote", "--no-progress")
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	out, err := cmd.Output()
+	require.NoError(t, err, "running git-sizer")
+	assert.Contains(t, string(out), "Objects by remote")
+	assert.Regexp(t, `(?m)^    origin\s+1\s+6\s`, string(out))
+}
+
+func TestMaxRefsPerCommit(t *testing.T) {
+	t.Parallel()
+
+	repo := testutils.NewTestRepo(t, false, "refs-per-commit")
+	t.Cleanup(func() { repo.Remove(t) })
+
+	timestamp := time.Unix(1112911993, 0)
+
+	runGit := func(args ...string) {
+		t.Helper()
+		cmd := repo.GitCommand(t, args...)
+		testutils.AddAuthorInfo(cmd, &timestamp)
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, "running git %v: %s", args, out)
+	}
+
+	repo.AddFile(t, "a.txt", "a\n")
+	runGit("commit", "-m", "release")
+	for i := 0; i < 3; i++ {
+		runGit("tag", fmt.Sprintf("spam-%d", i))
+	}
+	// Annotated tags, including a tag of a tag, are peeled:
+	runGit("tag", "-m", "annotated", "annotated")
+	runGit("tag", "-m", "nested", "nested", "annotated")
+
+	repo.AddFile(t, "b.txt", "b\n")
+	runGit("commit", "-m", "later")
+
+	h, err := sizes.ScanRepositoryUsingGraph(
+		repo.Repository(t),
+		refGrouper{}, sizes.NameStyleFull, meter.NoProgressMeter,
+		sizes.ScanOptions{},
+	)
+	require.NoError(t, err, "scanning repository")
+	assert.Equal(t, counts.Count32(6), h.ReferenceCount)
+	assert.Equal(t, counts.Count32(5), h.MaxRefsPerCommit)
+	if assert.NotNil(t, h.MaxRefsPerCommitCommit) {
+		assert.Equal(t, "refs/tags/spam-2", h.MaxRefsPerCommitCommit.Path())
+	}
+}
+
+func TestFlagWarnings(t *testing.T) {
+	t.Parallel()
+
+	repo := testutils.NewTestRepo(t, false, "flag-warnings")
+	t.Cleanup(func() { repo.Remove(t) })
+
+	timestamp := time.Unix(1112911993, 0)
+	repo.AddFile(t, "a.txt", "a\n")
+	cmd := repo.GitCommand(t, "commit", "-m", "initial")
+	testutils.AddAuthorInfo(cmd, &timestamp)
+	require.NoError(t, cmd.Run(), "committing")
+
+	run := func(args ...string) string {
+		t.Helper()
+		cmd := exec.Command(sizerExe(t), append([]string{"--no-progress"}, args...)...)
+		cmd.Dir = repo.Path
+		cmd.Env = testutils.CleanGitEnv()
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		require.NoError(t, cmd.Run(), "running git-sizer %v", args)
+		return stderr.String()
+	}
+
+	for _, p := range []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"-v", "--critical"}, "warning: --critical overrides the earlier --verbose\n"},
+		{[]string{"--critical", "--threshold=2"}, "warning: --threshold=2 overrides the earlier --critical\n"},
+		{[]string{"--threshold=2", "-v", "--threshold=2"}, "warning: --threshold=2 overrides the earlier --verbose\n"},
+		{[]string{"--color=always", "--no-color"}, "warning: --no-color overrides the earlier --color=always\n"},
+		{[]string{"--branches", "--no-branches"}, "warning: --no-branches overrides the earlier --branches\n"},
+		{[]string{"--no-tags", "--tags"}, "warning: --tags overrides the earlier --no-tags\n"},
+		{[]string{"--progress", "--no-progress"}, "warning: --no-progress overrides the earlier --progress\n"},
+		{[]string{"--json-version=2"}, "warning: --json-version has no effect without --json\n"},
+		{[]string{"--json-stream", "--json-version=1"}, "warning: --json-version has no effect with --json-stream, which always uses version 2\n"},
+		{[]string{"--names=none", "--names-per-metric=3"}, "warning: --names-per-metric has no effect with --names=none\n"},
+	} {
+		assert.Equalf(t, p.expected, run(p.args...), "git-sizer %v", p.args)
+	}
+
+	// Combinations that are fine:
+	for _, args := range [][]string{
+		{"-v", "-v"},
+		{"--threshold=2", "--threshold=2"},
+		{"--json", "--json-version=2"},
+		{"--print-config", "--json-version=2"},
+		{"--branches", "--no-tags"},
+		{"--names=hash", "--names-per-metric=3"},
+	} {
+		assert.Emptyf(t, run(args...), "git-sizer %v", args)
+	}
+
+	// With --log-json, the warnings are logged:
+	out := run("--log-json", "-v", "--critical")
+	assert.Contains(t, out, `"level":"warning","message":"--critical overrides the earlier --verbose"`)
+	assert.NotContains(t, out, "warning: ")
+}
+
+func TestPrintConfig(t *testing.T) {
+	t.Parallel()
+
+	repo := testutils.NewTestRepo(t, false, "print-config")
+	t.Cleanup(func() { repo.Remove(t) })
+
+	repo.ConfigAdd(t, "sizer.threshold", "5")
+	repo.ConfigAdd(t, "refgroup.foo.include", "refs/heads/foo")
+
+	type setting struct {
+		Value  interface{} `json:"value"`
+		Source string      `json:"source"`
+		Key    string      `json:"key"`
+	}
+
+	printConfig := func(env []string, args ...string) map[string]setting {
+		t.Helper()
+		cmd := exec.Command(sizerExe(t), append([]string{"--print-config"}, args...)...)
+		cmd.Dir = repo.Path
+		cmd.Env = append(testutils.CleanGitEnv(), env...)
+		out, err := cmd.Output()
+		require.NoError(t, err, "running git-sizer")
+		var settings map[string]setting
+		require.NoError(t, json.Unmarshal(out, &settings))
+		return settings
+	}
+
+	settings := printConfig(
+		[]string{"NO_COLOR=1"},
+		"--no-tags", "--names=hash", "--path=src", "--exclude-path=src/x",
+	)
+	assert.Equal(t, setting{5.0, "gitconfig", "sizer.threshold"}, settings["threshold"])
+	assert.Equal(t, setting{"hash", "command line", ""}, settings["names"])
+	assert.Equal(t, setting{1.0, "default", ""}, settings["json-version"])
+	assert.Equal(t, setting{"auto", "environment", "NO_COLOR"}, settings["color"])
+	assert.Equal(
+		t,
+		setting{[]interface{}{"--path=src", "--exclude-path=src/x"}, "command line", ""},
+		settings["path"],
+	)
+	assert.Equal(
+		t,
+		setting{[]interface{}{"--exclude=refs/tags"}, "command line", ""},
+		settings["refs"],
+	)
+	assert.Equal(
+		t,
+		setting{[]interface{}{"refgroup.foo.include=refs/heads/foo"}, "gitconfig", ""},
+		settings["refgroups"],
+	)
+	assert.NotContains(t, settings, "critical")
+	assert.NotContains(t, settings, "no-tags")
+
+	// The command line overrides gitconfig:
+	settings = printConfig(nil, "--critical")
+	assert.Equal(t, setting{30.0, "command line", ""}, settings["threshold"])
+	assert.Equal(t, setting{"auto", "default", ""}, settings["color"])
+}
+
+func TestDoctor(t *testing.T) {
+	t.Parallel()
+
+	repo := testutils.NewTestRepo(t, false, "doctor")
+	t.Cleanup(func() { repo.Remove(t) })
+
+	timestamp := time.Unix(1112911993, 0)
+
+	runGit := func(dir string, args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+		cmd.Env = testutils.CleanGitEnv()
+		testutils.AddAuthorInfo(cmd, &timestamp)
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, "running git %v: %s", args, out)
+	}
+
+	for i := 0; i < 2; i++ {
+		repo.AddFile(t, fmt.Sprintf("file-%d.txt", i), fmt.Sprintf("%d\n", i))
+		runGit(repo.Path, "commit", "-m", fmt.Sprintf("commit %d", i))
+	}
+
+	doctor := func(dir string) (string, int) {
+		t.Helper()
+		cmd := exec.Command(sizerExe(t), "--doctor")
+		cmd.Dir = dir
+		cmd.Env = testutils.CleanGitEnv()
+		out, err := cmd.Output()
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return string(out), exitErr.ExitCode()
+		}
+		require.NoError(t, err)
+		return string(out), 0
+	}
+
+	// Without a commit-graph, there is a warning:
+	out, exitCode := doctor(repo.Path)
+	assert.Equal(t, 6, exitCode, out)
+	assert.Contains(t, out, "\npass  git version:    ")
+	assert.Contains(t, out, "\npass  shallow clone:  no\n")
+	assert.Contains(t, out, "\nwarn  commit-graph:   none;")
+	assert.Contains(t, out, "remedy: run 'git commit-graph write --reachable'\n")
+	assert.Contains(t, out, "\npass  objects:        about 6 stored")
+
+	runGit(repo.Path, "commit-graph", "write", "--reachable")
+	out, exitCode = doctor(repo.Path)
+	assert.Equal(t, 0, exitCode, out)
+	assert.NotContains(t, out, "remedy:")
+
+	// A shallow clone can't be scanned, and the doctor agrees:
+	shallow := filepath.Join(t.TempDir(), "shallow")
+	runGit(".", "clone", "-q", "--depth=1", "file://"+repo.Path, shallow)
+	out, exitCode = doctor(shallow)
+	assert.Equal(t, 1, exitCode, out)
+	assert.Contains(t, out, "\nFAIL  shallow clone:  ")
+	assert.Contains(t, out, "remedy: run 'git fetch --unshallow'")
+	_, err := git.NewRepository(shallow)
+	assert.Error(t, err)
+
+	// A partial clone can be scanned, but with a warning:
+	runGit(repo.Path, "config", "uploadpack.allowFilter", "true")
+	partial := filepath.Join(t.TempDir(), "partial")
+	runGit(".", "clone", "-q", "--filter=blob:none", "file://"+repo.Path, partial)
+	out, exitCode = doctor(partial)
+	assert.Equal(t, 6, exitCode, out)
+	assert.Contains(t, out, "\nwarn  partial clone:  yes;")
+
+	// Outside of a repository, it fails:
+	notRepo := t.TempDir()
+	cmd := exec.Command(sizerExe(t), "--doctor")
+	cmd.Dir = notRepo
+	cmd.Env = append(testutils.CleanGitEnv(), "GIT_CEILING_DIRECTORIES="+filepath.Dir(notRepo))
+	outBytes, err := cmd.Output()
+	var exitErr *exec.ExitError
+	if assert.ErrorAs(t, err, &exitErr) {
+		assert.Equal(t, 1, exitErr.ExitCode())
+	}
+	assert.Contains(t, string(outBytes), "\nFAIL  repository:     ")
+}
+
+func TestPreflight(t *testing.T) {
+	t.Parallel()
+
+	if runtime.GOOS == "windows" {
+		t.Skip("the git wrapper script requires a POSIX shell")
+	}
+
+	gitBin, err := exec.LookPath("git")
+	require.NoError(t, err)
+
+	preflight := func(path string) string {
+		t.Helper()
+		cmd := exec.Command(sizerExe(t), "--preflight")
+		cmd.Dir = t.TempDir()
+		cmd.Env = append(testutils.CleanGitEnv(), "PATH="+path)
+		out, err := cmd.Output()
+		require.NoError(t, err, "running git-sizer --preflight")
+		return string(out)
+	}
+
+	out := preflight(os.Getenv("PATH"))
+	assert.Contains(t, out, "git executable: ")
+	assert.Contains(t, out, "\nyes  cat-file %(objectsize:disk)  ")
+	assert.Contains(t, out, "\nyes  rev-list --missing  ")
+
+	// A git that can't create SHA-256 repositories:
+	binDir := t.TempDir()
+	require.NoError(t, os.WriteFile(
+		filepath.Join(binDir, "git"),
+		[]byte(fmt.Sprintf(
+			"#!/bin/sh\n"+
+				"for arg; do\n"+
+				"    if test \"$arg\" = --object-format=sha256; then\n"+
+				"        echo 'fatal: unknown hash algorithm' >&2\n"+
+				"        exit 128\n"+
+				"    fi\n"+
+				"done\n"+
+				"exec '%s' \"$@\"\n",
+			gitBin,
+		)),
+		0o755,
+	))
+	out = preflight(binDir + string(os.PathListSeparator) + os.Getenv("PATH"))
+	assert.Contains(t, out, "git executable: "+filepath.Join(binDir, "git")+"\n")
+	assert.Regexp(t, `\nno   SHA-256 object format +needed for .*\n +\(exit status 128: fatal: unknown hash algorithm\)\n`, out)
+	assert.Contains(t, out, "\nyes  rev-list --missing  ")
+}
+
+func TestOldGit(t *testing.T) {
+	t.Parallel()
+
+	if runtime.GOOS == "windows" {
+		t.Skip("the git wrapper script requires a POSIX shell")
+	}
+
+	repo := testutils.NewTestRepo(t, true, "old-git")
+	t.Cleanup(func() { repo.Remove(t) })
+
+	repo.CreateReferencedOrphan(t, "refs/heads/main")
+
+	gitBin, err := exec.LookPath("git")
+	require.NoError(t, err)
+
+	// fakeVersion returns a `PATH` in which `git version` reports
+	// `version`, but which otherwise runs the real git:
+	fakeVersion := func(version string) (string, string) {
+		t.Helper()
+		binDir := t.TempDir()
+		require.NoError(t, os.WriteFile(
+			filepath.Join(binDir, "git"),
+			[]byte(fmt.Sprintf(
+				"#!/bin/sh\n"+
+					"if test \"$1\" = version; then\n"+
+					"    echo 'git version %s'\n"+
+					"    exit 0\n"+
+					"fi\n"+
+					"exec '%s' \"$@\"\n",
+				version, gitBin,
+			)),
+			0o755,
+		))
+		return filepath.Join(binDir, "git"), binDir + string(os.PathListSeparator) + os.Getenv("PATH")
+	}
+
+	run := func(path string, args ...string) (string, string, error) {
+		t.Helper()
+		cmd := exec.Command(sizerExe(t), append([]string{"--no-progress"}, args...)...)
+		cmd.Dir = repo.Path
+		cmd.Env = append(testutils.CleanGitEnv(), "PATH="+path)
+		var stdout, stderr bytes.Buffer
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+		err := cmd.Run()
+		return stdout.String(), stderr.String(), err
+	}
+
+	// A recent git:
+	_, stderr, err := run(os.Getenv("PATH"))
+	require.NoError(t, err, "running git-sizer")
+	assert.NotContains(t, stderr, "warning")
+
+	// A git that is supported, but lacks some features:
+	path, env := fakeVersion("2.25.1")
+	stdout, stderr, err := run(env, "--json", "--json-version=2")
+	require.NoError(t, err, "running git-sizer")
+	assert.Equal(
+		t,
+		"warning: git 2.25.1 ("+path+") is old, so these features are unavailable: "+
+			"SHA-256 object format (git 2.29.0 or newer; "+
+			"needed for scanning repositories that use SHA-256 object IDs)\n",
+		stderr,
+	)
+	var j struct {
+		GitLimitations sizes.GitLimitations `json:"gitLimitations"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(stdout), &j))
+	assert.Equal(t, "2.25.1", j.GitLimitations.Version)
+	assert.Equal(t, path, j.GitLimitations.Path)
+	if assert.Len(t, j.GitLimitations.Unavailable, 1) {
+		assert.Equal(t, "SHA-256 object format", j.GitLimitations.Unavailable[0].Name)
+		assert.Equal(t, "2.29.0", j.GitLimitations.Unavailable[0].Since)
+	}
+
+	stdout, _, _ = run(env, "--doctor")
+	assert.Regexp(t, `warn +git version: +2\.25\.1 lacks SHA-256 object format \(git 2\.29\.0\)`, stdout)
+
+	// A git that is too old to use at all:
+	path, env = fakeVersion("2.17.1")
+	_, stderr, err = run(env)
+	assert.Error(t, err)
+	assert.Contains(
+		t, stderr,
+		path+": git 2.17.1 is too old; git-sizer requires git 2.19.0 or newer",
+	)
+}
+
+func TestRefSharing(t *testing.T) {
+	t.Parallel()
+
+	repo := testutils.NewTestRepo(t, false, "ref-sharing")
+	t.Cleanup(func() { repo.Remove(t) })
+
+	timestamp := time.Unix(1112911993, 0)
+
+	runGit := func(args ...string) {
+		t.Helper()
+		cmd := repo.GitCommand(t, args...)
+		testutils.AddAuthorInfo(cmd, &timestamp)
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, "running git %v: %s", args, out)
+	}
+
+	repo.AddFile(t, "base.txt", strings.Repeat("x", 10))
+	runGit("commit", "-m", "base")
+
+	runGit("checkout", "-q", "-b", "a")
+	repo.AddFile(t, "a.bin", strings.Repeat("a", 100))
+	runGit("commit", "-m", "a")
+
+	runGit("checkout", "-q", "-b", "b", "master")
+	repo.AddFile(t, "b.bin", strings.Repeat("b", 1000))
+	runGit("commit", "-m", "b")
+	// "b.bin" is also reachable from "c", so it isn't exclusive:
+	runGit("branch", "c")
+
+	rs, err := sizes.ComputeRefSharing(context.Background(), repo.Repository(t), refGrouper{})
+	require.NoError(t, err)
+	assert.Equal(t, counts.Count32(4), rs.RefCount)
+	assert.Equal(t, counts.Count32(3), rs.BlobCount)
+	assert.Equal(t, counts.Count64(1110), rs.BlobSize)
+	assert.Equal(t, counts.Count32(1), rs.SharedBlobCount)
+	assert.Equal(t, counts.Count64(10), rs.SharedBlobSize)
+	assert.Equal(t, counts.Count32(1), rs.ExclusiveBlobCount)
+	assert.Equal(t, counts.Count64(100), rs.ExclusiveBlobSize)
+	assert.Equal(
+		t,
+		[]sizes.ExclusiveContent{{Refname: "refs/heads/a", BlobCount: 1, BlobSize: 100}},
+		rs.Exclusive,
+	)
+
+	// Only the included references count:
+	cmd := exec.Command(
+		sizerExe(t), "--no-progress", "--json", "--json-version=2",
+		"--ref-sharing", "--exclude=refs/heads/c",
+	)
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	out, err := cmd.Output()
+	require.NoError(t, err, "running git-sizer")
+	var j struct {
+		RefSharing struct {
+			RefCount          counts.Count32 `json:"refCount"`
+			ExclusiveBlobSize counts.Count64 `json:"exclusiveBlobSize"`
+			Exclusive         []struct {
+				Refname string `json:"refname"`
+			} `json:"exclusive"`
+		} `json:"refSharing"`
+	}
+	require.NoError(t, json.Unmarshal(out, &j))
+	assert.Equal(t, counts.Count32(3), j.RefSharing.RefCount)
+	assert.Equal(t, counts.Count64(1100), j.RefSharing.ExclusiveBlobSize)
+	if assert.Len(t, j.RefSharing.Exclusive, 2) {
+		assert.Equal(t, "refs/heads/b", j.RefSharing.Exclusive[0].Refname)
+	}
+}
+
+func TestNamespaceObjects(t *testing.T) {
+	t.Parallel()
+
+	repo := testutils.NewTestRepo(t, false, "namespace-objects")
+	t.Cleanup(func() { repo.Remove(t) })
+
+	timestamp := time.Unix(1112911993, 0)
+
+	runGit := func(args ...string) {
+		t.Helper()
+		cmd := repo.GitCommand(t, args...)
+		testutils.AddAuthorInfo(cmd, &timestamp)
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, "running git %v: %s", args, out)
+	}
+
+	repo.AddFile(t, "a.txt", "a\n")
+	runGit("commit", "-m", "one")
+	// The first commit is shared by the branch and the tag, but the
+	// tag object itself is exclusive to the tags:
+	runGit("tag", "-a", "-m", "release", "v1")
+
+	repo.AddFile(t, "b.txt", "b\n")
+	runGit("commit", "-m", "two")
+
+	runGit("checkout", "-q", "-b", "side", "HEAD~1")
+	repo.AddFile(t, "c.txt", "c\n")
+	runGit("commit", "-m", "three")
+	runGit("update-ref", "refs/remotes/origin/side", "HEAD")
+	runGit("checkout", "-q", "master")
+	runGit("branch", "-D", "side")
+
+	nso, err := sizes.ComputeNamespaceObjects(context.Background(), repo.Repository(t), refGrouper{})
+	require.NoError(t, err)
+
+	for namespace, expected := range map[string]sizes.NamespaceObjectCounts{
+		"heads":   {RefCount: 1, CommitCount: 1, TreeCount: 1, BlobCount: 1},
+		"tags":    {RefCount: 1, TagCount: 1},
+		"remotes": {RefCount: 1, CommitCount: 1, TreeCount: 1, BlobCount: 1},
+		"notes":   {},
+		"pulls":   {},
+		"other":   {},
+		"shared":  {CommitCount: 1, TreeCount: 1, BlobCount: 1},
+		"total":   {CommitCount: 3, TreeCount: 3, BlobCount: 3, TagCount: 1},
+	} {
+		actual := nso[namespace]
+		// The sizes aren't predictable, but they should be
+		// consistent with the counts:
+		if expected == (sizes.NamespaceObjectCounts{RefCount: expected.RefCount}) {
+			assert.Zero(t, actual.Size, namespace)
+		} else {
+			assert.NotZero(t, actual.Size, namespace)
+		}
+		actual.Size, actual.DiskSize = 0, 0
+		assert.Equal(t, expected, actual, namespace)
+	}
+
+	var sum counts.Count64
+	for _, namespace := range append(sizes.ReferenceNamespaces, "shared") {
+		sum += nso[namespace].Size
+	}
+	assert.Equal(t, nso["total"].Size, sum)
+
+	cmd := exec.Command(sizerExe(t), "--no-progress", "--by-namespace", "--exclude=refs/tags")
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	out, err := cmd.Output()
+	require.NoError(t, err, "running git-sizer")
+	assert.Contains(t, string(out), "\nObjects reachable exclusively from each reference namespace:\n\n")
+	assert.Regexp(t, `\n    heads +1 +1 +1 +1 +0 `, string(out))
+	assert.Regexp(t, `\n    remotes +1 +1 +1 +1 +0 `, string(out))
+	assert.NotContains(t, string(out), "\n    tags ")
+	assert.Regexp(t, `\n    total +3 +3 +3 +0 `, string(out))
+
+	cmd = exec.Command(sizerExe(t), "--no-progress", "--by-namespace", "--json", "--json-version=2")
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	out, err = cmd.Output()
+	require.NoError(t, err, "running git-sizer")
+	var j struct {
+		Namespaces map[string]map[string]uint64 `json:"namespaces"`
+	}
+	require.NoError(t, json.Unmarshal(out, &j))
+	assert.Equal(t, uint64(1), j.Namespaces["tags"]["tagCount"])
+	assert.Equal(t, uint64(3), j.Namespaces["total"]["commitCount"])
+}
+
+func TestCompareRepo(t *testing.T) {
+	t.Parallel()
+
+	upstream := testutils.NewTestRepo(t, false, "compare-repo-upstream")
+	t.Cleanup(func() { upstream.Remove(t) })
+
+	timestamp := time.Unix(1112911993, 0)
+
+	gitOutput := func(repo *testutils.TestRepo, stdin string, args ...string) string {
+		t.Helper()
+		cmd := repo.GitCommand(t, args...)
+		testutils.AddAuthorInfo(cmd, &timestamp)
+		cmd.Stdin = strings.NewReader(stdin)
+		out, err := cmd.Output()
+		require.NoError(t, err, "running git %v", args)
+		return strings.TrimSpace(string(out))
+	}
+
+	upstream.AddFile(t, "base.txt", "base\n")
+	gitOutput(upstream, "", "commit", "-m", "base")
+
+	fork := upstream.Clone(t, "compare-repo-fork")
+	t.Cleanup(func() { fork.Remove(t) })
+
+	// Each repository gets a commit, a tree, and a blob of its own:
+	upstream.AddFile(t, "upstream.txt", "upstream\n")
+	gitOutput(upstream, "", "commit", "-m", "upstream")
+
+	blob := gitOutput(fork, "fork\n", "hash-object", "-w", "--stdin")
+	tree := gitOutput(fork, fmt.Sprintf("100644 blob %s\tfork.txt\n", blob), "mktree")
+	commit := gitOutput(fork, "", "commit-tree", "-p", "master", "-m", "fork", tree)
+	gitOutput(fork, "", "update-ref", "refs/heads/master", commit)
+
+	rc, err := sizes.ComputeRepoComparison(
+		context.Background(), fork.Repository(t), refGrouper{},
+		upstream.Repository(t), upstream.Path,
+	)
+	require.NoError(t, err)
+	assert.Equal(t, upstream.Path, rc.Path)
+	assert.Equal(t, counts.Count64(3), rc.SharedCount)
+	assert.Equal(t, counts.Count64(3), rc.UniqueCount)
+	assert.Equal(t, counts.Count64(3), rc.OtherUniqueCount)
+	assert.NotZero(t, rc.SharedSize)
+	assert.NotZero(t, rc.UniqueSize)
+	assert.NotZero(t, rc.OtherUniqueSize)
+
+	cmd := exec.Command(sizerExe(t), "--no-progress", "--compare-repo", upstream.Path)
+	cmd.Dir = fork.Path
+	cmd.Env = testutils.CleanGitEnv()
+	out, err := cmd.Output()
+	require.NoError(t, err, "running git-sizer")
+	assert.Contains(t, string(out), fmt.Sprintf("\nObjects compared with '%s':\n\n", upstream.Path))
+	assert.Regexp(t, `\n    Shared +3 +\d+ B\n`, string(out))
+	assert.Regexp(t, `\n    Only in this repository +3 +\d+ B\n`, string(out))
+
+	cmd = exec.Command(
+		sizerExe(t), "--no-progress", "--compare-repo", filepath.Join(upstream.Path, "nonexistent"),
+	)
+	cmd.Dir = fork.Path
+	cmd.Env = testutils.CleanGitEnv()
+	out, err = cmd.CombinedOutput()
+	assert.Error(t, err)
+	assert.Contains(t, string(out), "couldn't open Git repository")
+}
+
+func TestWhy(t *testing.T) {
+	t.Parallel()
+
+	repo := testutils.NewTestRepo(t, false, "why")
+	t.Cleanup(func() { repo.Remove(t) })
+
+	timestamp := time.Unix(1112911993, 0)
+
+	runGit := func(args ...string) string {
+		t.Helper()
+		cmd := repo.GitCommand(t, args...)
+		testutils.AddAuthorInfo(cmd, &timestamp)
+		out, err := cmd.Output()
+		require.NoError(t, err, "running git %v", args)
+		return strings.TrimSpace(string(out))
+	}
+
+	repo.AddFile(t, "README", "hello\n")
+	runGit("commit", "-m", "initial")
+	runGit("checkout", "-q", "-b", "side")
+	repo.AddFile(t, "big/data/huge.bin", "lots of data\n")
+	runGit("commit", "-m", "add data")
+	runGit("checkout", "-q", "master")
+	repo.AddFile(t, "other.txt", "other\n")
+	runGit("commit", "-m", "other")
+	runGit("merge", "--no-edit", "side")
+	runGit("rm", "-q", "big/data/huge.bin")
+	runGit("commit", "-m", "remove data")
+	runGit("branch", "-D", "side")
+	runGit("tag", "old", "master~2")
+
+	blob := runGit("rev-parse", "master~1:big/data/huge.bin")
+	commit := runGit("rev-parse", "master~1^2")
+	unreachable := repo.CreateObject(t, "blob", func(w io.Writer) error {
+		_, err := io.WriteString(w, "unreachable\n")
+		return err
+	})
+
+	cmd := exec.Command(
+		sizerExe(t), "--json", "--why", blob, "--why", commit, "--why", unreachable.String(),
+	)
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	out, err := cmd.Output()
+	require.NoError(t, err, "running git-sizer")
+
+	type link struct {
+		OID  string `json:"oid"`
+		Name string `json:"name"`
+	}
+	type reachability struct {
+		Reachable bool   `json:"reachable"`
+		Ref       string `json:"ref"`
+		Chain     []link `json:"chain"`
+	}
+	var rs []reachability
+	require.NoError(t, json.Unmarshal(out, &rs))
+	require.Len(t, rs, 3)
+
+	names := func(r reachability) []string {
+		var names []string
+		for _, link := range r.Chain {
+			names = append(names, link.Name)
+		}
+		return names
+	}
+
+	assert.True(t, rs[0].Reachable)
+	assert.Equal(t, "refs/heads/master", rs[0].Ref)
+	assert.Equal(
+		t,
+		[]string{
+			"refs/heads/master",
+			"refs/heads/master~1",
+			"refs/heads/master~1:",
+			"refs/heads/master~1:big",
+			"refs/heads/master~1:big/data",
+			"refs/heads/master~1:big/data/huge.bin",
+		},
+		names(rs[0]),
+	)
+	assert.Equal(t, blob, rs[0].Chain[len(rs[0].Chain)-1].OID)
+
+	assert.True(t, rs[1].Reachable)
+	assert.Equal(t, []string{"refs/heads/master", "refs/heads/master~1^2"}, names(rs[1]))
+
+	assert.False(t, rs[2].Reachable)
+	assert.Empty(t, rs[2].Chain)
+
+	// Without the branch, the blob is only reachable via the tag:
+	cmd = exec.Command(sizerExe(t), "--why", blob, "--exclude=refs/heads/master")
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	out, err = cmd.Output()
+	require.NoError(t, err, "running git-sizer")
+	assert.Contains(t, string(out), "is not reachable from any of the scanned references")
+
+	runGit("tag", "data", "master~1")
+	cmd = exec.Command(sizerExe(t), "--why", blob, "--exclude=refs/heads/master")
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	out, err = cmd.Output()
+	require.NoError(t, err, "running git-sizer")
+	assert.Contains(t, string(out), "refs/tags/data:big/data/huge.bin")
+}
+
+func TestObjectsFrom(t *testing.T) {
+	t.Parallel()
+
+	repo := testutils.NewTestRepo(t, false, "objects-from")
+	t.Cleanup(func() { repo.Remove(t) })
+
+	timestamp := time.Unix(1112911993, 0)
+
+	runGit := func(args ...string) string {
+		t.Helper()
+		cmd := repo.GitCommand(t, args...)
+		testutils.AddAuthorInfo(cmd, &timestamp)
+		out, err := cmd.Output()
+		require.NoError(t, err, "running git %v", args)
+		return strings.TrimSpace(string(out))
+	}
+
+	repo.AddFile(t, "dir/old.bin", strings.Repeat("o", 100))
+	runGit("commit", "-m", "initial")
+	oldBlob := runGit("rev-parse", "HEAD:dir/old.bin")
+	runGit("rm", "-q", "dir/old.bin")
+	repo.AddFile(t, "new.txt", "new\n")
+	runGit("commit", "-m", "second")
+	newBlob := runGit("rev-parse", "HEAD:new.txt")
+	head := runGit("rev-parse", "HEAD")
+
+	dangling := repo.CreateObject(t, "blob", func(w io.Writer) error {
+		_, err := io.WriteString(w, "dangling\n")
+		return err
+	})
+	missing := strings.Repeat("1", 40)
+
+	// The input can be in the format of `git fsck` output:
+	input := fmt.Sprintf(
+		"# suspicious objects\n%s\n%s\ndangling blob %s\nmissing blob %s\n%s\n\n%s\n",
+		newBlob, oldBlob, dangling, missing, head, newBlob,
+	)
+
+	cmd := exec.Command(
+		sizerExe(t), "--no-progress", "--json", "--json-version=2", "--objects-from=-",
+	)
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	cmd.Stdin = strings.NewReader(input)
+	out, err := cmd.Output()
+	require.NoError(t, err, "running git-sizer")
+
+	var j struct {
+		ObjectLookups []struct {
+			OID        string `json:"oid"`
+			ObjectType string `json:"type"`
+			Size       uint64 `json:"size"`
+			Reachable  bool   `json:"reachable"`
+			Name       string `json:"name"`
+			Ref        string `json:"ref"`
+		} `json:"objectLookups"`
+	}
+	require.NoError(t, json.Unmarshal(out, &j))
+	require.Len(t, j.ObjectLookups, 5)
+
+	l := j.ObjectLookups[0]
+	assert.Equal(t, newBlob, l.OID)
+	assert.Equal(t, "blob", l.ObjectType)
+	assert.Equal(t, uint64(4), l.Size)
+	assert.True(t, l.Reachable)
+	assert.Equal(t, "refs/heads/master:new.txt", l.Name)
+	assert.Equal(t, "refs/heads/master", l.Ref)
+
+	// This blob is only in the history, so it is named by the commit
+	// that contains it, and a reference that contains that commit is
+	// looked up:
+	l = j.ObjectLookups[1]
+	assert.Equal(t, oldBlob, l.OID)
+	assert.True(t, l.Reachable)
+	assert.Regexp(t, `^[0-9a-f]{40}:dir/old.bin$`, l.Name)
+	assert.Equal(t, "refs/heads/master", l.Ref)
+
+	l = j.ObjectLookups[2]
+	assert.Equal(t, dangling.String(), l.OID)
+	assert.Equal(t, "blob", l.ObjectType)
+	assert.False(t, l.Reachable)
+	assert.Empty(t, l.Name)
+
+	l = j.ObjectLookups[3]
+	assert.Equal(t, missing, l.OID)
+	assert.Equal(t, "missing", l.ObjectType)
+	assert.False(t, l.Reachable)
+
+	l = j.ObjectLookups[4]
+	assert.Equal(t, head, l.OID)
+	assert.Equal(t, "commit", l.ObjectType)
+	assert.Equal(t, "refs/heads/master", l.Name)
+
+	path := filepath.Join(repo.Path, "oids.txt")
+	require.NoError(t, ioutil.WriteFile(path, []byte(input), 0o644))
+	cmd = exec.Command(sizerExe(t), "--no-progress", "--objects-from", path)
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	out, err = cmd.Output()
+	require.NoError(t, err, "running git-sizer")
+	assert.Contains(t, string(out), "\nLooked-up objects (5):\n\n")
+	assert.Contains(t, string(out), fmt.Sprintf("    %s  blob           4 B  refs/heads/master:new.txt\n", newBlob))
+	assert.Regexp(t, oldBlob+`  blob         100 B  [0-9a-f]{40}:dir/old.bin \(reachable from refs/heads/master\)\n`, string(out))
+	assert.Contains(t, string(out), fmt.Sprintf("    %s  blob           9 B  not reachable from the scanned references\n", dangling))
+	assert.Contains(t, string(out), fmt.Sprintf("    %s  missing\n", missing))
+}
+
+func TestTagOnly(t *testing.T) {
+	t.Parallel()
+
+	repo := testutils.NewTestRepo(t, false, "tag-only")
+	t.Cleanup(func() { repo.Remove(t) })
+
+	timestamp := time.Unix(1112911993, 0)
+
+	runGit := func(args ...string) {
+		t.Helper()
+		cmd := repo.GitCommand(t, args...)
+		testutils.AddAuthorInfo(cmd, &timestamp)
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, "running git %v: %s", args, out)
+	}
+
+	repo.AddFile(t, "a.txt", "a\n")
+	runGit("commit", "-m", "initial")
+	// This tag only points at content that is also on a branch:
+	runGit("tag", "v1")
+
+	// A release commit that is only tagged, with an annotated tag:
+	runGit("checkout", "-q", "-b", "release")
+	repo.AddFile(t, "release.bin", strings.Repeat("r", 1000))
+	runGit("commit", "-m", "release")
+	runGit("tag", "-m", "release 2", "v2")
+	runGit("checkout", "-q", "master")
+	runGit("branch", "-q", "-D", "release")
+
+	out, err := repo.GitCommand(t, "cat-file", "-s", "v2^{commit}").Output()
+	require.NoError(t, err)
+	commitSize, err := strconv.ParseUint(strings.TrimSpace(string(out)), 10, 64)
+	require.NoError(t, err)
+
+	tos, err := sizes.ComputeTagOnlySize(context.Background(), repo.Repository(t), refGrouper{})
+	require.NoError(t, err)
+	assert.Equal(t, counts.Count32(2), tos.TagCount)
+	assert.Equal(t, counts.Count32(1), tos.BranchCount)
+	assert.Equal(t, counts.Count64(1), tos.CommitCount)
+	assert.Equal(t, counts.Count64(commitSize), tos.CommitSize)
+	assert.Equal(t, counts.Count64(1), tos.BlobCount)
+	assert.Equal(t, counts.Count64(1000), tos.BlobSize)
+	// The commit, its tree, the blob, and the annotated tag:
+	assert.Equal(t, counts.Count64(4), tos.ObjectCount)
+	assert.Less(t, uint64(tos.CommitSize+tos.BlobSize), uint64(tos.ObjectSize))
+
+	cmd := exec.Command(sizerExe(t), "--tag-only", "--no-progress")
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	out, err = cmd.Output()
+	require.NoError(t, err, "running git-sizer")
+	assert.Contains(t, string(out), "\nObjects reachable from tags (2) but not from any branch (1):\n")
+	assert.Contains(t, string(out), "\n    Blobs                   1      1000 B\n")
+
+	// The release is everything except for the annotated tag itself:
+	out, err = repo.GitCommand(t, "cat-file", "-s", "v2").Output()
+	require.NoError(t, err)
+	tagSize, err := strconv.ParseUint(strings.TrimSpace(string(out)), 10, 64)
+	require.NoError(t, err)
+	assert.Equal(t, counts.Count32(1), tos.AnnotatedTagCount)
+	assert.Equal(t, counts.Count64(3), tos.ReleaseObjectCount)
+	assert.Equal(t, tos.ObjectSize-counts.Count64(tagSize), tos.ReleaseObjectSize)
+
+	// Content that is only reachable from lightweight tags isn't part
+	// of a release:
+	runGit("checkout", "-q", "-b", "snapshot")
+	repo.AddFile(t, "snapshot.bin", strings.Repeat("s", 500))
+	runGit("commit", "-m", "snapshot")
+	runGit("tag", "snapshot")
+	runGit("checkout", "-q", "master")
+	runGit("branch", "-q", "-D", "snapshot")
+
+	tos, err = sizes.ComputeTagOnlySize(context.Background(), repo.Repository(t), refGrouper{})
+	require.NoError(t, err)
+	assert.Equal(t, counts.Count64(1500), tos.BlobSize)
+	assert.Equal(t, counts.Count64(3), tos.ReleaseObjectCount)
+
+	cmd = exec.Command(sizerExe(t), "--tag-only", "--no-progress", "--json", "--json-version=2")
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	out, err = cmd.Output()
+	require.NoError(t, err, "running git-sizer")
+	var j map[string]json.RawMessage
+	require.NoError(t, json.Unmarshal(out, &j))
+	assert.Contains(t, j, "releaseObjectSize")
+}
+
+func TestNotesOnly(t *testing.T) {
+	t.Parallel()
+
+	repo := testutils.NewTestRepo(t, false, "notes-only")
+	t.Cleanup(func() { repo.Remove(t) })
+
+	timestamp := time.Unix(1112911993, 0)
+
+	runGit := func(args ...string) {
+		t.Helper()
+		cmd := repo.GitCommand(t, args...)
+		testutils.AddAuthorInfo(cmd, &timestamp)
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, "running git %v: %s", args, out)
+	}
+
+	repo.AddFile(t, "a.txt", "a\n")
+	runGit("commit", "-m", "initial")
+
+	nos, err := sizes.ComputeNotesOnlySize(context.Background(), repo.Repository(t), refGrouper{})
+	require.NoError(t, err)
+	assert.Equal(t, counts.Count32(0), nos.NotesRefCount)
+	assert.Equal(t, counts.Count64(0), nos.ObjectCount)
+	assert.Contains(t, nos.String(), "No notes references were included")
+
+	runGit("notes", "add", "-m", strings.Repeat("n", 2000), "HEAD")
+	runGit("notes", "--ref=review", "add", "-m", "ok", "HEAD")
+
+	nos, err = sizes.ComputeNotesOnlySize(context.Background(), repo.Repository(t), refGrouper{})
+	require.NoError(t, err)
+	assert.Equal(t, counts.Count32(2), nos.NotesRefCount)
+	assert.Equal(t, counts.Count32(1), nos.OtherRefCount)
+	// Each notes reference has a commit, a tree, and a blob of its
+	// own; the annotated commit is reachable from the branch:
+	assert.Equal(t, counts.Count64(6), nos.ObjectCount)
+	if assert.Len(t, nos.Refs, 2) {
+		assert.Equal(t, "refs/notes/commits", nos.Refs[0].Refname)
+		assert.Equal(t, counts.Count64(3), nos.Refs[0].ObjectCount)
+		assert.Less(t, uint64(2001), uint64(nos.Refs[0].ObjectSize))
+		assert.Equal(t, "refs/notes/review", nos.Refs[1].Refname)
+		assert.Equal(
+			t, nos.ObjectSize, nos.Refs[0].ObjectSize+nos.Refs[1].ObjectSize,
+		)
+	}
+
+	cmd := exec.Command(sizerExe(t), "--notes-only", "--no-progress")
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	out, err := cmd.Output()
+	require.NoError(t, err, "running git-sizer")
+	assert.Contains(
+		t, string(out),
+		"\nObjects reachable from notes references (2) but not from any other reference (1):\n",
+	)
+	assert.Contains(t, string(out), "\n    refs/notes/commits             3    2.21 KiB\n")
+
+	// Excluded notes references don't count:
+	cmd = exec.Command(
+		sizerExe(t), "--notes-only", "--no-progress", "--json", "--json-version=2",
+		"--exclude=refs/notes/review",
+	)
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	out, err = cmd.Output()
+	require.NoError(t, err, "running git-sizer")
+	var j struct {
+		NotesOnly struct {
+			NotesRefCount counts.Count32 `json:"notesRefCount"`
+			ObjectCount   counts.Count64 `json:"objectCount"`
+		} `json:"notesOnly"`
+	}
+	require.NoError(t, json.Unmarshal(out, &j))
+	assert.Equal(t, counts.Count32(1), j.NotesOnly.NotesRefCount)
+	assert.Equal(t, counts.Count64(3), j.NotesOnly.ObjectCount)
+}
+
+func TestLogJSON(t *testing.T) {
+	t.Parallel()
+
+	repo := testutils.NewTestRepo(t, true, "log-json")
+	t.Cleanup(func() { repo.Remove(t) })
+
+	repo.CreateReferencedOrphan(t, "refs/heads/main")
+
+	// Write a loose reference that points at an object that doesn't
+	// exist:
+	path := filepath.Join(repo.Path, "refs", "heads", "broken")
+	require.NoError(t, ioutil.WriteFile(path, []byte(strings.Repeat("1", 40)+"\n"), 0o644))
+
+	readRecords := func(stderr []byte) []map[string]interface{} {
+		t.Helper()
+		var records []map[string]interface{}
+		for _, line := range strings.Split(strings.TrimSuffix(string(stderr), "\n"), "\n") {
+			var r map[string]interface{}
+			require.NoError(t, json.Unmarshal([]byte(line), &r), "parsing %q", line)
+			assert.Contains(t, r, "time")
+			records = append(records, r)
+		}
+		return records
+	}
+
+	cmd := exec.Command(sizerExe(t), "--log-json", "--progress", "--json", "--json-version=2")
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	require.NoError(t, cmd.Run(), "running git-sizer")
+
+	// The data output is unaffected:
+	var output map[string]interface{}
+	require.NoError(t, json.Unmarshal(stdout.Bytes(), &output))
+
+	var phases []string
+	var warnings []string
+	var refSummary interface{}
+	for _, r := range readRecords(stderr.Bytes()) {
+		switch r["message"] {
+		case "phase started":
+			phases = append(phases, r["fields"].(map[string]interface{})["phase"].(string))
+		case "phase finished":
+			fields := r["fields"].(map[string]interface{})
+			if fields["phase"] == "Enumerating references" {
+				refSummary = fields["summary"]
+			}
+		case "references point at missing objects and were skipped":
+			assert.Equal(t, "warning", r["level"])
+			warnings = append(warnings, r["message"].(string))
+		}
+	}
+	if assert.NotEmpty(t, phases) {
+		assert.Equal(t, "Enumerating references", phases[0])
+	}
+	assert.Contains(t, phases, "Processing blobs")
+	assert.Contains(t, phases, "Processing references")
+	// The broken reference is seen, but not walked:
+	assert.Equal(t, "Enumerating references: 1 of 2 included", refSummary)
+	assert.Len(t, warnings, 1)
+
+	cmd = exec.Command(sizerExe(t), "--log-json", "--sample-rate=2")
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	stderr.Reset()
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	require.Error(t, err)
+	records := readRecords(stderr.Bytes())
+	require.Len(t, records, 1)
+	assert.Equal(t, "error", records[0]["level"])
+	assert.Contains(t, records[0]["message"], "--sample-rate")
+}
+
+func TestCheckSubmodules(t *testing.T) {
+	t.Parallel()
+
+	repo := testutils.NewTestRepo(t, false, "check-submodules")
+	t.Cleanup(func() { repo.Remove(t) })
+
+	timestamp := time.Unix(1112911993, 0)
+
+	runGit := func(args ...string) {
+		t.Helper()
+		cmd := repo.GitCommand(t, args...)
+		testutils.AddAuthorInfo(cmd, &timestamp)
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, "running git %v: %s", args, out)
+	}
+
+	repo.AddFile(t, "file.txt", "Hello, world!\n")
+	runGit("commit", "-m", "initial")
+	target := strings.Repeat("1", 40)
+
+	// `lib` is configured properly, but `gone` has no gitlink:
+	repo.AddFile(
+		t, ".gitmodules",
+		"[submodule \"lib\"]\n\tpath = lib\n\turl = https://example.com/lib.git\n"+
+			"[submodule \"gone\"]\n\tpath = gone\n\turl = https://example.com/gone.git\n",
+	)
+	runGit("update-index", "--add", "--cacheinfo", "160000,"+target+",lib")
+	runGit("commit", "-m", "add submodules")
+	runGit("branch", "copy")
+
+	// `old` is a leftover gitlink that isn't in `.gitmodules`:
+	runGit("checkout", "-q", "-b", "stale")
+	runGit("update-index", "--add", "--cacheinfo", "160000,"+target+",old")
+	runGit("commit", "-m", "add leftover gitlink")
+	runGit("checkout", "-q", "-")
+
+	gc, err := sizes.CheckGitlinks(context.Background(), repo.Repository(t), refGrouper{})
+	require.NoError(t, err)
+	assert.Equal(t, counts.Count32(3), gc.BranchCount)
+	assert.Equal(t, counts.Count32(2), gc.Count)
+	// Problems are reported once, for the first branch that has them:
+	assert.Equal(
+		t,
+		[]sizes.GitlinkProblem{
+			{
+				Refname: "refs/heads/copy",
+				Path:    "gone",
+				Problem: "listed in .gitmodules, but there is no gitlink in the tree",
+			},
+			{
+				Refname: "refs/heads/stale",
+				Path:    "old",
+				Problem: "gitlink is not listed in .gitmodules",
+			},
+		},
+		gc.Problems,
+	)
+
+	cmd := exec.Command(sizerExe(t), "--check-submodules", "--no-progress")
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	out, err := cmd.Output()
+	require.NoError(t, err, "running git-sizer")
+	assert.Contains(t, string(out), "(2 problem(s))")
+	assert.Contains(t, string(out), "refs/heads/stale: old")
+}
+
+func TestTreeEntryNameLength(t *testing.T) {
+	t.Parallel()
+
+	repo := testutils.NewTestRepo(t, false, "name-length")
+	t.Cleanup(func() { repo.Remove(t) })
+
+	timestamp := time.Unix(1112911993, 0)
+
+	repo.AddFile(t, "short.txt", "Hello, world!\n")
+	out, err := repo.GitCommand(t, "rev-parse", ":short.txt").Output()
+	require.NoError(t, err)
+	blob := strings.TrimSpace(string(out))
+
+	// Names this long can't necessarily be created in the filesystem,
+	// so add them directly to the index:
+	for _, name := range []string{
+		"d/" + strings.Repeat("a", 300),
+		"d/" + strings.Repeat("b", 256),
+		strings.Repeat("c", 210),
+	} {
+		cmd := repo.GitCommand(t, "update-index", "--add", "--cacheinfo", "100644,"+blob+","+name)
+		require.NoError(t, cmd.Run(), "adding %q", name)
+	}
+
+	cmd := repo.GitCommand(t, "commit", "-m", "long names")
+	testutils.AddAuthorInfo(cmd, &timestamp)
+	require.NoError(t, cmd.Run(), "creating commit")
+
+	h, err := sizes.ScanRepositoryUsingGraph(
+		repo.Repository(t),
+		refGrouper{}, sizes.NameStyleFull, meter.NoProgressMeter,
+		sizes.ScanOptions{},
+	)
+	require.NoError(t, err, "scanning repository")
+	assert.Equal(t, counts.Count32(300), h.MaxTreeEntryNameLength, "max tree entry name length")
+	assert.Equal(t, counts.Count64(2), h.LongTreeEntryNameCount, "long tree entry name count")
+	if assert.NotNil(t, h.MaxTreeEntryNameLengthTree) {
+		assert.True(
+			t, strings.HasSuffix(h.MaxTreeEntryNameLengthTree.Path(), ":d"),
+			"path %q", h.MaxTreeEntryNameLengthTree.Path(),
+		)
+	}
+
+	// 300 bytes is worth 1.5 stars:
+	cmd = exec.Command(sizerExe(t), "--no-progress", "--threshold=1")
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	out, err = cmd.Output()
+	require.NoError(t, err, "running git-sizer")
+	assert.Regexp(t, `\* Maximum name length\s+\[\d+\]\s+\|\s+300 B\s+\|\s+\*`, string(out))
+}
+
+func TestPackfiles(t *testing.T) {
+	t.Parallel()
+
+	repo := testutils.NewTestRepo(t, false, "packfiles")
+	t.Cleanup(func() { repo.Remove(t) })
+
+	scan := func() sizes.HistorySize {
+		t.Helper()
+		h, err := sizes.ScanRepositoryUsingGraph(
+			repo.Repository(t),
+			refGrouper{}, sizes.NameStyleNone, meter.NoProgressMeter,
+			sizes.ScanOptions{},
+		)
+		require.NoError(t, err, "scanning repository")
+		return h
+	}
+
+	timestamp := time.Unix(1112911993, 0)
+
+	repo.AddFile(t, "a.txt", "Hello, world!\n")
+	cmd := repo.GitCommand(t, "commit", "-m", "first")
+	testutils.AddAuthorInfo(cmd, &timestamp)
+	require.NoError(t, cmd.Run(), "creating commit")
+
+	// Only loose objects so far:
+	h := scan()
+	assert.Equal(t, counts.Count32(0), h.PackCount, "pack count")
+	assert.Equal(t, counts.Count64(0), h.PackSize, "pack size")
+	assert.Equal(t, counts.Count64(0), h.MaxPackSize, "max pack size")
+
+	require.NoError(t, repo.GitCommand(t, "repack", "-q", "-d").Run(), "repacking")
+
+	repo.AddFile(t, "b.txt", strings.Repeat("Goodbye, world!\n", 100))
+	cmd = repo.GitCommand(t, "commit", "-m", "second")
+	testutils.AddAuthorInfo(cmd, &timestamp)
+	require.NoError(t, cmd.Run(), "creating commit")
+
+	require.NoError(t, repo.GitCommand(t, "repack", "-q", "-d").Run(), "repacking")
+
+	packs, err := filepath.Glob(filepath.Join(repo.Path, ".git", "objects", "pack", "*.pack"))
+	require.NoError(t, err)
+	require.Len(t, packs, 2)
+
+	var total, largest int64
+	for _, pack := range packs {
+		fi, err := os.Stat(pack)
+		require.NoError(t, err)
+		total += fi.Size()
+		if fi.Size() > largest {
+			largest = fi.Size()
+		}
+	}
+
+	h = scan()
+	assert.Equal(t, counts.Count32(2), h.PackCount, "pack count")
+	assert.Equal(t, counts.Count64(total), h.PackSize, "pack size")
+	assert.Equal(t, counts.Count64(largest), h.MaxPackSize, "max pack size")
+}
+
+func TestPackStats(t *testing.T) {
+	t.Parallel()
+
+	repo := testutils.NewTestRepo(t, false, "pack-stats")
+	t.Cleanup(func() { repo.Remove(t) })
+
+	timestamp := time.Unix(1112911993, 0)
+
+	// Each version of the file changes one more line, so that each is
+	// most similar to its neighbors and the deltas form chains:
+	lines := make([]string, 2000)
+	for i := range lines {
+		lines[i] = strconv.Itoa(i)
+	}
+	for i := 1; i <= 12; i++ {
+		lines[i*150] = fmt.Sprintf("changed %d %s", i, strings.Repeat("x", 40))
+		repo.AddFile(t, "f.txt", strings.Join(lines, "\n")+"\n")
+		cmd := repo.GitCommand(t, "commit", "-m", fmt.Sprintf("version %d", i))
+		testutils.AddAuthorInfo(cmd, &timestamp)
+		require.NoError(t, cmd.Run(), "creating commit")
+	}
+
+	// Loose objects aren't counted:
+	ps, err := sizes.ComputePackStats(context.Background(), repo.Repository(t), nil)
+	require.NoError(t, err)
+	assert.Equal(t, counts.Count32(0), ps.PackCount)
+	assert.Equal(t, counts.Count64(0), ps.ObjectCount)
+
+	require.NoError(
+		t, repo.GitCommand(t, "repack", "-q", "-a", "-d", "--window=10", "--depth=3").Run(),
+		"repacking",
+	)
+
+	ps, err = sizes.ComputePackStats(context.Background(), repo.Repository(t), nil)
+	require.NoError(t, err)
+	assert.Equal(t, counts.Count32(1), ps.PackCount)
+	// 12 commits, trees, and blobs:
+	assert.Equal(t, counts.Count64(36), ps.ObjectCount)
+	assert.NotZero(t, ps.DeltaCount)
+	assert.GreaterOrEqual(t, ps.MaxDeltaChainDepth, counts.Count32(2))
+	assert.LessOrEqual(t, ps.MaxDeltaChainDepth, counts.Count32(3))
+
+	var total counts.Count64
+	for _, b := range ps.ChainLengthHistogram.Buckets {
+		total.Increment(counts.Count64(b.Count))
+	}
+	assert.Equal(t, ps.ObjectCount, total)
+	assert.Equal(t, counts.Count64(ps.ChainLengthHistogram.Buckets[0].Count), 36-ps.DeltaCount)
+
+	packs, err := repo.Repository(t).Packfiles()
+	require.NoError(t, err)
+	require.Len(t, packs, 1)
+	if assert.Len(t, ps.Packs, 1) {
+		assert.Equal(t, packs[0].Name, ps.Packs[0].Name)
+		assert.Equal(t, counts.Count32(36), ps.Packs[0].ObjectCount)
+		assert.Equal(t, counts.Count64(packs[0].Size), ps.Packs[0].DiskSize)
+		assert.NotEqual(t, git.NullOID, ps.Packs[0].LargestObject)
+		assert.NotZero(t, ps.Packs[0].LargestObjectDiskSize)
+	}
+	assert.Empty(t, ps.Skipped)
+
+	// A blob added after the repack is loose:
+	repo.AddFile(t, "big.bin", strings.Repeat("y", 20000))
+	cmd := repo.GitCommand(t, "commit", "-m", "big")
+	testutils.AddAuthorInfo(cmd, &timestamp)
+	require.NoError(t, cmd.Run(), "creating commit")
+
+	h, err := sizes.ScanRepositoryUsingGraph(
+		repo.Repository(t),
+		refGrouper{}, sizes.NameStyleFull, meter.NoProgressMeter,
+		sizes.ScanOptions{TopBlobs: 2},
+	)
+	require.NoError(t, err, "scanning repository")
+	ps, err = sizes.ComputePackStats(context.Background(), repo.Repository(t), h.TopBlobs)
+	require.NoError(t, err)
+	if assert.Len(t, h.TopBlobs.Blobs, 2) {
+		assert.Equal(t, "big.bin", h.TopBlobs.Blobs[0].Path)
+		assert.Equal(t, sizes.LoosePack, h.TopBlobs.Blobs[0].Pack)
+		assert.Equal(t, "f.txt", h.TopBlobs.Blobs[1].Path)
+		assert.Equal(t, packs[0].Name, h.TopBlobs.Blobs[1].Pack)
+	}
+
+	cmd = exec.Command(sizerExe(t), "--no-progress", "-v", "--pack-stats", "--top=2")
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	out, err := cmd.Output()
+	require.NoError(t, err, "running git-sizer")
+	assert.Contains(t, string(out), "Max delta chain")
+	assert.Contains(t, string(out), "\nDelta chain length histogram:\n")
+	assert.Contains(t, string(out), "\nPackfiles (1):\n\n    "+packs[0].Name+"          36 objects")
+	assert.Regexp(t, `\n +19\.5 KiB  [0-9a-f]{40}  loose {46}\(refs/heads/master:big\.bin\)\n`, string(out))
+	assert.Contains(t, string(out), "  "+packs[0].Name+" (refs/heads/master:f.txt)\n")
+}
+
+func TestPackStatsCruft(t *testing.T) {
+	t.Parallel()
+
+	repo := testutils.NewTestRepo(t, false, "pack-stats-cruft")
+	t.Cleanup(func() { repo.Remove(t) })
+
+	timestamp := time.Unix(1112911993, 0)
+	runGit := func(args ...string) string {
+		t.Helper()
+		cmd := repo.GitCommand(t, args...)
+		testutils.AddAuthorInfo(cmd, &timestamp)
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, "running git %v: %s", args, out)
+		return strings.TrimSpace(string(out))
+	}
+
+	repo.AddFile(t, "a.txt", "a\n")
+	runGit("commit", "-m", "initial")
+
+	// Make a commit, tree, and blob unreachable, and move them into a
+	// cruft pack:
+	runGit("checkout", "-q", "-b", "tmp")
+	repo.AddFile(t, "b.txt", "b\n")
+	runGit("commit", "-m", "unreachable")
+	runGit("checkout", "-q", "-")
+	runGit("branch", "-q", "-D", "tmp")
+	runGit("reflog", "expire", "--expire=now", "--all")
+	if out, err := repo.GitCommand(t, "repack", "-q", "--cruft", "-d").CombinedOutput(); err != nil {
+		t.Skipf("this version of git can't write cruft packs: %s", out)
+	}
+
+	// Without a multi-pack-index:
+	ps, err := sizes.ComputePackStats(context.Background(), repo.Repository(t), nil)
+	require.NoError(t, err)
+	assert.Nil(t, ps.MultiPackIndex)
+
+	runGit("multi-pack-index", "write")
+	cmd := repo.GitCommand(t, "hash-object", "-w", "--stdin")
+	cmd.Stdin = strings.NewReader("loose\n")
+	require.NoError(t, cmd.Run(), "writing loose object")
+
+	ps, err = sizes.ComputePackStats(context.Background(), repo.Repository(t), nil)
+	require.NoError(t, err)
+	assert.Equal(t, counts.Count64(1), ps.LivePacks.Count)
+	assert.Equal(t, counts.Count64(1), ps.CruftPacks.Count)
+	assert.NotZero(t, ps.CruftPacks.Size)
+	assert.Equal(t, counts.Count64(1), ps.LooseObjects.Count)
+	assert.NotZero(t, ps.LooseObjects.Size)
+	if assert.NotNil(t, ps.MultiPackIndex) {
+		assert.Equal(t, counts.Count32(2), ps.MultiPackIndex.PackCount)
+		assert.Equal(t, counts.Count32(0), ps.MultiPackIndex.UncoveredPackCount)
+		assert.Equal(t, counts.Count64(6), ps.MultiPackIndex.ObjectCount)
+	}
+
+	// The cruft pack's objects are left out of the delta chain
+	// statistics:
+	assert.Equal(t, counts.Count32(1), ps.PackCount)
+	assert.Equal(t, counts.Count64(3), ps.ObjectCount)
+	if assert.Len(t, ps.Packs, 2) {
+		assert.NotEqual(t, ps.Packs[0].Cruft, ps.Packs[1].Cruft)
+	}
+
+	h, err := sizes.ScanRepositoryUsingGraph(
+		repo.Repository(t),
+		refGrouper{}, sizes.NameStyleFull, meter.NoProgressMeter,
+		sizes.ScanOptions{},
+	)
+	require.NoError(t, err, "scanning repository")
+	assert.Equal(t, counts.Count32(2), h.PackCount)
+	assert.Equal(t, counts.Count32(1), h.CruftPackCount)
+	assert.NotZero(t, h.CruftPackSize)
+	assert.Less(t, uint64(h.CruftPackSize), uint64(h.PackSize))
+
+	cmd = exec.Command(sizerExe(t), "--no-progress", "--pack-stats", "--json", "--json-version=2")
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	out, err := cmd.Output()
+	require.NoError(t, err, "running git-sizer")
+	var j struct {
+		PackStats struct {
+			LivePacks      map[string]uint64 `json:"livePacks"`
+			CruftPacks     map[string]uint64 `json:"cruftPacks"`
+			LooseObjects   map[string]uint64 `json:"looseObjects"`
+			MultiPackIndex map[string]uint64 `json:"multiPackIndex"`
+		} `json:"packStats"`
+	}
+	require.NoError(t, json.Unmarshal(out, &j))
+	assert.Equal(t, uint64(1), j.PackStats.LivePacks["count"])
+	assert.Equal(t, uint64(1), j.PackStats.CruftPacks["count"])
+	assert.Equal(t, uint64(1), j.PackStats.LooseObjects["count"])
+	assert.Equal(t, uint64(6), j.PackStats.MultiPackIndex["objectCount"])
+
+	cmd = exec.Command(sizerExe(t), "--no-progress", "--pack-stats")
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	out, err = cmd.Output()
+	require.NoError(t, err, "running git-sizer")
+	assert.Contains(t, string(out), "\nObject storage:\n\n")
+	assert.Regexp(t, `\n    Cruft packs +1 packs +\d+ B\n`, string(out))
+	assert.Contains(t, string(out), "    Multi-pack-index covers 2 packs (6 distinct objects)\n")
+}
+
+func TestTopTrees(t *testing.T) {
+	t.Parallel()
+
+	repo := testutils.NewTestRepo(t, false, "top-trees")
+	t.Cleanup(func() { repo.Remove(t) })
+
+	timestamp := time.Unix(1112911993, 0)
+
+	for i := 0; i < 5; i++ {
+		repo.AddFile(t, fmt.Sprintf("wide/file-%d.txt", i), fmt.Sprintf("%d\n", i))
+	}
+	for i := 0; i < 3; i++ {
+		repo.AddFile(t, fmt.Sprintf("wide/sub/file-%d.txt", i), fmt.Sprintf("%d\n", i))
+	}
+	repo.AddFile(t, "README", "Hello, world!\n")
+
+	cmd := repo.GitCommand(t, "commit", "-m", "initial")
+	testutils.AddAuthorInfo(cmd, &timestamp)
+	require.NoError(t, cmd.Run(), "creating commit")
+
+	out, err := repo.GitCommand(t, "rev-parse", "HEAD", "HEAD:wide", "HEAD^{tree}").Output()
+	require.NoError(t, err)
+	oids := strings.Fields(string(out))
+	require.Len(t, oids, 3)
+	commit, wide, root := oids[0], oids[1], oids[2]
+
+	h, err := sizes.ScanRepositoryUsingGraph(
+		repo.Repository(t),
+		refGrouper{}, sizes.NameStyleFull, meter.NoProgressMeter,
+		sizes.ScanOptions{TopTrees: 2},
+	)
+	require.NoError(t, err, "scanning repository")
+
+	require.Len(t, h.WidestTrees, 2)
+
+	assert.Equal(t, wide, h.WidestTrees[0].OID.String())
+	assert.Equal(t, counts.Count32(6), h.WidestTrees[0].Entries)
+	assert.Equal(t, "refs/heads/master:wide", h.WidestTrees[0].Name)
+	assert.Equal(t, "wide", h.WidestTrees[0].Path)
+	if assert.NotNil(t, h.WidestTrees[0].Commit) {
+		assert.Equal(t, commit, h.WidestTrees[0].Commit.String())
+	}
+
+	assert.Equal(t, counts.Count32(3), h.WidestTrees[1].Entries)
+	assert.Equal(t, "refs/heads/master:wide/sub", h.WidestTrees[1].Name)
+	assert.Equal(t, "wide/sub", h.WidestTrees[1].Path)
+
+	// The widest tree is named in the footnote, too:
+	if assert.NotNil(t, h.MaxTreeEntriesTree) {
+		assert.Equal(t, "refs/heads/master:wide", h.MaxTreeEntriesTree.Path())
+	}
+
+	// The root tree only makes the list if there's room:
+	h, err = sizes.ScanRepositoryUsingGraph(
+		repo.Repository(t),
+		refGrouper{}, sizes.NameStyleFull, meter.NoProgressMeter,
+		sizes.ScanOptions{TopTrees: 5},
+	)
+	require.NoError(t, err, "scanning repository")
+	require.Len(t, h.WidestTrees, 3)
+	assert.Equal(t, root, h.WidestTrees[2].OID.String())
+	assert.Equal(t, "", h.WidestTrees[2].Path)
+	assert.Equal(t, "refs/heads/master^{tree}", h.WidestTrees[2].Name)
+
+	cmd = exec.Command(sizerExe(t), "--no-progress", "--top-trees=1")
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	out, err = cmd.Output()
+	require.NoError(t, err, "running git-sizer")
+	assert.Contains(
+		t, string(out),
+		fmt.Sprintf("\nWidest trees (1):\n\n             6 entries  %s (refs/heads/master:wide)\n", wide),
+	)
+}
+
+func TestTopBlobs(t *testing.T) {
+	t.Parallel()
+
+	repo := testutils.NewTestRepo(t, false, "top-blobs")
+	t.Cleanup(func() { repo.Remove(t) })
+
+	timestamp := time.Unix(1112911993, 0)
+
+	// "common" is referred to by three distinct trees, and "big" by
+	// one:
+	repo.AddFile(t, "big.bin", strings.Repeat("x", 1000))
+	repo.AddFile(t, "medium.txt", strings.Repeat("y", 100))
+	for _, dir := range []string{"a", "b", "c"} {
+		repo.AddFile(t, dir+"/common.txt", "common\n")
+		repo.AddFile(t, dir+"/"+dir+".txt", dir+"\n")
+	}
+
+	cmd := repo.GitCommand(t, "commit", "-m", "initial")
+	testutils.AddAuthorInfo(cmd, &timestamp)
+	require.NoError(t, cmd.Run(), "creating commit")
+
+	out, err := repo.GitCommand(t, "rev-parse", "HEAD:big.bin", "HEAD:medium.txt", "HEAD:a/common.txt").Output()
+	require.NoError(t, err)
+	oids := strings.Fields(string(out))
+	require.Len(t, oids, 3)
+	big, medium, common := oids[0], oids[1], oids[2]
+
+	h, err := sizes.ScanRepositoryUsingGraph(
+		repo.Repository(t),
+		refGrouper{}, sizes.NameStyleFull, meter.NoProgressMeter,
+		sizes.ScanOptions{TopBlobs: 2},
+	)
+	require.NoError(t, err, "scanning repository")
+	if assert.NotNil(t, h.TopBlobs) {
+		assert.Equal(t, sizes.BlobOrderSize, h.TopBlobs.By)
+		require.Len(t, h.TopBlobs.Blobs, 2)
+		assert.Equal(t, big, h.TopBlobs.Blobs[0].OID.String())
+		assert.Equal(t, counts.Count32(1000), h.TopBlobs.Blobs[0].Size)
+		assert.Equal(t, "refs/heads/master:big.bin", h.TopBlobs.Blobs[0].Name)
+		assert.Equal(t, medium, h.TopBlobs.Blobs[1].OID.String())
+		assert.Equal(t, "refs/heads/master:medium.txt", h.TopBlobs.Blobs[1].Name)
+	}
+
+	h, err = sizes.ScanRepositoryUsingGraph(
+		repo.Repository(t),
+		refGrouper{}, sizes.NameStyleFull, meter.NoProgressMeter,
+		sizes.ScanOptions{TopBlobs: 1, TopBlobsBy: sizes.BlobOrderRefCount},
+	)
+	require.NoError(t, err, "scanning repository")
+	if assert.NotNil(t, h.TopBlobs) {
+		require.Len(t, h.TopBlobs.Blobs, 1)
+		assert.Equal(t, common, h.TopBlobs.Blobs[0].OID.String())
+		assert.Equal(t, counts.Count32(3), h.TopBlobs.Blobs[0].RefCount)
+		assert.Equal(t, counts.Count32(7), h.TopBlobs.Blobs[0].Size)
+		assert.Regexp(t, `^refs/heads/master:[abc]/common\.txt$`, h.TopBlobs.Blobs[0].Name)
+	}
+
+	cmd = exec.Command(sizerExe(t), "--no-progress", "--top=1", "--top-by=refcount")
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	out, err = cmd.Output()
+	require.NoError(t, err, "running git-sizer")
+	assert.Contains(
+		t, string(out),
+		fmt.Sprintf("\nMost referenced blobs (1):\n\n             3 refs         7 B  %s (refs/heads/master:", common),
+	)
+
+	cmd = exec.Command(sizerExe(t), "--no-progress", "--top=1", "--top-by=age")
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	out, err = cmd.CombinedOutput()
+	assert.Error(t, err)
+	assert.Contains(t, string(out), "--top-by must be 'size' or 'refcount'")
+}
+
+func TestNamesPerMetric(t *testing.T) {
+	t.Parallel()
+
+	repo := testutils.NewTestRepo(t, false, "names-per-metric")
+	t.Cleanup(func() { repo.Remove(t) })
+
+	timestamp := time.Unix(1112911993, 0)
+
+	// Three blobs tie for second place, so only the two with the
+	// smallest OIDs should be named after "big":
+	repo.AddFile(t, "big.bin", strings.Repeat("x", 100))
+	for _, name := range []string{"a", "b", "c"} {
+		repo.AddFile(t, name+".txt", strings.Repeat(name, 10))
+	}
+
+	cmd := repo.GitCommand(t, "commit", "-m", "initial")
+	testutils.AddAuthorInfo(cmd, &timestamp)
+	require.NoError(t, cmd.Run(), "creating commit")
+
+	out, err := repo.GitCommand(
+		t, "rev-parse", "HEAD:big.bin", "HEAD:a.txt", "HEAD:b.txt", "HEAD:c.txt",
+	).Output()
+	require.NoError(t, err)
+	oids := strings.Fields(string(out))
+	require.Len(t, oids, 4)
+	big, ties := oids[0], oids[1:]
+	sort.Strings(ties)
+
+	run := func(args ...string) (string, error) {
+		cmd := exec.Command(sizerExe(t), append([]string{"--no-progress", "-v"}, args...)...)
+		cmd.Dir = repo.Path
+		cmd.Env = testutils.CleanGitEnv()
+		out, err := cmd.CombinedOutput()
+		return string(out), err
+	}
+
+	// By default, a single object is named, without a number:
+	stdout, err := run("--names=hash")
+	require.NoError(t, err, "running git-sizer: %s", stdout)
+	assert.Contains(t, stdout, "]  "+big+"\n")
+	assert.NotContains(t, stdout, "1. ")
+
+	stdout, err = run("--names=hash", "--names-per-metric=3")
+	require.NoError(t, err, "running git-sizer: %s", stdout)
+	assert.Contains(
+		t, stdout,
+		"]  1. "+big+"\n     2. "+ties[0]+"\n     3. "+ties[1]+"\n",
+	)
+
+	stdout, err = run("--json", "--json-version=2", "--names-per-metric=3")
+	require.NoError(t, err, "running git-sizer: %s", stdout)
+	var j map[string]struct {
+		ObjectName string `json:"objectName"`
+		Objects    []struct {
+			ObjectName        string `json:"objectName"`
+			ObjectDescription string `json:"objectDescription"`
+		} `json:"objects"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(stdout), &j))
+	maxBlobSize := j["maxBlobSize"]
+	assert.Equal(t, big, maxBlobSize.ObjectName)
+	if assert.Len(t, maxBlobSize.Objects, 3) {
+		assert.Equal(t, big, maxBlobSize.Objects[0].ObjectName)
+		assert.Equal(t, "refs/heads/master:big.bin", maxBlobSize.Objects[0].ObjectDescription)
+		assert.Equal(t, ties[0], maxBlobSize.Objects[1].ObjectName)
+		assert.Equal(t, ties[1], maxBlobSize.Objects[2].ObjectName)
+	}
+	// There is only one commit to name:
+	assert.Len(t, j["maxCommitSize"].Objects, 1)
+
+	stdout, err = run("--names-per-metric=0")
+	assert.Error(t, err)
+	assert.Contains(t, stdout, "--names-per-metric must be at least 1")
+}
+
+func TestNamesFile(t *testing.T) {
+	t.Parallel()
+
+	repo := testutils.NewTestRepo(t, false, "names-file")
+	t.Cleanup(func() { repo.Remove(t) })
+
+	timestamp := time.Unix(1112911993, 0)
+
+	repo.AddFile(t, "src/big.bin", strings.Repeat("x", 1000))
+	repo.AddFile(t, "small.txt", "small\n")
+	cmd := repo.GitCommand(t, "commit", "-m", "initial")
+	testutils.AddAuthorInfo(cmd, &timestamp)
+	require.NoError(t, cmd.Run(), "creating commit")
+
+	out, err := repo.GitCommand(t, "rev-parse", "HEAD:src/big.bin").Output()
+	require.NoError(t, err)
+	big := strings.TrimSpace(string(out))
+
+	dir := t.TempDir()
+	namesFile := filepath.Join(dir, "names.tsv")
+
+	run := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command(sizerExe(t), append([]string{"--no-progress"}, args...)...)
+		cmd.Dir = repo.Path
+		cmd.Env = testutils.CleanGitEnv()
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, "running git-sizer: %s", out)
+	}
+
+	// The names file is written along with the JSON output:
+	run("--json", "--top=2", "--names-file="+namesFile)
+	contents, err := os.ReadFile(namesFile)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSuffix(string(contents), "\n"), "\n")
+	assert.Equal(t, "metric\toid\ttype\tsize\tpath\tref", lines[0])
+	assert.Contains(t, lines, "maxBlobSize\t"+big+"\tblob\t1000\tsrc/big.bin\trefs/heads/master")
+	assert.Contains(t, lines, "topBlobs\t"+big+"\tblob\t1000\tsrc/big.bin\trefs/heads/master")
+	for _, line := range lines {
+		assert.Len(t, strings.Split(line, "\t"), 6, line)
+	}
+
+	// No temporary files are left behind:
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	// If no objects are named, the file isn't written at all:
+	require.NoError(t, os.Remove(namesFile))
+	run("--names=none", "--names-file="+namesFile)
+	_, err = os.Stat(namesFile)
+	assert.True(t, os.IsNotExist(err), "names file was written: %v", err)
+}
+
+func TestTrack(t *testing.T) {
+	t.Parallel()
+
+	repo := testutils.NewTestRepo(t, false, "track")
+	t.Cleanup(func() { repo.Remove(t) })
+
+	timestamp := time.Unix(1112911993, 0)
+	commit := func(msg string) {
+		t.Helper()
+		cmd := repo.GitCommand(t, "commit", "-m", msg)
+		testutils.AddAuthorInfo(cmd, &timestamp)
+		require.NoError(t, cmd.Run(), "creating commit")
+	}
+
+	cacheDir := t.TempDir()
+	run := func(args ...string) string {
+		t.Helper()
+		cmd := exec.Command(sizerExe(t), append([]string{"--no-progress", "--track"}, args...)...)
+		cmd.Dir = repo.Path
+		cmd.Env = append(testutils.CleanGitEnv(), "XDG_CACHE_HOME="+cacheDir)
+		out, err := cmd.Output()
+		require.NoError(t, err, "running git-sizer")
+		return string(out)
+	}
+
+	repo.AddFile(t, "a.txt", "Hello, world!\n")
+	commit("first")
+
+	// There is nothing to compare with the first time:
+	out := run()
+	assert.NotContains(t, out, "Changes since the previous run")
+
+	repo.AddFile(t, "b.txt", strings.Repeat("x", 100))
+	commit("second")
+
+	out = run("--json", "--json-version=2")
+	var j struct {
+		Growth struct {
+			Changes []struct {
+				Symbol   string `json:"symbol"`
+				Previous uint64 `json:"previous"`
+				Current  uint64 `json:"current"`
+			} `json:"changes"`
+		} `json:"growth"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(out), &j))
+	changes := make(map[string][2]uint64)
+	for _, c := range j.Growth.Changes {
+		changes[c.Symbol] = [2]uint64{c.Previous, c.Current}
+	}
+	assert.Equal(t, [2]uint64{1, 2}, changes["uniqueCommitCount"])
+	assert.Equal(t, [2]uint64{14, 114}, changes["uniqueBlobSize"])
+	assert.NotContains(t, changes, "referenceCount")
+
+	// The JSON run was stored, too:
+	out = run()
+	assert.Contains(t, out, "Changes since the previous run (")
+	assert.Contains(t, out, "):\n\n    (none)\n")
+
+	// The results are stored in a single file per repository:
+	entries, err := os.ReadDir(filepath.Join(cacheDir, "git-sizer", "track"))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestAssumeUnchangedCache(t *testing.T) {
+	t.Parallel()
+
+	repo := testutils.NewTestRepo(t, false, "assume-unchanged-cache")
+	t.Cleanup(func() { repo.Remove(t) })
+
+	timestamp := time.Unix(1112911993, 0)
+	commit := func(msg string) {
+		t.Helper()
+		cmd := repo.GitCommand(t, "commit", "-m", msg)
+		testutils.AddAuthorInfo(cmd, &timestamp)
+		require.NoError(t, cmd.Run(), "creating commit")
+	}
+
+	cacheDir := t.TempDir()
+	run := func(args ...string) (string, string, int) {
+		t.Helper()
+		cmd := exec.Command(sizerExe(t), append([]string{"--no-progress", "-v"}, args...)...)
+		cmd.Dir = repo.Path
+		cmd.Env = append(testutils.CleanGitEnv(), "XDG_CACHE_HOME="+cacheDir)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return string(out), stderr.String(), exitErr.ExitCode()
+		}
+		require.NoError(t, err, "running git-sizer")
+		return string(out), stderr.String(), 0
+	}
+
+	repo.AddFile(t, "a.txt", "Hello, world!\n")
+	commit("first")
+	expected, _, _ := run()
+
+	out, stderr, code := run("--assume-unchanged-cache")
+	assert.Equal(t, 0, code)
+	assert.Equal(t, expected, out)
+	assert.Contains(t, stderr, "note: recomputing the results, because none are cached")
+
+	out, stderr, code = run("--assume-unchanged-cache")
+	assert.Equal(t, 0, code)
+	assert.Equal(t, expected, out)
+	assert.Contains(t, stderr, "note: trusting the results cached at ")
+
+	// Other settings are cached separately:
+	out, stderr, _ = run("--assume-unchanged-cache", "--json", "--json-version=2")
+	assert.Contains(t, out, `"uniqueCommitCount"`)
+	assert.Contains(t, stderr, "because none are cached")
+	entries, err := os.ReadDir(filepath.Join(cacheDir, "git-sizer", "results"))
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+
+	// A new commit makes the cached results stale:
+	repo.AddFile(t, "b.txt", strings.Repeat("x", 100))
+	commit("second")
+	expected, _, _ = run()
+	out, stderr, _ = run("--assume-unchanged-cache")
+	assert.Equal(t, expected, out)
+	assert.Contains(t, stderr, "because the references have changed")
+
+	// Simulate results that went stale without the references
+	// changing:
+	for _, e := range entries {
+		filename := filepath.Join(cacheDir, "git-sizer", "results", e.Name())
+		data, err := os.ReadFile(filename)
+		require.NoError(t, err)
+		var entry map[string]interface{}
+		require.NoError(t, json.Unmarshal(data, &entry))
+		output, err := base64.StdEncoding.DecodeString(entry["output"].(string))
+		require.NoError(t, err)
+		output = bytes.Replace(output, []byte("|     2     |"), []byte("|     7     |"), -1)
+		entry["output"] = output
+		data, err = json.Marshal(entry)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(filename, data, 0o644))
+	}
+
+	// The stale results are trusted:
+	out, _, _ = run("--assume-unchanged-cache")
+	assert.NotEqual(t, expected, out)
+	assert.Contains(t, out, "|     7     |")
+
+	// ...until they are verified:
+	out, stderr, code = run("--assume-unchanged-cache", "--verify-cache")
+	assert.Equal(t, 1, code)
+	assert.Equal(t, expected, out)
+	assert.Contains(t, stderr, "note: recomputing the results cached at ")
+	assert.Contains(t, stderr, "the cached results don't match the recomputed ones:\n-")
+	assert.Regexp(t, `\n-.*\|     7     \|.*\n`, stderr)
+	assert.Regexp(t, `\n\+.*\|     2     \|.*\n`, stderr)
+	assert.Contains(t, stderr, "use --repair-cache")
+
+	// Verifying doesn't change the cache:
+	out, _, _ = run("--assume-unchanged-cache")
+	assert.Contains(t, out, "|     7     |")
+
+	// ...but repairing it does:
+	out, stderr, code = run("--assume-unchanged-cache", "--repair-cache")
+	assert.Equal(t, 0, code)
+	assert.Equal(t, expected, out)
+	assert.Contains(t, stderr, "to replace them")
+
+	out, stderr, code = run("--assume-unchanged-cache", "--verify-cache")
+	assert.Equal(t, 0, code)
+	assert.Equal(t, expected, out)
+	assert.Contains(t, stderr, "note: the cached results match the recomputed ones")
+
+	out, _, _ = run("--assume-unchanged-cache")
+	assert.Equal(t, expected, out)
+
+	for _, args := range [][]string{
+		{"--verify-cache"},
+		{"--assume-unchanged-cache", "--verify-cache", "--repair-cache"},
+		{"--assume-unchanged-cache", "--track"},
+		{"--assume-unchanged-cache", "--names-file=names.tsv"},
+	} {
+		_, _, code := run(args...)
+		assert.Equal(t, 3, code, "%v", args)
+	}
+}
+
+func TestJSONStream(t *testing.T) {
+	t.Parallel()
+
+	repo := testutils.NewTestRepo(t, false, "json-stream")
+	t.Cleanup(func() { repo.Remove(t) })
+
+	timestamp := time.Unix(1112911993, 0)
+
+	repo.AddFile(t, "a.txt", "a\n")
+	repo.AddFile(t, "dir/b.txt", "b\n")
+	cmd := repo.GitCommand(t, "commit", "-m", "initial")
+	testutils.AddAuthorInfo(cmd, &timestamp)
+	require.NoError(t, cmd.Run(), "creating commit")
+	require.NoError(t, repo.GitCommand(t, "update-ref", "refs/remotes/origin/main", "HEAD").Run())
+	require.NoError(t, repo.GitCommand(t, "update-ref", "refs/remotes/upstream/main", "HEAD").Run())
+
+	run := func(args ...string) []byte {
+		t.Helper()
+		cmd := exec.Command(sizerExe(t), append([]string{"--no-progress"}, args...)...)
+		cmd.Dir = repo.Path
+		cmd.Env = testutils.CleanGitEnv()
+		out, err := cmd.Output()
+		require.NoError(t, err, "running git-sizer")
+		return out
+	}
+
+	args := []string{"--by-remote", "--top-trees=2", "--top=1"}
+	var expected map[string]interface{}
+	require.NoError(
+		t,
+		json.Unmarshal(run(append(args, "--json", "--json-version=2")...), &expected),
+	)
+
+	// Reassemble the document from the stream:
+	actual := make(map[string]interface{})
+	statistics := 0
+	lines := strings.Split(strings.TrimSuffix(string(run(append(args, "--json-stream")...)), "\n"), "\n")
+	for _, line := range lines {
+		var record struct {
+			Section string
+			Key     *string
+			Index   *int
+			Value   interface{}
+		}
+		require.NoError(t, json.Unmarshal([]byte(line), &record), line)
+		switch {
+		case record.Section == "statistics":
+			require.NotNil(t, record.Key, line)
+			actual[*record.Key] = record.Value
+			statistics++
+		case record.Key != nil:
+			m, _ := actual[record.Section].(map[string]interface{})
+			if m == nil {
+				m = make(map[string]interface{})
+			}
+			m[*record.Key] = record.Value
+			actual[record.Section] = m
+		case record.Index != nil:
+			l, _ := actual[record.Section].([]interface{})
+			require.Len(t, l, *record.Index, line)
+			actual[record.Section] = append(l, record.Value)
+		default:
+			actual[record.Section] = record.Value
+		}
+	}
+	assert.Equal(t, expected, actual)
+
+	// There is a line for each statistic and other section, except
+	// that the two remotes, the two trees, and the four named objects
+	// get a line each:
+	assert.Less(t, 20, statistics)
+	assert.Len(t, actual["remotes"], 2)
+	assert.Len(t, actual["widestTrees"], 2)
+	assert.Len(t, actual["objects"], 4)
+	assert.Len(t, lines, len(expected)+1+1+3)
+
+	cmd = exec.Command(sizerExe(t), "--no-progress", "--json", "--json-stream")
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	out, err := cmd.CombinedOutput()
+	assert.Error(t, err)
+	assert.Contains(t, string(out), "--json-stream can't be combined with --json")
+}
+
+func TestOutputTemplate(t *testing.T) {
+	t.Parallel()
+
+	repo := testutils.NewTestRepo(t, false, "output-template")
+	t.Cleanup(func() { repo.Remove(t) })
+
+	timestamp := time.Unix(1112911993, 0)
+
+	repo.AddFile(t, "a.txt", strings.Repeat("a", 2000))
+	cmd := repo.GitCommand(t, "commit", "-m", "initial")
+	testutils.AddAuthorInfo(cmd, &timestamp)
+	require.NoError(t, cmd.Run(), "creating commit")
+
+	run := func(args ...string) (string, string, error) {
+		t.Helper()
+		cmd := exec.Command(sizerExe(t), append([]string{"--no-progress"}, args...)...)
+		cmd.Dir = repo.Path
+		cmd.Env = testutils.CleanGitEnv()
+		var stdout, stderr bytes.Buffer
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+		err := cmd.Run()
+		return stdout.String(), stderr.String(), err
+	}
+
+	out, _, err := run(
+		"--by-remote",
+		"--output-template-text="+
+			"{{with .Stats.uniqueBlobSize}}{{.Symbol}} {{.Value}} {{.HumanValue}} {{.Reported}}{{end}}\n"+
+			"{{bytes .History.UniqueBlobSize}} {{metric 12345}} [{{stars 2.5}}]\n"+
+			"{{json .History.Remotes}}\n",
+	)
+	require.NoError(t, err)
+	assert.Equal(t, "uniqueBlobSize 2000 1.95 KiB false\n1.95 KiB 12.3 k [**]\n{}\n", out)
+
+	// The threshold decides which statistics are reported:
+	tmpl := "{{range .Statistics}}{{if .Reported}}{{.Symbol}}\n{{end}}{{end}}"
+	out, _, err = run("--output-template-text=" + tmpl)
+	require.NoError(t, err)
+	assert.Equal(t, "", out)
+	out, _, err = run("--output-template-text="+tmpl, "--threshold=0")
+	require.NoError(t, err)
+	assert.Contains(t, out, "\nuniqueBlobSize\n")
+
+	// The template can be read from a file:
+	templateFile := filepath.Join(t.TempDir(), "template")
+	require.NoError(t, os.WriteFile(templateFile, []byte("{{.Stats.uniqueBlobCount.Value}}\n"), 0o644))
+	out, _, err = run("--output-template=" + templateFile)
+	require.NoError(t, err)
+	assert.Equal(t, "1\n", out)
+
+	// Errors are reported along with where they occurred:
+	_, stderr, err := run("--output-template-text={{.Stats.maxBlobSize")
+	assert.Error(t, err)
+	assert.Contains(t, stderr, "parsing output template: template: --output-template-text:1: unclosed action")
+
+	out, stderr, err = run("--output-template=" + templateFile + "x")
+	assert.Error(t, err)
+	assert.Contains(t, stderr, "reading output template: ")
+
+	out, stderr, err = run("--output-template-text=before {{.Stats.noSuchStatistic}}")
+	assert.Error(t, err)
+	assert.Equal(t, "", out)
+	assert.Contains(t, stderr, `map has no entry for key "noSuchStatistic"`)
+
+	_, stderr, err = run("--output-template-text=x", "--json")
+	assert.Error(t, err)
+	assert.Contains(t, stderr, "--output-template can't be combined with --json")
+}
+
+func TestPorcelain(t *testing.T) {
+	t.Parallel()
+
+	repo := testutils.NewTestRepo(t, false, "porcelain")
+	t.Cleanup(func() { repo.Remove(t) })
+
+	timestamp := time.Unix(1112911993, 0)
+
+	repo.AddFile(t, "small.txt", "small\n")
+	repo.AddFile(t, "dir/big café.bin", strings.Repeat("x", 5000))
+	cmd := repo.GitCommand(t, "commit", "-m", "initial")
+	testutils.AddAuthorInfo(cmd, &timestamp)
+	require.NoError(t, cmd.Run(), "creating commit")
+
+	out, err := repo.GitCommand(t, "rev-parse", "HEAD:dir/big café.bin").Output()
+	require.NoError(t, err)
+	bigOID := strings.TrimSpace(string(out))
+
+	run := func(env []string, args ...string) string {
+		t.Helper()
+		cmd := exec.Command(sizerExe(t), append([]string{"--no-progress", "--porcelain"}, args...)...)
+		cmd.Dir = repo.Path
+		cmd.Env = append(testutils.CleanGitEnv(), env...)
+		out, err := cmd.Output()
+		require.NoError(t, err, "running git-sizer")
+		return string(out)
+	}
+
+	porcelain := run(nil)
+	lines := strings.Split(strings.TrimSuffix(porcelain, "\n"), "\n")
+	require.NotEmpty(t, lines)
+	assert.Equal(t, "# git-sizer porcelain 1", lines[0])
+	assert.Contains(
+		t, porcelain,
+		"\nmaxBlobSize 5000 0.001 "+bigOID+` "refs/heads/master:dir/big caf\303\251.bin"`+"\n",
+	)
+	assert.Contains(t, porcelain, "\nuniqueBlobCount 2 0.000 - -\n")
+
+	// Every line has all of the fields, and they are sorted:
+	var symbols []string
+	for _, line := range lines[1:] {
+		fields := strings.SplitN(line, " ", 5)
+		if assert.Len(t, fields, 5, line) {
+			symbols = append(symbols, fields[0])
+			_, err := strconv.ParseUint(fields[1], 10, 64)
+			assert.NoError(t, err, line)
+			assert.Regexp(t, `^[0-9]+\.[0-9]{3}$`, fields[2], line)
+		}
+	}
+	assert.True(t, sort.StringsAreSorted(symbols))
+
+	// The output doesn't depend on cosmetic options or the
+	// environment:
+	assert.Equal(t, porcelain, run(nil, "--color=always", "--encoding=utf-16le", "--bom"))
+	assert.Equal(t, porcelain, run([]string{"LANG=de_DE.UTF-8", "LC_ALL=de_DE.UTF-8", "COLUMNS=20"}))
+	assert.Equal(t, porcelain, run(nil, "--threshold=30"))
+
+	cmd = exec.Command(sizerExe(t), "--porcelain", "--json")
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	out, err = cmd.CombinedOutput()
+	assert.Error(t, err)
+	assert.Contains(t, string(out), "--porcelain can't be combined with --json")
+}
+
+func TestBlobSizeLimit(t *testing.T) {
+	t.Parallel()
+
+	repo := testutils.NewTestRepo(t, false, "blob-size-limit")
+	t.Cleanup(func() { repo.Remove(t) })
+
+	timestamp := time.Unix(1112911993, 0)
+
+	for i := 0; i < 12; i++ {
+		repo.AddFile(t, fmt.Sprintf("big-%02d.bin", i), strings.Repeat("x", 2000+i))
+	}
+	repo.AddFile(t, "limit.bin", strings.Repeat("y", 2000))
+	repo.AddFile(t, "small.txt", "small\n")
+
+	cmd := repo.GitCommand(t, "commit", "-m", "initial")
+	testutils.AddAuthorInfo(cmd, &timestamp)
+	require.NoError(t, cmd.Run(), "creating commit")
+
+	h, err := sizes.ScanRepositoryUsingGraph(
+		repo.Repository(t),
+		refGrouper{}, sizes.NameStyleFull, meter.NoProgressMeter,
+		sizes.ScanOptions{BlobSizeLimit: 2000},
+	)
+	require.NoError(t, err, "scanning repository")
+	if assert.NotNil(t, h.OversizedBlobs) {
+		assert.Equal(t, counts.Count64(2000), h.OversizedBlobs.Limit)
+		// "big-00.bin" and "limit.bin" are exactly at the limit, so
+		// they don't count:
+		assert.Equal(t, counts.Count32(11), h.OversizedBlobs.Count)
+		assert.Equal(t, counts.Count64(11*2000+66), h.OversizedBlobs.Size)
+		assert.Len(t, h.OversizedBlobs.Examples, 10)
+		for _, p := range h.OversizedBlobs.Examples {
+			assert.Regexp(t, `^refs/heads/master:big-\d\d\.bin$`, p.Path())
+		}
+	}
+
+	h, err = sizes.ScanRepositoryUsingGraph(
+		repo.Repository(t),
+		refGrouper{}, sizes.NameStyleFull, meter.NoProgressMeter,
+		sizes.ScanOptions{},
+	)
+	require.NoError(t, err, "scanning repository")
+	assert.Nil(t, h.OversizedBlobs)
+
+	cmd = exec.Command(sizerExe(t), "--no-progress", "--blob-size-limit=1.95k", "--names=hash")
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	out, err := cmd.Output()
+	require.NoError(t, err, "running git-sizer")
+	assert.Contains(t, string(out), "|   * Count over 1.95 KiB  [1] |    13     | *************")
+	assert.Regexp(t, `\n\[1\]  [0-9a-f]{40}\n     [0-9a-f]{40}\n`, string(out))
+
+	cmd = exec.Command(sizerExe(t), "--no-progress", "--threshold=0")
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	out, err = cmd.Output()
+	require.NoError(t, err, "running git-sizer")
+	assert.NotContains(t, string(out), "Count over")
+
+	for _, s := range []struct {
+		arg      string
+		expected sizes.ByteSize
+		err      bool
+	}{
+		{arg: "0", expected: 0},
+		{arg: "1000", expected: 1000},
+		{arg: "1000b", expected: 1000},
+		{arg: "10k", expected: 10 << 10},
+		{arg: "10K", expected: 10 << 10},
+		{arg: "10KiB", expected: 10 << 10},
+		{arg: "10M", expected: 10 << 20},
+		{arg: "1.5g", expected: 3 << 29},
+		{arg: "1t", expected: 1 << 40},
+		{arg: "", err: true},
+		{arg: "1.5", err: true},
+		{arg: "-1", err: true},
+		{arg: "10x", err: true},
+		{arg: "ki", err: true},
+		{arg: "1ib", err: true},
+	} {
+		var b sizes.ByteSize
+		err := b.Set(s.arg)
+		if s.err {
+			assert.Errorf(t, err, "parsing %q", s.arg)
+		} else if assert.NoErrorf(t, err, "parsing %q", s.arg) {
+			assert.Equalf(t, s.expected, b, "parsing %q", s.arg)
+		}
+	}
+}
+
+func TestParseHumanBytes(t *testing.T) {
+	t.Parallel()
+
+	for _, s := range []struct {
+		arg      string
+		expected uint64
+		err      string
+	}{
+		{arg: "0", expected: 0},
+		{arg: "512", expected: 512},
+		{arg: " 512 ", expected: 512},
+		{arg: "512B", expected: 512},
+		{arg: "512 b", expected: 512},
+		{arg: "512k", expected: 512 << 10},
+		{arg: "512K", expected: 512 << 10},
+		{arg: "10MiB", expected: 10 << 20},
+		{arg: "10mib", expected: 10 << 20},
+		{arg: "10Mi", expected: 10 << 20},
+		{arg: "10 MiB", expected: 10 << 20},
+		{arg: "10.0 MiB", expected: 10 << 20},
+		{arg: "1.5G", expected: 3 << 29},
+		{arg: "1.5GB", expected: 1500000000},
+		{arg: "1kB", expected: 1000},
+		{arg: "1KB", expected: 1000},
+		{arg: "1KiB", expected: 1024},
+		{arg: "2TB", expected: 2000000000000},
+		{arg: "2T", expected: 2 << 40},
+		{arg: ".5k", expected: 512},
+		{arg: "", err: "empty size"},
+		{arg: "-1", err: "can't be negative"},
+		{arg: "-1k", err: "can't be negative"},
+		{arg: "k", err: "must start with a number"},
+		{arg: "1.5", err: "fractional number of bytes"},
+		{arg: "1.5B", err: "fractional number of bytes"},
+		{arg: "10mb", err: "'mb' is ambiguous; write 'MiB' for powers of 1024 or 'MB' for powers of 1000"},
+		{arg: "10Kb", err: "'Kb' is ambiguous; write 'KiB' for powers of 1024 or 'kB' for powers of 1000"},
+		{arg: "1,000", err: "digit grouping"},
+		{arg: "1e6", err: "the unit must be"},
+		{arg: "10x", err: "the unit must be"},
+		{arg: "10KiBs", err: "the unit must be"},
+		{arg: "1.2.3k", err: "is not a number"},
+		{arg: "99999999999T", err: "too large"},
+	} {
+		v, err := sizes.ParseHumanBytes(s.arg)
+		if s.err != "" {
+			if assert.Errorf(t, err, "parsing %q", s.arg) {
+				assert.Containsf(t, err.Error(), s.err, "parsing %q", s.arg)
+			}
+		} else if assert.NoErrorf(t, err, "parsing %q", s.arg) {
+			assert.Equalf(t, s.expected, v, "parsing %q", s.arg)
+		}
+	}
+
+	// Exact values round-trip through the display format:
+	for _, n := range []uint64{0, 1023, 1 << 10, 10 << 20, 3 << 29, 100 << 40} {
+		formatted := sizes.FormatHumanBytes(n)
+		v, err := sizes.ParseHumanBytes(formatted)
+		if assert.NoErrorf(t, err, "parsing %q", formatted) {
+			assert.Equalf(t, n, v, "round-tripping %d via %q", n, formatted)
+		}
+	}
+	assert.Equal(t, "10.0 MiB", sizes.FormatHumanBytes(10<<20))
+}
+
+func TestBigFileThreshold(t *testing.T) {
+	t.Parallel()
+
+	repo := testutils.NewTestRepo(t, false, "big-file-threshold")
+	t.Cleanup(func() { repo.Remove(t) })
+
+	timestamp := time.Unix(1112911993, 0)
+
+	repo.AddFile(t, "huge.bin", strings.Repeat("x", 3000))
+	repo.AddFile(t, "big.bin", strings.Repeat("y", 1500))
+	repo.AddFile(t, "small.txt", "small\n")
+	cmd := repo.GitCommand(t, "commit", "-m", "initial")
+	testutils.AddAuthorInfo(cmd, &timestamp)
+	require.NoError(t, cmd.Run(), "creating commit")
+
+	h, err := sizes.ScanRepositoryUsingGraph(
+		repo.Repository(t),
+		refGrouper{}, sizes.NameStyleFull, meter.NoProgressMeter,
+		sizes.ScanOptions{BigFileThreshold: 2000},
+	)
+	require.NoError(t, err, "scanning repository")
+	if assert.NotNil(t, h.BigFiles) {
+		assert.Equal(t, counts.Count32(1), h.BigFiles.Count)
+		assert.Equal(t, counts.Count64(3000), h.BigFiles.Size)
+		if assert.Len(t, h.BigFiles.Examples, 1) {
+			assert.Equal(t, "refs/heads/master:huge.bin", h.BigFiles.Examples[0].Path())
+		}
+	}
+
+	type bigFiles struct {
+		Limit counts.Count64 `json:"limit"`
+		Count counts.Count32 `json:"count"`
+		Size  counts.Count64 `json:"size"`
+	}
+	run := func(args ...string) *bigFiles {
+		t.Helper()
+		cmd := exec.Command(sizerExe(t), append([]string{"--no-progress", "--json"}, args...)...)
+		cmd.Dir = repo.Path
+		cmd.Env = testutils.CleanGitEnv()
+		out, err := cmd.Output()
+		require.NoError(t, err, "running git-sizer")
+		var j struct {
+			BigFiles *bigFiles `json:"big_files"`
+		}
+		require.NoError(t, json.Unmarshal(out, &j))
+		return j.BigFiles
+	}
+
+	// Git's default is 512 MiB:
+	if bf := run(); assert.NotNil(t, bf) {
+		assert.Equal(t, counts.Count64(512<<20), bf.Limit)
+		assert.Equal(t, counts.Count32(0), bf.Count)
+	}
+
+	repo.ConfigAdd(t, "core.bigFileThreshold", "2k")
+	if bf := run(); assert.NotNil(t, bf) {
+		assert.Equal(t, counts.Count64(2048), bf.Limit)
+		assert.Equal(t, counts.Count32(1), bf.Count)
+		assert.Equal(t, counts.Count64(3000), bf.Size)
+	}
+
+	// The command line overrides the gitconfig, for what-if analysis:
+	if bf := run("--big-file-threshold=1k"); assert.NotNil(t, bf) {
+		assert.Equal(t, counts.Count64(1024), bf.Limit)
+		assert.Equal(t, counts.Count32(2), bf.Count)
+		assert.Equal(t, counts.Count64(4500), bf.Size)
+	}
+	assert.Nil(t, run("--big-file-threshold=0"))
+
+	cmd = exec.Command(sizerExe(t), "--print-config")
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	out, err := cmd.Output()
+	require.NoError(t, err, "running git-sizer")
+	assert.Contains(
+		t, string(out),
+		`"big-file-threshold": {
+        "value": 2048,
+        "source": "gitconfig",
+        "key": "core.bigFileThreshold"
+    }`,
+	)
+}
+
+func TestManifest(t *testing.T) {
+	t.Parallel()
+
+	repo := testutils.NewTestRepo(t, false, "manifest")
+	t.Cleanup(func() { repo.Remove(t) })
+
+	timestamp := time.Unix(1112911993, 0)
+	commit := func(msg string) string {
+		t.Helper()
+		cmd := repo.GitCommand(t, "commit", "-m", msg)
+		testutils.AddAuthorInfo(cmd, &timestamp)
+		require.NoError(t, cmd.Run(), "creating commit")
+		out, err := repo.GitCommand(t, "rev-parse", "HEAD").Output()
+		require.NoError(t, err)
+		return strings.TrimSpace(string(out))
+	}
+	revParse := func(rev string) string {
+		t.Helper()
+		out, err := repo.GitCommand(t, "rev-parse", rev).Output()
+		require.NoError(t, err)
+		return strings.TrimSpace(string(out))
+	}
+
+	repo.AddFile(t, ".gitattributes", "c.bin filter=lfs\n")
+	repo.AddFile(t, "a/big.bin", strings.Repeat("x", 2000))
+	repo.AddFile(t, "b/copy.bin", strings.Repeat("x", 2000))
+	repo.AddFile(t, "small.txt", "small\n")
+	first := commit("first")
+	oldBlob := revParse("HEAD:a/big.bin")
+
+	require.NoError(t, repo.GitCommand(t, "rm", "-q", "a/big.bin", "b/copy.bin").Run())
+	repo.AddFile(t, "c.bin", strings.Repeat("y", 3000))
+	second := commit("second")
+	newBlob := revParse("HEAD:c.bin")
+
+	// A blob that is only reachable via a tag pointing at it:
+	cmd := repo.GitCommand(t, "hash-object", "-w", "--stdin")
+	cmd.Stdin = strings.NewReader(strings.Repeat("z", 2500))
+	out, err := cmd.Output()
+	require.NoError(t, err)
+	taggedBlob := strings.TrimSpace(string(out))
+	require.NoError(t, repo.GitCommand(t, "tag", "blob-tag", taggedBlob).Run())
+
+	manifest := filepath.Join(t.TempDir(), "manifest.jsonl")
+	run := func(args ...string) []map[string]interface{} {
+		t.Helper()
+		cmd := exec.Command(sizerExe(t), append([]string{"--no-progress"}, args...)...)
+		cmd.Dir = repo.Path
+		cmd.Env = testutils.CleanGitEnv()
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, "running git-sizer: %s", out)
+
+		contents, err := os.ReadFile(manifest)
+		require.NoError(t, err)
+		var entries []map[string]interface{}
+		for _, line := range strings.SplitAfter(string(contents), "\n") {
+			if line == "" {
+				continue
+			}
+			var e map[string]interface{}
+			require.NoError(t, json.Unmarshal([]byte(line), &e), line)
+			entries = append(entries, e)
+		}
+		return entries
+	}
+
+	entries := run("--blob-size-limit=1k", "--manifest="+manifest)
+	assert.Equal(
+		t,
+		[]map[string]interface{}{
+			{
+				"oid":    oldBlob,
+				"size":   2000.0,
+				"paths":  []interface{}{"a/big.bin", "b/copy.bin"},
+				"commit": first,
+				"date":   "2005-04-07T15:13:13-07:00",
+				"ref":    "refs/heads/master",
+				"at_tip": false,
+			},
+			{
+				"oid":    newBlob,
+				"size":   3000.0,
+				"paths":  []interface{}{"c.bin"},
+				"commit": second,
+				"date":   "2005-04-07T15:14:13-07:00",
+				"ref":    "refs/heads/master",
+				"at_tip": true,
+			},
+			{
+				"oid":    taggedBlob,
+				"size":   2500.0,
+				"paths":  []interface{}{},
+				"at_tip": true,
+			},
+		},
+		entries,
+	)
+
+	// With `--lfs-candidates`, the gitattributes are checked, too:
+	entries = run("--blob-size-limit=1k", "--manifest="+manifest, "--lfs-candidates")
+	if assert.Len(t, entries, 3) {
+		assert.Equal(t, false, entries[0]["lfs"])
+		assert.Equal(t, true, entries[1]["lfs"])
+		assert.Equal(t, false, entries[2]["lfs"])
+	}
+
+	cmd = exec.Command(sizerExe(t), "--no-progress", "--manifest="+manifest)
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	out, err = cmd.CombinedOutput()
+	assert.Error(t, err)
+	assert.Contains(t, string(out), "--manifest requires --blob-size-limit")
+}
+
+func TestBlobRefWeight(t *testing.T) {
+	t.Parallel()
+
+	repo := testutils.NewTestRepo(t, false, "blob-ref-weight")
+	t.Cleanup(func() { repo.Remove(t) })
+
+	timestamp := time.Unix(1112911993, 0)
+
+	// "shared" (1000 B) is referred to by three distinct trees, for a
+	// weight of 3000 B, which beats the bigger "big" (2000 B):
+	repo.AddFile(t, "big.bin", strings.Repeat("x", 2000))
+	for _, dir := range []string{"a", "b", "c"} {
+		repo.AddFile(t, dir+"/shared.bin", strings.Repeat("s", 1000))
+		repo.AddFile(t, dir+"/"+dir+".txt", dir+"\n")
+	}
+
+	cmd := repo.GitCommand(t, "commit", "-m", "initial")
+	testutils.AddAuthorInfo(cmd, &timestamp)
+	require.NoError(t, cmd.Run(), "creating commit")
+
+	out, err := repo.GitCommand(t, "rev-parse", "HEAD:a/shared.bin").Output()
+	require.NoError(t, err)
+	shared := strings.TrimSpace(string(out))
+
+	h, err := sizes.ScanRepositoryUsingGraph(
+		repo.Repository(t),
+		refGrouper{}, sizes.NameStyleFull, meter.NoProgressMeter,
+		sizes.ScanOptions{},
+	)
+	require.NoError(t, err, "scanning repository")
+
+	assert.Equal(t, counts.Count64(3000), h.MaxBlobRefWeight)
+	assert.Equal(t, counts.Count32(1000), h.MaxBlobRefWeightSize)
+	assert.Equal(t, counts.Count32(3), h.MaxBlobRefWeightRefCount)
+	if assert.NotNil(t, h.MaxBlobRefWeightBlob) {
+		assert.Equal(t, shared, h.MaxBlobRefWeightBlob.OID.String())
+		assert.Regexp(t, `^refs/heads/master:[abc]/shared\.bin$`, h.MaxBlobRefWeightBlob.Path())
+	}
+
+	cmd = exec.Command(sizerExe(t), "--no-progress", "-v")
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	out, err = cmd.Output()
+	require.NoError(t, err, "running git-sizer")
+	assert.Regexp(t, `\|   \* Size times refs      \[\d+\] \|  2\.93 KiB \|`, string(out))
+	assert.Regexp(
+		t,
+		shared+` \(refs/heads/master:[abc]/shared\.bin\) 1000 B, 3 references\n`,
+		string(out),
+	)
+}
+
+func TestBlobSizeHistogram(t *testing.T) {
+	t.Parallel()
+
+	repo := testutils.NewTestRepo(t, false, "blob-size-histogram")
+	t.Cleanup(func() { repo.Remove(t) })
+
+	timestamp := time.Unix(1112911993, 0)
+
+	repo.AddFile(t, "tiny-1", "a\n")
+	repo.AddFile(t, "tiny-2", strings.Repeat("b", 999))
+	repo.AddFile(t, "small", strings.Repeat("c", 1000))
+	repo.AddFile(t, "large", strings.Repeat("d", 2000000))
+
+	cmd := repo.GitCommand(t, "commit", "-m", "initial")
+	testutils.AddAuthorInfo(cmd, &timestamp)
+	require.NoError(t, cmd.Run(), "creating commit")
+
+	h, err := sizes.ScanRepositoryUsingGraph(
+		repo.Repository(t),
+		refGrouper{}, sizes.NameStyleFull, meter.NoProgressMeter,
+		sizes.ScanOptions{},
+	)
+	require.NoError(t, err, "scanning repository")
+	assert.Nil(t, h.BlobSizeHistogram)
+
+	h, err = sizes.ScanRepositoryUsingGraph(
+		repo.Repository(t),
+		refGrouper{}, sizes.NameStyleFull, meter.NoProgressMeter,
+		sizes.ScanOptions{Histograms: true},
+	)
+	require.NoError(t, err, "scanning repository")
+	require.NotNil(t, h.BlobSizeHistogram)
+	buckets := h.BlobSizeHistogram.Buckets
+	require.Len(t, buckets, 7)
+
+	assert.Equal(t, uint64(0), buckets[0].Min)
+	assert.Equal(t, uint64(1000), buckets[0].Max)
+	assert.Equal(t, counts.Count32(2), buckets[0].Count)
+	assert.Equal(t, counts.Count64(1001), buckets[0].Size)
+
+	assert.Equal(t, counts.Count32(1), buckets[1].Count)
+	assert.Equal(t, counts.Count64(1000), buckets[1].Size)
+
+	assert.Equal(t, uint64(1000000), buckets[4].Min)
+	assert.Equal(t, counts.Count32(1), buckets[4].Count)
+	assert.Equal(t, counts.Count64(2000000), buckets[4].Size)
+
+	assert.Equal(t, uint64(100000000), buckets[6].Min)
+	assert.Equal(t, uint64(0), buckets[6].Max)
+	assert.Equal(t, counts.Count32(0), buckets[6].Count)
+
+	for _, args := range [][]string{{"--histograms"}, {"-v"}} {
+		cmd = exec.Command(sizerExe(t), append([]string{"--no-progress"}, args...)...)
+		cmd.Dir = repo.Path
+		cmd.Env = testutils.CleanGitEnv()
+		out, err := cmd.Output()
+		require.NoError(t, err, "running git-sizer")
+		assert.Contains(
+			t, string(out),
+			"\nBlob size histogram:\n\n"+
+				"    Range                  Count        Size\n"+
+				"    < 1 KB                     2      1001 B\n"+
+				"    1 KB - 10 KB               1      1000 B\n",
+		)
+		assert.Contains(t, string(out), "    1 MB - 10 MB               1    1.91 MiB\n")
+	}
+
+	cmd = exec.Command(sizerExe(t), "--no-progress")
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	out, err := cmd.Output()
+	require.NoError(t, err, "running git-sizer")
+	assert.NotContains(t, string(out), "Blob size histogram")
+}
+
+func TestTreeHistograms(t *testing.T) {
+	t.Parallel()
+
+	repo := testutils.NewTestRepo(t, false, "tree-histograms")
+	t.Cleanup(func() { repo.Remove(t) })
+
+	timestamp := time.Unix(1112911993, 0)
+	commit := func(subject string) {
+		t.Helper()
+		cmd := repo.GitCommand(t, "commit", "-m", subject)
+		testutils.AddAuthorInfo(cmd, &timestamp)
+		require.NoError(t, cmd.Run(), "creating commit")
+		timestamp = timestamp.Add(time.Hour)
+	}
+
+	repo.AddFile(t, "README", "Hello, world!\n")
+	commit("flat")
+
+	for i := 0; i < 12; i++ {
+		repo.AddFile(t, fmt.Sprintf("wide/file-%02d", i), fmt.Sprintf("%d\n", i))
+	}
+	repo.AddFile(t, "deep/a/b/file", "deep\n")
+	commit("wide and deep")
+
+	h, err := sizes.ScanRepositoryUsingGraph(
+		repo.Repository(t),
+		refGrouper{}, sizes.NameStyleFull, meter.NoProgressMeter,
+		sizes.ScanOptions{Histograms: true},
+	)
+	require.NoError(t, err, "scanning repository")
+
+	// The trees are the two root trees, `wide`, `deep`, `deep/a`,
+	// and `deep/a/b`:
+	require.NotNil(t, h.TreeEntriesHistogram)
+	entries := h.TreeEntriesHistogram.Buckets
+	require.Len(t, entries, 6)
+	assert.Equal(t, uint64(10), entries[0].Max)
+	assert.Equal(t, counts.Count32(5), entries[0].Count)
+	assert.Equal(t, counts.Count32(1), entries[1].Count)
+	assert.Equal(t, counts.Count64(h.UniqueTreeSize), entries[0].Size+entries[1].Size)
+
+	require.NotNil(t, h.PathDepthHistogram)
+	depths := h.PathDepthHistogram.Buckets
+	require.Len(t, depths, 7)
+	assert.Equal(t, counts.Count32(1), depths[0].Count)
+	assert.Equal(t, uint64(4), depths[2].Min)
+	assert.Equal(t, counts.Count32(1), depths[2].Count)
+	assert.Equal(t, counts.Count64(0), depths[2].Size)
+
+	cmd := exec.Command(sizerExe(t), "--no-progress", "--histograms")
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	out, err := cmd.Output()
+	require.NoError(t, err, "running git-sizer")
+	assert.Contains(
+		t, string(out),
+		"\nTree entry count histogram:\n\n"+
+			"    Range                  Count        Size\n"+
+			"    < 10                       5",
+	)
+	assert.Contains(t, string(out), "    100 - 1K                   0         0 B\n")
+	assert.Contains(
+		t, string(out),
+		"\nCommit path depth histogram:\n\n"+
+			"    Range                  Count\n"+
+			"    < 2                        1\n"+
+			"    2 - 4                      0\n"+
+			"    4 - 8                      1\n",
+	)
+}
+
+func TestBlobSizePercentiles(t *testing.T) {
+	t.Parallel()
+
+	repo := testutils.NewTestRepo(t, false, "blob-size-percentiles")
+	t.Cleanup(func() { repo.Remove(t) })
+
+	timestamp := time.Unix(1112911993, 0)
+
+	// Blobs with sizes 1 through 1000:
+	for i := 1; i <= 1000; i++ {
+		repo.AddFile(t, fmt.Sprintf("file-%04d", i), strings.Repeat("x", i))
+	}
+
+	cmd := repo.GitCommand(t, "commit", "-m", "initial")
+	testutils.AddAuthorInfo(cmd, &timestamp)
+	require.NoError(t, cmd.Run(), "creating commit")
+
+	h, err := sizes.ScanRepositoryUsingGraph(
+		repo.Repository(t),
+		refGrouper{}, sizes.NameStyleFull, meter.NoProgressMeter,
+		sizes.ScanOptions{},
+	)
+	require.NoError(t, err, "scanning repository")
+
+	assert.InEpsilon(t, 500, float64(h.BlobSizeP50), 0.01)
+	assert.InEpsilon(t, 900, float64(h.BlobSizeP90), 0.01)
+	assert.InEpsilon(t, 990, float64(h.BlobSizeP99), 0.01)
+	assert.LessOrEqual(t, h.BlobSizeP99, h.MaxBlobSize)
+}
+
+func TestInterruptedScan(t *testing.T) {
+	t.Parallel()
+
+	repo := testutils.NewTestRepo(t, false, "interrupted-scan")
+	t.Cleanup(func() { repo.Remove(t) })
+
+	timestamp := time.Unix(1112911993, 0)
+
+	repo.AddFile(t, "README", "Hello, world!\n")
+	cmd := repo.GitCommand(t, "commit", "-m", "initial")
+	testutils.AddAuthorInfo(cmd, &timestamp)
+	require.NoError(t, cmd.Run(), "creating commit")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	h, err := sizes.ScanRepositoryUsingGraphContext(
+		ctx, repo.Repository(t),
+		refGrouper{}, sizes.NameStyleFull, meter.NoProgressMeter,
+		sizes.ScanOptions{},
+	)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.True(t, h.Partial)
+	assert.Contains(
+		t, h.TableString(refGrouper{}.Groups(), sizes.Threshold(0), sizes.NameStyleFull, false),
+		"NOTE: The scan was interrupted, so these results are partial.",
+	)
+
+	// An uninterrupted scan isn't marked as partial:
+	h, err = sizes.ScanRepositoryUsingGraphContext(
+		context.Background(), repo.Repository(t),
+		refGrouper{}, sizes.NameStyleFull, meter.NoProgressMeter,
+		sizes.ScanOptions{},
+	)
+	require.NoError(t, err, "scanning repository")
+	assert.False(t, h.Partial)
+	assert.Equal(t, counts.Count32(1), h.UniqueBlobCount)
+}
+
+func TestInterruptedAnalysis(t *testing.T) {
+	t.Parallel()
+
+	if runtime.GOOS == "windows" {
+		t.Skip("the git wrapper script requires a POSIX shell")
+	}
+
+	repo := testutils.NewTestRepo(t, false, "interrupted-analysis")
+	t.Cleanup(func() { repo.Remove(t) })
+
+	timestamp := time.Unix(1112911993, 0)
+	repo.AddFile(t, "README", "Hello, world!\n")
+	cmd := repo.GitCommand(t, "commit", "-m", "initial")
+	testutils.AddAuthorInfo(cmd, &timestamp)
+	require.NoError(t, cmd.Run(), "creating commit")
+
+	// A git whose `check-attr` (used by `--attributes`) hangs, but
+	// which otherwise runs the real git:
+	gitBin, err := exec.LookPath("git")
+	require.NoError(t, err)
+	binDir := t.TempDir()
+	require.NoError(t, os.WriteFile(
+		filepath.Join(binDir, "git"),
+		[]byte(fmt.Sprintf(
+			"#!/bin/sh\n"+
+				"for arg; do\n"+
+				"    if test \"$arg\" = check-attr; then\n"+
+				"        exec sleep 60\n"+
+				"    fi\n"+
+				"done\n"+
+				"exec '%s' \"$@\"\n",
+			gitBin,
+		)),
+		0o755,
+	))
+
+	run := func(args ...string) (string, int) {
+		t.Helper()
+		cmd := exec.Command(
+			sizerExe(t),
+			append([]string{"--no-progress", "--timeout=2s", "--attributes", "--renames"}, args...)...,
+		)
+		cmd.Dir = repo.Path
+		cmd.Env = append(
+			testutils.CleanGitEnv(),
+			"PATH="+binDir+string(os.PathListSeparator)+os.Getenv("PATH"),
+		)
+		out, err := cmd.Output()
+		var exitErr *exec.ExitError
+		require.ErrorAs(t, err, &exitErr)
+		return string(out), exitErr.ExitCode()
+	}
+
+	// The results of the main scan are output, without the analysis
+	// that was cut short or the ones after it:
+	out, code := run("-v")
+	assert.Equal(t, 4, code)
+	assert.Contains(
+		t, out,
+		"NOTE: git-sizer was interrupted after the scan, so these results leave out\n"+
+			"what was asked for by --attributes, --renames.\n",
+	)
+	assert.Contains(t, out, "| * Blobs")
+	assert.NotContains(t, out, "Renames")
+
+	out, code = run("--json", "--json-version=2")
+	assert.Equal(t, 4, code)
+	var j struct {
+		Partial         bool                       `json:"partial"`
+		LeftOut         []string                   `json:"leftOut"`
+		UniqueBlobCount struct{ Value int }        `json:"uniqueBlobCount"`
+		Attributes      map[string]json.RawMessage `json:"attributes"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(out), &j))
+	assert.True(t, j.Partial)
+	assert.Equal(t, []string{"--attributes", "--renames", `the "objects" table`}, j.LeftOut)
+	assert.Equal(t, 1, j.UniqueBlobCount.Value)
+	assert.Nil(t, j.Attributes)
+}
+
+// childPIDs returns the PIDs of the child processes of this process,
+// including zombies, by reading `/proc`.
+func childPIDs(t *testing.T) []int {
+	t.Helper()
+
+	entries, err := os.ReadDir("/proc")
+	require.NoError(t, err, "reading /proc")
+	self := os.Getpid()
+	var pids []int
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		stat, err := os.ReadFile(filepath.Join("/proc", entry.Name(), "stat"))
+		if err != nil {
+			// The process has exited in the meantime.
+			continue
+		}
+		// The fields after the command name, which is in parentheses
+		// and might contain spaces, are the state and the PPID:
+		fields := strings.Fields(string(stat[bytes.LastIndexByte(stat, ')')+1:]))
+		if len(fields) >= 2 && fields[1] == strconv.Itoa(self) {
+			pids = append(pids, pid)
+		}
+	}
+	return pids
+}
+
+// cancelingMeter is a `meter.Progress` that calls `cancel` when the
+// trees start being processed.
+type cancelingMeter struct {
+	cancel context.CancelFunc
+}
+
+func (cm cancelingMeter) Start(format string) {
+	if strings.HasPrefix(format, "Processing trees") {
+		cm.cancel()
+	}
+}
+
+func (cm cancelingMeter) Inc()                           {}
+func (cm cancelingMeter) Add(delta int64)                {}
+func (cm cancelingMeter) Done()                          {}
+func (cm cancelingMeter) DoneWithSummary(summary string) {}
+
+// TestRepositoryClose isn't run in parallel, so that the child
+// processes of other tests don't get in the way.
+func TestRepositoryClose(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("child processes are found via /proc")
+	}
+
+	repo := testutils.NewTestRepo(t, false, "repository-close")
+	t.Cleanup(func() { repo.Remove(t) })
+
+	timestamp := time.Unix(1112911993, 0)
+	for i := 0; i < 10; i++ {
+		for j := 0; j < 20; j++ {
+			repo.AddFile(t, fmt.Sprintf("d%d/f%d.txt", j, i), fmt.Sprintf("%d %d\n", i, j))
+		}
+		cmd := repo.GitCommand(t, "commit", "-m", fmt.Sprintf("commit %d", i))
+		testutils.AddAuthorInfo(cmd, &timestamp)
+		require.NoError(t, cmd.Run(), "creating commit")
+	}
+
+	r, err := git.NewRepository(repo.Path)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	_, err = sizes.ScanRepositoryUsingGraphContext(
+		ctx, r, refGrouper{}, sizes.NameStyleFull, cancelingMeter{cancel},
+		sizes.ScanOptions{},
+	)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	// Abandon an iterator partway through its output, too:
+	iter, err := r.NewBatchObjectIter(context.Background())
+	require.NoError(t, err)
+	head, err := r.ResolveCommit("HEAD")
+	require.NoError(t, err)
+	require.NoError(t, iter.RequestObject(head))
+	require.NoError(t, iter.RequestObject(head))
+	iter.Close()
+	_, ok, err := iter.Next()
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.NotEmpty(t, childPIDs(t))
+
+	r.Close()
+	assert.Empty(t, childPIDs(t), "child processes remain after Close()")
+
+	// Closing again is harmless, but no more commands can be started:
+	r.Close()
+	_, err = r.NewBatchObjectIter(context.Background())
+	assert.ErrorIs(t, err, git.ErrRepositoryClosed)
+}
+
+// checkpointCopier is a `meter.Progress` that copies the checkpoint
+// file when the trees start being processed, by which time it has
+// been written. Restoring the copy after the scan has completed (and
+// removed the checkpoint) simulates an interruption.
+type checkpointCopier struct {
+	t          *testing.T
+	checkpoint string
+	copy       string
+}
+
+func (cc checkpointCopier) Start(format string) {
+	if strings.HasPrefix(format, "Processing trees") {
+		data, err := os.ReadFile(cc.checkpoint)
+		require.NoError(cc.t, err, "reading checkpoint")
+		require.NoError(cc.t, os.WriteFile(cc.copy, data, 0o644), "copying checkpoint")
+	}
+}
+
+func (cc checkpointCopier) Inc()                           {}
+func (cc checkpointCopier) Add(delta int64)                {}
+func (cc checkpointCopier) Done()                          {}
+func (cc checkpointCopier) DoneWithSummary(summary string) {}
+
+func TestCheckpoint(t *testing.T) {
+	t.Parallel()
+
+	repo := testutils.NewTestRepo(t, false, "checkpoint")
+	t.Cleanup(func() { repo.Remove(t) })
+
+	timestamp := time.Unix(1112911993, 0)
+	commit := func(msg string) {
+		t.Helper()
+		cmd := repo.GitCommand(t, "commit", "-m", msg)
+		testutils.AddAuthorInfo(cmd, &timestamp)
+		require.NoError(t, cmd.Run(), "creating commit")
+	}
+
+	repo.AddFile(t, "README", "Hello, world!\n")
+	repo.AddFile(t, "src/main.go", "package main\n")
+	commit("initial")
+	repo.AddFile(t, "src/main.go", "package main\n\nfunc main() {}\n")
+	commit("add main")
+
+	dir := t.TempDir()
+	checkpoint := filepath.Join(dir, "checkpoint")
+	saved := filepath.Join(dir, "saved")
+	restore := func() {
+		t.Helper()
+		data, err := os.ReadFile(saved)
+		require.NoError(t, err, "reading saved checkpoint")
+		require.NoError(t, os.WriteFile(checkpoint, data, 0o644), "restoring checkpoint")
+	}
+	table := func(h sizes.HistorySize) string {
+		return h.TableString(refGrouper{}.Groups(), sizes.Threshold(0), sizes.NameStyleFull, false)
+	}
+	scan := func(progress meter.Progress, opts sizes.ScanOptions) (sizes.HistorySize, error) {
+		opts.Checkpoint = checkpoint
+		if opts.CheckpointVersion == "" {
+			opts.CheckpointVersion = "1.0"
+		}
+		return sizes.ScanRepositoryUsingGraph(
+			repo.Repository(t), refGrouper{}, sizes.NameStyleFull, progress, opts,
+		)
+	}
+
+	expected, err := sizes.ScanRepositoryUsingGraph(
+		repo.Repository(t),
+		refGrouper{}, sizes.NameStyleFull, meter.NoProgressMeter,
+		sizes.ScanOptions{},
+	)
+	require.NoError(t, err, "scanning repository")
+
+	// The checkpoint is written, then removed once the scan is done:
+	h, err := scan(checkpointCopier{t, checkpoint, saved}, sizes.ScanOptions{})
+	require.NoError(t, err, "scanning repository")
+	assert.Equal(t, table(expected), table(h))
+	assert.NoFileExists(t, checkpoint)
+	assert.FileExists(t, saved)
+
+	// Resuming from the checkpoint gives the same results:
+	restore()
+	h, err = scan(meter.NoProgressMeter, sizes.ScanOptions{})
+	require.NoError(t, err, "resuming scan")
+	assert.Equal(t, table(expected), table(h))
+	assert.NoFileExists(t, checkpoint)
+
+	// A checkpoint from another version, or for other options, is
+	// refused and left alone:
+	restore()
+	_, err = scan(meter.NoProgressMeter, sizes.ScanOptions{CheckpointVersion: "2.0"})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "different version of git-sizer")
+	}
+	_, err = scan(meter.NoProgressMeter, sizes.ScanOptions{TopBlobs: 3})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "different options")
+	}
+	assert.FileExists(t, checkpoint)
+
+	// So is one written for other references:
+	repo.AddFile(t, "README", "Goodbye!\n")
+	commit("update README")
+	_, err = scan(meter.NoProgressMeter, sizes.ScanOptions{})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "references have changed")
+	}
+	assert.FileExists(t, checkpoint)
+
+	_, err = scan(meter.NoProgressMeter, sizes.ScanOptions{SampleRate: 0.5})
+	assert.Error(t, err)
+}
+
+func TestMergeBase(t *testing.T) {
+	t.Parallel()
+
+	repo := testutils.NewTestRepo(t, false, "merge-base")
+	t.Cleanup(func() { repo.Remove(t) })
+
+	timestamp := time.Unix(1112911993, 0)
+	commit := func(subject string) {
+		t.Helper()
+		cmd := repo.GitCommand(t, "commit", "-m", subject)
+		testutils.AddAuthorInfo(cmd, &timestamp)
+		require.NoError(t, cmd.Run(), "creating commit")
+		timestamp = timestamp.Add(time.Hour)
+	}
+
+	repo.AddFile(t, "base.txt", strings.Repeat("b", 10000))
+	commit("base")
+
+	require.NoError(t, repo.GitCommand(t, "checkout", "-q", "-b", "feature").Run())
+	repo.AddFile(t, "feature/one.txt", strings.Repeat("1", 100))
+	commit("feature 1")
+	repo.AddFile(t, "feature/one.txt", strings.Repeat("2", 200))
+	commit("feature 2")
+
+	require.NoError(t, repo.GitCommand(t, "checkout", "-q", "master").Run())
+	repo.AddFile(t, "main.txt", strings.Repeat("m", 5000))
+	commit("main")
+
+	root, mergeBase, err := sizes.ResolveMergeBaseRange(repo.Repository(t), "master...feature")
+	require.NoError(t, err)
+	out, err := repo.GitCommand(t, "rev-parse", "master~1", "feature").Output()
+	require.NoError(t, err)
+	oids := strings.Fields(string(out))
+	assert.Equal(t, oids[0], mergeBase.String())
+	assert.Equal(t, oids[1], root.OID.String())
+	assert.Equal(t, "feature", root.Refname)
+
+	h, err := sizes.ScanRepositoryUsingGraph(
+		repo.Repository(t),
+		refGrouper{}, sizes.NameStyleFull, meter.NoProgressMeter,
+		sizes.ScanOptions{
+			Roots:   []git.Reference{root},
+			Exclude: []git.OID{mergeBase},
+		},
+	)
+	require.NoError(t, err, "scanning repository")
+
+	assert.Equal(t, counts.Count32(2), h.UniqueCommitCount)
+	assert.Equal(t, counts.Count32(2), h.MaxHistoryDepth)
+	assert.Equal(t, counts.Count32(2), h.UniqueBlobCount)
+	assert.Equal(t, counts.Count64(300), h.UniqueBlobSize)
+	assert.Equal(t, counts.Count32(200), h.MaxBlobSize)
+	// Both references are still counted:
+	assert.Equal(t, counts.Count32(2), h.ReferenceCount)
+	if assert.NotNil(t, h.MaxBlobSizeBlob) {
+		assert.Equal(t, "feature:feature/one.txt", h.MaxBlobSizeBlob.Path())
+	}
+	if assert.NotNil(t, h.Scope) {
+		assert.Equal(t, []string{"feature"}, h.Scope.Roots)
+		assert.Equal(t, []git.OID{mergeBase}, h.Scope.Exclude)
+	}
+
+	cmd := exec.Command(sizerExe(t), "--no-progress", "-v", "--merge-base=master..feature")
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	out, err = cmd.Output()
+	require.NoError(t, err, "running git-sizer")
+	assert.Contains(
+		t, string(out),
+		fmt.Sprintf("NOTE: Only objects reachable from feature\nbut not from %s were scanned.\n", mergeBase),
+	)
+	assert.Regexp(t, `\| \* Commits +\| +\| +\|\n\|   \* Count +\|     2     \|`, string(out))
+
+	cmd = exec.Command(sizerExe(t), "--no-progress", "--merge-base=feature")
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	out, err = cmd.CombinedOutput()
+	assert.Error(t, err)
+	assert.Contains(t, string(out), "malformed range")
+}
+
+func TestPathScope(t *testing.T) {
+	t.Parallel()
+
+	repo := testutils.NewTestRepo(t, false, "path-scope")
+	t.Cleanup(func() { repo.Remove(t) })
+
+	timestamp := time.Unix(1112911993, 0)
+	commit := func(subject string) {
+		t.Helper()
+		cmd := repo.GitCommand(t, "commit", "-m", subject)
+		testutils.AddAuthorInfo(cmd, &timestamp)
+		require.NoError(t, cmd.Run(), "creating commit")
+		timestamp = timestamp.Add(time.Hour)
+	}
+
+	// "shared.txt" is both inside and outside of the scope, so it
+	// counts:
+	repo.AddFile(t, "services/payments/shared.txt", strings.Repeat("s", 10))
+	repo.AddFile(t, "services/payments/api/main.go", strings.Repeat("p", 100))
+	repo.AddFile(t, "services/billing/shared.txt", strings.Repeat("s", 10))
+	repo.AddFile(t, "services/billing/big.bin", strings.Repeat("b", 10000))
+	commit("initial")
+
+	// The old version of "main.go" is only in the history:
+	repo.AddFile(t, "services/payments/api/main.go", strings.Repeat("q", 200))
+	commit("update payments")
+
+	h, err := sizes.ScanRepositoryUsingGraph(
+		repo.Repository(t),
+		refGrouper{}, sizes.NameStyleFull, meter.NoProgressMeter,
+		sizes.ScanOptions{PathRules: []sizes.PathRule{{Prefix: "services/payments"}}},
+	)
+	require.NoError(t, err, "scanning repository")
+
+	assert.Equal(t, counts.Count32(3), h.UniqueBlobCount)
+	assert.Equal(t, counts.Count64(310), h.UniqueBlobSize)
+	assert.Equal(t, counts.Count32(200), h.MaxBlobSize)
+	if assert.NotNil(t, h.MaxBlobSizeBlob) {
+		assert.Equal(t, "refs/heads/master:services/payments/api/main.go", h.MaxBlobSizeBlob.Path())
+	}
+	// Two versions each of "services/payments" and
+	// "services/payments/api":
+	assert.Equal(t, counts.Count32(4), h.UniqueTreeCount)
+	// The biggest checkout is that of "services/payments":
+	assert.Equal(t, counts.Count32(2), h.MaxExpandedBlobCount)
+	// The commit statistics cover the whole history:
+	assert.Equal(t, counts.Count32(2), h.UniqueCommitCount)
+	if assert.NotNil(t, h.Scope) {
+		assert.Equal(t, []sizes.PathRule{{Prefix: "services/payments"}}, h.Scope.PathRules)
+		assert.Empty(t, h.Scope.Roots)
+		// "big.bin" was left out:
+		assert.Equal(t, counts.Count32(1), h.Scope.ExcludedBlobCount)
+		assert.Equal(t, counts.Count64(10000), h.Scope.ExcludedBlobSize)
+	}
+
+	// A path can also name a blob:
+	h, err = sizes.ScanRepositoryUsingGraph(
+		repo.Repository(t),
+		refGrouper{}, sizes.NameStyleFull, meter.NoProgressMeter,
+		sizes.ScanOptions{PathRules: []sizes.PathRule{
+			{Prefix: "services/billing/big.bin"}, {Prefix: "no/such/path"},
+		}},
+	)
+	require.NoError(t, err, "scanning repository")
+	assert.Equal(t, counts.Count32(1), h.UniqueBlobCount)
+	assert.Equal(t, counts.Count32(0), h.UniqueTreeCount)
+
+	for _, tc := range []struct {
+		name      string
+		rules     []sizes.PathRule
+		blobCount counts.Count32
+		blobSize  counts.Count64
+	}{
+		{
+			// "shared.txt" is also under "services/payments", so it
+			// still counts:
+			name:      "exclude",
+			rules:     []sizes.PathRule{{Prefix: "services/billing", Exclude: true}},
+			blobCount: 3,
+			blobSize:  310,
+		},
+		{
+			name: "include-then-exclude",
+			rules: []sizes.PathRule{
+				{Prefix: "services"}, {Prefix: "services/billing", Exclude: true},
+			},
+			blobCount: 3,
+			blobSize:  310,
+		},
+		{
+			// The last rule that matches wins:
+			name: "exclude-then-include",
+			rules: []sizes.PathRule{
+				{Prefix: "services/billing", Exclude: true}, {Prefix: "services"},
+			},
+			blobCount: 4,
+			blobSize:  10310,
+		},
+		{
+			name: "exclude-all-but-one",
+			rules: []sizes.PathRule{
+				{Prefix: "services", Exclude: true}, {Prefix: "services/billing/big.bin"},
+			},
+			blobCount: 1,
+			blobSize:  10000,
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			h, err := sizes.ScanRepositoryUsingGraph(
+				repo.Repository(t),
+				refGrouper{}, sizes.NameStyleFull, meter.NoProgressMeter,
+				sizes.ScanOptions{PathRules: tc.rules},
+			)
+			require.NoError(t, err, "scanning repository")
+			assert.Equal(t, tc.blobCount, h.UniqueBlobCount)
+			assert.Equal(t, tc.blobSize, h.UniqueBlobSize)
+			if assert.NotNil(t, h.Scope) {
+				assert.Equal(t, 4-tc.blobCount, h.Scope.ExcludedBlobCount)
+				assert.Equal(t, 10310-tc.blobSize, h.Scope.ExcludedBlobSize)
+			}
+		})
+	}
+
+	cmd := exec.Command(
+		sizerExe(t), "--no-progress", "-v", "--path=services/payments/", "--path", "services/billing",
+	)
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	out, err := cmd.Output()
+	require.NoError(t, err, "running git-sizer")
+	assert.Contains(
+		t, string(out),
+		"NOTE: The blob and tree statistics only include objects at the paths\n"+
+			"selected by --path=services/payments --path=services/billing.\n"+
+			"0 other blobs (0 B) were left out.",
+	)
+	assert.Regexp(t, `\| \* Blobs +\| +\| +\|\n\|   \* Count +\|     4     \|`, string(out))
+
+	cmd = exec.Command(
+		sizerExe(t), "--no-progress", "--json", "--json-version=2",
+		"--path=services", "--exclude-path=services/billing/",
+	)
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	out, err = cmd.Output()
+	require.NoError(t, err, "running git-sizer")
+	var j struct {
+		Scope struct {
+			PathRules         []sizes.PathRule `json:"pathRules"`
+			ExcludedBlobCount counts.Count32   `json:"excludedBlobCount"`
+			ExcludedBlobSize  counts.Count64   `json:"excludedBlobSize"`
+		} `json:"scope"`
+	}
+	require.NoError(t, json.Unmarshal(out, &j))
+	assert.Equal(
+		t,
+		[]sizes.PathRule{{Prefix: "services"}, {Prefix: "services/billing", Exclude: true}},
+		j.Scope.PathRules,
+	)
+	assert.Equal(t, counts.Count32(1), j.Scope.ExcludedBlobCount)
+	assert.Equal(t, counts.Count64(10000), j.Scope.ExcludedBlobSize)
+
+	cmd = exec.Command(sizerExe(t), "--no-progress", "--path=../elsewhere")
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	out, err = cmd.CombinedOutput()
+	assert.Error(t, err)
+	assert.Contains(t, string(out), `"../elsewhere" must name a file or directory`)
+}
+
+func TestPathRegexp(t *testing.T) {
+	t.Parallel()
+
+	repo := testutils.NewTestRepo(t, false, "path-regexp")
+	t.Cleanup(func() { repo.Remove(t) })
+
+	timestamp := time.Unix(1112911993, 0)
+	commit := func(subject string) {
+		t.Helper()
+		cmd := repo.GitCommand(t, "commit", "-m", subject)
+		testutils.AddAuthorInfo(cmd, &timestamp)
+		require.NoError(t, cmd.Run(), "creating commit")
+		timestamp = timestamp.Add(time.Hour)
+	}
+
+	repo.AddFile(t, "services/payments/shared.txt", strings.Repeat("s", 10))
+	repo.AddFile(t, "services/payments/api/main.go", strings.Repeat("p", 100))
+	repo.AddFile(t, "services/billing/shared.txt", strings.Repeat("s", 10))
+	repo.AddFile(t, "services/billing/big.bin", strings.Repeat("b", 10000))
+	commit("initial")
+	repo.AddFile(t, "services/payments/api/main.go", strings.Repeat("q", 200))
+	commit("update payments")
+
+	rule := func(pattern string, exclude bool) sizes.PathRule {
+		t.Helper()
+		r, err := sizes.NewPathRegexpRule(pattern, exclude)
+		require.NoError(t, err)
+		return r
+	}
+
+	for _, tc := range []struct {
+		name      string
+		rules     []sizes.PathRule
+		blobCount counts.Count32
+		blobSize  counts.Count64
+		treeCount counts.Count32
+	}{
+		{
+			name:      "include-files",
+			rules:     []sizes.PathRule{rule(`.*\.go`, false)},
+			blobCount: 2,
+			blobSize:  300,
+		},
+		{
+			name:      "exclude-files",
+			rules:     []sizes.PathRule{rule(`.*\.bin`, true)},
+			blobCount: 3,
+			blobSize:  310,
+			treeCount: 9,
+		},
+		{
+			// The regexp has to match the whole path:
+			name:  "anchored",
+			rules: []sizes.PathRule{rule(`main`, false)},
+		},
+		{
+			// Matching a directory selects everything under it:
+			name:      "directory",
+			rules:     []sizes.PathRule{rule(`.*/api`, false)},
+			blobCount: 2,
+			blobSize:  300,
+			treeCount: 2,
+		},
+		{
+			name: "mixed-with-prefix",
+			rules: []sizes.PathRule{
+				{Prefix: "services/billing"}, rule(`.*\.bin`, true),
+			},
+			blobCount: 1,
+			blobSize:  10,
+			treeCount: 1,
+		},
+		{
+			// The last rule that matches wins:
+			name: "last-wins",
+			rules: []sizes.PathRule{
+				{Prefix: "services/billing"}, rule(`.*\.bin`, true), rule(`services/billing/big\.bin`, false),
+			},
+			blobCount: 2,
+			blobSize:  10010,
+			treeCount: 1,
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			h, err := sizes.ScanRepositoryUsingGraph(
+				repo.Repository(t),
+				refGrouper{}, sizes.NameStyleFull, meter.NoProgressMeter,
+				sizes.ScanOptions{PathRules: tc.rules},
+			)
+			require.NoError(t, err, "scanning repository")
+			assert.Equal(t, tc.blobCount, h.UniqueBlobCount)
+			assert.Equal(t, tc.blobSize, h.UniqueBlobSize)
+			assert.Equal(t, tc.treeCount, h.UniqueTreeCount)
+			if assert.NotNil(t, h.Scope) {
+				assert.Equal(t, 4-tc.blobCount, h.Scope.ExcludedBlobCount)
+			}
+		})
+	}
+
+	cmd := exec.Command(
+		sizerExe(t), "--no-progress", "-v",
+		"--path=services", "--exclude-path-regexp", `(.*/)?api`,
+	)
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	out, err := cmd.Output()
+	require.NoError(t, err, "running git-sizer")
+	assert.Contains(
+		t, string(out),
+		"NOTE: The blob and tree statistics only include objects at the paths\n"+
+			"selected by --path=services --exclude-path-regexp=(.*/)?api.\n"+
+			"2 other blobs (300 B) were left out.",
+	)
+
+	cmd = exec.Command(
+		sizerExe(t), "--no-progress", "--json", "--json-version=2", "--path-regexp=.*\\.txt",
+	)
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	out, err = cmd.Output()
+	require.NoError(t, err, "running git-sizer")
+	var j struct {
+		Scope struct {
+			PathRules []map[string]interface{} `json:"pathRules"`
+		} `json:"scope"`
+	}
+	require.NoError(t, json.Unmarshal(out, &j))
+	assert.Equal(
+		t, []map[string]interface{}{{"regexp": `.*\.txt`}}, j.Scope.PathRules,
+	)
+
+	cmd = exec.Command(sizerExe(t), "--no-progress", "--path-regexp=(")
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	out, err = cmd.CombinedOutput()
+	assert.Error(t, err)
+	assert.Contains(t, string(out), `invalid path regexp "("`)
+}
+
+func TestIntroducedSince(t *testing.T) {
+	t.Parallel()
+
+	repo := testutils.NewTestRepo(t, false, "introduced-since")
+	t.Cleanup(func() { repo.Remove(t) })
+
+	timestamp := time.Unix(1112911993, 0)
+	commit := func(subject string) {
+		t.Helper()
+		cmd := repo.GitCommand(t, "commit", "-m", subject)
+		testutils.AddAuthorInfo(cmd, &timestamp)
+		require.NoError(t, cmd.Run(), "creating commit")
+		timestamp = timestamp.Add(time.Hour)
+	}
+
+	repo.AddFile(t, "old.txt", strings.Repeat("o", 1000))
+	repo.AddFile(t, "deep/x/y/z.txt", strings.Repeat("z", 10))
+	commit("old")
+	cutoff := timestamp.Add(-time.Minute)
+
+	// Removing "deep" makes the newer checkout shallower. "old.txt"
+	// is still there, but it was introduced before the cutoff:
+	repo.AddFile(t, "new.txt", strings.Repeat("n", 300))
+	require.NoError(t, repo.GitCommand(t, "rm", "-rq", "deep").Run(), "removing deep")
+	commit("new")
+
+	h, err := sizes.ScanRepositoryUsingGraph(
+		repo.Repository(t),
+		refGrouper{}, sizes.NameStyleFull, meter.NoProgressMeter,
+		sizes.ScanOptions{IntroducedSince: cutoff},
+	)
+	require.NoError(t, err, "scanning repository")
+
+	assert.Equal(t, counts.Count32(1), h.UniqueBlobCount)
+	assert.Equal(t, counts.Count64(300), h.UniqueBlobSize)
+	// Only the new root tree:
+	assert.Equal(t, counts.Count32(1), h.UniqueTreeCount)
+	// The commit and checkout statistics cover the whole history:
+	assert.Equal(t, counts.Count32(2), h.UniqueCommitCount)
+	assert.Equal(t, counts.Count32(4), h.MaxPathDepth)
+	if assert.NotNil(t, h.Scope) && assert.NotNil(t, h.Scope.IntroducedSince) {
+		assert.True(t, cutoff.Equal(*h.Scope.IntroducedSince))
+		assert.Equal(t, counts.Count32(2), h.Scope.ExcludedBlobCount)
+		assert.Equal(t, counts.Count64(1010), h.Scope.ExcludedBlobSize)
+	}
+
+	// It can be combined with path rules:
+	h, err = sizes.ScanRepositoryUsingGraph(
+		repo.Repository(t),
+		refGrouper{}, sizes.NameStyleFull, meter.NoProgressMeter,
+		sizes.ScanOptions{
+			IntroducedSince: cutoff,
+			PathRules:       []sizes.PathRule{{Prefix: "old.txt"}},
+		},
+	)
+	require.NoError(t, err, "scanning repository")
+	assert.Equal(t, counts.Count32(0), h.UniqueBlobCount)
+	if assert.NotNil(t, h.Scope) {
+		assert.Equal(t, counts.Count32(3), h.Scope.ExcludedBlobCount)
+	}
+
+	since := cutoff.UTC().Format(time.RFC3339)
+	cmd := exec.Command(sizerExe(t), "--no-progress", "-v", "--introduced-since="+since)
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	out, err := cmd.Output()
+	require.NoError(t, err, "running git-sizer")
+	assert.Contains(
+		t, string(out),
+		"NOTE: The blob and tree statistics only include objects first introduced by\n"+
+			"commits dated after "+since+".\n"+
+			"2 other blobs (1010 B) were left out.",
+	)
+	assert.Contains(t, string(out), "The checkout statistics (e.g., the maximum path depth) aren't\n")
+
+	cmd = exec.Command(
+		sizerExe(t), "--no-progress", "--json", "--json-version=2", "--introduced-since=2005-04-08",
+	)
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	out, err = cmd.Output()
+	require.NoError(t, err, "running git-sizer")
+	var j struct {
+		Scope struct {
+			IntroducedSince   *time.Time     `json:"introducedSince"`
+			ExcludedBlobCount counts.Count32 `json:"excludedBlobCount"`
+			ExcludedBlobSize  counts.Count64 `json:"excludedBlobSize"`
+		} `json:"scope"`
+	}
+	require.NoError(t, json.Unmarshal(out, &j))
+	if assert.NotNil(t, j.Scope.IntroducedSince) {
+		assert.Equal(t, "2005-04-08T00:00:00Z", j.Scope.IntroducedSince.Format(time.RFC3339))
+	}
+	// Both commits are older than that:
+	assert.Equal(t, counts.Count32(3), j.Scope.ExcludedBlobCount)
+
+	cmd = exec.Command(sizerExe(t), "--no-progress", "--introduced-since=yesterday")
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	out, err = cmd.CombinedOutput()
+	assert.Error(t, err)
+	assert.Contains(t, string(out), "invalid --introduced-since")
+}
+
+func TestDiffCommits(t *testing.T) {
+	t.Parallel()
+
+	repo := testutils.NewTestRepo(t, false, "diff-commits")
+	t.Cleanup(func() { repo.Remove(t) })
+
+	commit := func(subject string, timestamp time.Time) {
+		t.Helper()
+		cmd := repo.GitCommand(t, "commit", "--allow-empty", "-m", subject)
+		testutils.AddAuthorInfo(cmd, &timestamp)
+		require.NoError(t, cmd.Run(), "creating commit")
+	}
+
+	// The root commit adds three paths:
+	for i := 0; i < 3; i++ {
+		repo.AddFile(t, fmt.Sprintf("file-%d.txt", i), "original\n")
+	}
+	commit("initial", time.Unix(1112911993, 0))
+
+	// This commit changes four paths: one modified, one deleted, and
+	// two added:
+	repo.AddFile(t, "file-0.txt", "modified\n")
+	require.NoError(t, repo.GitCommand(t, "rm", "-q", "file-1.txt").Run())
+	repo.AddFile(t, "dir/a.txt", "a\n")
+	repo.AddFile(t, "dir/b.txt", "b\n")
+	commit("bulk change", time.Unix(1112912993, 0))
+
+	// A merge whose tree equals that of its first parent changes
+	// nothing, even though it differs from its other parent in six
+	// paths:
+	require.NoError(t, repo.GitCommand(t, "checkout", "-q", "-b", "side", "HEAD~").Run())
+	for i := 0; i < 2; i++ {
+		repo.AddFile(t, fmt.Sprintf("side/%d.txt", i), "side\n")
+	}
+	commit("side", time.Unix(1112913993, 0))
+	require.NoError(t, repo.GitCommand(t, "checkout", "-q", "master").Run())
+	cmd := repo.GitCommand(t, "merge", "-q", "-s", "ours", "-m", "merge side", "side")
+	timestamp := time.Unix(1112914993, 0)
+	testutils.AddAuthorInfo(cmd, &timestamp)
+	require.NoError(t, cmd.Run(), "merging")
+	require.NoError(t, repo.GitCommand(t, "branch", "-q", "-D", "side").Run())
+
+	out, err := repo.GitCommand(t, "rev-parse", "master^").Output()
+	require.NoError(t, err)
+	bulk := strings.TrimSpace(string(out))
+
+	h, err := sizes.ScanRepositoryUsingGraph(
+		repo.Repository(t),
+		refGrouper{}, sizes.NameStyleFull, meter.NoProgressMeter,
+		sizes.ScanOptions{DiffCommits: true},
+	)
+	require.NoError(t, err, "scanning repository")
+
+	if assert.NotNil(t, h.CommitDiffs) {
+		d := h.CommitDiffs
+		assert.Equal(t, counts.Count32(4), d.MaxChangedPaths, "max changed paths")
+		if assert.NotNil(t, d.MaxChangedPathsCommit) {
+			assert.Equal(t, bulk, d.MaxChangedPathsCommit.OID.String())
+		}
+		assert.Equal(t, "2005-04-07T15:29:53-07:00", d.MaxChangedPathsDate)
+		assert.Equal(t, "bulk change", d.MaxChangedPathsSubject)
+	}
+
+	// Without the option, the commits aren't diffed:
+	h, err = sizes.ScanRepositoryUsingGraph(
+		repo.Repository(t),
+		refGrouper{}, sizes.NameStyleFull, meter.NoProgressMeter,
+		sizes.ScanOptions{},
+	)
+	require.NoError(t, err, "scanning repository")
+	assert.Nil(t, h.CommitDiffs)
+
+	cmd = exec.Command(sizerExe(t), "--no-progress", "-v", "--diff-commits")
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	out, err = cmd.Output()
+	require.NoError(t, err, "running git-sizer")
+	assert.Regexp(t, `\* Most changed paths\s+\[(\d+)\]\s+\|\s+4\s+\|`, string(out))
+	assert.Contains(t, string(out), bulk+" 2005-04-07T15:29:53-07:00 bulk change\n")
+}
+
+func TestDirFanOut(t *testing.T) {
+	t.Parallel()
+
+	repo := testutils.NewTestRepo(t, false, "dir-fan-out")
+	t.Cleanup(func() { repo.Remove(t) })
+
+	timestamp := time.Unix(1112911993, 0)
+	commit := func(subject string) {
+		t.Helper()
+		cmd := repo.GitCommand(t, "commit", "-m", subject)
+		testutils.AddAuthorInfo(cmd, &timestamp)
+		require.NoError(t, cmd.Run(), "creating commit")
+	}
+
+	repo.AddFile(t, "README", "readme\n")
+	repo.AddFile(t, "dir/sub/a.txt", "a\n")
+	repo.AddFile(t, "dir/sub/b.txt", "b\n")
+	commit("initial")
+
+	// `dir/sub` never has more than two entries at a time, but over
+	// history it contains four distinct names:
+	require.NoError(t, repo.GitCommand(t, "rm", "-q", "dir/sub/a.txt", "dir/sub/b.txt").Run())
+	repo.AddFile(t, "dir/sub/c.txt", "c\n")
+	commit("replace")
+	repo.AddFile(t, "dir/sub/d.txt", "d\n")
+	commit("add")
+
+	out, err := repo.GitCommand(t, "rev-parse", "HEAD").Output()
+	require.NoError(t, err)
+	head := strings.TrimSpace(string(out))
+
+	h, err := sizes.ScanRepositoryUsingGraph(
+		repo.Repository(t),
+		refGrouper{}, sizes.NameStyleFull, meter.NoProgressMeter,
+		sizes.ScanOptions{DiffCommits: true},
+	)
+	require.NoError(t, err, "scanning repository")
+
+	assert.Equal(t, counts.Count32(2), h.MaxTreeEntries, "max tree entries")
+	if assert.NotNil(t, h.CommitDiffs) {
+		d := h.CommitDiffs
+		assert.Equal(t, counts.Count32(4), d.MaxDirFanOut, "max directory fan-out")
+		assert.Equal(t, "dir/sub", d.MaxDirFanOutPath)
+		if assert.NotNil(t, d.MaxDirFanOutCommit) {
+			assert.Equal(t, head, d.MaxDirFanOutCommit.OID.String())
+		}
+	}
+
+	cmd := exec.Command(sizerExe(t), "--no-progress", "-v", "--diff-commits")
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	out, err = cmd.Output()
+	require.NoError(t, err, "running git-sizer")
+	assert.Regexp(t, `\* Max dir fan-out\s+\[(\d+)\]\s+\|\s+4\s+\|`, string(out))
+	assert.Contains(t, string(out), head+" (refs/heads/master) in dir/sub\n")
+}
+
+func TestMaxNewBlobSize(t *testing.T) {
+	t.Parallel()
+
+	repo := testutils.NewTestRepo(t, false, "max-new-blob-size")
+	t.Cleanup(func() { repo.Remove(t) })
+
+	timestamp := time.Unix(1112911993, 0)
+	commit := func(subject string) {
+		t.Helper()
+		cmd := repo.GitCommand(t, "commit", "-m", subject)
+		testutils.AddAuthorInfo(cmd, &timestamp)
+		require.NoError(t, cmd.Run(), "creating commit")
+	}
+	revParse := func(rev string) string {
+		t.Helper()
+		out, err := repo.GitCommand(t, "rev-parse", rev).Output()
+		require.NoError(t, err)
+		return strings.TrimSpace(string(out))
+	}
+
+	repo.AddFile(t, "big.bin", strings.Repeat("x", 3000))
+	commit("add big file")
+	big := revParse("HEAD")
+
+	require.NoError(t, repo.GitCommand(t, "rm", "-q", "big.bin").Run())
+	commit("remove big file")
+
+	// Re-adding the same contents (e.g., by reverting or
+	// cherry-picking) only counts the new blob:
+	repo.AddFile(t, "big.bin", strings.Repeat("x", 3000))
+	repo.AddFile(t, "small.txt", strings.Repeat("s", 100))
+	commit("re-add big file")
+
+	// The merge brings in a big blob relative to its first parent,
+	// but doesn't introduce it:
+	require.NoError(t, repo.GitCommand(t, "checkout", "-q", "-b", "side").Run())
+	repo.AddFile(t, "bigger.bin", strings.Repeat("y", 4000))
+	commit("add bigger file")
+	side := revParse("HEAD")
+	require.NoError(t, repo.GitCommand(t, "checkout", "-q", "master").Run())
+	repo.AddFile(t, "other.txt", "other\n")
+	commit("other")
+	cmd := repo.GitCommand(t, "merge", "-q", "--no-ff", "-m", "merge side", "side")
+	testutils.AddAuthorInfo(cmd, &timestamp)
+	require.NoError(t, cmd.Run(), "merging")
+
+	h, err := sizes.ScanRepositoryUsingGraph(
+		repo.Repository(t),
+		refGrouper{}, sizes.NameStyleFull, meter.NoProgressMeter,
+		sizes.ScanOptions{DiffCommits: true},
+	)
+	require.NoError(t, err, "scanning repository")
+
+	if assert.NotNil(t, h.CommitDiffs) {
+		d := h.CommitDiffs
+		assert.Equal(t, counts.Count64(4000), d.MaxNewBlobSize, "max new blob size")
+		if assert.NotNil(t, d.MaxNewBlobSizeCommit) {
+			assert.Equal(t, side, d.MaxNewBlobSizeCommit.OID.String())
+		}
+	}
+
+	require.NoError(t, repo.GitCommand(t, "branch", "-q", "-D", "side").Run())
+	require.NoError(t, repo.GitCommand(t, "reset", "-q", "--hard", "master~2").Run())
+
+	cmd = exec.Command(sizerExe(t), "--no-progress", "--diff-commits", "--json", "--json-version=2")
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	out, err := cmd.Output()
+	require.NoError(t, err, "running git-sizer")
+
+	var v map[string]struct {
+		Value      uint64 `json:"value"`
+		ObjectName string `json:"objectName"`
+	}
+	require.NoError(t, json.Unmarshal(out, &v))
+	assert.Equal(t, uint64(3000), v["maxNewBlobSize"].Value)
+	assert.Equal(t, big, v["maxNewBlobSize"].ObjectName)
+
+	// Without the option, the metric isn't computed:
+	cmd = exec.Command(sizerExe(t), "--no-progress", "--json", "--json-version=2")
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	out, err = cmd.Output()
+	require.NoError(t, err, "running git-sizer")
+	var keys map[string]interface{}
+	require.NoError(t, json.Unmarshal(out, &keys))
+	assert.NotContains(t, keys, "maxNewBlobSize")
+}
+
+func TestPreReceive(t *testing.T) {
+	t.Parallel()
+
+	if runtime.GOOS == "windows" {
+		t.Skip("the hook script requires a POSIX shell")
+	}
+
+	upstream := testutils.NewTestRepo(t, true, "pre-receive-upstream")
+	t.Cleanup(func() { upstream.Remove(t) })
+
+	repo := testutils.NewTestRepo(t, false, "pre-receive")
+	t.Cleanup(func() { repo.Remove(t) })
+
+	timestamp := time.Unix(1112911993, 0)
+	commit := func(subject string) {
+		t.Helper()
+		cmd := repo.GitCommand(t, "commit", "-m", subject)
+		testutils.AddAuthorInfo(cmd, &timestamp)
+		require.NoError(t, cmd.Run(), "creating commit")
+	}
+
+	repo.AddFile(t, "README", "Hello, world!\n")
+	commit("initial")
+	require.NoError(t, repo.GitCommand(t, "push", "-q", upstream.Path, "master").Run())
+
+	// Install a hook that records what git-sizer says about the next
+	// push:
+	output := filepath.Join(upstream.Path, "pre-receive.json")
+	hook := filepath.Join(upstream.Path, "hooks", "pre-receive")
+	require.NoError(t, os.MkdirAll(filepath.Dir(hook), 0o755))
+	require.NoError(t, ioutil.WriteFile(
+		hook,
+		[]byte(fmt.Sprintf("#!/bin/sh\nexec '%s' --pre-receive --json >'%s'\n", sizerExe(t), output)),
+		0o755,
+	))
+
+	// `master` gets one new commit, with a new tree and blob:
+	repo.AddFile(t, "big.bin", strings.Repeat("x", 10000))
+	commit("big")
+
+	// `topic` gets those, plus another commit, tree, and blob:
+	require.NoError(t, repo.GitCommand(t, "checkout", "-q", "-b", "topic").Run())
+	repo.AddFile(t, "small.txt", "small\n")
+	commit("small")
+
+	cmd := repo.GitCommand(t, "push", "-q", upstream.Path, "master", "topic")
+	out, err := cmd.CombinedOutput()
+	require.NoError(t, err, "pushing: %s", out)
+
+	j, err := ioutil.ReadFile(output)
+	require.NoError(t, err)
+	type objects struct {
+		ObjectCount uint64 `json:"object_count"`
+		ObjectSize  uint64 `json:"object_size"`
+	}
+	var ps struct {
+		objects
+		References []struct {
+			Refname string `json:"refname"`
+			OldOID  string `json:"old_oid"`
+			objects
+		} `json:"references"`
+	}
+	require.NoError(t, json.Unmarshal(j, &ps), "parsing %s", j)
+
+	assert.EqualValues(t, 6, ps.ObjectCount, "total object count")
+	require.Len(t, ps.References, 2)
+
+	topic, master := ps.References[0], ps.References[1]
+	assert.Equal(t, "refs/heads/topic", topic.Refname)
+	assert.Equal(t, git.NullOID.String(), topic.OldOID)
+	assert.EqualValues(t, 6, topic.ObjectCount)
+	assert.Equal(t, ps.ObjectSize, topic.ObjectSize)
+
+	assert.Equal(t, "refs/heads/master", master.Refname)
+	assert.NotEqual(t, git.NullOID.String(), master.OldOID)
+	assert.EqualValues(t, 3, master.ObjectCount)
+	assert.Greater(t, master.ObjectSize, uint64(10000))
+	assert.Less(t, master.ObjectSize, topic.ObjectSize)
+
+	// With `--max-push-size`, the hook rejects pushes that are too
+	// big, but accepts the others:
+	require.NoError(t, ioutil.WriteFile(
+		hook,
+		[]byte(fmt.Sprintf("#!/bin/sh\nexec '%s' --pre-receive --max-push-size=5k\n", sizerExe(t))),
+		0o755,
+	))
+
+	repo.AddFile(t, "big2.bin", strings.Repeat("y", 10000))
+	commit("big2")
+	cmd = repo.GitCommand(t, "push", upstream.Path, "topic")
+	out, err = cmd.CombinedOutput()
+	assert.Error(t, err, "pushing too much")
+	assert.Regexp(
+		t, `error: the push is too large: its new objects total \d+(\.\d+)? KiB, `+
+			`more than --max-push-size=5\.00 KiB`,
+		string(out),
+	)
+	assert.Contains(t, string(out), "pre-receive hook declined")
+
+	require.NoError(t, repo.GitCommand(t, "reset", "-q", "--hard", "HEAD^").Run())
+	repo.AddFile(t, "small2.txt", "small\n")
+	commit("small2")
+	cmd = repo.GitCommand(t, "push", "-q", upstream.Path, "topic")
+	out, err = cmd.CombinedOutput()
+	assert.NoError(t, err, "pushing a little: %s", out)
+
+	// The option only makes sense for a push:
+	cmd = exec.Command(sizerExe(t), "--max-push-size=5k")
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	err = cmd.Run()
+	var exitErr *exec.ExitError
+	if assert.ErrorAs(t, err, &exitErr) {
+		assert.Equal(t, 3, exitErr.ExitCode())
+	}
+}
+
+func TestExportDOT(t *testing.T) {
+	t.Parallel()
+
+	repo := testutils.NewTestRepo(t, false, "export-dot")
+	t.Cleanup(func() { repo.Remove(t) })
+
+	timestamp := time.Unix(1112911993, 0)
+	commit := func(subject string) {
+		t.Helper()
+		cmd := repo.GitCommand(t, "commit", "-m", subject)
+		testutils.AddAuthorInfo(cmd, &timestamp)
+		require.NoError(t, cmd.Run(), "creating commit")
+	}
+
+	repo.AddFile(t, "a.txt", "a\n")
+	commit("root")
+	require.NoError(t, repo.GitCommand(t, "checkout", "-q", "-b", "side").Run())
+	repo.AddFile(t, "b.txt", strings.Repeat("b", 1000))
+	commit("side")
+	require.NoError(t, repo.GitCommand(t, "checkout", "-q", "master").Run())
+	repo.AddFile(t, "c.txt", "c\n")
+	commit("main")
+	cmd := repo.GitCommand(t, "merge", "-q", "--no-ff", "-m", "merge", "side")
+	testutils.AddAuthorInfo(cmd, &timestamp)
+	require.NoError(t, cmd.Run(), "merging")
+
+	out, err := repo.GitCommand(t, "rev-parse", "master", "master^1", "master^2", "master~2").Output()
+	require.NoError(t, err)
+	oids := strings.Fields(string(out))
+	require.Len(t, oids, 4)
+	merge, main, side, root := oids[0], oids[1], oids[2], oids[3]
+
+	dotFile := filepath.Join(repo.Path, "commits.dot")
+	cmd = exec.Command(sizerExe(t), "--no-progress", "--diff-commits", "--export-dot", dotFile)
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	require.NoError(t, cmd.Run(), "running git-sizer")
+
+	contents, err := ioutil.ReadFile(dotFile)
+	require.NoError(t, err)
+	dot := string(contents)
+
+	assert.True(t, strings.HasPrefix(dot, "digraph commits {\n"), dot)
+	assert.True(t, strings.HasSuffix(dot, "}\n"), dot)
+	assert.Contains(t, dot, fmt.Sprintf("\t%q [label=\"%s\\n+2 B\"];\n", root, root[:10]))
+	assert.Contains(t, dot, fmt.Sprintf("\t%q [label=\"%s\\n+1000 B\"];\n", side, side[:10]))
+	// The merge brings in b.txt relative to its first parent, but
+	// that blob was already introduced by the side commit:
+	assert.Contains(t, dot, fmt.Sprintf("\t%q [label=\"%s\\n+0 B\"];\n", merge, merge[:10]))
+	for _, edge := range [][2]string{
+		{main, root}, {side, root}, {merge, main}, {merge, side},
+	} {
+		assert.Contains(t, dot, fmt.Sprintf("\t%q -> %q;\n", edge[0], edge[1]))
+	}
+	assert.Equal(t, 4, strings.Count(dot, " -> "))
+
+	cmd = exec.Command(sizerExe(t), "--no-progress", "--export-dot", dotFile, "--export-dot-limit=3")
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	out, err = cmd.CombinedOutput()
+	assert.Error(t, err)
+	assert.Contains(t, string(out), "too many commits to export as DOT (4; the limit is 3)")
+}
+
+func TestExportTreeDOT(t *testing.T) {
+	t.Parallel()
+
+	repo := testutils.NewTestRepo(t, false, "export-tree-dot")
+	t.Cleanup(func() { repo.Remove(t) })
+
+	timestamp := time.Unix(1112911993, 0)
+	commit := func(subject string) {
+		t.Helper()
+		cmd := repo.GitCommand(t, "commit", "-m", subject)
+		testutils.AddAuthorInfo(cmd, &timestamp)
+		require.NoError(t, cmd.Run(), "creating commit")
+	}
+
+	repo.AddFile(t, "src/lib/a.c", strings.Repeat("a", 1000))
+	repo.AddFile(t, "src/b.c", strings.Repeat("b", 100))
+	repo.AddFile(t, "docs/readme", strings.Repeat("r", 10))
+	repo.AddFile(t, "top.txt", "top\n")
+	if runtime.GOOS != "windows" {
+		repo.AddFile(t, `say "hi"\now/x`, strings.Repeat("x", 50))
+	}
+	commit("initial")
+
+	// A modified blob is counted, too, but a copy of an existing one
+	// isn't:
+	repo.AddFile(t, "src/b.c", strings.Repeat("b", 200))
+	repo.AddFile(t, "docs/copy.c", strings.Repeat("a", 1000))
+	commit("modify")
+
+	export := func(args ...string) string {
+		t.Helper()
+		dotFile := filepath.Join(repo.Path, "tree.dot")
+		cmd := exec.Command(
+			sizerExe(t),
+			append([]string{"--no-progress", "--export-tree-dot", dotFile}, args...)...,
+		)
+		cmd.Dir = repo.Path
+		cmd.Env = testutils.CleanGitEnv()
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, "running git-sizer %v: %s", args, out)
+
+		contents, err := ioutil.ReadFile(dotFile)
+		require.NoError(t, err)
+		return string(contents)
+	}
+
+	dot := export("--dot-depth=1")
+	assert.True(t, strings.HasPrefix(dot, "digraph directories {\n"), dot)
+	assert.True(t, strings.HasSuffix(dot, "}\n"), dot)
+	assert.Contains(t, dot, "\td1 [label=\"docs\\n10 B\"];\n\td0 -> d1;\n")
+	assert.Contains(t, dot, "[label=\"src\\n1.27 KiB\"];\n")
+	assert.NotContains(t, dot, "src/lib")
+	if runtime.GOOS != "windows" {
+		assert.Contains(t, dot, "\td0 [label=\".\\n1.33 KiB\"];\n")
+		assert.Contains(t, dot, `[label="say \"hi\"\\now\n50 B"];`)
+	}
+
+	dot = export("--dot-min-bytes=100")
+	assert.Contains(t, dot, "[label=\"src/lib\\n1000 B\"];\n")
+	assert.NotContains(t, dot, "docs")
+	assert.NotContains(t, dot, "say")
+
+	cmd := exec.Command(sizerExe(t), "--no-progress", "--dot-depth=2")
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	out, err := cmd.CombinedOutput()
+	assert.Error(t, err)
+	assert.Contains(t, string(out), "--dot-depth and --dot-min-bytes require --export-tree-dot")
+}
+
+func TestExportSQLite(t *testing.T) {
+	t.Parallel()
+
+	if _, err := exec.LookPath("sqlite3"); err != nil {
+		t.Skip("the 'sqlite3' command is not available")
+	}
+
+	repo := testutils.NewTestRepo(t, false, "export-sqlite")
+	t.Cleanup(func() { repo.Remove(t) })
+
+	timestamp := time.Unix(1112911993, 0)
+	commit := func(subject string) {
+		t.Helper()
+		cmd := repo.GitCommand(t, "commit", "-m", subject)
+		testutils.AddAuthorInfo(cmd, &timestamp)
+		require.NoError(t, cmd.Run(), "creating commit")
+	}
+
+	repo.AddFile(t, "a.txt", "a\n")
+	commit("root")
+	repo.AddFile(t, "dir/it's.txt", strings.Repeat("b", 1000))
+	commit("second")
+
+	dbFile := filepath.Join(repo.Path, "inventory.db")
+	query := func(sql string) string {
+		t.Helper()
+		out, err := exec.Command("sqlite3", dbFile, sql).Output()
+		require.NoError(t, err, "querying %q", sql)
+		return strings.TrimSpace(string(out))
+	}
+
+	cmd := exec.Command(sizerExe(t), "--no-progress", "--export-sqlite", dbFile)
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	require.NoError(t, cmd.Run(), "running git-sizer")
+
+	assert.Equal(
+		t,
+		"blob|2|1002\ncommit|2|\ntree|3|",
+		query("SELECT type, COUNT(*), CASE type WHEN 'blob' THEN SUM(size) END FROM objects GROUP BY type ORDER BY type"),
+	)
+	out, err := repo.GitCommand(t, "rev-parse", "master", "master~", "master^{tree}").Output()
+	require.NoError(t, err)
+	oids := strings.Fields(string(out))
+	assert.Equal(
+		t,
+		fmt.Sprintf("%s|1112912053|1|%s", oids[0], oids[2]),
+		query("SELECT oid, author_date, parent_count, tree FROM commits WHERE parent_count = 1"),
+	)
+	assert.Equal(t, "refs/heads/master|"+oids[0], query("SELECT name, oid FROM refs"))
+	assert.Equal(t, "0", query("SELECT COUNT(*) FROM sqlite_master WHERE name = 'tree_entries'"))
+	assert.Contains(t, query("SELECT name FROM sqlite_master WHERE type = 'index'"), "objects_oid")
+
+	// Exporting again replaces the tables:
+	cmd = exec.Command(sizerExe(t), "--no-progress", "--export-sqlite", dbFile, "--sqlite-tree-entries")
+	cmd.Dir = repo.Path
+	cmd.Env = testutils.CleanGitEnv()
+	require.NoError(t, cmd.Run(), "running git-sizer")
+
+	assert.Equal(t, "7", query("SELECT COUNT(*) FROM objects"))
+	assert.Equal(
+		t,
+		"it's.txt|33188",
+		query("SELECT e.name, e.mode FROM tree_entries e JOIN objects o ON o.oid = e.entry_oid WHERE o.size = 1000"),
+	)
+}
+
+func TestLive(t *testing.T) {
+	t.Parallel()
+
+	repo := testutils.NewTestRepo(t, false, "live")
+	t.Cleanup(func() { repo.Remove(t) })
+
+	newGitBomb(t, repo, 10, 10, "boom!\n")
+
+	t.Run("snapshots", func(t *testing.T) {
+		var snapshots []sizes.HistorySize
+		h, err := sizes.ScanRepositoryUsingGraph(
+			repo.Repository(t),
+			refGrouper{}, sizes.NameStyleFull, meter.NoProgressMeter,
+			sizes.ScanOptions{
+				Snapshot: func(hs sizes.HistorySize) {
+					// Only the values are kept, not the paths:
+					snapshots = append(snapshots, sizes.HistorySize{
+						UniqueBlobCount: hs.UniqueBlobCount,
+						UniqueTreeCount: hs.UniqueTreeCount,
+					})
+				},
+				SnapshotInterval: time.Nanosecond,
+				TopTrees:         3,
+				TopBlobs:         3,
+				Histograms:       true,
+			},
+		)
+		require.NoError(t, err)
+
+		require.NotEmpty(t, snapshots)
+		for _, s := range snapshots {
+			assert.LessOrEqual(t, s.UniqueBlobCount, h.UniqueBlobCount)
+			assert.LessOrEqual(t, s.UniqueTreeCount, h.UniqueTreeCount)
+		}
+	})
+
+	t.Run("not-a-terminal", func(t *testing.T) {
+		run := func(args ...string) string {
+			cmd := exec.Command(sizerExe(t), append([]string{"--no-progress", "-v"}, args...)...)
+			cmd.Dir = repo.Path
+			cmd.Env = testutils.CleanGitEnv()
+			out, err := cmd.Output()
+			require.NoError(t, err, "running git-sizer %v", args)
+			return string(out)
+		}
+
+		// When stdout isn't a terminal, `--live` has no effect:
+		assert.Equal(t, run(), run("--live"))
+	})
+
+	t.Run("json", func(t *testing.T) {
+		cmd := exec.Command(sizerExe(t), "--no-progress", "--live", "--json")
+		cmd.Dir = repo.Path
+		cmd.Env = testutils.CleanGitEnv()
+		out, err := cmd.CombinedOutput()
+		assert.Error(t, err)
+		assert.Contains(t, string(out), "--live can't be combined with --json")
+	})
+}
+
+func TestLimitMemory(t *testing.T) {
+	t.Parallel()
+
+	repo := testutils.NewTestRepo(t, false, "limit-memory")
+	t.Cleanup(func() { repo.Remove(t) })
+
+	// Enough blobs, of assorted sizes, to be spilled to disk in more
+	// runs than are kept before they are merged:
+	for i := 0; i < 1200; i++ {
+		require.NoError(t, os.WriteFile(
+			filepath.Join(repo.Path, fmt.Sprintf("file-%04d.txt", i)),
+			[]byte(strings.Repeat(fmt.Sprintf("%d\n", i), i%17+1)),
+			0o644,
+		))
+	}
+	cmd := repo.GitCommand(t, "add", ".")
+	require.NoError(t, cmd.Run(), "adding files")
+	cmd = repo.GitCommand(t, "commit", "-m", "many files")
+	timestamp := time.Unix(1112911993, 0)
+	testutils.AddAuthorInfo(cmd, &timestamp)
+	require.NoError(t, cmd.Run(), "committing")
+
+	scan := func(repo *testutils.TestRepo, limit uint64) sizes.HistorySize {
+		h, err := sizes.ScanRepositoryUsingGraph(
+			repo.Repository(t),
+			refGrouper{}, sizes.NameStyleFull, meter.NoProgressMeter,
+			sizes.ScanOptions{MemoryLimit: limit, TopBlobs: 3, DiffCommits: true},
+		)
+		require.NoError(t, err, "scanning repository")
+		return h
+	}
+
+	inMemory := scan(repo, 0)
+	assert.Equal(t, counts.Count32(1200), inMemory.UniqueBlobCount)
+	assert.Equal(t, 0, inMemory.SpilledRuns)
+
+	spilled := scan(repo, 1)
+	assert.Greater(t, spilled.SpilledRuns, 8, "runs spilled")
+	spilled.SpilledRuns = 0
+	assert.Equal(t, inMemory, spilled)
+
+	assert.Equal(t, inMemory, scan(repo, 1<<30))
+
+	run := func(repo *testutils.TestRepo, args ...string) string {
+		cmd := exec.Command(sizerExe(t), append([]string{"--no-progress", "-v"}, args...)...)
+		cmd.Dir = repo.Path
+		cmd.Env = testutils.CleanGitEnv()
+		out, err := cmd.Output()
+		require.NoError(t, err, "running git-sizer %v", args)
+		return string(out)
+	}
+	assert.Equal(t, run(repo), run(repo, "--limit-memory=1k"))
+
+	// A long history with a single blob, in which only the trees,
+	// the commits, and their trees can be spilled:
+	long := testutils.NewTestRepo(t, false, "limit-memory-long")
+	t.Cleanup(func() { long.Remove(t) })
+
+	var stream strings.Builder
+	for i := 0; i < 400; i++ {
+		fmt.Fprintf(
+			&stream,
+			"commit refs/heads/master\n"+
+				"committer A U Thor <author@example.com> %d +0000\n"+
+				"data <<EOF\ncommit %d\nEOF\n"+
+				"M 644 inline dir-%d/file.txt\n"+
+				"data <<EOF\nsame\nEOF\n\n",
+			1112911993+i, i, i,
+		)
+	}
+	cmd = long.GitCommand(t, "fast-import", "--quiet")
+	cmd.Stdin = strings.NewReader(stream.String())
+	require.NoError(t, cmd.Run(), "importing history")
+
+	inMemory = scan(long, 0)
+	assert.Equal(t, counts.Count32(1), inMemory.UniqueBlobCount)
+	assert.Equal(t, counts.Count32(400), inMemory.UniqueCommitCount)
+	assert.Equal(t, 0, inMemory.SpilledRuns)
+
+	spilled = scan(long, 1)
+	assert.Greater(t, spilled.SpilledRuns, 8, "runs spilled")
+	spilled.SpilledRuns = 0
+	assert.Equal(t, inMemory, spilled)
+
+	assert.Equal(t, run(long), run(long, "--limit-memory=1k"))
+}
+
+func TestExitCodes(t *testing.T) {
+	t.Parallel()
+
+	repo := testutils.NewTestRepo(t, false, "exit-codes")
+	t.Cleanup(func() { repo.Remove(t) })
+
+	timestamp := time.Unix(1112911993, 0)
+	repo.AddFile(t, "present.txt", "present\n")
+	repo.AddFile(t, "missing.txt", "missing\n")
+	cmd := repo.GitCommand(t, "commit", "-m", "initial")
+	testutils.AddAuthorInfo(cmd, &timestamp)
+	require.NoError(t, cmd.Run(), "creating commit")
+
+	// A clone in which one of the blobs is missing:
+	corrupt := repo.Clone(t, "exit-codes-corrupt")
+	t.Cleanup(func() { corrupt.Remove(t) })
+	out, err := corrupt.GitCommand(t, "rev-parse", "HEAD:missing.txt").Output()
+	require.NoError(t, err)
+	missingOID := strings.TrimSpace(string(out))
+	require.NoError(
+		t,
+		os.Remove(filepath.Join(corrupt.Path, "objects", missingOID[:2], missingOID[2:])),
+	)
+
+	notRepo := t.TempDir()
+
+	for _, p := range []struct {
+		name     string
+		dir      string
+		args     []string
+		expected int
+	}{
+		{"success", repo.Path, nil, 0},
+		{"below-fail-on", repo.Path, []string{"--fail-on=30"}, 0},
+		{"not-a-repository", notRepo, nil, 1},
+		{"fail-on", repo.Path, []string{"--fail-on=0"}, 2},
+		{"unknown-option", repo.Path, []string{"--no-such-option"}, 3},
+		{"invalid-option", repo.Path, []string{"--top=-1"}, 3},
+		{"conflicting-options", repo.Path, []string{"--live", "--json"}, 3},
+		{"timeout", repo.Path, []string{"--timeout=1ns"}, 4},
+		{"why-timeout", repo.Path, []string{"--timeout=1ns", "--why=" + missingOID}, 4},
+		{"corruption", corrupt.Path, nil, 5},
+		{"corruption-and-fail-on", corrupt.Path, []string{"--fail-on=0"}, 5},
+		{"strict-corruption", corrupt.Path, []string{"--strict"}, 1},
+		// There is no commit-graph, which the doctor warns about:
+		{"doctor-warning", repo.Path, []string{"--doctor"}, 6},
+	} {
+		p := p
+		t.Run(p.name, func(t *testing.T) {
+			t.Parallel()
+
+			cmd := exec.Command(sizerExe(t), append([]string{"--no-progress"}, p.args...)...)
+			cmd.Dir = p.dir
+			cmd.Env = append(
+				testutils.CleanGitEnv(), "GIT_CEILING_DIRECTORIES="+filepath.Dir(notRepo),
+			)
+			out, err := cmd.CombinedOutput()
+			if p.expected == 0 {
+				assert.NoError(t, err, string(out))
+				return
+			}
+			var exitErr *exec.ExitError
+			if assert.ErrorAs(t, err, &exitErr, string(out)) {
+				assert.Equal(t, p.expected, exitErr.ExitCode(), string(out))
+			}
+		})
+	}
+
+	cmd = exec.Command(sizerExe(t), "--help-exit-codes")
+	cmd.Env = testutils.CleanGitEnv()
+	out, err = cmd.Output()
+	require.NoError(t, err)
+	for code := 0; code <= 6; code++ {
+		assert.Regexp(t, fmt.Sprintf(`(?m)^    %d  \S`, code), string(out))
+	}
+}
+
+// TestGitSizerOpts checks that options can be supplied via
+// `GIT_SIZER_OPTS`, and that the command line overrides them.
+func TestGitSizerOpts(t *testing.T) {
+	t.Parallel()
+
+	repo := testutils.NewTestRepo(t, false, "git-sizer-opts")
+	t.Cleanup(func() { repo.Remove(t) })
+
+	timestamp := time.Unix(1112911993, 0)
+	repo.AddFile(t, "file.txt", "contents\n")
+	cmd := repo.GitCommand(t, "commit", "-m", "initial")
+	testutils.AddAuthorInfo(cmd, &timestamp)
+	require.NoError(t, cmd.Run(), "creating commit")
+
+	run := func(opts string, args ...string) (string, string, error) {
+		t.Helper()
+		cmd := exec.Command(sizerExe(t), args...)
+		cmd.Dir = repo.Path
+		cmd.Env = append(testutils.CleanGitEnv(), "GIT_SIZER_OPTS="+opts)
+		var stdout, stderr bytes.Buffer
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+		err := cmd.Run()
+		return stdout.String(), stderr.String(), err
+	}
+
+	// The command line overrides the environment, without a warning:
+	stdout, stderr, err := run(`--no-progress --json --json-version=1`, "--json-version=2")
+	require.NoError(t, err, stderr)
+	assert.Equal(t, "", stderr)
+	var output map[string]map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(stdout), &output))
+	assert.Equal(t, 1.0, output["uniqueCommitCount"]["value"])
+
+	// Quoted words are kept together, and the options are reported
+	// with `--verbose`:
+	stdout, stderr, err = run(`--no-progress -v "--names=none" --exclude='refs/tags/a b'`)
+	require.NoError(t, err, stderr)
+	assert.Equal(
+		t,
+		"note: using options from GIT_SIZER_OPTS: --no-progress -v --names=none '--exclude=refs/tags/a b'\n",
+		stderr,
+	)
+	assert.NotContains(t, stdout, "[1]")
+
+	for _, p := range []struct {
+		opts   string
+		stderr string
+	}{
+		{`--json 'oops`, "error: invalid GIT_SIZER_OPTS: unterminated single quote\n"},
+		{`--json "oops`, "error: invalid GIT_SIZER_OPTS: unterminated double quote\n"},
+		{`--json oops\`, "error: invalid GIT_SIZER_OPTS: trailing backslash\n"},
+		{`--threshold`, "error: in GIT_SIZER_OPTS: flag needs an argument: --threshold\n"},
+		{`oops`, "error: in GIT_SIZER_OPTS: unexpected argument \"oops\"\n"},
+	} {
+		_, stderr, err := run(p.opts, "--no-progress")
+		var exitErr *exec.ExitError
+		if assert.ErrorAs(t, err, &exitErr, p.opts) {
+			assert.Equal(t, 3, exitErr.ExitCode(), p.opts)
+		}
+		assert.Equal(t, p.stderr, stderr, p.opts)
+	}
+}
+
+func TestJSONV2KeysAreCamelCase(t *testing.T) {
+	t.Parallel()
+
+	repo := testutils.NewTestRepo(t, false, "json-v2-keys")
+	t.Cleanup(func() { repo.Remove(t) })
+
+	timestamp := time.Unix(1112911993, 0)
+	runGit := func(args ...string) {
+		t.Helper()
+		cmd := repo.GitCommand(t, args...)
+		testutils.AddAuthorInfo(cmd, &timestamp)
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, "running git %v: %s", args, out)
+	}
+
+	// None of the names in the repository contain underscores or
+	// capital letters, so that any that show up as keys are the
+	// names of fields:
+	repo.AddFile(t, ".gitattributes", "*.bin filter=lfs\nignored.txt export-ignore\n")
+	repo.AddFile(t, "a.txt", "a\n")
+	repo.AddFile(t, "ignored.txt", "ignored\n")
+	repo.AddFile(t, "dir/big.bin", strings.Repeat("x", 10000))
+	runGit("commit", "-m", "initial")
+	runGit("mv", "a.txt", "b.txt")
+	runGit("commit", "-m", "rename")
+	runGit("checkout", "-q", "-b", "side")
+	repo.AddFile(t, "side.txt", "side\n")
+	runGit("commit", "-m", "side")
+	runGit("checkout", "-q", "master")
+	runGit("merge", "-q", "--no-ff", "-m", "merge", "side")
+	runGit("tag", "-a", "-m", "tag", "v1")
+	runGit("notes", "add", "-m", "note", "HEAD")
+	runGit("update-ref", "refs/remotes/origin/master", "HEAD^")
+	runGit("update-ref", "refs/namespaces/ns/refs/heads/master", "HEAD")
+
+	corrupt := repo.Clone(t, "json-v2-keys-corrupt")
+	t.Cleanup(func() { corrupt.Remove(t) })
+	out, err := corrupt.GitCommand(t, "rev-parse", "HEAD:b.txt").Output()
+	require.NoError(t, err)
+	missingOID := strings.TrimSpace(string(out))
+	require.NoError(
+		t,
+		os.Remove(filepath.Join(corrupt.Path, "objects", missingOID[:2], missingOID[2:])),
+	)
+
+	repo.AddFile(t, "dir/b.txt", "duplicate name\n")
+	runGit("commit", "-m", "duplicate")
+	runGit("repack", "-adq")
+	runGit("multi-pack-index", "write")
+
+	cacheDir := t.TempDir()
+	checkKeys := func(dir string, args ...string) {
+		t.Helper()
+		cmd := exec.Command(
+			sizerExe(t),
+			append([]string{"--no-progress", "--json", "--json-version=2"}, args...)...,
+		)
+		cmd.Dir = dir
+		cmd.Env = append(testutils.CleanGitEnv(), "XDG_CACHE_HOME="+cacheDir)
+		// The exit status may be nonzero because of the corruption or
+		// the limits, but the output must be complete all the same:
+		out, _ := cmd.Output()
+
+		var v interface{}
+		require.NoError(t, json.Unmarshal(out, &v), "parsing the output of %v", args)
+		var walk func(path string, v interface{})
+		walk = func(path string, v interface{}) {
+			switch v := v.(type) {
+			case map[string]interface{}:
+				for key, value := range v {
+					assert.Regexp(
+						t, `^[^A-Z_][^_]*$`, key,
+						"key %s.%s in the output of %v", path, key, args,
+					)
+					walk(path+"."+key, value)
+				}
+			case []interface{}:
+				for i, value := range v {
+					walk(fmt.Sprintf("%s[%d]", path, i), value)
+				}
+			}
+		}
+		walk("", v)
+	}
+
+	checkKeys(
+		repo.Path,
+		"-v", "--names=full", "--attributes", "--archive-size", "--blame-top-blob",
+		"--renames", "--include-gitattributes-lfs-size", "--by-remote",
+		"--by-namespace", "--compare-repo="+corrupt.Path, "--tag-only",
+		"--notes-only", "--ref-sharing", "--check-submodules", "--diff-commits",
+		"--persistence-weighted", "--committer-domains", "--histograms",
+		"--pack-stats", "--top-trees=2", "--top=2", "--classify-attr=filter",
+		"--classify", "--duplicate-names=1", "--blob-size-limit=1k",
+		"--big-file-threshold=1k", "--track",
+	)
+	checkKeys(repo.Path, "--track", "--top=2", "--top-by=refcount")
+	checkKeys(repo.Path, "--first-parent", "--path=dir", "--introduced-since=2000-01-01")
+	checkKeys(repo.Path, "--sample-rate=0.5")
+	checkKeys(repo.Path, "--max-commits=2")
+	checkKeys(corrupt.Path)
+}
@@ -0,0 +1,164 @@
+// Package diag reports git-sizer's operational events (phase
+// transitions, warnings, and errors) as structured log records, for
+// consumption by automation.
+package diag
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/github/git-sizer/meter"
+)
+
+// Level is the severity of a log record.
+type Level string
+
+const (
+	LevelInfo    Level = "info"
+	LevelWarning Level = "warning"
+	LevelError   Level = "error"
+)
+
+// Fields holds additional structured data about a log record.
+type Fields map[string]interface{}
+
+// record is the JSON form of a log record.
+type record struct {
+	Time    string `json:"time"`
+	Level   Level  `json:"level"`
+	Message string `json:"message"`
+	Fields  Fields `json:"fields,omitempty"`
+}
+
+// Logger writes log records to an `io.Writer`, one JSON object per
+// line. A nil `*Logger` discards everything logged to it, so callers
+// don't need to check whether logging is enabled.
+type Logger struct {
+	lock sync.Mutex
+	w    io.Writer
+
+	// now returns the current time; it can be overridden in tests.
+	now func() time.Time
+}
+
+// NewJSONLogger returns a `Logger` that writes JSON records to `w`.
+func NewJSONLogger(w io.Writer) *Logger {
+	return &Logger{
+		w:   w,
+		now: time.Now,
+	}
+}
+
+// Log writes a record with the specified level, message, and fields.
+// Errors writing the record are ignored, because there's nowhere
+// better to report them.
+func (l *Logger) Log(level Level, message string, fields Fields) {
+	if l == nil {
+		return
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	j, err := json.Marshal(
+		record{
+			Time:    l.now().UTC().Format(time.RFC3339Nano),
+			Level:   level,
+			Message: message,
+			Fields:  fields,
+		},
+	)
+	if err != nil {
+		// The fields couldn't be marshaled. Log what we can:
+		j, _ = json.Marshal(
+			record{
+				Time:    l.now().UTC().Format(time.RFC3339Nano),
+				Level:   level,
+				Message: message,
+				Fields:  Fields{"fieldsError": err.Error()},
+			},
+		)
+	}
+	_, _ = fmt.Fprintf(l.w, "%s\n", j)
+}
+
+// Info logs an informational record.
+func (l *Logger) Info(message string, fields Fields) {
+	l.Log(LevelInfo, message, fields)
+}
+
+// Warn logs a warning.
+func (l *Logger) Warn(message string, fields Fields) {
+	l.Log(LevelWarning, message, fields)
+}
+
+// Error logs an error.
+func (l *Logger) Error(message string, fields Fields) {
+	l.Log(LevelError, message, fields)
+}
+
+// Progress returns a `meter.Progress` that, rather than showing a
+// running count, logs a record when each phase starts and another,
+// including the final count and the elapsed time, when it is done.
+func (l *Logger) Progress() meter.Progress {
+	if l == nil {
+		return meter.NoProgressMeter
+	}
+	return &logProgress{l: l}
+}
+
+type logProgress struct {
+	l     *Logger
+	phase string
+	start time.Time
+
+	// `count` is updated atomically:
+	count int64
+}
+
+// phaseName extracts the name of a phase from a progress format
+// string like "Processing blobs: %d".
+func phaseName(format string) string {
+	name := strings.TrimSpace(strings.ReplaceAll(format, "%d", ""))
+	return strings.TrimSuffix(name, ":")
+}
+
+func (p *logProgress) Start(format string) {
+	p.phase = phaseName(format)
+	p.start = p.l.now()
+	atomic.StoreInt64(&p.count, 0)
+	p.l.Info("phase started", Fields{"phase": p.phase})
+}
+
+func (p *logProgress) Inc() {
+	atomic.AddInt64(&p.count, 1)
+}
+
+func (p *logProgress) Add(delta int64) {
+	atomic.AddInt64(&p.count, delta)
+}
+
+func (p *logProgress) Done() {
+	p.l.Info("phase finished", p.finishedFields())
+}
+
+func (p *logProgress) DoneWithSummary(summary string) {
+	fields := p.finishedFields()
+	fields["summary"] = summary
+	p.l.Info("phase finished", fields)
+}
+
+// finishedFields returns the fields that are logged when the current
+// phase is done.
+func (p *logProgress) finishedFields() Fields {
+	return Fields{
+		"phase":     p.phase,
+		"count":     atomic.LoadInt64(&p.count),
+		"elapsedMs": p.l.now().Sub(p.start).Milliseconds(),
+	}
+}
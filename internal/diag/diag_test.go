@@ -0,0 +1,85 @@
+package diag
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogger(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	l := NewJSONLogger(&buf)
+	now := time.Date(2021, 6, 1, 12, 0, 1, 0, time.UTC)
+	l.now = func() time.Time { return now }
+
+	l.Warn("something odd", Fields{"count": 3})
+	l.Error("it broke", nil)
+
+	p := l.Progress()
+	p.Start("Processing blobs: %d")
+	p.Inc()
+	p.Add(2)
+	now = now.Add(time.Second)
+	p.Done()
+
+	p.Start("Enumerating references: %d")
+	p.Inc()
+	p.DoneWithSummary("Enumerating references: 1 of 1 included")
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	require.Len(t, lines, 6)
+
+	var records []map[string]interface{}
+	for _, line := range lines {
+		var r map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(line), &r), line)
+		records = append(records, r)
+	}
+
+	assert.Equal(t, "2021-06-01T12:00:01Z", records[0]["time"])
+	assert.Equal(t, "warning", records[0]["level"])
+	assert.Equal(t, "something odd", records[0]["message"])
+	assert.Equal(t, map[string]interface{}{"count": 3.0}, records[0]["fields"])
+
+	assert.Equal(t, "error", records[1]["level"])
+	assert.NotContains(t, records[1], "fields")
+
+	assert.Equal(t, "phase started", records[2]["message"])
+	assert.Equal(t, map[string]interface{}{"phase": "Processing blobs"}, records[2]["fields"])
+
+	assert.Equal(t, "phase finished", records[3]["message"])
+	assert.Equal(
+		t,
+		map[string]interface{}{"phase": "Processing blobs", "count": 3.0, "elapsedMs": 1000.0},
+		records[3]["fields"],
+	)
+
+	assert.Equal(t, "phase started", records[4]["message"])
+	assert.Equal(
+		t,
+		map[string]interface{}{
+			"phase":     "Enumerating references",
+			"count":     1.0,
+			"elapsedMs": 0.0,
+			"summary":   "Enumerating references: 1 of 1 included",
+		},
+		records[5]["fields"],
+	)
+}
+
+func TestNilLogger(t *testing.T) {
+	t.Parallel()
+
+	var l *Logger
+	l.Info("ignored", nil)
+	p := l.Progress()
+	p.Start("Processing blobs: %d")
+	p.Done()
+}
@@ -30,11 +30,15 @@ func (v *filterGroupValue) Set(symbolString string) error {
 	refGroup, ok := v.rgb.groups[symbol]
 
 	if !ok || symbol == "" {
-		return fmt.Errorf("refgroup '%s' is not defined", symbol)
+		v.rgb.addFilterError(
+			"--refgroup", symbolString, fmt.Errorf("refgroup '%s' is not defined", symbol),
+		)
+		return nil
 	}
 
-	v.rgb.topLevelGroup.filter = git.Include.Combine(
-		v.rgb.topLevelGroup.filter, refGroupFilter{refGroup},
+	v.rgb.addFilterRule(
+		"--include=@"+symbolString, "--refgroup="+symbolString,
+		git.Include, refGroupFilter{refGroup},
 	)
 
 	return nil
@@ -28,6 +28,9 @@ type filterValue struct {
 	// regexp specifies whether `pattern` should be interpreted as
 	// a regexp (as opposed to handling it flexibly).
 	regexp bool
+
+	// name is the name of the option (e.g., "no-tags").
+	name string
 }
 
 func (v *filterValue) Set(s string) error {
@@ -53,21 +56,45 @@ func (v *filterValue) Set(s string) error {
 		pattern = s
 	}
 
-	if v.regexp {
+	option := "--include"
+	if combiner == git.Exclude {
+		option = "--exclude"
+	}
+
+	switch {
+	case v.regexp && v.pattern != "":
+		// Built-in patterns always have to match the whole
+		// reference name:
 		var err error
 		filter, err = git.RegexpFilter(pattern)
 		if err != nil {
 			return fmt.Errorf("invalid regexp: %q", s)
 		}
-	} else {
+	case v.regexp:
+		var err error
+		filter, err = v.rgb.regexpFilter(pattern)
+		if err != nil {
+			v.rgb.addFilterError(option, s, fmt.Errorf("invalid regexp: %q", s))
+			return nil
+		}
+	default:
 		var err error
 		filter, err = v.interpretFlexibly(pattern)
 		if err != nil {
-			return err
+			v.rgb.addFilterError(option, s, err)
+			return nil
 		}
 	}
 
-	v.rgb.topLevelGroup.filter = combiner.Combine(v.rgb.topLevelGroup.filter, filter)
+	given := "--" + v.name + "=" + s
+	if v.pattern != "" && s == "true" {
+		given = "--" + v.name
+	}
+
+	if v.regexp {
+		pattern = "/" + pattern + "/"
+	}
+	v.rgb.addFilterRule(option+"="+pattern, given, combiner, filter)
 
 	return nil
 }
@@ -84,7 +111,7 @@ func (v *filterValue) Set(s string) error {
 func (v *filterValue) interpretFlexibly(s string) (git.ReferenceFilter, error) {
 	if len(s) >= 2 && strings.HasPrefix(s, "/") && strings.HasSuffix(s, "/") {
 		pattern := s[1 : len(s)-1]
-		return git.RegexpFilter(pattern)
+		return v.rgb.regexpFilter(pattern)
 	}
 
 	if len(s) >= 1 && s[0] == '@' {
@@ -76,8 +76,9 @@ func (rg *refGroup) collectSymbols(refname string) (bool, []sizes.RefGroupSymbol
 
 // augmentFromConfig augments `rg` based on configuration in the
 // gitconfig and returns the result. It is not considered an error if
-// there are no usable config entries for the filter.
-func (rg *refGroup) augmentFromConfig(configger Configger) error {
+// there are no usable config entries for the filter. Regexps are
+// interpreted according to the options of `rgb`.
+func (rg *refGroup) augmentFromConfig(rgb *RefGroupBuilder, configger Configger) error {
 	config, err := configger.GetConfig(fmt.Sprintf("refgroup.%s", rg.Symbol))
 	if err != nil {
 		return err
@@ -92,7 +93,7 @@ func (rg *refGroup) augmentFromConfig(configger Configger) error {
 				rg.filter, git.PrefixFilter(entry.Value),
 			)
 		case "includeregexp":
-			f, err := git.RegexpFilter(entry.Value)
+			f, err := rgb.regexpFilter(entry.Value)
 			if err != nil {
 				return fmt.Errorf(
 					"invalid regular expression for '%s': %w",
@@ -105,7 +106,7 @@ func (rg *refGroup) augmentFromConfig(configger Configger) error {
 				rg.filter, git.PrefixFilter(entry.Value),
 			)
 		case "excluderegexp":
-			f, err := git.RegexpFilter(entry.Value)
+			f, err := rgb.regexpFilter(entry.Value)
 			if err != nil {
 				return fmt.Errorf(
 					"invalid regular expression for '%s': %w",
@@ -20,6 +20,26 @@ type Configger interface {
 type RefGroupBuilder struct {
 	topLevelGroup *refGroup
 	groups        map[sizes.RefGroupSymbol]*refGroup
+
+	// regexpPartialMatch is set if user-supplied regexps only have
+	// to match part of a reference name (`--regexp-partial-match`).
+	regexpPartialMatch bool
+
+	// filterRules records the reference-selection options that have
+	// been applied to the top-level filter, in order (see
+	// `FilterOptions()` and `Explain()`).
+	filterRules []filterRule
+
+	// filterErrors records the reference-selection options whose
+	// patterns couldn't be compiled, which were skipped. Whether
+	// they are errors or only warnings is decided by
+	// `CheckFilters()`, because `--lenient-filters` might appear on
+	// the command line after them.
+	filterErrors []error
+
+	// lenientFilters is set if patterns that can't be compiled
+	// should be skipped with a warning (`--lenient-filters`).
+	lenientFilters bool
 }
 
 // NewRefGroupBuilder creates and returns a `RefGroupBuilder`
@@ -137,7 +157,7 @@ func (rgb *RefGroupBuilder) readRefgroupsFromGitconfig(configger Configger) erro
 		}
 
 		rg := rgb.getGroup(symbol)
-		if err := rg.augmentFromConfig(configger); err != nil {
+		if err := rg.augmentFromConfig(rgb, configger); err != nil {
 			return err
 		}
 
@@ -147,6 +167,40 @@ func (rgb *RefGroupBuilder) readRefgroupsFromGitconfig(configger Configger) erro
 	return nil
 }
 
+// regexpFilter returns a filter for the user-supplied regexp
+// `pattern`. Whether the pattern has to match the whole reference
+// name is only decided when the filter is used, because
+// `--regexp-partial-match` might appear on the command line after
+// the pattern (or the pattern might come from gitconfig, which is
+// read before the options are parsed).
+func (rgb *RefGroupBuilder) regexpFilter(pattern string) (git.ReferenceFilter, error) {
+	full, err := git.RegexpFilter(pattern)
+	if err != nil {
+		return nil, err
+	}
+	partial, err := git.PartialRegexpFilter(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return regexpFilter{rgb, full, partial}, nil
+}
+
+// regexpFilter is a `git.ReferenceFilter` that matches a regexp
+// either against the whole reference name or against any part of
+// it, depending on `rgb.regexpPartialMatch`.
+type regexpFilter struct {
+	rgb     *RefGroupBuilder
+	full    git.ReferenceFilter
+	partial git.ReferenceFilter
+}
+
+func (f regexpFilter) Filter(refname string) bool {
+	if f.rgb.regexpPartialMatch {
+		return f.partial.Filter(refname)
+	}
+	return f.full.Filter(refname)
+}
+
 // splitKey splits `key`, which is part of a gitconfig key, into the
 // refgroup symbol to which it applies and the field name within that
 // section.
@@ -161,89 +215,99 @@ func splitKey(key string) (sizes.RefGroupSymbol, string) {
 // AddRefopts adds the reference-related options to `flags`.
 func (rgb *RefGroupBuilder) AddRefopts(flags *pflag.FlagSet) {
 	flags.Var(
-		&filterValue{rgb, git.Include, "", false}, "include",
+		&filterValue{rgb, git.Include, "", false, "include"}, "include",
 		"include specified references",
 	)
 
 	flag := flags.VarPF(
-		&filterValue{rgb, git.Include, "", true}, "include-regexp", "",
+		&filterValue{rgb, git.Include, "", true, "include-regexp"}, "include-regexp", "",
 		"include references matching the specified regular expression",
 	)
 	flag.Hidden = true
 	flag.Deprecated = "use --include=/REGEXP/"
 
 	flags.Var(
-		&filterValue{rgb, git.Exclude, "", false}, "exclude",
+		&filterValue{rgb, git.Exclude, "", false, "exclude"}, "exclude",
 		"exclude specified references",
 	)
 
 	flag = flags.VarPF(
-		&filterValue{rgb, git.Exclude, "", true}, "exclude-regexp", "",
+		&filterValue{rgb, git.Exclude, "", true, "exclude-regexp"}, "exclude-regexp", "",
 		"exclude references matching the specified regular expression",
 	)
 	flag.Hidden = true
 	flag.Deprecated = "use --exclude=/REGEXP/"
 
 	flag = flags.VarPF(
-		&filterValue{rgb, git.Include, "refs/heads", false}, "branches", "",
+		&filterValue{rgb, git.Include, "refs/heads", false, "branches"}, "branches", "",
 		"process all branches",
 	)
 	flag.NoOptDefVal = "true"
 
 	flag = flags.VarPF(
-		&filterValue{rgb, git.Exclude, "refs/heads", false}, "no-branches", "",
+		&filterValue{rgb, git.Exclude, "refs/heads", false, "no-branches"}, "no-branches", "",
 		"exclude all branches",
 	)
 	flag.NoOptDefVal = "true"
 
 	flag = flags.VarPF(
-		&filterValue{rgb, git.Include, "refs/tags", false}, "tags", "",
+		&filterValue{rgb, git.Include, "refs/tags", false, "tags"}, "tags", "",
 		"process all tags",
 	)
 	flag.NoOptDefVal = "true"
 
 	flag = flags.VarPF(
-		&filterValue{rgb, git.Exclude, "refs/tags", false}, "no-tags", "",
+		&filterValue{rgb, git.Exclude, "refs/tags", false, "no-tags"}, "no-tags", "",
 		"exclude all tags",
 	)
 	flag.NoOptDefVal = "true"
 
 	flag = flags.VarPF(
-		&filterValue{rgb, git.Include, "refs/remotes", false}, "remotes", "",
+		&filterValue{rgb, git.Include, "refs/remotes", false, "remotes"}, "remotes", "",
 		"process all remote-tracking references",
 	)
 	flag.NoOptDefVal = "true"
 
 	flag = flags.VarPF(
-		&filterValue{rgb, git.Exclude, "refs/remotes", false}, "no-remotes", "",
+		&filterValue{rgb, git.Exclude, "refs/remotes", false, "no-remotes"}, "no-remotes", "",
 		"exclude all remote-tracking references",
 	)
 	flag.NoOptDefVal = "true"
 
 	flag = flags.VarPF(
-		&filterValue{rgb, git.Include, "refs/notes", false}, "notes", "",
+		&filterValue{rgb, git.Include, "refs/notes", false, "notes"}, "notes", "",
 		"process all git-notes references",
 	)
 	flag.NoOptDefVal = "true"
 
 	flag = flags.VarPF(
-		&filterValue{rgb, git.Exclude, "refs/notes", false}, "no-notes", "",
+		&filterValue{rgb, git.Exclude, "refs/notes", false, "no-notes"}, "no-notes", "",
 		"exclude all git-notes references",
 	)
 	flag.NoOptDefVal = "true"
 
 	flag = flags.VarPF(
-		&filterValue{rgb, git.Include, "refs/stash", true}, "stash", "",
+		&filterValue{rgb, git.Include, "refs/stash", true, "stash"}, "stash", "",
 		"process refs/stash",
 	)
 	flag.NoOptDefVal = "true"
 
 	flag = flags.VarPF(
-		&filterValue{rgb, git.Exclude, "refs/stash", true}, "no-stash", "",
+		&filterValue{rgb, git.Exclude, "refs/stash", true, "no-stash"}, "no-stash", "",
 		"exclude refs/stash",
 	)
 	flag.NoOptDefVal = "true"
 
+	flags.BoolVar(
+		&rgb.regexpPartialMatch, "regexp-partial-match", false,
+		"let REGEXP patterns match any part of a reference name",
+	)
+
+	flags.BoolVar(
+		&rgb.lenientFilters, "lenient-filters", false,
+		"skip invalid reference-selection patterns with a warning",
+	)
+
 	flag = flags.VarPF(
 		&filterGroupValue{rgb}, "refgroup", "",
 		"process references in refgroup defined by gitconfig",
@@ -252,6 +316,107 @@ func (rgb *RefGroupBuilder) AddRefopts(flags *pflag.FlagSet) {
 	flag.Deprecated = "use --include=@REFGROUP"
 }
 
+// filterRule is one reference-selection option that has been applied
+// to the top-level filter.
+type filterRule struct {
+	// option is the option, written as the equivalent `--include` or
+	// `--exclude` option.
+	option string
+
+	// given is the option the way that the user wrote it (e.g.,
+	// `--no-tags`).
+	given string
+
+	combiner git.Combiner
+	filter   git.ReferenceFilter
+}
+
+// addFilterRule combines `filter` into the top-level filter using
+// `combiner`, and records that it was done by the option `given`,
+// which is equivalent to `option`.
+func (rgb *RefGroupBuilder) addFilterRule(
+	option, given string, combiner git.Combiner, filter git.ReferenceFilter,
+) {
+	rgb.topLevelGroup.filter = combiner.Combine(rgb.topLevelGroup.filter, filter)
+	rgb.filterRules = append(rgb.filterRules, filterRule{option, given, combiner, filter})
+}
+
+// addFilterError records that the argument `arg` of the
+// reference-selection option `option` was skipped because of `err`.
+func (rgb *RefGroupBuilder) addFilterError(option, arg string, err error) {
+	rgb.filterErrors = append(
+		rgb.filterErrors, fmt.Errorf("invalid argument %q for %q flag: %w", arg, option, err),
+	)
+}
+
+// CheckFilters reports the reference-selection options whose patterns
+// couldn't be compiled. Normally the first of them is returned as an
+// error, but with `--lenient-filters` they are returned as warnings,
+// and the scan goes on without them. It must be called after the
+// options have been parsed.
+func (rgb *RefGroupBuilder) CheckFilters() ([]string, error) {
+	if len(rgb.filterErrors) == 0 {
+		return nil, nil
+	}
+	if !rgb.lenientFilters {
+		return nil, rgb.filterErrors[0]
+	}
+
+	warnings := make([]string, 0, len(rgb.filterErrors))
+	for _, err := range rgb.filterErrors {
+		warnings = append(warnings, fmt.Sprintf("skipping %s", err))
+	}
+	return warnings, nil
+}
+
+// FilterOptions returns the reference-selection options that have
+// been used so far, in the order that they were applied, each written
+// as the equivalent `--include` or `--exclude` option (e.g.,
+// `--no-tags` is reported as `--exclude=refs/tags`).
+func (rgb *RefGroupBuilder) FilterOptions() []string {
+	options := make([]string, 0, len(rgb.filterRules))
+	for _, rule := range rgb.filterRules {
+		options = append(options, rule.option)
+	}
+	return options
+}
+
+// Explain reports whether the reference named `refname` is walked,
+// and which reference-selection option decided it, the way that the
+// user wrote it. Since each option
+// includes or excludes the references that it matches, overriding the
+// options before it, the decision is made by the last option that
+// matches. If none of them match, the reference is treated the
+// opposite way from the first option (e.g., if the first option is an
+// `--include`, then references that it doesn't match are excluded).
+// It must be called after the options have been parsed.
+func (rgb *RefGroupBuilder) Explain(refname string) (bool, string) {
+	if len(rgb.filterRules) == 0 {
+		return true, "no reference-selection options"
+	}
+
+	for i := len(rgb.filterRules) - 1; i >= 0; i-- {
+		rule := rgb.filterRules[i]
+		if rule.filter.Filter(refname) {
+			return rule.combiner == git.Include, rule.given
+		}
+	}
+
+	return rgb.filterRules[0].combiner == git.Exclude, "no option matched"
+}
+
+// IsFilterFlag reports whether `flag` is one of the
+// reference-selection options added by `AddRefopts()`, whose values
+// are reported by `FilterOptions()` rather than by the flag itself.
+func IsFilterFlag(flag *pflag.Flag) bool {
+	switch flag.Value.(type) {
+	case *filterValue, *filterGroupValue:
+		return true
+	default:
+		return false
+	}
+}
+
 // Finish collects the information gained from processing the options
 // and returns a `sizes.RefGrouper`.
 func (rgb *RefGroupBuilder) Finish() (sizes.RefGrouper, error) {
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io"
 
+	"github.com/github/git-sizer/git"
 	"github.com/github/git-sizer/sizes"
 )
 
@@ -26,9 +27,42 @@ func NewShowRefGrouper(rg sizes.RefGrouper, w io.Writer) sizes.RefGrouper {
 func (rg showRefGrouper) Categorize(refname string) (bool, []sizes.RefGroupSymbol) {
 	walk, symbols := rg.RefGrouper.Categorize(refname)
 	if walk {
-		fmt.Fprintf(rg.w, "+ %s\n", refname)
+		fmt.Fprintf(rg.w, "+ %s\n", git.DisplayString(refname))
 	} else {
-		fmt.Fprintf(rg.w, "  %s\n", refname)
+		fmt.Fprintf(rg.w, "  %s\n", git.DisplayString(refname))
 	}
 	return walk, symbols
 }
+
+// explainRefGrouper is a `sizes.RefGrouper` that logs its choices to
+// an `io.Writer`, along with the option that decided each one.
+type explainRefGrouper struct {
+	sizes.RefGrouper
+	rgb *RefGroupBuilder
+	w   io.Writer
+}
+
+// Return a `sizes.RefGrouper` that wraps its argument and behaves
+// like it except that it also logs its decisions to an `io.Writer`,
+// each followed by the reference-selection option of `rgb` that
+// decided it (see `RefGroupBuilder.Explain()`).
+func NewExplainRefGrouper(
+	rg sizes.RefGrouper, rgb *RefGroupBuilder, w io.Writer,
+) sizes.RefGrouper {
+	return explainRefGrouper{
+		RefGrouper: rg,
+		rgb:        rgb,
+		w:          w,
+	}
+}
+
+func (rg explainRefGrouper) Categorize(refname string) (bool, []sizes.RefGroupSymbol) {
+	walk, symbols := rg.RefGrouper.Categorize(refname)
+	_, reason := rg.rgb.Explain(refname)
+	marker := " "
+	if walk {
+		marker = "+"
+	}
+	fmt.Fprintf(rg.w, "%s %s (%s)\n", marker, git.DisplayString(refname), reason)
+	return walk, symbols
+}
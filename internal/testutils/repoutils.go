@@ -86,12 +86,14 @@ func (repo *TestRepo) Clone(t *testing.T, pattern string) *TestRepo {
 	}
 }
 
-// Repository returns a `*git.Repository` for `repo`.
+// Repository returns a `*git.Repository` for `repo`. It is closed
+// when the test finishes.
 func (repo *TestRepo) Repository(t *testing.T) *git.Repository {
 	t.Helper()
 
 	r, err := git.NewRepository(repo.Path)
 	require.NoError(t, err)
+	t.Cleanup(r.Close)
 	return r
 }
 
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// liveInterval is how often the table is redrawn by `--live`.
+const liveInterval = 500 * time.Millisecond
+
+// liveTable displays a table on a terminal, redrawing it in place
+// each time it is updated. Write errors are remembered and reported
+// by `Clear()`.
+type liveTable struct {
+	out      io.Writer
+	encoding OutputEncoding
+
+	// lines is the number of lines of the table that is currently
+	// displayed.
+	lines int
+	err   error
+}
+
+func newLiveTable(out io.Writer, encoding OutputEncoding) *liveTable {
+	return &liveTable{
+		out:      out,
+		encoding: encoding,
+	}
+}
+
+// erase returns the escape sequences that move the cursor back to
+// the start of the displayed table and erase it.
+func (lt *liveTable) erase() string {
+	if lt.lines == 0 {
+		return ""
+	}
+	return fmt.Sprintf("\x1b[%dA\r\x1b[J", lt.lines)
+}
+
+// Update replaces the displayed table with `table`.
+func (lt *liveTable) Update(table string) {
+	if lt.err != nil {
+		return
+	}
+	_, lt.err = lt.out.Write(lt.encoding.Encode(lt.erase()+table, false))
+	lt.lines = strings.Count(table, "\n")
+}
+
+// Clear erases the displayed table, so that the final output can be
+// written in its place. It is a NOP if `lt` is nil.
+func (lt *liveTable) Clear() error {
+	if lt == nil {
+		return nil
+	}
+	if lt.err == nil && lt.lines != 0 {
+		_, lt.err = lt.out.Write(lt.encoding.Encode(lt.erase(), false))
+		lt.lines = 0
+	}
+	return lt.err
+}
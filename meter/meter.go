@@ -14,14 +14,17 @@ import (
 // and a CR character will be added automatically.
 //
 // Call `Inc()` every time the quantity of interest increases. Call
-// `Stop()` to stop reporting. After an instance's `Stop()` method has
-// been called, it may be reused (starting at value 0) by calling
-// `Start()` again.
+// `Done()` to stop reporting, or `DoneWithSummary()` to stop
+// reporting and show `summary` (e.g., "Enumerating references: 10 of
+// 12 included") in place of the final count. After an instance's
+// `Done()` method has been called, it may be reused (starting at value
+// 0) by calling `Start()` again.
 type Progress interface {
 	Start(format string)
 	Inc()
 	Add(delta int64)
 	Done()
+	DoneWithSummary(summary string)
 }
 
 // Spinners is a slice of short strings that are repeatedly output in
@@ -105,6 +108,14 @@ func (p *progressMeter) Done() {
 	fmt.Fprintf(p.w, p.format, c, " ", "\n")
 }
 
+func (p *progressMeter) DoneWithSummary(summary string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.ticker = nil
+	// Pad it like the count, to overwrite the last progress line:
+	fmt.Fprintf(p.w, "%s                        \n", summary)
+}
+
 // NoProgressMeter is a `Progress` that doesn't actually report
 // anything.
 var NoProgressMeter noProgressMeter
@@ -115,3 +126,5 @@ func (p noProgressMeter) Start(string) {}
 func (p noProgressMeter) Inc()         {}
 func (p noProgressMeter) Add(int64)    {}
 func (p noProgressMeter) Done()        {}
+
+func (p noProgressMeter) DoneWithSummary(string) {}
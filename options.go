@@ -0,0 +1,811 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"text/template"
+	"time"
+
+	"github.com/spf13/pflag"
+
+	"github.com/github/git-sizer/git"
+	"github.com/github/git-sizer/sizes"
+)
+
+// options holds the values of the command-line options, and of the
+// gitconfig settings that provide defaults for some of them.
+type options struct {
+	nameStyle           sizes.NameStyle
+	cpuprofile          string
+	jsonOutput          bool
+	jsonStream          bool
+	outputTemplateFile  string
+	outputTemplateText  string
+	porcelain           bool
+	jsonVersion         int
+	threshold           sizes.Threshold
+	progress            bool
+	live                bool
+	version             bool
+	helpExitCodes       bool
+	failOn              sizes.Threshold
+	timeout             time.Duration
+	printConfigOnly     bool
+	doctor              bool
+	preflight           bool
+	showRefs            bool
+	explainRefs         bool
+	colorMode           ColorMode
+	outputEncoding      OutputEncoding
+	bom                 bool
+	strict              bool
+	attributesRev       string
+	archiveRev          string
+	blameTopBlob        bool
+	renames             bool
+	lfsSizes            bool
+	recurseSubmodules   bool
+	byRemote            bool
+	byNamespace         bool
+	compareRepo         string
+	tagOnly             bool
+	notesOnly           bool
+	refSharing          bool
+	checkSubmodules     bool
+	logJSON             bool
+	sampleRate          float64
+	sampleSeed          int64
+	maxCommits          int
+	checkpointFile      string
+	memoryLimit         sizes.ByteSize
+	topTrees            int
+	mergeBaseRange      string
+	firstParent         bool
+	pathRules           []sizes.PathRule
+	introducedSince     string
+	histograms          bool
+	committerDomains    bool
+	persistenceWeighted bool
+	topBlobs            int
+	topBlobsBy          string
+	classifyAttr        string
+	classify            bool
+	duplicateNames      int
+	lfsCandidates       bool
+	packStats           bool
+	namesPerMetric      int
+	namesFile           string
+	track               bool
+	assumeUnchanged     bool
+	verifyCache         bool
+	repairCache         bool
+	blobSizeLimit       sizes.ByteSize
+	bigFileThreshold    sizes.ByteSize
+	manifestFile        string
+	objectsFrom         string
+	whyOIDs             []string
+	diffCommits         bool
+	preReceive          bool
+	maxPushSize         sizes.ByteSize
+	exportDOT           string
+	exportDOTLimit      int
+	exportTreeDOT       string
+	dotDepth            int
+	dotMinBytes         sizes.ByteSize
+	exportSQLite        string
+	sqliteTreeEntries   bool
+
+	// since is the parsed value of `introducedSince`.
+	since time.Time
+
+	// outputTemplate is the parsed output template, if one was
+	// given.
+	outputTemplate *template.Template
+}
+
+// newOptions returns the options' default values.
+func newOptions() *options {
+	return &options{
+		nameStyle:      sizes.NameStyleFull,
+		threshold:      1,
+		colorMode:      ColorAuto,
+		outputEncoding: EncodingUTF8,
+	}
+}
+
+// addFlags defines the command-line options in `flags`, which store
+// their values in `o`. The reference selection options are defined
+// separately, by `refopts.RefGroupBuilder`. `defaultProgress` is the
+// default for `--progress`.
+func (o *options) addFlags(flags *pflag.FlagSet, defaultProgress bool) error {
+	flags.VarP(
+		sizes.NewThresholdFlagValue(&o.threshold, 0),
+		"verbose", "v", "report all statistics, whether concerning or not",
+	)
+	flags.Lookup("verbose").NoOptDefVal = "true"
+
+	flags.Var(
+		sizes.NewThresholdFlagValue(&o.threshold, 1),
+		"no-verbose", "report statistics that are at all concerning",
+	)
+	flags.Lookup("no-verbose").NoOptDefVal = "true"
+
+	flags.Var(
+		&o.failOn, "fail-on",
+		"exit with status 2 if any statistic reaches this level of concern",
+	)
+
+	flags.Var(
+		&o.threshold, "threshold",
+		"minimum level of concern (i.e., number of stars) that should be\n"+
+			"                              reported",
+	)
+
+	flags.Var(
+		sizes.NewThresholdFlagValue(&o.threshold, 30),
+		"critical", "only report critical statistics",
+	)
+	flags.Lookup("critical").NoOptDefVal = "true"
+
+	flags.Var(
+		&o.nameStyle, "names",
+		"display names of large objects in the specified `style`:\n"+
+			"        --names=none            omit footnotes entirely\n"+
+			"        --names=hash            show only the SHA-1s of objects\n"+
+			"        --names=full            show full names",
+	)
+
+	flags.IntVar(
+		&o.namesPerMetric, "names-per-metric", 1,
+		"name the `n` objects with the highest values of each footnoted statistic",
+	)
+
+	flags.StringVar(
+		&o.namesFile, "names-file", "",
+		"write the named objects to `file` as tab-separated values",
+	)
+
+	flags.BoolVar(
+		&o.track, "track", false,
+		"show the changes since the previous run with --track, and store this run's results",
+	)
+
+	flags.BoolVar(
+		&o.assumeUnchanged, "assume-unchanged-cache", false,
+		"reuse the cached results of an earlier run if the references haven't changed",
+	)
+	flags.BoolVar(
+		&o.verifyCache, "verify-cache", false,
+		"with --assume-unchanged-cache, recompute the results and compare them with the cached ones",
+	)
+	flags.BoolVar(
+		&o.repairCache, "repair-cache", false,
+		"with --assume-unchanged-cache, recompute the results and replace the cached ones",
+	)
+
+	flags.BoolVarP(&o.jsonOutput, "json", "j", false, "output results in JSON format")
+	flags.IntVar(&o.jsonVersion, "json-version", 1, "JSON format version to output (1 or 2)")
+	flags.BoolVar(
+		&o.jsonStream, "json-stream", false,
+		"output results as JSON objects, one statistic or entry per line",
+	)
+	flags.StringVar(
+		&o.outputTemplateFile, "output-template", "",
+		"format the results using the Go template in `FILE`",
+	)
+	flags.StringVar(
+		&o.outputTemplateText, "output-template-text", "",
+		"format the results using the Go `TEMPLATE`",
+	)
+	flags.BoolVar(
+		&o.porcelain, "porcelain", false,
+		"output the statistics in a stable, line-oriented format for scripts",
+	)
+
+	flags.BoolVar(&o.progress, "progress", defaultProgress, "report progress to stderr")
+	flags.BoolVar(&o.version, "version", false, "report the git-sizer version number")
+	flags.BoolVar(&o.helpExitCodes, "help-exit-codes", false, "list the exit statuses")
+	flags.BoolVar(
+		&o.doctor, "doctor", false,
+		"check the git executable and the repository without scanning",
+	)
+	flags.BoolVar(
+		&o.preflight, "preflight", false,
+		"report which optional git capabilities are available",
+	)
+	flags.Var(&NegatedBoolValue{&o.progress}, "no-progress", "suppress progress output")
+	flags.BoolVar(&o.logJSON, "log-json", false, "write diagnostics to stderr as JSON")
+	flags.Lookup("no-progress").NoOptDefVal = "true"
+
+	flags.Var(&o.colorMode, "color", "colorize output: `when` is 'auto', 'always', or 'never'")
+	flags.Lookup("color").NoOptDefVal = "always"
+	flags.Var(noColorValue{&o.colorMode}, "no-color", "equivalent to --color=never")
+	flags.Var(&o.outputEncoding, "encoding", "the `encoding` of the tabular output")
+	flags.BoolVar(&o.bom, "bom", false, "start the output with a byte-order mark")
+	flags.Lookup("no-color").NoOptDefVal = "true"
+	flags.BoolVar(&o.live, "live", false, "update the table in place while the scan runs")
+
+	flags.StringVar(
+		&o.attributesRev, "attributes", "",
+		"count blobs in the tree of `rev` by gitattribute setting",
+	)
+	flags.Lookup("attributes").NoOptDefVal = "HEAD"
+
+	flags.StringVar(
+		&o.archiveRev, "archive-size", "",
+		"report the size of 'git archive' output for `rev`",
+	)
+	flags.Lookup("archive-size").NoOptDefVal = "HEAD"
+
+	flags.BoolVar(
+		&o.blameTopBlob, "blame-top-blob", false,
+		"list the commits that touched the path of the largest blob",
+	)
+
+	flags.BoolVar(
+		&o.renames, "renames", false,
+		"count the renames and copies of files in the history",
+	)
+
+	flags.BoolVar(
+		&o.lfsSizes, "include-gitattributes-lfs-size", false,
+		"also report the content size, counting LFS objects instead of pointers",
+	)
+
+	flags.BoolVar(
+		&o.byRemote, "by-remote", false,
+		"report the objects unique to each remote",
+	)
+
+	flags.BoolVar(
+		&o.byNamespace, "by-namespace", false,
+		"report the objects of each type exclusive to each reference namespace",
+	)
+
+	flags.StringVar(
+		&o.compareRepo, "compare-repo", "",
+		"report the objects shared with the repository at the specified path",
+	)
+
+	flags.BoolVar(
+		&o.notesOnly, "notes-only", false,
+		"report the objects reachable from notes references but not from other references",
+	)
+
+	flags.BoolVar(
+		&o.tagOnly, "tag-only", false,
+		"report the objects reachable from tags but not from branches",
+	)
+
+	flags.BoolVar(
+		&o.refSharing, "ref-sharing", false,
+		"report the blob content shared by all references or exclusive to one",
+	)
+
+	flags.BoolVar(
+		&o.checkSubmodules, "check-submodules", false,
+		"check that gitlinks at branch tips match .gitmodules",
+	)
+
+	flags.BoolVar(
+		&o.recurseSubmodules, "recurse-submodules", false,
+		"also scan submodules and show combined totals",
+	)
+
+	flags.BoolVar(
+		&o.diffCommits, "diff-commits", false,
+		"compare each commit with its first parent",
+	)
+
+	flags.BoolVar(
+		&o.persistenceWeighted, "persistence-weighted", false,
+		"report the blob sizes weighted by the number of commits that contain them",
+	)
+
+	flags.BoolVar(
+		&o.committerDomains, "committer-domains", false,
+		"count the commits by the domain of their committer's email address",
+	)
+
+	flags.StringVar(
+		&o.exportDOT, "export-dot", "",
+		"write the commit graph to `file` in Graphviz DOT format",
+	)
+
+	flags.IntVar(
+		&o.exportDOTLimit, "export-dot-limit", 10000,
+		"refuse to export more than this many commits as DOT (0: no limit)",
+	)
+
+	flags.StringVar(
+		&o.exportTreeDOT, "export-tree-dot", "",
+		"write the directory hierarchy of HEAD's history to `file` in Graphviz DOT format",
+	)
+
+	flags.IntVar(
+		&o.dotDepth, "dot-depth", 3,
+		"with --export-tree-dot, show directories down to `n` levels deep",
+	)
+
+	flags.Var(
+		&o.dotMinBytes, "dot-min-bytes",
+		"with --export-tree-dot, leave out directories smaller than `size`",
+	)
+
+	flags.StringVar(
+		&o.exportSQLite, "export-sqlite", "",
+		"write an inventory of the scanned objects to the SQLite database `file`",
+	)
+
+	flags.BoolVar(
+		&o.sqliteTreeEntries, "sqlite-tree-entries", false,
+		"with --export-sqlite, also record every tree entry",
+	)
+
+	flags.BoolVar(
+		&o.histograms, "histograms", false,
+		"show the distributions of blob sizes, tree entries, and path depths",
+	)
+
+	flags.BoolVar(
+		&o.packStats, "pack-stats", false,
+		"report the lengths of the delta chains in packfiles",
+	)
+
+	flags.IntVar(
+		&o.topTrees, "top-trees", 0,
+		"list the `n` trees with the most entries, with their paths",
+	)
+
+	flags.IntVar(
+		&o.topBlobs, "top", 0,
+		"list the `n` top-ranked blobs, with their paths",
+	)
+
+	flags.StringVar(
+		&o.topBlobsBy, "top-by", string(sizes.BlobOrderSize),
+		"rank the blobs listed by --top by 'size' or 'refcount'",
+	)
+
+	flags.StringVar(
+		&o.classifyAttr, "classify-attr", "",
+		"split the blobs listed by --top by whether gitattribute `attr` is true",
+	)
+
+	flags.BoolVar(
+		&o.classify, "classify", false,
+		"guess what kind of repository this is from its file extensions",
+	)
+
+	flags.IntVar(
+		&o.duplicateNames, "duplicate-names", 0,
+		"list the `N` file names used by the most paths in HEAD",
+	)
+
+	flags.BoolVar(
+		&o.lfsCandidates, "lfs-candidates", false,
+		"list only the largest blobs whose paths aren't routed to LFS",
+	)
+
+	flags.Var(
+		&o.blobSizeLimit, "blob-size-limit",
+		"count the blobs larger than `size` (e.g., '10m')",
+	)
+
+	flags.Var(
+		&o.bigFileThreshold, "big-file-threshold",
+		"count the blobs larger than `size` instead of core.bigFileThreshold",
+	)
+
+	flags.StringVar(
+		&o.manifestFile, "manifest", "",
+		"write the blobs larger than --blob-size-limit to `file` as JSON lines",
+	)
+
+	flags.StringVar(
+		&o.objectsFrom, "objects-from", "",
+		"describe the objects whose OIDs are listed in `file` ('-' for stdin)",
+	)
+
+	flags.StringArrayVar(
+		&o.whyOIDs, "why", nil,
+		"show how the object `oid` is reachable from a reference",
+	)
+
+	flags.StringVar(
+		&o.mergeBaseRange, "merge-base", "",
+		"scan only the objects reachable from `<tip>` in '<base>..<tip>' "+
+			"but not from the merge base",
+	)
+
+	flags.BoolVar(
+		&o.firstParent, "first-parent", false,
+		"scan only the first-parent history of the references",
+	)
+
+	flags.Var(
+		sizes.NewPathRuleFlagValue(&o.pathRules, false), "path",
+		"limit the blob and tree statistics to the objects under `prefix`",
+	)
+
+	flags.Var(
+		sizes.NewPathRuleFlagValue(&o.pathRules, true), "exclude-path",
+		"leave the objects under `prefix` out of the blob and tree statistics",
+	)
+
+	flags.Var(
+		sizes.NewPathRegexpFlagValue(&o.pathRules, false), "path-regexp",
+		"limit the blob and tree statistics to the objects at paths matching `regexp`",
+	)
+
+	flags.Var(
+		sizes.NewPathRegexpFlagValue(&o.pathRules, true), "exclude-path-regexp",
+		"leave the objects at paths matching `regexp` out of the blob and tree statistics",
+	)
+
+	flags.StringVar(
+		&o.introducedSince, "introduced-since", "",
+		"limit the blob and tree statistics to the objects introduced after `date`",
+	)
+
+	flags.Float64Var(
+		&o.sampleRate, "sample-rate", 1,
+		"scan only this fraction of commits and extrapolate from them",
+	)
+	flags.Int64Var(
+		&o.sampleSeed, "sample-seed", 0,
+		"seed the random choice of commits for --sample-rate with `n`",
+	)
+
+	flags.IntVar(
+		&o.maxCommits, "max-commits", 0,
+		"quickly scan only the newest `n` commits and extrapolate from them",
+	)
+
+	flags.StringVar(
+		&o.checkpointFile, "checkpoint", "",
+		"save the list of objects to scan in `file`, and resume from it if it exists",
+	)
+
+	flags.Var(
+		&o.memoryLimit, "limit-memory",
+		"spill the per-object tables to disk rather than use more than about `size` of memory for them",
+	)
+
+	flags.BoolVar(
+		&o.preReceive, "pre-receive", false,
+		"report the size of the objects introduced by the ref updates on stdin",
+	)
+
+	flags.Var(
+		&o.maxPushSize, "max-push-size",
+		"with --pre-receive, exit with status 2 if the new objects total more than `size`",
+	)
+
+	flags.DurationVar(&o.timeout, "timeout", 0, "stop the scan after `duration`")
+	flags.BoolVar(&o.strict, "strict", false, "abort if any object is missing or can't be parsed")
+
+	flags.BoolVar(
+		&o.printConfigOnly, "print-config", false,
+		"print the effective settings as JSON and exit",
+	)
+
+	flags.StringVar(&o.cpuprofile, "cpuprofile", "", "write cpu profile to file")
+	if err := flags.MarkHidden("cpuprofile"); err != nil {
+		return fmt.Errorf("marking option hidden: %w", err)
+	}
+
+	return nil
+}
+
+// check checks for option values, and combinations of options, that
+// don't make sense, and parses the values that need it. It doesn't
+// need the repository.
+func (o *options) check(flags *pflag.FlagSet) error {
+	if !(o.sampleRate > 0 && o.sampleRate <= 1) {
+		return usageErrorf("--sample-rate must be greater than 0 and at most 1")
+	}
+
+	if flags.Changed("sample-seed") && o.sampleRate == 1 {
+		return usageErrorf("--sample-seed requires --sample-rate")
+	}
+
+	if o.mergeBaseRange != "" && o.sampleRate < 1 {
+		return usageErrorf("--merge-base cannot be combined with --sample-rate")
+	}
+
+	if o.firstParent && o.sampleRate < 1 {
+		return usageErrorf("--first-parent cannot be combined with --sample-rate")
+	}
+
+	if o.maxCommits < 0 {
+		return usageErrorf("--max-commits must not be negative")
+	}
+
+	if o.maxCommits > 0 && (o.sampleRate < 1 || o.mergeBaseRange != "") {
+		return usageErrorf("--max-commits cannot be combined with --sample-rate or --merge-base")
+	}
+
+	if o.checkpointFile != "" && (o.sampleRate < 1 || o.maxCommits > 0) {
+		return usageErrorf("--checkpoint cannot be combined with --sample-rate or --max-commits")
+	}
+
+	if o.introducedSince != "" {
+		var err error
+		o.since, err = parseDate(o.introducedSince)
+		if err != nil {
+			return usageErrorf("invalid --introduced-since: %w", err)
+		}
+	}
+
+	if o.topTrees < 0 {
+		return usageErrorf("--top-trees must not be negative")
+	}
+
+	if o.duplicateNames < 0 {
+		return usageErrorf("--duplicate-names must not be negative")
+	}
+
+	if o.topBlobs < 0 {
+		return usageErrorf("--top must not be negative")
+	}
+
+	if o.namesPerMetric < 1 {
+		return usageErrorf("--names-per-metric must be at least 1")
+	}
+
+	if o.objectsFrom == "-" && o.preReceive {
+		return usageErrorf("--objects-from=- cannot be combined with --pre-receive")
+	}
+
+	if flags.Changed("max-push-size") && !o.preReceive {
+		return usageErrorf("--max-push-size requires --pre-receive")
+	}
+
+	if len(o.whyOIDs) != 0 && o.preReceive {
+		return usageErrorf("--why cannot be combined with --pre-receive")
+	}
+
+	if o.classifyAttr != "" && o.topBlobs == 0 {
+		return usageErrorf("--classify-attr requires --top")
+	}
+
+	if o.lfsCandidates {
+		if sizes.BlobOrder(o.topBlobsBy) != sizes.BlobOrderSize {
+			return usageErrorf("--lfs-candidates requires --top-by=size")
+		}
+		if o.topBlobs == 0 {
+			o.topBlobs = 10
+		}
+	}
+
+	switch sizes.BlobOrder(o.topBlobsBy) {
+	case sizes.BlobOrderSize, sizes.BlobOrderRefCount:
+	default:
+		return usageErrorf("--top-by must be 'size' or 'refcount', not %q", o.topBlobsBy)
+	}
+
+	if o.manifestFile != "" && o.blobSizeLimit == 0 {
+		return usageErrorf("--manifest requires --blob-size-limit")
+	}
+
+	if o.sqliteTreeEntries && o.exportSQLite == "" {
+		return usageErrorf("--sqlite-tree-entries requires --export-sqlite")
+	}
+
+	if o.exportDOTLimit < 0 {
+		return usageErrorf("--export-dot-limit must not be negative")
+	}
+
+	if o.exportTreeDOT == "" && (flags.Changed("dot-depth") || flags.Changed("dot-min-bytes")) {
+		return usageErrorf("--dot-depth and --dot-min-bytes require --export-tree-dot")
+	}
+
+	if o.dotDepth < 0 {
+		return usageErrorf("--dot-depth must not be negative")
+	}
+
+	if o.live && o.jsonOutput {
+		return usageErrorf("--live can't be combined with --json")
+	}
+
+	if (o.verifyCache || o.repairCache) && !o.assumeUnchanged {
+		return usageErrorf("--verify-cache and --repair-cache require --assume-unchanged-cache")
+	}
+
+	if o.verifyCache && o.repairCache {
+		return usageErrorf("--verify-cache can't be combined with --repair-cache")
+	}
+
+	if o.assumeUnchanged {
+		// The cache only holds the output, so nothing else that a run
+		// would do can be skipped:
+		switch {
+		case o.live, o.track, o.preReceive, len(o.whyOIDs) != 0:
+			return usageErrorf(
+				"--assume-unchanged-cache can't be combined with --live, --track, --pre-receive, or --why",
+			)
+		case o.checkpointFile != "", o.objectsFrom != "", o.manifestFile != "", o.namesFile != "",
+			o.exportDOT != "", o.exportTreeDOT != "", o.exportSQLite != "":
+			return usageErrorf(
+				"--assume-unchanged-cache can't be combined with options that read or write files",
+			)
+		}
+	}
+
+	if o.jsonStream {
+		switch {
+		case o.jsonOutput:
+			return usageErrorf("--json-stream can't be combined with --json")
+		case o.live:
+			return usageErrorf("--live can't be combined with --json-stream")
+		case o.preReceive, len(o.whyOIDs) != 0, o.lfsCandidates:
+			return usageErrorf(
+				"--json-stream can't be combined with --pre-receive, --why, or --lfs-candidates",
+			)
+		}
+	}
+
+	if o.porcelain {
+		switch {
+		case o.jsonOutput, o.jsonStream:
+			return usageErrorf("--porcelain can't be combined with --json or --json-stream")
+		case o.outputTemplateFile != "", o.outputTemplateText != "":
+			return usageErrorf("--porcelain can't be combined with --output-template")
+		case o.live:
+			return usageErrorf("--live can't be combined with --porcelain")
+		case o.preReceive, len(o.whyOIDs) != 0, o.lfsCandidates:
+			return usageErrorf(
+				"--porcelain can't be combined with --pre-receive, --why, or --lfs-candidates",
+			)
+		}
+	}
+
+	if o.outputTemplateFile != "" || o.outputTemplateText != "" {
+		switch {
+		case o.outputTemplateFile != "" && o.outputTemplateText != "":
+			return usageErrorf("--output-template can't be combined with --output-template-text")
+		case o.jsonOutput, o.jsonStream:
+			return usageErrorf("--output-template can't be combined with --json or --json-stream")
+		case o.live:
+			return usageErrorf("--live can't be combined with --output-template")
+		case o.preReceive, len(o.whyOIDs) != 0, o.lfsCandidates:
+			return usageErrorf(
+				"--output-template can't be combined with --pre-receive, --why, or --lfs-candidates",
+			)
+		}
+
+		name, text := "--output-template-text", o.outputTemplateText
+		if o.outputTemplateFile != "" {
+			contents, err := os.ReadFile(o.outputTemplateFile)
+			if err != nil {
+				return fmt.Errorf("reading output template: %w", err)
+			}
+			name, text = o.outputTemplateFile, string(contents)
+		}
+		var err error
+		o.outputTemplate, err = sizes.ParseOutputTemplate(name, text)
+		if err != nil {
+			return fmt.Errorf("parsing output template: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// readConfig fills in the options that weren't given on the command
+// line from the gitconfig settings in `repo`, and checks the ones that
+// depend on them.
+func (o *options) readConfig(repo *git.Repository, flags *pflag.FlagSet) error {
+	if o.jsonOutput || o.printConfigOnly {
+		if !flags.Changed("json-version") {
+			v, err := repo.ConfigIntDefault("sizer.jsonVersion", o.jsonVersion)
+			if err != nil {
+				return err
+			}
+			o.jsonVersion = v
+			if !(o.jsonVersion == 1 || o.jsonVersion == 2) {
+				return fmt.Errorf("JSON version (read from gitconfig) must be 1 or 2")
+			}
+		} else if !(o.jsonVersion == 1 || o.jsonVersion == 2) {
+			return usageErrorf("JSON version must be 1 or 2")
+		}
+	}
+
+	if !flags.Changed("threshold") &&
+		!flags.Changed("verbose") &&
+		!flags.Changed("no-verbose") &&
+		!flags.Changed("critical") {
+		s, err := repo.ConfigStringDefault("sizer.threshold", fmt.Sprintf("%g", o.threshold))
+		if err != nil {
+			return err
+		}
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return fmt.Errorf("parsing gitconfig value for 'sizer.threshold': %w", err)
+		}
+		o.threshold = sizes.Threshold(v)
+	}
+
+	if !flags.Changed("names") {
+		s, err := repo.ConfigStringDefault("sizer.names", "full")
+		if err != nil {
+			return err
+		}
+		err = o.nameStyle.Set(s)
+		if err != nil {
+			return fmt.Errorf("parsing gitconfig value for 'sizer.names': %w", err)
+		}
+	}
+
+	if !flags.Changed("big-file-threshold") {
+		// This is Git's default:
+		v, err := repo.ConfigIntDefault("core.bigFileThreshold", 512<<20)
+		if err != nil {
+			return fmt.Errorf("reading gitconfig value for 'core.bigFileThreshold': %w", err)
+		}
+		if v < 0 {
+			return fmt.Errorf("invalid gitconfig value for 'core.bigFileThreshold': %d", v)
+		}
+		o.bigFileThreshold = sizes.ByteSize(v)
+	}
+
+	if o.blameTopBlob && o.nameStyle != sizes.NameStyleFull {
+		return usageErrorf("--blame-top-blob requires --names=full")
+	}
+
+	if o.classifyAttr != "" && o.nameStyle != sizes.NameStyleFull {
+		return usageErrorf("--classify-attr requires --names=full")
+	}
+
+	if o.lfsCandidates && o.nameStyle != sizes.NameStyleFull {
+		return usageErrorf("--lfs-candidates requires --names=full")
+	}
+
+	if !flags.Changed("progress") && !flags.Changed("no-progress") {
+		v, err := repo.ConfigBoolDefault("sizer.progress", o.progress)
+		if err != nil {
+			return fmt.Errorf("parsing gitconfig value for 'sizer.progress': %w", err)
+		}
+		o.progress = v
+	}
+
+	return nil
+}
+
+// objectsTable reports whether the output includes an "objects" table
+// (see `HistorySize.SetNamedObjects()`).
+func (o *options) objectsTable() bool {
+	return o.jsonOutput && o.jsonVersion == 2 || o.jsonStream
+}
+
+// scanOptions returns the `sizes.ScanOptions` that `o` selects for
+// the scan of any repository. The ones that only apply to the
+// top-level repository (e.g., the DOT and SQL output, the paths, and
+// the roots) are left for the caller to fill in.
+func (o *options) scanOptions() sizes.ScanOptions {
+	return sizes.ScanOptions{
+		Strict:                 o.strict,
+		SampleRate:             o.sampleRate,
+		SampleSeed:             o.sampleSeed,
+		TopTrees:               o.topTrees,
+		TopBlobs:               o.topBlobs,
+		TopBlobsBy:             sizes.BlobOrder(o.topBlobsBy),
+		NamesPerMetric:         o.namesPerMetric,
+		BlobSizeLimit:          uint64(o.blobSizeLimit),
+		BigFileThreshold:       uint64(o.bigFileThreshold),
+		RememberOversizedBlobs: o.manifestFile != "",
+		Histograms:             o.histograms || o.threshold <= 0,
+		DiffCommits:            o.diffCommits,
+		PersistenceWeighted:    o.persistenceWeighted,
+		CommitterDomains:       o.committerDomains,
+		DOTLimit:               o.exportDOTLimit,
+		SQLTreeEntries:         o.sqliteTreeEntries,
+		FirstParent:            o.firstParent,
+		MaxCommits:             o.maxCommits,
+		IntroducedSince:        o.since,
+		CheckpointVersion:      BuildVersion,
+		MemoryLimit:            uint64(o.memoryLimit),
+	}
+}
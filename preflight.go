@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/github/git-sizer/git"
+)
+
+// runPreflight checks, without looking at any repository, which of
+// git-sizer's optional features the `git` executable supports, and
+// writes the results to `w`. It fails only if git can't be used at
+// all; a missing capability just means that the features that depend
+// on it fall back or fail.
+func runPreflight(w io.Writer) error {
+	gitBin, err := git.FindGit()
+	if err != nil {
+		return err
+	}
+	version, err := git.ReadGitVersion(gitBin)
+	if err != nil {
+		return err
+	}
+	if err := git.CheckGitVersion(version); err != nil {
+		return err
+	}
+
+	results, err := git.ProbeCapabilities(gitBin)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "git executable: %s\n", gitBin)
+	fmt.Fprintf(w, "git version:    %s (at least %s is required)\n", version, git.MinimumGitVersion)
+	fmt.Fprintln(w)
+
+	width := 0
+	for _, r := range results {
+		if len(r.Name) > width {
+			width = len(r.Name)
+		}
+	}
+	for _, r := range results {
+		if r.Available() {
+			fmt.Fprintf(w, "yes  %-*s  needed for %s\n", width, r.Name, r.NeededFor)
+		} else {
+			fmt.Fprintf(w, "no   %-*s  needed for %s\n", width, r.Name, r.NeededFor)
+			fmt.Fprintf(w, "     %-*s  (%s)\n", width, "", r.Err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/pflag"
+
+	"github.com/github/git-sizer/git"
+	"github.com/github/git-sizer/internal/refopts"
+	"github.com/github/git-sizer/sizes"
+)
+
+// ConfigSource says where the effective value of an option came from.
+type ConfigSource string
+
+const (
+	SourceDefault     ConfigSource = "default"
+	SourceGitconfig   ConfigSource = "gitconfig"
+	SourceEnvironment ConfigSource = "environment"
+	SourceCommandLine ConfigSource = "command line"
+)
+
+// ConfigSetting is the effective value of one option, as reported by
+// `--print-config`.
+type ConfigSetting struct {
+	Value  interface{}  `json:"value"`
+	Source ConfigSource `json:"source"`
+
+	// Key is the name of the gitconfig setting or environment
+	// variable that supplied the value, if any.
+	Key string `json:"key,omitempty"`
+}
+
+// configAliases maps options that only set the value of another
+// option (e.g., `--critical` sets the threshold) to that option.
+var configAliases = map[string]string{
+	"verbose":      "threshold",
+	"no-verbose":   "threshold",
+	"critical":     "threshold",
+	"no-progress":  "progress",
+	"no-color":     "color",
+	"exclude-path": "path",
+
+	"path-regexp":         "path",
+	"exclude-path-regexp": "path",
+}
+
+// configGitconfigKeys maps options that can be set via gitconfig to
+// the corresponding gitconfig key.
+var configGitconfigKeys = map[string]string{
+	"threshold":    "sizer.threshold",
+	"names":        "sizer.names",
+	"json-version": "sizer.jsonVersion",
+	"progress":     "sizer.progress",
+
+	"big-file-threshold": "core.bigFileThreshold",
+}
+
+// effectiveConfig returns the settings of all of the options in
+// `flags` after they have been parsed and merged with the gitconfig
+// and the environment, keyed by option name.
+func effectiveConfig(
+	repo *git.Repository, flags *pflag.FlagSet, rgb *refopts.RefGroupBuilder,
+	pathRules []sizes.PathRule, getenv func(string) string,
+) (map[string]ConfigSetting, error) {
+	gitconfig, err := repo.GetConfig("")
+	if err != nil {
+		return nil, err
+	}
+	// Section and variable names are case-insensitive, and `git
+	// config --list` reports them in lowercase:
+	configured := make(map[string]bool)
+	for _, entry := range gitconfig.Entries {
+		configured[entry.Key] = true
+	}
+
+	changed := make(map[string]bool)
+	flags.Visit(func(flag *pflag.Flag) {
+		name := flag.Name
+		if alias, ok := configAliases[name]; ok {
+			name = alias
+		}
+		changed[name] = true
+	})
+
+	settings := make(map[string]ConfigSetting)
+	flags.VisitAll(func(flag *pflag.Flag) {
+		switch {
+		case flag.Hidden, flag.Deprecated != "":
+			return
+		case flag.Name == "help" || flag.Name == "version" || flag.Name == "print-config":
+			return
+		case configAliases[flag.Name] != "", refopts.IsFilterFlag(flag):
+			return
+		}
+
+		setting := ConfigSetting{
+			Value:  flagValue(flag),
+			Source: SourceDefault,
+		}
+
+		key := configGitconfigKeys[flag.Name]
+		switch {
+		case changed[flag.Name]:
+			setting.Source = SourceCommandLine
+		case key != "" && configured[strings.ToLower(key)]:
+			setting.Source = SourceGitconfig
+			setting.Key = key
+		case flag.Name == "color":
+			for _, name := range []string{"NO_COLOR", "FORCE_COLOR"} {
+				if getenv(name) != "" {
+					setting.Source = SourceEnvironment
+					setting.Key = name
+					break
+				}
+			}
+		}
+
+		settings[flag.Name] = setting
+	})
+
+	rules := make([]string, 0, len(pathRules))
+	for _, rule := range pathRules {
+		rules = append(rules, rule.String())
+	}
+	settings["path"] = ConfigSetting{
+		Value:  rules,
+		Source: sourceIf(changed["path"], SourceCommandLine),
+	}
+
+	filters := rgb.FilterOptions()
+	if filters == nil {
+		filters = []string{}
+	}
+	settings["refs"] = ConfigSetting{
+		Value:  filters,
+		Source: sourceIf(len(filters) != 0, SourceCommandLine),
+	}
+
+	refgroups := []string{}
+	for _, entry := range gitconfig.Entries {
+		if strings.HasPrefix(entry.Key, "refgroup.") {
+			refgroups = append(refgroups, entry.Key+"="+entry.Value)
+		}
+	}
+	settings["refgroups"] = ConfigSetting{
+		Value:  refgroups,
+		Source: sourceIf(len(refgroups) != 0, SourceGitconfig),
+	}
+
+	return settings, nil
+}
+
+// printConfig writes the effective settings to `w` as JSON.
+func printConfig(w io.Writer, settings map[string]ConfigSetting) error {
+	j, err := json.MarshalIndent(settings, "", "    ")
+	if err != nil {
+		return fmt.Errorf("could not convert %v to json: %w", settings, err)
+	}
+	if _, err := fmt.Fprintf(w, "%s\n", j); err != nil {
+		return fmt.Errorf("writing output: %w", err)
+	}
+	return nil
+}
+
+// flagValue returns the value of `flag`, converted to a JSON-friendly
+// type if its type is known.
+func flagValue(flag *pflag.Flag) interface{} {
+	s := flag.Value.String()
+	switch flag.Value.Type() {
+	case "bool":
+		if b, err := strconv.ParseBool(s); err == nil {
+			return b
+		}
+	case "int":
+		if i, err := strconv.Atoi(s); err == nil {
+			return i
+		}
+	case "size":
+		if n, err := strconv.ParseUint(s, 10, 64); err == nil {
+			return n
+		}
+	case "threshold":
+		if t, ok := flag.Value.(*sizes.Threshold); ok {
+			return float64(*t)
+		}
+	case "float64":
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f
+		}
+	}
+	return s
+}
+
+// sourceIf returns `source` if `cond` is true, or `SourceDefault`
+// otherwise.
+func sourceIf(cond bool, source ConfigSource) ConfigSource {
+	if cond {
+		return source
+	}
+	return SourceDefault
+}
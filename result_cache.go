@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/github/git-sizer/git"
+)
+
+// resultCacheIgnoredSettings lists the settings that don't affect the
+// output, so they aren't part of the key under which
+// `--assume-unchanged-cache` stores it.
+var resultCacheIgnoredSettings = map[string]bool{
+	"progress":               true,
+	"log-json":               true,
+	"timeout":                true,
+	"limit-memory":           true,
+	"assume-unchanged-cache": true,
+	"verify-cache":           true,
+	"repair-cache":           true,
+}
+
+// resultCacheEntry is what `--assume-unchanged-cache` stores: the
+// output of a run, and the state of the references that it was
+// computed from.
+type resultCacheEntry struct {
+	// Refs is a hash of the names and values of the references and
+	// of HEAD; see `hashReferences()`.
+	Refs    string    `json:"refs"`
+	SavedAt time.Time `json:"saved_at"`
+	Output  []byte    `json:"output"`
+}
+
+// resultCache is the place where the results of running git-sizer on
+// one repository with one set of settings are cached.
+type resultCache struct {
+	filename string
+
+	// refs is the hash of the current references.
+	refs string
+
+	// cached is the entry that was stored by an earlier run, if any
+	// could be read.
+	cached *resultCacheEntry
+}
+
+// openResultCache returns the cache for running git-sizer in `repo`
+// with `settings` (see `effectiveConfig()`), reading the entry that
+// an earlier run stored there, if any. The file is in
+// 'git-sizer/results' in the user's cache directory, named after a
+// hash of the git dir, the settings, `colorize` (which changes the
+// output, too), and git-sizer's version.
+func openResultCache(
+	repo *git.Repository, settings map[string]ConfigSetting, colorize bool,
+) (*resultCache, error) {
+	key := make(map[string]interface{}, len(settings)+3)
+	for name, setting := range settings {
+		if !resultCacheIgnoredSettings[name] {
+			key[name] = setting.Value
+		}
+	}
+	key["gitDir"] = repo.Path()
+	key["colorize"] = colorize
+	key["version"] = ReleaseVersion + " " + BuildVersion
+	// Maps are marshaled with their keys sorted, so this is stable:
+	j, err := json.Marshal(key)
+	if err != nil {
+		return nil, fmt.Errorf("could not convert %v to json: %w", key, err)
+	}
+
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return nil, fmt.Errorf("finding the directory for --assume-unchanged-cache: %w", err)
+	}
+	sum := sha256.Sum256(j)
+	c := &resultCache{
+		filename: filepath.Join(
+			cacheDir, "git-sizer", "results", hex.EncodeToString(sum[:])+".json",
+		),
+	}
+
+	c.refs, err = hashReferences(repo)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(c.filename)
+	switch {
+	case err == nil:
+		// An entry that can't be parsed is treated like a missing
+		// one, and replaced:
+		var entry resultCacheEntry
+		if json.Unmarshal(data, &entry) == nil {
+			c.cached = &entry
+		}
+	case !os.IsNotExist(err):
+		return nil, fmt.Errorf("reading cached results: %w", err)
+	}
+	return c, nil
+}
+
+// fresh returns the cached entry if it was computed from the current
+// references, or nil.
+func (c *resultCache) fresh() *resultCacheEntry {
+	if c.cached == nil || c.cached.Refs != c.refs {
+		return nil
+	}
+	return c.cached
+}
+
+// save stores `output` in the cache as the results for the current
+// references, replacing the entry that was there, if any.
+func (c *resultCache) save(output []byte) error {
+	if err := os.MkdirAll(filepath.Dir(c.filename), 0o755); err != nil {
+		return fmt.Errorf("couldn't create directory for --assume-unchanged-cache: %w", err)
+	}
+	entry := resultCacheEntry{
+		Refs:    c.refs,
+		SavedAt: time.Now(),
+		Output:  output,
+	}
+	return writeFileAtomically(c.filename, "cached results", func(w io.Writer) error {
+		return json.NewEncoder(w).Encode(entry)
+	})
+}
+
+// hashReferences returns a hash of the names and values of all of the
+// references in `repo`, and of the value of HEAD, which changes if
+// any of them does.
+func hashReferences(repo *git.Repository) (string, error) {
+	h := sha256.New()
+	out, err := repo.GitCommand("for-each-ref", "--format=%(objectname) %(refname)").Output()
+	if err != nil {
+		return "", fmt.Errorf("listing references: %w", err)
+	}
+	h.Write(out)
+	// This fails harmlessly if HEAD is unborn:
+	head, _ := repo.GitCommand("rev-parse", "--verify", "--quiet", "HEAD").Output()
+	h.Write(head)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// cacheMismatches compares the cached output `cached` with the
+// recomputed output `recomputed`, and returns the lines that are only
+// in the former and those that are only in the latter, in order.
+func cacheMismatches(cached, recomputed []byte) (removed, added []string) {
+	lines := func(b []byte) []string {
+		return strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+	}
+	oldLines, newLines := lines(cached), lines(recomputed)
+
+	// only returns the lines of `a` that aren't matched by a line of
+	// `b`, counting repeated lines separately:
+	only := func(a, b []string) []string {
+		counts := make(map[string]int)
+		for _, line := range b {
+			counts[line]++
+		}
+		var result []string
+		for _, line := range a {
+			if counts[line] > 0 {
+				counts[line]--
+				continue
+			}
+			result = append(result, line)
+		}
+		return result
+	}
+	return only(oldLines, newLines), only(newLines, oldLines)
+}
+
+// writeCacheMismatches writes the result of `cacheMismatches()` to
+// `w`, in the style of a diff.
+func writeCacheMismatches(w io.Writer, cached, recomputed []byte) {
+	removed, added := cacheMismatches(cached, recomputed)
+	var buf bytes.Buffer
+	for _, line := range removed {
+		fmt.Fprintf(&buf, "-%s\n", line)
+	}
+	for _, line := range added {
+		fmt.Fprintf(&buf, "+%s\n", line)
+	}
+	_, _ = w.Write(buf.Bytes())
+}
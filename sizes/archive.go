@@ -0,0 +1,146 @@
+package sizes
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/github/git-sizer/counts"
+	"github.com/github/git-sizer/git"
+)
+
+// ArchiveSize estimates the size of the output of `git archive` for
+// a revision; i.e., of its tree without the paths that have the
+// `export-ignore` gitattribute.
+type ArchiveSize struct {
+	// Rev is the revision whose tree was measured.
+	Rev string `json:"rev"`
+
+	// BlobCount and BlobSize describe the files (including
+	// symlinks) that would be archived.
+	BlobCount counts.Count32 `json:"blob_count"`
+	BlobSize  counts.Count64 `json:"blob_size"`
+
+	// IgnoredBlobCount and IgnoredBlobSize describe the files that
+	// would be left out because of `export-ignore`.
+	IgnoredBlobCount counts.Count32 `json:"ignored_blob_count"`
+	IgnoredBlobSize  counts.Count64 `json:"ignored_blob_size"`
+
+	// LookupFailureCount is the number of paths whose attributes
+	// couldn't be determined. Their files are counted as archived.
+	LookupFailureCount counts.Count32 `json:"lookup_failure_count"`
+}
+
+// ComputeArchiveSize estimates the size of the output of `git
+// archive` for `rev` (see `ArchiveSize`). The `export-ignore`
+// attribute is taken from the tree of `rev`. As in `git archive`, if
+// a directory has the attribute, so does everything under it.
+func ComputeArchiveSize(ctx context.Context, repo *git.Repository, rev string) (*ArchiveSize, error) {
+	var entries []git.LsTreeEntry
+	var paths []string
+	if err := repo.ForEachLsTreeEntry(
+		ctx, rev,
+		func(entry git.LsTreeEntry) error {
+			switch entry.ObjectType {
+			case "blob", "tree":
+				entries = append(entries, entry)
+				paths = append(paths, entry.Path)
+			}
+			return nil
+		},
+	); err != nil {
+		return nil, fmt.Errorf("listing the tree of '%s': %w", rev, err)
+	}
+
+	values, err := repo.CheckAttr(ctx, rev, "export-ignore", paths)
+	if err != nil {
+		return nil, fmt.Errorf("checking 'export-ignore' in '%s': %w", rev, err)
+	}
+
+	as := ArchiveSize{Rev: rev}
+
+	// ignoredDirs holds the directories that are ignored, either
+	// directly or because their parents are. Since a tree is listed
+	// before its contents, its parent has always been seen already.
+	ignoredDirs := make(map[string]bool)
+	for _, entry := range entries {
+		value, ok := values[entry.Path]
+		if !ok {
+			as.LookupFailureCount.Increment(1)
+		}
+		ignored := value == "set" || ignoredDirs[path.Dir(entry.Path)]
+
+		switch {
+		case entry.ObjectType == "tree":
+			if ignored {
+				ignoredDirs[entry.Path] = true
+			}
+		case ignored:
+			as.IgnoredBlobCount.Increment(1)
+			as.IgnoredBlobSize.Increment(counts.NewCount64(uint64(entry.Size)))
+		default:
+			as.BlobCount.Increment(1)
+			as.BlobSize.Increment(counts.NewCount64(uint64(entry.Size)))
+		}
+	}
+
+	return &as, nil
+}
+
+// jsonV2 returns `as` the way that it is represented in the version 2
+// JSON output, with camelCase names.
+func (as *ArchiveSize) jsonV2() interface{} {
+	return struct {
+		Rev                string         `json:"rev"`
+		BlobCount          counts.Count32 `json:"blobCount"`
+		BlobSize           counts.Count64 `json:"blobSize"`
+		IgnoredBlobCount   counts.Count32 `json:"ignoredBlobCount"`
+		IgnoredBlobSize    counts.Count64 `json:"ignoredBlobSize"`
+		LookupFailureCount counts.Count32 `json:"lookupFailureCount"`
+	}{
+		Rev:                as.Rev,
+		BlobCount:          as.BlobCount,
+		BlobSize:           as.BlobSize,
+		IgnoredBlobCount:   as.IgnoredBlobCount,
+		IgnoredBlobSize:    as.IgnoredBlobSize,
+		LookupFailureCount: as.LookupFailureCount,
+	}
+}
+
+// Warning returns a one-line warning if the attributes of some paths
+// couldn't be determined, or "" otherwise.
+func (as *ArchiveSize) Warning() string {
+	if as == nil || as.LookupFailureCount == 0 {
+		return ""
+	}
+	return fmt.Sprintf(
+		"couldn't check the 'export-ignore' attribute of %d path(s) in '%s'; "+
+			"their files are counted as archived",
+		as.LookupFailureCount, as.Rev,
+	)
+}
+
+// String returns a human-readable summary of the estimated archive
+// size.
+func (as *ArchiveSize) String() string {
+	if as == nil {
+		return ""
+	}
+
+	size := func(n counts.Humanable) string {
+		numeral, unit := counts.Binary.Format(n, "B")
+		return strings.TrimSpace(numeral + " " + unit)
+	}
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "\nFiles in 'git archive %s':\n\n", git.DisplayString(as.Rev))
+	fmt.Fprintf(buf, "    %-24s  %10s  %10s\n", "Files", "Count", "Size")
+	fmt.Fprintf(buf, "    %-24s  %10d  %10s\n", "Archived", as.BlobCount, size(as.BlobSize))
+	fmt.Fprintf(
+		buf, "    %-24s  %10d  %10s\n",
+		"Left out (export-ignore)", as.IgnoredBlobCount, size(as.IgnoredBlobSize),
+	)
+	return buf.String()
+}
@@ -0,0 +1,108 @@
+package sizes
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/github/git-sizer/counts"
+	"github.com/github/git-sizer/git"
+)
+
+// AttributeCounts records how many of the blobs in a tree are
+// governed by each gitattribute setting.
+type AttributeCounts struct {
+	// Rev is the revision whose tree was analyzed.
+	Rev string `json:"rev"`
+
+	// BlobCount is the total number of blobs in the tree.
+	BlobCount counts.Count32 `json:"blob_count"`
+
+	// UnattributedBlobCount is the number of blobs that have no
+	// attributes at all.
+	UnattributedBlobCount counts.Count32 `json:"unattributed_blob_count"`
+
+	// Counts maps each attribute setting, in `.gitattributes`
+	// notation (e.g., `binary`, `-text`, or `diff=lfs`), to the
+	// number of blobs that it applies to.
+	Counts map[string]counts.Count32 `json:"counts"`
+}
+
+// CountAttributes uses `git check-attr` to count how many of the
+// blobs in the tree of `rev` are governed by each gitattribute
+// setting.
+func CountAttributes(ctx context.Context, repo *git.Repository, rev string) (*AttributeCounts, error) {
+	ac := AttributeCounts{
+		Rev:    rev,
+		Counts: make(map[string]counts.Count32),
+	}
+
+	attributedBlobCount := 0
+	blobCount, err := repo.ForEachBlobAttributes(
+		ctx, rev,
+		func(_ string, attrs []git.Attribute) error {
+			attributedBlobCount++
+			for _, attr := range attrs {
+				c := ac.Counts[attr.String()]
+				c.Increment(1)
+				ac.Counts[attr.String()] = c
+			}
+			return nil
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("counting gitattributes for '%s': %w", rev, err)
+	}
+
+	ac.BlobCount = counts.NewCount32(uint64(blobCount))
+	ac.UnattributedBlobCount = counts.NewCount32(uint64(blobCount - attributedBlobCount))
+
+	return &ac, nil
+}
+
+// jsonV2 returns `ac` the way that it is represented in the version 2
+// JSON output, with camelCase names.
+func (ac *AttributeCounts) jsonV2() interface{} {
+	return struct {
+		Rev                   string                    `json:"rev"`
+		BlobCount             counts.Count32            `json:"blobCount"`
+		UnattributedBlobCount counts.Count32            `json:"unattributedBlobCount"`
+		Counts                map[string]counts.Count32 `json:"counts"`
+	}(*ac)
+}
+
+// String returns a human-readable table of the attribute counts,
+// with the most common settings first.
+func (ac *AttributeCounts) String() string {
+	if ac == nil {
+		return ""
+	}
+
+	settings := make([]string, 0, len(ac.Counts))
+	width := len("(no attributes)")
+	for setting := range ac.Counts {
+		settings = append(settings, setting)
+		if len(setting) > width {
+			width = len(setting)
+		}
+	}
+	sort.Slice(settings, func(i, j int) bool {
+		ci, cj := ac.Counts[settings[i]], ac.Counts[settings[j]]
+		if ci != cj {
+			return ci > cj
+		}
+		return settings[i] < settings[j]
+	})
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(
+		buf, "\nBlobs by gitattribute in '%s' (%d blobs):\n\n",
+		git.DisplayString(ac.Rev), ac.BlobCount,
+	)
+	for _, setting := range settings {
+		fmt.Fprintf(buf, "    %-*s %8d\n", width, git.DisplayString(setting), ac.Counts[setting])
+	}
+	fmt.Fprintf(buf, "    %-*s %8d\n", width, "(no attributes)", ac.UnattributedBlobCount)
+	return buf.String()
+}
@@ -0,0 +1,128 @@
+package sizes
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/github/git-sizer/counts"
+	"github.com/github/git-sizer/git"
+)
+
+// MaxTopBlobCommitsListed is the maximum number of commits that are
+// listed in `TopBlobHistory.Commits`. Additional commits are only
+// counted.
+const MaxTopBlobCommitsListed = 20
+
+// TopBlobCommit is a commit that added or modified the path of the
+// largest blob.
+type TopBlobCommit struct {
+	OID     git.OID `json:"oid"`
+	Author  string  `json:"author"`
+	Date    string  `json:"date"`
+	Subject string  `json:"subject"`
+}
+
+// TopBlobHistory lists the commits that added or modified the path
+// at which the largest blob was found.
+type TopBlobHistory struct {
+	// OID and Size identify the largest blob.
+	OID  git.OID        `json:"oid"`
+	Size counts.Count32 `json:"size"`
+
+	// Path is the path of the blob within the tree of Commit, which
+	// is where the scan found it.
+	Commit git.OID `json:"commit"`
+	Path   string  `json:"path"`
+
+	// Count is the total number of commits that touched Path. At
+	// most `MaxTopBlobCommitsListed` of them, the newest ones, are
+	// listed in Commits.
+	Count   counts.Count32  `json:"count"`
+	Commits []TopBlobCommit `json:"commits"`
+}
+
+// BlameTopBlob uses `git log --follow` to find the commits that added
+// or modified the path of the largest blob in `s`, as of the commit
+// via which it was found. It returns nil if `s` includes no blobs.
+// The path of the largest blob must be known, which requires the scan
+// to have been run with `NameStyleFull`.
+func BlameTopBlob(
+	ctx context.Context, repo *git.Repository, s *HistorySize,
+) (*TopBlobHistory, error) {
+	if s.MaxBlobSizeBlob == nil {
+		if s.UniqueBlobCount == 0 {
+			return nil, nil
+		}
+		return nil, errors.New("the path of the largest blob is not known")
+	}
+
+	commit, path, ok := s.MaxBlobSizeBlob.TreePath()
+	if !ok {
+		return nil, fmt.Errorf(
+			"could not determine the path of the largest blob (%s)",
+			s.MaxBlobSizeBlob.OID,
+		)
+	}
+
+	tbh := TopBlobHistory{
+		OID:     s.MaxBlobSizeBlob.OID,
+		Size:    s.MaxBlobSize,
+		Commit:  commit,
+		Path:    path,
+		Commits: []TopBlobCommit{},
+	}
+
+	if err := repo.ForEachPathCommit(
+		ctx, commit.String(), path,
+		func(pc git.PathCommit) error {
+			tbh.Count.Increment(1)
+			if len(tbh.Commits) < MaxTopBlobCommitsListed {
+				tbh.Commits = append(
+					tbh.Commits,
+					TopBlobCommit{
+						OID:     pc.OID,
+						Author:  fmt.Sprintf("%s <%s>", pc.AuthorName, pc.AuthorEmail),
+						Date:    pc.AuthorDate,
+						Subject: pc.Subject,
+					},
+				)
+			}
+			return nil
+		},
+	); err != nil {
+		return nil, fmt.Errorf("listing commits that touched '%s': %w", path, err)
+	}
+
+	return &tbh, nil
+}
+
+// String returns a human-readable list of the commits that touched
+// the path of the largest blob.
+func (tbh *TopBlobHistory) String() string {
+	if tbh == nil {
+		return ""
+	}
+
+	buf := &bytes.Buffer{}
+	size, unit := counts.Binary.Format(tbh.Size, "B")
+	fmt.Fprintf(
+		buf, "\nCommits that touched the path of the largest blob (%s, %s %s):\n"+
+			"    %s:%s\n\n",
+		tbh.OID, size, unit, tbh.Commit, git.DisplayString(tbh.Path),
+	)
+	for _, c := range tbh.Commits {
+		fmt.Fprintf(
+			buf, "    %s %s %s\n        %s\n",
+			c.OID, c.Date, git.DisplayString(c.Author), git.DisplayString(c.Subject),
+		)
+	}
+	if tbh.Count > counts.Count32(len(tbh.Commits)) {
+		fmt.Fprintf(
+			buf, "    (%d more not listed)\n",
+			uint64(tbh.Count)-uint64(len(tbh.Commits)),
+		)
+	}
+	return buf.String()
+}
@@ -0,0 +1,55 @@
+package sizes
+
+import (
+	"github.com/github/git-sizer/counts"
+	"github.com/github/git-sizer/git"
+)
+
+// maxOversizedBlobExamples is the most blobs that are named as
+// examples in `OversizedBlobs`.
+const maxOversizedBlobExamples = 10
+
+// OversizedBlobs describes the blobs that are larger than a size
+// limit (`ScanOptions.BlobSizeLimit` or `BigFileThreshold`).
+type OversizedBlobs struct {
+	// Limit is the size limit, in bytes.
+	Limit counts.Count64 `json:"limit"`
+
+	// Count is the number of distinct blobs larger than `Limit`,
+	// and Size is their total size.
+	Count counts.Count32 `json:"count"`
+	Size  counts.Count64 `json:"size"`
+
+	// Examples holds (up to `maxOversizedBlobExamples` of) those
+	// blobs, in the order that they were found.
+	Examples []*Path `json:"examples,omitempty"`
+
+	// blobs maps the OID of each of those blobs to its size, if
+	// `ScanOptions.RememberOversizedBlobs` was set (see
+	// `WriteBlobManifest()`).
+	blobs map[git.OID]counts.Count32
+}
+
+// recordBlob records the blob `oid`, whose size is `size`, if it is
+// over the limit.
+func (ob *OversizedBlobs) recordBlob(g *Graph, oid git.OID, size counts.Count32) {
+	if counts.Count64(size) <= ob.Limit {
+		return
+	}
+	ob.Count.Increment(1)
+	ob.Size.Increment(counts.Count64(size))
+	if ob.blobs != nil {
+		ob.blobs[oid] = size
+	}
+	if len(ob.Examples) < maxOversizedBlobExamples {
+		if p := g.pathResolver.RequestPath(oid, "blob"); p != nil {
+			ob.Examples = append(ob.Examples, p)
+		}
+	}
+}
+
+// limitString returns the limit in human-readable form (e.g., "10.0
+// MiB").
+func (ob *OversizedBlobs) limitString() string {
+	return FormatHumanBytes(uint64(ob.Limit))
+}
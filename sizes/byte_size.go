@@ -0,0 +1,142 @@
+package sizes
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/github/git-sizer/counts"
+)
+
+// ParseHumanBytes parses `s`, which is a number of bytes, optionally
+// followed by a unit (possibly after a space):
+//
+//   - "k", "m", "g", or "t" (in either case) multiply by powers of
+//     1024, as in Git's configuration;
+//   - "KiB", "MiB", "GiB", or "TiB" (in any case, with or without the
+//     "B") also multiply by powers of 1024;
+//   - "kB", "MB", "GB", or "TB" (the prefix in either case, but with
+//     an uppercase "B") multiply by powers of 1000;
+//   - "B" (in either case) means bytes.
+//
+// Fractional values (e.g., "1.5g") are allowed with a unit other
+// than bytes, and are rounded to the nearest byte. A lowercase "b"
+// after a prefix (e.g., "10mb") is rejected as ambiguous, because it
+// could mean bits, and because Git reads it as "MiB". So are negative
+// numbers, digit grouping, and exponents.
+//
+// The output of `FormatHumanBytes()` is accepted, and round-trips if
+// it was exact.
+func ParseHumanBytes(s string) (uint64, error) {
+	trimmed := strings.TrimSpace(s)
+	i := strings.IndexFunc(trimmed, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	if i == -1 {
+		i = len(trimmed)
+	}
+	numeral, suffix := trimmed[:i], strings.TrimLeft(trimmed[i:], " ")
+
+	switch {
+	case trimmed == "":
+		return 0, errors.New("empty size")
+	case strings.HasPrefix(trimmed, "-"):
+		return 0, fmt.Errorf("invalid size %q: sizes can't be negative", s)
+	case numeral == "":
+		return 0, fmt.Errorf("invalid size %q: it must start with a number", s)
+	case strings.HasPrefix(suffix, ",") || strings.HasPrefix(suffix, "_"):
+		return 0, fmt.Errorf("invalid size %q: write the number without digit grouping", s)
+	}
+
+	multiplier, err := byteUnitMultiplier(suffix)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q: %w", s, err)
+	}
+
+	v, err := strconv.ParseFloat(numeral, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q: %q is not a number", s, numeral)
+	}
+	if multiplier == 1 && v != math.Trunc(v) {
+		return 0, fmt.Errorf("invalid size %q: fractional number of bytes", s)
+	}
+	v = math.Round(v * float64(multiplier))
+	if v >= math.MaxUint64 {
+		return 0, fmt.Errorf("invalid size %q: too large", s)
+	}
+	return uint64(v), nil
+}
+
+// byteUnitMultiplier returns the number of bytes in `unit`, which is
+// the part of a size that follows the number (see
+// `ParseHumanBytes()`).
+func byteUnitMultiplier(unit string) (uint64, error) {
+	if unit == "" || unit == "b" || unit == "B" {
+		return 1, nil
+	}
+
+	var exponent int
+	switch strings.ToLower(unit[:1]) {
+	case "k":
+		exponent = 1
+	case "m":
+		exponent = 2
+	case "g":
+		exponent = 3
+	case "t":
+		exponent = 4
+	default:
+		return 0, errors.New("the unit must be k, m, g, or t, optionally followed by 'iB' or 'B'")
+	}
+
+	binary := uint64(1) << (10 * exponent)
+	decimal := uint64(math.Pow10(3 * exponent))
+	switch rest := unit[1:]; rest {
+	case "", "i", "I", "iB", "ib", "IB", "Ib":
+		return binary, nil
+	case "B":
+		return decimal, nil
+	case "b":
+		decimalPrefix := strings.ToUpper(unit[:1])
+		if decimalPrefix == "K" {
+			decimalPrefix = "k"
+		}
+		return 0, fmt.Errorf(
+			"'%s' is ambiguous; write '%siB' for powers of 1024 or '%sB' for powers of 1000",
+			unit, strings.ToUpper(unit[:1]), decimalPrefix,
+		)
+	default:
+		return 0, errors.New("the unit must be k, m, g, or t, optionally followed by 'iB' or 'B'")
+	}
+}
+
+// FormatHumanBytes formats `n` the way sizes are shown in the output
+// (e.g., "10.0 MiB").
+func FormatHumanBytes(n uint64) string {
+	numeral, unit := counts.Binary.FormatNumber(n, "B")
+	return numeral + " " + unit
+}
+
+// ByteSize is a number of bytes that can be set from a command-line
+// flag, written as described in `ParseHumanBytes()`. It implements
+// `pflag.Value`.
+type ByteSize uint64
+
+func (b *ByteSize) String() string {
+	return strconv.FormatUint(uint64(*b), 10)
+}
+
+func (b *ByteSize) Set(s string) error {
+	v, err := ParseHumanBytes(s)
+	if err != nil {
+		return err
+	}
+	*b = ByteSize(v)
+	return nil
+}
+
+func (b *ByteSize) Type() string {
+	return "size"
+}
@@ -0,0 +1,312 @@
+package sizes
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/github/git-sizer/counts"
+	"github.com/github/git-sizer/git"
+)
+
+// checkpointFormat is the version of the format of checkpoint files
+// (see `ScanOptions.Checkpoint`). It has to be incremented whenever
+// the format changes.
+const checkpointFormat = 1
+
+// A checkpoint file consists of a header line holding a
+// `checkpointHeader` as JSON, followed by one line per object listed
+// by `git rev-list --objects`, in the order that they were listed,
+// of the form "<oid> <type> <size>".
+type checkpointHeader struct {
+	Format  int    `json:"format"`
+	Version string `json:"version"`
+
+	// Options and Refs are the scan options and the references that
+	// the objects were listed for. They have to match exactly for the
+	// checkpoint to be used.
+	Options json.RawMessage `json:"options"`
+	Refs    json.RawMessage `json:"refs"`
+
+	// ObjectCount is the number of object lines that follow.
+	ObjectCount uint64 `json:"object_count"`
+}
+
+// checkpointRef is how a reference is recorded in a checkpoint.
+type checkpointRef struct {
+	Refname    string           `json:"refname"`
+	OID        git.OID          `json:"oid"`
+	ObjectType git.ObjectType   `json:"object_type"`
+	Walked     bool             `json:"walked"`
+	Groups     []RefGroupSymbol `json:"groups"`
+}
+
+// checkpointOptions returns the options that a checkpoint for a scan
+// with `opts` and `nameStyle` must have been written with.
+func checkpointOptions(opts ScanOptions, nameStyle NameStyle) (json.RawMessage, error) {
+	return json.Marshal(
+		struct {
+			NameStyle NameStyle   `json:"name_style"`
+			Options   ScanOptions `json:"scan_options"`
+		}{nameStyle, opts},
+	)
+}
+
+// checkpointRefs returns `refs` in the form in which they are
+// recorded in a checkpoint.
+func checkpointRefs(refs []refSeen) (json.RawMessage, error) {
+	crs := make([]checkpointRef, 0, len(refs))
+	for _, ref := range refs {
+		crs = append(
+			crs,
+			checkpointRef{
+				Refname:    ref.Refname,
+				OID:        ref.OID,
+				ObjectType: ref.ObjectType,
+				Walked:     ref.walked,
+				Groups:     ref.groups,
+			},
+		)
+	}
+	return json.Marshal(crs)
+}
+
+// checkpointWriter records the objects listed by `git rev-list` in a
+// temporary file, and turns them into a checkpoint file once the
+// listing is complete. That way, there is never a checkpoint for an
+// incomplete listing.
+type checkpointWriter struct {
+	path    string
+	objects *os.File
+	out     *bufio.Writer
+	count   uint64
+}
+
+// newCheckpointWriter returns a `checkpointWriter` that writes the
+// checkpoint to `path`.
+func newCheckpointWriter(path string) (*checkpointWriter, error) {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".objects-*")
+	if err != nil {
+		return nil, fmt.Errorf("creating checkpoint: %w", err)
+	}
+	return &checkpointWriter{
+		path:    path,
+		objects: f,
+		out:     bufio.NewWriter(f),
+	}, nil
+}
+
+// add records the object described by `header`.
+func (cw *checkpointWriter) add(header git.BatchHeader) error {
+	cw.count++
+	if _, err := fmt.Fprintf(
+		cw.out, "%s %s %d\n", header.OID, header.ObjectType, header.ObjectSize,
+	); err != nil {
+		return fmt.Errorf("writing checkpoint: %w", err)
+	}
+	return nil
+}
+
+// finish writes the checkpoint file, with a header made from
+// `version`, `options`, and `refs`, followed by the objects that have
+// been added.
+func (cw *checkpointWriter) finish(version string, options json.RawMessage, refs []refSeen) error {
+	defer cw.abort()
+
+	if err := cw.out.Flush(); err != nil {
+		return fmt.Errorf("writing checkpoint: %w", err)
+	}
+	if _, err := cw.objects.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("writing checkpoint: %w", err)
+	}
+
+	crs, err := checkpointRefs(refs)
+	if err != nil {
+		return fmt.Errorf("writing checkpoint: %w", err)
+	}
+	header, err := json.Marshal(
+		checkpointHeader{
+			Format:      checkpointFormat,
+			Version:     version,
+			Options:     options,
+			Refs:        crs,
+			ObjectCount: cw.count,
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("writing checkpoint: %w", err)
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(cw.path), "."+filepath.Base(cw.path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("creating checkpoint: %w", err)
+	}
+	if err := func() error {
+		out := bufio.NewWriter(f)
+		if _, err := out.Write(append(header, '\n')); err != nil {
+			return err
+		}
+		if _, err := io.Copy(out, cw.objects); err != nil {
+			return err
+		}
+		if err := out.Flush(); err != nil {
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+		return os.Rename(f.Name(), cw.path)
+	}(); err != nil {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+		return fmt.Errorf("writing checkpoint: %w", err)
+	}
+	return nil
+}
+
+// abort discards the temporary file. It may be called more than once.
+func (cw *checkpointWriter) abort() {
+	if cw.objects == nil {
+		return
+	}
+	_ = cw.objects.Close()
+	_ = os.Remove(cw.objects.Name())
+	cw.objects = nil
+}
+
+// checkpointReader replays the objects recorded in a checkpoint file,
+// in place of a `git.ObjectIter`.
+type checkpointReader struct {
+	path   string
+	f      *os.File
+	in     *bufio.Reader
+	header checkpointHeader
+	read   uint64
+}
+
+// openCheckpoint opens the checkpoint at `path`, if there is one, and
+// checks that it was written by git-sizer `version` for a scan with
+// `options`. It returns nil if there is no such file.
+func openCheckpoint(path, version string, options json.RawMessage) (*checkpointReader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("opening checkpoint: %w", err)
+	}
+
+	cr := checkpointReader{
+		path: path,
+		f:    f,
+		in:   bufio.NewReader(f),
+	}
+	if err := cr.readHeader(version, options); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return &cr, nil
+}
+
+func (cr *checkpointReader) readHeader(version string, options json.RawMessage) error {
+	line, err := cr.in.ReadBytes('\n')
+	if err != nil {
+		return fmt.Errorf("reading checkpoint '%s': %w", cr.path, err)
+	}
+	if err := json.Unmarshal(line, &cr.header); err != nil {
+		return fmt.Errorf("reading checkpoint '%s': %w", cr.path, err)
+	}
+
+	switch {
+	case cr.header.Format != checkpointFormat:
+		return fmt.Errorf(
+			"checkpoint '%s' has an unsupported format (%d); remove it to start over",
+			cr.path, cr.header.Format,
+		)
+	case cr.header.Version != version:
+		return fmt.Errorf(
+			"checkpoint '%s' was written by a different version of git-sizer (%q); "+
+				"remove it to start over",
+			cr.path, cr.header.Version,
+		)
+	case !bytes.Equal(cr.header.Options, options):
+		return fmt.Errorf(
+			"checkpoint '%s' was written for a scan with different options; "+
+				"remove it to start over",
+			cr.path,
+		)
+	}
+	return nil
+}
+
+// checkRefs checks that the checkpoint was written for `refs`.
+func (cr *checkpointReader) checkRefs(refs []refSeen) error {
+	crs, err := checkpointRefs(refs)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(cr.header.Refs, crs) {
+		return fmt.Errorf(
+			"the references have changed since checkpoint '%s' was written; "+
+				"remove it to start over",
+			cr.path,
+		)
+	}
+	return nil
+}
+
+// AddRoot does nothing, because the objects were already listed.
+func (cr *checkpointReader) AddRoot(_ git.OID) error {
+	return nil
+}
+
+// Close does nothing. (The file is closed by `closeFile()`.)
+func (cr *checkpointReader) Close() {}
+
+// closeFile closes the checkpoint file.
+func (cr *checkpointReader) closeFile() {
+	_ = cr.f.Close()
+}
+
+// Next returns the next object recorded in the checkpoint, or false
+// if there are none left.
+func (cr *checkpointReader) Next() (git.BatchHeader, bool, error) {
+	if cr.read == cr.header.ObjectCount {
+		return git.BatchHeader{}, false, nil
+	}
+
+	line, err := cr.in.ReadString('\n')
+	if err != nil {
+		if err == io.EOF {
+			err = errors.New("the file is truncated")
+		}
+		return git.BatchHeader{}, false, fmt.Errorf("reading checkpoint '%s': %w", cr.path, err)
+	}
+	words := strings.Fields(line)
+	if len(words) != 3 {
+		return git.BatchHeader{}, false, fmt.Errorf(
+			"reading checkpoint '%s': malformed line %q", cr.path, line,
+		)
+	}
+	oid, err := git.NewOID(words[0])
+	if err != nil {
+		return git.BatchHeader{}, false, fmt.Errorf("reading checkpoint '%s': %w", cr.path, err)
+	}
+	size, err := strconv.ParseUint(words[2], 10, 32)
+	if err != nil {
+		return git.BatchHeader{}, false, fmt.Errorf("reading checkpoint '%s': %w", cr.path, err)
+	}
+	cr.read++
+	return git.BatchHeader{
+		OID:        oid,
+		ObjectType: git.ObjectType(words[1]),
+		ObjectSize: counts.NewCount32(size),
+	}, true, nil
+}
@@ -0,0 +1,133 @@
+package sizes
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/github/git-sizer/counts"
+	"github.com/github/git-sizer/git"
+)
+
+// AttributeBucket totals the blobs in one bucket of an
+// `AttributeSplit`.
+type AttributeBucket struct {
+	BlobCount counts.Count32 `json:"blob_count"`
+	BlobSize  counts.Count64 `json:"blob_size"`
+}
+
+// add adds a blob of size `size` to the bucket.
+func (ab *AttributeBucket) add(size counts.Count32) {
+	ab.BlobCount.Increment(1)
+	ab.BlobSize.Increment(counts.Count64(size))
+}
+
+// AttributeSplit splits the blobs in `TopBlobs` according to whether
+// a gitattribute is true for their paths.
+type AttributeSplit struct {
+	// Attr is the gitattribute, and Rev the revision whose
+	// attributes were used.
+	Attr string `json:"attr"`
+	Rev  string `json:"rev"`
+
+	// True holds the blobs for whose paths the attribute is set or
+	// has a value other than "false", and False those for whose
+	// paths it is unset, unspecified, or "false".
+	True  AttributeBucket `json:"true"`
+	False AttributeBucket `json:"false"`
+
+	// Unknown holds the blobs whose paths aren't known.
+	Unknown AttributeBucket `json:"unknown"`
+}
+
+// ClassifyTopBlobs splits the blobs in `tb` according to whether the
+// gitattribute `attr` is true for their paths, taking the attributes
+// from the tree of `rev` (even for blobs that were found in other
+// commits). The paths of the blobs must be known, which requires the
+// scan to have been run with `NameStyleFull`.
+func ClassifyTopBlobs(
+	ctx context.Context, repo *git.Repository, rev, attr string, tb *TopBlobs,
+) (*AttributeSplit, error) {
+	split := AttributeSplit{
+		Attr: attr,
+		Rev:  rev,
+	}
+
+	var paths []string
+	for _, b := range tb.Blobs {
+		if b.Path != "" {
+			paths = append(paths, b.Path)
+		}
+	}
+
+	values, err := repo.CheckAttr(ctx, rev, attr, paths)
+	if err != nil {
+		return nil, fmt.Errorf("checking gitattribute '%s' in '%s': %w", attr, rev, err)
+	}
+
+	for _, b := range tb.Blobs {
+		if b.Path == "" {
+			split.Unknown.add(b.Size)
+			continue
+		}
+		switch values[b.Path] {
+		case "unset", "unspecified", "false", "":
+			split.False.add(b.Size)
+		default:
+			split.True.add(b.Size)
+		}
+	}
+
+	return &split, nil
+}
+
+// jsonV2 returns `as` the way that it is represented in the version 2
+// JSON output, with camelCase names.
+func (as *AttributeSplit) jsonV2() interface{} {
+	type attributeBucket struct {
+		BlobCount counts.Count32 `json:"blobCount"`
+		BlobSize  counts.Count64 `json:"blobSize"`
+	}
+	return struct {
+		Attr    string          `json:"attr"`
+		Rev     string          `json:"rev"`
+		True    attributeBucket `json:"true"`
+		False   attributeBucket `json:"false"`
+		Unknown attributeBucket `json:"unknown"`
+	}{
+		Attr:    as.Attr,
+		Rev:     as.Rev,
+		True:    attributeBucket(as.True),
+		False:   attributeBucket(as.False),
+		Unknown: attributeBucket(as.Unknown),
+	}
+}
+
+// String returns a human-readable table of the buckets.
+func (as *AttributeSplit) String() string {
+	if as == nil {
+		return ""
+	}
+
+	size := func(n counts.Humanable) string {
+		numeral, unit := counts.Binary.Format(n, "B")
+		return strings.TrimSpace(numeral + " " + unit)
+	}
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(
+		buf, "\nListed blobs by gitattribute '%s' in '%s':\n\n",
+		git.DisplayString(as.Attr), git.DisplayString(as.Rev),
+	)
+	fmt.Fprintf(buf, "    %-13s  %10s  %10s\n", "Attribute", "Count", "Size")
+	fmt.Fprintf(buf, "    %-13s  %10d  %10s\n", "true", as.True.BlobCount, size(as.True.BlobSize))
+	fmt.Fprintf(buf, "    %-13s  %10d  %10s\n", "false", as.False.BlobCount, size(as.False.BlobSize))
+	if as.Unknown.BlobCount != 0 {
+		fmt.Fprintf(
+			buf, "    %-13s  %10d  %10s\n",
+			"(no path)", as.Unknown.BlobCount, size(as.Unknown.BlobSize),
+		)
+	}
+	return buf.String()
+}
@@ -0,0 +1,142 @@
+package sizes
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/github/git-sizer/git"
+)
+
+// secondsPerYear is the length of an average Gregorian year.
+const secondsPerYear = 365.2425 * 24 * 60 * 60
+
+// CommitDates is the range of the committer dates of the scanned
+// commits. Dates are not checked for plausibility, so a commit with a
+// skewed clock can stretch the range; such commits are also counted
+// in `HistorySize.ImplausibleDateCommitCount`.
+type CommitDates struct {
+	// Earliest is the earliest committer date, as a Unix timestamp,
+	// and EarliestDate is the same date in RFC 3339 format, in UTC.
+	// EarliestCommit is the first commit found with that date.
+	Earliest       int64  `json:"earliest"`
+	EarliestDate   string `json:"earliest_date"`
+	EarliestCommit *Path  `json:"earliest_commit,omitempty"`
+
+	// Latest, LatestDate, and LatestCommit are the same for the
+	// latest committer date.
+	Latest       int64  `json:"latest"`
+	LatestDate   string `json:"latest_date"`
+	LatestCommit *Path  `json:"latest_commit,omitempty"`
+
+	// SpanYears is the time from the earliest to the latest date, in
+	// years.
+	SpanYears float64 `json:"span_years"`
+
+	// implausible is set if either end of the range is before 1980
+	// or in the future.
+	implausible bool
+}
+
+// formatCommitDate formats `t` the way that it is shown in the JSON
+// output. Unlike `time.Time.MarshalJSON()`, `Format()` can cope with
+// years that don't have four digits, which skewed clocks can produce.
+func formatCommitDate(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// recordCommitDate records that the commit `oid` has the committer
+// `committer`, which is nil if it is missing or malformed. Dates
+// after `latest` are considered implausible.
+func (s *HistorySize) recordCommitDate(
+	g *Graph, oid git.OID, committer *git.Signature, latest time.Time,
+) {
+	if committer == nil {
+		return
+	}
+	when := committer.When.Unix()
+
+	cd := s.CommitDates
+	if cd == nil {
+		cd = &CommitDates{Earliest: when, Latest: when}
+		s.CommitDates = cd
+		cd.EarliestDate = formatCommitDate(committer.When)
+		cd.LatestDate = cd.EarliestDate
+		setPath(g.pathResolver, &cd.EarliestCommit, oid, "commit")
+		setPath(g.pathResolver, &cd.LatestCommit, oid, "commit")
+	} else if when < cd.Earliest {
+		cd.Earliest = when
+		cd.EarliestDate = formatCommitDate(committer.When)
+		setPath(g.pathResolver, &cd.EarliestCommit, oid, "commit")
+	} else if when > cd.Latest {
+		cd.Latest = when
+		cd.LatestDate = formatCommitDate(committer.When)
+		setPath(g.pathResolver, &cd.LatestCommit, oid, "commit")
+	} else {
+		return
+	}
+
+	// Compute the span from the timestamps rather than using
+	// `time.Time.Sub()`, which saturates after about 292 years:
+	cd.SpanYears = float64(cd.Latest-cd.Earliest) / secondsPerYear
+	if committer.When.Before(earliestPlausibleTime) || committer.When.After(latest) {
+		cd.implausible = true
+	}
+}
+
+// jsonV2 returns `cd` the way that it is represented in the version 2
+// JSON output, with camelCase names, and with the commits given by OID
+// and, separately, by the reference-based name that they were found
+// under.
+func (cd *CommitDates) jsonV2() interface{} {
+	return struct {
+		Earliest          int64   `json:"earliest"`
+		EarliestDate      string  `json:"earliestDate"`
+		EarliestCommit    string  `json:"earliestCommit,omitempty"`
+		EarliestCommitRef string  `json:"earliestCommitRef,omitempty"`
+		Latest            int64   `json:"latest"`
+		LatestDate        string  `json:"latestDate"`
+		LatestCommit      string  `json:"latestCommit,omitempty"`
+		LatestCommitRef   string  `json:"latestCommitRef,omitempty"`
+		SpanYears         float64 `json:"spanYears"`
+	}{
+		Earliest:          cd.Earliest,
+		EarliestDate:      cd.EarliestDate,
+		EarliestCommit:    pathOID(cd.EarliestCommit),
+		EarliestCommitRef: pathRef(cd.EarliestCommit),
+		Latest:            cd.Latest,
+		LatestDate:        cd.LatestDate,
+		LatestCommit:      pathOID(cd.LatestCommit),
+		LatestCommitRef:   pathRef(cd.LatestCommit),
+		SpanYears:         cd.SpanYears,
+	}
+}
+
+// String returns a human-readable summary of the range of commit
+// dates.
+func (cd *CommitDates) String() string {
+	if cd == nil {
+		return ""
+	}
+
+	s := fmt.Sprintf(
+		"\nCommit dates: %s to %s (%.1f years)\n",
+		time.Unix(cd.Earliest, 0).UTC().Format("2006-01-02"),
+		time.Unix(cd.Latest, 0).UTC().Format("2006-01-02"),
+		cd.SpanYears,
+	)
+	if cd.implausible {
+		s += "    Some commits have implausible dates, which may distort this range\n"
+	}
+	return s
+}
+
+// tableString returns `cd.String()` if it belongs in a table with the
+// specified threshold. The range isn't a cause for concern in itself,
+// so it is only shown with `--verbose`, unless some of the dates are
+// implausible.
+func (cd *CommitDates) tableString(threshold Threshold) string {
+	if cd == nil || threshold > 0 && !cd.implausible {
+		return ""
+	}
+	return cd.String()
+}
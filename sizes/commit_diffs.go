@@ -0,0 +1,150 @@
+package sizes
+
+import (
+	"strings"
+
+	"github.com/github/git-sizer/counts"
+	"github.com/github/git-sizer/git"
+)
+
+// CommitDiffs holds statistics that are computed by comparing the
+// tree of each commit with the tree of its first parent (see
+// `ScanOptions.DiffCommits`). Root commits are compared with the
+// empty tree.
+//
+// Each blob is also credited to the first commit (parents first) that
+// introduced it, i.e., that added or modified an entry to refer to
+// it. For merge commits, only entries that differ from those in all
+// of the parents count, so content that is merged in isn't counted
+// twice. Neither is content that already appeared elsewhere in
+// history, for example because it was cherry-picked.
+type CommitDiffs struct {
+	// MaxChangedPaths is the largest number of paths whose entries
+	// were added, deleted, or modified by any single commit.
+	MaxChangedPaths counts.Count32 `json:"max_changed_paths"`
+
+	// MaxChangedPathsCommit is the commit that changed the most
+	// paths. MaxChangedPathsDate (its author date) and
+	// MaxChangedPathsSubject describe it further.
+	MaxChangedPathsCommit  *Path  `json:"max_changed_paths_commit,omitempty"`
+	MaxChangedPathsDate    string `json:"max_changed_paths_date,omitempty"`
+	MaxChangedPathsSubject string `json:"max_changed_paths_subject,omitempty"`
+
+	// MaxNewBlobSize is the largest total size of the new blobs that
+	// were introduced by any single commit, and
+	// MaxNewBlobSizeCommit is that commit.
+	MaxNewBlobSize       counts.Count64 `json:"max_new_blob_size"`
+	MaxNewBlobSizeCommit *Path          `json:"max_new_blob_size_commit,omitempty"`
+
+	// MaxDirFanOut is the largest number of distinct names that any
+	// single directory has contained over the course of history,
+	// whether at the same time or not. The same directory is
+	// represented by many tree objects over time, so this can be
+	// larger than `HistorySize.MaxTreeEntries`. MaxDirFanOutPath is
+	// that directory ("." for the top-level directory), and
+	// MaxDirFanOutCommit is the commit that added the last of those
+	// names.
+	MaxDirFanOut       counts.Count32 `json:"max_dir_fan_out"`
+	MaxDirFanOutPath   string         `json:"max_dir_fan_out_path,omitempty"`
+	MaxDirFanOutCommit *Path          `json:"max_dir_fan_out_commit,omitempty"`
+
+	// maxChangedPathsOID is the OID of the commit that changed the
+	// most paths. It is known even if `MaxChangedPathsCommit` is not.
+	maxChangedPathsOID git.OID
+
+	// seenPaths holds every path (of files and of directories) that
+	// has appeared in the diffs so far, and dirFanOut holds the
+	// number of distinct names that have appeared in each directory.
+	seenPaths map[string]struct{}
+	dirFanOut map[string]counts.Count32
+}
+
+func newCommitDiffs() *CommitDiffs {
+	return &CommitDiffs{
+		seenPaths: make(map[string]struct{}),
+		dirFanOut: make(map[string]counts.Count32),
+	}
+}
+
+func (d *CommitDiffs) recordCommitDiff(
+	g *Graph, oid git.OID, changes []git.TreeChange,
+) {
+	if d.MaxChangedPaths.AdjustMaxIfNecessary(counts.NewCount32(uint64(len(changes)))) {
+		setPath(g.pathResolver, &d.MaxChangedPathsCommit, oid, "commit")
+		d.maxChangedPathsOID = oid
+	}
+	g.metricExamples.consider(g.pathResolver, "maxChangedPaths", oid, "commit", uint64(len(changes)))
+
+	for _, change := range changes {
+		d.recordPath(g, oid, change.Path)
+	}
+}
+
+// recordPath records that `path` exists in the commit `oid`. If the
+// path hasn't been seen before, it is counted as a new name in its
+// directory, and its own directory is recorded, too.
+func (d *CommitDiffs) recordPath(g *Graph, oid git.OID, path string) {
+	for {
+		if _, ok := d.seenPaths[path]; ok {
+			return
+		}
+		d.seenPaths[path] = struct{}{}
+
+		dir := "."
+		if i := strings.LastIndexByte(path, '/'); i != -1 {
+			dir = path[:i]
+		}
+		fanOut := d.dirFanOut[dir]
+		fanOut.Increment(1)
+		d.dirFanOut[dir] = fanOut
+		if d.MaxDirFanOut.AdjustMaxIfNecessary(fanOut) {
+			d.MaxDirFanOutPath = dir
+			setPath(g.pathResolver, &d.MaxDirFanOutCommit, oid, "commit")
+		}
+
+		if dir == "." {
+			return
+		}
+		path = dir
+	}
+}
+
+func (d *CommitDiffs) recordNewBlobs(g *Graph, oid git.OID, size counts.Count64) {
+	if d.MaxNewBlobSize.AdjustMaxIfNecessary(size) {
+		setPath(g.pathResolver, &d.MaxNewBlobSizeCommit, oid, "commit")
+	}
+	g.metricExamples.consider(g.pathResolver, "maxNewBlobSize", oid, "commit", uint64(size))
+}
+
+// describe fills in the date and subject of the commit that changed
+// the most paths.
+func (d *CommitDiffs) describe(repo *git.Repository) error {
+	if d.maxChangedPathsOID == git.NullOID {
+		return nil
+	}
+	date, subject, err := repo.CommitSummary(d.maxChangedPathsOID)
+	if err != nil {
+		return err
+	}
+	d.MaxChangedPathsDate = date
+	d.MaxChangedPathsSubject = subject
+	return nil
+}
+
+// changedPathsNote returns the note that is appended to the
+// footnote for the commit that changed the most paths.
+func (d *CommitDiffs) changedPathsNote() string {
+	if d.MaxChangedPathsDate == "" {
+		return ""
+	}
+	return d.MaxChangedPathsDate + " " + d.MaxChangedPathsSubject
+}
+
+// dirFanOutNote returns the note that is appended to the footnote for
+// the commit that completed the directory with the most names.
+func (d *CommitDiffs) dirFanOutNote() string {
+	if d.MaxDirFanOutPath == "" {
+		return ""
+	}
+	return "in " + d.MaxDirFanOutPath
+}
@@ -0,0 +1,135 @@
+package sizes
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/github/git-sizer/counts"
+	"github.com/github/git-sizer/git"
+)
+
+// MaxCommitterDomainsListed is the maximum number of domains that
+// `CommitterDomains.String()` lists. The JSON output includes all of
+// them.
+const MaxCommitterDomainsListed = 20
+
+// CommitterDomains counts the scanned commits by the domain of their
+// committer's email address (see `ScanOptions.CommitterDomains`).
+// Domains are compared case-insensitively, and reported in lowercase.
+type CommitterDomains struct {
+	// DomainCount is the number of distinct domains.
+	DomainCount counts.Count32 `json:"domain_count"`
+
+	// Domains maps each domain to the number of commits whose
+	// committer's email address is in it.
+	Domains map[string]counts.Count32 `json:"domains"`
+
+	// MalformedCount is the number of commits whose committer is
+	// missing or has an email address without a usable domain (e.g.,
+	// "root@localhost" is fine, but "root" or "jdoe@" is not).
+	MalformedCount counts.Count32 `json:"malformed_count"`
+}
+
+func newCommitterDomains() *CommitterDomains {
+	return &CommitterDomains{
+		Domains: make(map[string]counts.Count32),
+	}
+}
+
+// emailDomain returns the normalized domain of `email`, or "" if it
+// doesn't have a usable one. The domain is what follows the last "@",
+// lowercased, without surrounding whitespace or a trailing dot.
+func emailDomain(email string) string {
+	i := strings.LastIndexByte(email, '@')
+	if i == -1 {
+		return ""
+	}
+	domain := strings.TrimSuffix(strings.TrimSpace(email[i+1:]), ".")
+	if domain == "" || strings.ContainsAny(domain, " \t<>@") {
+		return ""
+	}
+	return strings.ToLower(domain)
+}
+
+// recordCommitter records the committer of a commit, which is nil if
+// it is missing or malformed.
+func (cd *CommitterDomains) recordCommitter(committer *git.Signature) {
+	if cd == nil {
+		return
+	}
+
+	var domain string
+	if committer != nil {
+		domain = emailDomain(committer.Email)
+	}
+	if domain == "" {
+		cd.MalformedCount.Increment(1)
+		return
+	}
+
+	n, ok := cd.Domains[domain]
+	if !ok {
+		cd.DomainCount.Increment(1)
+	}
+	cd.Domains[domain] = n.Plus(1)
+}
+
+// jsonV2 returns `cd` the way that it is represented in the version 2
+// JSON output, with camelCase names.
+func (cd *CommitterDomains) jsonV2() interface{} {
+	return struct {
+		DomainCount    counts.Count32            `json:"domainCount"`
+		Domains        map[string]counts.Count32 `json:"domains"`
+		MalformedCount counts.Count32            `json:"malformedCount"`
+	}(*cd)
+}
+
+// String returns a table of the domains with the most commits.
+func (cd *CommitterDomains) String() string {
+	if cd == nil {
+		return ""
+	}
+
+	domains := make([]string, 0, len(cd.Domains))
+	for domain := range cd.Domains {
+		domains = append(domains, domain)
+	}
+	sort.Slice(domains, func(i, j int) bool {
+		ni, nj := cd.Domains[domains[i]], cd.Domains[domains[j]]
+		if ni != nj {
+			return ni > nj
+		}
+		return domains[i] < domains[j]
+	})
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "\nCommitter email domains: %d\n", cd.DomainCount)
+	if len(domains) != 0 {
+		listed := domains
+		if len(listed) > MaxCommitterDomainsListed {
+			listed = listed[:MaxCommitterDomainsListed]
+		}
+		width := len("Domain")
+		for _, domain := range listed {
+			if w := len(git.DisplayString(domain)); w > width {
+				width = w
+			}
+		}
+		fmt.Fprintf(buf, "\n    %-*s  %10s\n", width, "Domain", "Commits")
+		for _, domain := range listed {
+			fmt.Fprintf(buf, "    %-*s  %10d\n", width, git.DisplayString(domain), cd.Domains[domain])
+		}
+		if len(domains) > len(listed) {
+			fmt.Fprintf(buf, "    ... and %d more\n", len(domains)-len(listed))
+		}
+	}
+	if cd.MalformedCount != 0 {
+		fmt.Fprintf(
+			buf, "\n    %d commit(s) have a committer email address without a usable domain\n",
+			cd.MalformedCount,
+		)
+	}
+	return buf.String()
+}
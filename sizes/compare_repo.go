@@ -0,0 +1,172 @@
+package sizes
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/github/git-sizer/counts"
+	"github.com/github/git-sizer/git"
+)
+
+// RepoComparison compares the objects that are reachable in the
+// scanned repository with those that are reachable in another local
+// repository (e.g., the upstream of a fork, or the repository that a
+// `--reference` clone borrows objects from). Sizes are uncompressed.
+type RepoComparison struct {
+	// Path is the path of the other repository, as given.
+	Path string `json:"path"`
+
+	// SharedCount and SharedSize describe the objects that are
+	// reachable in both repositories.
+	SharedCount counts.Count64 `json:"shared_count"`
+	SharedSize  counts.Count64 `json:"shared_size"`
+
+	// UniqueCount and UniqueSize describe the objects that are only
+	// reachable in the scanned repository.
+	UniqueCount counts.Count64 `json:"unique_count"`
+	UniqueSize  counts.Count64 `json:"unique_size"`
+
+	// OtherUniqueCount and OtherUniqueSize describe the objects that
+	// are only reachable in the other repository.
+	OtherUniqueCount counts.Count64 `json:"other_unique_count"`
+	OtherUniqueSize  counts.Count64 `json:"other_unique_size"`
+}
+
+// reachableObjects returns the set of objects that are reachable
+// from the references in `repo` that `rg` selects for walking (or from
+// all of its references, if `rg` is nil).
+func reachableObjects(
+	ctx context.Context, repo *git.Repository, rg RefGrouper,
+) (map[git.OID]struct{}, error) {
+	refs, err := walkedReferences(ctx, repo, rg)
+	if err != nil {
+		return nil, err
+	}
+
+	tips := make([]git.OID, 0, len(refs))
+	for _, ref := range refs {
+		tips = append(tips, ref.OID)
+	}
+
+	objects := make(map[git.OID]struct{})
+	if err := repo.ForEachReachableObject(
+		ctx, tips,
+		func(oid git.OID) error {
+			objects[oid] = struct{}{}
+			return nil
+		},
+	); err != nil {
+		return nil, err
+	}
+	return objects, nil
+}
+
+// sumObjectSizes returns the number and total size of `oids`, which
+// are looked up in `repo`.
+func sumObjectSizes(
+	ctx context.Context, repo *git.Repository, oids []git.OID,
+) (counts.Count64, counts.Count64, error) {
+	headers, err := repo.ObjectHeaders(ctx, oids)
+	if err != nil {
+		return 0, 0, err
+	}
+	var count, size counts.Count64
+	for _, header := range headers {
+		if header.ObjectType == "missing" {
+			continue
+		}
+		count.Increment(1)
+		size.Increment(counts.Count64(header.ObjectSize))
+	}
+	return count, size, nil
+}
+
+// ComputeRepoComparison compares the objects that are reachable from
+// the references in `repo` that `rg` selects for walking with those
+// that are reachable from any reference in `other`, which was opened
+// from `otherPath` (see `RepoComparison`).
+func ComputeRepoComparison(
+	ctx context.Context, repo *git.Repository, rg RefGrouper,
+	other *git.Repository, otherPath string,
+) (*RepoComparison, error) {
+	if repo.ObjectFormat() != other.ObjectFormat() {
+		return nil, fmt.Errorf(
+			"can't compare a %s repository with a %s repository",
+			repo.ObjectFormat(), other.ObjectFormat(),
+		)
+	}
+
+	ours, err := reachableObjects(ctx, repo, rg)
+	if err != nil {
+		return nil, fmt.Errorf("listing reachable objects: %w", err)
+	}
+	theirs, err := reachableObjects(ctx, other, nil)
+	if err != nil {
+		return nil, fmt.Errorf("listing reachable objects in '%s': %w", otherPath, err)
+	}
+
+	var shared, unique, otherUnique []git.OID
+	for oid := range ours {
+		if _, ok := theirs[oid]; ok {
+			shared = append(shared, oid)
+		} else {
+			unique = append(unique, oid)
+		}
+	}
+	for oid := range theirs {
+		if _, ok := ours[oid]; !ok {
+			otherUnique = append(otherUnique, oid)
+		}
+	}
+
+	rc := RepoComparison{Path: otherPath}
+	if rc.SharedCount, rc.SharedSize, err = sumObjectSizes(ctx, repo, shared); err != nil {
+		return nil, fmt.Errorf("looking up shared objects: %w", err)
+	}
+	if rc.UniqueCount, rc.UniqueSize, err = sumObjectSizes(ctx, repo, unique); err != nil {
+		return nil, fmt.Errorf("looking up unique objects: %w", err)
+	}
+	if rc.OtherUniqueCount, rc.OtherUniqueSize, err = sumObjectSizes(ctx, other, otherUnique); err != nil {
+		return nil, fmt.Errorf("looking up objects in '%s': %w", otherPath, err)
+	}
+	return &rc, nil
+}
+
+// jsonV2 returns `rc` the way that it is represented in the version 2
+// JSON output, with camelCase names.
+func (rc *RepoComparison) jsonV2() interface{} {
+	return struct {
+		Path             string         `json:"path"`
+		SharedCount      counts.Count64 `json:"sharedCount"`
+		SharedSize       counts.Count64 `json:"sharedSize"`
+		UniqueCount      counts.Count64 `json:"uniqueCount"`
+		UniqueSize       counts.Count64 `json:"uniqueSize"`
+		OtherUniqueCount counts.Count64 `json:"otherUniqueCount"`
+		OtherUniqueSize  counts.Count64 `json:"otherUniqueSize"`
+	}(*rc)
+}
+
+// String returns a human-readable summary of the comparison.
+func (rc *RepoComparison) String() string {
+	if rc == nil {
+		return ""
+	}
+
+	size := func(n counts.Humanable) string {
+		numeral, unit := counts.Binary.Format(n, "B")
+		return strings.TrimSpace(numeral + " " + unit)
+	}
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "\nObjects compared with '%s':\n\n", rc.Path)
+	fmt.Fprintf(buf, "    %-24s  %10s  %10s\n", "Objects", "Count", "Size")
+	fmt.Fprintf(buf, "    %-24s  %10d  %10s\n", "Shared", rc.SharedCount, size(rc.SharedSize))
+	fmt.Fprintf(buf, "    %-24s  %10d  %10s\n", "Only in this repository", rc.UniqueCount, size(rc.UniqueSize))
+	fmt.Fprintf(
+		buf, "    %-24s  %10d  %10s\n",
+		"Only in the other", rc.OtherUniqueCount, size(rc.OtherUniqueSize),
+	)
+	return buf.String()
+}
@@ -0,0 +1,162 @@
+package sizes
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/github/git-sizer/counts"
+	"github.com/github/git-sizer/git"
+)
+
+// DirectorySizes holds the number of bytes of unique blobs that were
+// ever found under each directory in the history of a revision. Each
+// blob is counted once, under the first path (parents first) at
+// which it appeared.
+type DirectorySizes struct {
+	// bytes maps each directory, as a path relative to the top level
+	// of the tree ("" for the top level itself), to the total size
+	// of the blobs under it.
+	bytes map[string]counts.Count64
+}
+
+// ComputeDirectorySizes aggregates the sizes of the blobs in the
+// history of `rev` by directory, down to `maxDepth` levels below the
+// top level. Each commit is compared with its first parent, so
+// content that a merge brings in is credited to the paths at which
+// it appears in the merge.
+func ComputeDirectorySizes(
+	ctx context.Context, repo *git.Repository, rev string, maxDepth int,
+) (*DirectorySizes, error) {
+	tip, err := repo.ResolveCommit(rev)
+	if err != nil {
+		return nil, err
+	}
+
+	var commitParents []git.CommitParent
+	if err := repo.ForEachCommit(
+		ctx, []git.OID{tip}, nil,
+		func(oid git.OID, parents []git.OID) error {
+			cp := git.CommitParent{Commit: oid}
+			if len(parents) != 0 {
+				cp.Parent = parents[0]
+			}
+			commitParents = append(commitParents, cp)
+			return nil
+		},
+	); err != nil {
+		return nil, fmt.Errorf("listing the commits of '%s': %w", rev, err)
+	}
+
+	// Remember the first path at which each object appeared:
+	var oids []git.OID
+	var paths []string
+	seen := make(map[git.OID]bool)
+	if err := repo.ForEachCommitDiff(
+		ctx, commitParents,
+		func(_ git.OID, changes []git.TreeChange) error {
+			for _, change := range changes {
+				if change.NewOID == git.NullOID || seen[change.NewOID] {
+					continue
+				}
+				seen[change.NewOID] = true
+				oids = append(oids, change.NewOID)
+				paths = append(paths, change.Path)
+			}
+			return nil
+		},
+	); err != nil {
+		return nil, fmt.Errorf("diffing the commits of '%s': %w", rev, err)
+	}
+
+	headers, err := repo.ObjectHeaders(ctx, oids)
+	if err != nil {
+		return nil, fmt.Errorf("reading object sizes: %w", err)
+	}
+
+	ds := DirectorySizes{
+		bytes: map[string]counts.Count64{"": 0},
+	}
+	for i, header := range headers {
+		if header.ObjectType != "blob" {
+			// This is a submodule, whose commit isn't in this
+			// repository.
+			continue
+		}
+		size := counts.Count64(header.ObjectSize)
+		ds.bytes[""] += size
+		components := strings.Split(paths[i], "/")
+		for depth := 1; depth < len(components) && depth <= maxDepth; depth++ {
+			ds.bytes[strings.Join(components[:depth], "/")] += size
+		}
+	}
+
+	return &ds, nil
+}
+
+// WriteDOT writes the directory hierarchy to `w` in Graphviz DOT
+// format. Each directory is a node, labeled with its path and the
+// number of bytes under it, with an edge from its parent. Directories
+// with fewer than `minBytes` bytes are left out, along with
+// everything under them.
+func (ds *DirectorySizes) WriteDOT(w io.Writer, minBytes counts.Count64) error {
+	out := bufio.NewWriter(w)
+
+	dirs := make([]string, 0, len(ds.bytes))
+	for dir, size := range ds.bytes {
+		if size >= minBytes {
+			dirs = append(dirs, dir)
+		}
+	}
+	sort.Strings(dirs)
+
+	// Nodes are named by number, so that only their labels have to
+	// be quoted. Parents sort before their children.
+	ids := make(map[string]int, len(dirs))
+
+	fmt.Fprintln(out, "digraph directories {")
+	fmt.Fprintln(out, "\trankdir=LR;")
+	fmt.Fprintln(out, "\tnode [shape=box, fontname=monospace];")
+	for _, dir := range dirs {
+		parentID := -1
+		label := "."
+		if dir != "" {
+			parent := ""
+			if i := strings.LastIndexByte(dir, '/'); i != -1 {
+				parent = dir[:i]
+			}
+			id, ok := ids[parent]
+			if !ok {
+				// The parent was pruned, so this is, too.
+				continue
+			}
+			parentID = id
+			label = dir
+		}
+		ids[dir] = len(ids)
+
+		numeral, unit := counts.Binary.Format(ds.bytes[dir], "B")
+		fmt.Fprintf(
+			out, "\td%d [label=\"%s\\n%s\"];\n",
+			ids[dir], dotEscape(label), strings.TrimSpace(numeral+" "+unit),
+		)
+		if parentID != -1 {
+			fmt.Fprintf(out, "\td%d -> d%d;\n", parentID, ids[dir])
+		}
+	}
+	fmt.Fprintln(out, "}")
+
+	return out.Flush()
+}
+
+// dotEscape returns `s`, which can be an arbitrary byte string (e.g.,
+// a path), in a form that can be used inside a double-quoted DOT
+// string and that is displayed literally.
+func dotEscape(s string) string {
+	s = git.DisplayString(s)
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return strings.ReplaceAll(s, `"`, `\"`)
+}
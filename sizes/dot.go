@@ -0,0 +1,76 @@
+package sizes
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/github/git-sizer/counts"
+	"github.com/github/git-sizer/git"
+)
+
+// dotGraph collects the commits that are scanned, so that the commit
+// graph can be written in Graphviz DOT format (see
+// `ScanOptions.DOT`).
+type dotGraph struct {
+	commits []dotCommit
+
+	// newBytes holds the number of bytes of new blobs that each
+	// commit introduced. It is only filled in if the commits are
+	// diffed (see `ScanOptions.DiffCommits`).
+	newBytes map[git.OID]counts.Count64
+}
+
+type dotCommit struct {
+	oid     git.OID
+	parents []git.OID
+}
+
+func (d *dotGraph) addCommit(oid git.OID, parents []git.OID) {
+	d.commits = append(d.commits, dotCommit{oid, parents})
+}
+
+func (d *dotGraph) setNewBytes(oid git.OID, size counts.Count64) {
+	if d.newBytes == nil {
+		d.newBytes = make(map[git.OID]counts.Count64)
+	}
+	d.newBytes[oid] = size
+}
+
+// write writes the commit graph to `w` in DOT format. Each commit is
+// a node, labeled with its abbreviated OID and (if known) the number
+// of bytes of new blobs that it introduced. Each parent link is an
+// edge from the child to the parent. If only a sample of commits was
+// scanned, edges to parents that weren't scanned are omitted.
+func (d *dotGraph) write(w io.Writer) error {
+	out := bufio.NewWriter(w)
+
+	scanned := make(map[git.OID]bool, len(d.commits))
+	for _, c := range d.commits {
+		scanned[c.oid] = true
+	}
+
+	fmt.Fprintln(out, "digraph commits {")
+	fmt.Fprintln(out, "\trankdir=BT;")
+	fmt.Fprintln(out, "\tnode [shape=box, fontname=monospace];")
+	for _, c := range d.commits {
+		label := c.oid.String()[:10]
+		if size, ok := d.newBytes[c.oid]; ok {
+			numeral, unit := counts.Binary.Format(size, "B")
+			label += fmt.Sprintf("\\n+%s", strings.TrimSpace(numeral+" "+unit))
+		}
+		fmt.Fprintf(out, "\t\"%s\" [label=\"%s\"];\n", c.oid, label)
+	}
+	for _, c := range d.commits {
+		for _, parent := range c.parents {
+			if !scanned[parent] {
+				continue
+			}
+			fmt.Fprintf(out, "\t\"%s\" -> \"%s\";\n", c.oid, parent)
+		}
+	}
+	fmt.Fprintln(out, "}")
+
+	return out.Flush()
+}
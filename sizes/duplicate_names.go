@@ -0,0 +1,140 @@
+package sizes
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path"
+	"sort"
+
+	"github.com/github/git-sizer/counts"
+	"github.com/github/git-sizer/git"
+)
+
+// DuplicateNames lists the file names that are used by the most
+// paths in a checkout (e.g., hundreds of `index.js` files in different
+// directories), which can be a sign of generated or copied sprawl.
+type DuplicateNames struct {
+	// Rev is the revision whose checkout was examined.
+	Rev string `json:"rev"`
+
+	// FileCount is the number of files (blobs and symlinks) in the
+	// checkout, and DistinctNameCount is the number of different base
+	// names among them.
+	FileCount         counts.Count32 `json:"file_count"`
+	DistinctNameCount counts.Count32 `json:"distinct_name_count"`
+
+	// Names are the base names that are used by more than one path,
+	// with the most-used first (ties are broken by name), up to the
+	// number that was requested.
+	Names []DuplicateName `json:"names"`
+}
+
+// DuplicateName is a base name and the number of paths that use it.
+type DuplicateName struct {
+	Name      string         `json:"name"`
+	PathCount counts.Count32 `json:"path_count"`
+
+	// ExamplePath is the first path (in tree order) that uses it.
+	ExamplePath string `json:"example_path"`
+}
+
+// FindDuplicateNames counts, for each base name of the files in the
+// checkout of `rev`, how many paths use it, and returns the `limit`
+// names that are used by the most paths (at least two).
+func FindDuplicateNames(
+	ctx context.Context, repo *git.Repository, rev string, limit int,
+) (*DuplicateNames, error) {
+	dn := DuplicateNames{
+		Rev:   rev,
+		Names: []DuplicateName{},
+	}
+
+	byName := make(map[string]*DuplicateName)
+	if err := repo.ForEachLsTreeEntry(
+		ctx, rev,
+		func(entry git.LsTreeEntry) error {
+			if entry.ObjectType != "blob" {
+				return nil
+			}
+			dn.FileCount.Increment(1)
+			name := path.Base(entry.Path)
+			d, ok := byName[name]
+			if !ok {
+				d = &DuplicateName{Name: name, ExamplePath: entry.Path}
+				byName[name] = d
+			}
+			d.PathCount.Increment(1)
+			return nil
+		},
+	); err != nil {
+		return nil, fmt.Errorf("listing the files in '%s': %w", rev, err)
+	}
+	dn.DistinctNameCount = counts.NewCount32(uint64(len(byName)))
+
+	for _, d := range byName {
+		if d.PathCount > 1 {
+			dn.Names = append(dn.Names, *d)
+		}
+	}
+	sort.Slice(dn.Names, func(i, j int) bool {
+		if dn.Names[i].PathCount != dn.Names[j].PathCount {
+			return dn.Names[i].PathCount > dn.Names[j].PathCount
+		}
+		return dn.Names[i].Name < dn.Names[j].Name
+	})
+	if len(dn.Names) > limit {
+		dn.Names = dn.Names[:limit]
+	}
+
+	return &dn, nil
+}
+
+// jsonV2 returns `dn` the way that it is represented in the version 2
+// JSON output, with camelCase names.
+func (dn *DuplicateNames) jsonV2() interface{} {
+	type duplicateName struct {
+		Name        string         `json:"name"`
+		PathCount   counts.Count32 `json:"pathCount"`
+		ExamplePath string         `json:"examplePath"`
+	}
+	names := make([]duplicateName, len(dn.Names))
+	for i, n := range dn.Names {
+		names[i] = duplicateName(n)
+	}
+	return struct {
+		Rev               string          `json:"rev"`
+		FileCount         counts.Count32  `json:"fileCount"`
+		DistinctNameCount counts.Count32  `json:"distinctNameCount"`
+		Names             []duplicateName `json:"names"`
+	}{
+		Rev:               dn.Rev,
+		FileCount:         dn.FileCount,
+		DistinctNameCount: dn.DistinctNameCount,
+		Names:             names,
+	}
+}
+
+// String returns a human-readable list of the most duplicated names.
+func (dn *DuplicateNames) String() string {
+	if dn == nil {
+		return ""
+	}
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(
+		buf, "\nMost duplicated file names in %s (%d files, %d distinct names):\n\n",
+		dn.Rev, dn.FileCount, dn.DistinctNameCount,
+	)
+	if len(dn.Names) == 0 {
+		fmt.Fprintf(buf, "    No name is used by more than one path\n")
+		return buf.String()
+	}
+	for _, d := range dn.Names {
+		fmt.Fprintf(
+			buf, "    %8d paths  %s (e.g., %s)\n",
+			d.PathCount, git.DisplayString(d.Name), git.DisplayString(d.ExamplePath),
+		)
+	}
+	return buf.String()
+}
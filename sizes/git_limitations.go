@@ -0,0 +1,93 @@
+package sizes
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/github/git-sizer/git"
+)
+
+// GitLimitations describes the features that are unavailable because
+// the `git` executable is older than git-sizer would like (but not so
+// old that git-sizer refuses to use it). Automated consumers of the
+// JSON output can use it to tell that some of the results may be less
+// complete than usual.
+type GitLimitations struct {
+	// Version is the version of the `git` executable.
+	Version string `json:"version"`
+
+	// Path is the path of the `git` executable.
+	Path string `json:"path"`
+
+	// Unavailable lists the capabilities that it lacks.
+	Unavailable []UnavailableGitFeature `json:"unavailable"`
+}
+
+// UnavailableGitFeature is a capability that the `git` executable
+// lacks, and what it would be needed for.
+type UnavailableGitFeature struct {
+	Name      string `json:"name"`
+	Since     string `json:"since"`
+	NeededFor string `json:"needed_for"`
+}
+
+// CheckGitLimitations returns the limitations of the `git` executable
+// that `repo` uses, or nil if it is new enough for all of git-sizer's
+// features.
+func CheckGitLimitations(repo *git.Repository) *GitLimitations {
+	unavailable := git.UnavailableCapabilities(repo.GitVersion())
+	if len(unavailable) == 0 {
+		return nil
+	}
+
+	gl := GitLimitations{
+		Version: repo.GitVersion().String(),
+		Path:    repo.GitBin(),
+	}
+	for _, c := range unavailable {
+		gl.Unavailable = append(gl.Unavailable, UnavailableGitFeature{
+			Name:      c.Name,
+			Since:     c.Since.String(),
+			NeededFor: c.NeededFor,
+		})
+	}
+	return &gl
+}
+
+// Warning returns a one-line warning that names the `git` executable
+// and the features that are unavailable.
+func (gl *GitLimitations) Warning() string {
+	features := make([]string, 0, len(gl.Unavailable))
+	for _, f := range gl.Unavailable {
+		features = append(
+			features, fmt.Sprintf("%s (git %s or newer; needed for %s)", f.Name, f.Since, f.NeededFor),
+		)
+	}
+	return fmt.Sprintf(
+		"git %s (%s) is old, so these features are unavailable: %s",
+		gl.Version, gl.Path, strings.Join(features, "; "),
+	)
+}
+
+// jsonV2 returns `gl` the way that it is represented in the version 2
+// JSON output, with camelCase names.
+func (gl *GitLimitations) jsonV2() interface{} {
+	type unavailableGitFeature struct {
+		Name      string `json:"name"`
+		Since     string `json:"since"`
+		NeededFor string `json:"neededFor"`
+	}
+	unavailable := make([]unavailableGitFeature, len(gl.Unavailable))
+	for i, f := range gl.Unavailable {
+		unavailable[i] = unavailableGitFeature(f)
+	}
+	return struct {
+		Version     string                  `json:"version"`
+		Path        string                  `json:"path"`
+		Unavailable []unavailableGitFeature `json:"unavailable"`
+	}{
+		Version:     gl.Version,
+		Path:        gl.Path,
+		Unavailable: unavailable,
+	}
+}
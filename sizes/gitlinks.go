@@ -0,0 +1,186 @@
+package sizes
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/github/git-sizer/counts"
+	"github.com/github/git-sizer/git"
+)
+
+// MaxGitlinkProblemsListed is the maximum number of problems that are
+// listed in `GitlinkCheck.Problems`. Additional problems are only
+// counted.
+const MaxGitlinkProblemsListed = 20
+
+// GitlinkProblem is an inconsistency between the gitlinks (submodule
+// entries) in the tree of a branch tip and its `.gitmodules` file.
+type GitlinkProblem struct {
+	// Refname is the branch at whose tip the problem was found (the
+	// first one, if there are several).
+	Refname string `json:"refname"`
+
+	// Path is the path of the gitlink or submodule.
+	Path string `json:"path"`
+
+	// Problem describes what is wrong.
+	Problem string `json:"problem"`
+}
+
+// GitlinkCheck summarizes the problems that `CheckGitlinks()` found.
+type GitlinkCheck struct {
+	// BranchCount is the number of branches that were checked.
+	BranchCount counts.Count32 `json:"branch_count"`
+
+	// Count is the number of distinct problems found. At most
+	// `MaxGitlinkProblemsListed` of them are listed in Problems.
+	Count    counts.Count32   `json:"count"`
+	Problems []GitlinkProblem `json:"problems"`
+}
+
+const (
+	gitlinkNotInGitmodules = "gitlink is not listed in .gitmodules"
+	gitmodulesNotInTree    = "listed in .gitmodules, but there is no gitlink in the tree"
+)
+
+// CheckGitlinks compares the gitlinks in the tree at the tip of each
+// branch (i.e., each reference under `refs/heads/` that `rg` selects
+// for walking) with the submodules configured in that tree's
+// `.gitmodules` file. Gitlinks that have no `.gitmodules` entry
+// (often left over from incompletely-removed submodules, which
+// breaks checkouts) and `.gitmodules` entries with no corresponding
+// gitlink are reported. A problem that occurs at the tips of several
+// branches is reported only once.
+func CheckGitlinks(
+	ctx context.Context, repo *git.Repository, rg RefGrouper,
+) (*GitlinkCheck, error) {
+	refs, err := walkedReferences(ctx, repo, rg)
+	if err != nil {
+		return nil, err
+	}
+
+	var branches []git.Reference
+	for _, ref := range refs {
+		if strings.HasPrefix(ref.Refname, "refs/heads/") && ref.ObjectType == "commit" {
+			branches = append(branches, ref)
+		}
+	}
+
+	var gc GitlinkCheck
+	seenCommits := make(map[git.OID]bool)
+	seenProblems := make(map[GitlinkProblem]bool)
+	record := func(refname, path, problem string) {
+		key := GitlinkProblem{Path: path, Problem: problem}
+		if seenProblems[key] {
+			return
+		}
+		seenProblems[key] = true
+		gc.Count.Increment(1)
+		if len(gc.Problems) < MaxGitlinkProblemsListed {
+			key.Refname = refname
+			gc.Problems = append(gc.Problems, key)
+		}
+	}
+
+	for _, branch := range branches {
+		gc.BranchCount.Increment(1)
+		if seenCommits[branch.OID] {
+			continue
+		}
+		seenCommits[branch.OID] = true
+
+		rev := branch.OID.String()
+		configured := make(map[string]bool)
+		names, err := repo.SubmoduleNames(rev)
+		if err != nil {
+			record(branch.Refname, ".gitmodules", fmt.Sprintf("could not be parsed: %s", err))
+		}
+		for path := range names {
+			configured[path] = true
+		}
+
+		gitlinks := make(map[string]bool)
+		if err := repo.ForEachGitlink(
+			ctx, rev,
+			func(path string, _ git.OID) error {
+				gitlinks[path] = true
+				return nil
+			},
+		); err != nil {
+			return nil, fmt.Errorf("listing gitlinks in '%s': %w", git.DisplayString(branch.Refname), err)
+		}
+
+		for _, path := range sortedKeys(gitlinks) {
+			if !configured[path] {
+				record(branch.Refname, path, gitlinkNotInGitmodules)
+			}
+		}
+		for _, path := range sortedKeys(configured) {
+			if !gitlinks[path] {
+				record(branch.Refname, path, gitmodulesNotInTree)
+			}
+		}
+	}
+
+	if gc.Problems == nil {
+		gc.Problems = []GitlinkProblem{}
+	}
+	return &gc, nil
+}
+
+// sortedKeys returns the keys of `m`, sorted.
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// jsonV2 returns `gc` the way that it is represented in the version 2
+// JSON output, with camelCase names.
+func (gc *GitlinkCheck) jsonV2() interface{} {
+	return struct {
+		BranchCount counts.Count32   `json:"branchCount"`
+		Count       counts.Count32   `json:"count"`
+		Problems    []GitlinkProblem `json:"problems"`
+	}(*gc)
+}
+
+// String returns a human-readable list of the problems found.
+func (gc *GitlinkCheck) String() string {
+	if gc == nil {
+		return ""
+	}
+
+	buf := &bytes.Buffer{}
+	if gc.Count == 0 {
+		fmt.Fprintf(
+			buf, "\nGitlinks match .gitmodules at the tips of all %d branch(es)\n",
+			gc.BranchCount,
+		)
+		return buf.String()
+	}
+
+	fmt.Fprintf(
+		buf, "\nGitlinks that don't match .gitmodules at branch tips (%d problem(s)):\n\n",
+		gc.Count,
+	)
+	for _, p := range gc.Problems {
+		fmt.Fprintf(
+			buf, "    %s: %s\n        %s\n",
+			git.DisplayString(p.Refname), git.DisplayString(p.Path), p.Problem,
+		)
+	}
+	if gc.Count > counts.Count32(len(gc.Problems)) {
+		fmt.Fprintf(
+			buf, "    (%d more not listed)\n",
+			uint64(gc.Count)-uint64(len(gc.Problems)),
+		)
+	}
+	return buf.String()
+}
@@ -2,9 +2,14 @@ package sizes
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"os"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/github/git-sizer/counts"
 	"github.com/github/git-sizer/git"
@@ -49,56 +54,568 @@ type RefGrouper interface {
 	Groups() []RefGroup
 }
 
+// walkedReferences returns the references in `repo` that `rg` selects
+// for walking, in the order that Git lists them, skipping any that
+// point at missing objects. If `rg` is nil, all of the references are
+// returned.
+func walkedReferences(
+	ctx context.Context, repo *git.Repository, rg RefGrouper,
+) ([]git.Reference, error) {
+	refIter, err := repo.NewReferenceIter(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var refs []git.Reference
+	for {
+		ref, ok, err := refIter.Next()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return refs, nil
+		}
+		if ref.ObjectType == "missing" {
+			continue
+		}
+		if rg != nil {
+			if walk, _ := rg.Categorize(ref.Refname); !walk {
+				continue
+			}
+		}
+		refs = append(refs, ref)
+	}
+}
+
 type refSeen struct {
 	git.Reference
 	walked bool
 	groups []RefGroupSymbol
 }
 
+// ScanOptions holds optional settings that affect how a repository
+// is scanned. The zero value gives the default behavior.
+type ScanOptions struct {
+	// Strict causes the scan to fail as soon as an object is found
+	// that is missing or can't be parsed. Otherwise, such objects
+	// are recorded in `HistorySize.Errors` and skipped.
+	Strict bool
+
+	// SampleRate, if strictly between 0 and 1, causes only that
+	// fraction of commits (chosen at random) to be scanned, and the
+	// commit statistics to be extrapolated from them. See
+	// `SampleInfo` for how precise the results are. Otherwise, all
+	// commits are scanned.
+	SampleRate float64
+
+	// SampleSeed seeds the pseudorandom number generator that
+	// chooses the commits to scan with `SampleRate`.
+	SampleSeed int64
+
+	// TopTrees, if positive, is the number of trees with the most
+	// entries to list in `HistorySize.WidestTrees`, along with their
+	// paths (if names are being computed).
+	TopTrees int
+
+	// TopBlobs, if positive, is the number of top-ranked blobs to
+	// list in `HistorySize.TopBlobs`, along with their paths (if
+	// names are being computed). TopBlobsBy is how they are ranked;
+	// it defaults to `BlobOrderSize`.
+	TopBlobs   int
+	TopBlobsBy BlobOrder
+
+	// NamesPerMetric, if greater than one, is the number of objects
+	// to name for each statistic that has a footnote (e.g., the N
+	// largest blobs for "maxBlobSize"), in order of decreasing value
+	// and then of increasing OID. Otherwise, just one object is named,
+	// as recorded along with the statistic.
+	NamesPerMetric int
+
+	// BlobSizeLimit, if positive, causes the blobs that are larger
+	// than that many bytes to be counted, in
+	// `HistorySize.OversizedBlobs`.
+	BlobSizeLimit uint64
+
+	// BigFileThreshold, if positive, causes the blobs that are
+	// larger than that many bytes to be counted, in
+	// `HistorySize.BigFiles`. It is meant to be Git's
+	// `core.bigFileThreshold`.
+	BigFileThreshold uint64
+
+	// RememberOversizedBlobs causes the OIDs and sizes of the blobs
+	// counted in `HistorySize.OversizedBlobs` to be kept, so that
+	// they can be listed by `WriteBlobManifest()`.
+	RememberOversizedBlobs bool
+
+	// LookupOIDs lists objects to be described after the scan (see
+	// `HistorySize.ObjectLookups`).
+	LookupOIDs []git.OID
+
+	// Histograms causes the distributions of some quantities to be
+	// collected, in `HistorySize.BlobSizeHistogram`,
+	// `TreeEntriesHistogram`, and `PathDepthHistogram`.
+	Histograms bool
+
+	// DiffCommits causes the tree of each commit to be compared with
+	// that of its first parent, to compute `HistorySize.CommitDiffs`.
+	// This is relatively expensive.
+	DiffCommits bool
+
+	// PersistenceWeighted causes the size of each blob, multiplied by
+	// the number of scanned commits that contain it, to be totaled
+	// in `HistorySize.PersistenceWeighted`.
+	PersistenceWeighted bool
+
+	// CommitterDomains causes the scanned commits to be counted by
+	// the domain of their committer's email address, in
+	// `HistorySize.CommitterDomains`.
+	CommitterDomains bool
+
+	// DOT, if set, is where the graph of the scanned commits is
+	// written in Graphviz DOT format. If `DiffCommits` is also set,
+	// the commits are labeled with the number of bytes of new blobs
+	// that they introduced (see `CommitDiffs`).
+	DOT io.Writer `json:"-"`
+
+	// DOTLimit, if positive, is the most commits that can be
+	// exported to `DOT`. If there are more, the scan fails early
+	// rather than producing an unusably large graph.
+	DOTLimit int
+
+	// SQL, if set, is where SQL statements are written that fill an
+	// SQLite database with an inventory of the scanned objects,
+	// commits, and walked references (see `sqlSchema`). If
+	// `SQLTreeEntries` is also set, every entry of every tree is
+	// recorded, too, which can take a lot of space.
+	SQL            io.Writer `json:"-"`
+	SQLTreeEntries bool
+
+	// Roots, if non-empty, are the objects at which to start the
+	// walk, instead of the references that the `RefGrouper` selects.
+	// All of the references are still counted. Each root's `Refname`
+	// (which needn't be a real reference name) is used to name the
+	// objects found via it.
+	Roots []git.Reference
+
+	// PathRules, if non-empty, limits the blob and tree statistics to
+	// the objects that are reachable via tree entries at the paths
+	// that the rules select (see `PathRule`) in the commits that are
+	// scanned. An object that is also reachable via other selected
+	// paths still counts. The other statistics are unaffected.
+	PathRules []PathRule
+
+	// IntroducedSince, if non-zero, limits the blob and tree
+	// statistics to the objects that were first introduced by commits
+	// (among those scanned) whose committer date is after it; i.e.,
+	// objects that are also reachable from an older commit are left
+	// out. It can be combined with `PathRules`. The other statistics
+	// are unaffected.
+	IntroducedSince time.Time
+
+	// Exclude lists commits whose history is left out of the walk,
+	// like `git rev-list --not`. Objects that are only reachable from
+	// those commits are treated as empty, so statistics about whole
+	// checkouts only include what was scanned. It can't be combined
+	// with `SampleRate`.
+	Exclude []git.OID
+
+	// FirstParent, if set, restricts the walk to the first parents
+	// of the commits reachable from the references (like `git
+	// rev-list --first-parent`), so that only the "mainline" history
+	// and the trees and blobs of its commits are scanned. The history
+	// depth then counts the commits along it. It can't be combined
+	// with `SampleRate`.
+	FirstParent bool
+
+	// MaxCommits, if positive, makes this a quick scan: only the
+	// trees of (up to) that many of the newest commits, found by
+	// walking back from all of the references at once, are scanned.
+	// Annotated tags aren't scanned. The commit count is still exact
+	// (using `git rev-list --count`), but the other totals are
+	// extrapolated from what was scanned, using the number of objects
+	// in the repository, and maxima are only lower bounds; see
+	// `HistorySize.QuickScan`. It can't be combined with `SampleRate`
+	// or `Exclude`.
+	MaxCommits int
+
+	// Checkpoint, if set, is the name of a file in which the list of
+	// objects to scan is saved once `git rev-list` has produced it.
+	// If the scan is interrupted after that, a later scan with the
+	// same `Checkpoint` resumes from the saved list rather than
+	// walking the history again, provided that it has the same
+	// options, the references haven't changed, and the file was
+	// written by the same `CheckpointVersion` of git-sizer. The file
+	// is removed when the scan completes. It can't be combined with
+	// `SampleRate` or `MaxCommits`.
+	Checkpoint        string `json:"-"`
+	CheckpointVersion string `json:"-"`
+
+	// MemoryLimit, if positive, is roughly how many bytes of memory
+	// may be used for the tables that grow with the number of objects
+	// in the history: the sizes of the blobs, trees, and commits, the
+	// tree of each commit, the number of references to each blob,
+	// and the blobs that `DiffCommits` has credited. It is shared
+	// among them. Entries that don't fit are spilled to temporary
+	// files, which makes looking them up much slower. Below the
+	// limit, the scan runs entirely in memory, as usual.
+	// `HistorySize.SpilledRuns` tells whether anything was spilled.
+	//
+	// The trees that are waiting for their entries, the blob
+	// manifest's oversized blobs, and the objects whose paths are
+	// being sought still stay in memory. They are bounded by the
+	// width of the history and by what is being reported rather than
+	// by its size.
+	MemoryLimit uint64
+
+	// Snapshot, if set, is called every `SnapshotInterval` (or every
+	// second, if that is zero) while the scan is running, with the
+	// statistics gathered so far. Trees and tags whose sizes haven't
+	// been finalized yet are left out. The graph is locked while
+	// `Snapshot` runs, so it should be quick, and it must not keep
+	// the `HistorySize` (which shares data with the scan) or render
+	// the names of any paths.
+	Snapshot         func(HistorySize) `json:"-"`
+	SnapshotInterval time.Duration     `json:"-"`
+}
+
+// sampling returns true iff `opts` requests a sampled scan.
+func (opts ScanOptions) sampling() bool {
+	return opts.SampleRate > 0 && opts.SampleRate < 1
+}
+
+// quickScan returns true iff `opts` requests a quick scan.
+func (opts ScanOptions) quickScan() bool {
+	return opts.MaxCommits > 0
+}
+
+// choosesCommits returns true iff the commits to be scanned are
+// chosen up front (see `SampleRate` and `MaxCommits`), in which case
+// only their trees are walked and their parents aren't available.
+func (opts ScanOptions) choosesCommits() bool {
+	return opts.sampling() || opts.quickScan()
+}
+
 // ScanRepositoryUsingGraph scans `repo`, using `rg` to decide which
 // references to scan and how to group them. `nameStyle` specifies
 // whether the output should include full names, hashes only, or
 // nothing in the footnotes. `progress` tells whether a progress meter
-// should be displayed while it works.
+// should be displayed while it works. `opts` holds any other
+// settings.
 //
 // It returns the size data for the repository.
+//
+// Unless `opts.Strict` is set, objects that are missing or can't be
+// parsed are skipped, so the results might be incomplete if
+// `HistorySize.Errors` is non-nil. (Corruption that prevents `git
+// rev-list` itself from traversing the history is still fatal.)
 func ScanRepositoryUsingGraph(
 	repo *git.Repository, rg RefGrouper, nameStyle NameStyle,
-	progressMeter meter.Progress,
+	progressMeter meter.Progress, opts ScanOptions,
 ) (HistorySize, error) {
-	ctx, cancel := context.WithCancel(context.TODO())
-	defer cancel()
+	return ScanRepositoryUsingGraphContext(
+		context.Background(), repo, rg, nameStyle, progressMeter, opts,
+	)
+}
+
+// ScanRepositoryUsingGraphContext is like `ScanRepositoryUsingGraph`,
+// except that the scan is stopped if `ctx` is cancelled. In that case,
+// it returns `ctx.Err()` along with whatever statistics had been
+// gathered so far, with `HistorySize.Partial` set.
+func ScanRepositoryUsingGraphContext(
+	ctx context.Context,
+	repo *git.Repository, rg RefGrouper, nameStyle NameStyle,
+	progressMeter meter.Progress, opts ScanOptions,
+) (HistorySize, error) {
+	if opts.sampling() && len(opts.Exclude) != 0 {
+		return HistorySize{}, errors.New("excluded commits can't be combined with sampling")
+	}
+	if opts.sampling() && opts.FirstParent {
+		return HistorySize{}, errors.New("a first-parent scan can't be combined with sampling")
+	}
+	if opts.quickScan() && (opts.sampling() || len(opts.Exclude) != 0) {
+		return HistorySize{}, errors.New(
+			"a quick scan can't be combined with sampling or excluded commits",
+		)
+	}
+	if opts.Checkpoint != "" && opts.choosesCommits() {
+		return HistorySize{}, errors.New(
+			"a checkpoint can't be combined with sampling or a quick scan",
+		)
+	}
 
 	graph := NewGraph(rg, nameStyle)
+	defer graph.closeStores()
+	pm := &phaseMeter{Progress: progressMeter}
+	historySize, err := scanRepository(ctx, graph, repo, rg, nameStyle, pm, opts)
+	if err != nil && ctx.Err() != nil {
+		// Whatever error we got was most likely caused by the
+		// cancellation (e.g., a `git` subprocess being killed).
+		pm.stop()
+		return graph.partialHistorySize(), ctx.Err()
+	}
+	return historySize, err
+}
+
+// phaseMeter is a `meter.Progress` that remembers whether a phase of
+// the scan is in progress, so that the meter can be stopped if the
+// scan is interrupted partway through.
+type phaseMeter struct {
+	meter.Progress
+	running bool
+}
+
+func (pm *phaseMeter) Start(format string) {
+	pm.Progress.Start(format)
+	pm.running = true
+}
+
+func (pm *phaseMeter) Done() {
+	pm.Progress.Done()
+	pm.running = false
+}
+
+func (pm *phaseMeter) DoneWithSummary(summary string) {
+	pm.Progress.DoneWithSummary(summary)
+	pm.running = false
+}
+
+// stop stops the meter if a phase is in progress.
+func (pm *phaseMeter) stop() {
+	if pm.running {
+		pm.Done()
+	}
+}
+
+// scanRepository does the work of `ScanRepositoryUsingGraphContext()`,
+// recording the objects that it finds in `graph`.
+func scanRepository(
+	ctx context.Context, graph *Graph,
+	repo *git.Repository, rg RefGrouper, nameStyle NameStyle,
+	progressMeter meter.Progress, opts ScanOptions,
+) (HistorySize, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	graph.ignoreParents = opts.choosesCommits()
+	graph.partialHistory = len(opts.Exclude) != 0
+	graph.firstParent = opts.FirstParent
+	if len(opts.Roots) != 0 || len(opts.PathRules) != 0 || !opts.IntroducedSince.IsZero() ||
+		opts.FirstParent {
+		scope := ScanScope{
+			Exclude:     opts.Exclude,
+			PathRules:   opts.PathRules,
+			FirstParent: opts.FirstParent,
+		}
+		for _, root := range opts.Roots {
+			scope.Roots = append(scope.Roots, root.Refname)
+		}
+		if !opts.IntroducedSince.IsZero() {
+			since := opts.IntroducedSince
+			scope.IntroducedSince = &since
+		}
+		graph.historySize.Scope = &scope
+	}
+	graph.topTrees = newTopTrees(opts.TopTrees)
+	graph.metricExamples = newMetricExamples(opts.NamesPerMetric)
+	if opts.TopBlobs > 0 {
+		by := opts.TopBlobsBy
+		if by == "" {
+			by = BlobOrderSize
+		}
+		graph.topBlobs = newTopBlobs(opts.TopBlobs, by)
+	}
+	if opts.BlobSizeLimit > 0 {
+		graph.historySize.OversizedBlobs = &OversizedBlobs{
+			Limit: counts.Count64(opts.BlobSizeLimit),
+		}
+		if opts.RememberOversizedBlobs {
+			graph.historySize.OversizedBlobs.blobs = make(map[git.OID]counts.Count32)
+		}
+	}
+	if opts.BigFileThreshold > 0 {
+		graph.historySize.BigFiles = &OversizedBlobs{
+			Limit: counts.Count64(opts.BigFileThreshold),
+		}
+	}
+	if opts.Histograms {
+		graph.historySize.BlobSizeHistogram = newHistogram(blobSizeBounds)
+		graph.historySize.TreeEntriesHistogram = newHistogram(treeEntryBounds)
+		graph.historySize.PathDepthHistogram = newHistogram(pathDepthBounds)
+	}
+	if opts.DiffCommits {
+		graph.historySize.CommitDiffs = newCommitDiffs()
+		graph.creditedBlobs = newOIDSetStore("credited blobs")
+	}
+	graph.setMemoryLimit(opts.MemoryLimit)
+	if opts.PersistenceWeighted {
+		graph.historySize.PersistenceWeighted = &PersistenceWeightedSize{}
+	}
+	if opts.CommitterDomains {
+		graph.historySize.CommitterDomains = newCommitterDomains()
+	}
+	if opts.DOT != nil {
+		graph.dot = &dotGraph{}
+	}
+	var sqlOut *sqlExport
+	if opts.SQL != nil {
+		sqlOut = newSQLExport(opts.SQL, opts.SQLTreeEntries)
+	}
+	if len(opts.LookupOIDs) != 0 {
+		if err := graph.startObjectLookups(ctx, repo, opts.LookupOIDs); err != nil {
+			return HistorySize{}, err
+		}
+	}
+
+	// Snapshots are only taken while the objects are being read,
+	// after the graph has been set up and before the results are
+	// finalized.
+	stopSnapshots := func() {}
+	if opts.Snapshot != nil {
+		interval := opts.SnapshotInterval
+		if interval <= 0 {
+			interval = time.Second
+		}
+		stopSnapshots = graph.startSnapshots(opts.Snapshot, interval)
+	}
+	defer stopSnapshots()
+
+	// skip records that the object with the specified `oid` couldn't
+	// be read or parsed, or fails if we are in strict mode:
+	skip := func(oid git.OID, objectType git.ObjectType, err error) error {
+		if opts.Strict {
+			return err
+		}
+		graph.RegisterSkippedObject(oid, objectType, err)
+		return nil
+	}
+
+	// skipUnexpected is like `skip`, for an object that `git
+	// cat-file` reported with a type other than `expected`:
+	skipUnexpected := func(oid git.OID, objectType, expected git.ObjectType) error {
+		if objectType == "missing" {
+			return skip(oid, "", errors.New("object is missing"))
+		}
+		return skip(oid, expected, fmt.Errorf("expected %s; read %#v", expected, objectType))
+	}
 
 	refIter, err := repo.NewReferenceIter(ctx)
 	if err != nil {
 		return HistorySize{}, err
 	}
 
-	objIter, err := repo.NewObjectIter(context.TODO())
-	if err != nil {
-		return HistorySize{}, err
+	var revListArgs []string
+	if !opts.Strict {
+		revListArgs = append(revListArgs, "--missing=print")
+	}
+	if opts.choosesCommits() {
+		// Only walk the trees of the commits that we feed in, not
+		// their ancestors:
+		revListArgs = append(revListArgs, "--no-walk=unsorted")
+	}
+	if opts.FirstParent {
+		revListArgs = append(revListArgs, "--first-parent")
+	}
+	for _, oid := range opts.Exclude {
+		revListArgs = append(revListArgs, "^"+oid.String())
+	}
+
+	// If there is a checkpoint from an earlier run, the objects are
+	// read from it rather than from `git rev-list`. Otherwise, if
+	// requested, the objects are recorded for a checkpoint as they
+	// are listed:
+	var objIter interface {
+		AddRoot(oid git.OID) error
+		Close()
+		Next() (git.BatchHeader, bool, error)
+	}
+	var checkpointIn *checkpointReader
+	var checkpointOut *checkpointWriter
+	var checkpointOpts json.RawMessage
+	if opts.Checkpoint != "" {
+		checkpointOpts, err = checkpointOptions(opts, nameStyle)
+		if err != nil {
+			return HistorySize{}, err
+		}
+		checkpointIn, err = openCheckpoint(opts.Checkpoint, opts.CheckpointVersion, checkpointOpts)
+		if err != nil {
+			return HistorySize{}, err
+		}
+	}
+	if checkpointIn != nil {
+		defer checkpointIn.closeFile()
+		objIter = checkpointIn
+	} else {
+		objIter, err = repo.NewObjectIter(ctx, revListArgs...)
+		if err != nil {
+			return HistorySize{}, err
+		}
+		if opts.Checkpoint != "" {
+			checkpointOut, err = newCheckpointWriter(opts.Checkpoint)
+			if err != nil {
+				return HistorySize{}, err
+			}
+			defer checkpointOut.abort()
+		}
 	}
 
 	errChan := make(chan error, 1)
 	var refsSeen []refSeen
+	var sample *commitSample
+	var quick *QuickScanInfo
+
+	// Enumerating the references is a phase of its own, because with
+	// very many of them it can take a while before `git rev-list`
+	// outputs anything. `refsEnumerated` is closed when it is over
+	// (whether or not it succeeded), after which `refCount` and
+	// `includedRefCount` can be read.
+	var refCount, includedRefCount int
+	refsEnumerated := make(chan struct{})
+	var enumerated sync.Once
+	endEnumeration := func() {
+		enumerated.Do(func() { close(refsEnumerated) })
+	}
+	progressMeter.Start("Enumerating references: %d")
+
 	// Feed the references that we want into the stdin of the object
-	// iterator:
+	// iterator. If we are sampling or doing a quick scan, then feed
+	// it the chosen commits instead of the commits that the
+	// references point at:
 	go func() {
 		defer objIter.Close()
+		defer endEnumeration()
 
 		errChan <- func() error {
+			var commitRoots []git.OID
+			var brokenRefs []string
 			for {
 				ref, ok, err := refIter.Next()
 				if err != nil {
 					return err
 				}
 				if !ok {
-					return nil
+					break
 				}
+				progressMeter.Inc()
+				refCount++
 
 				walk, groups := rg.Categorize(ref.Refname)
+				if len(opts.Roots) != 0 {
+					walk = false
+				}
+
+				if walk && ref.ObjectType == "missing" {
+					// Don't try to walk a reference whose object
+					// doesn't exist:
+					if opts.Strict {
+						brokenRefs = append(
+							brokenRefs,
+							fmt.Sprintf("%s -> %s", git.DisplayString(ref.Refname), ref.OID),
+						)
+					} else {
+						graph.RegisterBrokenReference(ref)
+					}
+					continue
+				}
 
 				refsSeen = append(
 					refsSeen,
@@ -112,11 +629,79 @@ func ScanRepositoryUsingGraph(
 				if !walk {
 					continue
 				}
+				includedRefCount++
+
+				if opts.choosesCommits() && (ref.ObjectType == "commit" || ref.ObjectType == "tag") {
+					commitRoots = append(commitRoots, ref.OID)
+					if ref.ObjectType == "commit" || opts.quickScan() {
+						continue
+					}
+				}
 
 				if err := objIter.AddRoot(ref.OID); err != nil {
 					return err
 				}
 			}
+			endEnumeration()
+
+			if len(brokenRefs) != 0 {
+				return fmt.Errorf(
+					"%d reference(s) point at missing objects:\n    %s",
+					len(brokenRefs), strings.Join(brokenRefs, "\n    "),
+				)
+			}
+
+			for _, root := range opts.Roots {
+				if opts.choosesCommits() && (root.ObjectType == "commit" || root.ObjectType == "tag") {
+					commitRoots = append(commitRoots, root.OID)
+					if root.ObjectType == "commit" || opts.quickScan() {
+						continue
+					}
+				}
+
+				if err := objIter.AddRoot(root.OID); err != nil {
+					return err
+				}
+			}
+
+			if opts.quickScan() {
+				count, err := repo.CountCommits(ctx, commitRoots, opts.FirstParent)
+				if err != nil {
+					return err
+				}
+				newest, err := repo.NewestCommits(
+					ctx, commitRoots, opts.MaxCommits, opts.FirstParent,
+				)
+				if err != nil {
+					return err
+				}
+				quick = &QuickScanInfo{
+					MaxCommits:  opts.MaxCommits,
+					CommitCount: counts.NewCount32(count),
+				}
+				for _, oid := range newest {
+					if err := objIter.AddRoot(oid); err != nil {
+						return err
+					}
+				}
+				return nil
+			}
+
+			if !opts.sampling() {
+				return nil
+			}
+
+			var err error
+			sample, err = sampleCommits(ctx, repo, commitRoots, opts.SampleRate, opts.SampleSeed)
+			if err != nil {
+				return err
+			}
+			for _, oid := range sample.sampled {
+				if err := objIter.AddRoot(oid); err != nil {
+					return err
+				}
+			}
+			return nil
 		}()
 	}()
 
@@ -174,6 +759,23 @@ func ScanRepositoryUsingGraph(
 	var trees, tags []ObjectHeader
 	var commits []CommitHeader
 
+	// If `opts.PathRules` or `opts.IntroducedSince` is set, the blobs
+	// can't be registered until we know which of them are in scope:
+	var blobs []ObjectHeader
+	deferBlobs := len(opts.PathRules) != 0 || !opts.IntroducedSince.IsZero()
+
+	// The commits to be diffed against their first parents, if
+	// `opts.DiffCommits` is set:
+	var commitParents []git.CommitParent
+
+	// The number of objects listed, for extrapolating a quick scan:
+	var objectCount uint64
+
+	<-refsEnumerated
+	progressMeter.DoneWithSummary(
+		fmt.Sprintf("Enumerating references: %d of %d included", includedRefCount, refCount),
+	)
+
 	progressMeter.Start("Processing blobs: %d")
 	for {
 		obj, ok, err := objIter.Next()
@@ -183,9 +785,25 @@ func ScanRepositoryUsingGraph(
 		if !ok {
 			break
 		}
+		objectCount++
+		if checkpointOut != nil {
+			if err := checkpointOut.add(obj); err != nil {
+				return HistorySize{}, err
+			}
+		}
+		if sqlOut != nil {
+			switch obj.ObjectType {
+			case "blob", "tree", "commit", "tag":
+				sqlOut.addObject(obj.OID, obj.ObjectType, obj.ObjectSize)
+			}
+		}
 		switch obj.ObjectType {
 		case "blob":
 			progressMeter.Inc()
+			if deferBlobs {
+				blobs = append(blobs, ObjectHeader{obj.OID, obj.ObjectSize})
+				continue
+			}
 			graph.RegisterBlob(obj.OID, obj.ObjectSize)
 		case "tree":
 			trees = append(trees, ObjectHeader{obj.OID, obj.ObjectSize})
@@ -193,8 +811,17 @@ func ScanRepositoryUsingGraph(
 			commits = append(commits, CommitHeader{ObjectHeader{obj.OID, obj.ObjectSize}, git.NullOID})
 		case "tag":
 			tags = append(tags, ObjectHeader{obj.OID, obj.ObjectSize})
+		case "missing":
+			if err := skip(obj.OID, "", errors.New("object is missing")); err != nil {
+				return HistorySize{}, err
+			}
 		default:
-			return HistorySize{}, fmt.Errorf("unexpected object type: %s", obj.ObjectType)
+			if err := skip(
+				obj.OID, obj.ObjectType,
+				fmt.Errorf("unexpected object type: %s", obj.ObjectType),
+			); err != nil {
+				return HistorySize{}, err
+			}
 		}
 	}
 	progressMeter.Done()
@@ -204,6 +831,62 @@ func ScanRepositoryUsingGraph(
 		return HistorySize{}, err
 	}
 
+	switch {
+	case checkpointIn != nil:
+		if err := checkpointIn.checkRefs(refsSeen); err != nil {
+			return HistorySize{}, err
+		}
+	case checkpointOut != nil:
+		if err := checkpointOut.finish(opts.CheckpointVersion, checkpointOpts, refsSeen); err != nil {
+			return HistorySize{}, err
+		}
+	}
+
+	if deferBlobs {
+		commitOIDs := make([]git.OID, len(commits))
+		for i, commit := range commits {
+			commitOIDs[i] = commit.oid
+		}
+		if len(opts.PathRules) != 0 {
+			progressMeter.Start("Finding objects under paths: %d")
+			graph.pathScope, err = findPathScope(ctx, repo, commitOIDs, opts.PathRules, progressMeter)
+			progressMeter.Done()
+			if err != nil {
+				return HistorySize{}, err
+			}
+		}
+		if !opts.IntroducedSince.IsZero() {
+			graph.sinceScope = make(map[git.OID]struct{})
+			progressMeter.Start("Finding objects introduced since the date: %d")
+			err = repo.ForEachObjectIntroducedSince(
+				ctx, commitOIDs, opts.IntroducedSince,
+				func(oid git.OID) error {
+					progressMeter.Inc()
+					graph.sinceScope[oid] = struct{}{}
+					return nil
+				},
+			)
+			progressMeter.Done()
+			if err != nil {
+				return HistorySize{}, err
+			}
+		}
+
+		for _, blob := range blobs {
+			graph.RegisterBlob(blob.oid, blob.objectSize)
+		}
+	}
+	if err := graph.storeErr(); err != nil {
+		return HistorySize{}, err
+	}
+
+	if opts.DOT != nil && opts.DOTLimit > 0 && len(commits) > opts.DOTLimit {
+		return HistorySize{}, fmt.Errorf(
+			"too many commits to export as DOT (%d; the limit is %d)",
+			len(commits), opts.DOTLimit,
+		)
+	}
+
 	objectIter, err := repo.NewBatchObjectIter(ctx)
 	if err != nil {
 		return HistorySize{}, err
@@ -245,21 +928,40 @@ func ScanRepositoryUsingGraph(
 		if !ok {
 			return HistorySize{}, errors.New("fewer trees read than expected")
 		}
+		progressMeter.Inc()
 		if obj.ObjectType != "tree" {
-			return HistorySize{}, fmt.Errorf("expected tree; read %#v", obj.ObjectType)
+			if err := skipUnexpected(obj.OID, obj.ObjectType, "tree"); err != nil {
+				return HistorySize{}, err
+			}
+			continue
 		}
-		progressMeter.Inc()
 		tree, err := git.ParseTree(obj.OID, obj.Data)
 		if err != nil {
-			return HistorySize{}, err
+			if err := skip(obj.OID, "tree", err); err != nil {
+				return HistorySize{}, err
+			}
+			continue
+		}
+		if sqlOut != nil {
+			sqlOut.addTree(obj.OID, tree)
 		}
 		err = graph.RegisterTree(obj.OID, tree)
 		if err != nil {
+			// The entries that could be read have been counted, but
+			// the rest of the tree is lost:
+			if !opts.Strict {
+				graph.RecordCorruptObject(obj.OID, "tree", err)
+				continue
+			}
 			return HistorySize{}, err
 		}
 	}
 	progressMeter.Done()
 
+	if graph.partialHistory {
+		graph.registerExcludedTrees()
+	}
+
 	// Process the commits in (roughly) chronological order, to
 	// minimize the number of commits that are pending at any one
 	// time:
@@ -272,19 +974,40 @@ func ScanRepositoryUsingGraph(
 		if !ok {
 			return HistorySize{}, errors.New("fewer commits read than expected")
 		}
+		if obj.OID != commits[i-1].oid {
+			panic("commits not read in same order as requested")
+		}
 		if obj.ObjectType != "commit" {
-			return HistorySize{}, fmt.Errorf("expected commit; read %#v", obj.ObjectType)
+			if err := skipUnexpected(obj.OID, obj.ObjectType, "commit"); err != nil {
+				return HistorySize{}, err
+			}
+			progressMeter.Inc()
+			continue
 		}
 		commit, err := git.ParseCommit(obj.OID, obj.Data)
 		if err != nil {
-			return HistorySize{}, err
-		}
-		if obj.OID != commits[i-1].oid {
-			panic("commits not read in same order as requested")
+			if err := skip(obj.OID, "commit", err); err != nil {
+				return HistorySize{}, err
+			}
+			progressMeter.Inc()
+			continue
 		}
 		commits[i-1].tree = commit.Tree
 		progressMeter.Inc()
 		graph.RegisterCommit(obj.OID, commit)
+		if graph.dot != nil {
+			graph.dot.addCommit(obj.OID, commit.Parents)
+		}
+		if sqlOut != nil {
+			sqlOut.addCommit(obj.OID, commit)
+		}
+		if opts.DiffCommits {
+			cp := git.CommitParent{Commit: obj.OID}
+			if len(commit.Parents) != 0 {
+				cp.Parent = commit.Parents[0]
+			}
+			commitParents = append(commitParents, cp)
+		}
 	}
 	progressMeter.Done()
 
@@ -294,6 +1017,10 @@ func ScanRepositoryUsingGraph(
 		progressMeter.Start("Matching commits to trees: %d")
 		for _, commit := range commits {
 			progressMeter.Inc()
+			if commit.tree == git.NullOID {
+				// The commit couldn't be parsed.
+				continue
+			}
 			graph.pathResolver.RecordCommit(commit.oid, commit.tree)
 		}
 		progressMeter.Done()
@@ -309,54 +1036,226 @@ func ScanRepositoryUsingGraph(
 			return HistorySize{}, errors.New("fewer tags read than expected")
 		}
 		if obj.ObjectType != "tag" {
-			return HistorySize{}, fmt.Errorf("expected tag; read %#v", obj.ObjectType)
+			if err := skipUnexpected(obj.OID, obj.ObjectType, "tag"); err != nil {
+				return HistorySize{}, err
+			}
+			progressMeter.Inc()
+			continue
 		}
 		tag, err := git.ParseTag(obj.OID, obj.Data)
 		if err != nil {
-			return HistorySize{}, err
+			if err := skip(obj.OID, "tag", err); err != nil {
+				return HistorySize{}, err
+			}
+			progressMeter.Inc()
+			continue
 		}
 		progressMeter.Inc()
 		graph.RegisterTag(obj.OID, tag)
 	}
 	progressMeter.Done()
 
+	graph.breakTagCycles()
+
 	err = <-errChan
 	if err != nil {
 		return HistorySize{}, err
 	}
 
+	// This has to happen before the references are processed, so
+	// that the `PathResolver` can name the commits that we find:
+	if opts.DiffCommits {
+		progressMeter.Start("Diffing commits: %d")
+		err := repo.ForEachCommitDiff(
+			ctx, commitParents,
+			func(oid git.OID, changes []git.TreeChange) error {
+				progressMeter.Inc()
+				graph.RegisterCommitDiff(oid, changes)
+				return nil
+			},
+		)
+		progressMeter.Done()
+		if err != nil {
+			return HistorySize{}, err
+		}
+	}
+
 	progressMeter.Start("Processing references: %d")
 	for _, refSeen := range refsSeen {
 		progressMeter.Inc()
 		graph.RegisterReference(refSeen.Reference, refSeen.walked, refSeen.groups)
+		if sqlOut != nil && refSeen.walked {
+			sqlOut.addReference(refSeen.Reference)
+		}
+	}
+	for _, root := range opts.Roots {
+		graph.pathResolver.RecordReference(root)
 	}
 	progressMeter.Done()
 
-	return graph.HistorySize(), nil
+	stopSnapshots()
+	historySize := graph.HistorySize()
+	if err := graph.storeErr(); err != nil {
+		return HistorySize{}, err
+	}
+	historySize.SpilledRuns = graph.spilledRuns()
+
+	if sample != nil {
+		commitSizes := make([]counts.Count32, len(commits))
+		for i, commit := range commits {
+			commitSizes[i] = commit.objectSize
+		}
+		historySize.extrapolateCommits(opts.SampleRate, opts.SampleSeed, sample, commitSizes)
+	}
+
+	if quick != nil {
+		stored, err := repo.StoredObjectCount()
+		if err != nil {
+			return HistorySize{}, err
+		}
+		quick.ScannedCommitCount = counts.NewCount32(uint64(len(commits)))
+		quick.ObjectCount = counts.NewCount64(stored)
+		quick.ScannedObjectCount = counts.NewCount64(objectCount)
+		historySize.extrapolateQuickScan(*quick)
+	}
+
+	packs, err := repo.Packfiles()
+	if err != nil {
+		return HistorySize{}, err
+	}
+	historySize.recordPacks(packs)
+
+	if len(opts.LookupOIDs) != 0 {
+		historySize.ObjectLookups, err = graph.finishObjectLookups(repo)
+		if err != nil {
+			return HistorySize{}, err
+		}
+	}
+
+	if graph.dot != nil {
+		if err := graph.dot.write(opts.DOT); err != nil {
+			return HistorySize{}, fmt.Errorf("writing DOT output: %w", err)
+		}
+	}
+
+	if sqlOut != nil {
+		if err := sqlOut.finish(); err != nil {
+			return HistorySize{}, fmt.Errorf("writing SQL output: %w", err)
+		}
+	}
+
+	if historySize.CommitDiffs != nil {
+		if err := historySize.CommitDiffs.describe(repo); err != nil {
+			return HistorySize{}, err
+		}
+	}
+
+	historySize.Worst = historySize.worstStatistic(rg.Groups())
+
+	if opts.Checkpoint != "" {
+		if err := os.Remove(opts.Checkpoint); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return HistorySize{}, fmt.Errorf("removing checkpoint: %w", err)
+		}
+	}
+
+	return historySize, nil
 }
 
 // Graph is an object graph that is being built up.
 type Graph struct {
 	rg RefGrouper
 
+	// ignoreParents is set if not all commits are being scanned, in
+	// which case commits' parents are not available.
+	ignoreParents bool
+
+	// partialHistory is set if the history is cut off (see
+	// `ScanOptions.Exclude`), in which case the parents of some
+	// commits are not available.
+	partialHistory bool
+
+	// firstParent is set if only the first parents of commits are
+	// being walked (see `ScanOptions.FirstParent`), in which case
+	// the other parents of merges are not available.
+	firstParent bool
+
+	// blobSizes is protected by `blobLock` while blobs are being
+	// registered. After that, it is only read.
 	blobLock  sync.Mutex
-	blobSizes map[git.OID]BlobSize
+	blobSizes *count32Store
+
+	// creditedBlobs holds the blobs that `RegisterCommitDiff()` has
+	// already credited to a commit. It is protected by `blobLock`.
+	creditedBlobs *oidSetStore
 
 	treeLock    sync.Mutex
 	treeRecords map[git.OID]*treeRecord
-	treeSizes   map[git.OID]TreeSize
+	treeSizes   *treeSizeStore
 
 	commitLock  sync.Mutex
-	commitSizes map[git.OID]CommitSize
+	commitSizes *commitSizeStore
+
+	// commitTrees holds the tree of each commit that has been
+	// registered, so that commits can be compared with their first
+	// parents. It is protected by `commitLock`.
+	commitTrees *oidStore
 
 	tagLock    sync.Mutex
 	tagRecords map[git.OID]*tagRecord
 	tagSizes   map[git.OID]TagSize
 
+	// tagReferents holds the object that each tag points at, so that
+	// references can be peeled to commits. It is protected by
+	// `tagLock`.
+	tagReferents map[git.OID]tagReferent
+
+	// commitRefCounts holds the number of walked references that
+	// resolve to each commit. It is protected by `historyLock`.
+	commitRefCounts map[git.OID]counts.Count32
+
 	// Statistics about the overall history size:
 	historyLock sync.Mutex
 	historySize HistorySize
 
+	// topTrees, if set, keeps track of the widest trees. It is
+	// protected by `historyLock`.
+	topTrees *topTrees
+
+	// metricExamples, if set, keeps track of the objects to name for
+	// each statistic. It is protected by `historyLock`.
+	metricExamples *metricExamples
+
+	// topBlobs, if set, keeps track of the top-ranked blobs, and
+	// blobRefCounts holds the number of tree entries that refer to
+	// each blob. Both are protected by `historyLock`.
+	topBlobs      *topBlobs
+	blobRefCounts *count32Store
+
+	// blobSizeSketch estimates the blob size percentiles. It is
+	// protected by `historyLock`.
+	blobSizeSketch *quantileSketch
+
+	// pathScope, if set, holds the blobs and trees that are at the
+	// paths selected by `ScanOptions.PathRules`. Only they are
+	// included in the blob and tree statistics. It isn't changed once
+	// the blobs have started to be registered.
+	pathScope map[git.OID]struct{}
+
+	// sinceScope, if set, holds the objects that were first
+	// introduced by commits dated after `ScanOptions.IntroducedSince`.
+	// Like `pathScope`, it limits the blob and tree statistics.
+	sinceScope map[git.OID]struct{}
+
+	// lookups holds the objects in `ScanOptions.LookupOIDs`.
+	lookups []objectLookup
+
+	// dot, if set, collects the commit graph for DOT output.
+	dot *dotGraph
+
+	// latestPlausibleTime is the latest commit date that isn't
+	// considered to be in the future.
+	latestPlausibleTime time.Time
+
 	pathResolver PathResolver
 }
 
@@ -365,31 +1264,173 @@ func NewGraph(rg RefGrouper, nameStyle NameStyle) *Graph {
 	return &Graph{
 		rg: rg,
 
-		blobSizes: make(map[git.OID]BlobSize),
+		blobSizes:      newCount32Store("blob sizes"),
+		blobSizeSketch: newQuantileSketch(),
+		blobRefCounts:  newCount32Store("blob reference counts"),
 
 		treeRecords: make(map[git.OID]*treeRecord),
-		treeSizes:   make(map[git.OID]TreeSize),
+		treeSizes:   newTreeSizeStore(),
+
+		commitSizes: newCommitSizeStore(),
+		commitTrees: newOIDStore("commit trees"),
 
-		commitSizes: make(map[git.OID]CommitSize),
+		tagRecords:   make(map[git.OID]*tagRecord),
+		tagSizes:     make(map[git.OID]TagSize),
+		tagReferents: make(map[git.OID]tagReferent),
 
-		tagRecords: make(map[git.OID]*tagRecord),
-		tagSizes:   make(map[git.OID]TagSize),
+		commitRefCounts: make(map[git.OID]counts.Count32),
 
 		historySize: HistorySize{
 			ReferenceGroups: make(map[RefGroupSymbol]*counts.Count32),
 		},
 
+		latestPlausibleTime: time.Now().Add(24 * time.Hour),
+
 		pathResolver: NewPathResolver(nameStyle),
 	}
 }
 
+// setMemoryLimit shares `limit` (see `ScanOptions.MemoryLimit`)
+// among the tables that can be spilled to disk.
+func (g *Graph) setMemoryLimit(limit uint64) {
+	if limit == 0 {
+		return
+	}
+	share := limit / 6
+	if share == 0 {
+		share = 1
+	}
+	g.blobSizes.setMemoryLimit(share)
+	g.blobRefCounts.setMemoryLimit(share)
+	g.treeSizes.setMemoryLimit(share)
+	g.commitSizes.setMemoryLimit(share)
+	g.commitTrees.setMemoryLimit(share)
+	if g.creditedBlobs != nil {
+		g.creditedBlobs.setMemoryLimit(share)
+	}
+}
+
+// stores returns the tables that can be spilled to disk.
+func (g *Graph) stores() []*spillStore {
+	stores := []*spillStore{
+		&g.blobSizes.spillStore,
+		&g.blobRefCounts.spillStore,
+		&g.treeSizes.spillStore,
+		&g.commitSizes.spillStore,
+		&g.commitTrees.spillStore,
+	}
+	if g.creditedBlobs != nil {
+		stores = append(stores, &g.creditedBlobs.spillStore)
+	}
+	return stores
+}
+
+// storeErr returns the first error that occurred while spilling any
+// of the tables to disk, if any.
+func (g *Graph) storeErr() error {
+	for _, s := range g.stores() {
+		if err := s.err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// spilledRuns returns the number of runs that were spilled to disk
+// for all of the tables.
+func (g *Graph) spilledRuns() int {
+	var n int
+	for _, s := range g.stores() {
+		n += s.spilledRuns
+	}
+	return n
+}
+
+// closeStores removes the temporary files that the tables were
+// spilled to, if any.
+func (g *Graph) closeStores() {
+	for _, s := range g.stores() {
+		s.close()
+	}
+}
+
+// RegisterCommitDiff records the entries that differ between the
+// tree of the commit `oid` and that of its first parent. The commit is
+// credited with the blobs that it refers to that haven't been credited
+// to another commit already. Since commits are registered parents
+// first, blobs that a merge commit takes from any of its parents have
+// always been credited already.
+func (g *Graph) RegisterCommitDiff(oid git.OID, changes []git.TreeChange) {
+	var size counts.Count64
+	g.blobLock.Lock()
+	for _, change := range changes {
+		if change.NewOID == git.NullOID || g.creditedBlobs.has(change.NewOID) {
+			continue
+		}
+		blobSize, ok := g.blobSizes.get(change.NewOID)
+		if !ok {
+			// This is a submodule, not a blob.
+			continue
+		}
+		g.creditedBlobs.add(change.NewOID)
+		size.Increment(counts.Count64(blobSize))
+	}
+	g.blobLock.Unlock()
+
+	g.historyLock.Lock()
+	g.historySize.CommitDiffs.recordCommitDiff(g, oid, changes)
+	g.historySize.CommitDiffs.recordNewBlobs(g, oid, size)
+	if g.dot != nil {
+		g.dot.setNewBytes(oid, size)
+	}
+	g.historyLock.Unlock()
+}
+
+// tagReferent is the object that a tag points at.
+type tagReferent struct {
+	oid        git.OID
+	objectType git.ObjectType
+}
+
+// peel returns the object that `oid`, of type `objectType`, refers to
+// once any annotated tags are peeled off, and its type. If a tag in
+// the chain wasn't scanned, the type "tag" is returned.
+func (g *Graph) peel(oid git.OID, objectType git.ObjectType) (git.OID, git.ObjectType) {
+	g.tagLock.Lock()
+	defer g.tagLock.Unlock()
+
+	// A chain can't be longer than the number of tags, unless it
+	// contains a cycle:
+	for i := 0; objectType == "tag" && i <= len(g.tagReferents); i++ {
+		referent, ok := g.tagReferents[oid]
+		if !ok {
+			break
+		}
+		oid, objectType = referent.oid, referent.objectType
+	}
+	return oid, objectType
+}
+
 // RegisterReference records the specified reference in `g`.
 func (g *Graph) RegisterReference(ref git.Reference, walked bool, groups []RefGroupSymbol) {
+	var commit git.OID
+	var isCommit bool
+	if walked {
+		oid, objectType := g.peel(ref.OID, ref.ObjectType)
+		commit, isCommit = oid, objectType == "commit"
+	}
+
 	g.historyLock.Lock()
 	g.historySize.recordReference(g, ref)
 	for _, group := range groups {
 		g.historySize.recordReferenceGroup(g, group)
 	}
+	if isCommit {
+		refCount := g.commitRefCounts[commit]
+		refCount.Increment(1)
+		g.commitRefCounts[commit] = refCount
+		g.historySize.recordCommitRefCount(g, commit, refCount)
+	}
 	g.historyLock.Unlock()
 
 	if walked {
@@ -411,9 +1452,111 @@ func (g *Graph) HistorySize() HistorySize {
 	if len(g.tagRecords) != 0 {
 		panic(fmt.Sprintf("%d tag records remain!", len(g.tagRecords)))
 	}
+	return g.historySizeLocked()
+}
+
+// startSnapshots calls `fn` with a snapshot of the size data
+// collected so far every `interval`, until the returned function is
+// called (which may be done more than once).
+func (g *Graph) startSnapshots(fn func(HistorySize), interval time.Duration) func() {
+	done := make(chan struct{})
+	var once sync.Once
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				g.snapshot(fn)
+			}
+		}
+	}()
+	return func() {
+		once.Do(func() { close(done) })
+		wg.Wait()
+	}
+}
+
+// snapshot calls `fn` with the size data collected so far, while
+// holding the graph's locks. The lists of top trees and blobs are
+// left out, because rendering their paths would race with the path
+// resolver, which is still being filled in.
+func (g *Graph) snapshot(fn func(HistorySize)) {
+	g.treeLock.Lock()
+	defer g.treeLock.Unlock()
+	g.tagLock.Lock()
+	defer g.tagLock.Unlock()
+	g.historyLock.Lock()
+	defer g.historyLock.Unlock()
+	hs := g.historySize
+	hs.recordBlobSizeQuantiles(g.blobSizeSketch)
+	hs.Worst = hs.worstStatistic(g.rg.Groups())
+	fn(hs)
+}
+
+// partialHistorySize returns the size data that have been collected
+// by a scan that was stopped before it was finished. Trees and tags
+// whose sizes couldn't be finalized are simply left out.
+func (g *Graph) partialHistorySize() HistorySize {
+	g.treeLock.Lock()
+	defer g.treeLock.Unlock()
+	g.tagLock.Lock()
+	defer g.tagLock.Unlock()
+	g.historyLock.Lock()
+	defer g.historyLock.Unlock()
+	hs := g.historySizeLocked()
+	hs.Partial = true
+	hs.Worst = hs.worstStatistic(g.rg.Groups())
+	return hs
+}
+
+// historySizeLocked fills in the summary statistics and returns the
+// size data. The caller must hold `treeLock`, `tagLock`, and
+// `historyLock`.
+func (g *Graph) historySizeLocked() HistorySize {
+	if g.topTrees != nil {
+		g.historySize.WidestTrees = g.topTrees.result()
+	}
+	g.historySize.metricExamples = g.metricExamples.result()
+	if g.topBlobs != nil {
+		g.historySize.TopBlobs = g.topBlobs.result(g)
+	}
+	g.historySize.recordBlobSizeQuantiles(g.blobSizeSketch)
 	return g.historySize
 }
 
+// inScope reports whether the blob or tree `oid` should be included
+// in the blob and tree statistics (see `ScanOptions.PathRules` and
+// `ScanOptions.IntroducedSince`).
+func (g *Graph) inScope(oid git.OID) bool {
+	return g.inPathScope(oid) && g.inSinceScope(oid)
+}
+
+// inPathScope reports whether `oid` is at one of the paths selected
+// by `ScanOptions.PathRules`.
+func (g *Graph) inPathScope(oid git.OID) bool {
+	if g.pathScope == nil {
+		return true
+	}
+	_, ok := g.pathScope[oid]
+	return ok
+}
+
+// inSinceScope reports whether `oid` was first introduced after
+// `ScanOptions.IntroducedSince`.
+func (g *Graph) inSinceScope(oid git.OID) bool {
+	if g.sinceScope == nil {
+		return true
+	}
+	_, ok := g.sinceScope[oid]
+	return ok
+}
+
 // RegisterBlob records that the specified `oid` is a blob with the
 // specified size.
 func (g *Graph) RegisterBlob(oid git.OID, objectSize counts.Count32) {
@@ -422,11 +1565,135 @@ func (g *Graph) RegisterBlob(oid git.OID, objectSize counts.Count32) {
 	// we need to know about it. So skip the record and just fill in
 	// the size.
 	g.blobLock.Lock()
-	g.blobSizes[oid] = size
+	g.blobSizes.set(oid, objectSize)
 	g.blobLock.Unlock()
 
+	if !g.inScope(oid) {
+		g.historyLock.Lock()
+		g.historySize.Scope.ExcludedBlobCount.Increment(1)
+		g.historySize.Scope.ExcludedBlobSize.Increment(counts.Count64(objectSize))
+		g.historyLock.Unlock()
+		return
+	}
+
 	g.historyLock.Lock()
 	g.historySize.recordBlob(g, oid, size)
+	g.blobSizeSketch.add(uint64(objectSize))
+	if g.topBlobs != nil && g.topBlobs.by == BlobOrderSize {
+		g.topBlobs.update(g.pathResolver, oid, objectSize)
+	}
+	g.historyLock.Unlock()
+}
+
+// countBlobReference records that a tree entry refers to the blob
+// `oid`. It must be called before the tree entry is recorded with the
+// path resolver.
+func (g *Graph) countBlobReference(oid git.OID) {
+	if !g.inScope(oid) {
+		return
+	}
+	size := g.GetBlobSize(oid).Size
+
+	g.historyLock.Lock()
+	defer g.historyLock.Unlock()
+	refCount, _ := g.blobRefCounts.get(oid)
+	refCount.Increment(1)
+	g.blobRefCounts.set(oid, refCount)
+	g.historySize.recordBlobReference(g, oid, size, refCount)
+	if g.topBlobs != nil && g.topBlobs.by == BlobOrderRefCount {
+		g.topBlobs.update(g.pathResolver, oid, refCount)
+	}
+}
+
+// registerExcludedTrees treats the trees that were referred to but
+// never read, because they are only reachable from excluded commits
+// (see `ScanOptions.Exclude`), as empty. It must be called after all
+// of the trees that were scanned have been registered.
+func (g *Graph) registerExcludedTrees() {
+	g.treeLock.Lock()
+	var records []*treeRecord
+	for oid, record := range g.treeRecords {
+		if record.pending == -1 {
+			records = append(records, record)
+			g.treeSizes.set(oid, TreeSize{})
+			delete(g.treeRecords, oid)
+		}
+	}
+	g.treeLock.Unlock()
+
+	for _, record := range records {
+		for _, listener := range record.listeners {
+			listener(TreeSize{})
+		}
+	}
+}
+
+// RegisterSkippedObject records that the object with the specified
+// `oid` couldn't be read or parsed. `objectType` is the type of the
+// object, or "" if it is not known. The object is recorded in the
+// history's list of errors, and treated as empty (and not counted)
+// when computing the sizes of objects that refer to it.
+func (g *Graph) RegisterSkippedObject(oid git.OID, objectType git.ObjectType, err error) {
+	known := objectType == "blob" || objectType == "tree" ||
+		objectType == "commit" || objectType == "tag"
+
+	if objectType == "blob" || !known {
+		g.blobLock.Lock()
+		g.blobSizes.set(oid, 0)
+		g.blobLock.Unlock()
+	}
+
+	if objectType == "tree" || !known {
+		g.treeLock.Lock()
+		g.treeSizes.set(oid, TreeSize{})
+		record := g.treeRecords[oid]
+		delete(g.treeRecords, oid)
+		g.treeLock.Unlock()
+
+		if record != nil {
+			for _, listener := range record.listeners {
+				listener(TreeSize{})
+			}
+		}
+	}
+
+	if objectType == "commit" || !known {
+		g.commitLock.Lock()
+		g.commitSizes.set(oid, CommitSize{})
+		g.commitLock.Unlock()
+	}
+
+	if objectType == "tag" || !known {
+		g.tagLock.Lock()
+		g.tagSizes[oid] = TagSize{}
+		record := g.tagRecords[oid]
+		delete(g.tagRecords, oid)
+		g.tagLock.Unlock()
+
+		if record != nil {
+			for _, listener := range record.listeners {
+				listener(TagSize{})
+			}
+		}
+	}
+
+	g.RecordCorruptObject(oid, objectType, err)
+}
+
+// RegisterBrokenReference records that `ref` points at an object that
+// doesn't exist, and therefore won't be scanned.
+func (g *Graph) RegisterBrokenReference(ref git.Reference) {
+	g.historyLock.Lock()
+	g.historySize.recordBrokenReference(ref)
+	g.historyLock.Unlock()
+}
+
+// RecordCorruptObject records in the history's list of errors that
+// the object with the specified `oid` couldn't be read or parsed,
+// without otherwise affecting how the object is processed.
+func (g *Graph) RecordCorruptObject(oid git.OID, objectType git.ObjectType, err error) {
+	g.historyLock.Lock()
+	g.historySize.recordCorruptObject(oid, objectType, err)
 	g.historyLock.Unlock()
 }
 
@@ -441,17 +1708,21 @@ func (g *Graph) RegisterBlob(oid git.OID, objectSize counts.Count32) {
 
 func (g *Graph) GetBlobSize(oid git.OID) BlobSize {
 	// See if we already know the size:
-	size, ok := g.blobSizes[oid]
+	size, ok := g.blobSizes.get(oid)
 	if !ok {
+		if g.partialHistory {
+			// The blob is only reachable from excluded commits.
+			return BlobSize{}
+		}
 		panic("blob size not known")
 	}
-	return size
+	return BlobSize{Size: size}
 }
 
 func (g *Graph) RequireTreeSize(oid git.OID, listener func(TreeSize)) (TreeSize, bool) {
 	g.treeLock.Lock()
 
-	size, ok := g.treeSizes[oid]
+	size, ok := g.treeSizes.get(oid)
 	if ok {
 		g.treeLock.Unlock()
 
@@ -473,8 +1744,13 @@ func (g *Graph) RequireTreeSize(oid git.OID, listener func(TreeSize)) (TreeSize,
 func (g *Graph) GetTreeSize(oid git.OID) TreeSize {
 	g.treeLock.Lock()
 
-	size, ok := g.treeSizes[oid]
+	size, ok := g.treeSizes.get(oid)
 	if !ok {
+		if g.partialHistory {
+			// The tree is only reachable from excluded commits.
+			g.treeLock.Unlock()
+			return TreeSize{}
+		}
 		panic("tree size not available!")
 	}
 	g.treeLock.Unlock()
@@ -485,7 +1761,7 @@ func (g *Graph) GetTreeSize(oid git.OID) TreeSize {
 func (g *Graph) RegisterTree(oid git.OID, tree *git.Tree) error {
 	g.treeLock.Lock()
 
-	if _, ok := g.treeSizes[oid]; ok {
+	if _, ok := g.treeSizes.get(oid); ok {
 		panic(fmt.Sprintf("tree %s registered twice!", oid))
 	}
 
@@ -504,17 +1780,52 @@ func (g *Graph) RegisterTree(oid git.OID, tree *git.Tree) error {
 
 func (g *Graph) finalizeTreeSize(
 	oid git.OID, size TreeSize, objectSize counts.Count32, treeEntries counts.Count32,
+	names treeNameStats,
 ) {
 	g.treeLock.Lock()
-	g.treeSizes[oid] = size
+	g.treeSizes.set(oid, size)
 	delete(g.treeRecords, oid)
 	g.treeLock.Unlock()
 
+	if !g.inPathScope(oid) {
+		return
+	}
+	if !g.inSinceScope(oid) {
+		// The checkout statistics describe the structure of the
+		// history as a whole, so they aren't limited by date:
+		g.historyLock.Lock()
+		g.historySize.recordCheckout(g, oid, size)
+		g.historyLock.Unlock()
+		return
+	}
+
 	g.historyLock.Lock()
-	g.historySize.recordTree(g, oid, size, objectSize, treeEntries)
+	g.historySize.recordTree(g, oid, size, objectSize, treeEntries, names)
+	if g.topTrees != nil {
+		g.topTrees.add(g.pathResolver, oid, treeEntries)
+	}
 	g.historyLock.Unlock()
 }
 
+// treeNameStats holds statistics about the names of the entries
+// directly in a tree.
+type treeNameStats struct {
+	// maxLength is the length of the longest entry name, in bytes.
+	maxLength counts.Count32
+
+	// longCount is the number of entries whose names are longer than
+	// `MaxPortableNameLength`.
+	longCount counts.Count32
+}
+
+func (ns *treeNameStats) addName(name string) {
+	length := counts.NewCount32(uint64(len(name)))
+	ns.maxLength.AdjustMaxIfNecessary(length)
+	if len(name) > MaxPortableNameLength {
+		ns.longCount.Increment(1)
+	}
+}
+
 type treeRecord struct {
 	oid git.OID
 
@@ -529,6 +1840,10 @@ type treeRecord struct {
 	// pending != -1.
 	entryCount counts.Count32
 
+	// Statistics about the names of the entries directly in this
+	// tree. Initialized iff pending != -1.
+	names treeNameStats
+
 	// The size of the items we know so far:
 	size TreeSize
 
@@ -559,16 +1874,22 @@ func (r *treeRecord) initialize(g *Graph, oid git.OID, tree *git.Tree) error {
 	r.objectSize = tree.Size()
 	r.pending = 0
 
+	var anomalies treeAnomalyChecker
 	iter := tree.Iter()
 	for {
 		entry, ok, err := iter.NextEntry()
 		if err != nil {
+			// Finalize the tree based on the entries that we could
+			// read, so that our listeners aren't left hanging:
+			r.maybeFinalize(g)
 			return err
 		}
 		if !ok {
 			break
 		}
+		anomalies.check(entry)
 		name := entry.Name
+		r.names.addName(name)
 
 		switch {
 		case entry.Filemode&0o170000 == 0o40000:
@@ -602,6 +1923,7 @@ func (r *treeRecord) initialize(g *Graph, oid git.OID, tree *git.Tree) error {
 
 		case entry.Filemode&0o170000 == 0o120000:
 			// Symlink
+			g.countBlobReference(entry.OID)
 			g.pathResolver.RecordTreeEntry(oid, name, entry.OID)
 
 			r.size.addLink(name)
@@ -609,6 +1931,7 @@ func (r *treeRecord) initialize(g *Graph, oid git.OID, tree *git.Tree) error {
 
 		default:
 			// Blob
+			g.countBlobReference(entry.OID)
 			g.pathResolver.RecordTreeEntry(oid, name, entry.OID)
 
 			blobSize := g.GetBlobSize(entry.OID)
@@ -617,6 +1940,12 @@ func (r *treeRecord) initialize(g *Graph, oid git.OID, tree *git.Tree) error {
 		}
 	}
 
+	if anomalies.found != 0 {
+		g.historyLock.Lock()
+		g.historySize.recordTreeAnomalies(g, oid, anomalies.found)
+		g.historyLock.Unlock()
+	}
+
 	r.maybeFinalize(g)
 
 	return nil
@@ -624,7 +1953,7 @@ func (r *treeRecord) initialize(g *Graph, oid git.OID, tree *git.Tree) error {
 
 func (r *treeRecord) maybeFinalize(g *Graph) {
 	if r.pending == 0 {
-		g.finalizeTreeSize(r.oid, r.size, r.objectSize, r.entryCount)
+		g.finalizeTreeSize(r.oid, r.size, r.objectSize, r.entryCount, r.names)
 		for _, listener := range r.listeners {
 			listener(r.size)
 		}
@@ -640,7 +1969,7 @@ func (r *treeRecord) addListener(listener func(TreeSize)) {
 func (g *Graph) GetCommitSize(oid git.OID) CommitSize {
 	g.commitLock.Lock()
 
-	size, ok := g.commitSizes[oid]
+	size, ok := g.commitSizes.get(oid)
 	if !ok {
 		panic("commit is not available")
 	}
@@ -649,10 +1978,19 @@ func (g *Graph) GetCommitSize(oid git.OID) CommitSize {
 	return size
 }
 
+// haveCommit returns true iff the commit `oid` has been registered.
+func (g *Graph) haveCommit(oid git.OID) bool {
+	g.commitLock.Lock()
+	defer g.commitLock.Unlock()
+
+	_, ok := g.commitSizes.get(oid)
+	return ok
+}
+
 // Record that the specified `oid` is the specified `commit`.
 func (g *Graph) RegisterCommit(oid git.OID, commit *git.Commit) {
 	g.commitLock.Lock()
-	if _, ok := g.commitSizes[oid]; ok {
+	if _, ok := g.commitSizes.get(oid); ok {
 		panic(fmt.Sprintf("commit %s registered twice!", oid))
 	}
 	g.commitLock.Unlock()
@@ -667,20 +2005,50 @@ func (g *Graph) RegisterCommit(oid git.OID, commit *git.Commit) {
 	treeSize := g.GetTreeSize(commit.Tree)
 	size.addTree(treeSize)
 
-	for _, parent := range commit.Parents {
-		parentSize := g.GetCommitSize(parent)
-		size.addParent(parentSize)
+	if !g.ignoreParents {
+		parents := commit.Parents
+		if g.firstParent && len(parents) > 1 {
+			parents = parents[:1]
+		}
+		for _, parent := range parents {
+			if g.partialHistory && !g.haveCommit(parent) {
+				continue
+			}
+			parentSize := g.GetCommitSize(parent)
+			size.addParent(parentSize)
+		}
 	}
 
 	// Add 1 for this commit itself:
 	size.MaxAncestorDepth.Increment(1)
+	if len(commit.Parents) > 1 {
+		size.MaxMergeDepth.Increment(1)
+	}
+
+	// The commit doesn't contain or change any files if its tree is
+	// empty or the same as its first parent's (if that was scanned):
+	empty := treeSize.ExpandedBlobCount == 0 &&
+		treeSize.ExpandedLinkCount == 0 &&
+		treeSize.ExpandedSubmoduleCount == 0
 
 	g.commitLock.Lock()
-	g.commitSizes[oid] = size
+	g.commitSizes.set(oid, size)
+	if len(commit.Parents) != 0 {
+		if parentTree, ok := g.commitTrees.get(commit.Parents[0]); ok && parentTree == commit.Tree {
+			empty = true
+		}
+	}
+	g.commitTrees.set(oid, commit.Tree)
 	g.commitLock.Unlock()
 
 	g.historyLock.Lock()
 	g.historySize.recordCommit(g, oid, size, commit.Size, parentCount)
+	if empty {
+		g.historySize.recordEmptyCommit(g, oid)
+	}
+	g.historySize.recordCommitPathDepth(treeSize.MaxPathDepth)
+	g.historySize.PersistenceWeighted.recordCommitTree(treeSize)
+	g.historySize.recordCommitMetadata(g, oid, commit, g.latestPlausibleTime)
 	g.historyLock.Unlock()
 }
 
@@ -720,11 +2088,51 @@ func (g *Graph) RegisterTag(oid git.OID, tag *git.Tag) {
 		record = newTagRecord(oid)
 		g.tagRecords[oid] = record
 	}
+	g.tagReferents[oid] = tagReferent{tag.Referent, tag.ReferentType}
 
 	g.tagLock.Unlock()
 
+	g.historyLock.Lock()
+	if tag.Signed {
+		g.historySize.SignedTagCount.Increment(1)
+	}
+	g.historySize.recordTagMessage(g, oid, tag.MessageSize)
+	g.historyLock.Unlock()
+
 	// Let the record take care of the rest:
 	record.initialize(g, oid, tag)
+
+	g.pathResolver.RecordTag(oid, tag)
+}
+
+// breakTagCycles finalizes the tags that are still waiting to learn
+// the depth of the tag that they point at, which can only happen if
+// a chain of tags contains a cycle (which requires a hash collision,
+// but a corrupt repository shouldn't make the scan hang or crash).
+// Their depths are capped at what was known so far, and they are
+// recorded as corrupt. It must be called after all of the tags have
+// been registered.
+func (g *Graph) breakTagCycles() {
+	g.tagLock.Lock()
+	var records []*tagRecord
+	for _, record := range g.tagRecords {
+		records = append(records, record)
+	}
+	g.tagLock.Unlock()
+
+	for _, record := range records {
+		// Don't notify the listeners, which are other tags in the
+		// cycle that are also being finalized here:
+		record.lock.Lock()
+		record.pending = -1
+		size, objectSize := record.size, record.objectSize
+		record.lock.Unlock()
+
+		g.finalizeTagSize(record.oid, size, objectSize)
+		g.RecordCorruptObject(
+			record.oid, "tag", errors.New("chain of tags does not end (it contains a cycle)"),
+		)
+	}
 }
 
 func (g *Graph) finalizeTagSize(oid git.OID, size TagSize, objectSize counts.Count32) {
@@ -0,0 +1,150 @@
+package sizes
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/github/git-sizer/counts"
+)
+
+// The lower bounds of the buckets (after the first) of the histograms
+// in `HistorySize`. They are fixed, so that histograms from different
+// repositories can be compared.
+var (
+	// blobSizeBounds are in bytes.
+	blobSizeBounds = []uint64{1e3, 1e4, 1e5, 1e6, 1e7, 1e8}
+
+	// treeEntryBounds are numbers of entries.
+	treeEntryBounds = []uint64{10, 100, 1e3, 1e4, 1e5}
+
+	// pathDepthBounds are path depths, where a file in the
+	// top-level directory has depth 1.
+	pathDepthBounds = []uint64{2, 4, 8, 16, 32, 64}
+)
+
+// HistogramBucket is one bucket of a `Histogram`.
+type HistogramBucket struct {
+	// Min is the smallest value that falls into the bucket, and Max
+	// is the smallest value above it that doesn't. Max is 0 for the
+	// last bucket, which has no upper bound.
+	Min uint64 `json:"min"`
+	Max uint64 `json:"max,omitempty"`
+
+	// Count is the number of objects in the bucket, and Size is their
+	// total size in bytes (if the histogram records sizes).
+	Count counts.Count32 `json:"count"`
+	Size  counts.Count64 `json:"size,omitempty"`
+}
+
+// Histogram counts objects in buckets with logarithmically-spaced
+// bounds.
+type Histogram struct {
+	Buckets []HistogramBucket `json:"buckets"`
+}
+
+// newHistogram returns an empty `*Histogram` whose buckets start at 0
+// and at each of `bounds`, which must be increasing.
+func newHistogram(bounds []uint64) *Histogram {
+	h := Histogram{
+		Buckets: make([]HistogramBucket, len(bounds)+1),
+	}
+	for i, bound := range bounds {
+		h.Buckets[i].Max = bound
+		h.Buckets[i+1].Min = bound
+	}
+	return &h
+}
+
+// add records an object with the specified `value` (the quantity that
+// the histogram is bucketed by) and `size`.
+func (h *Histogram) add(value uint64, size counts.Count64) {
+	b := h.bucket(value)
+	b.Count.Increment(1)
+	b.Size.Increment(size)
+}
+
+// addCount records `count` objects with the specified `value`,
+// without sizes.
+func (h *Histogram) addCount(value uint64, count counts.Count32) {
+	h.bucket(value).Count.Increment(count)
+}
+
+// bucket returns the bucket that `value` falls into.
+func (h *Histogram) bucket(value uint64) *HistogramBucket {
+	i := len(h.Buckets) - 1
+	for i > 0 && value < h.Buckets[i].Min {
+		i--
+	}
+	return &h.Buckets[i]
+}
+
+// format returns a table of the histogram, headed by `title`, with
+// the bucket bounds expressed in `unit`. The total size of the objects
+// in each bucket is shown if `withSize` is set.
+func (h *Histogram) format(title, unit string, withSize bool) string {
+	if h == nil {
+		return ""
+	}
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "\n%s:\n\n", title)
+	if withSize {
+		fmt.Fprintf(buf, "    %-16s  %10s  %10s\n", "Range", "Count", "Size")
+	} else {
+		fmt.Fprintf(buf, "    %-16s  %10s\n", "Range", "Count")
+	}
+	for _, b := range h.Buckets {
+		var label string
+		switch {
+		case b.Max == 0:
+			label = ">= " + compactNumber(b.Min, unit)
+		case b.Min == 0:
+			label = "< " + compactNumber(b.Max, unit)
+		default:
+			label = compactNumber(b.Min, unit) + " - " + compactNumber(b.Max, unit)
+		}
+		if !withSize {
+			fmt.Fprintf(buf, "    %-16s  %10d\n", label, b.Count)
+			continue
+		}
+		numeral, sizeUnit := counts.Binary.Format(b.Size, "B")
+		fmt.Fprintf(
+			buf, "    %-16s  %10d  %10s\n",
+			label, b.Count, strings.TrimSpace(numeral+" "+sizeUnit),
+		)
+	}
+	return buf.String()
+}
+
+// compactNumber formats `n`, which is expected to be a power of ten,
+// followed by `unit` with a decimal prefix (e.g., "10 KB", or "1K" if
+// `unit` is empty).
+func compactNumber(n uint64, unit string) string {
+	prefixes := []string{"", "K", "M", "G", "T"}
+	i := 0
+	for i < len(prefixes)-1 && n >= 1000 && n%1000 == 0 {
+		n /= 1000
+		i++
+	}
+	if unit == "" {
+		return fmt.Sprintf("%d%s", n, prefixes[i])
+	}
+	return fmt.Sprintf("%d %s%s", n, prefixes[i], unit)
+}
+
+// recordCommitPathDepth records the maximum path depth in the tree of
+// a commit, if histograms are being collected.
+func (s *HistorySize) recordCommitPathDepth(depth counts.Count32) {
+	if s.PathDepthHistogram != nil {
+		s.PathDepthHistogram.add(uint64(depth), 0)
+	}
+}
+
+// histogramsString returns tables of the histograms that were
+// collected, if any.
+func (s *HistorySize) histogramsString() string {
+	return s.BlobSizeHistogram.format("Blob size histogram", "B", true) +
+		s.TreeEntriesHistogram.format("Tree entry count histogram", "", true) +
+		s.PathDepthHistogram.format("Commit path depth histogram", "", false)
+}
@@ -0,0 +1,127 @@
+package sizes
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+)
+
+// jsonStreamRecord is one line of the output of `WriteJSONStream()`.
+type jsonStreamRecord struct {
+	// Section is "statistics" for a statistic, or otherwise the key
+	// of the section in the version 2 JSON output (e.g.,
+	// "topBlobs").
+	Section string `json:"section"`
+
+	// Key is the symbol of a statistic, or the key of an entry of a
+	// section that is a map (e.g., the name of a remote in
+	// "remotes").
+	Key string `json:"key,omitempty"`
+
+	// Index is the position of an entry of a section that is a list
+	// (e.g., "objectLookups").
+	Index *int `json:"index,omitempty"`
+
+	Value interface{} `json:"value"`
+}
+
+// WriteJSONStream writes the same contents as the version 2 JSON
+// output (see `JSON()`) to `w`, but as a stream of JSON objects, one
+// per line, so that consumers can process them one at a time. Each
+// line has the following fields:
+//
+//   - "section": "statistics" for a statistic, or otherwise the key
+//     of the section in the version 2 JSON output (e.g., "topBlobs").
+//   - "key": for a statistic, its symbol; for an entry of a section
+//     that is a map (e.g., "remotes" or "submodules"), its key.
+//   - "index": for an entry of a section that is a list (e.g.,
+//     "objectLookups" or "widestTrees"), its position, counting from 0.
+//   - "value": the statistic, entry, or the whole section, formatted
+//     as in the version 2 JSON output.
+//
+// The statistics come first, ordered by symbol, followed by the other
+// sections, ordered by key. The entries of a map are ordered by key.
+func (s *HistorySize) WriteJSONStream(w io.Writer, refGroups []RefGroup) error {
+	items := make(map[string]*item)
+	s.contents(refGroups).CollectItems(items)
+	output := s.jsonMap(refGroups)
+
+	out := bufio.NewWriter(w)
+	enc := json.NewEncoder(out)
+	write := func(r jsonStreamRecord) error {
+		if err := enc.Encode(r); err != nil {
+			return fmt.Errorf("could not convert %s to json: %w", r.Section, err)
+		}
+		return nil
+	}
+
+	var symbols, sections []string
+	for key := range output {
+		if _, ok := items[key]; ok {
+			symbols = append(symbols, key)
+		} else {
+			sections = append(sections, key)
+		}
+	}
+	sort.Strings(symbols)
+	sort.Strings(sections)
+
+	for _, symbol := range symbols {
+		if err := write(jsonStreamRecord{
+			Section: "statistics",
+			Key:     symbol,
+			Value:   output[symbol],
+		}); err != nil {
+			return err
+		}
+	}
+
+	for _, section := range sections {
+		value := output[section]
+		v := reflect.ValueOf(value)
+		switch v.Kind() {
+		case reflect.Map:
+			keys := make([]string, 0, v.Len())
+			entries := make(map[string]interface{}, v.Len())
+			iter := v.MapRange()
+			for iter.Next() {
+				key := fmt.Sprint(iter.Key().Interface())
+				keys = append(keys, key)
+				entries[key] = iter.Value().Interface()
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				if err := write(jsonStreamRecord{
+					Section: section,
+					Key:     key,
+					Value:   entries[key],
+				}); err != nil {
+					return err
+				}
+			}
+		case reflect.Slice:
+			for i := 0; i < v.Len(); i++ {
+				i := i
+				if err := write(jsonStreamRecord{
+					Section: section,
+					Index:   &i,
+					Value:   v.Index(i).Interface(),
+				}); err != nil {
+					return err
+				}
+			}
+		default:
+			if err := write(jsonStreamRecord{
+				Section: section,
+				Value:   value,
+			}); err != nil {
+				return err
+			}
+		}
+	}
+
+	return out.Flush()
+}
@@ -0,0 +1,108 @@
+package sizes
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/github/git-sizer/counts"
+	"github.com/github/git-sizer/git"
+)
+
+// LFSCandidates lists the blobs among `TopBlobs` whose paths aren't
+// routed to Git LFS; i.e., for which the `filter` gitattribute isn't
+// "lfs". They are the files that would have to be migrated to LFS.
+type LFSCandidates struct {
+	// Rev is the revision whose attributes were used.
+	Rev string `json:"rev"`
+
+	// CheckedCount is the number of blobs whose paths were checked,
+	// and LFSCount the number of those that are already in LFS.
+	CheckedCount counts.Count32 `json:"checked_count"`
+	LFSCount     counts.Count32 `json:"lfs_count"`
+
+	// UnknownCount is the number of blobs whose paths aren't known,
+	// and which therefore couldn't be checked.
+	UnknownCount counts.Count32 `json:"unknown_count"`
+
+	// Blobs are the blobs that aren't in LFS, largest first, and
+	// BlobSize is their total size.
+	Blobs    []RankedBlob   `json:"blobs"`
+	BlobSize counts.Count64 `json:"blob_size"`
+}
+
+// FindLFSCandidates checks, for each of the blobs in `tb`, whether
+// the gitattributes in the tree of `rev` route its path to LFS (even
+// for blobs that were found in other commits), and returns the ones
+// that they don't. As for `ClassifyTopBlobs()`, the paths of the
+// blobs must be known.
+func FindLFSCandidates(
+	ctx context.Context, repo *git.Repository, rev string, tb *TopBlobs,
+) (*LFSCandidates, error) {
+	lc := LFSCandidates{
+		Rev:   rev,
+		Blobs: []RankedBlob{},
+	}
+
+	var paths []string
+	for _, b := range tb.Blobs {
+		if b.Path != "" {
+			paths = append(paths, b.Path)
+		}
+	}
+
+	values, err := repo.CheckAttr(ctx, rev, "filter", paths)
+	if err != nil {
+		return nil, fmt.Errorf("checking gitattribute 'filter' in '%s': %w", rev, err)
+	}
+
+	for _, b := range tb.Blobs {
+		if b.Path == "" {
+			lc.UnknownCount.Increment(1)
+			continue
+		}
+		lc.CheckedCount.Increment(1)
+		if values[b.Path] == "lfs" {
+			lc.LFSCount.Increment(1)
+			continue
+		}
+		lc.Blobs = append(lc.Blobs, b)
+		lc.BlobSize.Increment(counts.Count64(b.Size))
+	}
+
+	return &lc, nil
+}
+
+// String returns a human-readable list of the blobs that aren't in
+// LFS.
+func (lc *LFSCandidates) String() string {
+	if lc == nil {
+		return ""
+	}
+
+	size := func(n counts.Humanable) string {
+		numeral, unit := counts.Binary.Format(n, "B")
+		return strings.TrimSpace(numeral + " " + unit)
+	}
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(
+		buf, "Large blobs not stored in LFS according to the gitattributes in '%s' (%d of %d",
+		git.DisplayString(lc.Rev), len(lc.Blobs), lc.CheckedCount,
+	)
+	if lc.UnknownCount != 0 {
+		fmt.Fprintf(buf, "; %d without a known path", lc.UnknownCount)
+	}
+	fmt.Fprintln(buf, "):")
+	fmt.Fprintln(buf)
+	if len(lc.Blobs) == 0 {
+		fmt.Fprintln(buf, "    (none)")
+		return buf.String()
+	}
+	for _, b := range lc.Blobs {
+		fmt.Fprintf(buf, "    %10s  %s  %s\n", size(b.Size), b.OID, git.DisplayString(b.Path))
+	}
+	fmt.Fprintf(buf, "\nTotal: %s\n", size(lc.BlobSize))
+	return buf.String()
+}
@@ -0,0 +1,145 @@
+package sizes
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/github/git-sizer/counts"
+	"github.com/github/git-sizer/git"
+)
+
+// LFSSizes compares the size of the blobs in a repository's history
+// with the size of the content that they represent, counting each Git
+// LFS pointer blob as the size of the file that it points at. It is
+// computed by `ComputeLFSSizes()`.
+type LFSSizes struct {
+	// BlobCount and BlobSize total the blobs in the history, as Git
+	// stores them.
+	BlobCount counts.Count32 `json:"blob_count"`
+	BlobSize  counts.Count64 `json:"blob_size"`
+
+	// PointerCount and PointerSize total the blobs that are Git LFS
+	// pointer files.
+	PointerCount counts.Count32 `json:"pointer_count"`
+	PointerSize  counts.Count64 `json:"pointer_size"`
+
+	// ObjectCount and ObjectSize total the distinct LFS objects
+	// (i.e., real file contents) that the pointers point at.
+	ObjectCount counts.Count32 `json:"object_count"`
+	ObjectSize  counts.Count64 `json:"object_size"`
+
+	// LocalObjectCount and LocalObjectSize total the LFS objects that
+	// are present in the local LFS storage (`.git/lfs/objects`).
+	LocalObjectCount counts.Count32 `json:"local_object_count"`
+	LocalObjectSize  counts.Count64 `json:"local_object_size"`
+
+	// ContentSize is the "true" size of the content: `BlobSize`, but
+	// with the LFS objects in place of their pointers.
+	ContentSize counts.Count64 `json:"content_size"`
+}
+
+// ComputeLFSSizes finds the Git LFS pointer blobs that are reachable
+// from the references that `rg` walks, and totals the real sizes that
+// they record, as well as the sizes of the LFS objects that are
+// present locally. Only blobs of at most `git.MaxLFSPointerSize` bytes
+// are read, since bigger ones can't be pointers.
+func ComputeLFSSizes(
+	ctx context.Context, repo *git.Repository, rg RefGrouper,
+) (*LFSSizes, error) {
+	var roots []git.OID
+	refs, err := walkedReferences(ctx, repo, rg)
+	if err != nil {
+		return nil, err
+	}
+	for _, ref := range refs {
+		roots = append(roots, ref.OID)
+	}
+
+	dir, err := repo.LFSObjectsDir()
+	if err != nil {
+		return nil, fmt.Errorf("locating the LFS objects: %w", err)
+	}
+
+	var ls LFSSizes
+	seen := make(map[string]bool)
+	blobs, err := repo.ForEachLFSPointer(
+		ctx, roots,
+		func(blob git.BatchHeader, p git.LFSPointer) error {
+			ls.PointerCount.Increment(1)
+			ls.PointerSize.Increment(counts.Count64(blob.ObjectSize))
+			if seen[p.OID] {
+				return nil
+			}
+			seen[p.OID] = true
+			ls.ObjectCount.Increment(1)
+			ls.ObjectSize.Increment(counts.Count64(p.Size))
+			if git.HasLFSObject(dir, p) {
+				ls.LocalObjectCount.Increment(1)
+				ls.LocalObjectSize.Increment(counts.Count64(p.Size))
+			}
+			return nil
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("reading LFS pointers: %w", err)
+	}
+
+	ls.BlobCount = counts.NewCount32(blobs.Count)
+	ls.BlobSize = counts.NewCount64(blobs.Size)
+	ls.ContentSize = counts.NewCount64(
+		blobs.Size - uint64(ls.PointerSize) + uint64(ls.ObjectSize),
+	)
+
+	return &ls, nil
+}
+
+// jsonV2 returns `ls` the way that it is represented in the version 2
+// JSON output, with camelCase names.
+func (ls *LFSSizes) jsonV2() interface{} {
+	return struct {
+		BlobCount        counts.Count32 `json:"blobCount"`
+		BlobSize         counts.Count64 `json:"blobSize"`
+		PointerCount     counts.Count32 `json:"pointerCount"`
+		PointerSize      counts.Count64 `json:"pointerSize"`
+		ObjectCount      counts.Count32 `json:"objectCount"`
+		ObjectSize       counts.Count64 `json:"objectSize"`
+		LocalObjectCount counts.Count32 `json:"localObjectCount"`
+		LocalObjectSize  counts.Count64 `json:"localObjectSize"`
+		ContentSize      counts.Count64 `json:"contentSize"`
+	}(*ls)
+}
+
+// String returns a table comparing the size of the blobs in Git with
+// the size of the content, including the LFS objects.
+func (ls *LFSSizes) String() string {
+	if ls == nil {
+		return ""
+	}
+
+	size := func(n counts.Count64) string {
+		numeral, unit := counts.Binary.Format(n, "B")
+		return strings.TrimSpace(numeral + " " + unit)
+	}
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "\nGit LFS sizes:\n\n")
+	fmt.Fprintf(buf, "    %-28s  %10s  %10s\n", "", "Count", "Size")
+	for _, row := range []struct {
+		name  string
+		count counts.Count32
+		size  counts.Count64
+	}{
+		{"Blobs in Git", ls.BlobCount, ls.BlobSize},
+		{"  of which LFS pointers", ls.PointerCount, ls.PointerSize},
+		{"LFS objects", ls.ObjectCount, ls.ObjectSize},
+		{"  of which present locally", ls.LocalObjectCount, ls.LocalObjectSize},
+	} {
+		fmt.Fprintf(buf, "    %-28s  %10d  %10s\n", row.name, row.count, size(row.size))
+	}
+	fmt.Fprintf(
+		buf, "    %-28s  %10s  %10s\n", "True content size", "", size(ls.ContentSize),
+	)
+	return buf.String()
+}
@@ -0,0 +1,212 @@
+package sizes
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/github/git-sizer/counts"
+	"github.com/github/git-sizer/git"
+)
+
+// maxManifestPaths is the most paths that are listed for each blob in
+// the manifest.
+const maxManifestPaths = 3
+
+// ManifestEntry describes one of the blobs that are larger than
+// `ScanOptions.BlobSizeLimit`. `WriteBlobManifest()` writes one entry
+// per line, as a JSON object with the following fields:
+//
+//   - "oid": the blob's object ID.
+//   - "size": its size in bytes.
+//   - "paths": up to three of the paths at which it was added, in the
+//     order that they were found; empty if none are known.
+//   - "commit" and "date": the first commit that added it, in
+//     parents-first order, and that commit's committer date in strict
+//     ISO 8601 format. Left out if no such commit was found (e.g., if
+//     the blob is only reachable via a reference to a tree).
+//   - "ref": a scanned reference from which that commit is reachable.
+//     Left out along with "commit".
+//   - "at_tip": whether the blob is in the tree of the commit (or the
+//     tree, or is the blob) that one of the scanned references points
+//     at, rather than only in older history.
+//   - "lfs": whether the gitattributes in `HEAD` route the blob's
+//     first path to Git LFS. Only present if that was requested.
+//
+// Fields may be added in the future, but these won't be changed.
+type ManifestEntry struct {
+	OID    git.OID        `json:"oid"`
+	Size   counts.Count32 `json:"size"`
+	Paths  []string       `json:"paths"`
+	Commit *git.OID       `json:"commit,omitempty"`
+	Date   string         `json:"date,omitempty"`
+	Ref    string         `json:"ref,omitempty"`
+	AtTip  bool           `json:"at_tip"`
+	LFS    *bool          `json:"lfs,omitempty"`
+}
+
+// WriteBlobManifest writes a `ManifestEntry` for each of the blobs
+// counted in `s.OversizedBlobs` to `w`, as JSON lines. The blobs are
+// listed in the order that they were first added to the history, and
+// any that weren't found in a commit come last, ordered by OID. The
+// scan must have been run with `ScanOptions.RememberOversizedBlobs`,
+// and `rg` must be the `RefGrouper` that was used for it. If `lfs` is
+// set, the "lfs" field is filled in, too.
+//
+// The history of the walked references is traversed again (using
+// `git log`) to find the commits and paths. Only a fixed amount of
+// data is kept per oversized blob, so the memory needed doesn't grow
+// with the size of the history.
+func (s *HistorySize) WriteBlobManifest(
+	ctx context.Context, repo *git.Repository, rg RefGrouper, lfs bool, w io.Writer,
+) error {
+	ob := s.OversizedBlobs
+	if ob == nil || ob.blobs == nil {
+		return errors.New("the scan didn't remember the oversized blobs")
+	}
+
+	var roots []string
+	var tips []git.OID
+	refs, err := walkedReferences(ctx, repo, rg)
+	if err != nil {
+		return err
+	}
+	for _, ref := range refs {
+		roots = append(roots, ref.Refname)
+		tips = append(tips, ref.OID)
+	}
+
+	headers, err := repo.PeeledObjectHeaders(ctx, tips)
+	if err != nil {
+		return err
+	}
+
+	entries := make(map[git.OID]*ManifestEntry, len(ob.blobs))
+	var order []*ManifestEntry
+	atTip := make(map[git.OID]bool)
+
+	var commitRoots []string
+	seenTips := make(map[git.OID]bool)
+	for i, header := range headers {
+		switch header.ObjectType {
+		case "commit":
+			commitRoots = append(commitRoots, roots[i])
+		case "blob":
+			atTip[header.OID] = true
+			continue
+		case "tree":
+		default:
+			continue
+		}
+		if seenTips[header.OID] {
+			continue
+		}
+		seenTips[header.OID] = true
+		if err := repo.ForEachLsTreeEntry(
+			ctx, header.OID.String(),
+			func(entry git.LsTreeEntry) error {
+				if _, ok := ob.blobs[entry.OID]; ok {
+					atTip[entry.OID] = true
+				}
+				return nil
+			},
+		); err != nil {
+			return fmt.Errorf("listing the tree of %s: %w", header.OID, err)
+		}
+	}
+
+	if err := repo.ForEachLoggedCommit(
+		ctx, commitRoots,
+		func(lc git.LoggedCommit) error {
+			for _, change := range lc.Changes {
+				if change.Status == 'D' {
+					continue
+				}
+				size, ok := ob.blobs[change.NewOID]
+				if !ok {
+					continue
+				}
+				e := entries[change.NewOID]
+				if e == nil {
+					commit := lc.OID
+					e = &ManifestEntry{
+						OID:    change.NewOID,
+						Size:   size,
+						Commit: &commit,
+						Date:   lc.Date,
+						Ref:    lc.Source,
+					}
+					entries[change.NewOID] = e
+					order = append(order, e)
+				}
+				addManifestPath(e, change.Path)
+			}
+			return nil
+		},
+	); err != nil {
+		return fmt.Errorf("walking history for the manifest: %w", err)
+	}
+
+	var unseen []*ManifestEntry
+	for oid, size := range ob.blobs {
+		if entries[oid] == nil {
+			unseen = append(unseen, &ManifestEntry{OID: oid, Size: size})
+		}
+	}
+	sort.Slice(unseen, func(i, j int) bool {
+		return bytes.Compare(unseen[i].OID.Bytes(), unseen[j].OID.Bytes()) < 0
+	})
+	order = append(order, unseen...)
+
+	for _, e := range order {
+		e.AtTip = atTip[e.OID]
+		if e.Paths == nil {
+			e.Paths = []string{}
+		}
+	}
+
+	if lfs {
+		var paths []string
+		for _, e := range order {
+			if len(e.Paths) != 0 {
+				paths = append(paths, e.Paths[0])
+			}
+		}
+		values, err := repo.CheckAttr(ctx, "HEAD", "filter", paths)
+		if err != nil {
+			return fmt.Errorf("checking gitattribute 'filter' in 'HEAD': %w", err)
+		}
+		for _, e := range order {
+			inLFS := len(e.Paths) != 0 && values[e.Paths[0]] == "lfs"
+			e.LFS = &inLFS
+		}
+	}
+
+	out := bufio.NewWriter(w)
+	enc := json.NewEncoder(out)
+	for _, e := range order {
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+	return out.Flush()
+}
+
+// addManifestPath adds `path` to the paths of `e`, unless it is
+// already listed or `e` already has `maxManifestPaths` of them.
+func addManifestPath(e *ManifestEntry, path string) {
+	if len(e.Paths) == maxManifestPaths {
+		return
+	}
+	for _, p := range e.Paths {
+		if p == path {
+			return
+		}
+	}
+	e.Paths = append(e.Paths, path)
+}
@@ -0,0 +1,117 @@
+package sizes
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/github/git-sizer/git"
+)
+
+// metricExamples keeps track of the `limit` objects with the highest
+// values of each footnoted statistic (see
+// `ScanOptions.NamesPerMetric`), keyed by the statistic's symbol
+// (e.g., "maxBlobSize"). Like `topTrees`, it only requests paths for
+// those objects, and forgets them again when an object drops out of
+// a list, so the memory needed doesn't grow with the size of the
+// repository.
+type metricExamples struct {
+	limit    int
+	bySymbol map[string][]metricExample
+}
+
+// metricExample is one of the objects in a list. The lists are sorted
+// by decreasing value and, among objects with the same value, by
+// increasing OID, so that the choice doesn't depend on the order in
+// which the objects are scanned.
+type metricExample struct {
+	oid   git.OID
+	value uint64
+	path  *Path
+}
+
+// before reports whether `e` belongs before `other` in a list.
+func (e metricExample) before(other metricExample) bool {
+	if e.value != other.value {
+		return e.value > other.value
+	}
+	return bytes.Compare(e.oid.Bytes(), other.oid.Bytes()) < 0
+}
+
+// newMetricExamples returns a `*metricExamples` that keeps track of
+// `limit` objects per statistic, or nil if `limit` is at most one
+// (in which case only the object recorded with the statistic itself
+// is named).
+func newMetricExamples(limit int) *metricExamples {
+	if limit <= 1 {
+		return nil
+	}
+	return &metricExamples{
+		limit:    limit,
+		bySymbol: make(map[string][]metricExample),
+	}
+}
+
+// consider records that the statistic `symbol` has the value `value`
+// for the object `oid`, of type `objectType`. The value for a given
+// object may only increase. It is a NOP if `m` is nil.
+func (m *metricExamples) consider(
+	pr PathResolver, symbol string, oid git.OID, objectType string, value uint64,
+) {
+	if m == nil || value == 0 {
+		return
+	}
+
+	example := metricExample{oid: oid, value: value}
+	examples := m.bySymbol[symbol]
+	n := len(examples)
+	if n == m.limit && !example.before(examples[n-1]) {
+		// If the object were already in the list, its old value
+		// would have been at least that of the last entry, so its
+		// new value would be greater.
+		return
+	}
+
+	found := false
+	for i, e := range examples {
+		if e.oid == oid {
+			example.path = e.path
+			examples = append(examples[:i], examples[i+1:]...)
+			found = true
+			break
+		}
+	}
+
+	n = len(examples)
+	if !found {
+		if n == m.limit {
+			if p := examples[n-1].path; p != nil {
+				pr.ForgetPath(p)
+			}
+			examples = examples[:n-1]
+			n--
+		}
+		example.path = pr.RequestPath(oid, objectType)
+	}
+
+	i := sort.Search(n, func(i int) bool { return !examples[i].before(example) })
+	examples = append(examples, metricExample{})
+	copy(examples[i+1:], examples[i:])
+	examples[i] = example
+	m.bySymbol[symbol] = examples
+}
+
+// result returns the paths of the objects in each list, in order.
+func (m *metricExamples) result() map[string][]*Path {
+	if m == nil {
+		return nil
+	}
+	paths := make(map[string][]*Path, len(m.bySymbol))
+	for symbol, examples := range m.bySymbol {
+		ps := make([]*Path, len(examples))
+		for i, e := range examples {
+			ps[i] = e.path
+		}
+		paths[symbol] = ps
+	}
+	return paths
+}
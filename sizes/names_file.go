@@ -0,0 +1,189 @@
+package sizes
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/github/git-sizer/counts"
+	"github.com/github/git-sizer/git"
+)
+
+// NamedObject is one of the objects that the output names, either in
+// the footnote of a statistic or in a list like `TopBlobs`.
+type NamedObject struct {
+	// Metric is the symbol of the statistic (e.g., "maxBlobSize"),
+	// or "topBlobs" or "widestTrees" for the lists.
+	Metric string
+
+	OID        git.OID
+	ObjectType git.ObjectType
+	Size       counts.Count32
+
+	// Path is the object's path within the tree of the commit via
+	// which it was found, or "" if that isn't known (or if the
+	// object is a commit or tag, or a root tree).
+	Path string
+
+	// Ref is the scanned reference via which the object was found,
+	// or "" if it was found via a commit that is named by its OID.
+	// Unlike with `--objects-from`, no reference is looked for in the
+	// latter case, since that would mean walking the history again.
+	Ref string
+}
+
+// NamedObjects returns the objects that the output of `s` names, with
+// their types and sizes: those in the footnotes of the statistics
+// (ordered by symbol, then as in the footnote), followed by those in
+// `TopBlobs` and `WidestTrees`. `rg` must be the `RefGrouper` that
+// was used for the scan. The references are taken from the names that
+// the scan gave the objects, so this only runs one git command.
+func (s *HistorySize) NamedObjects(
+	ctx context.Context, repo *git.Repository, rg RefGrouper,
+) ([]NamedObject, error) {
+	var objects []NamedObject
+
+	items := make(map[string]*item)
+	s.contents(rg.Groups()).CollectItems(items)
+	symbols := make([]string, 0, len(items))
+	for symbol := range items {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+
+	for _, symbol := range symbols {
+		i := items[symbol]
+		if i.path == nil || i.path.OID == git.NullOID {
+			continue
+		}
+		for _, p := range append([]*Path{i.path}, i.examples...) {
+			_, path, _ := p.TreePath()
+			objects = append(objects, NamedObject{
+				Metric: symbol,
+				OID:    p.OID,
+				Path:   path,
+				Ref:    pathRoot(p).relativePath,
+			})
+		}
+	}
+
+	if s.TopBlobs != nil {
+		for _, b := range s.TopBlobs.Blobs {
+			objects = append(objects, NamedObject{
+				Metric: "topBlobs",
+				OID:    b.OID,
+				Path:   b.Path,
+				Ref:    nameRef(b.Name),
+			})
+		}
+	}
+
+	for _, wt := range s.WidestTrees {
+		no := NamedObject{
+			Metric: "widestTrees",
+			OID:    wt.OID,
+		}
+		if wt.Commit != nil {
+			no.Path = wt.Path
+			no.Ref = nameRef(wt.Name)
+		}
+		objects = append(objects, no)
+	}
+
+	if len(objects) == 0 {
+		return nil, nil
+	}
+
+	oids := make([]git.OID, len(objects))
+	for i, no := range objects {
+		oids[i] = no.OID
+	}
+	headers, err := repo.ObjectHeaders(ctx, oids)
+	if err != nil {
+		return nil, fmt.Errorf("reading object sizes: %w", err)
+	}
+	for i, header := range headers {
+		objects[i].ObjectType = header.ObjectType
+		objects[i].Size = header.ObjectSize
+	}
+
+	return objects, nil
+}
+
+// namedObjectEntry is an entry of the "objects" table of the version 2
+// JSON output.
+type namedObjectEntry struct {
+	OID        git.OID        `json:"oid"`
+	ObjectType git.ObjectType `json:"type"`
+	Size       counts.Count32 `json:"size"`
+	Path       string         `json:"path,omitempty"`
+	Ref        string         `json:"ref,omitempty"`
+}
+
+// SetNamedObjects adds an "objects" table to the version 2 JSON
+// output, describing `objects` (as returned by `NamedObjects()`). It
+// is keyed by OID, so an object that is named more than once appears
+// only once, and each statistic with a footnote has an "objectKey"
+// field (as does each entry of its "objects" list) that refers to
+// it. The display strings in "objectName" and "objectDescription"
+// are still output as before.
+func (s *HistorySize) SetNamedObjects(objects []NamedObject) {
+	if len(objects) == 0 {
+		s.namedObjects = nil
+		return
+	}
+	s.namedObjects = make(map[string]namedObjectEntry, len(objects))
+	for _, no := range objects {
+		key := no.OID.String()
+		entry, ok := s.namedObjects[key]
+		if !ok {
+			entry = namedObjectEntry{
+				OID:        no.OID,
+				ObjectType: no.ObjectType,
+				Size:       no.Size,
+			}
+		}
+		if entry.Path == "" {
+			entry.Path = no.Path
+		}
+		if entry.Ref == "" {
+			entry.Ref = no.Ref
+		}
+		s.namedObjects[key] = entry
+	}
+}
+
+// nameRef returns the reference that the `rev-parse`-style name
+// `name` (e.g., `refs/heads/main:src/big.bin`) starts with, or "" if
+// it starts with the OID of a commit or tag instead. Since reference
+// names can't contain ':' or '^', that is all that can precede them.
+func nameRef(name string) string {
+	prefix := name
+	if i := strings.IndexAny(name, ":^"); i != -1 {
+		prefix = name[:i]
+	}
+	if strings.HasPrefix(prefix, "refs/") {
+		return prefix
+	}
+	return ""
+}
+
+// WriteNamedObjects writes `objects` to `w` as tab-separated values,
+// one object per line, after a header line naming the columns. Paths
+// and reference names are escaped like `git.DisplayString()` does, so
+// that they can't contain tabs or newlines.
+func WriteNamedObjects(w io.Writer, objects []NamedObject) error {
+	out := bufio.NewWriter(w)
+	fmt.Fprintln(out, "metric\toid\ttype\tsize\tpath\tref")
+	for _, no := range objects {
+		fmt.Fprintf(
+			out, "%s\t%s\t%s\t%d\t%s\t%s\n",
+			no.Metric, no.OID, no.ObjectType, no.Size,
+			git.DisplayString(no.Path), git.DisplayString(no.Ref),
+		)
+	}
+	return out.Flush()
+}
@@ -0,0 +1,220 @@
+package sizes
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/github/git-sizer/counts"
+	"github.com/github/git-sizer/git"
+)
+
+// ReferenceNamespaces are the reference namespaces that
+// `ComputeNamespaceObjects()` breaks the objects down by, in the order
+// that they are output. "pulls" covers both `refs/pull/` and
+// `refs/changes/` (i.e., code review references), and "other" covers
+// every reference that isn't in one of the others.
+var ReferenceNamespaces = []string{"heads", "tags", "remotes", "notes", "pulls", "other"}
+
+// referenceNamespace returns the namespace (one of
+// `ReferenceNamespaces`) that `refname` belongs to.
+func referenceNamespace(refname string) string {
+	switch {
+	case strings.HasPrefix(refname, "refs/heads/"):
+		return "heads"
+	case strings.HasPrefix(refname, "refs/tags/"):
+		return "tags"
+	case strings.HasPrefix(refname, "refs/remotes/"):
+		return "remotes"
+	case strings.HasPrefix(refname, "refs/notes/"):
+		return "notes"
+	case strings.HasPrefix(refname, "refs/pull/"), strings.HasPrefix(refname, "refs/changes/"):
+		return "pulls"
+	default:
+		return "other"
+	}
+}
+
+// NamespaceObjectCounts describes a set of objects by type.
+type NamespaceObjectCounts struct {
+	// RefCount is the number of included references in the namespace
+	// (zero for the "shared" and "total" rows).
+	RefCount counts.Count32 `json:"ref_count"`
+
+	CommitCount counts.Count64 `json:"commit_count"`
+	TreeCount   counts.Count64 `json:"tree_count"`
+	BlobCount   counts.Count64 `json:"blob_count"`
+	TagCount    counts.Count64 `json:"tag_count"`
+
+	// Size and DiskSize are the total uncompressed and on-disk sizes
+	// of the objects.
+	Size     counts.Count64 `json:"size"`
+	DiskSize counts.Count64 `json:"disk_size"`
+}
+
+func newNamespaceObjectCounts(byType map[git.ObjectType]git.ObjectsSize) NamespaceObjectCounts {
+	var c NamespaceObjectCounts
+	for objectType, size := range byType {
+		switch objectType {
+		case "commit":
+			c.CommitCount = counts.NewCount64(size.Count)
+		case "tree":
+			c.TreeCount = counts.NewCount64(size.Count)
+		case "blob":
+			c.BlobCount = counts.NewCount64(size.Count)
+		case "tag":
+			c.TagCount = counts.NewCount64(size.Count)
+		}
+		c.Size.Increment(counts.NewCount64(size.Size))
+		c.DiskSize.Increment(counts.NewCount64(size.DiskSize))
+	}
+	return c
+}
+
+// minus returns the counts in `c` less those in `other`. Since `git
+// rev-list` doesn't always exclude every object that is reachable from
+// the excluded references, the differences are clamped at zero.
+func (c NamespaceObjectCounts) minus(other NamespaceObjectCounts) NamespaceObjectCounts {
+	sub := func(a, b counts.Count64) counts.Count64 {
+		if b > a {
+			return 0
+		}
+		return a - b
+	}
+	return NamespaceObjectCounts{
+		CommitCount: sub(c.CommitCount, other.CommitCount),
+		TreeCount:   sub(c.TreeCount, other.TreeCount),
+		BlobCount:   sub(c.BlobCount, other.BlobCount),
+		TagCount:    sub(c.TagCount, other.TagCount),
+		Size:        sub(c.Size, other.Size),
+		DiskSize:    sub(c.DiskSize, other.DiskSize),
+	}
+}
+
+// NamespaceObjects breaks down the objects that are reachable from the
+// included references by reference namespace (see
+// `ReferenceNamespaces`). An object is counted in a namespace's row if
+// it is reachable from that namespace's references but not from any
+// other namespace's; the objects that are reachable from more than
+// one namespace are counted in the "shared" row. So each column sums
+// to the "total" row, which describes all of the reachable objects.
+//
+// It is keyed by namespace name, plus "shared" and "total".
+type NamespaceObjects map[string]NamespaceObjectCounts
+
+// ComputeNamespaceObjects computes the breakdown of the reachable
+// objects by reference namespace (see `NamespaceObjects`). Only
+// references that `rg` selects for walking are considered. This runs
+// one `git rev-list` for each namespace that has references, plus one
+// for all of them.
+func ComputeNamespaceObjects(
+	ctx context.Context, repo *git.Repository, rg RefGrouper,
+) (NamespaceObjects, error) {
+	refs, err := walkedReferences(ctx, repo, rg)
+	if err != nil {
+		return nil, err
+	}
+
+	var tips []git.OID
+	var tipNamespaces []string
+	refCounts := make(map[string]counts.Count32)
+	for _, ref := range refs {
+		namespace := referenceNamespace(ref.Refname)
+		tips = append(tips, ref.OID)
+		tipNamespaces = append(tipNamespaces, namespace)
+		refCounts[namespace]++
+	}
+
+	byType, err := repo.ReachableObjectsSizeByType(ctx, tips, nil)
+	if err != nil {
+		return nil, fmt.Errorf("measuring reachable objects: %w", err)
+	}
+	total := newNamespaceObjectCounts(byType)
+
+	nso := make(NamespaceObjects, len(ReferenceNamespaces)+2)
+	shared := total
+	for _, namespace := range ReferenceNamespaces {
+		var include, exclude []git.OID
+		for i, tip := range tips {
+			if tipNamespaces[i] == namespace {
+				include = append(include, tip)
+			} else {
+				exclude = append(exclude, tip)
+			}
+		}
+
+		byType, err := repo.ReachableObjectsSizeByType(ctx, include, exclude)
+		if err != nil {
+			return nil, fmt.Errorf("measuring objects exclusive to %s: %w", namespace, err)
+		}
+		c := newNamespaceObjectCounts(byType)
+		c.RefCount = refCounts[namespace]
+		nso[namespace] = c
+		shared = shared.minus(c)
+	}
+	nso["shared"] = shared
+	nso["total"] = total
+
+	return nso, nil
+}
+
+// jsonV2 returns `nso` the way that it is represented in the version 2
+// JSON output, with camelCase names.
+func (nso NamespaceObjects) jsonV2() interface{} {
+	type namespaceObjectCounts struct {
+		RefCount    counts.Count32 `json:"refCount"`
+		CommitCount counts.Count64 `json:"commitCount"`
+		TreeCount   counts.Count64 `json:"treeCount"`
+		BlobCount   counts.Count64 `json:"blobCount"`
+		TagCount    counts.Count64 `json:"tagCount"`
+		Size        counts.Count64 `json:"size"`
+		DiskSize    counts.Count64 `json:"diskSize"`
+	}
+	namespaces := make(map[string]namespaceObjectCounts, len(nso))
+	for name, c := range nso {
+		namespaces[name] = namespaceObjectCounts(c)
+	}
+	return namespaces
+}
+
+// String returns a human-readable matrix of the objects in each
+// namespace.
+func (nso NamespaceObjects) String() string {
+	if nso == nil {
+		return ""
+	}
+
+	size := func(n counts.Humanable) string {
+		numeral, unit := counts.Binary.Format(n, "B")
+		return strings.TrimSpace(numeral + " " + unit)
+	}
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "\nObjects reachable exclusively from each reference namespace:\n\n")
+	fmt.Fprintf(
+		buf, "    %-13s  %6s  %9s  %9s  %9s  %7s  %10s  %10s\n",
+		"Namespace", "Refs", "Commits", "Trees", "Blobs", "Tags", "Size", "Disk size",
+	)
+	row := func(label, refs string, c NamespaceObjectCounts) {
+		fmt.Fprintf(
+			buf, "    %-13s  %6s  %9d  %9d  %9d  %7d  %10s  %10s\n",
+			label, refs, c.CommitCount, c.TreeCount, c.BlobCount, c.TagCount,
+			size(c.Size), size(c.DiskSize),
+		)
+	}
+	for _, namespace := range ReferenceNamespaces {
+		c := nso[namespace]
+		if c.RefCount == 0 {
+			continue
+		}
+		label := namespace
+		if namespace == "pulls" {
+			label = "pulls/changes"
+		}
+		row(label, fmt.Sprint(c.RefCount), c)
+	}
+	row("shared", "", nso["shared"])
+	row("total", "", nso["total"])
+	return buf.String()
+}
@@ -0,0 +1,175 @@
+package sizes
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/github/git-sizer/counts"
+	"github.com/github/git-sizer/git"
+)
+
+// NotesOnlySize describes the objects that are reachable from git-notes
+// references (`refs/notes/*`) but not from any other included
+// reference. That is the space that the notes themselves occupy, and
+// that could be reclaimed by pruning them.
+type NotesOnlySize struct {
+	// NotesRefCount and OtherRefCount are the numbers of notes
+	// references and other references that were included.
+	NotesRefCount counts.Count32 `json:"notes_ref_count"`
+	OtherRefCount counts.Count32 `json:"other_ref_count"`
+
+	// ObjectCount, ObjectSize, and DiskSize describe the objects that
+	// are only reachable from notes references.
+	ObjectCount counts.Count64 `json:"object_count"`
+	ObjectSize  counts.Count64 `json:"object_size"`
+	DiskSize    counts.Count64 `json:"disk_size"`
+
+	// Refs describes what each notes reference contributes, most
+	// first.
+	Refs []NotesRefSize `json:"refs,omitempty"`
+}
+
+// NotesRefSize describes the objects that are reachable from one notes
+// reference but not from any other included reference (including
+// other notes references).
+type NotesRefSize struct {
+	Refname     string         `json:"refname"`
+	ObjectCount counts.Count64 `json:"object_count"`
+	ObjectSize  counts.Count64 `json:"object_size"`
+}
+
+// ComputeNotesOnlySize computes the size of the objects that are
+// reachable from notes references but not from other references (see
+// `NotesOnlySize`). Only references that `rg` selects for walking are
+// considered.
+func ComputeNotesOnlySize(
+	ctx context.Context, repo *git.Repository, rg RefGrouper,
+) (*NotesOnlySize, error) {
+	refs, err := walkedReferences(ctx, repo, rg)
+	if err != nil {
+		return nil, err
+	}
+
+	var notesRefs []string
+	var notes, others []git.OID
+	for _, ref := range refs {
+		if strings.HasPrefix(ref.Refname, "refs/notes/") {
+			notesRefs = append(notesRefs, ref.Refname)
+			notes = append(notes, ref.OID)
+		} else {
+			others = append(others, ref.OID)
+		}
+	}
+
+	total, err := repo.ReachableObjectsSize(ctx, notes, others)
+	if err != nil {
+		return nil, fmt.Errorf("measuring notes-only objects: %w", err)
+	}
+
+	nos := NotesOnlySize{
+		NotesRefCount: counts.NewCount32(uint64(len(notes))),
+		OtherRefCount: counts.NewCount32(uint64(len(others))),
+		ObjectCount:   counts.NewCount64(total.Count),
+		ObjectSize:    counts.NewCount64(total.Size),
+		DiskSize:      counts.NewCount64(total.DiskSize),
+	}
+
+	for i, refname := range notesRefs {
+		exclude := make([]git.OID, 0, len(others)+len(notes)-1)
+		exclude = append(exclude, others...)
+		exclude = append(exclude, notes[:i]...)
+		exclude = append(exclude, notes[i+1:]...)
+
+		size, err := repo.ReachableObjectsSize(ctx, notes[i:i+1], exclude)
+		if err != nil {
+			return nil, fmt.Errorf("measuring '%s': %w", git.DisplayString(refname), err)
+		}
+		nos.Refs = append(
+			nos.Refs,
+			NotesRefSize{
+				Refname:     refname,
+				ObjectCount: counts.NewCount64(size.Count),
+				ObjectSize:  counts.NewCount64(size.Size),
+			},
+		)
+	}
+	sort.SliceStable(nos.Refs, func(i, j int) bool {
+		return nos.Refs[i].ObjectSize > nos.Refs[j].ObjectSize
+	})
+
+	return &nos, nil
+}
+
+// jsonV2 returns `nos` the way that it is represented in the version 2
+// JSON output, with camelCase names.
+func (nos *NotesOnlySize) jsonV2() interface{} {
+	type notesRefSize struct {
+		Refname     string         `json:"refname"`
+		ObjectCount counts.Count64 `json:"objectCount"`
+		ObjectSize  counts.Count64 `json:"objectSize"`
+	}
+	refs := make([]notesRefSize, len(nos.Refs))
+	for i, r := range nos.Refs {
+		refs[i] = notesRefSize(r)
+	}
+	return struct {
+		NotesRefCount counts.Count32 `json:"notesRefCount"`
+		OtherRefCount counts.Count32 `json:"otherRefCount"`
+		ObjectCount   counts.Count64 `json:"objectCount"`
+		ObjectSize    counts.Count64 `json:"objectSize"`
+		DiskSize      counts.Count64 `json:"diskSize"`
+		Refs          []notesRefSize `json:"refs,omitempty"`
+	}{
+		NotesRefCount: nos.NotesRefCount,
+		OtherRefCount: nos.OtherRefCount,
+		ObjectCount:   nos.ObjectCount,
+		ObjectSize:    nos.ObjectSize,
+		DiskSize:      nos.DiskSize,
+		Refs:          refs,
+	}
+}
+
+// String returns a human-readable summary of the notes-only objects.
+func (nos *NotesOnlySize) String() string {
+	if nos == nil {
+		return ""
+	}
+
+	buf := &bytes.Buffer{}
+	if nos.NotesRefCount == 0 {
+		fmt.Fprintf(buf, "\nNo notes references were included\n")
+		return buf.String()
+	}
+
+	size := func(n counts.Humanable) string {
+		numeral, unit := counts.Binary.Format(n, "B")
+		return strings.TrimSpace(numeral + " " + unit)
+	}
+
+	fmt.Fprintf(
+		buf, "\nObjects reachable from notes references (%d) but not from any other reference (%d):\n\n",
+		nos.NotesRefCount, nos.OtherRefCount,
+	)
+
+	width := len("All notes references")
+	for _, r := range nos.Refs {
+		if w := len(git.DisplayString(r.Refname)); w > width {
+			width = w
+		}
+	}
+	fmt.Fprintf(buf, "    %-*s  %10s  %10s\n", width, "Reference", "Objects", "Size")
+	for _, r := range nos.Refs {
+		fmt.Fprintf(
+			buf, "    %-*s  %10d  %10s\n",
+			width, git.DisplayString(r.Refname), r.ObjectCount, size(r.ObjectSize),
+		)
+	}
+	fmt.Fprintf(
+		buf, "    %-*s  %10d  %10s\n",
+		width, "All notes references", nos.ObjectCount, size(nos.ObjectSize),
+	)
+	return buf.String()
+}
@@ -0,0 +1,228 @@
+package sizes
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/github/git-sizer/counts"
+	"github.com/github/git-sizer/git"
+)
+
+// ObjectLookup describes one of the objects listed in
+// `ScanOptions.LookupOIDs`.
+type ObjectLookup struct {
+	OID git.OID `json:"oid"`
+
+	// ObjectType is the type of the object, or "missing" if it
+	// doesn't exist in the repository.
+	ObjectType git.ObjectType `json:"type"`
+	Size       counts.Count32 `json:"size"`
+
+	// Reachable is true if the object was reached by the scan.
+	Reachable bool `json:"reachable"`
+
+	// Name is the `rev-parse`-style name (e.g.,
+	// `refs/heads/main:src/big.bin`) by which the scan first reached
+	// the object, if it is known.
+	Name string `json:"name,omitempty"`
+
+	// Ref is a scanned reference from which the object is
+	// reachable, if one is known.
+	Ref string `json:"ref,omitempty"`
+}
+
+// ObjectLookups lists the results of looking up the objects in
+// `ScanOptions.LookupOIDs`, in the order that they were listed.
+type ObjectLookups []ObjectLookup
+
+// objectLookup is an object that is being looked up during a scan.
+type objectLookup struct {
+	header git.BatchHeader
+
+	// path is the path requested for the object, if any.
+	path *Path
+}
+
+// ReadObjectIDs reads object IDs from `r`. Each line may contain any
+// number of full object IDs, separated by whitespace; other words
+// (e.g., those in the output of `git fsck`) are ignored, as are
+// blank lines and lines starting with '#'. Each object ID is returned
+// only once, in the order that they first appear.
+func ReadObjectIDs(r io.Reader) ([]git.OID, error) {
+	var oids []git.OID
+	seen := make(map[git.OID]bool)
+	in := bufio.NewScanner(r)
+	for in.Scan() {
+		line := strings.TrimSpace(in.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		for _, word := range strings.Fields(line) {
+			word = strings.TrimSuffix(word, ":")
+			if len(word) != 2*git.SHA1Size && len(word) != 2*git.SHA256Size {
+				continue
+			}
+			oid, err := git.NewOID(strings.ToLower(word))
+			if err != nil || seen[oid] {
+				continue
+			}
+			seen[oid] = true
+			oids = append(oids, oid)
+		}
+	}
+	if err := in.Err(); err != nil {
+		return nil, fmt.Errorf("reading object IDs: %w", err)
+	}
+	return oids, nil
+}
+
+// startObjectLookups looks up the types of `oids` and requests the
+// paths of the ones that exist. It must be called before any objects
+// are recorded with the path resolver.
+func (g *Graph) startObjectLookups(ctx context.Context, repo *git.Repository, oids []git.OID) error {
+	headers, err := repo.ObjectHeaders(ctx, oids)
+	if err != nil {
+		return fmt.Errorf("looking up objects: %w", err)
+	}
+	for _, header := range headers {
+		lookup := objectLookup{header: header}
+		if header.ObjectType != "missing" {
+			lookup.path = g.pathResolver.RequestPath(header.OID, string(header.ObjectType))
+		}
+		g.lookups = append(g.lookups, lookup)
+	}
+	return nil
+}
+
+// reached reports whether the scan reached the object `oid`, of type
+// `objectType`.
+func (g *Graph) reached(oid git.OID, objectType git.ObjectType) bool {
+	var ok bool
+	switch objectType {
+	case "blob":
+		g.blobLock.Lock()
+		_, ok = g.blobSizes.get(oid)
+		g.blobLock.Unlock()
+	case "tree":
+		g.treeLock.Lock()
+		_, ok = g.treeSizes.get(oid)
+		g.treeLock.Unlock()
+	case "commit":
+		g.commitLock.Lock()
+		_, ok = g.commitSizes.get(oid)
+		g.commitLock.Unlock()
+	case "tag":
+		g.tagLock.Lock()
+		_, ok = g.tagSizes[oid]
+		g.tagLock.Unlock()
+	}
+	return ok
+}
+
+// finishObjectLookups returns the results of the lookups started by
+// `startObjectLookups()`. It must be called after the scan.
+func (g *Graph) finishObjectLookups(repo *git.Repository) (ObjectLookups, error) {
+	lookups := make(ObjectLookups, 0, len(g.lookups))
+	for _, l := range g.lookups {
+		lookup := ObjectLookup{
+			OID:        l.header.OID,
+			ObjectType: l.header.ObjectType,
+			Size:       l.header.ObjectSize,
+			Reachable:  g.reached(l.header.OID, l.header.ObjectType),
+		}
+		if lookup.Reachable && l.path != nil {
+			lookup.Name = l.path.Path()
+			ref, err := reachingRef(repo, g.rg, l.path)
+			if err != nil {
+				return nil, err
+			}
+			lookup.Ref = ref
+		}
+		lookups = append(lookups, lookup)
+	}
+	return lookups, nil
+}
+
+// reachingRef returns the name of a scanned reference from which the
+// object whose path is `p` is reachable, or "" if none is known. If
+// the path starts at a reference, that is used. Otherwise, if it
+// starts at a commit, a walked reference that contains that commit is
+// looked for.
+func reachingRef(repo *git.Repository, rg RefGrouper, p *Path) (string, error) {
+	root := pathRoot(p)
+	if root.relativePath != "" {
+		return root.relativePath, nil
+	}
+	if root.objectType != "commit" {
+		return "", nil
+	}
+	return walkedRefContaining(repo, rg, root.OID)
+}
+
+// pathRoot returns the object that the path `p` starts at. Its
+// `relativePath` is the reference that it was reached from, if any.
+func pathRoot(p *Path) *Path {
+	for p.parent != nil {
+		p = p.parent
+	}
+	return p
+}
+
+// walkedRefContaining returns the name of a reference that `rg` walks
+// and whose history contains the commit `oid`, or "" if there is
+// none.
+func walkedRefContaining(repo *git.Repository, rg RefGrouper, oid git.OID) (string, error) {
+	refnames, err := repo.RefsContaining(oid)
+	if err != nil {
+		return "", err
+	}
+	for _, refname := range refnames {
+		if walk, _ := rg.Categorize(refname); walk {
+			return refname, nil
+		}
+	}
+	return "", nil
+}
+
+// String returns a human-readable list of the looked-up objects.
+func (ol ObjectLookups) String() string {
+	if ol == nil {
+		return ""
+	}
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "\nLooked-up objects (%d):\n\n", len(ol))
+	for _, l := range ol {
+		if l.ObjectType == "missing" {
+			fmt.Fprintf(buf, "    %s  missing\n", l.OID)
+			continue
+		}
+
+		numeral, unit := counts.Binary.Format(l.Size, "B")
+		fmt.Fprintf(
+			buf, "    %s  %-6s  %10s",
+			l.OID, l.ObjectType, strings.TrimSpace(numeral+" "+unit),
+		)
+		switch {
+		case !l.Reachable:
+			fmt.Fprint(buf, "  not reachable from the scanned references")
+		case l.Name != "" && l.Ref != "" && !strings.HasPrefix(l.Name, l.Ref):
+			fmt.Fprintf(
+				buf, "  %s (reachable from %s)",
+				git.DisplayString(l.Name), git.DisplayString(l.Ref),
+			)
+		case l.Name != "":
+			fmt.Fprintf(buf, "  %s", git.DisplayString(l.Name))
+		case l.Ref != "":
+			fmt.Fprintf(buf, "  reachable from %s", git.DisplayString(l.Ref))
+		default:
+			fmt.Fprint(buf, "  reachable")
+		}
+		fmt.Fprintln(buf)
+	}
+	return buf.String()
+}
@@ -0,0 +1,605 @@
+package sizes
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/github/git-sizer/counts"
+	"github.com/github/git-sizer/git"
+)
+
+// oidMapEntryBytes is a rough estimate of the memory that each entry
+// of an in-memory map keyed by OID takes, not counting the value but
+// including the map's overhead. It is used to turn a memory limit
+// into a number of entries.
+const oidMapEntryBytes = 60
+
+// oidRunIndexInterval is the number of records in each block of a
+// run whose first OID is kept in memory. A lookup reads one block.
+const oidRunIndexInterval = 128
+
+// oidRunMergeThreshold is the number of runs at which they are merged
+// into one, to limit the number of blocks that a lookup might have to
+// read.
+const oidRunMergeThreshold = 8
+
+// spillStore is the part of a table keyed by OID that has been
+// spilled to disk. Each of the typed stores below is normally just a
+// map. But if `limit` is positive and the map reaches that many
+// entries, they are written to a temporary file (a "run") sorted by
+// OID, and the map is started over. Lookups then have to consult the
+// runs, too, which is much slower than a map lookup, but the memory
+// that is used is bounded.
+//
+// An entry that is set again after it was spilled is looked up in the
+// newest place that has it: first the map, then the runs from newest
+// to oldest. Lookups can run concurrently with each other, but not
+// with `set()`; the graph's locks take care of that.
+//
+// I/O errors are remembered rather than returned, and reported by
+// `err()`. A lookup that fails reports the zero value, so the results
+// mustn't be used if `err()` is non-nil.
+type spillStore struct {
+	// what describes the table, for error messages.
+	what string
+
+	// valueSize is the number of bytes that each value takes on
+	// disk.
+	valueSize int
+
+	limit int
+
+	dir  string
+	runs []*oidRun
+
+	// spilledRuns is the number of runs that have been written,
+	// including any that have since been merged.
+	spilledRuns int
+
+	errLock  sync.Mutex
+	firstErr error
+}
+
+// oidRun is a temporary file holding fixed-size records, each
+// consisting of an OID in binary format followed by its value, sorted
+// by OID.
+type oidRun struct {
+	f         *os.File
+	oidSize   int
+	valueSize int
+	count     int
+	firstOID  [][]byte
+}
+
+// setMemoryLimit causes the entries to be spilled to disk if they
+// would take more than about `limit` bytes of memory. A limit of zero
+// means no limit.
+func (s *spillStore) setMemoryLimit(limit uint64, entryBytes uint64) {
+	if limit == 0 {
+		s.limit = 0
+		return
+	}
+	entries := limit / (oidMapEntryBytes + entryBytes)
+	if entries < oidRunIndexInterval {
+		entries = oidRunIndexInterval
+	}
+	s.limit = int(entries)
+}
+
+// full reports whether a map with `n` entries should be spilled.
+func (s *spillStore) full(n int) bool {
+	return s.limit > 0 && n >= s.limit
+}
+
+// lookup returns the value of `oid` from the newest run that has it.
+func (s *spillStore) lookup(oid git.OID) ([]byte, bool) {
+	for i := len(s.runs) - 1; i >= 0; i-- {
+		value, ok, err := s.runs[i].get(oid)
+		if err != nil {
+			s.recordErr(err)
+			return make([]byte, s.valueSize), true
+		}
+		if ok {
+			return value, true
+		}
+	}
+	return nil, false
+}
+
+func (s *spillStore) recordErr(err error) {
+	s.errLock.Lock()
+	defer s.errLock.Unlock()
+	if s.firstErr == nil {
+		s.firstErr = err
+	}
+}
+
+// err returns the first I/O error that occurred, if any.
+func (s *spillStore) err() error {
+	s.errLock.Lock()
+	defer s.errLock.Unlock()
+	if s.firstErr != nil {
+		return fmt.Errorf("spilling %s to disk: %w", s.what, s.firstErr)
+	}
+	return nil
+}
+
+// spill writes the entries `oids`, whose values `encode` fills in, to
+// a new run, and merges the runs if there are too many of them. It
+// reports whether the run was written; if so, the caller should start
+// a new map.
+func (s *spillStore) spill(oids []git.OID, encode func(oid git.OID, value []byte)) bool {
+	if s.err() != nil {
+		return false
+	}
+	if s.dir == "" {
+		dir, err := os.MkdirTemp("", "git-sizer-spill-")
+		if err != nil {
+			s.recordErr(err)
+			return false
+		}
+		s.dir = dir
+	}
+
+	sort.Slice(oids, func(i, j int) bool {
+		return bytes.Compare(oids[i].Bytes(), oids[j].Bytes()) < 0
+	})
+
+	value := make([]byte, s.valueSize)
+	run, err := s.writeRun(func(emit func(oid, value []byte) error) error {
+		for _, oid := range oids {
+			encode(oid, value)
+			if err := emit(oid.Bytes(), value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		s.recordErr(err)
+		return false
+	}
+	s.runs = append(s.runs, run)
+	s.spilledRuns++
+
+	if len(s.runs) >= oidRunMergeThreshold {
+		s.mergeRuns()
+	}
+	return true
+}
+
+// writeRun creates a new run containing the records that `fill`
+// emits, which must be in OID order.
+func (s *spillStore) writeRun(
+	fill func(emit func(oid, value []byte) error) error,
+) (*oidRun, error) {
+	f, err := os.CreateTemp(s.dir, "run-")
+	if err != nil {
+		return nil, err
+	}
+	run := &oidRun{f: f, valueSize: s.valueSize}
+	w := bufio.NewWriter(f)
+	emit := func(oid, value []byte) error {
+		if run.count == 0 {
+			run.oidSize = len(oid)
+		}
+		if run.count%oidRunIndexInterval == 0 {
+			run.firstOID = append(run.firstOID, append([]byte(nil), oid...))
+		}
+		run.count++
+		if _, err := w.Write(oid); err != nil {
+			return err
+		}
+		_, err := w.Write(value)
+		return err
+	}
+	if err := fill(emit); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return run, nil
+}
+
+// mergeRuns merges all of the runs into one. Where runs have the same
+// OID, the entry from the latest one wins.
+func (s *spillStore) mergeRuns() {
+	type cursor struct {
+		r    *bufio.Reader
+		rec  []byte
+		done bool
+	}
+
+	cursors := make([]*cursor, len(s.runs))
+	for i, run := range s.runs {
+		if _, err := run.f.Seek(0, 0); err != nil {
+			s.recordErr(err)
+			return
+		}
+		c := &cursor{
+			r:   bufio.NewReader(run.f),
+			rec: make([]byte, run.oidSize+s.valueSize),
+		}
+		cursors[i] = c
+	}
+	advance := func(c *cursor) error {
+		_, err := io.ReadFull(c.r, c.rec)
+		if err == io.EOF {
+			c.done = true
+			return nil
+		}
+		return err
+	}
+	for _, c := range cursors {
+		if err := advance(c); err != nil {
+			s.recordErr(err)
+			return
+		}
+	}
+
+	merged, err := s.writeRun(func(emit func(oid, value []byte) error) error {
+		for {
+			// Find the smallest OID, preferring the latest run:
+			best := -1
+			for i, c := range cursors {
+				if c.done {
+					continue
+				}
+				if best == -1 {
+					best = i
+					continue
+				}
+				oidSize := len(c.rec) - s.valueSize
+				if bytes.Compare(c.rec[:oidSize], cursors[best].rec[:oidSize]) <= 0 {
+					best = i
+				}
+			}
+			if best == -1 {
+				return nil
+			}
+
+			rec := cursors[best].rec
+			oidSize := len(rec) - s.valueSize
+			oid := append([]byte(nil), rec[:oidSize]...)
+			if err := emit(oid, rec[oidSize:]); err != nil {
+				return err
+			}
+
+			// Skip this OID in every run:
+			for _, c := range cursors {
+				for !c.done && bytes.Equal(c.rec[:len(c.rec)-s.valueSize], oid) {
+					if err := advance(c); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	})
+	if err != nil {
+		s.recordErr(err)
+		return
+	}
+
+	for _, run := range s.runs {
+		run.close()
+	}
+	s.runs = []*oidRun{merged}
+}
+
+// close removes the runs, if any were written.
+func (s *spillStore) close() {
+	for _, run := range s.runs {
+		run.close()
+	}
+	s.runs = nil
+	if s.dir != "" {
+		os.RemoveAll(s.dir)
+		s.dir = ""
+	}
+}
+
+// get looks up `oid` in the run. It reads the one block that could
+// contain it.
+func (run *oidRun) get(oid git.OID) ([]byte, bool, error) {
+	key := oid.Bytes()
+	if run.count == 0 || len(key) != run.oidSize {
+		return nil, false, nil
+	}
+
+	// The last block whose first OID is <= key:
+	block := sort.Search(len(run.firstOID), func(i int) bool {
+		return bytes.Compare(run.firstOID[i], key) > 0
+	}) - 1
+	if block < 0 {
+		return nil, false, nil
+	}
+
+	recSize := run.oidSize + run.valueSize
+	first := block * oidRunIndexInterval
+	n := run.count - first
+	if n > oidRunIndexInterval {
+		n = oidRunIndexInterval
+	}
+	buf := make([]byte, n*recSize)
+	if _, err := run.f.ReadAt(buf, int64(first*recSize)); err != nil {
+		return nil, false, err
+	}
+
+	i := sort.Search(n, func(i int) bool {
+		return bytes.Compare(buf[i*recSize:i*recSize+run.oidSize], key) >= 0
+	})
+	if i == n || !bytes.Equal(buf[i*recSize:i*recSize+run.oidSize], key) {
+		return nil, false, nil
+	}
+	return buf[i*recSize+run.oidSize : (i+1)*recSize], true, nil
+}
+
+func (run *oidRun) close() {
+	run.f.Close()
+	os.Remove(run.f.Name())
+}
+
+// count32Store remembers a `Count32` for each OID, for example the
+// size of each blob or the number of references to it.
+type count32Store struct {
+	spillStore
+	mem map[git.OID]counts.Count32
+}
+
+func newCount32Store(what string) *count32Store {
+	return &count32Store{
+		spillStore: spillStore{what: what, valueSize: 4},
+		mem:        make(map[git.OID]counts.Count32),
+	}
+}
+
+func (s *count32Store) setMemoryLimit(limit uint64) {
+	s.spillStore.setMemoryLimit(limit, 4)
+}
+
+func (s *count32Store) set(oid git.OID, n counts.Count32) {
+	s.mem[oid] = n
+	if !s.full(len(s.mem)) {
+		return
+	}
+	oids := make([]git.OID, 0, len(s.mem))
+	for oid := range s.mem {
+		oids = append(oids, oid)
+	}
+	if s.spill(oids, func(oid git.OID, value []byte) {
+		binary.BigEndian.PutUint32(value, uint32(s.mem[oid]))
+	}) {
+		// Start a new map rather than emptying the old one, so that
+		// the old one's memory can be reclaimed:
+		s.mem = make(map[git.OID]counts.Count32)
+	}
+}
+
+func (s *count32Store) get(oid git.OID) (counts.Count32, bool) {
+	if n, ok := s.mem[oid]; ok {
+		return n, true
+	}
+	if value, ok := s.lookup(oid); ok {
+		return counts.Count32(binary.BigEndian.Uint32(value)), true
+	}
+	return 0, false
+}
+
+// oidSetStore remembers a set of OIDs.
+type oidSetStore struct {
+	spillStore
+	mem map[git.OID]struct{}
+}
+
+func newOIDSetStore(what string) *oidSetStore {
+	return &oidSetStore{
+		spillStore: spillStore{what: what},
+		mem:        make(map[git.OID]struct{}),
+	}
+}
+
+func (s *oidSetStore) setMemoryLimit(limit uint64) {
+	s.spillStore.setMemoryLimit(limit, 0)
+}
+
+func (s *oidSetStore) add(oid git.OID) {
+	s.mem[oid] = struct{}{}
+	if !s.full(len(s.mem)) {
+		return
+	}
+	oids := make([]git.OID, 0, len(s.mem))
+	for oid := range s.mem {
+		oids = append(oids, oid)
+	}
+	if s.spill(oids, func(git.OID, []byte) {}) {
+		s.mem = make(map[git.OID]struct{})
+	}
+}
+
+func (s *oidSetStore) has(oid git.OID) bool {
+	if _, ok := s.mem[oid]; ok {
+		return true
+	}
+	_, ok := s.lookup(oid)
+	return ok
+}
+
+// oidStore remembers an OID for each OID, for example the tree of
+// each commit. On disk, each value is its length followed by its
+// bytes, padded to the longest OID.
+type oidStore struct {
+	spillStore
+	mem map[git.OID]git.OID
+}
+
+func newOIDStore(what string) *oidStore {
+	return &oidStore{
+		spillStore: spillStore{what: what, valueSize: 1 + git.SHA256Size},
+		mem:        make(map[git.OID]git.OID),
+	}
+}
+
+func (s *oidStore) setMemoryLimit(limit uint64) {
+	s.spillStore.setMemoryLimit(limit, 1+git.SHA256Size)
+}
+
+func (s *oidStore) set(oid git.OID, v git.OID) {
+	s.mem[oid] = v
+	if !s.full(len(s.mem)) {
+		return
+	}
+	oids := make([]git.OID, 0, len(s.mem))
+	for oid := range s.mem {
+		oids = append(oids, oid)
+	}
+	if s.spill(oids, func(oid git.OID, value []byte) {
+		b := s.mem[oid].Bytes()
+		value[0] = byte(len(b))
+		n := copy(value[1:], b)
+		for i := 1 + n; i < len(value); i++ {
+			value[i] = 0
+		}
+	}) {
+		s.mem = make(map[git.OID]git.OID)
+	}
+}
+
+func (s *oidStore) get(oid git.OID) (git.OID, bool) {
+	if v, ok := s.mem[oid]; ok {
+		return v, true
+	}
+	if value, ok := s.lookup(oid); ok {
+		if value[0] == 0 {
+			return git.OID{}, true
+		}
+		v, err := git.OIDFromBytes(value[1 : 1+int(value[0])])
+		if err != nil {
+			s.recordErr(err)
+		}
+		return v, true
+	}
+	return git.OID{}, false
+}
+
+// treeSizeStore remembers the `TreeSize` of each tree.
+type treeSizeStore struct {
+	spillStore
+	mem map[git.OID]TreeSize
+}
+
+// treeSizeRecordSize is the number of bytes that a `TreeSize` takes
+// on disk: six `Count32`s and a `Count64`.
+const treeSizeRecordSize = 6*4 + 8
+
+func newTreeSizeStore() *treeSizeStore {
+	return &treeSizeStore{
+		spillStore: spillStore{what: "tree sizes", valueSize: treeSizeRecordSize},
+		mem:        make(map[git.OID]TreeSize),
+	}
+}
+
+func (s *treeSizeStore) setMemoryLimit(limit uint64) {
+	s.spillStore.setMemoryLimit(limit, treeSizeRecordSize)
+}
+
+func (s *treeSizeStore) set(oid git.OID, size TreeSize) {
+	s.mem[oid] = size
+	if !s.full(len(s.mem)) {
+		return
+	}
+	oids := make([]git.OID, 0, len(s.mem))
+	for oid := range s.mem {
+		oids = append(oids, oid)
+	}
+	if s.spill(oids, func(oid git.OID, value []byte) {
+		size := s.mem[oid]
+		be := binary.BigEndian
+		be.PutUint32(value[0:], uint32(size.MaxPathDepth))
+		be.PutUint32(value[4:], uint32(size.MaxPathLength))
+		be.PutUint32(value[8:], uint32(size.ExpandedTreeCount))
+		be.PutUint32(value[12:], uint32(size.ExpandedBlobCount))
+		be.PutUint32(value[16:], uint32(size.ExpandedLinkCount))
+		be.PutUint32(value[20:], uint32(size.ExpandedSubmoduleCount))
+		be.PutUint64(value[24:], uint64(size.ExpandedBlobSize))
+	}) {
+		s.mem = make(map[git.OID]TreeSize)
+	}
+}
+
+func (s *treeSizeStore) get(oid git.OID) (TreeSize, bool) {
+	if size, ok := s.mem[oid]; ok {
+		return size, true
+	}
+	value, ok := s.lookup(oid)
+	if !ok {
+		return TreeSize{}, false
+	}
+	be := binary.BigEndian
+	return TreeSize{
+		MaxPathDepth:           counts.Count32(be.Uint32(value[0:])),
+		MaxPathLength:          counts.Count32(be.Uint32(value[4:])),
+		ExpandedTreeCount:      counts.Count32(be.Uint32(value[8:])),
+		ExpandedBlobCount:      counts.Count32(be.Uint32(value[12:])),
+		ExpandedLinkCount:      counts.Count32(be.Uint32(value[16:])),
+		ExpandedSubmoduleCount: counts.Count32(be.Uint32(value[20:])),
+		ExpandedBlobSize:       counts.Count64(be.Uint64(value[24:])),
+	}, true
+}
+
+// commitSizeStore remembers the `CommitSize` of each commit.
+type commitSizeStore struct {
+	spillStore
+	mem map[git.OID]CommitSize
+}
+
+func newCommitSizeStore() *commitSizeStore {
+	return &commitSizeStore{
+		spillStore: spillStore{what: "commit sizes", valueSize: 8},
+		mem:        make(map[git.OID]CommitSize),
+	}
+}
+
+func (s *commitSizeStore) setMemoryLimit(limit uint64) {
+	s.spillStore.setMemoryLimit(limit, 8)
+}
+
+func (s *commitSizeStore) set(oid git.OID, size CommitSize) {
+	s.mem[oid] = size
+	if !s.full(len(s.mem)) {
+		return
+	}
+	oids := make([]git.OID, 0, len(s.mem))
+	for oid := range s.mem {
+		oids = append(oids, oid)
+	}
+	if s.spill(oids, func(oid git.OID, value []byte) {
+		size := s.mem[oid]
+		binary.BigEndian.PutUint32(value[0:], uint32(size.MaxAncestorDepth))
+		binary.BigEndian.PutUint32(value[4:], uint32(size.MaxMergeDepth))
+	}) {
+		s.mem = make(map[git.OID]CommitSize)
+	}
+}
+
+func (s *commitSizeStore) get(oid git.OID) (CommitSize, bool) {
+	if size, ok := s.mem[oid]; ok {
+		return size, true
+	}
+	value, ok := s.lookup(oid)
+	if !ok {
+		return CommitSize{}, false
+	}
+	return CommitSize{
+		MaxAncestorDepth: counts.Count32(binary.BigEndian.Uint32(value[0:])),
+		MaxMergeDepth:    counts.Count32(binary.BigEndian.Uint32(value[4:])),
+	}, true
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"math"
 	"strconv"
 	"strings"
 
@@ -32,8 +33,8 @@ func (s TreeSize) String() string {
 
 func (s CommitSize) String() string {
 	return fmt.Sprintf(
-		"max_ancestor_depth=%d",
-		s.MaxAncestorDepth,
+		"max_ancestor_depth=%d, max_merge_depth=%d",
+		s.MaxAncestorDepth, s.MaxMergeDepth,
 	)
 }
 
@@ -67,10 +68,17 @@ func (s *HistorySize) String() string {
 }
 
 const (
-	spaces = "                            "
+	spaces = "                              "
 	stars  = "******************************"
 )
 
+// ANSI escape sequences used to colorize the levels of concern.
+const (
+	colorWarning  = "\x1b[33m"
+	colorCritical = "\x1b[1;31m"
+	colorReset    = "\x1b[0m"
+)
+
 // Zero or more lines in the tabular output.
 type tableContents interface {
 	Emit(t *table)
@@ -117,6 +125,28 @@ type item struct {
 	humaner     counts.Humaner
 	unit        string
 	scale       float64
+
+	// note, if set, is appended to the footnote for `path` when
+	// full names are being shown.
+	note string
+
+	// examples, if set, are more objects that are listed in the
+	// footnote after `path`.
+	examples []*Path
+
+	// numbered is set if `path` and `examples` are the objects with
+	// the highest values, in order, in which case they are numbered
+	// in the footnote and all listed in the JSON output.
+	numbered bool
+
+	// estimate, if set, tells how the value was derived in a quick
+	// scan: `estimateExtrapolated` or `estimateLowerBound`.
+	estimate string
+
+	// keyed is set if the JSON output has an "objects" table (see
+	// `HistorySize.SetNamedObjects()`), in which case the objects
+	// are also given by their keys in it.
+	keyed bool
 }
 
 func newItem(
@@ -141,12 +171,41 @@ func newItem(
 	}
 }
 
+// withNote sets the note that is appended to the footnote of `i`
+// and returns `i`.
+func (i *item) withNote(note string) *item {
+	i.note = note
+	return i
+}
+
+// withExamples sets the objects that are listed in the footnote of
+// `i`, and returns `i`. The first one becomes `i`'s path.
+func (i *item) withExamples(paths []*Path) *item {
+	if len(paths) != 0 {
+		i.path = paths[0]
+		i.examples = paths[1:]
+	}
+	return i
+}
+
+// withRanking sets the objects with the highest values of `i`, in
+// order, which are numbered in its footnote, and returns `i`.
+func (i *item) withRanking(paths []*Path) *item {
+	if len(paths) != 0 && (i.path == nil || paths[0].OID != i.path.OID) {
+		// The note describes an object that isn't listed first.
+		i.note = ""
+	}
+	i.withExamples(paths)
+	i.numbered = len(paths) != 0
+	return i
+}
+
 func (i *item) Emit(t *table) {
 	levelOfConcern, interesting := i.levelOfConcern(t.threshold)
 	if !interesting {
 		return
 	}
-	valueString, unitString := i.humaner.Format(i.value, i.unit)
+	valueString, unitString := i.format()
 	t.formatRow(
 		i.name, t.footnotes.CreateCitation(i.Footnote(t.nameStyle)),
 		valueString, unitString,
@@ -154,6 +213,20 @@ func (i *item) Emit(t *table) {
 	)
 }
 
+// format returns the value and unit of `i` as they are shown in the
+// table. Extrapolated values are marked with a leading "~", and lower
+// bounds with a trailing "+".
+func (i *item) format() (string, string) {
+	valueString, unitString := i.humaner.Format(i.value, i.unit)
+	switch i.estimate {
+	case estimateExtrapolated:
+		valueString = "~" + valueString
+	case estimateLowerBound:
+		valueString += "+"
+	}
+	return valueString, unitString
+}
+
 func (i *item) Footnote(nameStyle NameStyle) string {
 	if i.path == nil || i.path.OID == git.NullOID {
 		return ""
@@ -162,18 +235,53 @@ func (i *item) Footnote(nameStyle NameStyle) string {
 	case NameStyleNone:
 		return ""
 	case NameStyleHash:
-		return i.path.OID.String()
+		lines := []string{i.path.OID.String()}
+		for _, p := range i.examples {
+			lines = append(lines, p.OID.String())
+		}
+		return i.joinFootnoteLines(lines)
 	case NameStyleFull:
-		return i.path.String()
+		if i.note != "" && !i.numbered {
+			return git.DisplayString(i.path.String() + " " + i.note)
+		}
+		lines := []string{git.DisplayString(i.path.String())}
+		if i.note != "" {
+			// The note describes the first object only.
+			lines[0] = git.DisplayString(i.path.String() + " " + i.note)
+		}
+		for _, p := range i.examples {
+			lines = append(lines, git.DisplayString(p.String()))
+		}
+		return i.joinFootnoteLines(lines)
 	default:
 		panic("unexpected NameStyle")
 	}
 }
 
+// footnoteContinuation separates the lines of a footnote that lists
+// several objects, aligning them with the first one.
+const footnoteContinuation = "\n     "
+
+// joinFootnoteLines joins the lines of a footnote, numbering them if
+// `i` is numbered.
+func (i *item) joinFootnoteLines(lines []string) string {
+	if i.numbered {
+		for n := range lines {
+			lines[n] = fmt.Sprintf("%d. %s", n+1, lines[n])
+		}
+	}
+	return strings.Join(lines, footnoteContinuation)
+}
+
 // If this item's alert level is at least as high as the threshold,
 // return the string that should be used as its "level of concern" and
-// `true`; otherwise, return `"", false`.
+// `true`; otherwise, return `"", false`. Informational items (those
+// with a `scale` of zero) never get stars, and are only shown if the
+// threshold is zero (e.g., with `--verbose`).
 func (i *item) levelOfConcern(threshold Threshold) (string, bool) {
+	if i.scale == 0 {
+		return "", threshold <= 0
+	}
 	value, overflow := i.value.ToUint64()
 	if overflow {
 		return "!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!", true
@@ -192,36 +300,98 @@ func (i *item) CollectItems(items map[string]*item) {
 	items[i.symbol] = i
 }
 
+// alertLevel returns the level of concern of `i` as a number; i.e.,
+// the ratio of its value to its reference value.
+func (i *item) alertLevel() float64 {
+	if i.scale == 0 {
+		return 0
+	}
+	value, overflow := i.value.ToUint64()
+	if overflow {
+		return math.MaxFloat64
+	}
+	return float64(value) / i.scale
+}
+
+// quantity returns what kind of quantity `i` measures, for the JSON
+// output: "bytes", "count", or "percent".
+func (i *item) quantity() string {
+	switch i.unit {
+	case "B":
+		return "bytes"
+	case "%":
+		return "percent"
+	default:
+		return "count"
+	}
+}
+
 func (i *item) MarshalJSON() ([]byte, error) {
 	// How we want to emit an item as JSON.
 	value, _ := i.value.ToUint64()
 
+	// The same value and label that are shown in the table:
+	valueString, unitString := i.format()
+
 	stat := struct {
-		Description       string  `json:"description"`
-		Value             uint64  `json:"value"`
-		Unit              string  `json:"unit"`
-		Prefixes          string  `json:"prefixes"`
-		ReferenceValue    float64 `json:"referenceValue"`
-		LevelOfConcern    float64 `json:"levelOfConcern"`
-		ObjectName        string  `json:"objectName,omitempty"`
-		ObjectDescription string  `json:"objectDescription,omitempty"`
+		Description       string       `json:"description"`
+		Value             uint64       `json:"value"`
+		Unit              string       `json:"unit"`
+		Prefixes          string       `json:"prefixes"`
+		ReferenceValue    float64      `json:"referenceValue"`
+		LevelOfConcern    float64      `json:"levelOfConcern"`
+		ObjectName        string       `json:"objectName,omitempty"`
+		ObjectDescription string       `json:"objectDescription,omitempty"`
+		ObjectKey         string       `json:"objectKey,omitempty"`
+		Objects           []jsonObject `json:"objects,omitempty"`
+		Quantity          string       `json:"quantity"`
+		HumanValue        string       `json:"humanValue"`
+		Label             string       `json:"label"`
+		Estimate          string       `json:"estimate,omitempty"`
 	}{
 		Description:    i.description,
 		Value:          value,
 		Unit:           i.unit,
 		Prefixes:       i.humaner.Name(),
 		ReferenceValue: i.scale,
-		LevelOfConcern: float64(value) / i.scale,
+		LevelOfConcern: i.alertLevel(),
+		Quantity:       i.quantity(),
+		HumanValue:     strings.TrimSpace(valueString + " " + unitString),
+		Label:          i.name,
+		Estimate:       i.estimate,
 	}
 
 	if i.path != nil && i.path.OID != git.NullOID {
 		stat.ObjectName = i.path.OID.String()
 		stat.ObjectDescription = i.path.Path()
+		if i.keyed {
+			stat.ObjectKey = stat.ObjectName
+		}
+		if i.numbered {
+			for _, p := range append([]*Path{i.path}, i.examples...) {
+				o := jsonObject{
+					ObjectName:        p.OID.String(),
+					ObjectDescription: p.Path(),
+				}
+				if i.keyed {
+					o.ObjectKey = o.ObjectName
+				}
+				stat.Objects = append(stat.Objects, o)
+			}
+		}
 	}
 
 	return json.Marshal(stat)
 }
 
+// jsonObject is how one of the objects with the highest values of an
+// item is emitted in the JSON output.
+type jsonObject struct {
+	ObjectName        string `json:"objectName"`
+	ObjectDescription string `json:"objectDescription"`
+	ObjectKey         string `json:"objectKey,omitempty"`
+}
+
 // Indented returns an `item` that is just like `i`, but indented by
 // `depth` more levels.
 func (i *item) Indented(depth int) tableContents {
@@ -279,10 +449,10 @@ func (t *Threshold) Type() string {
 // A `pflag.Value` that can be used as a boolean option that sets a
 // `Threshold` variable to a fixed value. For example,
 //
-//		pflag.Var(
-//			sizes.NewThresholdFlagValue(&threshold, 30),
-//			"critical", "only report critical statistics",
-//		)
+//	pflag.Var(
+//		sizes.NewThresholdFlagValue(&threshold, 30),
+//		"critical", "only report critical statistics",
+//	)
 //
 // adds a `--critical` flag that sets `threshold` to 30.
 type thresholdFlagValue struct {
@@ -365,19 +535,74 @@ func (n *NameStyle) Type() string {
 type table struct {
 	threshold     Threshold
 	nameStyle     NameStyle
+	colorize      bool
 	sectionHeader string
 	footnotes     *Footnotes
 	indent        int
 	buf           bytes.Buffer
 }
 
+// TableString returns the tabular representation of `s`. If
+// `colorize` is true, the levels of concern are highlighted using
+// ANSI escape sequences.
 func (s *HistorySize) TableString(
-	refGroups []RefGroup, threshold Threshold, nameStyle NameStyle,
+	refGroups []RefGroup, threshold Threshold, nameStyle NameStyle, colorize bool,
 ) string {
 	contents := s.contents(refGroups)
 	t := table{
 		threshold: threshold,
 		nameStyle: nameStyle,
+		colorize:  colorize,
+		footnotes: NewFootnotes(),
+		indent:    -1,
+	}
+
+	contents.Emit(&t)
+
+	var result string
+	if t.buf.Len() == 0 {
+		result = "No problems above the current threshold were found\n"
+	} else {
+		result = t.generateHeader() + t.buf.String() + t.footnotes.String()
+		if s.Worst != nil && Threshold(s.Worst.LevelOfConcern) >= threshold {
+			result += "\n" + s.Worst.String()
+		}
+	}
+
+	var partial string
+	switch {
+	case len(s.LeftOut) != 0:
+		partial = fmt.Sprintf(
+			"NOTE: git-sizer was interrupted after the scan, so these results leave out\n"+
+				"what was asked for by %s.\n\n",
+			strings.Join(s.LeftOut, ", "),
+		)
+	case s.Partial:
+		partial = "NOTE: The scan was interrupted, so these results are partial.\n\n"
+	}
+
+	return partial + s.Scope.String() + s.Sample.String() + s.QuickScan.String() + result +
+		s.CommitDates.tableString(threshold) + s.histogramsString() +
+		s.PackStats.String() + s.Archive.String() + s.CommitterDomains.String() +
+		s.WidestTrees.String() + s.TopBlobs.String() + s.TopBlobsByAttribute.String() +
+		s.TopBlobHistory.String() + s.Renames.String() + s.LFSSizes.String() + s.ObjectLookups.String() +
+		s.RepoType.String() + s.DuplicateNames.String() + s.Attributes.String() + s.Remotes.String() + s.Namespaces.String() + s.Comparison.String() + s.TagOnly.String() + s.NotesOnly.String() + s.RefSharing.String() +
+		s.GitlinkCheck.String() +
+		s.Submodules.String() + s.Combined.String() + s.Growth.String() +
+		s.TreeAnomalies.String() + s.BrokenReferences.String() + s.Errors.String()
+}
+
+// SnapshotTableString returns just the main table of `s`, without
+// footnotes, for displaying statistics that were passed to
+// `ScanOptions.Snapshot` while the scan is still running.
+func (s *HistorySize) SnapshotTableString(
+	refGroups []RefGroup, threshold Threshold, colorize bool,
+) string {
+	contents := s.contents(refGroups)
+	t := table{
+		threshold: threshold,
+		nameStyle: NameStyleNone,
+		colorize:  colorize,
 		footnotes: NewFootnotes(),
 		indent:    -1,
 	}
@@ -385,16 +610,70 @@ func (s *HistorySize) TableString(
 	contents.Emit(&t)
 
 	if t.buf.Len() == 0 {
-		return "No problems above the current threshold were found\n"
+		return "No problems above the current threshold have been found so far\n"
+	}
+	return t.generateHeader() + t.buf.String()
+}
+
+// String returns a human-readable warning listing the broken
+// references, or the empty string if there were none.
+func (b *BrokenReferences) String() string {
+	if b == nil || b.Count == 0 {
+		return ""
+	}
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(
+		buf, "\nWarning: %d reference(s) point at missing objects and were not scanned:\n\n",
+		b.Count,
+	)
+	for _, ref := range b.References {
+		fmt.Fprintf(buf, "    %s -> %s\n", git.DisplayString(ref.Refname), ref.OID)
+	}
+	return buf.String()
+}
+
+// String returns a line identifying the statistic, its value, and its
+// level of concern.
+func (st *Statistic) String() string {
+	valueString, unitString := st.item.format()
+	levelOfConcern, _ := st.item.levelOfConcern(0)
+	return fmt.Sprintf(
+		"Highest concern: %s = %s (level %.2f %s: %s)\n",
+		st.Symbol, strings.TrimSpace(valueString+" "+unitString),
+		st.LevelOfConcern, levelOfConcern, st.Description,
+	)
+}
+
+// String returns a human-readable description of the corrupt objects
+// that were encountered, or the empty string if there were none.
+func (c *CorruptObjects) String() string {
+	if c == nil || c.Count == 0 {
+		return ""
 	}
 
-	return t.generateHeader() + t.buf.String() + t.footnotes.String()
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "\nCorruption encountered: %d object(s) could not be read", c.Count)
+	if uint64(c.Count) > uint64(len(c.Objects)) {
+		fmt.Fprintf(buf, " (showing the first %d)", len(c.Objects))
+	}
+	buf.WriteString(":\n\n")
+	for _, obj := range c.Objects {
+		objectType := obj.ObjectType
+		if objectType == "" {
+			objectType = "unknown type"
+		}
+		fmt.Fprintf(buf, "    %s (%s): %s\n", obj.OID, objectType, git.DisplayString(obj.Error))
+	}
+	buf.WriteString("\nThe statistics above do not include these objects.\n")
+	return buf.String()
 }
 
 func (t *table) indented(sectionHeader string, depth int) *table {
 	return &table{
 		threshold:     t.threshold,
 		nameStyle:     t.nameStyle,
+		colorize:      t.colorize,
 		sectionHeader: sectionHeader,
 		footnotes:     t.footnotes,
 		indent:        t.indent + depth,
@@ -449,22 +728,261 @@ func (t *table) formatRow(
 		spacer = spaces[:28-l]
 	}
 	fmt.Fprintf(
-		&t.buf, "| %s%s%s%s | %5s %-3s | %-30s |\n",
-		prefix, name, spacer, citation, valueString, unitString, levelOfConcern,
+		&t.buf, "| %s%s%s%s | %5s %-3s | %s |\n",
+		prefix, name, spacer, citation, valueString, unitString,
+		t.formatLevelOfConcern(levelOfConcern),
 	)
 }
 
+// formatLevelOfConcern pads `levelOfConcern` to the width of its
+// column and, if requested, colors it according to its severity. The
+// escape sequences are added outside of the padding so that they
+// don't disturb the alignment of the table.
+func (t *table) formatLevelOfConcern(levelOfConcern string) string {
+	padding := ""
+	if len(levelOfConcern) < 30 {
+		padding = spaces[:30-len(levelOfConcern)]
+	}
+	if !t.colorize || levelOfConcern == "" {
+		return levelOfConcern + padding
+	}
+
+	color := colorWarning
+	if len(levelOfConcern) >= 30 {
+		color = colorCritical
+	}
+	return color + levelOfConcern + colorReset + padding
+}
+
 func (s *HistorySize) JSON(
 	refGroups []RefGroup, threshold Threshold, nameStyle NameStyle,
 ) ([]byte, error) {
+	j, err := json.MarshalIndent(s.jsonMap(refGroups), "", "    ")
+	return j, err
+}
+
+// pathOID returns the OID of the object described by `p`, for the
+// version 2 JSON output, or "" if `p` is nil.
+func pathOID(p *Path) string {
+	if p == nil || p.OID == git.NullOID {
+		return ""
+	}
+	return p.OID.String()
+}
+
+// pathRef returns the reference-based name (e.g.,
+// "refs/heads/main:dir") under which the object described by `p` was
+// found, for the version 2 JSON output, or "" if it isn't known.
+func pathRef(p *Path) string {
+	if p == nil {
+		return ""
+	}
+	return p.Path()
+}
+
+// jsonMap returns the contents of the version 2 JSON output for `s`,
+// ready to be marshaled.
+func (s *HistorySize) jsonMap(refGroups []RefGroup) map[string]interface{} {
 	contents := s.contents(refGroups)
 	items := make(map[string]*item)
 	contents.CollectItems(items)
-	j, err := json.MarshalIndent(items, "", "    ")
-	return j, err
+
+	output := make(map[string]interface{}, len(items)+5)
+	for symbol, item := range items {
+		item.keyed = s.namedObjects != nil
+		output[symbol] = item
+	}
+	if s.namedObjects != nil {
+		output["objects"] = s.namedObjects
+	}
+	if s.Worst != nil {
+		output["worst"] = struct {
+			Symbol         string  `json:"symbol"`
+			Description    string  `json:"description"`
+			Value          uint64  `json:"value"`
+			Unit           string  `json:"unit"`
+			LevelOfConcern float64 `json:"levelOfConcern"`
+		}{
+			Symbol:         s.Worst.Symbol,
+			Description:    s.Worst.Description,
+			Value:          s.Worst.Value,
+			Unit:           s.Worst.Unit,
+			LevelOfConcern: s.Worst.LevelOfConcern,
+		}
+	}
+	if s.Errors != nil {
+		output["errors"] = s.Errors.jsonV2()
+	}
+	if s.BrokenReferences != nil {
+		output["brokenReferences"] = s.BrokenReferences
+	}
+	if s.Attributes != nil {
+		output["attributes"] = s.Attributes.jsonV2()
+	}
+	if s.WidestTrees != nil {
+		output["widestTrees"] = s.WidestTrees
+	}
+	if s.TopBlobs != nil {
+		output["topBlobs"] = s.TopBlobs.jsonV2()
+	}
+	if s.TopBlobsByAttribute != nil {
+		output["topBlobsByAttribute"] = s.TopBlobsByAttribute.jsonV2()
+	}
+	if s.RepoType != nil {
+		output["repoType"] = s.RepoType.jsonV2()
+	}
+	if s.DuplicateNames != nil {
+		output["duplicateNames"] = s.DuplicateNames.jsonV2()
+	}
+	if s.CommitterDomains != nil {
+		output["committerDomains"] = s.CommitterDomains.jsonV2()
+	}
+	output["treeAnomalies"] = s.TreeAnomalies.jsonV2()
+	if s.CommitDates != nil {
+		output["commitDates"] = s.CommitDates.jsonV2()
+	}
+	if s.GitLimitations != nil {
+		output["gitLimitations"] = s.GitLimitations.jsonV2()
+	}
+	if s.BlobSizeHistogram != nil {
+		output["blobSizeHistogram"] = s.BlobSizeHistogram
+	}
+	if s.TreeEntriesHistogram != nil {
+		output["treeEntriesHistogram"] = s.TreeEntriesHistogram
+	}
+	if s.PathDepthHistogram != nil {
+		output["pathDepthHistogram"] = s.PathDepthHistogram
+	}
+	if s.TopBlobHistory != nil {
+		output["topBlobHistory"] = s.TopBlobHistory
+	}
+	if s.Renames != nil {
+		output["renames"] = s.Renames.jsonV2()
+	}
+	if s.LFSSizes != nil {
+		output["lfsSizes"] = s.LFSSizes.jsonV2()
+	}
+	if s.ObjectLookups != nil {
+		output["objectLookups"] = s.ObjectLookups
+	}
+	if s.Scope != nil {
+		output["scope"] = s.Scope.jsonV2()
+	}
+	if s.Partial {
+		output["partial"] = true
+	}
+	if s.LeftOut != nil {
+		output["leftOut"] = s.LeftOut
+	}
+	if s.Sample != nil {
+		output["sample"] = s.Sample.jsonV2()
+	}
+	if s.QuickScan != nil {
+		output["quickScan"] = s.QuickScan.jsonV2()
+	}
+	if s.Remotes != nil {
+		output["remotes"] = s.Remotes.jsonV2()
+	}
+	if s.Namespaces != nil {
+		output["namespaces"] = s.Namespaces.jsonV2()
+	}
+	if s.Comparison != nil {
+		output["comparison"] = s.Comparison.jsonV2()
+	}
+	if s.TagOnly != nil {
+		output["tagOnly"] = s.TagOnly.jsonV2()
+	}
+	if s.NotesOnly != nil {
+		output["notesOnly"] = s.NotesOnly.jsonV2()
+	}
+	if s.PackStats != nil {
+		output["packStats"] = s.PackStats.jsonV2()
+	}
+	if s.Archive != nil {
+		output["archive"] = s.Archive.jsonV2()
+	}
+	if s.Growth != nil {
+		output["growth"] = s.Growth
+	}
+	if s.RefSharing != nil {
+		output["refSharing"] = s.RefSharing.jsonV2()
+	}
+	if s.GitlinkCheck != nil {
+		output["gitlinkCheck"] = s.GitlinkCheck.jsonV2()
+	}
+	if s.Submodules != nil {
+		submodules := make(map[string]interface{}, len(s.Submodules))
+		for path, sm := range s.Submodules {
+			v := map[string]interface{}{
+				"commit": sm.Commit,
+			}
+			if sm.Skipped != "" {
+				v["skipped"] = sm.Skipped
+			}
+			if sm.Size != nil {
+				v["size"] = sm.Size.jsonMap(refGroups)
+			}
+			submodules[path] = v
+		}
+		output["submodules"] = submodules
+	}
+	if s.Combined != nil {
+		output["combined"] = s.Combined.jsonV2()
+	}
+	return output
+}
+
+// worstStatistic returns the statistic with the highest level of
+// concern, or nil if there are no statistics. Ties are broken in
+// favor of the alphabetically first symbol, to make the choice
+// deterministic.
+func (s *HistorySize) worstStatistic(refGroups []RefGroup) *Statistic {
+	items := make(map[string]*item)
+	s.contents(refGroups).CollectItems(items)
+
+	var worst *item
+	for _, i := range items {
+		if worst == nil ||
+			i.alertLevel() > worst.alertLevel() ||
+			(i.alertLevel() == worst.alertLevel() && i.symbol < worst.symbol) {
+			worst = i
+		}
+	}
+	if worst == nil {
+		return nil
+	}
+
+	value, _ := worst.value.ToUint64()
+	return &Statistic{
+		Symbol:         worst.symbol,
+		Description:    worst.description,
+		Value:          value,
+		Unit:           worst.unit,
+		LevelOfConcern: worst.alertLevel(),
+		item:           worst,
+	}
 }
 
+// contents returns the items to output for `s`. If more than one
+// object per statistic was requested, the footnoted items list them
+// all.
 func (s *HistorySize) contents(refGroups []RefGroup) tableContents {
+	c := s.baseContents(refGroups)
+	if s.metricExamples != nil {
+		items := make(map[string]*item)
+		c.CollectItems(items)
+		for symbol, paths := range s.metricExamples {
+			if i, ok := items[symbol]; ok {
+				i.withRanking(paths)
+			}
+		}
+	}
+	s.QuickScan.markItems(c)
+	s.Sample.markItems(c)
+	return c
+}
+
+func (s *HistorySize) baseContents(refGroups []RefGroup) tableContents {
 	S := newSection
 	I := newItem
 	metric := counts.Metric
@@ -489,6 +1007,171 @@ func (s *HistorySize) contents(refGroups []RefGroup) tableContents {
 		rgis = append(rgis, rgi.Indented(indent))
 	}
 
+	commitItems := []tableContents{
+		I("maxCommitSize", "Maximum size",
+			"The size of the largest single commit",
+			s.MaxCommitSizeCommit, s.MaxCommitSize, binary, "B", 50e3),
+		I("maxCommitParentCount", "Maximum parents",
+			"The most parents of any single commit",
+			s.MaxParentCountCommit, s.MaxParentCount, metric, "", 10),
+	}
+	damaged := s.Errors
+	if damaged == nil {
+		damaged = &CorruptObjects{}
+	}
+
+	// commitPercent returns `n` as a percentage of all commits,
+	// rounded to the nearest whole percent.
+	commitPercent := func(n counts.Count32) counts.Count32 {
+		if s.UniqueCommitCount == 0 {
+			return 0
+		}
+		return counts.NewCount32(
+			(100*uint64(n) + uint64(s.UniqueCommitCount)/2) / uint64(s.UniqueCommitCount),
+		)
+	}
+
+	if d := s.CommitDiffs; d != nil {
+		commitItems = append(
+			commitItems,
+			I("maxChangedPaths", "Most changed paths",
+				"The most paths changed by any single commit, relative to its first parent",
+				d.MaxChangedPathsCommit, d.MaxChangedPaths, metric, "", 25e3).
+				withNote(d.changedPathsNote()),
+			I("maxNewBlobSize", "Most new blob bytes",
+				"The most bytes of new blobs introduced by any single commit",
+				d.MaxNewBlobSizeCommit, d.MaxNewBlobSize, binary, "B", 100e6),
+		)
+	}
+
+	treeItems := []tableContents{
+		I("maxTreeEntries", "Maximum entries",
+			"The most entries in any single tree",
+			s.MaxTreeEntriesTree, s.MaxTreeEntries, metric, "", 1000),
+		I("maxTreeEntryNameLength", "Maximum name length",
+			"The length of the longest name of any single tree entry",
+			s.MaxTreeEntryNameLengthTree, s.MaxTreeEntryNameLength, binary, "B", 200),
+	}
+	if d := s.CommitDiffs; d != nil {
+		treeItems = append(
+			treeItems,
+			I("maxDirFanOut", "Max dir fan-out",
+				"The most distinct names that any single directory has contained over history",
+				d.MaxDirFanOutCommit, d.MaxDirFanOut, metric, "", 2000).
+				withNote(d.dirFanOutNote()),
+		)
+	}
+
+	blobItems := []tableContents{
+		I("uniqueBlobCount", "Count",
+			"The total number of distinct blob objects",
+			nil, s.UniqueBlobCount, metric, "", 1.5e6),
+		I("uniqueBlobSize", "Total size",
+			"The total size of all distinct blob objects",
+			nil, s.UniqueBlobSize, binary, "B", 10e9),
+	}
+	if ob := s.OversizedBlobs; ob != nil {
+		limit := ob.limitString()
+		blobItems = append(
+			blobItems,
+			I("oversizedBlobCount", "Count over "+limit,
+				fmt.Sprintf("The number of distinct blobs larger than %s", limit),
+				nil, ob.Count, metric, "", 1).
+				withExamples(ob.Examples),
+			I("oversizedBlobSize", "Size over "+limit,
+				fmt.Sprintf("The total size of the distinct blobs larger than %s", limit),
+				nil, ob.Size, binary, "B", float64(ob.Limit)),
+		)
+	}
+	if bf := s.BigFiles; bf != nil {
+		limit := bf.limitString()
+		blobItems = append(
+			blobItems,
+			I("bigFileCount", "Big files",
+				fmt.Sprintf(
+					"The number of distinct blobs larger than core.bigFileThreshold (%s), "+
+						"which Git stores without delta compression",
+					limit,
+				),
+				nil, bf.Count, metric, "", 1).
+				withExamples(bf.Examples),
+			I("bigFileSize", "Big files size",
+				fmt.Sprintf(
+					"The total size of the distinct blobs larger than core.bigFileThreshold (%s)",
+					limit,
+				),
+				nil, bf.Size, binary, "B", float64(bf.Limit)),
+		)
+	}
+
+	if p := s.PersistenceWeighted; p != nil {
+		blobItems = append(
+			blobItems,
+			I("persistenceWeightedBlobSize", "Persistence-weighted",
+				"The total size of the blobs in the tree of each commit, summed over the commits",
+				nil, p.Size, binary, "B", 1e12),
+			I("meanBlobPersistence", "Mean persistence",
+				"The number of commits that each byte of distinct blob content is in, on average",
+				nil, p.meanPersistence(s.UniqueBlobSize), metric, "", 10e3),
+		)
+	}
+
+	tagItems := []tableContents{
+		I("uniqueTagCount", "Count",
+			"The total number of annotated tags",
+			nil, s.UniqueTagCount, metric, "", 25e3),
+		I("uniqueTagSize", "Total size",
+			"The total size of all annotated tag objects",
+			nil, s.UniqueTagSize, binary, "B", 25e6),
+		I("signedTagCount", "Signed",
+			"The number of annotated tags that are signed (signatures are not verified)",
+			nil, s.SignedTagCount, metric, "", 0),
+	}
+	if tos := s.TagOnly; tos != nil {
+		tagItems = append(
+			tagItems,
+			I("releaseObjectCount", "Release-only objects",
+				"The number of objects reachable from what annotated tags point at, "+
+					"but not from any branch",
+				nil, tos.ReleaseObjectCount, metric, "", 1.5e6),
+			I("releaseObjectSize", "Release-only size",
+				"The total size of the objects reachable from what annotated tags point at, "+
+					"but not from any branch",
+				nil, tos.ReleaseObjectSize, binary, "B", 10e9),
+		)
+	}
+
+	packItems := []tableContents{
+		I("packCount", "Count",
+			"The number of packfiles; many packs slow Git down "+
+				"('git repack -ad' combines them)",
+			nil, s.PackCount, metric, "", 50),
+		I("packSize", "Total size",
+			"The total size of all packfiles",
+			nil, s.PackSize, binary, "B", 10e9),
+		I("maxPackSize", "Largest pack",
+			"The size of the largest single packfile",
+			nil, s.MaxPackSize, binary, "B", 10e9),
+		I("cruftPackCount", "Cruft packs",
+			"The number of cruft packs, which hold unreachable objects until they expire",
+			nil, s.CruftPackCount, metric, "", 0),
+		I("cruftPackSize", "Cruft size",
+			"The total size of the cruft packs",
+			nil, s.CruftPackSize, binary, "B", 0),
+	}
+	if ps := s.PackStats; ps != nil {
+		packItems = append(
+			packItems,
+			I("packDeltaCount", "Delta objects",
+				"The number of packed objects that are stored as deltas",
+				nil, ps.DeltaCount, metric, "", 0),
+			I("maxDeltaChainDepth", "Max delta chain",
+				"The length of the longest delta chain in any packfile "+
+					"('git repack --depth' limits it)",
+				nil, ps.MaxDeltaChainDepth, metric, "", 100),
+		)
+	}
+
 	return S(
 		"",
 		S(
@@ -501,6 +1184,30 @@ func (s *HistorySize) contents(refGroups []RefGroup) tableContents {
 				I("uniqueCommitSize", "Total size",
 					"The total size of all commit objects",
 					nil, s.UniqueCommitSize, binary, "B", 250e6),
+				I("mergeCommitCount", "Merge commits",
+					"The number of commits with more than one parent",
+					nil, s.MergeCommitCount, metric, "", 0),
+				I("mergeCommitRatio", "Merge ratio",
+					"The percentage of commits that are merge commits",
+					nil, commitPercent(s.MergeCommitCount), metric, "%", 0),
+				I("signedCommitCount", "Signed commits",
+					"The number of commits that are signed (signatures are not verified)",
+					nil, s.SignedCommitCount, metric, "", 0),
+				I("signedCommitRatio", "Signed ratio",
+					"The percentage of commits that are signed (signatures are not verified)",
+					nil, commitPercent(s.SignedCommitCount), metric, "%", 0),
+				I("emptyCommitCount", "Content-free commits",
+					"The number of commits whose tree is empty or the same as their first parent's",
+					s.EmptyCommit, s.EmptyCommitCount, metric, "", 0),
+				I("nonUTF8CommitCount", "Non-UTF-8 encoding",
+					"The number of commits with an encoding header other than UTF-8",
+					s.NonUTF8Commit, s.NonUTF8CommitCount, metric, "", 0),
+				I("malformedIdentityCommitCount", "Malformed identities",
+					"The number of commits with a missing or malformed author or committer",
+					s.MalformedIdentityCommit, s.MalformedIdentityCommitCount, metric, "", 0),
+				I("implausibleDateCommitCount", "Dates out of range",
+					"The number of commits dated before 1980 or in the future",
+					s.ImplausibleDateCommit, s.ImplausibleDateCommitCount, metric, "", 0),
 			),
 
 			S(
@@ -514,23 +1221,32 @@ func (s *HistorySize) contents(refGroups []RefGroup) tableContents {
 				I("uniqueTreeEntries", "Total tree entries",
 					"The total number of entries in all distinct tree objects",
 					nil, s.UniqueTreeEntries, metric, "", 50e6),
+				I("longTreeEntryNames", fmt.Sprintf("Names over %d B", MaxPortableNameLength),
+					fmt.Sprintf(
+						"The number of entries in all distinct tree objects "+
+							"whose names are longer than %d bytes",
+						MaxPortableNameLength,
+					),
+					nil, s.LongTreeEntryNameCount, metric, "", 100),
 			),
 
-			S(
-				"Blobs",
-				I("uniqueBlobCount", "Count",
-					"The total number of distinct blob objects",
-					nil, s.UniqueBlobCount, metric, "", 1.5e6),
-				I("uniqueBlobSize", "Total size",
-					"The total size of all distinct blob objects",
-					nil, s.UniqueBlobSize, binary, "B", 10e9),
-			),
+			S("Blobs", blobItems...),
+
+			S("Packfiles", packItems...),
+
+			S("Annotated tags", tagItems...),
 
 			S(
-				"Annotated tags",
-				I("uniqueTagCount", "Count",
-					"The total number of annotated tags",
-					nil, s.UniqueTagCount, metric, "", 25e3),
+				"Damaged objects",
+				I("missingObjectCount", "Missing",
+					"The number of objects that are referred to but missing",
+					nil, damaged.MissingCount, metric, "", 1),
+				I("unknownTypeObjectCount", "Unknown type",
+					"The number of objects whose type is not blob, tree, commit, or tag",
+					nil, damaged.UnknownTypeCount, metric, "", 1),
+				I("malformedObjectCount", "Malformed",
+					"The number of objects that couldn't be parsed or had an unexpected type",
+					nil, damaged.MalformedCount, metric, "", 1),
 			),
 
 			S(
@@ -542,29 +1258,41 @@ func (s *HistorySize) contents(refGroups []RefGroup) tableContents {
 					"",
 					rgis...,
 				),
+				I("maxRefsPerCommit", "Max refs per commit",
+					"The maximum number of references that resolve to a single commit",
+					s.MaxRefsPerCommitCommit, s.MaxRefsPerCommit, metric, "", 1000),
 			),
 		),
 
 		S("Biggest objects",
-			S("Commits",
-				I("maxCommitSize", "Maximum size",
-					"The size of the largest single commit",
-					s.MaxCommitSizeCommit, s.MaxCommitSize, binary, "B", 50e3),
-				I("maxCommitParentCount", "Maximum parents",
-					"The most parents of any single commit",
-					s.MaxParentCountCommit, s.MaxParentCount, metric, "", 10),
-			),
+			S("Commits", commitItems...),
 
-			S("Trees",
-				I("maxTreeEntries", "Maximum entries",
-					"The most entries in any single tree",
-					s.MaxTreeEntriesTree, s.MaxTreeEntries, metric, "", 1000),
-			),
+			S("Trees", treeItems...),
 
 			S("Blobs",
 				I("maxBlobSize", "Maximum size",
 					"The size of the largest blob object",
 					s.MaxBlobSizeBlob, s.MaxBlobSize, binary, "B", 10e6),
+				I("maxBlobRefWeight", "Size times refs",
+					"The largest product of a blob's size and the number of "+
+						"tree entries that refer to it",
+					s.MaxBlobRefWeightBlob, s.MaxBlobRefWeight, binary, "B", 1e9).
+					withNote(s.blobRefWeightNote()),
+				I("blobSizeP50", "Median size",
+					"The median size of the distinct blob objects (estimated to within 1%)",
+					nil, s.BlobSizeP50, binary, "B", 0),
+				I("blobSizeP90", "90th percentile",
+					"The size that 90% of distinct blob objects are no bigger than (estimated to within 1%)",
+					nil, s.BlobSizeP90, binary, "B", 0),
+				I("blobSizeP99", "99th percentile",
+					"The size that 99% of distinct blob objects are no bigger than (estimated to within 1%)",
+					nil, s.BlobSizeP99, binary, "B", 0),
+			),
+
+			S("Annotated tags",
+				I("maxTagMessageSize", "Maximum message",
+					"The size of the longest annotated tag message",
+					s.MaxTagMessageTag, s.MaxTagMessageSize, binary, "B", 50e3),
 			),
 		),
 
@@ -572,6 +1300,9 @@ func (s *HistorySize) contents(refGroups []RefGroup) tableContents {
 			I("maxHistoryDepth", "Maximum history depth",
 				"The longest chain of commits in history",
 				nil, s.MaxHistoryDepth, metric, "", 500e3),
+			I("maxMergeDepth", "Maximum merge depth",
+				"The most merge commits on any chain of commits in history",
+				s.MaxMergeDepthCommit, s.MaxMergeDepth, metric, "", 50e3),
 			I("maxTagDepth", "Maximum tag depth",
 				"The longest chain of annotated tags pointing at one another",
 				s.MaxTagDepthTag, s.MaxTagDepth, metric, "", 1.001),
@@ -605,3 +1336,19 @@ func (s *HistorySize) contents(refGroups []RefGroup) tableContents {
 		),
 	)
 }
+
+// blobRefWeightNote returns the note that is appended to the footnote
+// for the blob with the largest product of size and references.
+func (s *HistorySize) blobRefWeightNote() string {
+	if s.MaxBlobRefWeight == 0 {
+		return ""
+	}
+	numeral, unit := counts.Binary.Format(s.MaxBlobRefWeightSize, "B")
+	noun := "references"
+	if s.MaxBlobRefWeightRefCount == 1 {
+		noun = "reference"
+	}
+	return fmt.Sprintf(
+		"%s, %d %s", strings.TrimSpace(numeral+" "+unit), s.MaxBlobRefWeightRefCount, noun,
+	)
+}
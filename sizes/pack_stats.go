@@ -0,0 +1,347 @@
+package sizes
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/github/git-sizer/counts"
+	"github.com/github/git-sizer/git"
+)
+
+// deltaChainBounds are the lower bounds of the buckets (after the
+// first, which holds the objects that are stored whole) of
+// `PackStats.ChainLengthHistogram`. 50 is the default maximum depth
+// of `git repack`, and 250 the one used by `git gc --aggressive`.
+var deltaChainBounds = []uint64{1, 2, 5, 10, 20, 50, 100, 250}
+
+// PackStats describes the delta chains in the repository's packfiles,
+// as reported by `git verify-pack -v`, and how the object directory's
+// space is divided between live packs, cruft packs, and loose
+// objects. Long chains make objects slow to read; `git repack
+// --depth` limits their length.
+type PackStats struct {
+	// PackCount is the number of packfiles whose delta chains were
+	// examined. Cruft packs are left out, since they hold unreachable
+	// objects.
+	PackCount counts.Count32 `json:"pack_count"`
+
+	// ObjectCount is the number of objects in those packfiles, and
+	// DeltaCount the number of them that are stored as deltas.
+	// Objects that are in more than one pack are counted for each.
+	ObjectCount counts.Count64 `json:"object_count"`
+	DeltaCount  counts.Count64 `json:"delta_count"`
+
+	// MaxDeltaChainDepth is the length of the longest delta chain.
+	MaxDeltaChainDepth counts.Count32 `json:"max_delta_chain_depth"`
+
+	// ChainLengthHistogram is the distribution of the lengths of the
+	// objects' delta chains, where an object that is stored whole
+	// has length 0.
+	ChainLengthHistogram *Histogram `json:"chain_length_histogram"`
+
+	// LivePacks are the packfiles other than cruft packs, CruftPacks
+	// the cruft packs (whose contents approximate the unreachable
+	// objects that are waiting to expire), and LooseObjects the
+	// objects that aren't packed.
+	LivePacks    StorageSize `json:"live_packs"`
+	CruftPacks   StorageSize `json:"cruft_packs"`
+	LooseObjects StorageSize `json:"loose_objects"`
+
+	// MultiPackIndex describes the multi-pack-index, if there is one.
+	MultiPackIndex *MultiPackIndexCoverage `json:"multi_pack_index,omitempty"`
+
+	// Packs describes each of the packfiles, in order of name, as
+	// read from their indexes.
+	Packs []PackSummary `json:"packs,omitempty"`
+
+	// Skipped, if set, is why the packfiles' indexes couldn't be read
+	// (e.g., because the installed Git is too old). In that case,
+	// `Packs` is empty and no blobs are attributed to packfiles.
+	Skipped string `json:"skipped,omitempty"`
+}
+
+// StorageSize is the number of packfiles (or loose objects) of some
+// kind and the disk space that they use.
+type StorageSize struct {
+	Count counts.Count64 `json:"count"`
+	Size  counts.Count64 `json:"size"`
+}
+
+// MultiPackIndexCoverage describes which packfiles a multi-pack-index
+// covers.
+type MultiPackIndexCoverage struct {
+	// PackCount is the number of packfiles that it covers, and
+	// UncoveredPackCount the number of packfiles in the object
+	// directory that it doesn't.
+	PackCount          counts.Count32 `json:"pack_count"`
+	UncoveredPackCount counts.Count32 `json:"uncovered_pack_count"`
+
+	// ObjectCount is the number of distinct objects in the packfiles
+	// that it covers. Unlike `PackStats.ObjectCount`, objects that
+	// are in more than one of them are only counted once.
+	ObjectCount counts.Count64 `json:"object_count"`
+}
+
+// PackSummary describes the contents of one packfile.
+type PackSummary struct {
+	Name        string         `json:"name"`
+	ObjectCount counts.Count32 `json:"object_count"`
+	DiskSize    counts.Count64 `json:"disk_size"`
+	Cruft       bool           `json:"cruft,omitempty"`
+
+	// LargestObject is the object that takes the most space in the
+	// packfile, and LargestObjectDiskSize how much space it takes
+	// (compressed, and possibly as a delta).
+	LargestObject         git.OID        `json:"largest_object"`
+	LargestObjectDiskSize counts.Count64 `json:"largest_object_disk_size"`
+}
+
+// LoosePack is the `RankedBlob.Pack` of blobs that are stored as
+// loose objects.
+const LoosePack = "loose"
+
+// ComputePackStats reads the delta chains of the packfiles in
+// `repo`'s object directory (see `git.Repository.Packfiles()`), and
+// summarizes their indexes. If `tb` is not nil, the packfile
+// containing each of its blobs is recorded in `RankedBlob.Pack`.
+func ComputePackStats(
+	ctx context.Context, repo *git.Repository, tb *TopBlobs,
+) (*PackStats, error) {
+	packs, err := repo.Packfiles()
+	if err != nil {
+		return nil, err
+	}
+
+	ps := PackStats{
+		ChainLengthHistogram: newHistogram(deltaChainBounds),
+	}
+
+	// The blobs in `tb`, mapped to their indexes in `tb.Blobs`:
+	wanted := make(map[git.OID]int)
+	if tb != nil {
+		for i, b := range tb.Blobs {
+			wanted[b.OID] = i
+		}
+	}
+
+	for _, pack := range packs {
+		entries, err := repo.PackIndex(ctx, pack)
+		if err != nil {
+			// `git show-index` might not support the repository's
+			// object format. The other statistics can still be
+			// computed.
+			ps.Skipped = err.Error()
+			ps.Packs = nil
+			for _, i := range wanted {
+				tb.Blobs[i].Pack = ""
+			}
+			wanted = nil
+			break
+		}
+		summary := PackSummary{
+			Name:        pack.Name,
+			ObjectCount: counts.NewCount32(uint64(len(entries))),
+			DiskSize:    counts.NewCount64(uint64(pack.Size)),
+			Cruft:       pack.Cruft,
+		}
+		for _, e := range entries {
+			if counts.Count64(e.DiskSize) > summary.LargestObjectDiskSize {
+				summary.LargestObject = e.OID
+				summary.LargestObjectDiskSize = counts.NewCount64(e.DiskSize)
+			}
+			if i, ok := wanted[e.OID]; ok && tb.Blobs[i].Pack == "" {
+				tb.Blobs[i].Pack = pack.Name
+			}
+		}
+		ps.Packs = append(ps.Packs, summary)
+	}
+
+	for oid, i := range wanted {
+		if tb.Blobs[i].Pack != "" {
+			continue
+		}
+		loose, err := repo.IsLooseObject(oid)
+		if err != nil {
+			return nil, err
+		}
+		if loose {
+			tb.Blobs[i].Pack = LoosePack
+		}
+	}
+
+	for _, pack := range packs {
+		storage := &ps.LivePacks
+		if pack.Cruft {
+			storage = &ps.CruftPacks
+		}
+		storage.Count.Increment(1)
+		storage.Size.Increment(counts.NewCount64(uint64(pack.Size)))
+	}
+
+	loose, err := repo.LooseObjects()
+	if err != nil {
+		return nil, err
+	}
+	ps.LooseObjects = StorageSize{
+		Count: counts.NewCount64(loose.Count),
+		Size:  counts.NewCount64(loose.Size),
+	}
+
+	midx, err := repo.ReadMultiPackIndex()
+	if err != nil {
+		return nil, err
+	}
+	if midx != nil {
+		covered := make(map[string]bool, len(midx.Packs))
+		for _, name := range midx.Packs {
+			covered[name] = true
+		}
+		ps.MultiPackIndex = &MultiPackIndexCoverage{
+			PackCount:   counts.NewCount32(uint64(len(midx.Packs))),
+			ObjectCount: counts.NewCount64(uint64(midx.ObjectCount)),
+		}
+		for _, pack := range packs {
+			if !covered[pack.Name] {
+				ps.MultiPackIndex.UncoveredPackCount.Increment(1)
+			}
+		}
+	}
+
+	for _, pack := range packs {
+		if pack.Cruft {
+			continue
+		}
+		chains, err := repo.PackDeltaChains(ctx, pack)
+		if err != nil {
+			return nil, err
+		}
+		ps.PackCount.Increment(1)
+		for length, n := range chains {
+			ps.ObjectCount.Increment(counts.NewCount64(n))
+			if length != 0 {
+				ps.DeltaCount.Increment(counts.NewCount64(n))
+			}
+			ps.MaxDeltaChainDepth.AdjustMaxIfNecessary(counts.NewCount32(length))
+			ps.ChainLengthHistogram.addCount(length, counts.NewCount32(n))
+		}
+	}
+
+	return &ps, nil
+}
+
+// jsonV2 returns `ps` the way that it is represented in the version 2
+// JSON output, with camelCase names.
+func (ps *PackStats) jsonV2() interface{} {
+	type multiPackIndexCoverage struct {
+		PackCount          counts.Count32 `json:"packCount"`
+		UncoveredPackCount counts.Count32 `json:"uncoveredPackCount"`
+		ObjectCount        counts.Count64 `json:"objectCount"`
+	}
+	type packSummary struct {
+		Name                  string         `json:"name"`
+		ObjectCount           counts.Count32 `json:"objectCount"`
+		DiskSize              counts.Count64 `json:"diskSize"`
+		Cruft                 bool           `json:"cruft,omitempty"`
+		LargestObject         git.OID        `json:"largestObject"`
+		LargestObjectDiskSize counts.Count64 `json:"largestObjectDiskSize"`
+	}
+	var midx *multiPackIndexCoverage
+	if ps.MultiPackIndex != nil {
+		m := multiPackIndexCoverage(*ps.MultiPackIndex)
+		midx = &m
+	}
+	packs := make([]packSummary, len(ps.Packs))
+	for i, p := range ps.Packs {
+		packs[i] = packSummary(p)
+	}
+	return struct {
+		PackCount            counts.Count32          `json:"packCount"`
+		ObjectCount          counts.Count64          `json:"objectCount"`
+		DeltaCount           counts.Count64          `json:"deltaCount"`
+		MaxDeltaChainDepth   counts.Count32          `json:"maxDeltaChainDepth"`
+		ChainLengthHistogram *Histogram              `json:"chainLengthHistogram"`
+		LivePacks            StorageSize             `json:"livePacks"`
+		CruftPacks           StorageSize             `json:"cruftPacks"`
+		LooseObjects         StorageSize             `json:"looseObjects"`
+		MultiPackIndex       *multiPackIndexCoverage `json:"multiPackIndex,omitempty"`
+		Packs                []packSummary           `json:"packs,omitempty"`
+		Skipped              string                  `json:"skipped,omitempty"`
+	}{
+		PackCount:            ps.PackCount,
+		ObjectCount:          ps.ObjectCount,
+		DeltaCount:           ps.DeltaCount,
+		MaxDeltaChainDepth:   ps.MaxDeltaChainDepth,
+		ChainLengthHistogram: ps.ChainLengthHistogram,
+		LivePacks:            ps.LivePacks,
+		CruftPacks:           ps.CruftPacks,
+		LooseObjects:         ps.LooseObjects,
+		MultiPackIndex:       midx,
+		Packs:                packs,
+		Skipped:              ps.Skipped,
+	}
+}
+
+// String returns a table of the distribution of delta chain lengths.
+func (ps *PackStats) String() string {
+	if ps == nil {
+		return ""
+	}
+	size := func(n counts.Humanable) string {
+		numeral, unit := counts.Binary.Format(n, "B")
+		return strings.TrimSpace(numeral + " " + unit)
+	}
+
+	buf := &bytes.Buffer{}
+	buf.WriteString(ps.ChainLengthHistogram.format("Delta chain length histogram", "", false))
+
+	fmt.Fprintln(buf, "\nObject storage:")
+	fmt.Fprintln(buf)
+	for _, s := range []struct {
+		label   string
+		storage StorageSize
+		unit    string
+	}{
+		{"Live packs", ps.LivePacks, "packs"},
+		{"Cruft packs", ps.CruftPacks, "packs"},
+		{"Loose objects", ps.LooseObjects, "objects"},
+	} {
+		fmt.Fprintf(
+			buf, "    %-14s  %10d %-7s  %10s\n",
+			s.label, s.storage.Count, s.unit, size(s.storage.Size),
+		)
+	}
+	if midx := ps.MultiPackIndex; midx != nil {
+		fmt.Fprintf(
+			buf, "    Multi-pack-index covers %d packs (%d distinct objects)",
+			midx.PackCount, midx.ObjectCount,
+		)
+		if midx.UncoveredPackCount != 0 {
+			fmt.Fprintf(buf, "; %d packs aren't covered", midx.UncoveredPackCount)
+		}
+		fmt.Fprintln(buf)
+	}
+
+	if ps.Skipped != "" {
+		fmt.Fprintf(buf, "\nPackfiles: skipped (%s)\n", ps.Skipped)
+		return buf.String()
+	}
+	if len(ps.Packs) == 0 {
+		return buf.String()
+	}
+
+	fmt.Fprintf(buf, "\nPackfiles (%d):\n\n", len(ps.Packs))
+	for _, p := range ps.Packs {
+		fmt.Fprintf(
+			buf, "    %s  %10d objects  %10s  largest: %s (%s)",
+			p.Name, p.ObjectCount, size(p.DiskSize),
+			p.LargestObject, size(p.LargestObjectDiskSize),
+		)
+		if p.Cruft {
+			fmt.Fprint(buf, "  cruft")
+		}
+		fmt.Fprintln(buf)
+	}
+	return buf.String()
+}
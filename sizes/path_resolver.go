@@ -3,6 +3,7 @@ package sizes
 import (
 	"encoding/json"
 	"fmt"
+	"strings"
 	"sync"
 
 	"github.com/github/git-sizer/git"
@@ -179,6 +180,31 @@ func (p *Path) Path() string {
 	}
 }
 
+// TreePath returns the path of this blob or tree within the tree of
+// the commit via which it was found, along with that commit's OID.
+// The path of a commit's root tree is "". `ok` is false if the
+// object wasn't found via a commit's tree (or if its path isn't
+// known at all).
+func (p *Path) TreePath() (commit git.OID, path string, ok bool) {
+	var components []string
+	for q := p; q != nil; q = q.parent {
+		switch q.objectType {
+		case "blob", "tree":
+			if q.relativePath != "" {
+				components = append(components, q.relativePath)
+			}
+		case "commit":
+			for i, j := 0, len(components)-1; i < j; i, j = i+1, j-1 {
+				components[i], components[j] = components[j], components[i]
+			}
+			return q.OID, strings.Join(components, "/"), true
+		default:
+			return git.NullOID, "", false
+		}
+	}
+	return git.NullOID, "", false
+}
+
 // Return some human-readable path for this object, even if it's just
 // the OID.
 func (p *Path) BestPath() string {
@@ -332,6 +358,30 @@ func (pr *InOrderPathResolver) RecordCommit(oid, tree git.OID) {
 	delete(pr.soughtPaths, tree)
 }
 
+// Record that the tag with OID `oid` is `tag`. Only blobs and trees
+// are named via the tags that point at them; commits and tags are
+// almost always pointed at by references, which give better names.
 func (pr *InOrderPathResolver) RecordTag(oid git.OID, tag *git.Tag) {
-	// Not implemented.
+	if tag.ReferentType != "blob" && tag.ReferentType != "tree" {
+		return
+	}
+
+	pr.lock.Lock()
+	defer pr.lock.Unlock()
+
+	p, ok := pr.soughtPaths[tag.Referent]
+	if !ok {
+		// Nobody is looking for the path to the referent.
+		return
+	}
+
+	if p.parent != nil {
+		panic("tag referent parent unexpectedly filled in")
+	}
+	p.parent = pr.requestPathLocked(oid, "tag")
+
+	p.relativePath = ""
+
+	// We don't need to keep looking for the referent anymore:
+	delete(pr.soughtPaths, tag.Referent)
 }
@@ -0,0 +1,346 @@
+package sizes
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/pflag"
+
+	"github.com/github/git-sizer/git"
+	"github.com/github/git-sizer/meter"
+)
+
+// PathRule is one of the rules that select the paths to which the
+// blob and tree statistics are limited (see `ScanOptions.PathRules`).
+type PathRule struct {
+	// Prefix is a path relative to the top level of the tree, in the
+	// form returned by `NormalizeScanPath()`. The rule applies to it
+	// and to everything under it.
+	Prefix string `json:"prefix,omitempty"`
+
+	// Regexp, if set instead of `Prefix`, is a regular expression
+	// that must match a whole path relative to the top level of the
+	// tree (e.g., "a/b.txt"). The rule applies to the paths that it
+	// matches and to everything under them.
+	Regexp string `json:"regexp,omitempty"`
+
+	// re is `Regexp`, compiled and anchored at both ends.
+	re *regexp.Regexp
+
+	// Exclude is set if the rule excludes the paths, rather than
+	// including them.
+	Exclude bool `json:"exclude,omitempty"`
+}
+
+// NewPathRegexpRule returns a `PathRule` that applies to the paths
+// that `pattern` matches in full, and to everything under them.
+func NewPathRegexpRule(pattern string, exclude bool) (PathRule, error) {
+	if _, err := regexp.Compile(pattern); err != nil {
+		return PathRule{}, fmt.Errorf("invalid path regexp %q: %w", pattern, err)
+	}
+	re := regexp.MustCompile("^(?:" + pattern + ")$")
+	return PathRule{Regexp: pattern, Exclude: exclude, re: re}, nil
+}
+
+// String returns the command-line option corresponding to `r`.
+func (r PathRule) String() string {
+	if r.re != nil {
+		if r.Exclude {
+			return "--exclude-path-regexp=" + git.DisplayString(r.Regexp)
+		}
+		return "--path-regexp=" + git.DisplayString(r.Regexp)
+	}
+	if r.Exclude {
+		return "--exclude-path=" + git.DisplayString(r.Prefix)
+	}
+	return "--path=" + git.DisplayString(r.Prefix)
+}
+
+// matches reports whether `r` applies to `p`.
+func (r PathRule) matches(p string) bool {
+	if r.re == nil {
+		return p == r.Prefix || strings.HasPrefix(p, r.Prefix+"/")
+	}
+
+	// The rule applies if the regexp matches `p` or any of the
+	// directories that contain it (but not the top-level tree):
+	for p != "" {
+		if r.re.MatchString(p) {
+			return true
+		}
+		i := strings.LastIndexByte(p, '/')
+		if i == -1 {
+			break
+		}
+		p = p[:i]
+	}
+	return false
+}
+
+// pathSelected reports whether `rules` select the path `p` (where ""
+// is the top-level tree). As with reference filters, the last rule
+// that matches wins. If none matches, `p` is selected unless the
+// first rule is an include rule.
+func pathSelected(rules []PathRule, p string) bool {
+	selected := len(rules) == 0 || rules[0].Exclude
+	for _, rule := range rules {
+		if rule.matches(p) {
+			selected = !rule.Exclude
+		}
+	}
+	return selected
+}
+
+// NormalizeScanPath checks `p`, a path relative to the top level of
+// the tree (e.g., "services/payments/"), and returns it in the form
+// used by `PathRule` (e.g., "services/payments").
+func NormalizeScanPath(p string) (string, error) {
+	clean := path.Clean(strings.Trim(p, "/"))
+	if clean == "." || clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", fmt.Errorf("path %q must name a file or directory within the tree", p)
+	}
+	return clean, nil
+}
+
+// pathRuleFlagValue is a `pflag.Value` that appends a `PathRule` to a
+// list each time that the flag is used, so that the relative order of
+// `--path`, `--exclude-path`, and the corresponding regexp options is
+// preserved.
+type pathRuleFlagValue struct {
+	rules   *[]PathRule
+	exclude bool
+	regexp  bool
+}
+
+// NewPathRuleFlagValue returns a `pflag.Value` that appends a rule to
+// `*rules` for each path that it is set to. The rules exclude paths
+// if `exclude` is set, and otherwise include them.
+func NewPathRuleFlagValue(rules *[]PathRule, exclude bool) pflag.Value {
+	return pathRuleFlagValue{rules: rules, exclude: exclude}
+}
+
+// NewPathRegexpFlagValue is like `NewPathRuleFlagValue()`, except that
+// it is set to regular expressions (see `NewPathRegexpRule()`).
+func NewPathRegexpFlagValue(rules *[]PathRule, exclude bool) pflag.Value {
+	return pathRuleFlagValue{rules: rules, exclude: exclude, regexp: true}
+}
+
+func (v pathRuleFlagValue) String() string {
+	return ""
+}
+
+func (v pathRuleFlagValue) Set(s string) error {
+	if v.regexp {
+		rule, err := NewPathRegexpRule(s, v.exclude)
+		if err != nil {
+			return err
+		}
+		*v.rules = append(*v.rules, rule)
+		return nil
+	}
+
+	prefix, err := NormalizeScanPath(s)
+	if err != nil {
+		return err
+	}
+	*v.rules = append(*v.rules, PathRule{Prefix: prefix, Exclude: v.exclude})
+	return nil
+}
+
+func (v pathRuleFlagValue) Type() string {
+	if v.regexp {
+		return "regexp"
+	}
+	return "prefix"
+}
+
+// treeAtPath is a tree found at a particular path.
+type treeAtPath struct {
+	oid  git.OID
+	path string
+}
+
+// findPathScope returns the set of blobs and trees that are found at
+// a path that `rules` select (see `pathSelected()`), in the tree of
+// any of `commits`. `progressMeter` is incremented for each object
+// found.
+//
+// Only the trees at the directories that contain the rules' prefixes
+// have to be read one by one. Everything else is under a directory
+// that is either selected or not as a whole, so the objects
+// reachable from the selected ones are listed in bulk. A regexp rule
+// could match anywhere, though, so if there are any, every tree is
+// read (see `findPathScopeByWalk()`).
+func findPathScope(
+	ctx context.Context, repo *git.Repository, commits []git.OID, rules []PathRule,
+	progressMeter meter.Progress,
+) (map[git.OID]struct{}, error) {
+	for _, rule := range rules {
+		if rule.re != nil {
+			return findPathScopeByWalk(ctx, repo, commits, rules, progressMeter)
+		}
+	}
+
+	// The directories that contain the prefixes, starting with the
+	// top-level tree (""):
+	dirs := []string{""}
+	isDir := map[string]bool{"": true}
+	for _, rule := range rules {
+		for i := range rule.Prefix {
+			if rule.Prefix[i] != '/' || isDir[rule.Prefix[:i]] {
+				continue
+			}
+			dirs = append(dirs, rule.Prefix[:i])
+			isDir[rule.Prefix[:i]] = true
+		}
+	}
+
+	specs := make([]string, 0, len(commits)*len(dirs))
+	for _, commit := range commits {
+		for _, dir := range dirs {
+			specs = append(specs, commit.String()+":"+dir)
+		}
+	}
+
+	scope := make(map[git.OID]struct{})
+	seen := make(map[treeAtPath]bool)
+	var roots []git.OID
+	isRoot := make(map[git.OID]bool)
+	if err := repo.ForEachTreeAt(
+		ctx, specs,
+		func(i int, oid git.OID, tree *git.Tree) error {
+			dir := dirs[i%len(dirs)]
+			if seen[treeAtPath{oid, dir}] {
+				return nil
+			}
+			seen[treeAtPath{oid, dir}] = true
+
+			if pathSelected(rules, dir) {
+				progressMeter.Inc()
+				scope[oid] = struct{}{}
+			}
+
+			iter := tree.Iter()
+			for {
+				entry, ok, err := iter.NextEntry()
+				if err != nil {
+					return fmt.Errorf("reading tree %s: %w", oid, err)
+				}
+				if !ok {
+					return nil
+				}
+
+				p := path.Join(dir, entry.Name)
+				switch {
+				case entry.Filemode&0o170000 == 0o160000:
+					// A submodule isn't part of this repository.
+					continue
+				case entry.Filemode&0o170000 == 0o40000 && isDir[p]:
+					// This tree is read separately.
+					continue
+				}
+				if pathSelected(rules, p) && !isRoot[entry.OID] {
+					isRoot[entry.OID] = true
+					roots = append(roots, entry.OID)
+				}
+			}
+		},
+	); err != nil {
+		return nil, fmt.Errorf("reading trees: %w", err)
+	}
+
+	if err := repo.ForEachReachableObject(
+		ctx, roots,
+		func(oid git.OID) error {
+			progressMeter.Inc()
+			scope[oid] = struct{}{}
+			return nil
+		},
+	); err != nil {
+		return nil, fmt.Errorf("listing objects under paths: %w", err)
+	}
+	return scope, nil
+}
+
+// findPathScopeByWalk is like `findPathScope()`, but it reads every
+// tree at every path in the trees of `commits`, one level of
+// directories at a time, and checks each path against `rules`. Each
+// tree is only read once at each path where it appears.
+func findPathScopeByWalk(
+	ctx context.Context, repo *git.Repository, commits []git.OID, rules []PathRule,
+	progressMeter meter.Progress,
+) (map[git.OID]struct{}, error) {
+	scope := make(map[git.OID]struct{})
+	add := func(oid git.OID) {
+		if _, ok := scope[oid]; !ok {
+			progressMeter.Inc()
+			scope[oid] = struct{}{}
+		}
+	}
+
+	var level []treeAtPath
+	specs := make([]string, len(commits))
+	for i, commit := range commits {
+		specs[i] = commit.String() + ":"
+	}
+	seen := make(map[treeAtPath]bool)
+
+	for len(specs) != 0 {
+		var next []treeAtPath
+		if err := repo.ForEachTreeAt(
+			ctx, specs,
+			func(i int, oid git.OID, tree *git.Tree) error {
+				var dir string
+				if level != nil {
+					// This tree was marked as seen when it was
+					// queued.
+					dir = level[i].path
+				} else if seen[treeAtPath{oid, dir}] {
+					return nil
+				} else {
+					seen[treeAtPath{oid, dir}] = true
+				}
+
+				if pathSelected(rules, dir) {
+					add(oid)
+				}
+
+				iter := tree.Iter()
+				for {
+					entry, ok, err := iter.NextEntry()
+					if err != nil {
+						return fmt.Errorf("reading tree %s: %w", oid, err)
+					}
+					if !ok {
+						return nil
+					}
+
+					p := path.Join(dir, entry.Name)
+					switch {
+					case entry.Filemode&0o170000 == 0o160000:
+						// A submodule isn't part of this repository.
+					case entry.Filemode&0o170000 == 0o40000:
+						if t := (treeAtPath{entry.OID, p}); !seen[t] {
+							seen[t] = true
+							next = append(next, t)
+						}
+					case pathSelected(rules, p):
+						add(entry.OID)
+					}
+				}
+			},
+		); err != nil {
+			return nil, fmt.Errorf("reading trees: %w", err)
+		}
+
+		level = next
+		specs = make([]string, len(level))
+		for i, t := range level {
+			specs[i] = t.oid.String()
+		}
+	}
+	return scope, nil
+}
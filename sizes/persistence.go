@@ -0,0 +1,45 @@
+package sizes
+
+import (
+	"github.com/github/git-sizer/counts"
+)
+
+// PersistenceWeightedSize is the total size of the blobs, each
+// multiplied by the number of scanned commits whose trees contain it
+// (counting each path at which it appears separately), as requested
+// by `ScanOptions.PersistenceWeighted`. A blob that has been present
+// throughout the history weighs much more than one that was added in
+// the last commit, so this is a rough model of what the content costs
+// to fetch and check out over time.
+//
+// It is the sum of the checkout sizes of the scanned commits, so
+// it doesn't require any extra tree walks.
+type PersistenceWeightedSize struct {
+	// Size is the weighted total, in bytes × commits.
+	Size counts.Count64 `json:"size"`
+
+	// CommitCount is the number of commits that contributed to
+	// `Size`.
+	CommitCount counts.Count32 `json:"commit_count"`
+}
+
+// recordCommitTree records a scanned commit whose tree's size is
+// `treeSize`.
+func (p *PersistenceWeightedSize) recordCommitTree(treeSize TreeSize) {
+	if p == nil {
+		return
+	}
+	p.Size.Increment(treeSize.ExpandedBlobSize)
+	p.CommitCount.Increment(1)
+}
+
+// meanPersistence returns the number of commits that each byte of
+// the distinct blobs, whose total size is `uniqueBlobSize`, is
+// present in on average, rounded to the nearest integer.
+func (p *PersistenceWeightedSize) meanPersistence(uniqueBlobSize counts.Count64) counts.Count32 {
+	weighted, overflow := p.Size.ToUint64()
+	if overflow || uniqueBlobSize == 0 {
+		return 0
+	}
+	return counts.NewCount32((weighted + uint64(uniqueBlobSize)/2) / uint64(uniqueBlobSize))
+}
@@ -0,0 +1,73 @@
+package sizes
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+
+	"github.com/github/git-sizer/git"
+)
+
+// PorcelainVersion is the version of the format written by
+// `WritePorcelain()`. The format is an API: any change to it, other
+// than adding statistics, requires incrementing this number.
+const PorcelainVersion = 1
+
+// WritePorcelain writes the statistics in `s` to `w` in a stable,
+// line-oriented format meant for scripts. The first line is a header
+// of the form
+//
+//	# git-sizer porcelain <version>
+//
+// where <version> is `PorcelainVersion`. It is followed by one line
+// per statistic, ordered by symbol, of the form
+//
+//	<metric_id> <value> <level> <object_oid> <object_path>
+//
+// separated by single spaces, where:
+//
+//   - <metric_id> is the statistic's symbol (as in the version 2 JSON
+//     output; e.g., "maxBlobSize").
+//   - <value> is its raw value, as a decimal integer (bytes for sizes,
+//     and whole percents for ratios).
+//   - <level> is its level of concern (the ratio of the value to the
+//     value that is worth one star), with exactly three decimal places.
+//   - <object_oid> is the full name of the object that the statistic
+//     refers to, or "-" if there is none.
+//   - <object_path> describes that object (e.g.,
+//     "refs/heads/main:dir/file"), C-quoted the way that Git quotes
+//     paths (see `git.QuotePath()`), or "-" if there is no object. It
+//     is the rest of the line, so it may contain spaces.
+//
+// All statistics are written, regardless of the threshold, and the
+// output doesn't depend on the locale, the terminal, or the choice of
+// colors or encoding.
+func (s *HistorySize) WritePorcelain(w io.Writer, refGroups []RefGroup) error {
+	items := make(map[string]*item)
+	s.contents(refGroups).CollectItems(items)
+
+	symbols := make([]string, 0, len(items))
+	for symbol := range items {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+
+	out := bufio.NewWriter(w)
+	fmt.Fprintf(out, "# git-sizer porcelain %d\n", PorcelainVersion)
+	for _, symbol := range symbols {
+		i := items[symbol]
+		value, _ := i.value.ToUint64()
+		oid, path := "-", "-"
+		if i.path != nil && i.path.OID != git.NullOID {
+			oid = i.path.OID.String()
+			path = git.QuotePath(i.path.Path())
+		}
+		fmt.Fprintf(
+			out, "%s %d %s %s %s\n",
+			symbol, value, strconv.FormatFloat(i.alertLevel(), 'f', 3, 64), oid, path,
+		)
+	}
+	return out.Flush()
+}
@@ -0,0 +1,181 @@
+package sizes
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/github/git-sizer/counts"
+	"github.com/github/git-sizer/git"
+)
+
+// RefUpdate is a reference update, as passed to a `pre-receive` hook.
+type RefUpdate struct {
+	OldOID  git.OID
+	NewOID  git.OID
+	Refname string
+}
+
+// ReadRefUpdates reads reference updates from `r`, one per line, in
+// the format that Git passes them to a `pre-receive` hook:
+//
+//	<old-oid> SP <new-oid> SP <refname> LF
+func ReadRefUpdates(r io.Reader) ([]RefUpdate, error) {
+	var updates []RefUpdate
+	in := bufio.NewScanner(r)
+	for in.Scan() {
+		line := in.Text()
+		if line == "" {
+			continue
+		}
+		words := strings.SplitN(line, " ", 3)
+		if len(words) != 3 || words[2] == "" {
+			return nil, fmt.Errorf("malformed reference update: %q", line)
+		}
+		oldOID, err := git.NewOID(words[0])
+		if err != nil {
+			return nil, fmt.Errorf("malformed reference update %q: %w", line, err)
+		}
+		newOID, err := git.NewOID(words[1])
+		if err != nil {
+			return nil, fmt.Errorf("malformed reference update %q: %w", line, err)
+		}
+		updates = append(updates, RefUpdate{oldOID, newOID, words[2]})
+	}
+	if err := in.Err(); err != nil {
+		return nil, fmt.Errorf("reading reference updates: %w", err)
+	}
+	return updates, nil
+}
+
+// PushedReference describes the objects that one updated reference
+// introduces, i.e., the objects that are reachable from its new value
+// but not from any existing reference.
+type PushedReference struct {
+	Refname string  `json:"refname"`
+	OldOID  git.OID `json:"old_oid"`
+	NewOID  git.OID `json:"new_oid"`
+
+	ObjectCount counts.Count64 `json:"object_count"`
+	ObjectSize  counts.Count64 `json:"object_size"`
+	DiskSize    counts.Count64 `json:"disk_size"`
+}
+
+// PushSize describes the objects introduced by a push.
+//
+// The totals count each new object once, even if it is reachable
+// from more than one updated reference. The per-reference numbers
+// count all of the new objects reachable from that reference, so
+// they can add up to more than the totals.
+type PushSize struct {
+	ObjectCount counts.Count64 `json:"object_count"`
+	ObjectSize  counts.Count64 `json:"object_size"`
+	DiskSize    counts.Count64 `json:"disk_size"`
+
+	// References lists the updated references, largest contribution
+	// first. References that are being deleted are omitted.
+	References []PushedReference `json:"references"`
+}
+
+// ComputePushSize computes the sizes of the objects that `updates`
+// would introduce into `repo`, like `git rev-list --objects <new>...
+// --not --all`. When run from a `pre-receive` hook, the references
+// haven't been updated yet, and the pushed objects are visible via
+// the quarantine environment that Git sets up.
+func ComputePushSize(
+	ctx context.Context, repo *git.Repository, updates []RefUpdate,
+) (*PushSize, error) {
+	refs, err := walkedReferences(ctx, repo, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	existing := make([]git.OID, 0, len(refs))
+	for _, ref := range refs {
+		existing = append(existing, ref.OID)
+	}
+
+	ps := PushSize{
+		References: []PushedReference{},
+	}
+
+	var tips []git.OID
+	for _, update := range updates {
+		if update.NewOID == git.NullOID {
+			// The reference is being deleted.
+			continue
+		}
+		tips = append(tips, update.NewOID)
+
+		size, err := repo.ReachableObjectsSize(ctx, []git.OID{update.NewOID}, existing)
+		if err != nil {
+			return nil, fmt.Errorf(
+				"measuring update of '%s': %w", git.DisplayString(update.Refname), err,
+			)
+		}
+		ps.References = append(ps.References, PushedReference{
+			Refname:     update.Refname,
+			OldOID:      update.OldOID,
+			NewOID:      update.NewOID,
+			ObjectCount: counts.NewCount64(size.Count),
+			ObjectSize:  counts.NewCount64(size.Size),
+			DiskSize:    counts.NewCount64(size.DiskSize),
+		})
+	}
+
+	total, err := repo.ReachableObjectsSize(ctx, tips, existing)
+	if err != nil {
+		return nil, fmt.Errorf("measuring push: %w", err)
+	}
+	ps.ObjectCount = counts.NewCount64(total.Count)
+	ps.ObjectSize = counts.NewCount64(total.Size)
+	ps.DiskSize = counts.NewCount64(total.DiskSize)
+
+	sort.SliceStable(ps.References, func(i, j int) bool {
+		return ps.References[i].ObjectSize > ps.References[j].ObjectSize
+	})
+
+	return &ps, nil
+}
+
+// String returns a human-readable summary of the push.
+func (ps *PushSize) String() string {
+	if ps == nil {
+		return ""
+	}
+
+	size := func(n counts.Humanable) string {
+		numeral, unit := counts.Binary.Format(n, "B")
+		return strings.TrimSpace(numeral + " " + unit)
+	}
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(
+		buf, "New objects in push: %d (%s, %s on disk)\n",
+		ps.ObjectCount, size(ps.ObjectSize), size(ps.DiskSize),
+	)
+	if len(ps.References) == 0 {
+		return buf.String()
+	}
+
+	width := len("Reference")
+	for _, r := range ps.References {
+		if w := len(git.DisplayString(r.Refname)); w > width {
+			width = w
+		}
+	}
+
+	fmt.Fprintf(buf, "\n    %-*s  %10s  %10s  %10s\n", width, "Reference", "Objects", "Size", "On disk")
+	for _, r := range ps.References {
+		fmt.Fprintf(
+			buf, "    %-*s  %10d  %10s  %10s\n",
+			width, git.DisplayString(r.Refname),
+			r.ObjectCount, size(r.ObjectSize), size(r.DiskSize),
+		)
+	}
+	return buf.String()
+}
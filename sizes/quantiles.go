@@ -0,0 +1,100 @@
+package sizes
+
+import (
+	"math"
+	"sort"
+
+	"github.com/github/git-sizer/counts"
+)
+
+// quantileRelativeError is the relative accuracy of the quantiles
+// estimated by `quantileSketch`.
+const quantileRelativeError = 0.01
+
+// quantileSketch estimates quantiles of a stream of sizes using a
+// fixed amount of memory (in the manner of DDSketch). Each positive
+// value `x` is counted in the bucket `ceil(log(x) / log(gamma))`,
+// where `gamma = (1 + α) / (1 - α)` and α is
+// `quantileRelativeError`. Every value in a bucket is within a
+// factor of α of the bucket's midpoint, so any estimated quantile is
+// within α (i.e., 1%) of the true value at that rank. Since the
+// values are at most 2³² bytes, there are at most about 1100
+// buckets, however many values are added.
+type quantileSketch struct {
+	gamma    float64
+	logGamma float64
+
+	// zeros is the number of zero values, which don't have a bucket.
+	zeros uint64
+
+	// buckets holds the number of positive values in each bucket.
+	buckets map[int]uint64
+
+	count uint64
+}
+
+func newQuantileSketch() *quantileSketch {
+	gamma := (1 + quantileRelativeError) / (1 - quantileRelativeError)
+	return &quantileSketch{
+		gamma:    gamma,
+		logGamma: math.Log(gamma),
+		buckets:  make(map[int]uint64),
+	}
+}
+
+func (qs *quantileSketch) add(value uint64) {
+	qs.count++
+	if value == 0 {
+		qs.zeros++
+		return
+	}
+	qs.buckets[int(math.Ceil(math.Log(float64(value))/qs.logGamma))]++
+}
+
+// quantile returns an estimate of the `q`th quantile (0 <= q <= 1) of
+// the values that have been added, or 0 if there are none.
+func (qs *quantileSketch) quantile(q float64) uint64 {
+	if qs.count == 0 {
+		return 0
+	}
+
+	rank := uint64(q * float64(qs.count-1))
+	if rank < qs.zeros {
+		return 0
+	}
+	seen := qs.zeros
+
+	indexes := make([]int, 0, len(qs.buckets))
+	for i := range qs.buckets {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+
+	for _, i := range indexes {
+		seen += qs.buckets[i]
+		if rank < seen {
+			// The midpoint (in terms of relative error) of the
+			// bucket `(gamma^(i-1), gamma^i]`:
+			return uint64(math.Round(2 * math.Pow(qs.gamma, float64(i)) / (qs.gamma + 1)))
+		}
+	}
+
+	// Not reached, because `rank < qs.count`.
+	return 0
+}
+
+// recordBlobSizeQuantiles fills in the blob size percentiles in `s`
+// from `qs`. The estimates are clamped to the largest blob size,
+// which is known exactly.
+func (s *HistorySize) recordBlobSizeQuantiles(qs *quantileSketch) {
+	estimate := func(q float64) counts.Count32 {
+		v := counts.NewCount32(qs.quantile(q))
+		if v > s.MaxBlobSize {
+			v = s.MaxBlobSize
+		}
+		return v
+	}
+	s.BlobSizeP50 = estimate(0.50)
+	s.BlobSizeP90 = estimate(0.90)
+	s.BlobSizeP99 = estimate(0.99)
+}
@@ -0,0 +1,190 @@
+package sizes
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+
+	"github.com/github/git-sizer/counts"
+)
+
+// How the value of an item was derived in a quick scan (see
+// `ScanOptions.MaxCommits`) or a sampled one (see
+// `ScanOptions.SampleRate`). Items with neither are exact.
+const (
+	// estimateExtrapolated marks a value that was extrapolated from
+	// the scanned part of the history to all of it.
+	estimateExtrapolated = "extrapolated"
+
+	// estimateLowerBound marks a value that is only known to be at
+	// least as big as reported.
+	estimateLowerBound = "lowerBound"
+)
+
+// quickScanExtrapolated lists the items whose values are extrapolated
+// in a quick scan.
+var quickScanExtrapolated = []string{
+	"uniqueCommitSize",
+	"mergeCommitCount", "mergeCommitRatio",
+	"signedCommitCount", "signedCommitRatio",
+	"emptyCommitCount", "nonUTF8CommitCount",
+	"malformedIdentityCommitCount", "implausibleDateCommitCount",
+	"uniqueTreeCount", "uniqueTreeSize", "uniqueTreeEntries", "longTreeEntryNames",
+	"uniqueBlobCount", "uniqueBlobSize",
+	"oversizedBlobCount", "oversizedBlobSize", "bigFileCount", "bigFileSize",
+	"blobSizeP50", "blobSizeP90", "blobSizeP99",
+}
+
+// quickScanLowerBounds lists the items whose values are only lower
+// bounds in a quick scan, because the part of the history that wasn't
+// scanned might hold bigger or more objects.
+var quickScanLowerBounds = []string{
+	"maxCommitSize", "maxCommitParentCount", "maxChangedPaths", "maxNewBlobSize",
+	"maxTreeEntries", "maxTreeEntryNameLength", "maxDirFanOut",
+	"maxBlobSize", "maxBlobRefWeight",
+	"uniqueTagCount", "uniqueTagSize", "signedTagCount", "maxTagMessageSize",
+	"maxHistoryDepth", "maxMergeDepth", "maxTagDepth",
+	"maxCheckoutTreeCount", "maxCheckoutPathDepth", "maxCheckoutPathLength",
+	"maxCheckoutBlobCount", "maxCheckoutBlobSize", "maxCheckoutLinkCount",
+	"maxCheckoutSubmoduleCount",
+	"missingObjectCount", "unknownTypeObjectCount", "malformedObjectCount",
+}
+
+// QuickScanInfo describes a quick scan (see `ScanOptions.MaxCommits`),
+// which stopped after the newest commits, and how its results were
+// extrapolated to the whole history.
+type QuickScanInfo struct {
+	// MaxCommits is the limit on the number of commits to scan.
+	MaxCommits int `json:"max_commits"`
+
+	// CommitCount is the number of commits in the history (exact),
+	// and ScannedCommitCount the number whose trees were scanned.
+	CommitCount        counts.Count32 `json:"commit_count"`
+	ScannedCommitCount counts.Count32 `json:"scanned_commit_count"`
+
+	// ObjectCount is the number of objects in the repository, as
+	// reported by `git count-objects`, and ScannedObjectCount the
+	// number that were scanned.
+	ObjectCount        counts.Count64 `json:"object_count"`
+	ScannedObjectCount counts.Count64 `json:"scanned_object_count"`
+
+	// Extrapolated and LowerBounds list the symbols of the
+	// statistics whose values were extrapolated or are only lower
+	// bounds, respectively. Other statistics are exact.
+	Extrapolated []string `json:"extrapolated"`
+	LowerBounds  []string `json:"lower_bounds"`
+}
+
+// extrapolateQuickScan scales the commit totals in `s`, which only
+// reflect the scanned commits, by the ratio of all commits to scanned
+// commits, and the tree and blob totals by the ratio of all other
+// objects to the scanned ones. It also records `s.QuickScan`.
+func (s *HistorySize) extrapolateQuickScan(qs QuickScanInfo) {
+	qs.Extrapolated = quickScanExtrapolated
+	qs.LowerBounds = quickScanLowerBounds
+
+	ratio := func(total, scanned float64) float64 {
+		if scanned <= 0 || total <= scanned {
+			return 1
+		}
+		return total / scanned
+	}
+	commitFactor := ratio(float64(qs.CommitCount), float64(qs.ScannedCommitCount))
+	objectFactor := ratio(
+		float64(qs.ObjectCount)-float64(qs.CommitCount),
+		float64(qs.ScannedObjectCount)-float64(qs.ScannedCommitCount),
+	)
+
+	scale32 := func(n *counts.Count32, factor float64) {
+		*n = counts.NewCount32(uint64(math.Round(float64(*n) * factor)))
+	}
+	scale64 := func(n *counts.Count64, factor float64) {
+		*n = counts.NewCount64(uint64(math.Round(float64(*n) * factor)))
+	}
+
+	s.UniqueCommitCount = qs.CommitCount
+	scale64(&s.UniqueCommitSize, commitFactor)
+	for _, n := range []*counts.Count32{
+		&s.MergeCommitCount, &s.SignedCommitCount, &s.EmptyCommitCount,
+		&s.NonUTF8CommitCount, &s.MalformedIdentityCommitCount,
+		&s.ImplausibleDateCommitCount,
+	} {
+		scale32(n, commitFactor)
+	}
+
+	scale32(&s.UniqueTreeCount, objectFactor)
+	scale64(&s.UniqueTreeSize, objectFactor)
+	scale64(&s.UniqueTreeEntries, objectFactor)
+	scale64(&s.LongTreeEntryNameCount, objectFactor)
+	scale32(&s.UniqueBlobCount, objectFactor)
+	scale64(&s.UniqueBlobSize, objectFactor)
+	for _, ob := range []*OversizedBlobs{s.OversizedBlobs, s.BigFiles} {
+		if ob != nil {
+			scale32(&ob.Count, objectFactor)
+			scale64(&ob.Size, objectFactor)
+		}
+	}
+
+	s.QuickScan = &qs
+}
+
+// markItems records in the items of `c` how their values were
+// derived, if `qs` is set.
+func (qs *QuickScanInfo) markItems(c tableContents) {
+	if qs == nil {
+		return
+	}
+
+	markEstimates(c, qs.Extrapolated, qs.LowerBounds)
+}
+
+// markEstimates marks the items of `c` whose symbols are listed in
+// `extrapolated` or `lowerBounds` accordingly.
+func markEstimates(c tableContents, extrapolated, lowerBounds []string) {
+	items := make(map[string]*item)
+	c.CollectItems(items)
+	for _, symbol := range extrapolated {
+		if i, ok := items[symbol]; ok {
+			i.estimate = estimateExtrapolated
+		}
+	}
+	for _, symbol := range lowerBounds {
+		if i, ok := items[symbol]; ok {
+			i.estimate = estimateLowerBound
+		}
+	}
+}
+
+// jsonV2 returns `qs` the way that it is represented in the version 2
+// JSON output, with camelCase names.
+func (qs *QuickScanInfo) jsonV2() interface{} {
+	return struct {
+		MaxCommits         int            `json:"maxCommits"`
+		CommitCount        counts.Count32 `json:"commitCount"`
+		ScannedCommitCount counts.Count32 `json:"scannedCommitCount"`
+		ObjectCount        counts.Count64 `json:"objectCount"`
+		ScannedObjectCount counts.Count64 `json:"scannedObjectCount"`
+		Extrapolated       []string       `json:"extrapolated"`
+		LowerBounds        []string       `json:"lowerBounds"`
+	}(*qs)
+}
+
+// String returns a note describing the quick scan, to be shown along
+// with the approximate results.
+func (qs *QuickScanInfo) String() string {
+	if qs == nil {
+		return ""
+	}
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(
+		buf,
+		"NOTE: This was a quick scan. Only the newest %d of %d commits (and %d of\n"+
+			"about %d objects) were scanned. Values marked '~' are extrapolated to\n"+
+			"the whole history and are rough estimates; values marked '+' are only\n"+
+			"lower bounds, because the rest of the history might exceed them. The\n"+
+			"commit count and the reference statistics are exact.\n\n",
+		qs.ScannedCommitCount, qs.CommitCount, qs.ScannedObjectCount, qs.ObjectCount,
+	)
+	return buf.String()
+}
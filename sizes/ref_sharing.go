@@ -0,0 +1,230 @@
+package sizes
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/github/git-sizer/counts"
+	"github.com/github/git-sizer/git"
+)
+
+// MaxExclusiveRefsListed is the maximum number of references that
+// are listed in `RefSharing.Exclusive`.
+const MaxExclusiveRefsListed = 10
+
+// RefSharing describes how much of the blob content that is reachable
+// from the included references is shared among all of them, and how
+// much is exclusive to one of them.
+type RefSharing struct {
+	// RefCount is the number of references that were included.
+	RefCount counts.Count32 `json:"ref_count"`
+
+	// BlobCount and BlobSize describe all of the blobs that are
+	// reachable from any of the references.
+	BlobCount counts.Count32 `json:"blob_count"`
+	BlobSize  counts.Count64 `json:"blob_size"`
+
+	// SharedBlobCount and SharedBlobSize describe the blobs that are
+	// reachable from every reference.
+	SharedBlobCount counts.Count32 `json:"shared_blob_count"`
+	SharedBlobSize  counts.Count64 `json:"shared_blob_size"`
+
+	// ExclusiveBlobCount and ExclusiveBlobSize describe the blobs
+	// that are reachable from exactly one reference.
+	ExclusiveBlobCount counts.Count32 `json:"exclusive_blob_count"`
+	ExclusiveBlobSize  counts.Count64 `json:"exclusive_blob_size"`
+
+	// Exclusive lists the references with the most exclusive blob
+	// content (at most `MaxExclusiveRefsListed` of them), most first.
+	Exclusive []ExclusiveContent `json:"exclusive"`
+}
+
+// ExclusiveContent describes the blobs that are reachable from only
+// one reference.
+type ExclusiveContent struct {
+	Refname   string         `json:"refname"`
+	BlobCount counts.Count32 `json:"blob_count"`
+	BlobSize  counts.Count64 `json:"blob_size"`
+}
+
+// blobSharing records how many references reach an object, and the
+// index of the first one.
+type blobSharing struct {
+	refCount uint32
+	firstRef int
+}
+
+// ComputeRefSharing computes how the blobs that are reachable from
+// the references that `rg` selects for walking are shared among them
+// (see `RefSharing`). This walks the history of each distinct
+// reference target separately, so it can be slow if there are many.
+func ComputeRefSharing(
+	ctx context.Context, repo *git.Repository, rg RefGrouper,
+) (*RefSharing, error) {
+	refs, err := walkedReferences(ctx, repo, rg)
+	if err != nil {
+		return nil, err
+	}
+
+	// The references, grouped by the object that they point at, since
+	// references to the same object reach the same blobs:
+	var refnames [][]string
+	var tips []git.OID
+	tipIndex := make(map[git.OID]int)
+	refCount := 0
+	for _, ref := range refs {
+		refCount++
+		i, ok := tipIndex[ref.OID]
+		if !ok {
+			i = len(tips)
+			tipIndex[ref.OID] = i
+			tips = append(tips, ref.OID)
+			refnames = append(refnames, nil)
+		}
+		refnames[i] = append(refnames[i], ref.Refname)
+	}
+
+	sharing := make(map[git.OID]blobSharing)
+	for i, tip := range tips {
+		if err := repo.ForEachReachableObject(
+			ctx, []git.OID{tip},
+			func(oid git.OID) error {
+				s, ok := sharing[oid]
+				if !ok {
+					s.firstRef = i
+				}
+				s.refCount += uint32(len(refnames[i]))
+				sharing[oid] = s
+				return nil
+			},
+		); err != nil {
+			return nil, fmt.Errorf("listing objects reachable from %s: %w", tip, err)
+		}
+	}
+
+	oids := make([]git.OID, 0, len(sharing))
+	for oid := range sharing {
+		oids = append(oids, oid)
+	}
+	headers, err := repo.ObjectHeaders(ctx, oids)
+	if err != nil {
+		return nil, fmt.Errorf("looking up reachable objects: %w", err)
+	}
+
+	rs := RefSharing{RefCount: counts.NewCount32(uint64(refCount))}
+	exclusive := make([]ExclusiveContent, len(tips))
+	for _, header := range headers {
+		if header.ObjectType != "blob" {
+			continue
+		}
+		size := counts.Count64(header.ObjectSize)
+		rs.BlobCount.Increment(1)
+		rs.BlobSize.Increment(size)
+
+		s := sharing[header.OID]
+		if s.refCount == uint32(refCount) {
+			rs.SharedBlobCount.Increment(1)
+			rs.SharedBlobSize.Increment(size)
+		}
+		if s.refCount == 1 {
+			rs.ExclusiveBlobCount.Increment(1)
+			rs.ExclusiveBlobSize.Increment(size)
+			exclusive[s.firstRef].BlobCount.Increment(1)
+			exclusive[s.firstRef].BlobSize.Increment(size)
+		}
+	}
+
+	for i := range exclusive {
+		if exclusive[i].BlobCount == 0 {
+			continue
+		}
+		// A reference with exclusive content is the only one that
+		// points at its target:
+		exclusive[i].Refname = refnames[i][0]
+		rs.Exclusive = append(rs.Exclusive, exclusive[i])
+	}
+	sort.SliceStable(rs.Exclusive, func(i, j int) bool {
+		ei, ej := rs.Exclusive[i], rs.Exclusive[j]
+		if ei.BlobSize != ej.BlobSize {
+			return ei.BlobSize > ej.BlobSize
+		}
+		return ei.Refname < ej.Refname
+	})
+	if len(rs.Exclusive) > MaxExclusiveRefsListed {
+		rs.Exclusive = rs.Exclusive[:MaxExclusiveRefsListed]
+	}
+	if rs.Exclusive == nil {
+		rs.Exclusive = []ExclusiveContent{}
+	}
+
+	return &rs, nil
+}
+
+// jsonV2 returns `rs` the way that it is represented in the version 2
+// JSON output, with camelCase names.
+func (rs *RefSharing) jsonV2() interface{} {
+	type exclusiveContent struct {
+		Refname   string         `json:"refname"`
+		BlobCount counts.Count32 `json:"blobCount"`
+		BlobSize  counts.Count64 `json:"blobSize"`
+	}
+	exclusive := make([]exclusiveContent, len(rs.Exclusive))
+	for i, ec := range rs.Exclusive {
+		exclusive[i] = exclusiveContent(ec)
+	}
+	return struct {
+		RefCount           counts.Count32     `json:"refCount"`
+		BlobCount          counts.Count32     `json:"blobCount"`
+		BlobSize           counts.Count64     `json:"blobSize"`
+		SharedBlobCount    counts.Count32     `json:"sharedBlobCount"`
+		SharedBlobSize     counts.Count64     `json:"sharedBlobSize"`
+		ExclusiveBlobCount counts.Count32     `json:"exclusiveBlobCount"`
+		ExclusiveBlobSize  counts.Count64     `json:"exclusiveBlobSize"`
+		Exclusive          []exclusiveContent `json:"exclusive"`
+	}{
+		RefCount:           rs.RefCount,
+		BlobCount:          rs.BlobCount,
+		BlobSize:           rs.BlobSize,
+		SharedBlobCount:    rs.SharedBlobCount,
+		SharedBlobSize:     rs.SharedBlobSize,
+		ExclusiveBlobCount: rs.ExclusiveBlobCount,
+		ExclusiveBlobSize:  rs.ExclusiveBlobSize,
+		Exclusive:          exclusive,
+	}
+}
+
+// String returns a human-readable summary of the blob sharing.
+func (rs *RefSharing) String() string {
+	if rs == nil {
+		return ""
+	}
+
+	size := func(n counts.Humanable) string {
+		numeral, unit := counts.Binary.Format(n, "B")
+		return strings.TrimSpace(numeral + " " + unit)
+	}
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "\nBlobs shared among the %d included references:\n\n", rs.RefCount)
+	fmt.Fprintf(buf, "    %-19s  %10s  %10s\n", "Blobs", "Count", "Size")
+	fmt.Fprintf(buf, "    %-19s  %10d  %10s\n", "All", rs.BlobCount, size(rs.BlobSize))
+	fmt.Fprintf(buf, "    %-19s  %10d  %10s\n", "Shared by all", rs.SharedBlobCount, size(rs.SharedBlobSize))
+	fmt.Fprintf(
+		buf, "    %-19s  %10d  %10s\n",
+		"Exclusive to one", rs.ExclusiveBlobCount, size(rs.ExclusiveBlobSize),
+	)
+
+	if len(rs.Exclusive) != 0 {
+		fmt.Fprintf(buf, "\nReferences with the most exclusive blob content:\n\n")
+		for _, e := range rs.Exclusive {
+			fmt.Fprintf(
+				buf, "    %10s  %8d blobs  %s\n",
+				size(e.BlobSize), e.BlobCount, git.DisplayString(e.Refname),
+			)
+		}
+	}
+	return buf.String()
+}
@@ -0,0 +1,184 @@
+package sizes
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/github/git-sizer/counts"
+	"github.com/github/git-sizer/git"
+)
+
+// RemoteSize describes how much the remote-tracking references of
+// one remote (i.e., those under `refs/remotes/<name>/`) contribute to
+// a repository.
+//
+// An object is *unique* to the remote if it is reachable from the
+// remote's references but not from any other reference that is
+// included in the scan (including other remotes' references). Those
+// are the objects that could be discarded if the remote were
+// removed and the repository garbage-collected. All of the other
+// objects that are reachable from the remote's references are
+// *shared*; they would be retained anyway.
+type RemoteSize struct {
+	// ReferenceCount is the number of the remote's references that
+	// were included.
+	ReferenceCount counts.Count32 `json:"reference_count"`
+
+	// ObjectCount and ObjectSize describe all of the objects
+	// reachable from the remote's references.
+	ObjectCount counts.Count64 `json:"object_count"`
+	ObjectSize  counts.Count64 `json:"object_size"`
+
+	// UniqueObjectCount, UniqueObjectSize, and UniqueDiskSize
+	// describe the objects that are unique to the remote.
+	UniqueObjectCount counts.Count64 `json:"unique_object_count"`
+	UniqueObjectSize  counts.Count64 `json:"unique_object_size"`
+	UniqueDiskSize    counts.Count64 `json:"unique_disk_size"`
+}
+
+// RemoteSizes maps remote names to their sizes.
+type RemoteSizes map[string]*RemoteSize
+
+// remoteName returns the name of the remote that `refname` belongs
+// to, or "" if it is not a remote-tracking reference.
+func remoteName(refname string) string {
+	rest := strings.TrimPrefix(refname, "refs/remotes/")
+	if rest == refname {
+		return ""
+	}
+	i := strings.IndexByte(rest, '/')
+	if i <= 0 {
+		return ""
+	}
+	return rest[:i]
+}
+
+// ComputeRemoteSizes computes the size of the objects reachable from
+// each remote's references, and of those that are unique to each
+// remote (see `RemoteSize`). Only references that `rg` selects for
+// walking are considered.
+func ComputeRemoteSizes(
+	ctx context.Context, repo *git.Repository, rg RefGrouper,
+) (RemoteSizes, error) {
+	refs, err := walkedReferences(ctx, repo, rg)
+	if err != nil {
+		return nil, err
+	}
+
+	remoteTips := make(map[string][]git.OID)
+	var tips []git.OID
+	var tipRemotes []string
+	for _, ref := range refs {
+		remote := remoteName(ref.Refname)
+		tips = append(tips, ref.OID)
+		tipRemotes = append(tipRemotes, remote)
+		if remote != "" {
+			remoteTips[remote] = append(remoteTips[remote], ref.OID)
+		}
+	}
+
+	remoteSizes := make(RemoteSizes, len(remoteTips))
+	for remote, include := range remoteTips {
+		var exclude []git.OID
+		for i, tip := range tips {
+			if tipRemotes[i] != remote {
+				exclude = append(exclude, tip)
+			}
+		}
+
+		all, err := repo.ReachableObjectsSize(ctx, include, nil)
+		if err != nil {
+			return nil, fmt.Errorf("measuring remote '%s': %w", git.DisplayString(remote), err)
+		}
+		unique, err := repo.ReachableObjectsSize(ctx, include, exclude)
+		if err != nil {
+			return nil, fmt.Errorf("measuring remote '%s': %w", git.DisplayString(remote), err)
+		}
+
+		remoteSizes[remote] = &RemoteSize{
+			ReferenceCount:    counts.NewCount32(uint64(len(include))),
+			ObjectCount:       counts.NewCount64(all.Count),
+			ObjectSize:        counts.NewCount64(all.Size),
+			UniqueObjectCount: counts.NewCount64(unique.Count),
+			UniqueObjectSize:  counts.NewCount64(unique.Size),
+			UniqueDiskSize:    counts.NewCount64(unique.DiskSize),
+		}
+	}
+
+	return remoteSizes, nil
+}
+
+// jsonV2 returns `rs` the way that it is represented in the version 2
+// JSON output, with camelCase names.
+func (rs RemoteSizes) jsonV2() interface{} {
+	type remoteSize struct {
+		ReferenceCount    counts.Count32 `json:"referenceCount"`
+		ObjectCount       counts.Count64 `json:"objectCount"`
+		ObjectSize        counts.Count64 `json:"objectSize"`
+		UniqueObjectCount counts.Count64 `json:"uniqueObjectCount"`
+		UniqueObjectSize  counts.Count64 `json:"uniqueObjectSize"`
+		UniqueDiskSize    counts.Count64 `json:"uniqueDiskSize"`
+	}
+	remotes := make(map[string]remoteSize, len(rs))
+	for name, size := range rs {
+		remotes[name] = remoteSize(*size)
+	}
+	return remotes
+}
+
+// String returns a human-readable table of the remotes' sizes,
+// largest unique contribution first.
+func (rs RemoteSizes) String() string {
+	if rs == nil {
+		return ""
+	}
+
+	buf := &bytes.Buffer{}
+	if len(rs) == 0 {
+		fmt.Fprintf(buf, "\nNo remote-tracking references were found\n")
+		return buf.String()
+	}
+
+	names := make([]string, 0, len(rs))
+	width := len("Remote")
+	for name := range rs {
+		names = append(names, name)
+		if w := len(git.DisplayString(name)); w > width {
+			width = w
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		si, sj := rs[names[i]].UniqueObjectSize, rs[names[j]].UniqueObjectSize
+		if si != sj {
+			return si > sj
+		}
+		return names[i] < names[j]
+	})
+
+	size := func(n counts.Humanable) string {
+		numeral, unit := counts.Binary.Format(n, "B")
+		return strings.TrimSpace(numeral + " " + unit)
+	}
+
+	fmt.Fprintf(
+		buf, "\nObjects by remote (unique objects are not reachable from any other\n"+
+			"included reference; shared objects are):\n\n",
+	)
+	fmt.Fprintf(
+		buf, "    %-*s  %6s  %10s  %10s  %10s  %10s\n",
+		width, "Remote", "Refs", "Objects", "Size", "Unique", "Unique size",
+	)
+	for _, name := range names {
+		r := rs[name]
+		fmt.Fprintf(
+			buf, "    %-*s  %6d  %10d  %10s  %10d  %10s\n",
+			width, git.DisplayString(name), r.ReferenceCount,
+			r.ObjectCount, size(r.ObjectSize),
+			r.UniqueObjectCount, size(r.UniqueObjectSize),
+		)
+	}
+	return buf.String()
+}
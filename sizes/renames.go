@@ -0,0 +1,183 @@
+package sizes
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/github/git-sizer/counts"
+	"github.com/github/git-sizer/git"
+)
+
+// MaxRenamedFilesListed is the maximum number of files that are
+// listed in `RenameStats.MostRenamed`.
+const MaxRenamedFilesListed = 10
+
+// RenamedFile is a file that was renamed in the history, identified
+// by the last name that it was given.
+type RenamedFile struct {
+	Path        string         `json:"path"`
+	RenameCount counts.Count32 `json:"rename_count"`
+}
+
+// RenameStats totals the renames and copies of files that Git detects
+// in the history, as computed by `CountRenames()`.
+type RenameStats struct {
+	// RenameCount and CopyCount are the numbers of renames and copies
+	// that were detected.
+	RenameCount counts.Count32 `json:"rename_count"`
+	CopyCount   counts.Count32 `json:"copy_count"`
+
+	// CommitCount is the number of commits that renamed or copied at
+	// least one file.
+	CommitCount counts.Count32 `json:"commit_count"`
+
+	// MostRenamed lists the files that were renamed most often (at
+	// most `MaxRenamedFilesListed` of them), most renames first.
+	MostRenamed []RenamedFile `json:"most_renamed"`
+}
+
+// CountRenames uses `git log --find-renames --find-copies` to count
+// the renames and copies of files in the commits reachable from the
+// references that `rg` walks. A file is followed through its renames,
+// so a file that was renamed several times is counted once, under its
+// last name. Merge commits aren't compared with their parents.
+//
+// This diffs every commit in the history, so it can take a long time
+// for big repositories.
+func CountRenames(
+	ctx context.Context, repo *git.Repository, rg RefGrouper,
+) (*RenameStats, error) {
+	var roots []string
+	var tips []git.OID
+	refs, err := walkedReferences(ctx, repo, rg)
+	if err != nil {
+		return nil, err
+	}
+	for _, ref := range refs {
+		roots = append(roots, ref.Refname)
+		tips = append(tips, ref.OID)
+	}
+
+	headers, err := repo.PeeledObjectHeaders(ctx, tips)
+	if err != nil {
+		return nil, err
+	}
+
+	// `git log` refuses references to trees and blobs:
+	var commitRoots []string
+	for i, header := range headers {
+		if header.ObjectType == "commit" {
+			commitRoots = append(commitRoots, roots[i])
+		}
+	}
+
+	rs := RenameStats{
+		MostRenamed: []RenamedFile{},
+	}
+
+	// Each file that has been renamed is identified by its original
+	// path. `identities` maps its current path to that identity:
+	identities := make(map[string]string)
+	renames := make(map[string]counts.Count32)
+	latest := make(map[string]string)
+
+	var lastCommit git.OID
+	if err := repo.ForEachRename(
+		ctx, commitRoots,
+		func(r git.PathRename) error {
+			if rs.CommitCount == 0 || r.Commit != lastCommit {
+				rs.CommitCount.Increment(1)
+				lastCommit = r.Commit
+			}
+
+			if r.Copy {
+				rs.CopyCount.Increment(1)
+				return nil
+			}
+
+			rs.RenameCount.Increment(1)
+			identity, ok := identities[r.OldPath]
+			if ok {
+				delete(identities, r.OldPath)
+			} else {
+				identity = r.OldPath
+			}
+			identities[r.NewPath] = identity
+			n := renames[identity]
+			n.Increment(1)
+			renames[identity] = n
+			latest[identity] = r.NewPath
+			return nil
+		},
+	); err != nil {
+		return nil, fmt.Errorf("listing renames: %w", err)
+	}
+
+	for identity, n := range renames {
+		rs.MostRenamed = append(
+			rs.MostRenamed, RenamedFile{Path: latest[identity], RenameCount: n},
+		)
+	}
+	sort.Slice(rs.MostRenamed, func(i, j int) bool {
+		ri, rj := rs.MostRenamed[i], rs.MostRenamed[j]
+		if ri.RenameCount != rj.RenameCount {
+			return ri.RenameCount > rj.RenameCount
+		}
+		return ri.Path < rj.Path
+	})
+	if len(rs.MostRenamed) > MaxRenamedFilesListed {
+		rs.MostRenamed = rs.MostRenamed[:MaxRenamedFilesListed]
+	}
+
+	return &rs, nil
+}
+
+// jsonV2 returns `rs` the way that it is represented in the version 2
+// JSON output, with camelCase names.
+func (rs *RenameStats) jsonV2() interface{} {
+	type renamedFile struct {
+		Path        string         `json:"path"`
+		RenameCount counts.Count32 `json:"renameCount"`
+	}
+	mostRenamed := make([]renamedFile, len(rs.MostRenamed))
+	for i, rf := range rs.MostRenamed {
+		mostRenamed[i] = renamedFile(rf)
+	}
+	return struct {
+		RenameCount counts.Count32 `json:"renameCount"`
+		CopyCount   counts.Count32 `json:"copyCount"`
+		CommitCount counts.Count32 `json:"commitCount"`
+		MostRenamed []renamedFile  `json:"mostRenamed"`
+	}{
+		RenameCount: rs.RenameCount,
+		CopyCount:   rs.CopyCount,
+		CommitCount: rs.CommitCount,
+		MostRenamed: mostRenamed,
+	}
+}
+
+// String returns the rename totals and a table of the files that were
+// renamed most often.
+func (rs *RenameStats) String() string {
+	if rs == nil {
+		return ""
+	}
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(
+		buf, "\nRenames detected in history: %d; copies: %d; commits with either: %d\n",
+		rs.RenameCount, rs.CopyCount, rs.CommitCount,
+	)
+	if len(rs.MostRenamed) == 0 {
+		return buf.String()
+	}
+
+	fmt.Fprintf(buf, "\nMost often renamed files (by their latest names):\n\n")
+	fmt.Fprintf(buf, "    %7s  %s\n", "Renames", "Path")
+	for _, f := range rs.MostRenamed {
+		fmt.Fprintf(buf, "    %7d  %s\n", f.RenameCount, git.DisplayString(f.Path))
+	}
+	return buf.String()
+}
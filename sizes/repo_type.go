@@ -0,0 +1,257 @@
+package sizes
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"path"
+	"strings"
+
+	"github.com/github/git-sizer/counts"
+	"github.com/github/git-sizer/git"
+)
+
+// The labels that `ClassifyRepository()` can choose.
+const (
+	RepoTypeSourceCode    = "source code"
+	RepoTypeAssetHeavy    = "asset-heavy"
+	RepoTypeMonorepo      = "monorepo"
+	RepoTypeDocumentation = "documentation"
+	RepoTypeUnknown       = "unknown"
+)
+
+// The kinds of files that `ClassifyRepository()` distinguishes.
+const (
+	fileKindCode   = "code"
+	fileKindDocs   = "docs"
+	fileKindAssets = "assets"
+	fileKindOther  = "other"
+)
+
+// fileKindsByExtension maps (lowercase) file extensions to the kinds
+// of files that they usually hold. Anything else is "other".
+var fileKindsByExtension = invertExtensions(map[string]string{
+	fileKindCode: ".c .cc .cpp .cs .cxx .dart .el .erl .ex .exs .go .h .hh .hpp " +
+		".hs .java .js .jsx .kt .kts .lua .m .mm .php .pl .pm .py .r .rb .rs " +
+		".scala .sh .sql .swift .ts .tsx .vue .zig",
+	fileKindDocs: ".adoc .asciidoc .htm .html .md .markdown .org .pdf .rst " +
+		".rtf .tex .texi .txt",
+	fileKindAssets: ".7z .aac .ai .avi .blend .bmp .dds .exr .fbx .flac .gif " +
+		".gz .hdr .ico .jar .jpeg .jpg .m4a .mkv .mov .mp3 .mp4 .obj .ogg " +
+		".otf .png .psd .tar .tga .tif .tiff .ttf .uasset .umap .wav .webm " +
+		".webp .woff .woff2 .xcf .zip",
+})
+
+// invertExtensions turns a map from kinds to space-separated lists
+// of extensions into a map from extensions to kinds.
+func invertExtensions(exts map[string]string) map[string]string {
+	kinds := make(map[string]string)
+	for kind, list := range exts {
+		for _, ext := range strings.Fields(list) {
+			kinds[ext] = kind
+		}
+	}
+	return kinds
+}
+
+// projectManifests are the names of the files that mark the top of a
+// buildable project. A repository that contains many of them is
+// likely to be a monorepo.
+var projectManifests = map[string]bool{
+	"BUILD":            true,
+	"BUILD.bazel":      true,
+	"Cargo.toml":       true,
+	"build.gradle":     true,
+	"build.gradle.kts": true,
+	"go.mod":           true,
+	"package.json":     true,
+	"pom.xml":          true,
+	"pyproject.toml":   true,
+	"setup.py":         true,
+}
+
+const (
+	// monorepoManifestCount is the number of project manifests at
+	// which a repository is certainly a monorepo. A quarter as many
+	// suffice to call it one.
+	monorepoManifestCount = 20
+
+	// monorepoFileCount is the number of files in the checkout at
+	// which a repository is considered a monorepo regardless of its
+	// manifests.
+	monorepoFileCount = 100000
+)
+
+// FileKindShare describes the files of one kind in a checkout.
+type FileKindShare struct {
+	Count counts.Count32 `json:"count"`
+	Size  counts.Count64 `json:"size"`
+}
+
+// RepoType is a best guess at what kind of repository was scanned,
+// made by `ClassifyRepository()`.
+type RepoType struct {
+	// Label is one of the `RepoType*` constants.
+	Label string `json:"label"`
+
+	// Confidence, between 0 and 1, is how strongly the evidence
+	// points at `Label`.
+	Confidence float64 `json:"confidence"`
+
+	// Rev is the revision whose files were considered.
+	Rev string `json:"rev"`
+
+	// FileCount is the number of files in `Rev`'s tree, and
+	// ManifestCount the number of project manifests (e.g., `go.mod`
+	// or `package.json`) among them.
+	FileCount     counts.Count32 `json:"file_count"`
+	ManifestCount counts.Count32 `json:"manifest_count"`
+
+	// Kinds totals the files in `Rev`'s tree by kind ("code",
+	// "docs", "assets", or "other"), judging by their extensions.
+	Kinds map[string]FileKindShare `json:"kinds"`
+}
+
+// ClassifyRepository guesses what kind of repository `repo` is from
+// the mix of file extensions in the tree of `rev` and from the blob
+// statistics in `s`:
+//
+//   - "asset-heavy" if most of the bytes in the checkout, or the
+//     average blob in history, are media or archives; the confidence
+//     is the share of the bytes that are assets, but at least 50%.
+//   - "monorepo" if the checkout has many files or several project
+//     manifests (like `go.mod` or `package.json`); the confidence
+//     grows with their number from 50% to 100%.
+//   - "documentation" if most of the files are documents; the
+//     confidence is their share.
+//   - "source code" otherwise; the confidence is the share of files
+//     that are code.
+//
+// It is "unknown", with no confidence, if the checkout is empty.
+func ClassifyRepository(
+	ctx context.Context, repo *git.Repository, rev string, s *HistorySize,
+) (*RepoType, error) {
+	rt := RepoType{
+		Rev: rev,
+		Kinds: map[string]FileKindShare{
+			fileKindCode:   {},
+			fileKindDocs:   {},
+			fileKindAssets: {},
+			fileKindOther:  {},
+		},
+	}
+
+	if err := repo.ForEachLsTreeEntry(
+		ctx, rev,
+		func(entry git.LsTreeEntry) error {
+			if entry.ObjectType != "blob" {
+				return nil
+			}
+			rt.FileCount.Increment(1)
+			name := path.Base(entry.Path)
+			if projectManifests[name] {
+				rt.ManifestCount.Increment(1)
+			}
+			kind, ok := fileKindsByExtension[strings.ToLower(path.Ext(name))]
+			if !ok {
+				kind = fileKindOther
+			}
+			share := rt.Kinds[kind]
+			share.Count.Increment(1)
+			share.Size.Increment(counts.Count64(entry.Size))
+			rt.Kinds[kind] = share
+			return nil
+		},
+	); err != nil {
+		return nil, fmt.Errorf("listing the files in '%s': %w", rev, err)
+	}
+
+	if rt.FileCount == 0 {
+		rt.Label = RepoTypeUnknown
+		return &rt, nil
+	}
+
+	var totalSize counts.Count64
+	for _, share := range rt.Kinds {
+		totalSize.Increment(share.Size)
+	}
+	countShare := func(kind string) float64 {
+		return float64(rt.Kinds[kind].Count) / float64(rt.FileCount)
+	}
+	sizeShare := func(kind string) float64 {
+		if totalSize == 0 {
+			return 0
+		}
+		return float64(rt.Kinds[kind].Size) / float64(totalSize)
+	}
+
+	// Big blobs in history suggest assets even if they have since
+	// been removed from the checkout:
+	var meanBlobSize float64
+	if s != nil && s.UniqueBlobCount != 0 {
+		meanBlobSize = float64(s.UniqueBlobSize) / float64(s.UniqueBlobCount)
+	}
+
+	switch {
+	case sizeShare(fileKindAssets) >= 0.5 || meanBlobSize >= 1<<20:
+		rt.Label = RepoTypeAssetHeavy
+		rt.Confidence = math.Max(sizeShare(fileKindAssets), 0.5)
+	case rt.ManifestCount >= monorepoManifestCount/4 || rt.FileCount >= monorepoFileCount:
+		rt.Label = RepoTypeMonorepo
+		rt.Confidence = 0.5 + 0.5*math.Min(
+			1,
+			math.Max(
+				float64(rt.ManifestCount)/monorepoManifestCount,
+				float64(rt.FileCount)/monorepoFileCount,
+			),
+		)
+	case countShare(fileKindDocs) > 0.5:
+		rt.Label = RepoTypeDocumentation
+		rt.Confidence = countShare(fileKindDocs)
+	default:
+		rt.Label = RepoTypeSourceCode
+		rt.Confidence = countShare(fileKindCode)
+	}
+
+	return &rt, nil
+}
+
+// jsonV2 returns `rt` the way that it is represented in the version 2
+// JSON output, with camelCase names.
+func (rt *RepoType) jsonV2() interface{} {
+	return struct {
+		Label         string                   `json:"label"`
+		Confidence    float64                  `json:"confidence"`
+		Rev           string                   `json:"rev"`
+		FileCount     counts.Count32           `json:"fileCount"`
+		ManifestCount counts.Count32           `json:"manifestCount"`
+		Kinds         map[string]FileKindShare `json:"kinds"`
+	}(*rt)
+}
+
+// String returns the label and a table of the file kinds.
+func (rt *RepoType) String() string {
+	if rt == nil {
+		return ""
+	}
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(
+		buf, "\nRepository type: %s (confidence %.0f%%)\n\n", rt.Label, 100*rt.Confidence,
+	)
+	fmt.Fprintf(
+		buf, "Files in '%s' by kind (project manifests: %d):\n\n",
+		git.DisplayString(rt.Rev), rt.ManifestCount,
+	)
+	fmt.Fprintf(buf, "    %-13s  %10s  %10s\n", "Kind", "Count", "Size")
+	for _, kind := range []string{fileKindCode, fileKindDocs, fileKindAssets, fileKindOther} {
+		share := rt.Kinds[kind]
+		numeral, unit := counts.Binary.Format(share.Size, "B")
+		fmt.Fprintf(
+			buf, "    %-13s  %10d  %10s\n",
+			kind, share.Count, strings.TrimSpace(numeral+" "+unit),
+		)
+	}
+	return buf.String()
+}
@@ -0,0 +1,260 @@
+package sizes
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+
+	"github.com/github/git-sizer/counts"
+	"github.com/github/git-sizer/git"
+)
+
+// sampleExtrapolated lists the items whose values are extrapolated
+// in a sampled scan.
+var sampleExtrapolated = []string{
+	"uniqueCommitSize",
+	"signedCommitCount", "signedCommitRatio",
+	"emptyCommitCount", "nonUTF8CommitCount",
+	"malformedIdentityCommitCount", "implausibleDateCommitCount",
+	"blobSizeP50", "blobSizeP90", "blobSizeP99",
+}
+
+// sampleLowerBounds lists the items whose values are only lower bounds
+// in a sampled scan, because they cover only the objects that are
+// reachable from the sampled commits' trees. (The number of distinct
+// objects doesn't grow in proportion to the number of commits, so
+// their totals can't be extrapolated like the commit totals.)
+var sampleLowerBounds = []string{
+	"maxCommitSize", "maxChangedPaths", "maxNewBlobSize",
+	"uniqueTreeCount", "uniqueTreeSize", "uniqueTreeEntries", "longTreeEntryNames",
+	"maxTreeEntries", "maxTreeEntryNameLength", "maxDirFanOut",
+	"uniqueBlobCount", "uniqueBlobSize", "maxBlobSize", "maxBlobRefWeight",
+	"oversizedBlobCount", "oversizedBlobSize", "bigFileCount", "bigFileSize",
+	"maxCheckoutTreeCount", "maxCheckoutPathDepth", "maxCheckoutPathLength",
+	"maxCheckoutBlobCount", "maxCheckoutBlobSize", "maxCheckoutLinkCount",
+	"maxCheckoutSubmoduleCount",
+	"missingObjectCount", "unknownTypeObjectCount", "malformedObjectCount",
+}
+
+// SampleInfo describes how a sampled scan (see
+// `ScanOptions.SampleRate`) was carried out, and how precise its
+// results are.
+type SampleInfo struct {
+	// Rate is the fraction of commits that were sampled.
+	Rate float64 `json:"rate"`
+
+	// Seed is the seed of the pseudorandom number generator that
+	// chose the sample.
+	Seed int64 `json:"seed"`
+
+	// CommitCount is the total number of commits in the history.
+	CommitCount counts.Count32 `json:"commit_count"`
+
+	// SampledCommitCount is the number of commits whose trees were
+	// actually scanned.
+	SampledCommitCount counts.Count32 `json:"sampled_commit_count"`
+
+	// CommitSizeMargin is the half-width of the 95% confidence
+	// interval for the extrapolated total commit size, as a fraction
+	// of that total.
+	CommitSizeMargin float64 `json:"commit_size_margin"`
+
+	// Extrapolated and LowerBounds list the symbols of the
+	// statistics whose values were extrapolated or are only lower
+	// bounds, respectively. Other statistics are exact.
+	Extrapolated []string `json:"extrapolated"`
+	LowerBounds  []string `json:"lower_bounds"`
+}
+
+// jsonV2 returns `si` the way that it is represented in the version 2
+// JSON output, with camelCase names.
+func (si *SampleInfo) jsonV2() interface{} {
+	return struct {
+		Rate               float64        `json:"rate"`
+		Seed               int64          `json:"seed"`
+		CommitCount        counts.Count32 `json:"commitCount"`
+		SampledCommitCount counts.Count32 `json:"sampledCommitCount"`
+		CommitSizeMargin   float64        `json:"commitSizeMargin"`
+		Extrapolated       []string       `json:"extrapolated"`
+		LowerBounds        []string       `json:"lowerBounds"`
+	}(*si)
+}
+
+// markItems records in the items of `c` how their values were
+// derived, if `si` is set.
+func (si *SampleInfo) markItems(c tableContents) {
+	if si == nil {
+		return
+	}
+	markEstimates(c, si.Extrapolated, si.LowerBounds)
+}
+
+// String returns a note describing the sample, to be shown along
+// with the approximate results.
+func (si *SampleInfo) String() string {
+	if si == nil {
+		return ""
+	}
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(
+		buf,
+		"NOTE: These results are approximate. Only a random sample of %d of %d\n"+
+			"commits (sample rate %g, seed %d) were scanned. The commit count,\n"+
+			"history depth, parent count, and merge count are exact. Values marked\n"+
+			"'~' are extrapolated; the total commit size is +/- %.1f%% at 95%%\n"+
+			"confidence. Values marked '+' cover only the objects in the sampled\n"+
+			"commits' trees, so they are lower bounds.\n\n",
+		si.SampledCommitCount, si.CommitCount, si.Rate, si.Seed, 100*si.CommitSizeMargin,
+	)
+	return buf.String()
+}
+
+// commitSample is the result of `sampleCommits()`.
+type commitSample struct {
+	// sampled lists the commits that were chosen for scanning.
+	sampled []git.OID
+
+	// Statistics about the full history, which are cheap to compute
+	// exactly:
+	commitCount     counts.Count32
+	maxHistoryDepth counts.Count32
+	maxMergeDepth   counts.Count32
+	maxParentCount  counts.Count32
+	mergeCount      counts.Count32
+}
+
+// sampleCommits walks the commits reachable from `roots` (without
+// reading their trees) and chooses a simple random sample of a
+// fraction `rate` of them (but at least one) to be scanned. The
+// pseudorandom number generator is seeded with `seed`, so that the
+// same seed chooses the same sample. Along the way, it computes the
+// statistics in `commitSample` that don't depend on trees.
+func sampleCommits(
+	ctx context.Context, repo *git.Repository, roots []git.OID, rate float64, seed int64,
+) (*commitSample, error) {
+	var cs commitSample
+	depths := make(map[git.OID]counts.Count32)
+	mergeDepths := make(map[git.OID]counts.Count32)
+
+	var all []git.OID
+	err := repo.ForEachCommit(
+		ctx, roots, nil,
+		func(oid git.OID, parents []git.OID) error {
+			var depth, mergeDepth counts.Count32
+			for _, parent := range parents {
+				depth.AdjustMaxIfNecessary(depths[parent])
+				mergeDepth.AdjustMaxIfNecessary(mergeDepths[parent])
+			}
+			depth.Increment(1)
+			depths[oid] = depth
+			if len(parents) > 1 {
+				mergeDepth.Increment(1)
+			}
+			mergeDepths[oid] = mergeDepth
+
+			cs.commitCount.Increment(1)
+			cs.maxHistoryDepth.AdjustMaxIfNecessary(depth)
+			cs.maxMergeDepth.AdjustMaxIfNecessary(mergeDepth)
+			cs.maxParentCount.AdjustMaxIfNecessary(counts.NewCount32(uint64(len(parents))))
+			if len(parents) > 1 {
+				cs.mergeCount.Increment(1)
+			}
+
+			all = append(all, oid)
+			return nil
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("listing commits to sample: %w", err)
+	}
+
+	if len(all) == 0 {
+		return &cs, nil
+	}
+	n := int(math.Round(rate * float64(len(all))))
+	if n < 1 {
+		n = 1
+	}
+	chosen := rand.New(rand.NewSource(seed)).Perm(len(all))[:n]
+	// Scan the chosen commits in the order that they were walked in,
+	// which keeps related objects together:
+	sort.Ints(chosen)
+	cs.sampled = make([]git.OID, n)
+	for i, j := range chosen {
+		cs.sampled[i] = all[j]
+	}
+
+	return &cs, nil
+}
+
+// extrapolateCommits replaces the commit statistics in `s`, which
+// only reflect the sampled commits, with exact values from `cs` or
+// with values extrapolated from `commitSizes`, the sizes of the
+// commits that were scanned. The tree and blob statistics are left
+// alone, as lower bounds. It also records `s.Sample`.
+func (s *HistorySize) extrapolateCommits(
+	rate float64, seed int64, cs *commitSample, commitSizes []counts.Count32,
+) {
+	si := SampleInfo{
+		Rate:               rate,
+		Seed:               seed,
+		CommitCount:        cs.commitCount,
+		SampledCommitCount: counts.NewCount32(uint64(len(commitSizes))),
+		Extrapolated:       sampleExtrapolated,
+		LowerBounds:        sampleLowerBounds,
+	}
+
+	n := float64(len(commitSizes))
+	if n > 0 {
+		var sum, sumSq float64
+		for _, size := range commitSizes {
+			sum += float64(size)
+			sumSq += float64(size) * float64(size)
+		}
+		mean := sum / n
+		total := mean * float64(cs.commitCount)
+		s.UniqueCommitSize = counts.NewCount64(uint64(math.Round(total)))
+
+		if n > 1 && mean > 0 {
+			variance := (sumSq - n*mean*mean) / (n - 1)
+			// Apply the finite population correction, since we might
+			// have sampled a large fraction of all commits:
+			fpc := 1 - n/float64(cs.commitCount)
+			if variance > 0 && fpc > 0 {
+				si.CommitSizeMargin = 1.96 * math.Sqrt(variance/n*fpc) / mean
+			}
+		}
+
+		// The counts of commits with some property scale the same
+		// way:
+		factor := float64(cs.commitCount) / n
+		for _, count := range []*counts.Count32{
+			&s.SignedCommitCount, &s.EmptyCommitCount, &s.NonUTF8CommitCount,
+			&s.MalformedIdentityCommitCount, &s.ImplausibleDateCommitCount,
+		} {
+			*count = counts.NewCount32(uint64(math.Round(float64(*count) * factor)))
+		}
+	}
+
+	s.UniqueCommitCount = cs.commitCount
+	s.MaxHistoryDepth = cs.maxHistoryDepth
+	if s.MaxMergeDepth != cs.maxMergeDepth {
+		// The commit where the deepest merge chain peaked wasn't
+		// sampled:
+		s.MaxMergeDepth = cs.maxMergeDepth
+		s.MaxMergeDepthCommit = nil
+	}
+	s.MergeCommitCount = cs.mergeCount
+	if s.MaxParentCount != cs.maxParentCount {
+		// The commit with the most parents wasn't sampled, so we
+		// don't know which one it was.
+		s.MaxParentCount = cs.maxParentCount
+		s.MaxParentCountCommit = nil
+	}
+
+	s.Sample = &si
+}
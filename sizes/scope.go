@@ -0,0 +1,179 @@
+package sizes
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/github/git-sizer/counts"
+	"github.com/github/git-sizer/git"
+)
+
+// ScanScope describes a scan that was limited to part of the history
+// (see `ScanOptions.Roots`, `ScanOptions.Exclude`, and
+// `ScanOptions.FirstParent`) or whose blob and tree statistics were
+// limited by path or by date (see `ScanOptions.PathRules` and
+// `ScanOptions.IntroducedSince`).
+type ScanScope struct {
+	// Roots names the objects at which the walk started.
+	Roots []string `json:"roots,omitempty"`
+
+	// Exclude lists the commits whose history was left out.
+	Exclude []git.OID `json:"exclude,omitempty"`
+
+	// FirstParent is set if only the first-parent history of the
+	// roots was scanned.
+	FirstParent bool `json:"first_parent,omitempty"`
+
+	// PathRules lists the rules that selected the paths to which the
+	// blob and tree statistics were limited.
+	PathRules []PathRule `json:"path_rules,omitempty"`
+
+	// IntroducedSince, if set, is the date after which the commits
+	// that first introduced an object must have been committed for
+	// the object to be included in the blob and tree statistics.
+	IntroducedSince *time.Time `json:"introduced_since,omitempty"`
+
+	// ExcludedBlobCount and ExcludedBlobSize describe the blobs that
+	// were scanned but left out of the blob statistics because
+	// `PathRules` didn't select any path at which they were found or
+	// because they were introduced too early.
+	ExcludedBlobCount counts.Count32 `json:"excluded_blob_count,omitempty"`
+	ExcludedBlobSize  counts.Count64 `json:"excluded_blob_size,omitempty"`
+}
+
+// jsonV2 returns `ss` the way that it is represented in the version 2
+// JSON output, with camelCase names.
+func (ss *ScanScope) jsonV2() interface{} {
+	return struct {
+		Roots             []string       `json:"roots,omitempty"`
+		Exclude           []git.OID      `json:"exclude,omitempty"`
+		FirstParent       bool           `json:"firstParent,omitempty"`
+		PathRules         []PathRule     `json:"pathRules,omitempty"`
+		IntroducedSince   *time.Time     `json:"introducedSince,omitempty"`
+		ExcludedBlobCount counts.Count32 `json:"excludedBlobCount,omitempty"`
+		ExcludedBlobSize  counts.Count64 `json:"excludedBlobSize,omitempty"`
+	}(*ss)
+}
+
+// String returns a note describing the scope of the scan, to be shown
+// along with the results.
+func (ss *ScanScope) String() string {
+	if ss == nil {
+		return ""
+	}
+
+	buf := &bytes.Buffer{}
+	if len(ss.Roots) != 0 {
+		roots := make([]string, len(ss.Roots))
+		for i, root := range ss.Roots {
+			roots[i] = git.DisplayString(root)
+		}
+
+		fmt.Fprintf(buf, "NOTE: Only objects reachable from %s", strings.Join(roots, ", "))
+		if len(ss.Exclude) != 0 {
+			excludes := make([]string, len(ss.Exclude))
+			for i, oid := range ss.Exclude {
+				excludes[i] = oid.String()
+			}
+			fmt.Fprintf(buf, "\nbut not from %s", strings.Join(excludes, ", "))
+		}
+		fmt.Fprint(buf, " were scanned.\n\n")
+	}
+	if ss.FirstParent {
+		fmt.Fprint(
+			buf,
+			"NOTE: Only the first-parent (mainline) history of each reference was\n"+
+				"scanned; the commits merged in from other branches, and the objects\n"+
+				"that only they refer to, were left out. The history depth is the\n"+
+				"length of the mainline.\n\n",
+		)
+	}
+	var limits []string
+	if len(ss.PathRules) != 0 {
+		rules := make([]string, len(ss.PathRules))
+		for i, rule := range ss.PathRules {
+			rules[i] = rule.String()
+		}
+		limits = append(
+			limits, fmt.Sprintf("at the paths\nselected by %s", strings.Join(rules, " ")),
+		)
+	}
+	if ss.IntroducedSince != nil {
+		limits = append(
+			limits,
+			fmt.Sprintf(
+				"first introduced by\ncommits dated after %s",
+				ss.IntroducedSince.Format(time.RFC3339),
+			),
+		)
+	}
+	if len(limits) != 0 {
+		numeral, unit := counts.Binary.Format(ss.ExcludedBlobSize, "B")
+		fmt.Fprintf(
+			buf,
+			"NOTE: The blob and tree statistics only include objects %s.\n"+
+				"%d other blobs (%s) were left out. The commit, tag, and reference\n"+
+				"statistics are for all of the history that was scanned.\n",
+			strings.Join(limits, ",\nand "),
+			ss.ExcludedBlobCount, strings.TrimSpace(numeral+" "+unit),
+		)
+		if ss.IntroducedSince != nil {
+			fmt.Fprint(
+				buf,
+				"The checkout statistics (e.g., the maximum path depth) aren't\n"+
+					"limited by date.\n",
+			)
+		}
+		fmt.Fprint(buf, "\n")
+	}
+	return buf.String()
+}
+
+// ResolveMergeBaseRange resolves `spec`, of the form `<base>..<tip>`
+// or `<base>...<tip>` (where either side defaults to `HEAD`, as in
+// Git), to the commit `tip` and the merge base of `base` and `tip`.
+// The history of `tip` since the merge base is what was introduced
+// on `tip` relative to `base`. The returned root is named by `<tip>`.
+func ResolveMergeBaseRange(repo *git.Repository, spec string) (git.Reference, git.OID, error) {
+	sep := "..."
+	i := strings.Index(spec, sep)
+	if i == -1 {
+		sep = ".."
+		i = strings.Index(spec, sep)
+	}
+	if i == -1 {
+		return git.Reference{}, git.NullOID, fmt.Errorf(
+			"malformed range %q: expected '<base>..<tip>' or '<base>...<tip>'", spec,
+		)
+	}
+
+	baseRev, tipRev := spec[:i], spec[i+len(sep):]
+	if baseRev == "" {
+		baseRev = "HEAD"
+	}
+	if tipRev == "" {
+		tipRev = "HEAD"
+	}
+
+	base, err := repo.ResolveCommit(baseRev)
+	if err != nil {
+		return git.Reference{}, git.NullOID, err
+	}
+	tip, err := repo.ResolveCommit(tipRev)
+	if err != nil {
+		return git.Reference{}, git.NullOID, err
+	}
+	mergeBase, err := repo.MergeBase(base, tip)
+	if err != nil {
+		return git.Reference{}, git.NullOID, err
+	}
+
+	root := git.Reference{
+		Refname:    tipRev,
+		ObjectType: "commit",
+		OID:        tip,
+	}
+	return root, mergeBase, nil
+}
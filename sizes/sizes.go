@@ -2,6 +2,8 @@ package sizes
 
 import (
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/github/git-sizer/counts"
 	"github.com/github/git-sizer/git"
@@ -82,10 +84,15 @@ func (s *TreeSize) addSubmodule(filename string) {
 type CommitSize struct {
 	// The height of the ancestor graph, including this commit.
 	MaxAncestorDepth counts.Count32 `json:"max_ancestor_depth"`
+
+	// The largest number of merge commits on any chain of ancestors
+	// leading to this commit, including this commit.
+	MaxMergeDepth counts.Count32 `json:"max_merge_depth"`
 }
 
 func (s *CommitSize) addParent(s2 CommitSize) {
 	s.MaxAncestorDepth.AdjustMaxIfNecessary(s2.MaxAncestorDepth)
+	s.MaxMergeDepth.AdjustMaxIfNecessary(s2.MaxMergeDepth)
 }
 
 func (s *CommitSize) addTree(s2 TreeSize) {
@@ -113,12 +120,56 @@ type HistorySize struct {
 	// The maximum ancestor depth of any analyzed commit.
 	MaxHistoryDepth counts.Count32 `json:"max_history_depth"`
 
+	// The largest number of merge commits on any chain of commits in
+	// the analyzed history.
+	MaxMergeDepth counts.Count32 `json:"max_merge_depth"`
+
+	// A commit (usually the tip of a reference) at the end of such a
+	// chain.
+	MaxMergeDepthCommit *Path `json:"max_merge_depth_commit,omitempty"`
+
 	// The maximum number of direct parents of any analyzed commit.
 	MaxParentCount counts.Count32 `json:"max_parent_count"`
 
 	// The commit with the maximum number of direct parents.
 	MaxParentCountCommit *Path `json:"max_parent_count_commit,omitempty"`
 
+	// The number of analyzed commits with more than one parent.
+	MergeCommitCount counts.Count32 `json:"merge_commit_count"`
+
+	// The number of analyzed commits that are signed (with GPG, SSH,
+	// or X.509). Signatures are not verified.
+	SignedCommitCount counts.Count32 `json:"signed_commit_count"`
+
+	// The number of analyzed commits that don't contain or change
+	// any files, because their tree is empty or is the same as their
+	// first parent's (e.g., empty merges), and the first such commit.
+	EmptyCommitCount counts.Count32 `json:"empty_commit_count"`
+	EmptyCommit      *Path          `json:"empty_commit,omitempty"`
+
+	// The number of analyzed commits with an `encoding` header other
+	// than UTF-8, and the first such commit.
+	NonUTF8CommitCount counts.Count32 `json:"non_utf8_commit_count"`
+	NonUTF8Commit      *Path          `json:"non_utf8_commit,omitempty"`
+
+	// The number of analyzed commits whose author or committer header
+	// is missing or can't be parsed, and the first such commit.
+	MalformedIdentityCommitCount counts.Count32 `json:"malformed_identity_commit_count"`
+	MalformedIdentityCommit      *Path          `json:"malformed_identity_commit,omitempty"`
+
+	// The number of analyzed commits whose author or committer date
+	// is before 1980 or more than a day in the future, and the first
+	// such commit.
+	ImplausibleDateCommitCount counts.Count32 `json:"implausible_date_commit_count"`
+	ImplausibleDateCommit      *Path          `json:"implausible_date_commit,omitempty"`
+
+	// The trees with problems that `git fsck` reports.
+	TreeAnomalies TreeAnomalies `json:"tree_anomalies"`
+
+	// The range of the committer dates of the analyzed commits, or
+	// nil if none of them has a usable committer.
+	CommitDates *CommitDates `json:"commit_dates,omitempty"`
+
 	// The total number of unique trees analyzed.
 	UniqueTreeCount counts.Count32 `json:"unique_tree_count"`
 
@@ -134,6 +185,17 @@ type HistorySize struct {
 	// The tree with the maximum number of entries.
 	MaxTreeEntriesTree *Path `json:"max_tree_entries_tree,omitempty"`
 
+	// The length, in bytes, of the longest name of any single tree
+	// entry.
+	MaxTreeEntryNameLength counts.Count32 `json:"max_tree_entry_name_length"`
+
+	// The tree containing the entry with the longest name.
+	MaxTreeEntryNameLengthTree *Path `json:"max_tree_entry_name_length_tree,omitempty"`
+
+	// The number of entries in all unique trees analyzed whose names
+	// are longer than `MaxPortableNameLength` bytes.
+	LongTreeEntryNameCount counts.Count64 `json:"long_tree_entry_name_count"`
+
 	// The total number of unique blobs analyzed.
 	UniqueBlobCount counts.Count32 `json:"unique_blob_count"`
 
@@ -146,24 +208,271 @@ type HistorySize struct {
 	// The biggest blob found.
 	MaxBlobSizeBlob *Path `json:"max_blob_size_blob,omitempty"`
 
+	// The largest product, over all blobs, of the blob's size and the
+	// number of tree entries (in distinct trees) that refer to it. A
+	// big blob that appears in many places inflates checkouts and
+	// history traversals. MaxBlobRefWeightBlob is that blob, and
+	// MaxBlobRefWeightSize and MaxBlobRefWeightRefCount are its size
+	// and its number of references.
+	MaxBlobRefWeight         counts.Count64 `json:"max_blob_ref_weight"`
+	MaxBlobRefWeightBlob     *Path          `json:"max_blob_ref_weight_blob,omitempty"`
+	MaxBlobRefWeightSize     counts.Count32 `json:"max_blob_ref_weight_size"`
+	MaxBlobRefWeightRefCount counts.Count32 `json:"max_blob_ref_weight_ref_count"`
+
+	// The 50th, 90th, and 99th percentiles of the sizes of the
+	// analyzed blobs. These are estimates, accurate to within 1% of
+	// the true values (see `quantileSketch`).
+	BlobSizeP50 counts.Count32 `json:"blob_size_p50"`
+	BlobSizeP90 counts.Count32 `json:"blob_size_p90"`
+	BlobSizeP99 counts.Count32 `json:"blob_size_p99"`
+
 	// The total number of unique tag objects analyzed.
 	UniqueTagCount counts.Count32 `json:"unique_tag_count"`
 
+	// The total size of all of the unique tag objects analyzed.
+	UniqueTagSize counts.Count64 `json:"unique_tag_size"`
+
+	// The size of the longest message of any analyzed tag, and the
+	// tag that has it.
+	MaxTagMessageSize counts.Count32 `json:"max_tag_message_size"`
+	MaxTagMessageTag  *Path          `json:"max_tag_message_tag,omitempty"`
+
+	// The number of analyzed tag objects that are signed. Signatures
+	// are not verified.
+	SignedTagCount counts.Count32 `json:"signed_tag_count"`
+
 	// The maximum number of tags in a chain.
 	MaxTagDepth counts.Count32 `json:"max_tag_depth"`
 
 	// The tag with the maximum tag depth.
 	MaxTagDepthTag *Path `json:"max_tag_depth_tag,omitempty"`
 
+	// The number of packfiles in the repository's object directory
+	// (including cruft packs).
+	PackCount counts.Count32 `json:"pack_count"`
+
+	// The total size of those packfiles, in bytes.
+	PackSize counts.Count64 `json:"pack_size"`
+
+	// The size of the largest single packfile, in bytes.
+	MaxPackSize counts.Count64 `json:"max_pack_size"`
+
+	// The number and total size of the cruft packs among them, which
+	// hold unreachable objects until they expire.
+	CruftPackCount counts.Count32 `json:"cruft_pack_count"`
+	CruftPackSize  counts.Count64 `json:"cruft_pack_size"`
+
 	// The number of references analyzed. Note that we don't eliminate
 	// duplicates if the user passes the same reference more than
 	// once.
 	ReferenceCount counts.Count32 `json:"reference_count"`
 
+	// The maximum number of walked references that resolve (after
+	// peeling any annotated tags) to the same commit, and that
+	// commit.
+	MaxRefsPerCommit       counts.Count32 `json:"max_refs_per_commit"`
+	MaxRefsPerCommitCommit *Path          `json:"max_refs_per_commit_commit,omitempty"`
+
 	// ReferenceGroups keeps track of how many references in each
 	// reference group were scanned.
 	ReferenceGroups map[RefGroupSymbol]*counts.Count32 `json:"reference_groups"`
 
+	// Errors describes any objects that couldn't be read or parsed
+	// and were therefore skipped. It is nil if there were no such
+	// objects.
+	Errors *CorruptObjects `json:"errors,omitempty"`
+
+	// Worst identifies the statistic with the highest level of
+	// concern.
+	Worst *Statistic `json:"worst,omitempty"`
+
+	// BrokenReferences describes any references that point at
+	// objects that don't exist, and were therefore not scanned. It
+	// is nil if there were no such references.
+	BrokenReferences *BrokenReferences `json:"broken_references,omitempty"`
+
+	// Attributes holds the counts of blobs by gitattribute, if they
+	// were requested (see `CountAttributes()`).
+	Attributes *AttributeCounts `json:"attributes,omitempty"`
+
+	// TopBlobsByAttribute splits the blobs in `TopBlobs` by a
+	// gitattribute, if that was requested (see
+	// `ClassifyTopBlobs()`).
+	TopBlobsByAttribute *AttributeSplit `json:"top_blobs_by_attribute,omitempty"`
+
+	// RepoType is a guess at what kind of repository this is, if it
+	// was requested (see `ClassifyRepository()`).
+	RepoType *RepoType `json:"repo_type,omitempty"`
+
+	// DuplicateNames lists the most duplicated file names in the
+	// checkout, if that was requested (see `FindDuplicateNames()`).
+	DuplicateNames *DuplicateNames `json:"duplicate_names,omitempty"`
+
+	// TopBlobHistory lists the commits that touched the path of the
+	// largest blob, if it was requested (see `BlameTopBlob()`).
+	TopBlobHistory *TopBlobHistory `json:"top_blob_history,omitempty"`
+
+	// Renames totals the renames and copies of files in the history,
+	// if they were requested (see `CountRenames()`).
+	Renames *RenameStats `json:"renames,omitempty"`
+
+	// LFSSizes compares the size of the blobs with the size of the
+	// content including Git LFS objects, if that was requested (see
+	// `ComputeLFSSizes()`).
+	LFSSizes *LFSSizes `json:"lfs_sizes,omitempty"`
+
+	// Submodules holds the results of scanning the repository's
+	// submodules, keyed by path, if that was requested (see
+	// `ScanSubmodules()`). In that case, Combined totals the
+	// statistics across the repository and its submodules.
+	Submodules SubmoduleSizes `json:"submodules,omitempty"`
+	Combined   *CombinedSize  `json:"combined,omitempty"`
+
+	// Remotes holds the sizes of the objects reachable from each
+	// remote's references, if they were requested (see
+	// `ComputeRemoteSizes()`).
+	Remotes RemoteSizes `json:"remotes,omitempty"`
+
+	// Namespaces breaks the reachable objects down by reference
+	// namespace, if that was requested (see
+	// `ComputeNamespaceObjects()`).
+	Namespaces NamespaceObjects `json:"namespaces,omitempty"`
+
+	// Comparison compares the reachable objects with those of
+	// another repository, if that was requested (see
+	// `ComputeRepoComparison()`).
+	Comparison *RepoComparison `json:"comparison,omitempty"`
+
+	// TagOnly holds the sizes of the objects that are reachable from
+	// tags but not from branches, if they were computed (see
+	// `ComputeTagOnlySize()`).
+	TagOnly *TagOnlySize `json:"tag_only,omitempty"`
+
+	// NotesOnly holds the sizes of the objects that are reachable
+	// from notes references but not from other references, if they
+	// were computed (see `ComputeNotesOnlySize()`).
+	NotesOnly *NotesOnlySize `json:"notes_only,omitempty"`
+
+	// RefSharing describes how the blobs are shared among the
+	// included references, if that was requested (see
+	// `ComputeRefSharing()`).
+	RefSharing *RefSharing `json:"ref_sharing,omitempty"`
+
+	// GitlinkCheck lists inconsistencies between gitlinks and
+	// `.gitmodules` at branch tips, if they were requested (see
+	// `CheckGitlinks()`).
+	GitlinkCheck *GitlinkCheck `json:"gitlink_check,omitempty"`
+
+	// CommitDiffs holds statistics computed by diffing each commit
+	// against its first parent, if they were requested (see
+	// `ScanOptions.DiffCommits`).
+	CommitDiffs *CommitDiffs `json:"commit_diffs,omitempty"`
+
+	// PersistenceWeighted is the total size of the blobs weighted by
+	// the number of commits that contain them, if that was requested
+	// (see `ScanOptions.PersistenceWeighted`).
+	PersistenceWeighted *PersistenceWeightedSize `json:"persistence_weighted,omitempty"`
+
+	// CommitterDomains counts the commits by the domain of their
+	// committer's email address, if that was requested (see
+	// `ScanOptions.CommitterDomains`).
+	CommitterDomains *CommitterDomains `json:"committer_domains,omitempty"`
+
+	// WidestTrees lists the trees with the most entries, if they
+	// were requested (see `ScanOptions.TopTrees`).
+	WidestTrees WideTrees `json:"widest_trees,omitempty"`
+
+	// TopBlobs lists the largest or most-referenced blobs, if they
+	// were requested (see `ScanOptions.TopBlobs`).
+	TopBlobs *TopBlobs `json:"top_blobs,omitempty"`
+
+	// OversizedBlobs counts the blobs that are larger than a limit,
+	// if one was given (see `ScanOptions.BlobSizeLimit`).
+	OversizedBlobs *OversizedBlobs `json:"oversized_blobs,omitempty"`
+
+	// BigFiles counts the blobs that are larger than Git's
+	// `core.bigFileThreshold` (or another value given instead; see
+	// `ScanOptions.BigFileThreshold`). Git stores them without delta
+	// compression, so they are good candidates for Git LFS.
+	BigFiles *OversizedBlobs `json:"big_files,omitempty"`
+
+	// ObjectLookups describes the objects in
+	// `ScanOptions.LookupOIDs`, if any.
+	ObjectLookups ObjectLookups `json:"object_lookups,omitempty"`
+
+	// Archive estimates the size of `git archive` output, if that
+	// was requested (see `ComputeArchiveSize()`).
+	Archive *ArchiveSize `json:"archive,omitempty"`
+
+	// PackStats describes the delta chains in the packfiles, if that
+	// was requested (see `ComputePackStats()`).
+	PackStats *PackStats `json:"pack_stats,omitempty"`
+
+	// Growth lists the statistics that changed since a previous run,
+	// if one was compared with (see `ComputeGrowth()`).
+	Growth *Growth `json:"growth,omitempty"`
+
+	// Scope describes which part of the history was scanned, if the
+	// scan was limited (see `ScanOptions.Roots`).
+	Scope *ScanScope `json:"scope,omitempty"`
+
+	// GitLimitations describes the features that were unavailable
+	// because the `git` executable is old, if any (see
+	// `CheckGitLimitations()`).
+	GitLimitations *GitLimitations `json:"git_limitations,omitempty"`
+
+	// Partial is set if the scan was interrupted before it finished,
+	// in which case the statistics only cover the objects that had
+	// been processed by then.
+	Partial bool `json:"partial,omitempty"`
+
+	// LeftOut lists the analyses that were requested in addition to
+	// the main scan (by option; e.g., "--renames") but were left out
+	// because git-sizer was interrupted after the main scan had
+	// finished. `Partial` is set in that case, too, but the other
+	// statistics are complete.
+	LeftOut []string `json:"left_out,omitempty"`
+
+	// BlobSizeHistogram is the distribution of the sizes of unique
+	// blobs, if histograms were requested (see
+	// `ScanOptions.Histograms`). Its buckets are bounded by powers
+	// of ten from 1 KB to 100 MB.
+	BlobSizeHistogram *Histogram `json:"blob_size_histogram,omitempty"`
+
+	// TreeEntriesHistogram is the distribution of the number of
+	// entries in unique trees, with buckets bounded by powers of ten
+	// from 10 to 100,000. PathDepthHistogram is the distribution of
+	// the maximum path depth in the tree of each commit, with buckets
+	// bounded by powers of two from 2 to 64. Both are only collected
+	// if histograms were requested.
+	TreeEntriesHistogram *Histogram `json:"tree_entries_histogram,omitempty"`
+	PathDepthHistogram   *Histogram `json:"path_depth_histogram,omitempty"`
+
+	// Sample describes the sample that the statistics are based on,
+	// if only a sample of commits was scanned. In that case, the
+	// statistics are approximate.
+	Sample *SampleInfo `json:"sample,omitempty"`
+
+	// QuickScan describes the quick scan that the statistics are
+	// based on, if the scan stopped after the newest commits. In that
+	// case, some statistics are estimates or lower bounds.
+	QuickScan *QuickScanInfo `json:"quick_scan,omitempty"`
+
+	// SpilledRuns is the number of times that one of the tables kept
+	// during the scan was spilled to a temporary file because of
+	// `ScanOptions.MemoryLimit`. It only describes how the scan ran,
+	// so it isn't output.
+	SpilledRuns int `json:"-"`
+
+	// metricExamples holds the objects to name for each footnoted
+	// statistic, by symbol, if more than one per statistic was
+	// requested (see `ScanOptions.NamesPerMetric`).
+	metricExamples map[string][]*Path
+
+	// namedObjects, if set, is the "objects" table of the version 2
+	// JSON output (see `SetNamedObjects()`).
+	namedObjects map[string]namedObjectEntry
+
 	// The maximum TreeSize in the analyzed history (where each
 	// attribute is maximized separately).
 
@@ -212,6 +521,86 @@ type HistorySize struct {
 	MaxExpandedSubmoduleCountTree *Path `json:"max_expanded_submodule_count_tree,omitempty"`
 }
 
+// MaxPortableNameLength is the longest tree entry name, in bytes,
+// that most filesystems and archive formats can store. Longer names
+// are counted in `HistorySize.LongTreeEntryNameCount`.
+const MaxPortableNameLength = 255
+
+// MaxCorruptObjectsListed is the maximum number of corrupt objects
+// that are described individually in `CorruptObjects.Objects`.
+const MaxCorruptObjectsListed = 20
+
+// CorruptObject describes an object that couldn't be read or parsed.
+type CorruptObject struct {
+	OID git.OID `json:"oid"`
+
+	// ObjectType is the type of the object, or "" if it is not
+	// known (e.g., because the object is missing).
+	ObjectType git.ObjectType `json:"type,omitempty"`
+
+	// Error describes what was wrong with the object.
+	Error string `json:"error"`
+}
+
+// CorruptObjects summarizes the objects that were skipped because
+// they couldn't be read or parsed.
+type CorruptObjects struct {
+	// Count is the total number of objects that were skipped.
+	Count counts.Count32 `json:"count"`
+
+	// MissingCount, UnknownTypeCount, and MalformedCount break
+	// `Count` down into objects that were missing, objects whose
+	// type was not one of the four known types, and objects that
+	// couldn't be parsed or whose type was not the expected one.
+	MissingCount     counts.Count32 `json:"missing_count"`
+	UnknownTypeCount counts.Count32 `json:"unknown_type_count"`
+	MalformedCount   counts.Count32 `json:"malformed_count"`
+
+	// Objects describes the first `MaxCorruptObjectsListed` objects
+	// that were skipped.
+	Objects []CorruptObject `json:"objects"`
+}
+
+// jsonV2 returns `c` the way that it is represented in the version 2
+// JSON output, with camelCase names.
+func (c *CorruptObjects) jsonV2() interface{} {
+	return struct {
+		Count            counts.Count32  `json:"count"`
+		MissingCount     counts.Count32  `json:"missingCount"`
+		UnknownTypeCount counts.Count32  `json:"unknownTypeCount"`
+		MalformedCount   counts.Count32  `json:"malformedCount"`
+		Objects          []CorruptObject `json:"objects"`
+	}(*c)
+}
+
+// Statistic identifies one of the statistics that git-sizer reports
+// (see `HistorySize.JSON()` for the available symbols), along with
+// its value and level of concern.
+type Statistic struct {
+	Symbol         string  `json:"symbol"`
+	Description    string  `json:"description"`
+	Value          uint64  `json:"value"`
+	Unit           string  `json:"unit"`
+	LevelOfConcern float64 `json:"level_of_concern"`
+
+	// item is used for formatting the statistic as text.
+	item *item
+}
+
+// BrokenReference is a reference that points at an object that
+// doesn't exist.
+type BrokenReference struct {
+	Refname string  `json:"refname"`
+	OID     git.OID `json:"oid"`
+}
+
+// BrokenReferences summarizes the references that were skipped
+// because they point at objects that don't exist.
+type BrokenReferences struct {
+	Count      counts.Count32    `json:"count"`
+	References []BrokenReference `json:"references"`
+}
+
 // Convenience function: forget `*path` if it is non-nil and overwrite
 // it with a `*Path` for the object corresponding to `(oid,
 // objectType)`. This function can be used if a new largest item was
@@ -226,16 +615,56 @@ func setPath(
 	*path = pr.RequestPath(oid, objectType)
 }
 
+func (s *HistorySize) recordPacks(packs []git.Packfile) {
+	for _, pack := range packs {
+		size := counts.NewCount64(uint64(pack.Size))
+		s.PackCount.Increment(1)
+		s.PackSize.Increment(size)
+		s.MaxPackSize.AdjustMaxIfNecessary(size)
+		if pack.Cruft {
+			s.CruftPackCount.Increment(1)
+			s.CruftPackSize.Increment(size)
+		}
+	}
+}
+
 func (s *HistorySize) recordBlob(g *Graph, oid git.OID, blobSize BlobSize) {
 	s.UniqueBlobCount.Increment(1)
 	s.UniqueBlobSize.Increment(counts.Count64(blobSize.Size))
 	if s.MaxBlobSize.AdjustMaxIfNecessary(blobSize.Size) {
 		setPath(g.pathResolver, &s.MaxBlobSizeBlob, oid, "blob")
 	}
+	g.metricExamples.consider(g.pathResolver, "maxBlobSize", oid, "blob", uint64(blobSize.Size))
+	if s.BlobSizeHistogram != nil {
+		s.BlobSizeHistogram.add(uint64(blobSize.Size), counts.Count64(blobSize.Size))
+	}
+	if s.OversizedBlobs != nil {
+		s.OversizedBlobs.recordBlob(g, oid, blobSize.Size)
+	}
+	if s.BigFiles != nil {
+		s.BigFiles.recordBlob(g, oid, blobSize.Size)
+	}
+}
+
+// recordBlobReference records that the blob `oid`, whose size is
+// `size`, is now referred to by `refCount` tree entries.
+func (s *HistorySize) recordBlobReference(
+	g *Graph, oid git.OID, size counts.Count32, refCount counts.Count32,
+) {
+	weight := counts.Count64(uint64(size) * uint64(refCount))
+	if s.MaxBlobRefWeight.AdjustMaxIfNecessary(weight) {
+		if s.MaxBlobRefWeightBlob == nil || s.MaxBlobRefWeightBlob.OID != oid {
+			setPath(g.pathResolver, &s.MaxBlobRefWeightBlob, oid, "blob")
+		}
+		s.MaxBlobRefWeightSize = size
+		s.MaxBlobRefWeightRefCount = refCount
+	}
+	g.metricExamples.consider(g.pathResolver, "maxBlobRefWeight", oid, "blob", uint64(weight))
 }
 
 func (s *HistorySize) recordTree(
 	g *Graph, oid git.OID, treeSize TreeSize, size counts.Count32, treeEntries counts.Count32,
+	names treeNameStats,
 ) {
 	s.UniqueTreeCount.Increment(1)
 	s.UniqueTreeSize.Increment(counts.Count64(size))
@@ -243,7 +672,25 @@ func (s *HistorySize) recordTree(
 	if s.MaxTreeEntries.AdjustMaxIfNecessary(treeEntries) {
 		setPath(g.pathResolver, &s.MaxTreeEntriesTree, oid, "tree")
 	}
+	if s.MaxTreeEntryNameLength.AdjustMaxIfNecessary(names.maxLength) {
+		setPath(g.pathResolver, &s.MaxTreeEntryNameLengthTree, oid, "tree")
+	}
+	consider := func(symbol string, value uint64) {
+		g.metricExamples.consider(g.pathResolver, symbol, oid, "tree", value)
+	}
+	consider("maxTreeEntries", uint64(treeEntries))
+	consider("maxTreeEntryNameLength", uint64(names.maxLength))
+	s.LongTreeEntryNameCount.Increment(counts.Count64(names.longCount))
+	if s.TreeEntriesHistogram != nil {
+		s.TreeEntriesHistogram.add(uint64(treeEntries), counts.Count64(size))
+	}
+
+	s.recordCheckout(g, oid, treeSize)
+}
 
+// recordCheckout records the statistics about the checkout of the
+// tree `oid`.
+func (s *HistorySize) recordCheckout(g *Graph, oid git.OID, treeSize TreeSize) {
 	if s.MaxPathDepth.AdjustMaxIfNecessary(treeSize.MaxPathDepth) {
 		setPath(g.pathResolver, &s.MaxPathDepthTree, oid, "tree")
 	}
@@ -265,6 +712,16 @@ func (s *HistorySize) recordTree(
 	if s.MaxExpandedSubmoduleCount.AdjustMaxIfNecessary(treeSize.ExpandedSubmoduleCount) {
 		setPath(g.pathResolver, &s.MaxExpandedSubmoduleCountTree, oid, "tree")
 	}
+	consider := func(symbol string, value uint64) {
+		g.metricExamples.consider(g.pathResolver, symbol, oid, "tree", value)
+	}
+	consider("maxCheckoutPathDepth", uint64(treeSize.MaxPathDepth))
+	consider("maxCheckoutPathLength", uint64(treeSize.MaxPathLength))
+	consider("maxCheckoutTreeCount", uint64(treeSize.ExpandedTreeCount))
+	consider("maxCheckoutBlobCount", uint64(treeSize.ExpandedBlobCount))
+	consider("maxCheckoutBlobSize", uint64(treeSize.ExpandedBlobSize))
+	consider("maxCheckoutLinkCount", uint64(treeSize.ExpandedLinkCount))
+	consider("maxCheckoutSubmoduleCount", uint64(treeSize.ExpandedSubmoduleCount))
 }
 
 func (s *HistorySize) recordCommit(
@@ -277,22 +734,142 @@ func (s *HistorySize) recordCommit(
 		setPath(g.pathResolver, &s.MaxCommitSizeCommit, oid, "commit")
 	}
 	s.MaxHistoryDepth.AdjustMaxIfPossible(commitSize.MaxAncestorDepth)
+	// On a linear history, no commit is an example of a merge depth
+	// of zero, so don't footnote one:
+	if s.MaxMergeDepth.AdjustMaxIfPossible(commitSize.MaxMergeDepth) &&
+		commitSize.MaxMergeDepth > 0 {
+		setPath(g.pathResolver, &s.MaxMergeDepthCommit, oid, "commit")
+	}
 	if s.MaxParentCount.AdjustMaxIfPossible(parentCount) {
 		setPath(g.pathResolver, &s.MaxParentCountCommit, oid, "commit")
 	}
+	g.metricExamples.consider(g.pathResolver, "maxCommitSize", oid, "commit", uint64(size))
+	g.metricExamples.consider(g.pathResolver, "maxCommitParentCount", oid, "commit", uint64(parentCount))
+	if parentCount > 1 {
+		s.MergeCommitCount.Increment(1)
+	}
+}
+
+// recordEmptyCommit records that the commit `oid` doesn't contain or
+// change any files.
+func (s *HistorySize) recordEmptyCommit(g *Graph, oid git.OID) {
+	s.EmptyCommitCount.Increment(1)
+	if s.EmptyCommitCount == 1 {
+		setPath(g.pathResolver, &s.EmptyCommit, oid, "commit")
+	}
+}
+
+// earliestPlausibleTime is the earliest author or committer date that
+// isn't considered suspicious.
+var earliestPlausibleTime = time.Date(1980, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// recordCommitMetadata records whether `commit` is signed and any
+// unusual metadata that it has. Dates after `latest` are considered
+// implausible.
+func (s *HistorySize) recordCommitMetadata(
+	g *Graph, oid git.OID, commit *git.Commit, latest time.Time,
+) {
+	record := func(count *counts.Count32, example **Path) {
+		count.Increment(1)
+		if *count == 1 {
+			setPath(g.pathResolver, example, oid, "commit")
+		}
+	}
+
+	if commit.Signed {
+		s.SignedCommitCount.Increment(1)
+	}
+
+	if commit.Encoding != "" &&
+		!strings.EqualFold(commit.Encoding, "utf-8") &&
+		!strings.EqualFold(commit.Encoding, "utf8") {
+		record(&s.NonUTF8CommitCount, &s.NonUTF8Commit)
+	}
+
+	if commit.Author == nil || commit.Committer == nil {
+		record(&s.MalformedIdentityCommitCount, &s.MalformedIdentityCommit)
+	}
+
+	s.CommitterDomains.recordCommitter(commit.Committer)
+	s.recordCommitDate(g, oid, commit.Committer, latest)
+
+	for _, sig := range []*git.Signature{commit.Author, commit.Committer} {
+		if sig != nil && (sig.When.Before(earliestPlausibleTime) || sig.When.After(latest)) {
+			record(&s.ImplausibleDateCommitCount, &s.ImplausibleDateCommit)
+			break
+		}
+	}
 }
 
 func (s *HistorySize) recordTag(g *Graph, oid git.OID, tagSize TagSize, size counts.Count32) {
 	s.UniqueTagCount.Increment(1)
+	s.UniqueTagSize.Increment(counts.Count64(size))
 	if s.MaxTagDepth.AdjustMaxIfNecessary(tagSize.TagDepth) {
 		setPath(g.pathResolver, &s.MaxTagDepthTag, oid, "tag")
 	}
+	g.metricExamples.consider(g.pathResolver, "maxTagDepth", oid, "tag", uint64(tagSize.TagDepth))
+}
+
+// recordTagMessage records the size of the message of the tag `oid`.
+func (s *HistorySize) recordTagMessage(g *Graph, oid git.OID, messageSize counts.Count32) {
+	if s.MaxTagMessageSize.AdjustMaxIfNecessary(messageSize) {
+		setPath(g.pathResolver, &s.MaxTagMessageTag, oid, "tag")
+	}
+	g.metricExamples.consider(g.pathResolver, "maxTagMessageSize", oid, "tag", uint64(messageSize))
 }
 
 func (s *HistorySize) recordReference(g *Graph, ref git.Reference) {
 	s.ReferenceCount.Increment(1)
 }
 
+// recordCommitRefCount records that `refCount` references resolve
+// to the commit `oid`.
+func (s *HistorySize) recordCommitRefCount(g *Graph, oid git.OID, refCount counts.Count32) {
+	if s.MaxRefsPerCommit.AdjustMaxIfNecessary(refCount) {
+		setPath(g.pathResolver, &s.MaxRefsPerCommitCommit, oid, "commit")
+	}
+	g.metricExamples.consider(g.pathResolver, "maxRefsPerCommit", oid, "commit", uint64(refCount))
+}
+
+func (s *HistorySize) recordCorruptObject(oid git.OID, objectType git.ObjectType, err error) {
+	if s.Errors == nil {
+		s.Errors = &CorruptObjects{}
+	}
+	s.Errors.Count.Increment(1)
+	switch objectType {
+	case "":
+		s.Errors.MissingCount.Increment(1)
+	case "blob", "tree", "commit", "tag":
+		s.Errors.MalformedCount.Increment(1)
+	default:
+		s.Errors.UnknownTypeCount.Increment(1)
+	}
+	if len(s.Errors.Objects) < MaxCorruptObjectsListed {
+		s.Errors.Objects = append(
+			s.Errors.Objects,
+			CorruptObject{
+				OID:        oid,
+				ObjectType: objectType,
+				Error:      err.Error(),
+			},
+		)
+	}
+}
+
+func (s *HistorySize) recordBrokenReference(ref git.Reference) {
+	if s.BrokenReferences == nil {
+		s.BrokenReferences = &BrokenReferences{}
+	}
+	s.BrokenReferences.Count.Increment(1)
+	s.BrokenReferences.References = append(
+		s.BrokenReferences.References,
+		BrokenReference{
+			Refname: ref.Refname,
+			OID:     ref.OID,
+		},
+	)
+}
+
 func (s *HistorySize) recordReferenceGroup(g *Graph, group RefGroupSymbol) {
 	c, ok := s.ReferenceGroups[group]
 	if ok {
@@ -0,0 +1,171 @@
+package sizes
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/github/git-sizer/counts"
+	"github.com/github/git-sizer/git"
+)
+
+// sqlBatchSize is the number of rows that are inserted in each
+// transaction by `sqlExport`.
+const sqlBatchSize = 10000
+
+// sqlSchema creates the tables that `sqlExport` fills, replacing any
+// tables with the same names. The `tree_entries` table is only
+// created if tree entries are requested (see
+// `sqlTreeEntriesSchema`).
+const sqlSchema = `PRAGMA journal_mode = OFF;
+PRAGMA synchronous = OFF;
+DROP TABLE IF EXISTS objects;
+DROP TABLE IF EXISTS commits;
+DROP TABLE IF EXISTS tree_entries;
+DROP TABLE IF EXISTS refs;
+CREATE TABLE objects (oid TEXT NOT NULL, type TEXT NOT NULL, size INTEGER NOT NULL);
+CREATE TABLE commits (oid TEXT NOT NULL, author_date INTEGER, parent_count INTEGER NOT NULL, tree TEXT NOT NULL);
+CREATE TABLE refs (name TEXT NOT NULL, oid TEXT NOT NULL);
+`
+
+// sqlTreeEntriesSchema creates the (optional) `tree_entries` table.
+const sqlTreeEntriesSchema = `CREATE TABLE tree_entries (tree_oid TEXT NOT NULL, name TEXT NOT NULL, mode INTEGER NOT NULL, entry_oid TEXT NOT NULL);
+`
+
+// sqlIndexes are created after all of the rows have been inserted,
+// which is faster than maintaining them along the way.
+const sqlIndexes = `CREATE UNIQUE INDEX objects_oid ON objects (oid);
+CREATE INDEX objects_type_size ON objects (type, size);
+CREATE UNIQUE INDEX commits_oid ON commits (oid);
+CREATE INDEX commits_tree ON commits (tree);
+CREATE INDEX refs_name ON refs (name);
+CREATE INDEX refs_oid ON refs (oid);
+`
+
+// sqlTreeEntriesIndexes are the indexes for the `tree_entries` table.
+const sqlTreeEntriesIndexes = `CREATE INDEX tree_entries_tree_oid ON tree_entries (tree_oid);
+CREATE INDEX tree_entries_entry_oid ON tree_entries (entry_oid);
+`
+
+// sqlExport writes SQL statements that fill an SQLite database with
+// an inventory of the objects and references that are scanned (see
+// `ScanOptions.SQL`). The rows are inserted in transactions of
+// `sqlBatchSize` rows each. Write errors are remembered and reported
+// by `finish()`.
+type sqlExport struct {
+	out         *bufio.Writer
+	treeEntries bool
+
+	// rows is the number of rows inserted in the current
+	// transaction.
+	rows int
+	err  error
+}
+
+func newSQLExport(w io.Writer, treeEntries bool) *sqlExport {
+	e := &sqlExport{
+		out:         bufio.NewWriter(w),
+		treeEntries: treeEntries,
+	}
+	e.write(sqlSchema)
+	if treeEntries {
+		e.write(sqlTreeEntriesSchema)
+	}
+	e.write("BEGIN;\n")
+	return e
+}
+
+func (e *sqlExport) write(s string) {
+	if e.err != nil {
+		return
+	}
+	_, e.err = e.out.WriteString(s)
+}
+
+// insert inserts a row containing `values` (each of which must be a
+// string, an integer, or nil) into `table`.
+func (e *sqlExport) insert(table string, values ...interface{}) {
+	var sb strings.Builder
+	sb.WriteString("INSERT INTO ")
+	sb.WriteString(table)
+	sb.WriteString(" VALUES (")
+	for i, v := range values {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		switch v := v.(type) {
+		case nil:
+			sb.WriteString("NULL")
+		case string:
+			sb.WriteString(sqlQuote(v))
+		case int:
+			sb.WriteString(strconv.Itoa(v))
+		case int64:
+			sb.WriteString(strconv.FormatInt(v, 10))
+		case uint64:
+			sb.WriteString(strconv.FormatUint(v, 10))
+		default:
+			panic(fmt.Sprintf("unexpected SQL value %#v", v))
+		}
+	}
+	sb.WriteString(");\n")
+	e.write(sb.String())
+
+	e.rows++
+	if e.rows == sqlBatchSize {
+		e.write("COMMIT;\nBEGIN;\n")
+		e.rows = 0
+	}
+}
+
+// sqlQuote returns `s` as an SQL string literal.
+func sqlQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+func (e *sqlExport) addObject(oid git.OID, objectType git.ObjectType, size counts.Count32) {
+	e.insert("objects", oid.String(), string(objectType), uint64(size))
+}
+
+func (e *sqlExport) addCommit(oid git.OID, commit *git.Commit) {
+	var authorDate interface{}
+	if commit.Author != nil {
+		authorDate = commit.Author.When.Unix()
+	}
+	e.insert("commits", oid.String(), authorDate, len(commit.Parents), commit.Tree.String())
+}
+
+func (e *sqlExport) addTree(oid git.OID, tree *git.Tree) {
+	if !e.treeEntries {
+		return
+	}
+	iter := tree.Iter()
+	for {
+		entry, ok, err := iter.NextEntry()
+		if err != nil || !ok {
+			// Malformed trees are reported by the scan itself.
+			return
+		}
+		e.insert("tree_entries", oid.String(), entry.Name, uint64(entry.Filemode), entry.OID.String())
+	}
+}
+
+func (e *sqlExport) addReference(ref git.Reference) {
+	e.insert("refs", ref.Refname, ref.OID.String())
+}
+
+// finish commits the last transaction, creates the indexes, and
+// flushes the output.
+func (e *sqlExport) finish() error {
+	e.write("COMMIT;\n")
+	e.write(sqlIndexes)
+	if e.treeEntries {
+		e.write(sqlTreeEntriesIndexes)
+	}
+	if e.err == nil {
+		e.err = e.out.Flush()
+	}
+	return e.err
+}
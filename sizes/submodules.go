@@ -0,0 +1,269 @@
+package sizes
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/github/git-sizer/counts"
+	"github.com/github/git-sizer/git"
+)
+
+// SubmoduleSize describes a submodule of a scanned repository.
+type SubmoduleSize struct {
+	// Commit is the commit that the submodule's gitlink refers to.
+	Commit git.OID `json:"commit"`
+
+	// Skipped explains why the submodule wasn't scanned (e.g.,
+	// because it hasn't been initialized). It is empty if the
+	// submodule was scanned.
+	Skipped string `json:"skipped,omitempty"`
+
+	// Size holds the results of scanning the submodule's
+	// repository, including any submodules of its own.
+	Size *HistorySize `json:"size,omitempty"`
+}
+
+// SubmoduleSizes maps the paths of submodules to their sizes.
+type SubmoduleSizes map[string]*SubmoduleSize
+
+// CombinedSize totals the most important statistics across a
+// repository and all of the submodules that were scanned along with
+// it, recursively.
+type CombinedSize struct {
+	RepositoryCount   counts.Count32 `json:"repository_count"`
+	UniqueCommitCount counts.Count32 `json:"unique_commit_count"`
+	UniqueCommitSize  counts.Count64 `json:"unique_commit_size"`
+	UniqueTreeCount   counts.Count32 `json:"unique_tree_count"`
+	UniqueTreeSize    counts.Count64 `json:"unique_tree_size"`
+	UniqueBlobCount   counts.Count32 `json:"unique_blob_count"`
+	UniqueBlobSize    counts.Count64 `json:"unique_blob_size"`
+	MaxBlobSize       counts.Count32 `json:"max_blob_size"`
+}
+
+// ScanSubmodules looks for gitlinks in the trees of the commits at
+// the tips of the references in `repo` that `rg` selects for
+// walking, locates the repositories of the corresponding submodules,
+// and scans each of them using `scan`. The results are recorded in
+// `s.Submodules` and `s.Combined`. Submodules whose repositories
+// can't be opened (e.g., because they haven't been initialized) are
+// recorded as skipped.
+func (s *HistorySize) ScanSubmodules(
+	ctx context.Context, repo *git.Repository, rg RefGrouper,
+	scan func(repo *git.Repository) (HistorySize, error),
+) error {
+	submodules := make(SubmoduleSizes)
+	names := make(map[string]string)
+
+	refs, err := walkedReferences(ctx, repo, rg)
+	if err != nil {
+		return err
+	}
+	var tips []git.OID
+	seen := make(map[git.OID]bool)
+	for _, ref := range refs {
+		if ref.ObjectType != "commit" {
+			continue
+		}
+		if !seen[ref.OID] {
+			seen[ref.OID] = true
+			tips = append(tips, ref.OID)
+		}
+	}
+
+	for _, tip := range tips {
+		tipNames, err := repo.SubmoduleNames(tip.String())
+		if err != nil {
+			return err
+		}
+		if err := repo.ForEachGitlink(
+			ctx, tip.String(),
+			func(path string, oid git.OID) error {
+				if _, ok := submodules[path]; ok {
+					// The first tip that we saw wins.
+					return nil
+				}
+				submodules[path] = &SubmoduleSize{Commit: oid}
+				if name, ok := tipNames[path]; ok {
+					names[path] = name
+				} else {
+					names[path] = path
+				}
+				return nil
+			},
+		); err != nil {
+			return fmt.Errorf("listing submodules in %s: %w", tip, err)
+		}
+	}
+
+	for _, path := range submodules.paths() {
+		sm := submodules[path]
+		gitDir, ok := repo.SubmoduleGitDir(names[path], path)
+		if !ok {
+			sm.Skipped = "not initialized"
+			continue
+		}
+		smRepo, err := git.NewRepository(gitDir)
+		if err != nil {
+			sm.Skipped = err.Error()
+			continue
+		}
+		h, err := scan(smRepo)
+		smRepo.Close()
+		if err != nil {
+			return fmt.Errorf("scanning submodule '%s': %w", git.DisplayString(path), err)
+		}
+		sm.Size = &h
+	}
+
+	s.Submodules = submodules
+	s.Combined = s.combinedSize()
+	return nil
+}
+
+// paths returns the paths of the submodules in `sms`, sorted.
+func (sms SubmoduleSizes) paths() []string {
+	paths := make([]string, 0, len(sms))
+	for path := range sms {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// combinedSize totals the statistics of `s` and all of the
+// submodules that were scanned along with it.
+func (s *HistorySize) combinedSize() *CombinedSize {
+	cs := CombinedSize{
+		RepositoryCount:   1,
+		UniqueCommitCount: s.UniqueCommitCount,
+		UniqueCommitSize:  s.UniqueCommitSize,
+		UniqueTreeCount:   s.UniqueTreeCount,
+		UniqueTreeSize:    s.UniqueTreeSize,
+		UniqueBlobCount:   s.UniqueBlobCount,
+		UniqueBlobSize:    s.UniqueBlobSize,
+		MaxBlobSize:       s.MaxBlobSize,
+	}
+	for _, sm := range s.Submodules {
+		if sm.Size == nil {
+			continue
+		}
+		smcs := sm.Size.combinedSize()
+		cs.RepositoryCount.Increment(smcs.RepositoryCount)
+		cs.UniqueCommitCount.Increment(smcs.UniqueCommitCount)
+		cs.UniqueCommitSize.Increment(smcs.UniqueCommitSize)
+		cs.UniqueTreeCount.Increment(smcs.UniqueTreeCount)
+		cs.UniqueTreeSize.Increment(smcs.UniqueTreeSize)
+		cs.UniqueBlobCount.Increment(smcs.UniqueBlobCount)
+		cs.UniqueBlobSize.Increment(smcs.UniqueBlobSize)
+		cs.MaxBlobSize.AdjustMaxIfNecessary(smcs.MaxBlobSize)
+	}
+	return &cs
+}
+
+// submoduleRow is one line of the submodule summary table.
+type submoduleRow struct {
+	path string
+	sm   *SubmoduleSize
+}
+
+// rows flattens `sms`, including nested submodules, into table rows.
+// The paths of nested submodules are prefixed with the paths of the
+// submodules that contain them.
+func (sms SubmoduleSizes) rows(prefix string) []submoduleRow {
+	var rows []submoduleRow
+	for _, path := range sms.paths() {
+		sm := sms[path]
+		rows = append(rows, submoduleRow{prefix + path, sm})
+		if sm.Size != nil {
+			rows = append(rows, sm.Size.Submodules.rows(prefix+path+"/")...)
+		}
+	}
+	return rows
+}
+
+// jsonV2 returns `cs` the way that it is represented in the version 2
+// JSON output, with camelCase names.
+func (cs *CombinedSize) jsonV2() interface{} {
+	return struct {
+		RepositoryCount   counts.Count32 `json:"repositoryCount"`
+		UniqueCommitCount counts.Count32 `json:"uniqueCommitCount"`
+		UniqueCommitSize  counts.Count64 `json:"uniqueCommitSize"`
+		UniqueTreeCount   counts.Count32 `json:"uniqueTreeCount"`
+		UniqueTreeSize    counts.Count64 `json:"uniqueTreeSize"`
+		UniqueBlobCount   counts.Count32 `json:"uniqueBlobCount"`
+		UniqueBlobSize    counts.Count64 `json:"uniqueBlobSize"`
+		MaxBlobSize       counts.Count32 `json:"maxBlobSize"`
+	}(*cs)
+}
+
+// String returns a human-readable summary of each submodule.
+func (sms SubmoduleSizes) String() string {
+	if sms == nil {
+		return ""
+	}
+
+	buf := &bytes.Buffer{}
+	if len(sms) == 0 {
+		fmt.Fprintf(buf, "\nNo submodules were found\n")
+		return buf.String()
+	}
+
+	rows := sms.rows("")
+	width := len("Path")
+	for _, row := range rows {
+		if w := len(git.DisplayString(row.path)); w > width {
+			width = w
+		}
+	}
+
+	size := func(n counts.Humanable) string {
+		numeral, unit := counts.Binary.Format(n, "B")
+		return strings.TrimSpace(numeral + " " + unit)
+	}
+
+	fmt.Fprintf(buf, "\nSubmodules:\n\n")
+	fmt.Fprintf(
+		buf, "    %-*s  %10s  %10s  %10s  %12s\n",
+		width, "Path", "Commits", "Blobs", "Blob size", "Largest blob",
+	)
+	for _, row := range rows {
+		path := git.DisplayString(row.path)
+		if row.sm.Size == nil {
+			fmt.Fprintf(buf, "    %-*s  (skipped: %s)\n", width, path, row.sm.Skipped)
+			continue
+		}
+		h := row.sm.Size
+		fmt.Fprintf(
+			buf, "    %-*s  %10d  %10d  %10s  %12s\n",
+			width, path, h.UniqueCommitCount, h.UniqueBlobCount,
+			size(h.UniqueBlobSize), size(h.MaxBlobSize),
+		)
+	}
+	return buf.String()
+}
+
+// String returns a human-readable summary of the combined totals.
+func (cs *CombinedSize) String() string {
+	if cs == nil {
+		return ""
+	}
+
+	size := func(n counts.Humanable) string {
+		numeral, unit := counts.Binary.Format(n, "B")
+		return strings.TrimSpace(numeral + " " + unit)
+	}
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(
+		buf, "\nCombined total (%d repositories, including submodules):\n\n",
+		cs.RepositoryCount,
+	)
+	fmt.Fprintf(buf, "    Commits       %10d  %10s\n", cs.UniqueCommitCount, size(cs.UniqueCommitSize))
+	fmt.Fprintf(buf, "    Trees         %10d  %10s\n", cs.UniqueTreeCount, size(cs.UniqueTreeSize))
+	fmt.Fprintf(buf, "    Blobs         %10d  %10s\n", cs.UniqueBlobCount, size(cs.UniqueBlobSize))
+	fmt.Fprintf(buf, "    Largest blob  %10s  %10s\n", "", size(cs.MaxBlobSize))
+	return buf.String()
+}
@@ -0,0 +1,156 @@
+package sizes
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/github/git-sizer/counts"
+	"github.com/github/git-sizer/git"
+)
+
+// TagOnlySize describes the objects that are reachable from tags
+// (`refs/tags/*`) but not from any branch (`refs/heads/*`). This is
+// the content that would be lost if the tags were deleted, and that
+// is retained only because of them if the branches are pruned.
+type TagOnlySize struct {
+	// TagCount and BranchCount are the numbers of tags and branches
+	// that were included.
+	TagCount    counts.Count32 `json:"tag_count"`
+	BranchCount counts.Count32 `json:"branch_count"`
+
+	// CommitCount and CommitSize describe the commits that are only
+	// reachable from tags, and BlobCount and BlobSize the blobs.
+	CommitCount counts.Count64 `json:"commit_count"`
+	CommitSize  counts.Count64 `json:"commit_size"`
+	BlobCount   counts.Count64 `json:"blob_count"`
+	BlobSize    counts.Count64 `json:"blob_size"`
+
+	// ObjectCount and ObjectSize describe all of the objects
+	// (including trees and annotated tags) that are only reachable
+	// from tags.
+	ObjectCount counts.Count64 `json:"object_count"`
+	ObjectSize  counts.Count64 `json:"object_size"`
+
+	// AnnotatedTagCount is the number of included tags that are
+	// annotated. ReleaseObjectCount and ReleaseObjectSize describe
+	// the objects that are reachable from the objects that those
+	// tags point at (not counting the tag objects themselves) but
+	// not from any branch; i.e., the space occupied by archived
+	// releases. They are a subset of the objects above.
+	AnnotatedTagCount  counts.Count32 `json:"annotated_tag_count"`
+	ReleaseObjectCount counts.Count64 `json:"release_object_count"`
+	ReleaseObjectSize  counts.Count64 `json:"release_object_size"`
+}
+
+// ComputeTagOnlySize computes the size of the objects that are
+// reachable from tags but not from branches (see `TagOnlySize`). Only
+// references that `rg` selects for walking are considered.
+func ComputeTagOnlySize(
+	ctx context.Context, repo *git.Repository, rg RefGrouper,
+) (*TagOnlySize, error) {
+	refs, err := walkedReferences(ctx, repo, rg)
+	if err != nil {
+		return nil, err
+	}
+
+	var tags, annotatedTags, branches []git.OID
+	for _, ref := range refs {
+		switch {
+		case strings.HasPrefix(ref.Refname, "refs/tags/"):
+			tags = append(tags, ref.OID)
+			if ref.ObjectType == "tag" {
+				annotatedTags = append(annotatedTags, ref.OID)
+			}
+		case strings.HasPrefix(ref.Refname, "refs/heads/"):
+			branches = append(branches, ref.OID)
+		}
+	}
+
+	byType, err := repo.ReachableObjectsSizeByType(ctx, tags, branches)
+	if err != nil {
+		return nil, fmt.Errorf("measuring tag-only objects: %w", err)
+	}
+
+	tos := TagOnlySize{
+		TagCount:    counts.NewCount32(uint64(len(tags))),
+		BranchCount: counts.NewCount32(uint64(len(branches))),
+		CommitCount: counts.NewCount64(byType["commit"].Count),
+		CommitSize:  counts.NewCount64(byType["commit"].Size),
+		BlobCount:   counts.NewCount64(byType["blob"].Count),
+		BlobSize:    counts.NewCount64(byType["blob"].Size),
+	}
+	for _, size := range byType {
+		tos.ObjectCount.Increment(counts.NewCount64(size.Count))
+		tos.ObjectSize.Increment(counts.NewCount64(size.Size))
+	}
+
+	if len(annotatedTags) != 0 {
+		headers, err := repo.PeeledObjectHeaders(ctx, annotatedTags)
+		if err != nil {
+			return nil, err
+		}
+		targets := make([]git.OID, 0, len(headers))
+		for _, header := range headers {
+			if header.ObjectType != "missing" {
+				targets = append(targets, header.OID)
+			}
+		}
+		releases, err := repo.ReachableObjectsSize(ctx, targets, branches)
+		if err != nil {
+			return nil, fmt.Errorf("measuring archived releases: %w", err)
+		}
+		tos.AnnotatedTagCount = counts.NewCount32(uint64(len(annotatedTags)))
+		tos.ReleaseObjectCount = counts.NewCount64(releases.Count)
+		tos.ReleaseObjectSize = counts.NewCount64(releases.Size)
+	}
+
+	return &tos, nil
+}
+
+// jsonV2 returns `tos` the way that it is represented in the version 2
+// JSON output, with camelCase names.
+func (tos *TagOnlySize) jsonV2() interface{} {
+	return struct {
+		TagCount           counts.Count32 `json:"tagCount"`
+		BranchCount        counts.Count32 `json:"branchCount"`
+		CommitCount        counts.Count64 `json:"commitCount"`
+		CommitSize         counts.Count64 `json:"commitSize"`
+		BlobCount          counts.Count64 `json:"blobCount"`
+		BlobSize           counts.Count64 `json:"blobSize"`
+		ObjectCount        counts.Count64 `json:"objectCount"`
+		ObjectSize         counts.Count64 `json:"objectSize"`
+		AnnotatedTagCount  counts.Count32 `json:"annotatedTagCount"`
+		ReleaseObjectCount counts.Count64 `json:"releaseObjectCount"`
+		ReleaseObjectSize  counts.Count64 `json:"releaseObjectSize"`
+	}(*tos)
+}
+
+// String returns a human-readable summary of the tag-only objects.
+func (tos *TagOnlySize) String() string {
+	if tos == nil {
+		return ""
+	}
+
+	size := func(n counts.Humanable) string {
+		numeral, unit := counts.Binary.Format(n, "B")
+		return strings.TrimSpace(numeral + " " + unit)
+	}
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(
+		buf, "\nObjects reachable from tags (%d) but not from any branch (%d):\n\n",
+		tos.TagCount, tos.BranchCount,
+	)
+	fmt.Fprintf(buf, "    %-13s  %10s  %10s\n", "Type", "Count", "Size")
+	fmt.Fprintf(buf, "    %-13s  %10d  %10s\n", "Commits", tos.CommitCount, size(tos.CommitSize))
+	fmt.Fprintf(buf, "    %-13s  %10d  %10s\n", "Blobs", tos.BlobCount, size(tos.BlobSize))
+	fmt.Fprintf(buf, "    %-13s  %10d  %10s\n", "All objects", tos.ObjectCount, size(tos.ObjectSize))
+	fmt.Fprintf(buf, "    %-13s  %10d  %10s\n", "Releases", tos.ReleaseObjectCount, size(tos.ReleaseObjectSize))
+	fmt.Fprintf(
+		buf, "\n    'Releases' are the objects reachable from what the %d annotated tag(s) point at.\n",
+		tos.AnnotatedTagCount,
+	)
+	return buf.String()
+}
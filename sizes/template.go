@@ -0,0 +1,211 @@
+package sizes
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/github/git-sizer/counts"
+	"github.com/github/git-sizer/git"
+)
+
+// TemplateStatistic is how a statistic is exposed to an output
+// template (see `ParseOutputTemplate()`).
+type TemplateStatistic struct {
+	Symbol      string
+	Label       string
+	Description string
+
+	// Value is the raw value, and HumanValue the value as it is shown
+	// in the table (e.g., "1.50 MiB").
+	Value      uint64
+	Unit       string
+	HumanValue string
+
+	// ReferenceValue is the value that corresponds to one star, or 0
+	// for informational statistics. LevelOfConcern is the ratio of
+	// `Value` to it, and Stars is how it is shown in the table.
+	ReferenceValue float64
+	LevelOfConcern float64
+	Stars          string
+
+	// Reported tells whether the statistic meets the threshold, and
+	// would therefore be shown in the table.
+	Reported bool
+
+	// ObjectName and ObjectDescription identify the object that the
+	// statistic's footnote refers to, if any.
+	ObjectName        string
+	ObjectDescription string
+}
+
+// TemplateData is the data that an output template is executed with.
+type TemplateData struct {
+	// Stats maps the symbol of each statistic (the same ones as in
+	// the version 2 JSON output) to the statistic.
+	Stats map[string]*TemplateStatistic
+
+	// Statistics lists the same statistics, ordered by symbol.
+	Statistics []*TemplateStatistic
+
+	// Worst is the statistic with the highest level of concern, or
+	// nil if there are none.
+	Worst *TemplateStatistic
+
+	// Threshold is the level of concern that statistics have to
+	// reach to be reported.
+	Threshold float64
+
+	// History is the complete `HistorySize`, for accessing the
+	// optional sections (e.g., `.History.Remotes`) by their Go field
+	// names.
+	History *HistorySize
+}
+
+// templateFuncs are the functions, in addition to the standard ones,
+// that are available in output templates:
+//
+//   - `bytes N`: N formatted with binary prefixes, like "1.50 MiB".
+//   - `metric N`: N formatted with metric prefixes, like "1.50 k".
+//   - `stars L`: the stars (or exclamation points) that show the
+//     level of concern L in the table.
+//   - `json V`: V formatted as JSON.
+//
+// N can be any integer, including the counts in `HistorySize`.
+var templateFuncs = template.FuncMap{
+	"bytes": func(n interface{}) (string, error) {
+		return formatTemplateNumber(n, counts.Binary, "B")
+	},
+	"metric": func(n interface{}) (string, error) {
+		return formatTemplateNumber(n, counts.Metric, "")
+	},
+	"stars": func(level float64) string {
+		switch {
+		case level < 1:
+			return ""
+		case level > 30:
+			return "!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!"
+		default:
+			return stars[:int(level)]
+		}
+	},
+	"json": func(v interface{}) (string, error) {
+		j, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		return string(j), nil
+	},
+}
+
+// formatTemplateNumber formats `n` using `humaner` and `unit`.
+func formatTemplateNumber(n interface{}, humaner counts.Humaner, unit string) (string, error) {
+	var value counts.Humanable
+	switch n := n.(type) {
+	case counts.Humanable:
+		value = n
+	case uint64:
+		value = counts.NewCount64(n)
+	case uint32:
+		value = counts.NewCount64(uint64(n))
+	case uint:
+		value = counts.NewCount64(uint64(n))
+	case int:
+		if n < 0 {
+			return "", fmt.Errorf("can't format negative number %d", n)
+		}
+		value = counts.NewCount64(uint64(n))
+	case int64:
+		if n < 0 {
+			return "", fmt.Errorf("can't format negative number %d", n)
+		}
+		value = counts.NewCount64(uint64(n))
+	case float64:
+		if n < 0 || n > math.MaxUint64 {
+			return "", fmt.Errorf("can't format number %g", n)
+		}
+		value = counts.NewCount64(uint64(n))
+	default:
+		return "", fmt.Errorf("can't format %T as a number", n)
+	}
+	numeral, unitString := humaner.Format(value, unit)
+	return strings.TrimSpace(numeral + " " + unitString), nil
+}
+
+// ParseOutputTemplate parses `text` as a Go `text/template` for
+// formatting a `HistorySize` (see `HistorySize.WriteTemplate()`).
+// `name` is used in error messages. Referring to a statistic that
+// doesn't exist (e.g., `.Stats.noSuchSymbol`) is an error when the
+// template is executed.
+func ParseOutputTemplate(name, text string) (*template.Template, error) {
+	return template.New(name).
+		Funcs(templateFuncs).
+		Option("missingkey=error").
+		Parse(text)
+}
+
+// WriteTemplate writes `s` to `w`, formatted using `tmpl` (see
+// `ParseOutputTemplate()`). Nothing is written if executing the
+// template fails.
+func (s *HistorySize) WriteTemplate(
+	w io.Writer, tmpl *template.Template, refGroups []RefGroup, threshold Threshold,
+) error {
+	items := make(map[string]*item)
+	s.contents(refGroups).CollectItems(items)
+
+	data := TemplateData{
+		Stats:     make(map[string]*TemplateStatistic, len(items)),
+		Threshold: float64(threshold),
+		History:   s,
+	}
+	for symbol, i := range items {
+		stat := newTemplateStatistic(i, threshold)
+		data.Stats[symbol] = stat
+		data.Statistics = append(data.Statistics, stat)
+	}
+	sort.Slice(data.Statistics, func(i, j int) bool {
+		return data.Statistics[i].Symbol < data.Statistics[j].Symbol
+	})
+	if worst := s.worstStatistic(refGroups); worst != nil {
+		data.Worst = data.Stats[worst.Symbol]
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return err
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// newTemplateStatistic returns `i` in the form in which it is exposed
+// to output templates.
+func newTemplateStatistic(i *item, threshold Threshold) *TemplateStatistic {
+	value, _ := i.value.ToUint64()
+	valueString, unitString := i.format()
+	levelOfConcern, _ := i.levelOfConcern(0)
+	_, reported := i.levelOfConcern(threshold)
+
+	stat := TemplateStatistic{
+		Symbol:         i.symbol,
+		Label:          i.name,
+		Description:    i.description,
+		Value:          value,
+		Unit:           i.unit,
+		HumanValue:     strings.TrimSpace(valueString + " " + unitString),
+		ReferenceValue: i.scale,
+		LevelOfConcern: i.alertLevel(),
+		Stars:          levelOfConcern,
+		Reported:       reported,
+	}
+	if i.path != nil && i.path.OID != git.NullOID {
+		stat.ObjectName = i.path.OID.String()
+		stat.ObjectDescription = i.path.Path()
+	}
+	return &stat
+}
@@ -0,0 +1,218 @@
+package sizes
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/github/git-sizer/counts"
+	"github.com/github/git-sizer/git"
+)
+
+// BlobOrder is the criterion by which blobs are ranked for
+// `ScanOptions.TopBlobs`.
+type BlobOrder string
+
+const (
+	// BlobOrderSize ranks blobs by their size in bytes.
+	BlobOrderSize BlobOrder = "size"
+
+	// BlobOrderRefCount ranks blobs by the number of tree entries
+	// (in distinct trees) that refer to them.
+	BlobOrderRefCount BlobOrder = "refcount"
+)
+
+// RankedBlob describes one of the blobs in `TopBlobs`.
+type RankedBlob struct {
+	OID  git.OID        `json:"oid"`
+	Size counts.Count32 `json:"size"`
+
+	// RefCount is the number of tree entries that refer to the blob.
+	// It is only counted when ranking by `BlobOrderRefCount`.
+	RefCount counts.Count32 `json:"ref_count,omitempty"`
+
+	// Pack is the name of the packfile that contains the blob (the
+	// first by name, if there are several), or `LoosePack` if it is
+	// a loose object. It is only filled in by `ComputePackStats()`,
+	// and left empty if the blob wasn't found in either form (e.g.,
+	// because it is in an alternate object directory).
+	Pack string `json:"pack,omitempty"`
+
+	// Name is a `rev-parse`-style name for the blob (e.g.,
+	// `refs/heads/main:src/big.bin`), or "" if none is known.
+	Name string `json:"name,omitempty"`
+
+	// Path is the blob's path within the tree of the commit via
+	// which it was found, or "" if that isn't known.
+	Path string `json:"path,omitempty"`
+}
+
+// TopBlobs lists the top-ranked blobs, first ranked first.
+type TopBlobs struct {
+	By    BlobOrder    `json:"by"`
+	Blobs []RankedBlob `json:"blobs"`
+}
+
+// topBlobs keeps track of the `limit` top-ranked blobs seen so far.
+// Like `topTrees`, it only requests paths for those blobs, and
+// forgets them again when a blob drops out of the list.
+type topBlobs struct {
+	limit int
+	by    BlobOrder
+
+	// blobs holds the top-ranked blobs, sorted by decreasing key.
+	// Among blobs with the same key, the first one to reach it comes
+	// first.
+	blobs []topBlob
+}
+
+type topBlob struct {
+	oid  git.OID
+	key  counts.Count32
+	path *Path
+}
+
+// newTopBlobs returns a `*topBlobs` that keeps track of the `limit`
+// top-ranked blobs, or nil if `limit` is not positive.
+func newTopBlobs(limit int, by BlobOrder) *topBlobs {
+	if limit <= 0 {
+		return nil
+	}
+	return &topBlobs{limit: limit, by: by}
+}
+
+// update records that the key of the blob `oid` is now `key`. Keys
+// may only increase.
+func (t *topBlobs) update(pr PathResolver, oid git.OID, key counts.Count32) {
+	n := len(t.blobs)
+	if n == t.limit && key <= t.blobs[n-1].key {
+		// If the blob were already in the list, its old key would
+		// have been at least that of the last entry, so its new key
+		// would be greater.
+		return
+	}
+
+	var path *Path
+	for i, b := range t.blobs {
+		if b.oid == oid {
+			path = b.path
+			t.blobs = append(t.blobs[:i], t.blobs[i+1:]...)
+			break
+		}
+	}
+
+	n = len(t.blobs)
+	if path == nil {
+		if n == t.limit {
+			if p := t.blobs[n-1].path; p != nil {
+				pr.ForgetPath(p)
+			}
+			t.blobs = t.blobs[:n-1]
+			n--
+		}
+		path = pr.RequestPath(oid, "blob")
+	}
+
+	i := sort.Search(n, func(i int) bool { return t.blobs[i].key < key })
+	t.blobs = append(t.blobs, topBlob{})
+	copy(t.blobs[i+1:], t.blobs[i:])
+	t.blobs[i] = topBlob{oid: oid, key: key, path: path}
+}
+
+// result returns the top-ranked blobs. `g.blobSizes` must be filled
+// in, and all of the objects that might be along their paths must
+// have been recorded.
+func (t *topBlobs) result(g *Graph) *TopBlobs {
+	tb := TopBlobs{
+		By:    t.by,
+		Blobs: make([]RankedBlob, 0, len(t.blobs)),
+	}
+	for _, blob := range t.blobs {
+		size, _ := g.blobSizes.get(blob.oid)
+		b := RankedBlob{
+			OID:  blob.oid,
+			Size: size,
+		}
+		if t.by == BlobOrderRefCount {
+			b.RefCount = blob.key
+		}
+		if blob.path != nil {
+			b.Name = blob.path.Path()
+			if _, path, ok := blob.path.TreePath(); ok {
+				b.Path = path
+			}
+		}
+		tb.Blobs = append(tb.Blobs, b)
+	}
+	return &tb
+}
+
+// jsonV2 returns `tb` the way that it is represented in the version 2
+// JSON output, with camelCase names.
+func (tb *TopBlobs) jsonV2() interface{} {
+	type rankedBlob struct {
+		OID      git.OID        `json:"oid"`
+		Size     counts.Count32 `json:"size"`
+		RefCount counts.Count32 `json:"refCount,omitempty"`
+		Pack     string         `json:"pack,omitempty"`
+		Name     string         `json:"name,omitempty"`
+		Path     string         `json:"path,omitempty"`
+	}
+	blobs := make([]rankedBlob, len(tb.Blobs))
+	for i, rb := range tb.Blobs {
+		blobs[i] = rankedBlob(rb)
+	}
+	return struct {
+		By    BlobOrder    `json:"by"`
+		Blobs []rankedBlob `json:"blobs"`
+	}{
+		By:    tb.By,
+		Blobs: blobs,
+	}
+}
+
+// String returns a human-readable list of the top-ranked blobs.
+func (tb *TopBlobs) String() string {
+	if tb == nil {
+		return ""
+	}
+
+	buf := &bytes.Buffer{}
+	if tb.By == BlobOrderRefCount {
+		fmt.Fprintf(buf, "\nMost referenced blobs (%d):\n\n", len(tb.Blobs))
+	} else {
+		fmt.Fprintf(buf, "\nLargest blobs (%d):\n\n", len(tb.Blobs))
+	}
+
+	// If the blobs were attributed to packfiles, that is shown in a
+	// column after the OIDs:
+	packWidth := 0
+	for _, b := range tb.Blobs {
+		if len(b.Pack) > packWidth {
+			packWidth = len(b.Pack)
+		}
+	}
+
+	for _, b := range tb.Blobs {
+		numeral, unit := counts.Binary.Format(b.Size, "B")
+		size := strings.TrimSpace(numeral + " " + unit)
+		if tb.By == BlobOrderRefCount {
+			fmt.Fprintf(buf, "    %10d refs  %10s  %s", b.RefCount, size, b.OID)
+		} else {
+			fmt.Fprintf(buf, "    %10s  %s", size, b.OID)
+		}
+		if packWidth != 0 {
+			pack := b.Pack
+			if pack == "" {
+				pack = "-"
+			}
+			fmt.Fprintf(buf, "  %-*s", packWidth, pack)
+		}
+		if b.Name != "" {
+			fmt.Fprintf(buf, " (%s)", git.DisplayString(b.Name))
+		}
+		fmt.Fprintln(buf)
+	}
+	return buf.String()
+}
@@ -0,0 +1,159 @@
+package sizes
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// TrackedRun records the values of the statistics from one run, so
+// that a later run can report how they changed (see `ComputeGrowth()`).
+type TrackedRun struct {
+	// GitDir is the git directory of the repository that was scanned.
+	GitDir string `json:"git_dir"`
+
+	// Time is when the run finished.
+	Time time.Time `json:"time"`
+
+	// Values maps the symbol of each statistic (e.g.,
+	// "uniqueBlobSize") to its value.
+	Values map[string]uint64 `json:"values"`
+}
+
+// TrackedRun returns the values of the statistics in `s`, for
+// comparison by a later run.
+func (s *HistorySize) TrackedRun(refGroups []RefGroup, gitDir string, now time.Time) *TrackedRun {
+	items := make(map[string]*item)
+	s.contents(refGroups).CollectItems(items)
+
+	tr := TrackedRun{
+		GitDir: gitDir,
+		Time:   now,
+		Values: make(map[string]uint64, len(items)),
+	}
+	for symbol, i := range items {
+		tr.Values[symbol], _ = i.value.ToUint64()
+	}
+	return &tr
+}
+
+// ReadTrackedRun reads a `TrackedRun` in the format written by
+// `TrackedRun.Write()`.
+func ReadTrackedRun(r io.Reader) (*TrackedRun, error) {
+	var tr TrackedRun
+	if err := json.NewDecoder(r).Decode(&tr); err != nil {
+		return nil, fmt.Errorf("reading previous results: %w", err)
+	}
+	return &tr, nil
+}
+
+// Write writes `tr` to `w` as JSON.
+func (tr *TrackedRun) Write(w io.Writer) error {
+	j, err := json.MarshalIndent(tr, "", "    ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", j)
+	return err
+}
+
+// Growth lists the statistics whose values changed since a previous
+// run.
+type Growth struct {
+	// Since is when the previous run finished.
+	Since time.Time `json:"since"`
+
+	// Changes are the statistics that changed, ordered by symbol.
+	// Statistics that weren't computed in both runs are left out.
+	Changes []StatisticChange `json:"changes"`
+}
+
+// StatisticChange describes how the value of one statistic changed.
+type StatisticChange struct {
+	Symbol      string `json:"symbol"`
+	Description string `json:"description"`
+	Previous    uint64 `json:"previous"`
+	Current     uint64 `json:"current"`
+
+	// item is used for formatting the values as text.
+	item *item
+}
+
+// ComputeGrowth compares the statistics in `s` with those from
+// `previous`.
+func (s *HistorySize) ComputeGrowth(refGroups []RefGroup, previous *TrackedRun) *Growth {
+	items := make(map[string]*item)
+	s.contents(refGroups).CollectItems(items)
+
+	g := Growth{
+		Since:   previous.Time,
+		Changes: []StatisticChange{},
+	}
+	for symbol, i := range items {
+		prev, ok := previous.Values[symbol]
+		if !ok {
+			continue
+		}
+		value, _ := i.value.ToUint64()
+		if value == prev {
+			continue
+		}
+		g.Changes = append(g.Changes, StatisticChange{
+			Symbol:      symbol,
+			Description: i.description,
+			Previous:    prev,
+			Current:     value,
+			item:        i,
+		})
+	}
+	sort.Slice(g.Changes, func(i, j int) bool {
+		return g.Changes[i].Symbol < g.Changes[j].Symbol
+	})
+
+	return &g
+}
+
+// String returns a human-readable list of the statistics that
+// changed.
+func (g *Growth) String() string {
+	if g == nil {
+		return ""
+	}
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(
+		buf, "\nChanges since the previous run (%s):\n\n",
+		g.Since.Local().Format("2006-01-02 15:04:05"),
+	)
+	if len(g.Changes) == 0 {
+		fmt.Fprintln(buf, "    (none)")
+		return buf.String()
+	}
+	for _, c := range g.Changes {
+		fmt.Fprintf(
+			buf, "    %-30s  %12s  ->  %12s  (%s)\n",
+			c.Symbol, c.format(c.Previous), c.format(c.Current), c.difference(),
+		)
+	}
+	return buf.String()
+}
+
+// format returns `n` formatted like the statistic's value in the
+// table.
+func (c *StatisticChange) format(n uint64) string {
+	numeral, unit := c.item.humaner.FormatNumber(n, c.item.unit)
+	return strings.TrimSpace(numeral + " " + unit)
+}
+
+// difference returns the change in the statistic's value, with a
+// sign.
+func (c *StatisticChange) difference() string {
+	if c.Current < c.Previous {
+		return "-" + c.format(c.Previous-c.Current)
+	}
+	return "+" + c.format(c.Current-c.Previous)
+}
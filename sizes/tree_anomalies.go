@@ -0,0 +1,240 @@
+package sizes
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/github/git-sizer/counts"
+	"github.com/github/git-sizer/git"
+)
+
+// TreeAnomalies counts the trees that have the kinds of problems that
+// `git fsck` complains about, and that hosting services that check
+// pushed objects reject. They are often found in old histories that
+// were written by early or buggy tools. They don't affect the rest of
+// the scan. For each kind, the first tree found is given as an
+// example.
+type TreeAnomalies struct {
+	// Trees with more than one entry with the same name.
+	DuplicateEntriesCount counts.Count32 `json:"duplicate_entries_count"`
+	DuplicateEntriesTree  *Path          `json:"duplicate_entries_tree,omitempty"`
+
+	// Trees whose entries are not in the order that Git sorts them.
+	UnsortedCount counts.Count32 `json:"unsorted_count"`
+	UnsortedTree  *Path          `json:"unsorted_tree,omitempty"`
+
+	// Trees with entries whose mode is not one that Git writes (e.g.,
+	// 100664).
+	BadFilemodeCount counts.Count32 `json:"bad_filemode_count"`
+	BadFilemodeTree  *Path          `json:"bad_filemode_tree,omitempty"`
+
+	// Trees with entries whose mode is written with a leading zero
+	// (e.g., "040000").
+	ZeroPaddedFilemodeCount counts.Count32 `json:"zero_padded_filemode_count"`
+	ZeroPaddedFilemodeTree  *Path          `json:"zero_padded_filemode_tree,omitempty"`
+
+	// Trees with an entry named ".git" (in any case).
+	DotGitCount counts.Count32 `json:"dot_git_count"`
+	DotGitTree  *Path          `json:"dot_git_tree,omitempty"`
+
+	// Trees with an entry whose name is empty, ".", "..", or contains
+	// a slash.
+	BadNameCount counts.Count32 `json:"bad_name_count"`
+	BadNameTree  *Path          `json:"bad_name_tree,omitempty"`
+}
+
+// treeAnomaly is a set of the kinds of problems that `TreeAnomalies`
+// counts.
+type treeAnomaly uint8
+
+const (
+	duplicateEntries treeAnomaly = 1 << iota
+	unsortedEntries
+	badFilemode
+	zeroPaddedFilemode
+	dotGitEntry
+	badEntryName
+)
+
+// treeAnomalyChecker looks for anomalies in the entries of a tree,
+// which must be passed to `check()` in the order that they appear in
+// the tree. It only compares each entry with the one before, so
+// it is cheap enough to use for every tree.
+type treeAnomalyChecker struct {
+	found treeAnomaly
+
+	started    bool
+	prevName   string
+	prevIsTree bool
+}
+
+func (c *treeAnomalyChecker) check(entry git.TreeEntry) {
+	isTree := entry.Filemode&0o170000 == 0o40000
+
+	switch entry.Filemode {
+	case 0o100644, 0o100755, 0o120000, 0o40000, 0o160000:
+	default:
+		c.found |= badFilemode
+	}
+	if entry.ZeroPaddedFilemode {
+		c.found |= zeroPaddedFilemode
+	}
+
+	name := entry.Name
+	switch {
+	case name == "" || name == "." || name == ".." || strings.IndexByte(name, '/') != -1:
+		c.found |= badEntryName
+	case len(name) == 4 && strings.EqualFold(name, ".git"):
+		c.found |= dotGitEntry
+	}
+
+	if c.started {
+		switch {
+		case name == c.prevName:
+			c.found |= duplicateEntries
+		case compareTreeEntryNames(c.prevName, c.prevIsTree, name, isTree) > 0:
+			c.found |= unsortedEntries
+		}
+	}
+	c.started = true
+	c.prevName = name
+	c.prevIsTree = isTree
+}
+
+// compareTreeEntryNames compares two tree entry names the way that Git
+// orders them, namely bytewise, but with the names of trees treated
+// as if they ended with a slash.
+func compareTreeEntryNames(name1 string, isTree1 bool, name2 string, isTree2 bool) int {
+	n := len(name1)
+	if len(name2) < n {
+		n = len(name2)
+	}
+	if cmp := strings.Compare(name1[:n], name2[:n]); cmp != 0 {
+		return cmp
+	}
+
+	next := func(name string, isTree bool) byte {
+		switch {
+		case len(name) > n:
+			return name[n]
+		case isTree:
+			return '/'
+		default:
+			return 0
+		}
+	}
+	c1, c2 := next(name1, isTree1), next(name2, isTree2)
+	switch {
+	case c1 < c2:
+		return -1
+	case c1 > c2:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// recordTreeAnomalies records that the tree `oid` has the anomalies
+// in `found`.
+func (s *HistorySize) recordTreeAnomalies(g *Graph, oid git.OID, found treeAnomaly) {
+	ta := &s.TreeAnomalies
+	record := func(anomaly treeAnomaly, count *counts.Count32, example **Path) {
+		if found&anomaly == 0 {
+			return
+		}
+		count.Increment(1)
+		if *count == 1 {
+			setPath(g.pathResolver, example, oid, "tree")
+		}
+	}
+
+	record(duplicateEntries, &ta.DuplicateEntriesCount, &ta.DuplicateEntriesTree)
+	record(unsortedEntries, &ta.UnsortedCount, &ta.UnsortedTree)
+	record(badFilemode, &ta.BadFilemodeCount, &ta.BadFilemodeTree)
+	record(zeroPaddedFilemode, &ta.ZeroPaddedFilemodeCount, &ta.ZeroPaddedFilemodeTree)
+	record(dotGitEntry, &ta.DotGitCount, &ta.DotGitTree)
+	record(badEntryName, &ta.BadNameCount, &ta.BadNameTree)
+}
+
+// jsonV2 returns `ta` the way that it is represented in the version 2
+// JSON output, with camelCase names, and with each example tree given
+// by OID and, separately, by the path that it was found under.
+func (ta *TreeAnomalies) jsonV2() interface{} {
+	return struct {
+		DuplicateEntriesCount     counts.Count32 `json:"duplicateEntriesCount"`
+		DuplicateEntriesTree      string         `json:"duplicateEntriesTree,omitempty"`
+		DuplicateEntriesTreeRef   string         `json:"duplicateEntriesTreeRef,omitempty"`
+		UnsortedCount             counts.Count32 `json:"unsortedCount"`
+		UnsortedTree              string         `json:"unsortedTree,omitempty"`
+		UnsortedTreeRef           string         `json:"unsortedTreeRef,omitempty"`
+		BadFilemodeCount          counts.Count32 `json:"badFilemodeCount"`
+		BadFilemodeTree           string         `json:"badFilemodeTree,omitempty"`
+		BadFilemodeTreeRef        string         `json:"badFilemodeTreeRef,omitempty"`
+		ZeroPaddedFilemodeCount   counts.Count32 `json:"zeroPaddedFilemodeCount"`
+		ZeroPaddedFilemodeTree    string         `json:"zeroPaddedFilemodeTree,omitempty"`
+		ZeroPaddedFilemodeTreeRef string         `json:"zeroPaddedFilemodeTreeRef,omitempty"`
+		DotGitCount               counts.Count32 `json:"dotGitCount"`
+		DotGitTree                string         `json:"dotGitTree,omitempty"`
+		DotGitTreeRef             string         `json:"dotGitTreeRef,omitempty"`
+		BadNameCount              counts.Count32 `json:"badNameCount"`
+		BadNameTree               string         `json:"badNameTree,omitempty"`
+		BadNameTreeRef            string         `json:"badNameTreeRef,omitempty"`
+	}{
+		DuplicateEntriesCount:     ta.DuplicateEntriesCount,
+		DuplicateEntriesTree:      pathOID(ta.DuplicateEntriesTree),
+		DuplicateEntriesTreeRef:   pathRef(ta.DuplicateEntriesTree),
+		UnsortedCount:             ta.UnsortedCount,
+		UnsortedTree:              pathOID(ta.UnsortedTree),
+		UnsortedTreeRef:           pathRef(ta.UnsortedTree),
+		BadFilemodeCount:          ta.BadFilemodeCount,
+		BadFilemodeTree:           pathOID(ta.BadFilemodeTree),
+		BadFilemodeTreeRef:        pathRef(ta.BadFilemodeTree),
+		ZeroPaddedFilemodeCount:   ta.ZeroPaddedFilemodeCount,
+		ZeroPaddedFilemodeTree:    pathOID(ta.ZeroPaddedFilemodeTree),
+		ZeroPaddedFilemodeTreeRef: pathRef(ta.ZeroPaddedFilemodeTree),
+		DotGitCount:               ta.DotGitCount,
+		DotGitTree:                pathOID(ta.DotGitTree),
+		DotGitTreeRef:             pathRef(ta.DotGitTree),
+		BadNameCount:              ta.BadNameCount,
+		BadNameTree:               pathOID(ta.BadNameTree),
+		BadNameTreeRef:            pathRef(ta.BadNameTree),
+	}
+}
+
+// String returns a human-readable warning listing the kinds of
+// anomalies that were found, or the empty string if there were none.
+func (ta *TreeAnomalies) String() string {
+	kinds := []struct {
+		description string
+		count       counts.Count32
+		example     *Path
+	}{
+		{"duplicate entries", ta.DuplicateEntriesCount, ta.DuplicateEntriesTree},
+		{"entries out of order", ta.UnsortedCount, ta.UnsortedTree},
+		{"bad file modes", ta.BadFilemodeCount, ta.BadFilemodeTree},
+		{"zero-padded file modes", ta.ZeroPaddedFilemodeCount, ta.ZeroPaddedFilemodeTree},
+		{"'.git' entries", ta.DotGitCount, ta.DotGitTree},
+		{"bad entry names", ta.BadNameCount, ta.BadNameTree},
+	}
+
+	buf := &bytes.Buffer{}
+	for _, k := range kinds {
+		if k.count == 0 {
+			continue
+		}
+		if buf.Len() == 0 {
+			fmt.Fprint(
+				buf,
+				"\nWarning: some trees have problems that 'git fsck' reports, and that\n"+
+					"hosts that check pushed objects reject:\n\n",
+			)
+		}
+		fmt.Fprintf(buf, "    %-24s %8d tree(s)", k.description, k.count)
+		if k.example != nil {
+			fmt.Fprintf(buf, ", e.g., %s", k.example)
+		}
+		buf.WriteString("\n")
+	}
+	return buf.String()
+}
@@ -0,0 +1,332 @@
+package sizes
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/github/git-sizer/git"
+	"github.com/github/git-sizer/internal/pipe"
+)
+
+// ReachabilityLink is one of the objects in a chain that shows how an
+// object is reachable from a reference.
+type ReachabilityLink struct {
+	ObjectType git.ObjectType `json:"type"`
+	OID        git.OID        `json:"oid"`
+
+	// Name is a `rev-parse`-style name for the object (e.g.,
+	// `refs/heads/main~2^2:src/big.bin`) that follows the chain.
+	Name string `json:"name"`
+}
+
+// Reachability explains why an object is reachable (see
+// `ExplainReachability()`).
+type Reachability struct {
+	OID        git.OID        `json:"oid"`
+	ObjectType git.ObjectType `json:"type"`
+
+	// Reachable is true if the object is reachable from any of the
+	// scanned references.
+	Reachable bool `json:"reachable"`
+
+	// Ref is the reference that the object was found to be
+	// reachable from.
+	Ref string `json:"ref,omitempty"`
+
+	// Chain is the chain of objects leading from the commit that
+	// `Ref` points at to the object itself. The commits in between
+	// the first and the last one are not listed, but the latter's
+	// name says how to get there.
+	Chain []ReachabilityLink `json:"chain,omitempty"`
+}
+
+// Reachabilities lists the results of `ExplainReachability()`, in the
+// order that the objects were requested.
+type Reachabilities []Reachability
+
+// childLink records the child through which a commit was reached
+// during a walk, and which parent of that child it is (starting at
+// 1, as in `<rev>^<n>`).
+type childLink struct {
+	child  git.OID
+	parent int
+}
+
+// ExplainReachability finds, for each of the blobs, trees, and
+// commits `oids`, a chain of objects through which it is reachable
+// from one of the references that `rg` selects for walking. The
+// branch that `HEAD` refers to is tried first, then tags, then all
+// other references. References that don't point (possibly via
+// annotated tags) at commits are not considered.
+//
+// The history is walked once for each of those groups of references
+// (excluding what was already walked), and only the child through
+// which each commit was first reached is remembered, so that the
+// chain from the reference can be reconstructed without keeping
+// track of how every object was reached.
+func ExplainReachability(
+	ctx context.Context, repo *git.Repository, rg RefGrouper, oids []git.OID,
+) (Reachabilities, error) {
+	headers, err := repo.ObjectHeaders(ctx, oids)
+	if err != nil {
+		return nil, err
+	}
+	results := make(Reachabilities, len(oids))
+	pending := make(map[git.OID]int)
+	for i, header := range headers {
+		switch header.ObjectType {
+		case "blob", "tree", "commit":
+		case "missing":
+			return nil, fmt.Errorf("object %s does not exist", oids[i])
+		default:
+			return nil, fmt.Errorf(
+				"object %s is a %s; only blobs, trees, and commits are supported",
+				oids[i], header.ObjectType,
+			)
+		}
+		results[i] = Reachability{OID: oids[i], ObjectType: header.ObjectType}
+		pending[oids[i]] = i
+	}
+
+	phases, err := reachabilityPhases(ctx, repo, rg)
+	if err != nil {
+		return nil, err
+	}
+
+	var exclude []git.OID
+	for _, tips := range phases {
+		if len(pending) == 0 {
+			break
+		}
+		if len(tips) == 0 {
+			continue
+		}
+
+		roots := make([]git.OID, 0, len(tips))
+		for oid := range tips {
+			roots = append(roots, oid)
+		}
+
+		children := make(map[git.OID]childLink)
+		if err := repo.ForEachCommit(
+			ctx, roots, exclude,
+			func(oid git.OID, parents []git.OID) error {
+				for i, parent := range parents {
+					if _, ok := children[parent]; !ok {
+						children[parent] = childLink{child: oid, parent: i + 1}
+					}
+				}
+				return nil
+			},
+		); err != nil {
+			return nil, fmt.Errorf("walking commits: %w", err)
+		}
+
+		// The paths (and OIDs) of the objects that were first
+		// reached via the tree of `commit`:
+		var commit git.OID
+		var paths map[string]git.OID
+
+		if err := repo.ForEachObjectInCommitOrder(
+			ctx, roots, exclude,
+			func(oid git.OID, isCommit bool, path string) error {
+				if isCommit {
+					commit = oid
+					paths = make(map[string]git.OID)
+				} else {
+					paths[path] = oid
+				}
+
+				i, ok := pending[oid]
+				if !ok {
+					return nil
+				}
+				results[i].Reachable = true
+				results[i].Ref, results[i].Chain = reachabilityChain(
+					results[i], commit, path, paths, children, tips,
+				)
+				delete(pending, oid)
+				if len(pending) == 0 {
+					return pipe.FinishEarly
+				}
+				return nil
+			},
+		); err != nil {
+			return nil, fmt.Errorf("walking objects: %w", err)
+		}
+
+		exclude = append(exclude, roots...)
+	}
+
+	return results, nil
+}
+
+// reachabilityPhases returns the commits pointed at by the references
+// that `rg` selects for walking, in the order in which they should be
+// searched: first the branch that `HEAD` refers to, then tags, then
+// everything else. Each commit is mapped to the name by which it can
+// be referred to via its reference.
+func reachabilityPhases(
+	ctx context.Context, repo *git.Repository, rg RefGrouper,
+) ([]map[git.OID]string, error) {
+	head, err := repo.HeadRefname()
+	if err != nil {
+		return nil, err
+	}
+
+	refs, err := walkedReferences(ctx, repo, rg)
+	if err != nil {
+		return nil, err
+	}
+
+	oids := make([]git.OID, 0, len(refs))
+	for _, ref := range refs {
+		oids = append(oids, ref.OID)
+	}
+
+	peeled, err := repo.PeeledObjectHeaders(ctx, oids)
+	if err != nil {
+		return nil, err
+	}
+
+	phases := []map[git.OID]string{{}, {}, {}}
+	for i, ref := range refs {
+		if peeled[i].ObjectType != "commit" {
+			continue
+		}
+
+		var tips map[git.OID]string
+		switch {
+		case ref.Refname == head:
+			tips = phases[0]
+		case strings.HasPrefix(ref.Refname, "refs/tags/"):
+			tips = phases[1]
+		default:
+			tips = phases[2]
+		}
+
+		if _, ok := tips[peeled[i].OID]; ok {
+			continue
+		}
+		name := ref.Refname
+		if ref.ObjectType != "commit" {
+			name += "^{}"
+		}
+		tips[peeled[i].OID] = name
+	}
+
+	return phases, nil
+}
+
+// reachabilityChain returns the reference and chain of objects that
+// shows how `r.OID`, which was reached at `path` via the tree of
+// `commit`, is reachable from one of `tips`.
+func reachabilityChain(
+	r Reachability, commit git.OID, path string, paths map[string]git.OID,
+	children map[git.OID]childLink, tips map[git.OID]string,
+) (string, []ReachabilityLink) {
+	if r.ObjectType == "commit" {
+		commit = r.OID
+	}
+
+	// Follow the children up to a tip, remembering which parent was
+	// followed at each step:
+	var steps []int
+	tip := commit
+	for {
+		if _, ok := tips[tip]; ok {
+			break
+		}
+		link, ok := children[tip]
+		if !ok {
+			// This shouldn't happen, since every commit in the walk
+			// was reached from some tip.
+			return "", nil
+		}
+		steps = append(steps, link.parent)
+		tip = link.child
+	}
+
+	tipName := tips[tip]
+	chain := []ReachabilityLink{{ObjectType: "commit", OID: tip, Name: tipName}}
+
+	rev := tipName + ancestrySuffix(steps)
+	if commit != tip {
+		chain = append(chain, ReachabilityLink{ObjectType: "commit", OID: commit, Name: rev})
+	}
+	if r.ObjectType == "commit" {
+		return strings.TrimSuffix(tipName, "^{}"), chain
+	}
+
+	// The trees leading to the object, starting with the commit's
+	// tree. They were all reached for the first time via `commit`,
+	// too, since otherwise the object would have been reached
+	// earlier.
+	if path != "" {
+		components := strings.Split(path, "/")
+		for i := range components {
+			dir := strings.Join(components[:i], "/")
+			if oid, ok := paths[dir]; ok {
+				chain = append(chain, ReachabilityLink{ObjectType: "tree", OID: oid, Name: rev + ":" + dir})
+			}
+		}
+	}
+	chain = append(chain, ReachabilityLink{ObjectType: r.ObjectType, OID: r.OID, Name: rev + ":" + path})
+
+	return strings.TrimSuffix(tipName, "^{}"), chain
+}
+
+// ancestrySuffix returns the suffix (like `~2^2~1`) that leads from a
+// commit to one of its ancestors, where `steps` lists the parent
+// number followed at each step, starting from the ancestor.
+func ancestrySuffix(steps []int) string {
+	var buf strings.Builder
+	n := 0
+	for i := len(steps) - 1; i >= 0; i-- {
+		if steps[i] == 1 {
+			n++
+			continue
+		}
+		if n > 0 {
+			fmt.Fprintf(&buf, "~%d", n)
+			n = 0
+		}
+		fmt.Fprintf(&buf, "^%d", steps[i])
+	}
+	if n > 0 {
+		fmt.Fprintf(&buf, "~%d", n)
+	}
+	return buf.String()
+}
+
+// String returns a human-readable explanation of how each object is
+// reachable.
+func (rs Reachabilities) String() string {
+	buf := &bytes.Buffer{}
+	for i, r := range rs {
+		if i > 0 {
+			fmt.Fprintln(buf)
+		}
+		if !r.Reachable {
+			fmt.Fprintf(
+				buf, "%s %s is not reachable from any of the scanned references\n",
+				r.ObjectType, r.OID,
+			)
+			continue
+		}
+
+		fmt.Fprintf(
+			buf, "%s %s is reachable from %s:\n",
+			r.ObjectType, r.OID, git.DisplayString(r.Ref),
+		)
+		for _, link := range r.Chain {
+			fmt.Fprintf(
+				buf, "    %-6s  %s  %s\n",
+				link.ObjectType, link.OID, git.DisplayString(link.Name),
+			)
+		}
+	}
+	return buf.String()
+}
@@ -0,0 +1,120 @@
+package sizes
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/github/git-sizer/counts"
+	"github.com/github/git-sizer/git"
+)
+
+// WideTree describes one of the trees with the most entries.
+type WideTree struct {
+	OID     git.OID        `json:"oid"`
+	Entries counts.Count32 `json:"entries"`
+
+	// Name is a `rev-parse`-style name for the tree (e.g.,
+	// `refs/heads/main:src`), or "" if none is known.
+	Name string `json:"name,omitempty"`
+
+	// Commit and Path identify a commit via which the tree was found
+	// and the directory at which it appears in that commit's tree
+	// ("" for the root directory). Commit is nil if the tree wasn't
+	// found via a commit, or if names weren't requested.
+	Commit *git.OID `json:"commit,omitempty"`
+	Path   string   `json:"path"`
+}
+
+// WideTrees lists the trees with the most entries, widest first.
+type WideTrees []WideTree
+
+// topTrees keeps track of the `limit` widest trees seen so far.
+// Paths are only requested for those trees, and are forgotten again
+// when a tree drops out of the list, so the memory needed doesn't
+// grow with the size of the repository.
+type topTrees struct {
+	limit int
+
+	// trees holds the widest trees, sorted by decreasing number of
+	// entries. Among trees with the same number of entries, the
+	// first one seen comes first.
+	trees []topTree
+}
+
+type topTree struct {
+	oid     git.OID
+	entries counts.Count32
+	path    *Path
+}
+
+// newTopTrees returns a `*topTrees` that keeps track of the `limit`
+// widest trees, or nil if `limit` is not positive.
+func newTopTrees(limit int) *topTrees {
+	if limit <= 0 {
+		return nil
+	}
+	return &topTrees{limit: limit}
+}
+
+func (t *topTrees) add(pr PathResolver, oid git.OID, entries counts.Count32) {
+	n := len(t.trees)
+	if n == t.limit && entries <= t.trees[n-1].entries {
+		return
+	}
+
+	i := sort.Search(n, func(i int) bool { return t.trees[i].entries < entries })
+	if n == t.limit {
+		if p := t.trees[n-1].path; p != nil {
+			pr.ForgetPath(p)
+		}
+		t.trees = t.trees[:n-1]
+	}
+
+	t.trees = append(t.trees, topTree{})
+	copy(t.trees[i+1:], t.trees[i:])
+	t.trees[i] = topTree{
+		oid:     oid,
+		entries: entries,
+		path:    pr.RequestPath(oid, "tree"),
+	}
+}
+
+// result returns the widest trees. It must only be called after all
+// of the objects that might be along their paths have been recorded.
+func (t *topTrees) result() WideTrees {
+	wt := make(WideTrees, 0, len(t.trees))
+	for _, tree := range t.trees {
+		w := WideTree{
+			OID:     tree.oid,
+			Entries: tree.entries,
+		}
+		if tree.path != nil {
+			w.Name = tree.path.Path()
+			if commit, path, ok := tree.path.TreePath(); ok {
+				w.Commit = &commit
+				w.Path = path
+			}
+		}
+		wt = append(wt, w)
+	}
+	return wt
+}
+
+// String returns a human-readable list of the widest trees.
+func (wt WideTrees) String() string {
+	if wt == nil {
+		return ""
+	}
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "\nWidest trees (%d):\n\n", len(wt))
+	for _, w := range wt {
+		fmt.Fprintf(buf, "    %10d entries  %s", w.Entries, w.OID)
+		if w.Name != "" {
+			fmt.Fprintf(buf, " (%s)", git.DisplayString(w.Name))
+		}
+		fmt.Fprintln(buf)
+	}
+	return buf.String()
+}
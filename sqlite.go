@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+
+	"github.com/cli/safeexec"
+)
+
+// sqliteDatabase is an `io.WriteCloser` that feeds SQL statements to
+// an `sqlite3` process, which executes them against a database file.
+// The `sqlite3` command-line shell is used (rather than linking in an
+// SQLite library) so that git-sizer remains a pure-Go program that is
+// easy to cross-compile.
+type sqliteDatabase struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stderr bytes.Buffer
+}
+
+// openSQLiteDatabase starts an `sqlite3` process for the database at
+// `path`, which is created if it doesn't already exist. It stops at
+// the first SQL statement that fails.
+func openSQLiteDatabase(path string) (*sqliteDatabase, error) {
+	// Use `safeexec` for the same reason as for `git` (see
+	// `findGitBin()`):
+	sqliteBin, err := safeexec.LookPath("sqlite3")
+	if err != nil {
+		return nil, fmt.Errorf("'sqlite3' is required for --export-sqlite: %w", err)
+	}
+
+	db := &sqliteDatabase{}
+	db.cmd = exec.Command(sqliteBin, "-batch", "-bail", path)
+	db.cmd.Stderr = &db.stderr
+	db.stdin, err = db.cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := db.cmd.Start(); err != nil {
+		return nil, fmt.Errorf("running 'sqlite3': %w", err)
+	}
+	return db, nil
+}
+
+func (db *sqliteDatabase) Write(p []byte) (int, error) {
+	n, err := db.stdin.Write(p)
+	if err != nil {
+		// Most likely, `sqlite3` has died. Its own error message is
+		// more useful than "broken pipe":
+		if closeErr := db.Close(); closeErr != nil {
+			return n, closeErr
+		}
+	}
+	return n, err
+}
+
+// Close closes the input of the `sqlite3` process and waits for it
+// to finish.
+func (db *sqliteDatabase) Close() error {
+	_ = db.stdin.Close()
+	return db.wait()
+}
+
+func (db *sqliteDatabase) wait() error {
+	if db.cmd.ProcessState == nil {
+		if err := db.cmd.Wait(); err != nil {
+			if msg := strings.TrimSpace(db.stderr.String()); msg != "" {
+				return fmt.Errorf("'sqlite3' failed: %s", msg)
+			}
+			return fmt.Errorf("'sqlite3' failed: %w", err)
+		}
+	} else if !db.cmd.ProcessState.Success() {
+		return fmt.Errorf("'sqlite3' failed: %s", strings.TrimSpace(db.stderr.String()))
+	}
+	return nil
+}